@@ -0,0 +1,64 @@
+package auth
+
+import "strings"
+
+// PermissionWildcard 通配符（`*`/`*:*` 覆盖全部权限，`resource:*` 覆盖该资源的全部动作）
+const PermissionWildcard = "*"
+
+// PermissionCovers 判断已持有的权限 held 是否覆盖所需权限 required（大小写不敏感）。
+//
+// 规则：
+//   - 完全相同即覆盖；
+//   - `*` 或 `*:*` 覆盖任意权限；
+//   - `resource:*` 覆盖任意 `resource:action`；
+//   - 字面动作仅匹配自身（`user:read` 不覆盖 `user:write`，也不覆盖 `user:*`）。
+func PermissionCovers(held, required string) bool {
+	if held == "" || required == "" {
+		return false
+	}
+	if strings.EqualFold(held, required) {
+		return true
+	}
+	if held == PermissionWildcard || held == "*:*" {
+		return true
+	}
+	resource, ok := strings.CutSuffix(held, ":"+PermissionWildcard)
+	if !ok || resource == "" {
+		return false
+	}
+	prefix := resource + ":"
+	return len(required) > len(prefix) && strings.EqualFold(required[:len(prefix)], prefix)
+}
+
+// HasPermission 判断权限列表中是否有任一权限覆盖 required（规则见 PermissionCovers）。
+func HasPermission(permissions []string, required string) bool {
+	for _, held := range permissions {
+		if PermissionCovers(held, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermissionSetCovers 判断小写权限集合（见 GetPermissionSet）是否覆盖 required，按 O(1) 查找精确值与通配符。
+func PermissionSetCovers(set map[string]struct{}, required string) bool {
+	if required == "" {
+		return false
+	}
+	required = strings.ToLower(required)
+	for _, key := range permissionCandidates(required) {
+		if _, ok := set[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionCandidates 返回可覆盖 required 的持有权限键（精确值、`resource:*`、`*:*`、`*`）
+func permissionCandidates(required string) []string {
+	candidates := []string{required, "*:*", PermissionWildcard}
+	if i := strings.Index(required, ":"); i > 0 {
+		candidates = append(candidates, required[:i+1]+PermissionWildcard)
+	}
+	return candidates
+}
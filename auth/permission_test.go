@@ -0,0 +1,57 @@
+package auth
+
+import "testing"
+
+func TestPermissionCovers(t *testing.T) {
+	cases := []struct {
+		held     string
+		required string
+		want     bool
+	}{
+		{"user:read", "user:read", true},
+		{"User:Read", "user:read", true},
+		{"user:read", "user:write", false},
+		{"user:read", "user:*", false},
+		{"user:*", "user:read", true},
+		{"user:*", "USER:delete", true},
+		{"user:*", "role:read", false},
+		{"user:*", "username:read", false},
+		{"user:*", "user:", false},
+		{"*:*", "role:read", true},
+		{"*", "menu:write", true},
+		{":*", "user:read", false},
+		{"", "user:read", false},
+		{"user:*", "", false},
+	}
+	for _, c := range cases {
+		if got := PermissionCovers(c.held, c.required); got != c.want {
+			t.Errorf("PermissionCovers(%q, %q) = %v, want %v", c.held, c.required, got, c.want)
+		}
+	}
+}
+
+func TestPermissionSetCovers(t *testing.T) {
+	set := map[string]struct{}{"user:*": {}, "role:read": {}}
+	cases := []struct {
+		required string
+		want     bool
+	}{
+		{"user:read", true},
+		{"User:Delete", true},
+		{"role:read", true},
+		{"role:write", false},
+		{"menu:read", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		if got := PermissionSetCovers(set, c.required); got != c.want {
+			t.Errorf("PermissionSetCovers(%q) = %v, want %v", c.required, got, c.want)
+		}
+	}
+	if !PermissionSetCovers(map[string]struct{}{"*": {}}, "menu:read") {
+		t.Error("expected * to cover everything")
+	}
+	if !HasPermission([]string{"role:read", "user:*"}, "user:read") || HasPermission([]string{"user:read"}, "role:read") {
+		t.Error("unexpected HasPermission result")
+	}
+}
@@ -18,12 +18,19 @@ type Group struct {
 	domain.Timestamps
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 
+	// 操作者（取自请求上下文中的用户 ID；0 表示系统操作）
+	CreatedBy int64 `json:"created_by" gorm:"not null;default:0"`
+	UpdatedBy int64 `json:"updated_by" gorm:"not null;default:0"`
+
 	Name        string `json:"name" gorm:"size:100;not null"`
 	Description string `json:"description" gorm:"size:500"`
 	ParentID    *int64 `json:"parent_id" gorm:"index"`
 	Level       int    `json:"level" gorm:"default:1"`
 	Path        string `json:"path" gorm:"size:500"` // 层级路径，如: /1/2/3
 
+	// TenantID 所属租户（仓储按请求上下文中的租户自动隔离；空表示未隔离的存量数据）
+	TenantID string `json:"tenant_id,omitempty" gorm:"size:128;index;default:''"`
+
 	// 关联关系
 	Parent       *Group   `json:"parent,omitempty" gorm:"foreignKey:ParentID"`
 	Children     []*Group `json:"children,omitempty" gorm:"foreignKey:ParentID"`
@@ -66,6 +73,21 @@ func (g *Group) MarkAsDeleted()           { now := time.Now(); g.DeletedAt = &no
 func (g *Group) Restore()                 { g.DeletedAt = nil; g.UpdatedAt = time.Now() }
 func (g *Group) GetDeletedAt() *time.Time { return g.DeletedAt }
 
+// GetTenantID 返回所属租户（空表示未隔离）
+func (g *Group) GetTenantID() string { return g.TenantID }
+
+// SetTenantID 设置所属租户
+func (g *Group) SetTenantID(tenantID string) { g.TenantID = tenantID }
+
+// GetCreatedBy 返回创建者用户 ID
+func (g *Group) GetCreatedBy() int64 { return g.CreatedBy }
+
+// SetCreatedBy 设置创建者用户 ID
+func (g *Group) SetCreatedBy(userID int64) { g.CreatedBy = userID }
+
+// SetUpdatedBy 设置最后修改者用户 ID
+func (g *Group) SetUpdatedBy(userID int64) { g.UpdatedBy = userID }
+
 // IsRootGroup 检查是否为根组织
 func (g *Group) IsRootGroup() bool {
 	return g.ParentID == nil
@@ -0,0 +1,27 @@
+package entity
+
+import "time"
+
+const (
+	// GroupRoleEventAdded 添加组织默认角色
+	GroupRoleEventAdded = "added"
+	// GroupRoleEventRemoved 移除组织默认角色
+	GroupRoleEventRemoved = "removed"
+)
+
+// GroupRoleEvent 组织默认角色变更审计记录（group_role_events 表）
+//
+// ActorID 为执行操作的用户 ID（取自请求上下文，系统内部调用时为 0）。
+type GroupRoleEvent struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	GroupID   int64     `json:"group_id" gorm:"not null;index:idx_group_role_events_group_created,priority:1"`
+	RoleID    int64     `json:"role_id" gorm:"not null"`
+	Action    string    `json:"action" gorm:"size:20;not null"` // added/removed
+	ActorID   int64     `json:"actor_id" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;index:idx_group_role_events_group_created,priority:2"`
+}
+
+// TableName 指定表名
+func (*GroupRoleEvent) TableName() string {
+	return "group_role_events"
+}
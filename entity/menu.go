@@ -57,6 +57,12 @@ type MenuItem struct {
 	domain.Timestamps
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 
+	// 操作者（取自请求上下文中的用户 ID；0 表示系统操作）
+	CreatedBy int64 `json:"created_by" gorm:"not null;default:0"`
+	UpdatedBy int64 `json:"updated_by" gorm:"not null;default:0"`
+	// DeletedBy 软删操作者（恢复时清零）
+	DeletedBy int64 `json:"deleted_by" gorm:"not null;default:0"`
+
 	Code     string `json:"code" gorm:"size:100;uniqueIndex;not null"`
 	ParentID *int64 `json:"parent_id,omitempty" gorm:"index"`
 
@@ -99,7 +105,19 @@ func (m *MenuItem) Validate() error {
 		m.Type = MenuTypePage
 	}
 	switch m.Type {
-	case MenuTypeGroup, MenuTypePage, MenuTypeLink:
+	case MenuTypeGroup:
+		// 分组仅作为容器，不可导航
+		if m.Route != "" || m.Path != "" {
+			return errorx.New(errorx.Validation, "menu of type group must not set route or path")
+		}
+	case MenuTypePage:
+		if m.Route == "" {
+			return errorx.New(errorx.Validation, "menu of type page requires route")
+		}
+	case MenuTypeLink:
+		if m.Path == "" && m.Route == "" {
+			return errorx.New(errorx.Validation, "menu of type link requires path or route")
+		}
 	default:
 		return errorx.New(errorx.Validation, "menu type is invalid")
 	}
@@ -120,6 +138,15 @@ func (m *MenuItem) SetUpdatedAt(t time.Time) { m.UpdatedAt = t }
 func (m *MenuItem) IsDeleted() bool          { return m.DeletedAt != nil }
 func (m *MenuItem) GetDeletedAt() *time.Time { return m.DeletedAt }
 
+// GetCreatedBy 返回创建者用户 ID
+func (m *MenuItem) GetCreatedBy() int64 { return m.CreatedBy }
+
+// SetCreatedBy 设置创建者用户 ID
+func (m *MenuItem) SetCreatedBy(userID int64) { m.CreatedBy = userID }
+
+// SetUpdatedBy 设置最后修改者用户 ID
+func (m *MenuItem) SetUpdatedBy(userID int64) { m.UpdatedBy = userID }
+
 // SoftDelete 实现 domain.ISoftDeletable（用于启用默认 ORM Repo 的软删能力）。
 func (m *MenuItem) SoftDelete(at time.Time) error {
 	m.DeletedAt = &at
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// PasswordHistory 历史密码记录（password_history 表）
+//
+// 每次修改/重置密码时写入被替换的旧密码哈希，用于拒绝重复使用最近的密码；仅保留最近 N-1 条（当前密码计入 N，见 service.PasswordHistorySize）。
+type PasswordHistory struct {
+	ID           int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID       int64     `json:"user_id" gorm:"not null;index:idx_password_history_user_created,priority:1"`
+	PasswordHash string    `json:"-" gorm:"size:255;not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"not null;index:idx_password_history_user_created,priority:2"`
+}
+
+// TableName 指定表名
+func (*PasswordHistory) TableName() string {
+	return "password_history"
+}
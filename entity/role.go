@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"gochen-iam/auth"
+
 	"gochen/domain"
 	"gochen/domain/crud"
 	"gochen/errorx"
@@ -45,12 +47,21 @@ type Role struct {
 	domain.Timestamps
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 
+	// 操作者（取自请求上下文中的用户 ID；0 表示系统操作）
+	CreatedBy int64 `json:"created_by" gorm:"not null;default:0"`
+	UpdatedBy int64 `json:"updated_by" gorm:"not null;default:0"`
+
 	Code        string          `json:"code" gorm:"size:50;index"` // 稳定标识，默认与 Name 相同
 	Name        string          `json:"name" gorm:"uniqueIndex;size:50;not null"`
 	Description string          `json:"description" gorm:"size:500"`
 	Permissions PermissionArray `json:"permissions" gorm:"type:text;serializer:json"`
 	IsSystem    bool            `json:"is_system" gorm:"default:false"`
 	Status      string          `json:"status" gorm:"size:20;default:active"`
+	// ParentRoleID 父角色（角色继承）；为空表示无父角色，链路上不允许出现环
+	ParentRoleID *int64 `json:"parent_role_id,omitempty" gorm:"index"`
+
+	// TenantID 所属租户（仓储按请求上下文中的租户自动隔离；空表示未隔离的存量数据）
+	TenantID string `json:"tenant_id,omitempty" gorm:"size:128;index;default:''"`
 
 	// 关联关系
 	Users  []User  `json:"users,omitempty" gorm:"many2many:user_roles;"`
@@ -95,6 +106,21 @@ func (r *Role) MarkAsDeleted()           { now := time.Now(); r.DeletedAt = &now
 func (r *Role) Restore()                 { r.DeletedAt = nil; r.UpdatedAt = time.Now() }
 func (r *Role) GetDeletedAt() *time.Time { return r.DeletedAt }
 
+// GetTenantID 返回所属租户（空表示未隔离）
+func (r *Role) GetTenantID() string { return r.TenantID }
+
+// SetTenantID 设置所属租户
+func (r *Role) SetTenantID(tenantID string) { r.TenantID = tenantID }
+
+// GetCreatedBy 返回创建者用户 ID
+func (r *Role) GetCreatedBy() int64 { return r.CreatedBy }
+
+// SetCreatedBy 设置创建者用户 ID
+func (r *Role) SetCreatedBy(userID int64) { r.CreatedBy = userID }
+
+// SetUpdatedBy 设置最后修改者用户 ID
+func (r *Role) SetUpdatedBy(userID int64) { r.UpdatedBy = userID }
+
 // IsActive 检查角色是否激活
 func (r *Role) IsActive() bool {
 	return r.Status == "active"
@@ -110,22 +136,20 @@ func (r *Role) CanBeDeleted() bool {
 	return !r.IsSystem
 }
 
-// HasPermission 检查角色是否拥有指定权限
+// HasPermission 检查角色是否拥有指定权限（支持 `resource:*`、`*:*`、`*` 通配符，见 auth.PermissionCovers）
 func (r *Role) HasPermission(permission string) bool {
-	for _, perm := range r.Permissions {
-		if perm == permission {
-			return true
-		}
-	}
-	return false
+	return auth.HasPermission(r.Permissions, permission)
 }
 
-// AddPermission 添加权限
+// AddPermission 添加权限（按字面值去重，已被通配符覆盖的权限仍会显式添加）
 func (r *Role) AddPermission(permission string) {
-	if !r.HasPermission(permission) {
-		r.Permissions = append(r.Permissions, permission)
-		r.SetUpdatedAt(time.Now())
+	for _, perm := range r.Permissions {
+		if perm == permission {
+			return
+		}
 	}
+	r.Permissions = append(r.Permissions, permission)
+	r.SetUpdatedAt(time.Now())
 }
 
 // RemovePermission 移除权限
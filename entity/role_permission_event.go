@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// RolePermissionEvent 角色权限变更审计记录（role_permission_events 表）
+//
+// 每条记录保存一次编辑相对于编辑前的权限差异；ActorID 为执行操作的用户 ID（取自请求上下文，系统内部调用时为 0）。
+type RolePermissionEvent struct {
+	ID        int64           `json:"id" gorm:"primaryKey;autoIncrement"`
+	RoleID    int64           `json:"role_id" gorm:"not null;index:idx_role_permission_events_role_created,priority:1"`
+	Added     PermissionArray `json:"added" gorm:"type:text;serializer:json"`
+	Removed   PermissionArray `json:"removed" gorm:"type:text;serializer:json"`
+	ActorID   int64           `json:"actor_id" gorm:"not null;default:0"`
+	CreatedAt time.Time       `json:"created_at" gorm:"not null;index:idx_role_permission_events_role_created,priority:2"`
+}
+
+// TableName 指定表名
+func (*RolePermissionEvent) TableName() string {
+	return "role_permission_events"
+}
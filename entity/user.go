@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"sort"
+	"strings"
 	"time"
 
 	"gochen/domain"
@@ -9,18 +11,62 @@ import (
 	"gochen/validation"
 )
 
+const (
+	// LockReasonManual 管理员手动锁定
+	LockReasonManual = "manual"
+	// LockReasonFailedLogins 连续登录失败自动锁定
+	LockReasonFailedLogins = "failed_logins"
+)
+
 // User 用户实体
 type User struct {
 	crud.Entity[int64]
 	domain.Timestamps
-	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index:idx_users_status_deleted_at,priority:2"`
+
+	// 操作者（取自请求上下文中的用户 ID；0 表示系统操作）
+	CreatedBy int64 `json:"created_by" gorm:"not null;default:0"`
+	UpdatedBy int64 `json:"updated_by" gorm:"not null;default:0"`
+	// DeletedBy 软删操作者（恢复时清零）
+	DeletedBy int64 `json:"deleted_by" gorm:"not null;default:0"`
 
 	Username    string     `json:"username" gorm:"uniqueIndex;size:50;not null"`
 	Email       string     `json:"email" gorm:"uniqueIndex;size:100;not null"`
-	Password    string     `json:"password" gorm:"column:password_hash;size:255;not null"`
-	Status      string     `json:"status" gorm:"size:20;default:active"`
+	Password    string     `json:"-" gorm:"column:password_hash;size:255;not null"` // bcrypt 哈希，不参与 JSON 序列化/反序列化（设置密码须经服务层哈希，见 SetPassword）
+	Status      string     `json:"status" gorm:"size:20;default:active;index:idx_users_status_deleted_at,priority:1"`
 	Avatar      string     `json:"avatar" gorm:"size:500"`
 	LastLoginAt *time.Time `json:"last_login_at"`
+	// PreviousLoginAt 本次登录之前的上一次登录时间（用于“上次登录于”提示；首次登录为空）
+	PreviousLoginAt *time.Time `json:"previous_login_at"`
+
+	// 资料字段（可选）：显示名、E.164 手机号、BCP 47 语言区域
+	DisplayName string `json:"display_name,omitempty" gorm:"size:100"`
+	Phone       string `json:"phone,omitempty" gorm:"size:20"`
+	Locale      string `json:"locale,omitempty" gorm:"size:35"`
+
+	// UsernameCanonical/EmailCanonical 小写规范化的用户名与邮箱（仓储写入时同步，唯一索引保证不区分大小写的唯一性，查找按其等值比较）
+	UsernameCanonical string `json:"-" gorm:"size:50;uniqueIndex"`
+	EmailCanonical    string `json:"-" gorm:"size:100;uniqueIndex"`
+
+	// TenantID 所属租户（仓储按请求上下文中的租户自动隔离；空表示未隔离的存量数据）
+	TenantID string `json:"tenant_id,omitempty" gorm:"size:128;index;default:''"`
+
+	// 最近一次设置密码的时间（用于密码过期；存量数据为空时按注册时间计算）
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty" gorm:"index"`
+
+	// 登录失败锁定（临时锁定到期自动解除，不改变 Status）
+	FailedLoginCount int        `json:"failed_login_count" gorm:"not null;default:0"`
+	LockoutUntil     *time.Time `json:"lockout_until,omitempty"`
+
+	// 锁定原因与时间（manual：管理员锁定；failed_logins：连续登录失败自动锁定）
+	LockReason string     `json:"lock_reason,omitempty" gorm:"size:30"`
+	LockAt     *time.Time `json:"lock_at,omitempty"`
+
+	// TOTP 两步验证：密钥以密文存储，启用需经首次验证码确认
+	TOTPSecret       string `json:"-" gorm:"column:totp_secret;size:255"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled" gorm:"not null;default:false"`
+	// TOTPLastStep 最近一次通过校验的 TOTP 时间步（拒绝同一验证码重放）
+	TOTPLastStep int64 `json:"-" gorm:"column:totp_last_step;not null;default:0"`
 
 	// 关联关系
 	Groups []Group `json:"groups" gorm:"many2many:user_groups;"`
@@ -78,11 +124,31 @@ func (u *User) MarkAsDeleted()           { now := time.Now(); u.DeletedAt = &now
 func (u *User) Restore()                 { u.DeletedAt = nil; u.UpdatedAt = time.Now() }
 func (u *User) GetDeletedAt() *time.Time { return u.DeletedAt }
 
+// GetTenantID 返回所属租户（空表示未隔离）
+func (u *User) GetTenantID() string { return u.TenantID }
+
+// SetTenantID 设置所属租户
+func (u *User) SetTenantID(tenantID string) { u.TenantID = tenantID }
+
+// GetCreatedBy 返回创建者用户 ID
+func (u *User) GetCreatedBy() int64 { return u.CreatedBy }
+
+// SetCreatedBy 设置创建者用户 ID
+func (u *User) SetCreatedBy(userID int64) { u.CreatedBy = userID }
+
+// SetUpdatedBy 设置最后修改者用户 ID
+func (u *User) SetUpdatedBy(userID int64) { u.UpdatedBy = userID }
+
 // IsActive 检查用户是否激活
 func (u *User) IsActive() bool {
 	return u.Status == "active"
 }
 
+// IsPending 检查用户是否待激活（待审核或待验证邮箱）
+func (u *User) IsPending() bool {
+	return u.Status == "pending"
+}
+
 // IsLocked 检查用户是否被锁定
 func (u *User) IsLocked() bool {
 	return u.Status == "locked"
@@ -94,10 +160,33 @@ func (u *User) Activate() {
 	u.SetUpdatedAt(time.Now())
 }
 
-// Lock 锁定用户
+// Lock 锁定用户（记录为管理员手动锁定）
 func (u *User) Lock() {
+	now := time.Now()
 	u.Status = "locked"
-	u.SetUpdatedAt(time.Now())
+	u.LockReason = LockReasonManual
+	u.LockAt = &now
+	u.SetUpdatedAt(now)
+}
+
+// SetPassword 设置密码哈希并记录密码变更时间
+func (u *User) SetPassword(hashedPassword string, now time.Time) {
+	u.Password = hashedPassword
+	u.PasswordChangedAt = &now
+	u.SetUpdatedAt(now)
+}
+
+// PasswordExpiresAt 返回密码过期时间（maxAge <= 0 表示未启用密码过期，返回 nil）
+func (u *User) PasswordExpiresAt(maxAge time.Duration) *time.Time {
+	if maxAge <= 0 {
+		return nil
+	}
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
+	}
+	expiresAt := changedAt.Add(maxAge)
+	return &expiresAt
 }
 
 // Deactivate 停用用户
@@ -106,19 +195,66 @@ func (u *User) Deactivate() {
 	u.SetUpdatedAt(time.Now())
 }
 
-// Unlock 解锁用户（恢复为激活状态）
+// Unlock 解锁用户（恢复为激活状态，清除锁定原因）
 func (u *User) Unlock() {
 	u.Status = "active"
+	u.LockReason = ""
+	u.LockAt = nil
 	u.SetUpdatedAt(time.Now())
 }
 
-// UpdateLastLogin 更新最后登录时间
+// UpdateLastLogin 更新最后登录时间（原最后登录时间移入 PreviousLoginAt）
 func (u *User) UpdateLastLogin() {
 	now := time.Now()
+	u.PreviousLoginAt = u.LastLoginAt
 	u.LastLoginAt = &now
 	u.SetUpdatedAt(now)
 }
 
+// SyncCanonicalNames 根据用户名与邮箱同步小写规范化列（去除首尾空白后转小写）
+func (u *User) SyncCanonicalNames() {
+	u.UsernameCanonical = CanonicalName(u.Username)
+	u.EmailCanonical = CanonicalName(u.Email)
+}
+
+// CanonicalName 返回用户名/邮箱的规范化形式（去除首尾空白后转小写），用于唯一性与查找比较
+func CanonicalName(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// IsLockedOut 检查用户在指定时刻是否处于临时锁定期
+func (u *User) IsLockedOut(now time.Time) bool {
+	return u.LockoutUntil != nil && now.Before(*u.LockoutUntil)
+}
+
+// ApplyFailedLoginCount 应用数据库中递增后的登录失败计数；达到阈值时进入临时锁定，返回是否因此被锁定
+//
+// 计数由仓储原子递增（见 UserRepo.IncrementLoginFailures），此处只决定是否锁定；threshold <= 0 表示不锁定。
+func (u *User) ApplyFailedLoginCount(count int, now time.Time, threshold int, duration time.Duration) bool {
+	u.FailedLoginCount = count
+	if threshold > 0 && count >= threshold {
+		until := now.Add(duration)
+		u.LockoutUntil = &until
+		// 已被管理员锁定时保留原锁定原因
+		if !u.IsLocked() {
+			u.LockReason = LockReasonFailedLogins
+			u.LockAt = &now
+		}
+		return true
+	}
+	return false
+}
+
+// ResetFailedLogins 清除登录失败计数与临时锁定（仅清除自动锁定的原因，不影响手动锁定）
+func (u *User) ResetFailedLogins() {
+	u.FailedLoginCount = 0
+	u.LockoutUntil = nil
+	if u.LockReason == LockReasonFailedLogins {
+		u.LockReason = ""
+		u.LockAt = nil
+	}
+}
+
 // HasRole 检查用户是否拥有指定角色
 func (u *User) HasRole(roleName string) bool {
 	for _, role := range u.Roles {
@@ -129,7 +265,7 @@ func (u *User) HasRole(roleName string) bool {
 	return false
 }
 
-// HasPermission 检查用户是否拥有指定权限
+// HasPermission 检查用户是否拥有指定权限（支持通配符，见 Role.HasPermission）
 func (u *User) HasPermission(permission string) bool {
 	for _, role := range u.Roles {
 		if role.HasPermission(permission) {
@@ -139,7 +275,7 @@ func (u *User) HasPermission(permission string) bool {
 	return false
 }
 
-// GetAllPermissions 获取用户所有权限
+// GetAllPermissions 获取用户所有权限（去重并按字典序排序，输出与角色加载顺序无关）
 func (u *User) GetAllPermissions() []string {
 	permissionSet := make(map[string]bool)
 	var permissions []string
@@ -153,6 +289,7 @@ func (u *User) GetAllPermissions() []string {
 		}
 	}
 
+	sort.Strings(permissions)
 	return permissions
 }
 
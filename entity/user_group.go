@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// UserGroup 用户-组织成员关系（user_groups 关联表）
+//
+// 说明：
+// - User.Groups / Group.Users 的 many2many 关联仍由 ORM 维护（user_id/group_id）；
+// - JoinedAt 由仓储在加入组织时补写，历史数据可通过 GroupRepo.BackfillMembershipJoinedAt 回填。
+type UserGroup struct {
+	UserID   int64      `json:"user_id" gorm:"primaryKey"`
+	GroupID  int64      `json:"group_id" gorm:"primaryKey"`
+	JoinedAt *time.Time `json:"joined_at"`
+}
+
+// TableName 指定表名
+func (*UserGroup) TableName() string {
+	return "user_groups"
+}
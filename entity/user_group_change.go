@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+const (
+	// GroupMembershipJoined 加入组织
+	GroupMembershipJoined = "joined"
+	// GroupMembershipLeft 离开组织
+	GroupMembershipLeft = "left"
+)
+
+// UserGroupChange 用户组织成员关系变更记录（user_group_changes 表）
+//
+// user_groups 关联行在离开组织时被删除，加入/离开历史单独记录于此；
+// GroupName 为变更时的组织名称快照，组织后续改名或删除不影响历史展示。
+type UserGroupChange struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    int64     `json:"user_id" gorm:"not null;index:idx_user_group_changes_user_changed,priority:1"`
+	GroupID   int64     `json:"group_id" gorm:"not null"`
+	GroupName string    `json:"group_name" gorm:"size:100"`
+	Action    string    `json:"action" gorm:"size:20;not null"` // joined/left
+	ChangedAt time.Time `json:"changed_at" gorm:"not null;index:idx_user_group_changes_user_changed,priority:2"`
+}
+
+// TableName 指定表名
+func (*UserGroupChange) TableName() string {
+	return "user_group_changes"
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// UserRoleAssignment 用户-角色分配关系（user_roles 关联表）
+//
+// 说明：
+// - User.Roles / Role.Users 的 many2many 关联仍由 ORM 维护（user_id/role_id）；
+// - ExpiresAt 为空表示永久分配；到期后不再计入有效角色，可由 RoleRepo.PurgeExpiredUserRoles 清理；
+// - GroupID 为空表示全局分配；非空时仅在该组织及其子组织范围内生效（见 UserService.CheckPermissionInGroup），全局鉴权快照仍合并所有分配；
+// - 每个用户-角色仅有一条分配，即同一角色只能限定于一个组织；
+// - SourceGroupID 非空表示该分配因加入组织而由组织默认角色自动授予（见 service.GrantGroupDefaultRoles），离开组织时可回收；直接分配为空。
+type UserRoleAssignment struct {
+	UserID        int64      `json:"user_id" gorm:"primaryKey"`
+	RoleID        int64      `json:"role_id" gorm:"primaryKey"`
+	ExpiresAt     *time.Time `json:"expires_at" gorm:"index"`
+	GroupID       *int64     `json:"group_id,omitempty" gorm:"index"`
+	SourceGroupID *int64     `json:"source_group_id,omitempty" gorm:"index"`
+}
+
+// TableName 指定表名
+func (*UserRoleAssignment) TableName() string {
+	return "user_roles"
+}
+
+// IsExpired 检查分配在 now 时刻是否已过期（永久分配永不过期）
+func (ur *UserRoleAssignment) IsExpired(now time.Time) bool {
+	return ur.ExpiresAt != nil && !ur.ExpiresAt.After(now)
+}
@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+const (
+	// RoleChangeGranted 授予角色
+	RoleChangeGranted = "granted"
+	// RoleChangeRevoked 移除角色
+	RoleChangeRevoked = "revoked"
+)
+
+// UserRoleChange 用户角色变更记录（user_role_changes 表）
+//
+// 记录直接授予/移除用户角色的历史，供用户查看自身权限变化；
+// RoleName 为变更时的角色名称快照，角色后续改名或删除不影响历史展示。
+type UserRoleChange struct {
+	ID        int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    int64     `json:"user_id" gorm:"not null;index:idx_user_role_changes_user_changed,priority:1"`
+	RoleID    int64     `json:"role_id" gorm:"not null"`
+	RoleName  string    `json:"role_name" gorm:"size:100"`
+	Action    string    `json:"action" gorm:"size:20;not null"` // granted/revoked
+	ChangedAt time.Time `json:"changed_at" gorm:"not null;index:idx_user_role_changes_user_changed,priority:2"`
+}
+
+// TableName 指定表名
+func (*UserRoleChange) TableName() string {
+	return "user_role_changes"
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// UserTenant 用户-租户成员关系（user_tenants 关联表）
+//
+// 多租户模式下一个用户可属于多个租户，用于构建租户切换列表。
+type UserTenant struct {
+	UserID   int64      `json:"user_id" gorm:"primaryKey"`
+	TenantID int64      `json:"tenant_id" gorm:"primaryKey;index"`
+	JoinedAt *time.Time `json:"joined_at"`
+}
+
+// TableName 指定表名
+func (*UserTenant) TableName() string {
+	return "user_tenants"
+}
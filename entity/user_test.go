@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPasswordHash = "$2a$10$abcdefghijklmnopqrstuuSECRETHASHVALUE"
+
+func TestUserJSONNeverContainsPasswordHash(t *testing.T) {
+	user := &User{Username: "alice", Email: "alice@example.com", TOTPSecret: "totp-secret"}
+	user.SetPassword(testPasswordHash, time.Now())
+	role := &Role{Name: "r", Users: make([]User, 1)}
+	role.Users[0].Username = user.Username
+	role.Users[0].SetPassword(testPasswordHash, time.Now())
+
+	for name, v := range map[string]any{
+		"pointer":     user,
+		"slice":       []*User{user},
+		"group_users": &Group{Name: "g", Users: []*User{user}},
+		"role_users":  role,
+		"map":         map[string]any{"user": user},
+	} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", name, err)
+		}
+		body := string(data)
+		if strings.Contains(body, testPasswordHash) || strings.Contains(body, "totp-secret") {
+			t.Fatalf("%s: JSON leaks secrets: %s", name, body)
+		}
+		if strings.Contains(body, `"password"`) {
+			t.Fatalf("%s: JSON contains password key: %s", name, body)
+		}
+		if !strings.Contains(body, `"username":"alice"`) {
+			t.Fatalf("%s: expected username in JSON: %s", name, body)
+		}
+	}
+}
+
+func TestUserJSONIgnoresIncomingPassword(t *testing.T) {
+	var user User
+	if err := json.Unmarshal([]byte(`{"username":"bob","password":"plaintext"}`), &user); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if user.Username != "bob" || user.Password != "" {
+		t.Fatalf("expected password to be ignored, got username=%q password=%q", user.Username, user.Password)
+	}
+}
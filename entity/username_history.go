@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// UsernameHistory 用户名变更记录（username_history 表）
+//
+// 每次改名时写入旧用户名与新用户名，用于审计；ChangedBy 为操作者用户 ID（系统操作为 0）。
+type UsernameHistory struct {
+	ID          int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      int64     `json:"user_id" gorm:"not null;index:idx_username_history_user_changed,priority:1"`
+	OldUsername string    `json:"old_username" gorm:"size:50;not null"`
+	NewUsername string    `json:"new_username" gorm:"size:50;not null"`
+	ChangedBy   int64     `json:"changed_by" gorm:"not null;default:0"`
+	ChangedAt   time.Time `json:"changed_at" gorm:"not null;index:idx_username_history_user_changed,priority:2"`
+}
+
+// TableName 指定表名
+func (*UsernameHistory) TableName() string {
+	return "username_history"
+}
@@ -0,0 +1,17 @@
+package event
+
+import "time"
+
+// RolePermissionsChanged 角色权限变更事件负载（Added/Removed 为相对变更前的差异）
+type RolePermissionsChanged struct {
+	RoleID    int64     `json:"role_id"`
+	RoleCode  string    `json:"role_code"`
+	Added     []string  `json:"added"`
+	Removed   []string  `json:"removed"`
+	ActorID   int64     `json:"actor_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func (e RolePermissionsChanged) GetType() string {
+	return "RolePermissionsChanged"
+}
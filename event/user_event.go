@@ -24,3 +24,59 @@ type UserRoleRemoved struct {
 func (e UserRoleRemoved) GetType() string {
 	return "UserRoleRemoved"
 }
+
+// UserRegistered 用户注册事件负载
+type UserRegistered struct {
+	UserID       int64     `json:"user_id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	Status       string    `json:"status"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+func (e UserRegistered) GetType() string {
+	return "UserRegistered"
+}
+
+// UserDeactivated 用户停用事件负载
+type UserDeactivated struct {
+	UserID        int64     `json:"user_id"`
+	DeactivatedAt time.Time `json:"deactivated_at"`
+}
+
+func (e UserDeactivated) GetType() string {
+	return "UserDeactivated"
+}
+
+// UserLocked 用户锁定事件负载（Reason：manual 管理员锁定 / failed_logins 连续登录失败自动锁定）
+type UserLocked struct {
+	UserID   int64      `json:"user_id"`
+	Reason   string     `json:"reason"`
+	LockedAt time.Time  `json:"locked_at"`
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+func (e UserLocked) GetType() string {
+	return "UserLocked"
+}
+
+// UserUnlocked 用户解锁事件负载
+type UserUnlocked struct {
+	UserID     int64     `json:"user_id"`
+	UnlockedAt time.Time `json:"unlocked_at"`
+}
+
+func (e UserUnlocked) GetType() string {
+	return "UserUnlocked"
+}
+
+// PasswordChanged 用户密码变更事件负载（Source：change 用户修改 / reset 重置令牌）
+type PasswordChanged struct {
+	UserID    int64     `json:"user_id"`
+	Source    string    `json:"source"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func (e PasswordChanged) GetType() string {
+	return "PasswordChanged"
+}
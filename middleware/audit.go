@@ -9,9 +9,9 @@ import (
 	"gochen/metadata"
 )
 
-// AuditRecord 表示一次鉴权/授权决策的审计记录（默认仅记录 deny）。
+// AuditRecord 表示一次鉴权/授权决策的审计记录（默认仅记录 deny；AUTH_AUDIT_ALL 开启后同时记录 allow）。
 type AuditRecord struct {
-	Decision   string // "deny" | "allow"（当前默认只写 deny）
+	Decision   string // "deny" | "allow"
 	Reason     string // 业务可读原因
 	Path       string
 	Method     string
@@ -37,6 +37,12 @@ func isAuditLogEnabled() bool {
 	return v == "" || v == "true" || v == "1"
 }
 
+// isAuditAllEnabled 是否同时记录 allow 决策（AUTH_AUDIT_ALL，默认关闭：放行请求量大，按需开启）
+func isAuditAllEnabled() bool {
+	v := os.Getenv("AUTH_AUDIT_ALL")
+	return v == "true" || v == "1"
+}
+
 // SetAuditSink 设置审计落点（线程安全：装配期调用即可）。
 func SetAuditSink(sink AuditSink) {
 	auditSink = sink
@@ -50,6 +56,20 @@ func SetAuditLogger(logger logging.ILogger) {
 }
 
 func recordAuthzDenied(ctx httpx.IContext, rec AuditRecord) {
+	rec.Decision = "deny"
+	recordAuthzDecision(ctx, rec)
+}
+
+// recordAuthzAllowed 记录放行决策（仅在 AUTH_AUDIT_ALL 开启时写入）
+func recordAuthzAllowed(ctx httpx.IContext, rec AuditRecord) {
+	if !isAuditAllEnabled() {
+		return
+	}
+	rec.Decision = "allow"
+	recordAuthzDecision(ctx, rec)
+}
+
+func recordAuthzDecision(ctx httpx.IContext, rec AuditRecord) {
 	if ctx == nil {
 		return
 	}
@@ -71,15 +91,21 @@ func recordAuthzDenied(ctx httpx.IContext, rec AuditRecord) {
 		auditSink.Record(stdCtx, rec)
 	}
 
-	if auditLogger != nil && isAuditLogEnabled() {
-		auditLogger.Warn(stdCtx, "[authz] denied",
-			logging.String("reason", rec.Reason),
-			logging.String("path", rec.Path),
-			logging.String("method", rec.Method),
-			logging.Int64("user_id", rec.UserID),
-			logging.String("tenant_id", rec.TenantID),
-			logging.String("role", rec.Role),
-			logging.String("permission", rec.Permission),
-		)
+	if auditLogger == nil || !isAuditLogEnabled() {
+		return
+	}
+	fields := []logging.Field{
+		logging.String("reason", rec.Reason),
+		logging.String("path", rec.Path),
+		logging.String("method", rec.Method),
+		logging.Int64("user_id", rec.UserID),
+		logging.String("tenant_id", rec.TenantID),
+		logging.String("role", rec.Role),
+		logging.String("permission", rec.Permission),
+	}
+	if rec.Decision == "allow" {
+		auditLogger.Info(stdCtx, "[authz] allowed", fields...)
+		return
 	}
+	auditLogger.Warn(stdCtx, "[authz] denied", fields...)
 }
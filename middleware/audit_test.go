@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuditSink_Decisions(t *testing.T) {
+	sink := &capturingAuditSink{}
+	SetAuditSink(sink)
+	defer SetAuditSink(nil)
+	t.Setenv("AUTH_AUDIT_LOG", "false")
+	RegisterRequiredPermissions("audit:read")
+
+	config := &AuthConfig{SecretKey: "audit-sink-secret", TokenHeader: "Authorization", TokenPrefix: "Bearer "}
+	authMW := AuthMiddleware(config)
+	permMW := PermissionMiddleware("audit:read")
+
+	call := func(token string) error {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/audit", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		ctx, err := nethttp.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		return authMW(ctx, func() error {
+			return permMW(ctx, func() error { return nil })
+		})
+	}
+	issue := func(permissions ...string) string {
+		token, err := GenerateToken(8101, "auditor", []string{"user"}, permissions, config.SecretKey)
+		if err != nil {
+			t.Fatalf("GenerateToken failed: %v", err)
+		}
+		return token
+	}
+
+	// 缺少 token：deny
+	if err := call(""); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized, got %v", err)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("expected 1 record, got %+v", sink.records)
+	}
+	if rec := sink.records[0]; rec.Decision != "deny" || rec.Path != "/api/v1/audit" || rec.Method != http.MethodGet || rec.UserID != 0 {
+		t.Fatalf("unexpected missing-token record: %+v", rec)
+	}
+
+	// 缺少权限：deny，带用户与所需权限
+	sink.records = nil
+	if err := call(issue()); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden, got %v", err)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("expected 1 record, got %+v", sink.records)
+	}
+	if rec := sink.records[0]; rec.Decision != "deny" || rec.UserID != 8101 || rec.Permission != "audit:read" {
+		t.Fatalf("unexpected missing-permission record: %+v", rec)
+	}
+
+	// 默认不记录 allow
+	sink.records = nil
+	if err := call(issue("audit:read")); err != nil {
+		t.Fatalf("expected allowed, got %v", err)
+	}
+	if len(sink.records) != 0 {
+		t.Fatalf("expected no allow records by default, got %+v", sink.records)
+	}
+
+	// AUTH_AUDIT_ALL 开启后记录 allow（认证 + 授权各一条）
+	t.Setenv("AUTH_AUDIT_ALL", "true")
+	if err := call(issue("audit:read")); err != nil {
+		t.Fatalf("expected allowed, got %v", err)
+	}
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 allow records, got %+v", sink.records)
+	}
+	for _, rec := range sink.records {
+		if rec.Decision != "allow" || rec.UserID != 8101 || rec.Path != "/api/v1/audit" || rec.Method != http.MethodGet {
+			t.Fatalf("unexpected allow record: %+v", rec)
+		}
+	}
+	if sink.records[1].Permission != "audit:read" {
+		t.Fatalf("expected permission on allow record, got %+v", sink.records[1])
+	}
+}
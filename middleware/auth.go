@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,15 +19,32 @@ import (
 
 const (
 	envAccessTokenTTL      = "AUTH_ACCESS_TOKEN_TTL"
+	envRefreshTokenTTL     = "AUTH_REFRESH_TOKEN_TTL"
 	envAllowQueryToken     = "AUTH_ALLOW_QUERY_TOKEN"
 	envRequireTenant       = "AUTH_REQUIRE_TENANT"
 	envAllowTenantQuery    = "AUTH_ALLOW_TENANT_QUERY"
 	envTenantHeader        = "AUTH_TENANT_HEADER"
+	envMaxSessions         = "AUTH_MAX_CONCURRENT_SESSIONS"
+	envSessionLimitPolicy  = "AUTH_SESSION_LIMIT_POLICY"
+	envSkipPaths           = "AUTH_SKIP_PATHS"
 	defaultAccessTokenTTL  = 24 * time.Hour
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	defaultMFATokenTTL     = 5 * time.Minute
 	defaultTenantHeaderKey = httpx.HeaderTenantID
 )
 
+const (
+	// TokenTypeAccess 访问令牌（历史签发、未携带 token_type 的令牌按访问令牌处理）
+	TokenTypeAccess = "access"
+	// TokenTypeRefresh 刷新令牌：仅可用于 /auth/refresh 换取访问令牌
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFA 两步验证挑战令牌：密码校验通过后签发，仅可用于提交第二因子
+	TokenTypeMFA = "mfa"
+)
+
 // AuthConfig 认证配置
+//
+// SkipPaths 为免鉴权路径：默认精确匹配（忽略末尾 /）；以 `*` 结尾表示前缀匹配（如 `/api/v1/public/*`）。
 type AuthConfig struct {
 	SecretKey    string   `json:"secret_key" yaml:"secret_key"`
 	TokenHeader  string   `json:"token_header" yaml:"token_header"`
@@ -33,10 +53,16 @@ type AuthConfig struct {
 	RequiredRole string   `json:"required_role" yaml:"required_role"`
 
 	AccessTokenTTL   time.Duration `json:"-" yaml:"-"`
+	RefreshTokenTTL  time.Duration `json:"-" yaml:"-"`
 	AllowQueryToken  bool          `json:"-" yaml:"-"`
 	RequireTenant    bool          `json:"-" yaml:"-"`
 	AllowTenantQuery bool          `json:"-" yaml:"-"`
 	TenantHeader     string        `json:"-" yaml:"-"`
+
+	// MaxConcurrentSessions 每个用户的最大并发会话数（<=0 不限制，见 StartSession）
+	MaxConcurrentSessions int `json:"-" yaml:"-"`
+	// SessionLimitPolicy 达到上限时的策略：reject（默认）/ evict_oldest
+	SessionLimitPolicy string `json:"-" yaml:"-"`
 }
 
 // DefaultAuthConfig 默认认证配置
@@ -51,27 +77,91 @@ func DefaultAuthConfig() *AuthConfig {
 		}
 	}
 
+	refreshTTL := defaultRefreshTokenTTL
+	if v := os.Getenv(envRefreshTokenTTL); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			refreshTTL = d
+		}
+	}
+
 	tenantHeader := os.Getenv(envTenantHeader)
 	if tenantHeader == "" {
 		tenantHeader = defaultTenantHeaderKey
 	}
 
+	maxSessions := 0
+	if v := os.Getenv(envMaxSessions); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxSessions = n
+		}
+	}
+
+	sessionPolicy := SessionLimitPolicyReject
+	if os.Getenv(envSessionLimitPolicy) == SessionLimitPolicyEvictOldest {
+		sessionPolicy = SessionLimitPolicyEvictOldest
+	}
+
 	return &AuthConfig{
 		SecretKey:        secret,
 		TokenHeader:      "Authorization",
 		TokenPrefix:      "Bearer ",
 		AccessTokenTTL:   ttl,
+		RefreshTokenTTL:  refreshTTL,
 		AllowQueryToken:  (os.Getenv(envAllowQueryToken) == "true" || os.Getenv(envAllowQueryToken) == "1") && isDevEnv(),
 		RequireTenant:    os.Getenv(envRequireTenant) == "true" || os.Getenv(envRequireTenant) == "1",
 		AllowTenantQuery: os.Getenv(envAllowTenantQuery) == "true" || os.Getenv(envAllowTenantQuery) == "1",
 		TenantHeader:     tenantHeader,
-		SkipPaths: []string{
+
+		MaxConcurrentSessions: maxSessions,
+		SessionLimitPolicy:    sessionPolicy,
+		SkipPaths: append([]string{
 			"/api/v1/auth/login",
+			"/api/v1/auth/login/2fa",
 			"/api/v1/auth/register",
+			"/api/v1/auth/availability",
+			"/api/v1/auth/break-glass",
 			"/api/v1/health",
 			"/api/v1/ping",
-		},
+		}, skipPathsFromEnv()...),
+	}
+}
+
+// skipPathsFromEnv 读取额外的免鉴权路径（AUTH_SKIP_PATHS，逗号分隔，规则同 SkipPaths）
+func skipPathsFromEnv() []string {
+	var paths []string
+	for _, p := range strings.Split(os.Getenv(envSkipPaths), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// matchSkipPath 判断请求路径是否命中免鉴权路径
+//
+// 条目以 `*` 结尾时按前缀匹配（`/api/v1/public/*` 命中 `/api/v1/public/x`），否则精确匹配（忽略末尾 /），
+// 避免 `/api/v1/health` 误放行 `/api/v1/healthz-internal` 之类的相邻路径。
+func matchSkipPath(path string, skipPaths []string) bool {
+	path = trimTrailingSlash(path)
+	for _, skipPath := range skipPaths {
+		if prefix, ok := strings.CutSuffix(skipPath, "*"); ok {
+			if prefix != "" && strings.HasPrefix(path, prefix) {
+				return true
+			}
+			continue
+		}
+		if skipPath != "" && path == trimTrailingSlash(skipPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimTrailingSlash(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
 	}
+	return path
 }
 
 // isDevEnv 检查是否为开发/测试环境
@@ -121,11 +211,8 @@ func AuthMiddleware(config *AuthConfig) httpx.Middleware {
 		}
 
 		// 检查是否需要跳过认证
-		path := ctx.GetPath()
-		for _, skipPath := range config.SkipPaths {
-			if strings.HasPrefix(path, skipPath) {
-				return next()
-			}
+		if matchSkipPath(ctx.GetPath(), config.SkipPaths) {
+			return next()
 		}
 
 		// 严格权限字典：运行期兜底 fail-close（防止上层装配期校验遗漏/被吞掉）。
@@ -135,7 +222,7 @@ func AuthMiddleware(config *AuthConfig) httpx.Middleware {
 		}
 
 		// 获取 token（必需鉴权：无 token 直接拒绝；如需可选鉴权请使用 OptionalAuthMiddleware）
-		token := extractToken(ctx, config)
+		token := ExtractToken(ctx, config)
 		if token == "" {
 			recordAuthzDenied(ctx, AuditRecord{
 				Decision: "deny",
@@ -157,27 +244,10 @@ func AuthMiddleware(config *AuthConfig) httpx.Middleware {
 		reqCtx := ctx.GetContext()
 		reqCtx = hbasic.WithUserID(reqCtx, claims.UserID)
 
-		tenantID := ctx.GetHeader(config.TenantHeader)
-		if tenantID == "" && config.AllowTenantQuery {
-			tenantID = ctx.GetQuery("tenant_id")
-		}
-		if tenantID == "" && config.RequireTenant {
-			recordAuthzDenied(ctx, AuditRecord{
-				Decision: "deny",
-				Reason:   "tenant_id is required",
-			})
-			return errorx.New(errorx.Validation, "tenant_id is required")
-		}
-		if tenantID != "" {
-			derived, err := hbasic.WithTenantID(reqCtx, tenantID)
-			if err != nil {
-				recordAuthzDenied(ctx, AuditRecord{
-					Decision: "deny",
-					Reason:   "invalid tenant_id",
-				})
-				return err
-			}
-			reqCtx = derived
+		// 租户取自令牌签名声明或经校验的成员关系（见 resolveRequestTenant）
+		reqCtx, err = applyRequestTenant(ctx, reqCtx, config, claims)
+		if err != nil {
+			return err
 		}
 
 		// 注入角色与权限信息，供后续 RBAC 使用
@@ -185,6 +255,7 @@ func AuthMiddleware(config *AuthConfig) httpx.Middleware {
 		reqCtx = auth.WithPermissions(reqCtx, claims.Permissions)
 
 		ctx.SetContext(reqCtx)
+		recordAuthzAllowed(ctx, AuditRecord{Reason: "token 验证通过"})
 
 		// 继续处理
 		return next()
@@ -208,11 +279,8 @@ func OptionalAuthMiddleware(config *AuthConfig) httpx.Middleware {
 		}
 
 		// 检查是否需要跳过认证
-		path := ctx.GetPath()
-		for _, skipPath := range config.SkipPaths {
-			if strings.HasPrefix(path, skipPath) {
-				return next()
-			}
+		if matchSkipPath(ctx.GetPath(), config.SkipPaths) {
+			return next()
 		}
 
 		// 严格权限字典：运行期兜底 fail-close（防止上层装配期校验遗漏/被吞掉）。
@@ -220,40 +288,21 @@ func OptionalAuthMiddleware(config *AuthConfig) httpx.Middleware {
 			return err
 		}
 
-		reqCtx := ctx.GetContext()
-		tenantID := ctx.GetHeader(config.TenantHeader)
-		if tenantID == "" && config.AllowTenantQuery {
-			tenantID = ctx.GetQuery("tenant_id")
-		}
-		if tenantID == "" && config.RequireTenant {
-			recordAuthzDenied(ctx, AuditRecord{
-				Decision: "deny",
-				Reason:   "tenant_id is required",
-			})
-			return errorx.New(errorx.Validation, "tenant_id is required")
-		}
-		if tenantID != "" {
-			derived, err := hbasic.WithTenantID(reqCtx, tenantID)
-			if err != nil {
-				recordAuthzDenied(ctx, AuditRecord{
-					Decision: "deny",
-					Reason:   "invalid tenant_id",
-				})
-				return err
-			}
-			reqCtx = derived
-			ctx.SetContext(reqCtx)
-		}
-
 		// 尝试获取token
-		token := extractToken(ctx, config)
+		token := ExtractToken(ctx, config)
 		if token != "" {
 			// 如果有token，尝试验证
 			if claims, err := validateToken(token, config.SecretKey); err == nil && claims != nil {
-				// 验证成功，设置用户ID，并注入角色/权限信息
+				// 验证成功，设置用户ID与租户，并注入角色/权限信息
 				reqCtx := ctx.GetContext()
 				reqCtx = hbasic.WithUserID(reqCtx, claims.UserID)
 
+				// 已认证请求的租户同样只信任令牌声明或经校验的成员关系；匿名请求不注入租户
+				reqCtx, err = applyRequestTenant(ctx, reqCtx, config, claims)
+				if err != nil {
+					return err
+				}
+
 				reqCtx = auth.WithRoles(reqCtx, claims.Roles)
 				reqCtx = auth.WithPermissions(reqCtx, claims.Permissions)
 
@@ -287,8 +336,8 @@ func extractTokenFromHeadersAndQuery(getHeader func(string) string, getQuery fun
 	return ""
 }
 
-// extractToken 提取 token
-func extractToken(ctx httpx.IContext, config *AuthConfig) string {
+// ExtractToken 从请求头（及启用时的查询参数）提取 token
+func ExtractToken(ctx httpx.IContext, config *AuthConfig) string {
 	return extractTokenFromHeadersAndQuery(ctx.GetHeader, ctx.GetQuery, config)
 }
 
@@ -301,6 +350,9 @@ func validateToken(token, secretKey string) (*JWTClaims, error) {
 	if claims == nil || claims.UserID <= 0 {
 		return nil, errorx.New(errorx.Unauthorized, "无效的token")
 	}
+	if IsTokenRevoked(claims) {
+		return nil, errorx.New(errorx.Unauthorized, "token 已失效")
+	}
 	return claims, nil
 }
 
@@ -310,9 +362,37 @@ type JWTClaims struct {
 	Username    string   `json:"username"`
 	Roles       []string `json:"roles"`
 	Permissions []string `json:"permissions"`
+	// TenantID 用户所属租户（签名声明；请求租户以此为准，见 resolveRequestTenant）
+	TenantID string `json:"tenant_id,omitempty"`
+	// TokenType 令牌类型（access/refresh）；为空视为访问令牌
+	TokenType string `json:"token_type,omitempty"`
+	// IssuedAtNano 纳秒精度的签发时间（iat 精度为秒，用户全量吊销以此判断先后，见 IsTokenRevoked）
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
+	// RegisteredClaims.ID 即 jti，用于单个 token 吊销（见 RevokeToken）
 	jwt.RegisteredClaims
 }
 
+// issuedAt 返回令牌签发时间（优先使用纳秒精度声明；历史令牌回退到秒级 iat）
+func (c *JWTClaims) issuedAt() (time.Time, bool) {
+	if c.IssuedAtNano > 0 {
+		return time.Unix(0, c.IssuedAtNano), true
+	}
+	if c.IssuedAt == nil {
+		return time.Time{}, false
+	}
+	return c.IssuedAt.Time, true
+}
+
+// IsRefreshToken 是否为刷新令牌
+func (c *JWTClaims) IsRefreshToken() bool {
+	return c != nil && c.TokenType == TokenTypeRefresh
+}
+
+// IsAccessToken 是否为访问令牌（未携带 token_type 的历史令牌视为访问令牌）
+func (c *JWTClaims) IsAccessToken() bool {
+	return c != nil && (c.TokenType == "" || c.TokenType == TokenTypeAccess)
+}
+
 // GenerateToken 生成 JWT 访问令牌
 func GenerateToken(userID int64, username string, roles, permissions []string, secretKey string) (string, error) {
 	return GenerateTokenWithTTL(userID, username, roles, permissions, secretKey, defaultAccessTokenTTL)
@@ -320,6 +400,11 @@ func GenerateToken(userID int64, username string, roles, permissions []string, s
 
 // GenerateTokenWithTTL 生成 JWT 访问令牌（可配置 TTL）
 func GenerateTokenWithTTL(userID int64, username string, roles, permissions []string, secretKey string, ttl time.Duration) (string, error) {
+	return GenerateTenantTokenWithTTL(userID, username, "", roles, permissions, secretKey, ttl)
+}
+
+// GenerateTenantTokenWithTTL 生成携带租户声明的 JWT 访问令牌（tenantID 为空表示不属于任何租户）
+func GenerateTenantTokenWithTTL(userID int64, username, tenantID string, roles, permissions []string, secretKey string, ttl time.Duration) (string, error) {
 	if secretKey == "" {
 		return "", errorx.New(errorx.Internal, "JWT 密钥未配置")
 	}
@@ -327,18 +412,85 @@ func GenerateTokenWithTTL(userID int64, username string, roles, permissions []st
 		ttl = defaultAccessTokenTTL
 	}
 
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	now := time.Now()
 	claims := &JWTClaims{
-		UserID:      userID,
-		Username:    username,
-		Roles:       roles,
-		Permissions: permissions,
+		UserID:       userID,
+		Username:     username,
+		Roles:        roles,
+		Permissions:  permissions,
+		TenantID:     tenantID,
+		TokenType:    TokenTypeAccess,
+		IssuedAtNano: now.UnixNano(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
+	return signClaims(claims, secretKey)
+}
+
+// GenerateRefreshToken 生成 JWT 刷新令牌
+//
+// 刷新令牌只携带用户身份（不含角色/权限快照），有效期更长（ttl<=0 时默认 30 天）；
+// 换取访问令牌时应重新从数据源获取最新 RBAC。
+func GenerateRefreshToken(userID int64, username, secretKey string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = defaultRefreshTokenTTL
+	}
+	return generateIdentityToken(userID, username, TokenTypeRefresh, secretKey, ttl)
+}
+
+// GenerateMFAToken 生成两步验证挑战令牌（仅携带用户身份；ttl<=0 时默认 5 分钟）
+func GenerateMFAToken(userID int64, username, secretKey string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = defaultMFATokenTTL
+	}
+	return generateIdentityToken(userID, username, TokenTypeMFA, secretKey, ttl)
+}
+
+// generateIdentityToken 生成仅携带用户身份的指定类型令牌
+func generateIdentityToken(userID int64, username, tokenType, secretKey string, ttl time.Duration) (string, error) {
+	if secretKey == "" {
+		return "", errorx.New(errorx.Internal, "JWT 密钥未配置")
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
 
+	now := time.Now()
+	claims := &JWTClaims{
+		UserID:       userID,
+		Username:     username,
+		TokenType:    tokenType,
+		IssuedAtNano: now.UnixNano(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return signClaims(claims, secretKey)
+}
+
+// newTokenID 生成随机 token ID（jti），用于单个 token 吊销
+func newTokenID() (string, error) {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return "", errorx.Wrap(err, errorx.Internal, "生成 token ID 失败")
+	}
+	return hex.EncodeToString(buf[:]), nil
+}
+
+// signClaims 使用 HS256 签名声明
+func signClaims(claims *JWTClaims, secretKey string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := token.SignedString([]byte(secretKey))
 	if err != nil {
@@ -347,8 +499,44 @@ func GenerateTokenWithTTL(userID int64, username string, roles, permissions []st
 	return signed, nil
 }
 
-// ParseToken 解析并验证 JWT 令牌
+// ParseToken 解析并验证 JWT 访问令牌（拒绝刷新令牌等其他类型）
 func ParseToken(tokenStr, secretKey string) (*JWTClaims, error) {
+	claims, err := parseClaims(tokenStr, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsAccessToken() {
+		return nil, errorx.New(errorx.Unauthorized, "token 类型错误：需要访问令牌")
+	}
+	return claims, nil
+}
+
+// ParseRefreshToken 解析并验证 JWT 刷新令牌（拒绝访问令牌）
+func ParseRefreshToken(tokenStr, secretKey string) (*JWTClaims, error) {
+	claims, err := parseClaims(tokenStr, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsRefreshToken() {
+		return nil, errorx.New(errorx.Unauthorized, "token 类型错误：需要刷新令牌")
+	}
+	return claims, nil
+}
+
+// ParseMFAToken 解析并验证两步验证挑战令牌（拒绝其他类型）
+func ParseMFAToken(tokenStr, secretKey string) (*JWTClaims, error) {
+	claims, err := parseClaims(tokenStr, secretKey)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != TokenTypeMFA {
+		return nil, errorx.New(errorx.Unauthorized, "token 类型错误：需要两步验证令牌")
+	}
+	return claims, nil
+}
+
+// parseClaims 解析并验证签名/有效期，不校验令牌类型
+func parseClaims(tokenStr, secretKey string) (*JWTClaims, error) {
 	if secretKey == "" {
 		return nil, errorx.New(errorx.Unauthorized, "认证配置错误")
 	}
@@ -371,14 +559,18 @@ func ParseToken(tokenStr, secretKey string) (*JWTClaims, error) {
 	return claims, nil
 }
 
-// RefreshToken 刷新token
-func RefreshToken(token, secretKey string) (string, error) {
-	// 解析旧token
-	claims, err := ParseToken(token, secretKey)
+// RefreshToken 使用刷新令牌换取新的访问令牌
+//
+// 刷新令牌不含 RBAC 快照，签发的访问令牌仅携带用户身份（无角色/权限）；
+// 需要完整权限时应在上层通过 GetAuthSnapshot 获取最新 RBAC 后调用 GenerateTokenWithTTL。
+func RefreshToken(refreshToken, secretKey string) (string, error) {
+	claims, err := ParseRefreshToken(refreshToken, secretKey)
 	if err != nil {
 		return "", err
 	}
+	if IsTokenRevoked(claims) {
+		return "", errorx.New(errorx.Unauthorized, "token 已失效")
+	}
 
-	// 生成新token
-	return GenerateToken(claims.UserID, claims.Username, claims.Roles, claims.Permissions, secretKey)
+	return GenerateToken(claims.UserID, claims.Username, nil, nil, secretKey)
 }
@@ -2,7 +2,11 @@ package middleware
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,6 +14,7 @@ import (
 
 	"gochen-iam/auth"
 	"gochen/errorx"
+	"gochen/httpx"
 	hbasic "gochen/httpx/nethttp"
 )
 
@@ -272,6 +277,33 @@ func TestHasPermission_AdminRoleOverrides(t *testing.T) {
 	}
 }
 
+func TestHasPermission_Wildcard(t *testing.T) {
+	ctx, err := hbasic.NewRequestContext(context.Background())
+	if err != nil {
+		t.Fatalf("NewRequestContext: %v", err)
+	}
+	ctx = auth.WithPermissions(ctx, []string{"user:*", "role:read"})
+
+	if !HasPermission(ctx, "user:read") || !HasPermission(ctx, "user:delete") {
+		t.Error("expected user:* to cover user actions")
+	}
+	if HasPermission(ctx, "menu:read") {
+		t.Error("expected user:* not to cover other resources")
+	}
+	if !HasPermission(ctx, "role:read") || HasPermission(ctx, "role:write") {
+		t.Error("expected literal role:read to match only itself")
+	}
+
+	all, err := hbasic.NewRequestContext(context.Background())
+	if err != nil {
+		t.Fatalf("NewRequestContext: %v", err)
+	}
+	all = auth.WithPermissions(all, []string{"*:*"})
+	if !HasPermission(all, "menu:write") {
+		t.Error("expected *:* to cover everything")
+	}
+}
+
 func TestRequirePermission(t *testing.T) {
 	ctx, err := hbasic.NewRequestContext(context.Background())
 	if err != nil {
@@ -340,6 +372,128 @@ func TestPermissionMiddleware_InvalidPermission_NotRegistered(t *testing.T) {
 	}
 }
 
+func TestRequireAllAndAnyPermissions_Registry(t *testing.T) {
+	resetRequiredPermissionsRegistryForTest()
+	defer resetRequiredPermissionsRegistryForTest()
+
+	_ = RequireAllPermissions("a:read", "b:write")
+	_ = RequireAnyPermission("b:write", "c:delete")
+	_ = RequireAllPermissions("d:read", "invalid-perm")
+	_ = RequireAnyPermission()
+
+	perms := RequiredPermissions()
+	if len(perms) != 3 || perms[0] != "a:read" || perms[1] != "b:write" || perms[2] != "c:delete" {
+		t.Fatalf("unexpected permissions: %#v", perms)
+	}
+}
+
+func TestRequireAllAndAnyPermissions_Enforce(t *testing.T) {
+	resetRequiredPermissionsRegistryForTest()
+	defer resetRequiredPermissionsRegistryForTest()
+
+	run := func(mw httpx.Middleware, userID int64, permissions []string) (bool, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/resource", nil)
+		ctx, err := hbasic.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		if userID != 0 {
+			ctx.SetContext(InjectAuthContext(ctx.GetContext(), userID, []string{"user"}, permissions))
+		}
+		called := false
+		err = mw(ctx, func() error {
+			called = true
+			return nil
+		})
+		return called, err
+	}
+
+	all := RequireAllPermissions("report:read", "report:export")
+	anyOf := RequireAnyPermission("report:read", "report:export")
+
+	// 检查失败时所有权限仍已注册（装配期注册，与请求无关）
+	if _, err := run(all, 1, nil); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden, got %v", err)
+	}
+	if !HasRequiredPermission("report:read") || !HasRequiredPermission("report:export") {
+		t.Fatalf("expected all permissions registered, got %#v", RequiredPermissions())
+	}
+
+	// 未认证
+	if _, err := run(all, 0, nil); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized, got %v", err)
+	}
+
+	// all：缺少其一即拒绝，错误信息包含缺失的权限
+	called, err := run(all, 1, []string{"report:read"})
+	if called || !errorx.Is(err, errorx.Forbidden) || !strings.Contains(err.Error(), "report:export") || strings.Contains(err.Error(), "report:read") {
+		t.Fatalf("expected Forbidden naming report:export, got called=%v err=%v", called, err)
+	}
+	if called, err := run(all, 1, []string{"report:read", "report:export"}); !called || err != nil {
+		t.Fatalf("expected pass with all permissions, got called=%v err=%v", called, err)
+	}
+
+	// any：具备任一即放行
+	if called, err := run(anyOf, 1, []string{"report:export"}); !called || err != nil {
+		t.Fatalf("expected pass with any permission, got called=%v err=%v", called, err)
+	}
+	called, err = run(anyOf, 1, []string{"other:read"})
+	if called || !errorx.Is(err, errorx.Forbidden) || !strings.Contains(err.Error(), "report:read") || !strings.Contains(err.Error(), "report:export") {
+		t.Fatalf("expected Forbidden naming both permissions, got called=%v err=%v", called, err)
+	}
+
+	// 管理员拥有所有权限
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/resource", nil)
+	ctx, _ := hbasic.NewBaseContext(httptest.NewRecorder(), req)
+	ctx.SetContext(InjectAuthContext(ctx.GetContext(), 1, []string{"system_admin"}, nil))
+	if err := all(ctx, func() error { return nil }); err != nil {
+		t.Fatalf("expected admin to pass, got %v", err)
+	}
+}
+
+func TestRequireOwnerOrAdmin(t *testing.T) {
+	mw := RequireOwnerOrAdmin(func(ctx httpx.IContext) (int64, error) {
+		return strconv.ParseInt(ctx.GetQuery("owner"), 10, 64)
+	})
+	run := func(owner string, userID int64, roles []string) (bool, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/resource?owner="+owner, nil)
+		ctx, err := hbasic.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		if userID != 0 {
+			ctx.SetContext(InjectAuthContext(ctx.GetContext(), userID, roles, nil))
+		}
+		called := false
+		err = mw(ctx, func() error {
+			called = true
+			return nil
+		})
+		return called, err
+	}
+
+	// 所有者本人
+	if called, err := run("42", 42, []string{"user"}); !called || err != nil {
+		t.Fatalf("expected owner to pass, got called=%v err=%v", called, err)
+	}
+	// 管理员可访问任意用户
+	if called, err := run("42", 7, []string{"system_admin"}); !called || err != nil {
+		t.Fatalf("expected admin to pass, got called=%v err=%v", called, err)
+	}
+	// 非所有者且非管理员
+	if called, err := run("42", 7, []string{"user"}); called || !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden, got called=%v err=%v", called, err)
+	}
+	// 未认证
+	if called, err := run("42", 0, nil); called || !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized, got called=%v err=%v", called, err)
+	}
+	// 提取失败时返回提取错误
+	if called, err := run("abc", 7, []string{"user"}); called || err == nil {
+		t.Fatalf("expected extractor error, got called=%v err=%v", called, err)
+	}
+}
+
 func TestValidateStrictPermissionRegistry_StrictEmpty(t *testing.T) {
 	resetRequiredPermissionsRegistryForTest()
 	defer resetRequiredPermissionsRegistryForTest()
@@ -358,3 +512,267 @@ func TestValidateStrictPermissionRegistry_StrictNonEmpty(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestRevokeUserTokens(t *testing.T) {
+	secretKey := "test-secret-key"
+	userID := int64(987654)
+
+	token, err := GenerateToken(userID, "revoked", []string{"user"}, nil, secretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	refreshToken, err := GenerateRefreshToken(userID, "revoked", secretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+	if _, err := validateToken(token, secretKey); err != nil {
+		t.Fatalf("expected token valid before revocation, got %v", err)
+	}
+
+	RevokeUserTokens(userID)
+
+	_, err = validateToken(token, secretKey)
+	if !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized after revocation, got %v", err)
+	}
+	if _, err := RefreshToken(refreshToken, secretKey); err == nil {
+		t.Fatal("expected refresh of revoked token to fail")
+	}
+
+	// 其他用户不受影响
+	other, err := GenerateToken(userID+1, "other", nil, nil, secretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	if _, err := validateToken(other, secretKey); err != nil {
+		t.Fatalf("expected other user's token valid, got %v", err)
+	}
+
+	// 吊销之后签发的 token 有效
+	claims := &JWTClaims{UserID: userID}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(2 * time.Second))
+	if IsTokenRevoked(claims) {
+		t.Fatal("expected token issued after revocation to be valid")
+	}
+
+	// 吊销后立即（同一秒内）重新登录签发的 token 有效
+	fresh, err := GenerateToken(userID, "revoked", []string{"user"}, nil, secretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	if _, err := validateToken(fresh, secretKey); err != nil {
+		t.Fatalf("expected token issued right after revocation valid, got %v", err)
+	}
+	freshRefresh, err := GenerateRefreshToken(userID, "revoked", secretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+	if _, err := RefreshToken(freshRefresh, secretKey); err != nil {
+		t.Fatalf("expected refresh token issued right after revocation valid, got %v", err)
+	}
+
+	// 仅携带秒级 iat 的历史 token 在吊销的同一秒内签发时仍视为失效
+	RevokeUserTokens(userID)
+	legacy := &JWTClaims{UserID: userID}
+	legacy.IssuedAt = jwt.NewNumericDate(time.Now())
+	if !IsTokenRevoked(legacy) {
+		t.Fatal("expected legacy second-precision token to be treated as revoked")
+	}
+}
+
+func TestRevokeToken_SingleToken(t *testing.T) {
+	SetDefaultTokenRevoker(NewMemoryTokenRevoker())
+	defer SetDefaultTokenRevoker(nil)
+
+	secretKey := "test-secret-key"
+	userID := int64(555001)
+
+	first, err := GenerateToken(userID, "jti", []string{"user"}, nil, secretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	second, err := GenerateToken(userID, "jti", []string{"user"}, nil, secretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+
+	claims, err := ParseToken(first, secretKey)
+	if err != nil {
+		t.Fatalf("ParseToken failed: %v", err)
+	}
+	if claims.ID == "" {
+		t.Fatal("expected jti to be generated")
+	}
+	if err := RevokeToken(claims); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+
+	// 被吊销的 token 被 AuthMiddleware 拒绝
+	_, err = validateToken(first, secretKey)
+	if !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized for revoked token, got %v", err)
+	}
+	// 同一用户的其他 token 不受影响
+	if _, err := validateToken(second, secretKey); err != nil {
+		t.Fatalf("expected other token valid, got %v", err)
+	}
+
+	// 无 jti 的历史 token 不能单独吊销
+	if err := RevokeToken(&JWTClaims{UserID: userID}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for missing jti, got %v", err)
+	}
+}
+
+func TestMemoryTokenRevoker_ExpiredEntries(t *testing.T) {
+	r := NewMemoryTokenRevoker()
+	r.RevokeToken("expired", time.Now().Add(-time.Second))
+	r.RevokeToken("active", time.Now().Add(time.Minute))
+
+	if r.IsTokenRevoked("expired") {
+		t.Fatal("expected expired entry to be dropped")
+	}
+	if !r.IsTokenRevoked("active") {
+		t.Fatal("expected active entry to be revoked")
+	}
+	if _, ok := r.UserRevokedAt(1); ok {
+		t.Fatal("expected no user-level revocation")
+	}
+}
+
+func TestTokenTypes_CrossTypeMisuse(t *testing.T) {
+	secretKey := "test-secret-key"
+	userID := int64(4242)
+
+	accessToken, err := GenerateToken(userID, "typed", []string{"user"}, []string{"task:read"}, secretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	refreshToken, err := GenerateRefreshToken(userID, "typed", secretKey, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+
+	// 访问令牌：可作为访问令牌解析，不可作为刷新令牌
+	claims, err := ParseToken(accessToken, secretKey)
+	if err != nil {
+		t.Fatalf("ParseToken(access) failed: %v", err)
+	}
+	if claims.TokenType != TokenTypeAccess {
+		t.Fatalf("expected token_type %q, got %q", TokenTypeAccess, claims.TokenType)
+	}
+	if _, err := ParseRefreshToken(accessToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized parsing access token as refresh, got %v", err)
+	}
+	if _, err := RefreshToken(accessToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized refreshing with access token, got %v", err)
+	}
+
+	// 刷新令牌：可作为刷新令牌解析，不可用于鉴权
+	refreshClaims, err := ParseRefreshToken(refreshToken, secretKey)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken failed: %v", err)
+	}
+	if refreshClaims.UserID != userID || len(refreshClaims.Roles) != 0 || len(refreshClaims.Permissions) != 0 {
+		t.Fatalf("unexpected refresh claims: %+v", refreshClaims)
+	}
+	if refreshClaims.ExpiresAt == nil || refreshClaims.ExpiresAt.Time.Before(time.Now().Add(30*time.Minute)) {
+		t.Fatalf("unexpected refresh expiry: %v", refreshClaims.ExpiresAt)
+	}
+	if _, err := ParseToken(refreshToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized parsing refresh token as access, got %v", err)
+	}
+	if _, err := validateToken(refreshToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected validateToken to reject refresh token, got %v", err)
+	}
+
+	newAccess, err := RefreshToken(refreshToken, secretKey)
+	if err != nil {
+		t.Fatalf("RefreshToken failed: %v", err)
+	}
+	if _, err := ParseToken(newAccess, secretKey); err != nil {
+		t.Fatalf("expected refreshed access token valid, got %v", err)
+	}
+
+	// 两步验证挑战令牌：不可用于鉴权或刷新
+	mfaToken, err := GenerateMFAToken(userID, "typed", secretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken failed: %v", err)
+	}
+	if _, err := ParseMFAToken(mfaToken, secretKey); err != nil {
+		t.Fatalf("ParseMFAToken failed: %v", err)
+	}
+	if _, err := ParseToken(mfaToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized parsing mfa token as access, got %v", err)
+	}
+	if _, err := ParseRefreshToken(mfaToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized parsing mfa token as refresh, got %v", err)
+	}
+	if _, err := ParseMFAToken(accessToken, secretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized parsing access token as mfa, got %v", err)
+	}
+
+	// 历史令牌（无 token_type）按访问令牌处理
+	legacy := &JWTClaims{UserID: userID, Username: "legacy"}
+	legacy.IssuedAt = jwt.NewNumericDate(time.Now())
+	legacy.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	legacyToken, err := signClaims(legacy, secretKey)
+	if err != nil {
+		t.Fatalf("signClaims failed: %v", err)
+	}
+	if _, err := ParseToken(legacyToken, secretKey); err != nil {
+		t.Fatalf("expected legacy token accepted as access, got %v", err)
+	}
+	if _, err := ParseRefreshToken(legacyToken, secretKey); err == nil {
+		t.Fatal("expected legacy token rejected as refresh")
+	}
+}
+
+func TestDefaultAuthConfig_RefreshTokenTTL(t *testing.T) {
+	t.Setenv(envRefreshTokenTTL, "")
+	if got := DefaultAuthConfig().RefreshTokenTTL; got != defaultRefreshTokenTTL {
+		t.Fatalf("expected default refresh ttl %v, got %v", defaultRefreshTokenTTL, got)
+	}
+	t.Setenv(envRefreshTokenTTL, "72h")
+	if got := DefaultAuthConfig().RefreshTokenTTL; got != 72*time.Hour {
+		t.Fatalf("expected 72h, got %v", got)
+	}
+	t.Setenv(envRefreshTokenTTL, "invalid")
+	if got := DefaultAuthConfig().RefreshTokenTTL; got != defaultRefreshTokenTTL {
+		t.Fatalf("expected fallback to default, got %v", got)
+	}
+}
+
+func TestMatchSkipPath(t *testing.T) {
+	skipPaths := []string{"/api/v1/health", "/api/v1/public/*"}
+	cases := map[string]bool{
+		"/api/v1/health":             true,
+		"/api/v1/health/":            true,
+		"/api/v1/healthz-internal":   false,
+		"/api/v1/healthcheck-secret": false,
+		"/api/v1/health/details":     false,
+		"/api/v1/public/docs":        true,
+		"/api/v1/public/a/b":         true,
+		"/api/v1/publicity":          false,
+	}
+	for path, want := range cases {
+		if got := matchSkipPath(path, skipPaths); got != want {
+			t.Errorf("matchSkipPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestDefaultAuthConfig_SkipPathsFromEnv(t *testing.T) {
+	t.Setenv(envSkipPaths, " /api/v1/status , /api/v1/docs/* ,")
+	cfg := DefaultAuthConfig()
+
+	for _, path := range []string{"/api/v1/auth/login", "/api/v1/auth/login/2fa", "/api/v1/status", "/api/v1/docs/index.html"} {
+		if !matchSkipPath(path, cfg.SkipPaths) {
+			t.Errorf("expected %q to be skipped", path)
+		}
+	}
+	for _, path := range []string{"/api/v1/statusz", "/api/v1/users"} {
+		if matchSkipPath(path, cfg.SkipPaths) {
+			t.Errorf("expected %q to require auth", path)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen/errorx"
+	"gochen/httpx"
+	"gochen/logging"
+	"gochen/metadata"
+)
+
+const (
+	// envBreakGlassCredential 应急管理员凭据（环境变量；未设置时应急登录关闭）
+	envBreakGlassCredential = "AUTH_BREAK_GLASS_CREDENTIAL"
+	// envBreakGlassTTL 应急管理员 token 有效期（环境变量）
+	envBreakGlassTTL = "AUTH_BREAK_GLASS_TTL"
+
+	// DefaultBreakGlassTTL 应急管理员 token 默认有效期
+	DefaultBreakGlassTTL = 15 * time.Minute
+	// minBreakGlassCredentialLength 凭据最小长度（过短视为未配置，避免弱口令开启后门）
+	minBreakGlassCredentialLength = 16
+
+	// BreakGlassUserID 应急管理员 token 使用的保留用户 ID（不对应任何真实用户）
+	BreakGlassUserID = int64(math.MaxInt64)
+	// BreakGlassUsername 应急管理员 token 的用户名
+	BreakGlassUsername = "break-glass"
+)
+
+// breakGlassUsed 已使用过的凭据指纹（进程内存；更换凭据后可再次使用）
+var breakGlassUsed = struct {
+	mu           sync.Mutex
+	fingerprints map[string]struct{}
+}{
+	fingerprints: map[string]struct{}{},
+}
+
+// BreakGlassLogin 使用应急凭据签发短期 system_admin 访问令牌（“破窗”恢复）
+//
+// 语义：
+//   - 仅当配置了 AUTH_BREAK_GLASS_CREDENTIAL（至少 16 字符）时可用，否则返回 Forbidden；
+//   - 凭据一次性：同一凭据成功使用后即失效（进程内存记录，多实例部署下每个实例各可使用一次，用后应立即轮换/移除）；
+//   - 签发的 token 携带 system_admin 角色、保留用户 ID（BreakGlassUserID），有效期默认 15 分钟（AUTH_BREAK_GLASS_TTL）；
+//   - 无论成功与否均写审计记录（AuditSink + Error 级日志，不受 AUTH_AUDIT_LOG 开关影响）。
+func BreakGlassLogin(ctx httpx.IContext, credential string, config *AuthConfig) (string, time.Time, error) {
+	if config == nil {
+		config = DefaultAuthConfig()
+	}
+
+	// 1. 检查是否启用
+	configured := strings.TrimSpace(os.Getenv(envBreakGlassCredential))
+	if len(configured) < minBreakGlassCredentialLength {
+		recordBreakGlass(ctx, "deny", "break-glass 未启用")
+		return "", time.Time{}, errorx.New(errorx.Forbidden, "应急登录未启用")
+	}
+
+	// 2. 校验凭据（常量时间比较）
+	given := sha256.Sum256([]byte(credential))
+	expected := sha256.Sum256([]byte(configured))
+	if subtle.ConstantTimeCompare(given[:], expected[:]) != 1 {
+		recordBreakGlass(ctx, "deny", "break-glass 凭据错误")
+		return "", time.Time{}, errorx.New(errorx.Unauthorized, "应急凭据错误")
+	}
+
+	// 3. 一次性：标记凭据已使用
+	fingerprint := hex.EncodeToString(expected[:])
+	breakGlassUsed.mu.Lock()
+	if _, used := breakGlassUsed.fingerprints[fingerprint]; used {
+		breakGlassUsed.mu.Unlock()
+		recordBreakGlass(ctx, "deny", "break-glass 凭据已使用")
+		return "", time.Time{}, errorx.New(errorx.Forbidden, "应急凭据已使用，请轮换后重试")
+	}
+	breakGlassUsed.fingerprints[fingerprint] = struct{}{}
+	breakGlassUsed.mu.Unlock()
+
+	// 4. 签发短期管理员 token
+	ttl := breakGlassTTL()
+	token, err := GenerateTokenWithTTL(BreakGlassUserID, BreakGlassUsername, []string{"system_admin"}, nil, config.SecretKey, ttl)
+	if err != nil {
+		recordBreakGlass(ctx, "deny", "break-glass token 签发失败")
+		return "", time.Time{}, err
+	}
+
+	recordBreakGlass(ctx, "allow", "break-glass 应急管理员 token 已签发")
+	return token, time.Now().Add(ttl), nil
+}
+
+// breakGlassTTL 返回应急 token 有效期（非法或非正值回退为默认值）
+func breakGlassTTL() time.Duration {
+	v := strings.TrimSpace(os.Getenv(envBreakGlassTTL))
+	if v == "" {
+		return DefaultBreakGlassTTL
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return DefaultBreakGlassTTL
+	}
+	return d
+}
+
+// recordBreakGlass 记录应急登录审计（始终写出，不受 AUTH_AUDIT_LOG 开关影响）
+func recordBreakGlass(ctx httpx.IContext, decision, reason string) {
+	rec := AuditRecord{
+		Decision: decision,
+		Reason:   reason,
+		Role:     "system_admin",
+	}
+	stdCtx := metadata.Background()
+	if ctx != nil {
+		if req := ctx.GetRequest(); req != nil {
+			rec.Method = req.Method
+			stdCtx = req.Context()
+		}
+		rec.Path = ctx.GetPath()
+	}
+	if decision == "allow" {
+		rec.UserID = BreakGlassUserID
+	}
+
+	if auditSink != nil {
+		auditSink.Record(stdCtx, rec)
+	}
+	if auditLogger != nil {
+		auditLogger.Error(stdCtx, "[authz] BREAK-GLASS",
+			logging.String("decision", rec.Decision),
+			logging.String("reason", rec.Reason),
+			logging.String("path", rec.Path),
+			logging.String("method", rec.Method),
+		)
+	}
+}
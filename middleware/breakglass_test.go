@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+type capturingAuditSink struct {
+	records []AuditRecord
+}
+
+func (s *capturingAuditSink) Record(_ context.Context, rec AuditRecord) {
+	s.records = append(s.records, rec)
+}
+
+func TestBreakGlassLogin(t *testing.T) {
+	sink := &capturingAuditSink{}
+	SetAuditSink(sink)
+	defer SetAuditSink(nil)
+	t.Setenv("AUTH_AUDIT_LOG", "false")
+
+	config := &AuthConfig{SecretKey: "break-glass-secret"}
+	login := func(credential string) (string, error) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/break-glass", nil)
+		ctx, err := nethttp.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		token, _, err := BreakGlassLogin(ctx, credential, config)
+		return token, err
+	}
+	lastRecord := func() AuditRecord {
+		if len(sink.records) == 0 {
+			t.Fatal("expected audit record")
+		}
+		return sink.records[len(sink.records)-1]
+	}
+
+	// 未配置时关闭（仍审计）
+	t.Setenv("AUTH_BREAK_GLASS_CREDENTIAL", "")
+	if _, err := login("anything-long-enough"); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden when not configured, got %v", err)
+	}
+	if rec := lastRecord(); rec.Decision != "deny" || rec.Path != "/api/v1/auth/break-glass" {
+		t.Fatalf("unexpected audit record: %+v", rec)
+	}
+
+	// 过短的凭据视为未配置
+	t.Setenv("AUTH_BREAK_GLASS_CREDENTIAL", "short")
+	if _, err := login("short"); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for weak credential, got %v", err)
+	}
+
+	credential := "emergency-credential-0001"
+	t.Setenv("AUTH_BREAK_GLASS_CREDENTIAL", credential)
+
+	// 凭据错误
+	before := len(sink.records)
+	if _, err := login("wrong-credential-0000"); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized for wrong credential, got %v", err)
+	}
+	if len(sink.records) != before+1 || lastRecord().Decision != "deny" {
+		t.Fatalf("expected deny audit for wrong credential, got %+v", sink.records)
+	}
+
+	// 成功：签发短期 system_admin token
+	token, err := login(credential)
+	if err != nil {
+		t.Fatalf("BreakGlassLogin failed: %v", err)
+	}
+	claims, err := validateToken(token, config.SecretKey)
+	if err != nil {
+		t.Fatalf("expected valid token, got %v", err)
+	}
+	if claims.UserID != BreakGlassUserID || len(claims.Roles) != 1 || claims.Roles[0] != "system_admin" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != DefaultBreakGlassTTL {
+		t.Fatalf("expected ttl %s, got %s", DefaultBreakGlassTTL, ttl)
+	}
+	if rec := lastRecord(); rec.Decision != "allow" || rec.UserID != BreakGlassUserID {
+		t.Fatalf("unexpected audit record: %+v", rec)
+	}
+
+	// 一次性：再次使用被拒绝
+	if _, err := login(credential); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for reused credential, got %v", err)
+	}
+	if rec := lastRecord(); rec.Decision != "deny" {
+		t.Fatalf("unexpected audit record: %+v", rec)
+	}
+}
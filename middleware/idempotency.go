@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+const (
+	// IdempotencyKeyHeader 幂等键请求头
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader 重放响应时附加的响应头
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL     = 10 * time.Minute
+	maxIdempotencyKeyLength   = 255
+	idempotencyRecorderCtxKey = "iam.idempotency.recorder"
+)
+
+// IdempotentResponse 已记录的响应（用于重放）
+type IdempotentResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+	// Fingerprint 请求体指纹：同一幂等键用于不同请求体时拒绝
+	Fingerprint string
+}
+
+// IdempotencyStore 幂等响应存储（可插拔，如替换为 Redis 实现多实例共享）
+type IdempotencyStore interface {
+	Get(key string) (*IdempotentResponse, bool)
+	Save(key string, resp *IdempotentResponse, ttl time.Duration)
+}
+
+var defaultIdempotencyStore = struct {
+	mu    sync.RWMutex
+	store IdempotencyStore
+}{}
+
+// SetDefaultIdempotencyStore 设置默认幂等存储；为 nil 时（默认）IdempotencyMiddleware 不生效。
+func SetDefaultIdempotencyStore(store IdempotencyStore) {
+	defaultIdempotencyStore.mu.Lock()
+	defer defaultIdempotencyStore.mu.Unlock()
+	defaultIdempotencyStore.store = store
+}
+
+func currentIdempotencyStore() IdempotencyStore {
+	defaultIdempotencyStore.mu.RLock()
+	defer defaultIdempotencyStore.mu.RUnlock()
+	return defaultIdempotencyStore.store
+}
+
+// IdempotencyConfig 幂等中间件配置
+type IdempotencyConfig struct {
+	// Store 为空时使用 SetDefaultIdempotencyStore 设置的默认存储（按请求解析）
+	Store IdempotencyStore
+	// TTL 响应保留时长（<=0 默认 10 分钟）
+	TTL time.Duration
+}
+
+// IdempotencyMiddleware 幂等键中间件
+//
+// 语义：
+//   - 未配置存储或请求未携带 Idempotency-Key 时直接放行（默认 no-op）；
+//   - 首次请求成功（2xx）后记录响应，窗口期内同一用户以相同键重复请求时直接重放原响应；
+//   - 同一键用于不同请求体时返回 Conflict；处理失败不记录，允许客户端重试；
+//   - 响应需经 WriteIdempotentJSON 写出才会被记录；并发的首次请求不做互斥。
+func IdempotencyMiddleware(config *IdempotencyConfig) httpx.Middleware {
+	if config == nil {
+		config = &IdempotencyConfig{}
+	}
+	ttl := config.TTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	return func(ctx httpx.IContext, next func() error) error {
+		store := config.Store
+		if store == nil {
+			store = currentIdempotencyStore()
+		}
+		key := strings.TrimSpace(ctx.GetHeader(IdempotencyKeyHeader))
+		if store == nil || key == "" {
+			return next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return errorx.New(errorx.Validation, "Idempotency-Key 过长")
+		}
+
+		body, err := ctx.GetBody()
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		// 键按 用户 + 方法 + 路径 隔离，避免跨用户/跨端点重放
+		var userID int64
+		if reqCtx := ctx.GetContext(); reqCtx != nil {
+			userID = reqCtx.GetUserID()
+		}
+		storeKey := strconv.FormatInt(userID, 10) + ":" + ctx.GetMethod() + ":" + ctx.GetPath() + ":" + key
+
+		if stored, ok := store.Get(storeKey); ok && stored != nil {
+			if stored.Fingerprint != fingerprint {
+				return errorx.New(errorx.Conflict, "Idempotency-Key 已用于不同的请求")
+			}
+			ctx.SetHeader(IdempotentReplayedHeader, "true")
+			return ctx.Data(stored.Status, stored.ContentType, stored.Body)
+		}
+
+		recorder := &idempotencyRecorder{}
+		ctx.Set(idempotencyRecorderCtxKey, recorder)
+		if err := next(); err != nil {
+			return err
+		}
+
+		if resp := recorder.response; resp != nil && resp.Status >= 200 && resp.Status < 300 {
+			resp.Fingerprint = fingerprint
+			store.Save(storeKey, resp, ttl)
+		}
+		return nil
+	}
+}
+
+type idempotencyRecorder struct {
+	response *IdempotentResponse
+}
+
+// WriteIdempotentJSON 写出 JSON 响应；若当前请求经过 IdempotencyMiddleware，则同时记录响应供重放。
+func WriteIdempotentJSON(ctx httpx.IContext, code int, obj any) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Internal, "failed to serialize JSON")
+	}
+	const contentType = "application/json"
+	if v, ok := ctx.Get(idempotencyRecorderCtxKey); ok {
+		if recorder, ok := v.(*idempotencyRecorder); ok && recorder != nil {
+			recorder.response = &IdempotentResponse{
+				Status:      code,
+				ContentType: contentType,
+				Body:        data,
+			}
+		}
+	}
+	return ctx.Data(code, contentType, data)
+}
+
+// WriteIdempotentSuccess 以统一成功响应格式写出数据（与 Utils.WriteSuccessResponse 一致）并记录。
+func WriteIdempotentSuccess(ctx httpx.IContext, data any) error {
+	return WriteIdempotentJSON(ctx, http.StatusOK, httpx.NewSuccessResponse(data))
+}
+
+// MemoryIdempotencyStore 进程内存幂等存储（单实例适用）
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	resp      *IdempotentResponse
+	expiresAt time.Time
+}
+
+// NewMemoryIdempotencyStore 创建进程内存幂等存储
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]memoryIdempotencyEntry{}}
+}
+
+// Get 获取未过期的记录
+func (s *MemoryIdempotencyStore) Get(key string) (*IdempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return entry.resp, true
+}
+
+// Save 保存记录，并顺带清理已过期的记录
+func (s *MemoryIdempotencyStore) Save(key string, resp *IdempotentResponse, ttl time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memoryIdempotencyEntry{resp: resp, expiresAt: now.Add(ttl)}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	mw := IdempotencyMiddleware(&IdempotencyConfig{Store: store, TTL: time.Minute})
+
+	calls := 0
+	run := func(key, body string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/roles/1/users", bytes.NewReader([]byte(body))).WithContext(context.Background())
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		ctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		err = mw(ctx, func() error {
+			calls++
+			return WriteIdempotentSuccess(ctx, map[string]int{"call": calls})
+		})
+		return rec, err
+	}
+
+	t.Run("no key passes through", func(t *testing.T) {
+		calls = 0
+		for i := 0; i < 2; i++ {
+			if _, err := run("", `{}`); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if calls != 2 {
+			t.Fatalf("expected handler called twice, got %d", calls)
+		}
+	})
+
+	t.Run("same key replays", func(t *testing.T) {
+		calls = 0
+		first, err := run("k1", `{"a":1}`)
+		if err != nil {
+			t.Fatalf("first: %v", err)
+		}
+		second, err := run("k1", `{"a":1}`)
+		if err != nil {
+			t.Fatalf("second: %v", err)
+		}
+		if calls != 1 {
+			t.Fatalf("expected handler called once, got %d", calls)
+		}
+		if !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) {
+			t.Fatalf("body mismatch: %s vs %s", first.Body.String(), second.Body.String())
+		}
+	})
+
+	t.Run("same key different body conflicts", func(t *testing.T) {
+		_, err := run("k1", `{"a":2}`)
+		var appErr *errorx.AppError
+		if !errors.As(err, &appErr) || appErr.Code() != errorx.Conflict {
+			t.Fatalf("expected Conflict, got %v", err)
+		}
+	})
+
+	t.Run("no store is no-op", func(t *testing.T) {
+		SetDefaultIdempotencyStore(nil)
+		noop := IdempotencyMiddleware(nil)
+		count := 0
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/x", bytes.NewReader([]byte(`{}`)))
+			req.Header.Set(IdempotencyKeyHeader, "k")
+			ctx, _ := nethttp.NewBaseContext(httptest.NewRecorder(), req)
+			if err := noop(ctx, func() error { count++; return nil }); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if count != 2 {
+			t.Fatalf("expected handler called twice, got %d", count)
+		}
+	})
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	store.Save("k", &IdempotentResponse{Status: http.StatusOK}, -time.Second)
+	if _, ok := store.Get("k"); ok {
+		t.Fatalf("expected expired entry to be absent")
+	}
+}
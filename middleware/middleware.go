@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"strings"
+
 	"gochen-iam/auth"
 	"gochen/errorx"
 	"gochen/httpx"
@@ -69,6 +71,7 @@ func RoleMiddleware(requiredRole string) httpx.Middleware {
 		called := false
 		err := base(ctx, func() error {
 			called = true
+			recordAuthzAllowed(ctx, AuditRecord{Reason: "角色校验通过", Role: requiredRole})
 			return next()
 		})
 		if err != nil && !called {
@@ -113,6 +116,7 @@ func PermissionMiddleware(requiredPermission string) httpx.Middleware {
 		called := false
 		err := base(ctx, func() error {
 			called = true
+			recordAuthzAllowed(ctx, AuditRecord{Reason: "权限校验通过", Permission: requiredPermission})
 			return next()
 		})
 		if err != nil && !called {
@@ -126,6 +130,97 @@ func PermissionMiddleware(requiredPermission string) httpx.Middleware {
 	}
 }
 
+// RequireAllPermissions 要求同时拥有全部指定权限的中间件
+//
+// 所有权限均注册到 required permissions registry（与 PermissionMiddleware 一致）；
+// 缺少任一权限时返回 Forbidden，错误信息列出缺失的权限。
+func RequireAllPermissions(permissions ...string) httpx.Middleware {
+	if !validPermissionList(permissions) {
+		return invalidPermissionMiddleware(strings.Join(permissions, ","))
+	}
+	for _, p := range permissions {
+		registerRequiredPermission(p)
+	}
+	return permissionSetMiddleware(permissions, true)
+}
+
+// RequireAnyPermission 要求拥有任一指定权限的中间件
+//
+// 所有权限均注册到 required permissions registry；一个都不具备时返回 Forbidden，错误信息列出所需权限。
+func RequireAnyPermission(permissions ...string) httpx.Middleware {
+	if !validPermissionList(permissions) {
+		return invalidPermissionMiddleware(strings.Join(permissions, ","))
+	}
+	for _, p := range permissions {
+		registerRequiredPermission(p)
+	}
+	return permissionSetMiddleware(permissions, false)
+}
+
+// validPermissionList 校验权限列表非空且每个权限码格式合法
+func validPermissionList(permissions []string) bool {
+	if len(permissions) == 0 {
+		return false
+	}
+	for _, p := range permissions {
+		if !IsValidPermissionCode(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// invalidPermissionMiddleware 装配期权限定义错误时的 fail-close 中间件
+func invalidPermissionMiddleware(permission string) httpx.Middleware {
+	return func(ctx httpx.IContext, next func() error) error {
+		recordAuthzDenied(ctx, AuditRecord{
+			Decision:   "deny",
+			Reason:     "invalid permission definition",
+			Permission: permission,
+		})
+		return errorx.New(errorx.Internal, "invalid permission definition")
+	}
+}
+
+// permissionSetMiddleware 按 all/any 语义校验多个权限
+func permissionSetMiddleware(permissions []string, requireAll bool) httpx.Middleware {
+	label := strings.Join(permissions, ",")
+	return func(ctx httpx.IContext, next func() error) error {
+		reqCtx := ctx.GetContext()
+		if reqCtx == nil || reqCtx.GetUserID() == 0 {
+			recordAuthzDenied(ctx, AuditRecord{
+				Decision:   "deny",
+				Reason:     "用户未认证",
+				Permission: label,
+			})
+			return errorx.New(errorx.Unauthorized, "用户未认证")
+		}
+
+		var missing []string
+		for _, p := range permissions {
+			if !HasPermission(reqCtx, p) {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) == 0 || (!requireAll && len(missing) < len(permissions)) {
+			recordAuthzAllowed(ctx, AuditRecord{Reason: "权限校验通过", Permission: label})
+			return next()
+		}
+
+		recordAuthzDenied(ctx, AuditRecord{
+			Decision:   "deny",
+			Reason:     "权限不足",
+			Permission: strings.Join(missing, ","),
+		})
+		message := "缺少权限: "
+		if !requireAll {
+			message = "需要以下任一权限: "
+		}
+		return errorx.New(errorx.Forbidden, message+strings.Join(missing, ", ")).
+			WithContext("missing_permissions", missing)
+	}
+}
+
 // AdminOnlyMiddleware 仅管理员中间件
 func AdminOnlyMiddleware() httpx.Middleware {
 	return RoleMiddleware("system_admin")
@@ -142,6 +237,42 @@ func UserOnlyMiddleware() httpx.Middleware {
 	}
 }
 
+// RequireOwnerOrAdmin 资源所有者或管理员中间件
+//
+// extractOwnerID 从请求中提取资源所有者的用户 ID（如路径参数）；当前用户为所有者或拥有 system_admin 角色时放行。
+// 未认证返回 Unauthorized，两者皆不满足返回 Forbidden；extractOwnerID 的错误原样返回。
+func RequireOwnerOrAdmin(extractOwnerID func(httpx.IContext) (int64, error)) httpx.Middleware {
+	return func(ctx httpx.IContext, next func() error) error {
+		reqCtx := ctx.GetContext()
+		if reqCtx == nil || reqCtx.GetUserID() == 0 {
+			recordAuthzDenied(ctx, AuditRecord{
+				Decision: "deny",
+				Reason:   "用户未认证",
+			})
+			return errorx.New(errorx.Unauthorized, "用户未认证")
+		}
+
+		if HasAnyRole(reqCtx, "system_admin") {
+			recordAuthzAllowed(ctx, AuditRecord{Reason: "管理员放行", Role: "system_admin"})
+			return next()
+		}
+
+		ownerID, err := extractOwnerID(ctx)
+		if err != nil {
+			return err
+		}
+		if ownerID != reqCtx.GetUserID() {
+			recordAuthzDenied(ctx, AuditRecord{
+				Decision: "deny",
+				Reason:   "非资源所有者",
+			})
+			return errorx.New(errorx.Forbidden, "无权访问其他用户的资源")
+		}
+		recordAuthzAllowed(ctx, AuditRecord{Reason: "资源所有者"})
+		return next()
+	}
+}
+
 // InjectAuthContext 将角色与权限信息注入 IRequestContext，供后续 RBAC 使用。
 func InjectAuthContext(reqCtx httpx.IRequestContext, userID int64, roles, permissions []string) httpx.IRequestContext {
 	reqCtx = hbasic.WithUserID(reqCtx, userID)
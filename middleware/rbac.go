@@ -56,7 +56,7 @@ func RequireAnyRole(ctx httpx.IRequestContext, required ...string) error {
 	return errorx.New(errorx.Forbidden, "无访问权限")
 }
 
-// HasPermission 判断是否拥有指定权限
+// HasPermission 判断是否拥有指定权限（大小写不敏感；持有的 `resource:*`、`*:*`、`*` 通配符覆盖对应权限）
 func HasPermission(ctx httpx.IRequestContext, permission string) bool {
 	if permission == "" {
 		return true
@@ -66,19 +66,9 @@ func HasPermission(ctx httpx.IRequestContext, permission string) bool {
 		return true
 	}
 	if set := auth.GetPermissionSet(ctx); set != nil {
-		_, ok := set[strings.ToLower(permission)]
-		return ok
+		return auth.PermissionSetCovers(set, permission)
 	}
-	perms := GetPermissions(ctx)
-	if len(perms) == 0 {
-		return false
-	}
-	for _, p := range perms {
-		if strings.EqualFold(p, permission) {
-			return true
-		}
-	}
-	return false
+	return auth.HasPermission(GetPermissions(ctx), permission)
 }
 
 // RequirePermission 校验是否拥有指定权限,否则返回 Forbidden 错误
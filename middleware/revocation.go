@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"gochen/errorx"
+)
+
+// TokenRevoker token 吊销存储（可插拔，如替换为 Redis 实现多实例共享）
+//
+// 支持两种粒度：
+//   - 单个 token：按 jti 记录，保留至 token 自然过期；
+//   - 用户全量：记录吊销时间点，签发时间不晚于该时间点的 token 视为失效（“退出所有设备”）。
+type TokenRevoker interface {
+	// RevokeToken 吊销单个 token（jti），记录保留至 expiresAt
+	RevokeToken(jti string, expiresAt time.Time)
+	// IsTokenRevoked 判断 jti 是否已被吊销
+	IsTokenRevoked(jti string) bool
+	// RevokeAllForUser 吊销用户在 at 及之前签发的全部 token
+	RevokeAllForUser(userID int64, at time.Time)
+	// UserRevokedAt 返回用户全量吊销的时间点
+	UserRevokedAt(userID int64) (time.Time, bool)
+}
+
+// TokenConsumer 可选扩展：原子地检查并吊销 jti，用于一次性令牌（如两步验证挑战令牌）
+//
+// 吊销存储实现该接口时 ConsumeToken 不存在并发重放窗口；多实例共享存储（如 Redis SETNX）应实现。
+type TokenConsumer interface {
+	// ConsumeToken 吊销尚未吊销的 jti 并返回 true；jti 已被吊销时返回 false
+	ConsumeToken(jti string, expiresAt time.Time) bool
+}
+
+var defaultTokenRevoker = struct {
+	mu      sync.RWMutex
+	revoker TokenRevoker
+}{
+	revoker: NewMemoryTokenRevoker(),
+}
+
+// SetDefaultTokenRevoker 设置默认 token 吊销存储；为 nil 时恢复进程内存实现。
+func SetDefaultTokenRevoker(revoker TokenRevoker) {
+	if revoker == nil {
+		revoker = NewMemoryTokenRevoker()
+	}
+	defaultTokenRevoker.mu.Lock()
+	defer defaultTokenRevoker.mu.Unlock()
+	defaultTokenRevoker.revoker = revoker
+}
+
+func currentTokenRevoker() TokenRevoker {
+	defaultTokenRevoker.mu.RLock()
+	defer defaultTokenRevoker.mu.RUnlock()
+	return defaultTokenRevoker.revoker
+}
+
+// RevokeToken 吊销单个 token（用于登出）；记录保留至 token 过期时间。
+//
+// 未携带 jti 的历史 token 无法单独吊销，返回 Validation。
+func RevokeToken(claims *JWTClaims) error {
+	if claims == nil || claims.ID == "" {
+		return errorx.New(errorx.Validation, "token 缺少 jti，无法单独吊销")
+	}
+	currentTokenRevoker().RevokeToken(claims.ID, revocationExpiry(claims))
+	return nil
+}
+
+// ConsumeToken 一次性使用 token：检查并吊销其 jti，已吊销（已被使用）时返回 Unauthorized。
+//
+// 吊销存储实现 TokenConsumer 时检查与吊销为一步；否则退化为先检查后吊销（并发提交存在重放窗口）。
+// 未携带 jti 的 token 无法单独吊销，返回 Validation。
+func ConsumeToken(claims *JWTClaims) error {
+	if claims == nil || claims.ID == "" {
+		return errorx.New(errorx.Validation, "token 缺少 jti，无法单独吊销")
+	}
+	expiresAt := revocationExpiry(claims)
+	revoker := currentTokenRevoker()
+	if consumer, ok := revoker.(TokenConsumer); ok {
+		if !consumer.ConsumeToken(claims.ID, expiresAt) {
+			return errorx.New(errorx.Unauthorized, "token 已失效")
+		}
+		return nil
+	}
+	if revoker.IsTokenRevoked(claims.ID) {
+		return errorx.New(errorx.Unauthorized, "token 已失效")
+	}
+	revoker.RevokeToken(claims.ID, expiresAt)
+	return nil
+}
+
+// revocationExpiry 返回吊销记录的保留截止时间（token 过期时间；缺失时按刷新令牌有效期）
+func revocationExpiry(claims *JWTClaims) time.Time {
+	if claims.ExpiresAt != nil {
+		return claims.ExpiresAt.Time
+	}
+	return time.Now().Add(defaultRefreshTokenTTL)
+}
+
+// RevokeUserTokens 吊销指定用户当前已签发的所有 token（退出所有设备；重新登录/刷新后签发的新 token 不受影响）。
+//
+// 按纳秒精度的签发时间判断先后，吊销后立即登录签发的新 token 不受影响；
+// 仅携带秒级 iat 的历史 token 在同一秒内签发时仍视为失效（偏保守）。
+func RevokeUserTokens(userID int64) {
+	if userID <= 0 {
+		return
+	}
+	currentTokenRevoker().RevokeAllForUser(userID, time.Now())
+}
+
+// IsTokenRevoked 判断 token 声明是否已被吊销（单个 jti 或用户全量吊销）。
+func IsTokenRevoked(claims *JWTClaims) bool {
+	if claims == nil {
+		return false
+	}
+
+	revoker := currentTokenRevoker()
+	if claims.ID != "" && revoker.IsTokenRevoked(claims.ID) {
+		return true
+	}
+
+	revokedAt, ok := revoker.UserRevokedAt(claims.UserID)
+	if !ok {
+		return false
+	}
+	// 无签发时间的 token 无法判断先后，按已吊销处理
+	issuedAt, ok := claims.issuedAt()
+	if !ok {
+		return true
+	}
+	if claims.IssuedAtNano <= 0 {
+		// 秒级 iat 向下取整，与同一秒内的吊销时间点比较时偏保守
+		return !issuedAt.After(revokedAt.Truncate(time.Second))
+	}
+	return !issuedAt.After(revokedAt)
+}
+
+// MemoryTokenRevoker 进程内存 token 吊销存储（单实例适用）
+type MemoryTokenRevoker struct {
+	mu            sync.Mutex
+	revokedTokens map[string]time.Time
+	revokedBefore map[int64]time.Time
+}
+
+// NewMemoryTokenRevoker 创建进程内存 token 吊销存储
+func NewMemoryTokenRevoker() *MemoryTokenRevoker {
+	return &MemoryTokenRevoker{
+		revokedTokens: map[string]time.Time{},
+		revokedBefore: map[int64]time.Time{},
+	}
+}
+
+// RevokeToken 记录吊销的 jti，并顺带清理已过期的记录
+func (r *MemoryTokenRevoker) RevokeToken(jti string, expiresAt time.Time) {
+	if jti == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now())
+	r.revokedTokens[jti] = expiresAt
+}
+
+// ConsumeToken 在同一把锁内检查并吊销 jti（实现 TokenConsumer）
+func (r *MemoryTokenRevoker) ConsumeToken(jti string, expiresAt time.Time) bool {
+	if jti == "" {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked(time.Now())
+	if _, ok := r.revokedTokens[jti]; ok {
+		return false
+	}
+	r.revokedTokens[jti] = expiresAt
+	return true
+}
+
+// pruneLocked 清理已过期的 jti 记录（调用方需持有锁）
+func (r *MemoryTokenRevoker) pruneLocked(now time.Time) {
+	for k, exp := range r.revokedTokens {
+		if now.After(exp) {
+			delete(r.revokedTokens, k)
+		}
+	}
+}
+
+// IsTokenRevoked 判断 jti 是否已被吊销（过期记录视为不存在：token 本身已无法通过校验）
+func (r *MemoryTokenRevoker) IsTokenRevoked(jti string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	exp, ok := r.revokedTokens[jti]
+	if !ok {
+		return false
+	}
+	if time.Now().After(exp) {
+		delete(r.revokedTokens, jti)
+		return false
+	}
+	return true
+}
+
+// RevokeAllForUser 记录用户全量吊销时间点
+func (r *MemoryTokenRevoker) RevokeAllForUser(userID int64, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revokedBefore[userID] = at
+}
+
+// UserRevokedAt 返回用户全量吊销时间点
+func (r *MemoryTokenRevoker) UserRevokedAt(userID int64) (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	at, ok := r.revokedBefore[userID]
+	return at, ok
+}
@@ -0,0 +1,347 @@
+package middleware
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"gochen/errorx"
+)
+
+const (
+	// SessionLimitPolicyReject 达到并发会话上限时拒绝新登录（默认）
+	SessionLimitPolicyReject = "reject"
+	// SessionLimitPolicyEvictOldest 达到并发会话上限时吊销最早的会话，允许新登录
+	SessionLimitPolicyEvictOldest = "evict_oldest"
+)
+
+// Session 登录会话（一次登录签发的访问令牌 + 刷新令牌）
+//
+// ID 为刷新令牌的 jti；会话在刷新令牌过期或被吊销前视为活跃。
+type Session struct {
+	ID                   string    `json:"id"`
+	UserID               int64     `json:"user_id"`
+	AccessTokenID        string    `json:"access_token_id"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+	// PreviousAccessTokens 本会话此前签发、尚未过期的访问令牌（刷新后保留，吊销会话时一并吊销）
+	PreviousAccessTokens []SessionToken `json:"previous_access_tokens,omitempty"`
+	IssuedAt             time.Time      `json:"issued_at"`
+	ExpiresAt            time.Time      `json:"expires_at"`
+	// CreatedAt 登记时间（精确到纳秒，用于确定最早的会话）
+	CreatedAt time.Time `json:"created_at"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+// SessionToken 会话内签发的令牌（jti 与过期时间）
+type SessionToken struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SessionClient 登录请求的客户端信息（随会话登记，便于用户识别设备）
+type SessionClient struct {
+	UserAgent string
+	IP        string
+}
+
+// SessionTracker 会话存储（可插拔，如替换为 Redis 实现多实例共享）
+type SessionTracker interface {
+	// SaveSession 写入或覆盖会话（按 UserID + ID）
+	SaveSession(session *Session)
+	// ListSessions 返回用户未过期的会话，按登记时间正序
+	ListSessions(userID int64) []*Session
+	// DeleteSession 删除会话
+	DeleteSession(userID int64, sessionID string)
+}
+
+var defaultSessionTracker = struct {
+	mu      sync.RWMutex
+	tracker SessionTracker
+}{
+	tracker: NewMemorySessionTracker(),
+}
+
+// sessionLimitMu 串行化会话上限检查与写入（进程内；多实例部署下上限为近似值）
+var sessionLimitMu sync.Mutex
+
+// SetDefaultSessionTracker 设置默认会话存储；为 nil 时恢复进程内存实现。
+func SetDefaultSessionTracker(tracker SessionTracker) {
+	if tracker == nil {
+		tracker = NewMemorySessionTracker()
+	}
+	defaultSessionTracker.mu.Lock()
+	defer defaultSessionTracker.mu.Unlock()
+	defaultSessionTracker.tracker = tracker
+}
+
+func currentSessionTracker() SessionTracker {
+	defaultSessionTracker.mu.RLock()
+	defer defaultSessionTracker.mu.RUnlock()
+	return defaultSessionTracker.tracker
+}
+
+// StartSession 登录成功签发令牌后登记会话，并执行并发会话上限（config.MaxConcurrentSessions，<=0 不限制）。
+//
+// 已吊销（登出、退出所有设备等）的会话不计入。达到上限时按 config.SessionLimitPolicy 处理：
+//   - reject（默认）：返回 Forbidden，本次签发的令牌不应下发；
+//   - evict_oldest：吊销最早的会话（访问令牌与刷新令牌）直至低于上限，再登记新会话。
+func StartSession(accessToken, refreshToken string, client SessionClient, config *AuthConfig) error {
+	if config == nil {
+		config = DefaultAuthConfig()
+	}
+
+	// 1. 解析本次签发的令牌
+	access, err := ParseToken(accessToken, config.SecretKey)
+	if err != nil {
+		return err
+	}
+	refresh, err := ParseRefreshToken(refreshToken, config.SecretKey)
+	if err != nil {
+		return err
+	}
+	if refresh.ID == "" || refresh.UserID != access.UserID {
+		return errorx.New(errorx.Validation, "会话令牌不匹配")
+	}
+
+	sessionLimitMu.Lock()
+	defer sessionLimitMu.Unlock()
+
+	// 2. 统计活跃会话（顺带清理已吊销的会话）
+	tracker := currentSessionTracker()
+	active := activeSessions(tracker, access.UserID)
+
+	// 3. 执行上限策略
+	if limit := config.MaxConcurrentSessions; limit > 0 && len(active) >= limit {
+		if config.SessionLimitPolicy != SessionLimitPolicyEvictOldest {
+			return errorx.New(errorx.Forbidden, "已达到最大并发会话数，请先退出其他设备")
+		}
+		for _, s := range active[:len(active)-limit+1] {
+			evictSession(tracker, s)
+		}
+	}
+
+	// 4. 登记新会话
+	tracker.SaveSession(&Session{
+		ID:                   refresh.ID,
+		UserID:               refresh.UserID,
+		AccessTokenID:        access.ID,
+		AccessTokenExpiresAt: claimsExpiresAt(access),
+		IssuedAt:             claimsIssuedAt(refresh),
+		ExpiresAt:            claimsExpiresAt(refresh),
+		CreatedAt:            time.Now(),
+		UserAgent:            client.UserAgent,
+		IP:                   client.IP,
+	})
+	return nil
+}
+
+// UpdateSessionAccessToken 刷新令牌换取新访问令牌后更新会话关联的访问令牌（未登记的会话忽略）
+//
+// 旧访问令牌在过期前仍然有效，因此保留在 PreviousAccessTokens 中，吊销会话时一并吊销。
+func UpdateSessionAccessToken(refreshClaims *JWTClaims, accessToken string, config *AuthConfig) {
+	if refreshClaims == nil || refreshClaims.ID == "" {
+		return
+	}
+	if config == nil {
+		config = DefaultAuthConfig()
+	}
+	access, err := ParseToken(accessToken, config.SecretKey)
+	if err != nil {
+		return
+	}
+
+	tracker := currentSessionTracker()
+	for _, s := range tracker.ListSessions(refreshClaims.UserID) {
+		if s.ID != refreshClaims.ID {
+			continue
+		}
+		s.PreviousAccessTokens = unexpiredTokens(s.PreviousAccessTokens, time.Now())
+		if s.AccessTokenID != "" && s.AccessTokenID != access.ID {
+			s.PreviousAccessTokens = append(s.PreviousAccessTokens, SessionToken{ID: s.AccessTokenID, ExpiresAt: s.AccessTokenExpiresAt})
+		}
+		s.AccessTokenID = access.ID
+		s.AccessTokenExpiresAt = claimsExpiresAt(access)
+		tracker.SaveSession(s)
+		return
+	}
+}
+
+// EndSession 删除会话（登出时调用；令牌本身的吊销由 RevokeToken 负责）
+func EndSession(userID int64, sessionID string) {
+	if userID <= 0 || sessionID == "" {
+		return
+	}
+	currentSessionTracker().DeleteSession(userID, sessionID)
+}
+
+// RevokeSession 吊销用户的指定会话（sessionID 可为会话 ID 即刷新令牌 jti，或会话内签发的任一访问令牌 jti）
+//
+// 会话内签发的全部访问令牌（含刷新前的旧令牌）与刷新令牌均被吊销，AuthMiddleware 与刷新接口随即拒绝；会话不存在或已失效时返回 false。
+func RevokeSession(userID int64, sessionID string) bool {
+	if userID <= 0 || sessionID == "" {
+		return false
+	}
+	tracker := currentSessionTracker()
+	for _, s := range activeSessions(tracker, userID) {
+		if s.ID == sessionID || s.hasAccessToken(sessionID) {
+			evictSession(tracker, s)
+			return true
+		}
+	}
+	return false
+}
+
+// hasAccessToken 判断 jti 是否为本会话签发的访问令牌（当前或此前）
+func (s *Session) hasAccessToken(tokenID string) bool {
+	if s.AccessTokenID == tokenID {
+		return true
+	}
+	for _, t := range s.PreviousAccessTokens {
+		if t.ID == tokenID {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveSessions 返回用户当前活跃的会话（未过期且未被吊销），按登记时间正序
+func ActiveSessions(userID int64) []*Session {
+	return activeSessions(currentSessionTracker(), userID)
+}
+
+// activeSessions 过滤并删除已吊销的会话
+func activeSessions(tracker SessionTracker, userID int64) []*Session {
+	sessions := tracker.ListSessions(userID)
+	active := make([]*Session, 0, len(sessions))
+	for _, s := range sessions {
+		if sessionRevoked(s) {
+			tracker.DeleteSession(userID, s.ID)
+			continue
+		}
+		active = append(active, s)
+	}
+	return active
+}
+
+// sessionRevoked 判断会话的刷新令牌是否已被吊销（单个 jti 或用户全量吊销）
+func sessionRevoked(s *Session) bool {
+	return IsTokenRevoked(&JWTClaims{
+		UserID:       s.UserID,
+		IssuedAtNano: s.IssuedAt.UnixNano(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       s.ID,
+			IssuedAt: jwt.NewNumericDate(s.IssuedAt),
+		},
+	})
+}
+
+// claimsIssuedAt 返回令牌签发时间（缺失时为当前时间）
+func claimsIssuedAt(claims *JWTClaims) time.Time {
+	if issuedAt, ok := claims.issuedAt(); ok {
+		return issuedAt
+	}
+	return time.Now()
+}
+
+// claimsExpiresAt 返回令牌过期时间（缺失时为零值，表示不过期）
+func claimsExpiresAt(claims *JWTClaims) time.Time {
+	if claims.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAt.Time
+}
+
+// unexpiredTokens 过滤掉已过期的令牌（零值过期时间视为不过期）
+func unexpiredTokens(tokens []SessionToken, now time.Time) []SessionToken {
+	kept := tokens[:0:0]
+	for _, t := range tokens {
+		if t.ExpiresAt.IsZero() || now.Before(t.ExpiresAt) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// evictSession 吊销会话内签发的全部访问令牌与刷新令牌并删除会话
+func evictSession(tracker SessionTracker, s *Session) {
+	revoker := currentTokenRevoker()
+	if s.AccessTokenID != "" {
+		revoker.RevokeToken(s.AccessTokenID, s.AccessTokenExpiresAt)
+	}
+	for _, t := range s.PreviousAccessTokens {
+		revoker.RevokeToken(t.ID, t.ExpiresAt)
+	}
+	revoker.RevokeToken(s.ID, s.ExpiresAt)
+	tracker.DeleteSession(s.UserID, s.ID)
+}
+
+// MemorySessionTracker 进程内存会话存储（单实例适用）
+type MemorySessionTracker struct {
+	mu       sync.Mutex
+	sessions map[int64]map[string]*Session
+}
+
+// NewMemorySessionTracker 创建进程内存会话存储
+func NewMemorySessionTracker() *MemorySessionTracker {
+	return &MemorySessionTracker{
+		sessions: map[int64]map[string]*Session{},
+	}
+}
+
+// SaveSession 写入或覆盖会话
+func (t *MemorySessionTracker) SaveSession(session *Session) {
+	if session == nil || session.ID == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byID, ok := t.sessions[session.UserID]
+	if !ok {
+		byID = map[string]*Session{}
+		t.sessions[session.UserID] = byID
+	}
+	copied := *session
+	byID[session.ID] = &copied
+}
+
+// ListSessions 返回用户未过期的会话（按登记时间正序），并顺带清理已过期的记录
+func (t *MemorySessionTracker) ListSessions(userID int64) []*Session {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	byID := t.sessions[userID]
+	sessions := make([]*Session, 0, len(byID))
+	for id, s := range byID {
+		if !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt) {
+			delete(byID, id)
+			continue
+		}
+		copied := *s
+		sessions = append(sessions, &copied)
+	}
+	if len(byID) == 0 {
+		delete(t.sessions, userID)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions
+}
+
+// DeleteSession 删除会话
+func (t *MemorySessionTracker) DeleteSession(userID int64, sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if byID, ok := t.sessions[userID]; ok {
+		delete(byID, sessionID)
+		if len(byID) == 0 {
+			delete(t.sessions, userID)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"testing"
+
+	"gochen/errorx"
+)
+
+// issueSession 签发一对访问/刷新令牌并登记会话
+func issueSession(t *testing.T, userID int64, config *AuthConfig) (access, refresh string, err error) {
+	t.Helper()
+	access, genErr := GenerateToken(userID, "session", []string{"user"}, nil, config.SecretKey)
+	if genErr != nil {
+		t.Fatalf("GenerateToken failed: %v", genErr)
+	}
+	refresh, genErr = GenerateRefreshToken(userID, "session", config.SecretKey, 0)
+	if genErr != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", genErr)
+	}
+	return access, refresh, StartSession(access, refresh, SessionClient{}, config)
+}
+
+func TestStartSession_RejectPolicy(t *testing.T) {
+	SetDefaultTokenRevoker(NewMemoryTokenRevoker())
+	defer SetDefaultTokenRevoker(nil)
+	SetDefaultSessionTracker(NewMemorySessionTracker())
+	defer SetDefaultSessionTracker(nil)
+
+	config := &AuthConfig{SecretKey: "session-secret", MaxConcurrentSessions: 2, SessionLimitPolicy: SessionLimitPolicyReject}
+	userID := int64(7001)
+
+	_, firstRefresh, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if _, _, err := issueSession(t, userID, config); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+
+	// 达到上限：拒绝新登录，已有会话不受影响
+	if _, _, err := issueSession(t, userID, config); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden at limit, got %v", err)
+	}
+	if n := len(ActiveSessions(userID)); n != 2 {
+		t.Fatalf("expected 2 active sessions, got %d", n)
+	}
+
+	// 其他用户不受影响
+	if _, _, err := issueSession(t, userID+1, config); err != nil {
+		t.Fatalf("other user login: %v", err)
+	}
+
+	// 登出（吊销刷新令牌）释放名额
+	claims, err := ParseRefreshToken(firstRefresh, config.SecretKey)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken failed: %v", err)
+	}
+	if err := RevokeToken(claims); err != nil {
+		t.Fatalf("RevokeToken failed: %v", err)
+	}
+	if _, _, err := issueSession(t, userID, config); err != nil {
+		t.Fatalf("expected login after logout to succeed, got %v", err)
+	}
+}
+
+func TestStartSession_EvictOldestPolicy(t *testing.T) {
+	SetDefaultTokenRevoker(NewMemoryTokenRevoker())
+	defer SetDefaultTokenRevoker(nil)
+	SetDefaultSessionTracker(NewMemorySessionTracker())
+	defer SetDefaultSessionTracker(nil)
+
+	config := &AuthConfig{SecretKey: "session-secret", MaxConcurrentSessions: 2, SessionLimitPolicy: SessionLimitPolicyEvictOldest}
+	userID := int64(7002)
+
+	oldestAccess, oldestRefresh, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	secondAccess, _, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+
+	// 达到上限：吊销最早的会话，新登录成功
+	newestAccess, _, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("expected login to evict oldest session, got %v", err)
+	}
+	if n := len(ActiveSessions(userID)); n != 2 {
+		t.Fatalf("expected 2 active sessions, got %d", n)
+	}
+
+	if _, err := validateToken(oldestAccess, config.SecretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected evicted access token to be revoked, got %v", err)
+	}
+	if _, err := RefreshToken(oldestRefresh, config.SecretKey); err == nil {
+		t.Fatal("expected evicted refresh token to be revoked")
+	}
+	for _, token := range []string{secondAccess, newestAccess} {
+		if _, err := validateToken(token, config.SecretKey); err != nil {
+			t.Fatalf("expected remaining session valid, got %v", err)
+		}
+	}
+}
+
+func TestStartSession_Unlimited(t *testing.T) {
+	SetDefaultSessionTracker(NewMemorySessionTracker())
+	defer SetDefaultSessionTracker(nil)
+
+	config := &AuthConfig{SecretKey: "session-secret"}
+	for i := 0; i < 5; i++ {
+		if _, _, err := issueSession(t, 7003, config); err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+	if n := len(ActiveSessions(7003)); n != 5 {
+		t.Fatalf("expected 5 active sessions, got %d", n)
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	SetDefaultTokenRevoker(NewMemoryTokenRevoker())
+	defer SetDefaultTokenRevoker(nil)
+	SetDefaultSessionTracker(NewMemorySessionTracker())
+	defer SetDefaultSessionTracker(nil)
+
+	config := &AuthConfig{SecretKey: "session-secret"}
+	userID := int64(7004)
+
+	firstAccess, firstRefresh, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	secondAccess, _, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	first, err := ParseRefreshToken(firstRefresh, config.SecretKey)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken failed: %v", err)
+	}
+
+	// 其他用户无法吊销；未知 jti 返回 false
+	if RevokeSession(userID+1, first.ID) || RevokeSession(userID, "unknown") {
+		t.Fatal("expected revoke of foreign/unknown session to fail")
+	}
+
+	if !RevokeSession(userID, first.ID) {
+		t.Fatal("expected session revoked")
+	}
+	if n := len(ActiveSessions(userID)); n != 1 {
+		t.Fatalf("expected 1 active session, got %d", n)
+	}
+	if _, err := validateToken(firstAccess, config.SecretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected revoked access token rejected, got %v", err)
+	}
+	if _, err := RefreshToken(firstRefresh, config.SecretKey); err == nil {
+		t.Fatal("expected revoked refresh token rejected")
+	}
+	if _, err := validateToken(secondAccess, config.SecretKey); err != nil {
+		t.Fatalf("expected other session valid, got %v", err)
+	}
+
+	// 按访问令牌 jti 吊销
+	second, err := ParseToken(secondAccess, config.SecretKey)
+	if err != nil {
+		t.Fatalf("ParseToken failed: %v", err)
+	}
+	if !RevokeSession(userID, second.ID) {
+		t.Fatal("expected session revoked by access token jti")
+	}
+	if n := len(ActiveSessions(userID)); n != 0 {
+		t.Fatalf("expected no active sessions, got %d", n)
+	}
+}
+
+func TestRevokeSession_RevokesRefreshedAccessTokens(t *testing.T) {
+	SetDefaultTokenRevoker(NewMemoryTokenRevoker())
+	defer SetDefaultTokenRevoker(nil)
+	SetDefaultSessionTracker(NewMemorySessionTracker())
+	defer SetDefaultSessionTracker(nil)
+
+	config := &AuthConfig{SecretKey: "session-secret"}
+	userID := int64(7201)
+
+	firstAccess, refresh, err := issueSession(t, userID, config)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	refreshClaims, err := ParseRefreshToken(refresh, config.SecretKey)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken failed: %v", err)
+	}
+
+	// 刷新两次：会话内共签发三个访问令牌，旧令牌在过期前仍然有效
+	accessTokens := []string{firstAccess}
+	for i := 0; i < 2; i++ {
+		access, err := GenerateToken(userID, "session", []string{"user"}, nil, config.SecretKey)
+		if err != nil {
+			t.Fatalf("GenerateToken failed: %v", err)
+		}
+		UpdateSessionAccessToken(refreshClaims, access, config)
+		accessTokens = append(accessTokens, access)
+	}
+
+	// 以最早的访问令牌 jti 定位会话
+	firstClaims, err := ParseToken(firstAccess, config.SecretKey)
+	if err != nil {
+		t.Fatalf("ParseToken failed: %v", err)
+	}
+	if !RevokeSession(userID, firstClaims.ID) {
+		t.Fatal("expected session to be found by an earlier access token id")
+	}
+
+	for i, token := range accessTokens {
+		claims, err := ParseToken(token, config.SecretKey)
+		if err != nil {
+			t.Fatalf("ParseToken failed: %v", err)
+		}
+		if !IsTokenRevoked(claims) {
+			t.Fatalf("expected access token #%d of the session to be revoked", i)
+		}
+	}
+	if !IsTokenRevoked(refreshClaims) {
+		t.Fatal("expected refresh token to be revoked")
+	}
+	if n := len(ActiveSessions(userID)); n != 0 {
+		t.Fatalf("expected no active sessions, got %d", n)
+	}
+}
@@ -1,11 +1,15 @@
 package middleware
 
 import (
+	"context"
+	"sync"
+
 	"gochen/errorx"
 	"gochen/httpx"
+	hbasic "gochen/httpx/nethttp"
 )
 
-// RequireTenant 要求请求上下文中已注入 tenant_id（通常来自 Header: X-Tenant-ID）。
+// RequireTenant 要求请求上下文中已注入 tenant_id（来自令牌租户声明或经成员关系校验的 X-Tenant-ID）。
 func RequireTenant(ctx httpx.IRequestContext) (string, error) {
 	if ctx == nil {
 		return "", errorx.New(errorx.Unauthorized, "用户未认证")
@@ -30,3 +34,85 @@ func RequireSameTenant(ctx httpx.IRequestContext, targetTenantID string) error {
 	}
 	return nil
 }
+
+// TenantMembershipChecker 校验用户是否属于指定租户（tenantID 为租户业务编码，对应 tenants.key）
+type TenantMembershipChecker func(ctx context.Context, userID int64, tenantID string) (bool, error)
+
+var defaultTenantMembershipChecker = struct {
+	mu      sync.RWMutex
+	checker TenantMembershipChecker
+}{}
+
+// SetTenantMembershipChecker 设置租户成员关系校验；为 nil 时不属于任何租户的用户无法通过租户头切换租户。
+func SetTenantMembershipChecker(checker TenantMembershipChecker) {
+	defaultTenantMembershipChecker.mu.Lock()
+	defer defaultTenantMembershipChecker.mu.Unlock()
+	defaultTenantMembershipChecker.checker = checker
+}
+
+func currentTenantMembershipChecker() TenantMembershipChecker {
+	defaultTenantMembershipChecker.mu.RLock()
+	defer defaultTenantMembershipChecker.mu.RUnlock()
+	return defaultTenantMembershipChecker.checker
+}
+
+// resolveRequestTenant 解析已认证请求的租户，租户头（及开启 AllowTenantQuery 时的 tenant_id 参数）只作为声明的佐证：
+//   - 令牌携带租户声明：以声明为准，租户头缺省时沿用声明，不一致时返回 Forbidden；
+//   - 令牌无租户声明：租户头须通过 TenantMembershipChecker 校验成员关系，未配置或校验失败返回 Forbidden；
+//   - 两者皆无：不注入租户（开启 RequireTenant 时返回 Validation）。
+func resolveRequestTenant(ctx httpx.IContext, config *AuthConfig, claims *JWTClaims) (string, error) {
+	requested := ctx.GetHeader(config.TenantHeader)
+	if requested == "" && config.AllowTenantQuery {
+		requested = ctx.GetQuery("tenant_id")
+	}
+
+	if claims.TenantID != "" {
+		if requested != "" && requested != claims.TenantID {
+			return "", errorx.New(errorx.Forbidden, "请求租户与令牌不一致")
+		}
+		return claims.TenantID, nil
+	}
+	if requested == "" {
+		if config.RequireTenant {
+			return "", errorx.New(errorx.Validation, "tenant_id is required")
+		}
+		return "", nil
+	}
+
+	checker := currentTenantMembershipChecker()
+	if checker == nil {
+		return "", errorx.New(errorx.Forbidden, "跨租户访问被拒绝")
+	}
+	ok, err := checker(ctx.GetContext(), claims.UserID, requested)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errorx.New(errorx.Forbidden, "跨租户访问被拒绝")
+	}
+	return requested, nil
+}
+
+// applyRequestTenant 解析请求租户并写入请求上下文；拒绝时记录审计
+func applyRequestTenant(ctx httpx.IContext, reqCtx httpx.IRequestContext, config *AuthConfig, claims *JWTClaims) (httpx.IRequestContext, error) {
+	tenantID, err := resolveRequestTenant(ctx, config, claims)
+	if err != nil {
+		recordAuthzDenied(ctx, AuditRecord{
+			Decision: "deny",
+			Reason:   err.Error(),
+		})
+		return nil, err
+	}
+	if tenantID == "" {
+		return reqCtx, nil
+	}
+	derived, err := hbasic.WithTenantID(reqCtx, tenantID)
+	if err != nil {
+		recordAuthzDenied(ctx, AuditRecord{
+			Decision: "deny",
+			Reason:   "invalid tenant_id",
+		})
+		return nil, err
+	}
+	return derived, nil
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gochen/errorx"
+	"gochen/httpx"
+	hbasic "gochen/httpx/nethttp"
+)
+
+func TestAuthMiddleware_TenantFromClaimsOrMembership(t *testing.T) {
+	RegisterRequiredPermissions("user:read")
+	SetDefaultTokenRevoker(NewMemoryTokenRevoker())
+	defer SetDefaultTokenRevoker(nil)
+	defer SetTenantMembershipChecker(nil)
+
+	config := DefaultAuthConfig()
+	config.SecretKey = "tenant-secret"
+
+	call := func(mw httpx.Middleware, token, header string) (string, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if header != "" {
+			req.Header.Set(httpx.HeaderTenantID, header)
+		}
+		ctx, err := hbasic.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		var tenantID string
+		err = mw(ctx, func() error {
+			tenantID = ctx.GetContext().GetTenantID()
+			return nil
+		})
+		return tenantID, err
+	}
+	issue := func(userID int64, tenantID string) string {
+		token, err := GenerateTenantTokenWithTTL(userID, "tenant_user", tenantID, []string{"user"}, nil, config.SecretKey, 0)
+		if err != nil {
+			t.Fatalf("GenerateTenantTokenWithTTL failed: %v", err)
+		}
+		return token
+	}
+
+	authMW := AuthMiddleware(config)
+	tenantToken := issue(9301, "tenant-a")
+
+	// 令牌声明租户：省略租户头时沿用声明，一致时放行，不一致时拒绝
+	for _, header := range []string{"", "tenant-a"} {
+		got, err := call(authMW, tenantToken, header)
+		if err != nil || got != "tenant-a" {
+			t.Fatalf("header %q: expected tenant-a, got %q, %v", header, got, err)
+		}
+	}
+	if _, err := call(authMW, tenantToken, "tenant-b"); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for mismatched header, got %v", err)
+	}
+
+	// 无租户声明：未配置成员关系校验时拒绝租户头，不带租户头时不隔离
+	globalToken := issue(9302, "")
+	if _, err := call(authMW, globalToken, "tenant-a"); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden without membership checker, got %v", err)
+	}
+	if got, err := call(authMW, globalToken, ""); err != nil || got != "" {
+		t.Fatalf("expected no tenant, got %q, %v", got, err)
+	}
+
+	// 按成员关系校验租户头
+	SetTenantMembershipChecker(func(_ context.Context, userID int64, tenantID string) (bool, error) {
+		return userID == 9302 && tenantID == "tenant-a", nil
+	})
+	if got, err := call(authMW, globalToken, "tenant-a"); err != nil || got != "tenant-a" {
+		t.Fatalf("expected member tenant-a, got %q, %v", got, err)
+	}
+	if _, err := call(authMW, globalToken, "tenant-b"); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for non-member tenant, got %v", err)
+	}
+
+	// 可选鉴权：同样校验已认证请求，匿名请求忽略租户头
+	optionalMW := OptionalAuthMiddleware(config)
+	if _, err := call(optionalMW, tenantToken, "tenant-b"); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for mismatched header (optional auth), got %v", err)
+	}
+	if got, err := call(optionalMW, "", "tenant-b"); err != nil || got != "" {
+		t.Fatalf("expected anonymous request without tenant, got %q, %v", got, err)
+	}
+}
@@ -1,6 +1,8 @@
 package iam
 
 import (
+	"context"
+
 	iammw "gochen-iam/middleware"
 	grouprepo "gochen-iam/repo/group"
 	menurepo "gochen-iam/repo/menu"
@@ -9,6 +11,7 @@ import (
 	userrepo "gochen-iam/repo/user"
 	iamrouter "gochen-iam/router"
 	iamservice "gochen-iam/service"
+	adminsvc "gochen-iam/service/admin"
 	groupsvc "gochen-iam/service/group"
 	menusvc "gochen-iam/service/menu"
 	rolesvc "gochen-iam/service/role"
@@ -16,6 +19,7 @@ import (
 	usersvc "gochen-iam/service/user"
 	"gochen/errorx"
 	"gochen/httpx"
+	"gochen/logging"
 	"gochen/server"
 )
 
@@ -37,6 +41,7 @@ func NewModule() (server.IModule, error) {
 			groupsvc.NewGroupService,
 			rolesvc.NewRoleService,
 			menusvc.NewMenuService,
+			adminsvc.NewAdminService,
 		},
 		RouteRegistrars: []any{
 			iamrouter.NewAuthRoutes,
@@ -45,7 +50,10 @@ func NewModule() (server.IModule, error) {
 			iamrouter.NewGroupRoutes,
 			iamrouter.NewTenantRoutes,
 			iamrouter.NewMenuRoutes,
+			iamrouter.NewAdminRoutes,
 			NewStrictPermissionRegistryValidator,
+			NewDefaultRoleValidator,
+			NewTenantMembershipBinder,
 		},
 		// IAM 模块既包含匿名可访问的登录/注册端点，也包含需要鉴权的管理端点。
 		// 使用 OptionalAuthMiddleware 统一解析 token（若存在），供后续 PermissionMiddleware 等使用。
@@ -69,3 +77,44 @@ func (v *strictPermissionRegistryValidator) RegisterRoutes(httpx.IRouteGroup) er
 	}
 	return nil
 }
+
+type defaultRoleValidator struct {
+	userService *usersvc.UserService
+	logger      logging.ILogger
+}
+
+func NewDefaultRoleValidator(userService *usersvc.UserService) *defaultRoleValidator {
+	return &defaultRoleValidator{
+		userService: userService,
+		logger:      logging.ComponentLogger("iam.module"),
+	}
+}
+
+func (v *defaultRoleValidator) RegisterRoutes(httpx.IRouteGroup) error {
+	// 启动期校验注册默认角色存在：严格模式 fail-close，否则仅告警（注册用户将没有默认角色）。
+	ctx := context.Background()
+	if err := v.userService.ValidateDefaultRole(ctx); err != nil {
+		if iamservice.DefaultRoleStrict() {
+			return errorx.Wrap(err, errorx.Internal, "default role validation failed")
+		}
+		v.logger.Warn(ctx, "[IAM] 注册默认角色校验失败，新注册用户将没有默认角色",
+			logging.Error(err),
+			logging.String("role", iamservice.DefaultRoleName()),
+		)
+	}
+	return nil
+}
+
+type tenantMembershipBinder struct {
+	userService *usersvc.UserService
+}
+
+func NewTenantMembershipBinder(userService *usersvc.UserService) *tenantMembershipBinder {
+	return &tenantMembershipBinder{userService: userService}
+}
+
+func (b *tenantMembershipBinder) RegisterRoutes(httpx.IRouteGroup) error {
+	// 不属于任何租户的用户通过租户头访问某租户时，按 user_tenants 成员关系校验（tenants.key）。
+	iammw.SetTenantMembershipChecker(b.userService.IsTenantMember)
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package actor 提供写入操作者（created_by/updated_by/deleted_by）的辅助函数。
+//
+// 操作者取自请求上下文中的用户 ID（AuthMiddleware 注入）；未认证的内部调用
+// （系统初始化、定时任务等）记为 System。
+package actor
+
+import (
+	"context"
+	"time"
+
+	"gochen/httpx"
+)
+
+// System 系统/引导操作的操作者（无请求用户）
+const System int64 = 0
+
+// ITracked 记录操作者的实体
+type ITracked interface {
+	GetCreatedBy() int64
+	SetCreatedBy(userID int64)
+	SetUpdatedBy(userID int64)
+}
+
+// FromContext 从请求上下文中获取操作者用户 ID（未认证或内部调用时返回 System）
+func FromContext(ctx context.Context) int64 {
+	if ctx == nil {
+		return System
+	}
+	switch v := ctx.Value(httpx.UserIDKey).(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return System
+}
+
+// StampCreate 新建实体时写入创建者与最后修改者（已指定创建者时保留）
+func StampCreate(ctx context.Context, e ITracked) {
+	by := FromContext(ctx)
+	if e.GetCreatedBy() == System {
+		e.SetCreatedBy(by)
+	}
+	e.SetUpdatedBy(by)
+}
+
+// StampUpdate 更新实体时写入最后修改者
+func StampUpdate(ctx context.Context, e ITracked) {
+	e.SetUpdatedBy(FromContext(ctx))
+}
+
+// StampValues 在按列更新的字段集合中写入最后修改者（updated_by），返回同一集合
+func StampValues(ctx context.Context, values map[string]any) map[string]any {
+	values["updated_by"] = FromContext(ctx)
+	return values
+}
+
+// SoftDeleteValues 返回软删写入的字段集合（删除时间与删除者，并同步最后修改时间与修改者）
+func SoftDeleteValues(ctx context.Context, at time.Time) map[string]any {
+	by := FromContext(ctx)
+	return map[string]any{
+		"deleted_at": at,
+		"deleted_by": by,
+		"updated_at": at,
+		"updated_by": by,
+	}
+}
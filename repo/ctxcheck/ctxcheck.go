@@ -0,0 +1,19 @@
+// Package ctxcheck 提供逐层/逐批遍历时的取消检查。
+//
+// 组织层级、菜单树等遍历会按层或按批多次访问数据库；每次访问前检查请求是否已取消或超时，
+// 避免客户端断开后继续执行查询。
+package ctxcheck
+
+import (
+	"context"
+
+	"gochen/errorx"
+)
+
+// Check 请求已取消或超时时返回包装为 Timeout 的 context 错误（message 描述被中断的操作），否则返回 nil
+func Check(ctx context.Context, message string) error {
+	if err := ctx.Err(); err != nil {
+		return errorx.Wrap(err, errorx.Timeout, message)
+	}
+	return nil
+}
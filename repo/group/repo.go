@@ -2,8 +2,14 @@ package group
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	iamentity "gochen-iam/entity"
+	"gochen-iam/repo/actor"
+	"gochen-iam/repo/ctxcheck"
+	"gochen-iam/repo/linktable"
+	"gochen-iam/repo/tenantscope"
 	"gochen/db/orm"
 	db "gochen/db/orm/repo"
 	"gochen/domain/crud"
@@ -19,7 +25,7 @@ type GroupRepo struct {
 // NewGroupRepository 创建组织Repository
 func NewGroupRepository(o orm.IOrm) (*GroupRepo, error) {
 	base, err := db.NewRepo(
-		o,
+		tenantscope.Wrap(o, tenantscope.Tables...),
 		"groups",
 		db.WithIDGenerator[*iamentity.Group](generator.DefaultInt64Generator()),
 	)
@@ -31,6 +37,18 @@ func NewGroupRepository(o orm.IOrm) (*GroupRepo, error) {
 
 // shared 原生 ICRUDRepository 方法由 CrudBase 提供
 
+// Create 覆盖通用创建，写入创建者/修改者（取自请求上下文）
+func (r *GroupRepo) Create(ctx context.Context, group *iamentity.Group) error {
+	actor.StampCreate(ctx, group)
+	return r.Repo.Create(ctx, group)
+}
+
+// Update 覆盖通用更新，写入修改者（取自请求上下文）
+func (r *GroupRepo) Update(ctx context.Context, group *iamentity.Group) error {
+	actor.StampUpdate(ctx, group)
+	return r.Repo.Update(ctx, group)
+}
+
 // GetByID 根据ID获取组织（过滤软删记录）
 func (r *GroupRepo) GetByID(ctx context.Context, id int64) (*iamentity.Group, error) {
 	model, err := r.ModelFor(ctx)
@@ -70,6 +88,26 @@ func (r *GroupRepo) FindByUserID(ctx context.Context, userID int64) ([]*iamentit
 	return groups, nil
 }
 
+// FindLiteByUserID 根据用户ID查找所属组织（不预加载关联），按 ID 升序
+func (r *GroupRepo) FindLiteByUserID(ctx context.Context, userID int64) ([]*iamentity.Group, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*iamentity.Group
+	err = model.Find(ctx, &groups,
+		orm.WithJoin(orm.InnerJoin("user_groups", "", orm.On("groups.id", "user_groups.group_id"))),
+		orm.WithWhere("user_groups.user_id = ? AND groups.deleted_at IS NULL", userID),
+		orm.WithOrderBy("groups.id", false),
+	)
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户组织失败")
+	}
+
+	return groups, nil
+}
+
 // FindChildren 查找子组织
 func (r *GroupRepo) FindChildren(ctx context.Context, parentID int64) ([]*iamentity.Group, error) {
 	model, err := r.ModelFor(ctx)
@@ -90,6 +128,33 @@ func (r *GroupRepo) FindChildren(ctx context.Context, parentID int64) ([]*iament
 	return groups, nil
 }
 
+// ExistsByNormalizedName 判断同级（parentID 为 nil 表示根组织）是否存在规范化后同名的未删除组织
+//
+// name 须已按 service.NormalizeName 规范化，比较时去除首尾空白，caseFold 为 true 时忽略大小写；
+// excludeID 为自身 ID（0 表示不排除）。
+func (r *GroupRepo) ExistsByNormalizedName(ctx context.Context, name string, parentID *int64, excludeID int64, caseFold bool) (bool, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return false, err
+	}
+	where := "TRIM(name) = ? AND deleted_at IS NULL AND id <> ?"
+	if caseFold {
+		where = "LOWER(TRIM(name)) = ? AND deleted_at IS NULL AND id <> ?"
+	}
+	args := []any{name, excludeID}
+	if parentID == nil {
+		where += " AND parent_id IS NULL"
+	} else {
+		where += " AND parent_id = ?"
+		args = append(args, *parentID)
+	}
+	count, err := model.Count(ctx, orm.WithWhere(where, args...))
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "检查组织名称失败")
+	}
+	return count > 0, nil
+}
+
 // FindRootGroups 查找根组织（没有父组织的组织）
 func (r *GroupRepo) FindRootGroups(ctx context.Context) ([]*iamentity.Group, error) {
 	model, err := r.ModelFor(ctx)
@@ -131,6 +196,28 @@ func (r *GroupRepo) FindByLevel(ctx context.Context, level int) ([]*iamentity.Gr
 	return groups, nil
 }
 
+// FindByLevelRange 查找层级在 [minLevel, maxLevel] 闭区间内的组织，按层级、id 升序
+func (r *GroupRepo) FindByLevelRange(ctx context.Context, minLevel, maxLevel int) ([]*iamentity.Group, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*iamentity.Group
+	err = model.Find(ctx, &groups,
+		orm.WithWhere("level >= ? AND level <= ? AND deleted_at IS NULL", minLevel, maxLevel),
+		orm.WithPreload("Parent"),
+		orm.WithPreload("Users"),
+		orm.WithOrderBy("level", false),
+		orm.WithOrderBy("id", false),
+	)
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织失败")
+	}
+
+	return groups, nil
+}
+
 // FindByPath 根据路径查找组织
 func (r *GroupRepo) FindByPath(ctx context.Context, path string) (*iamentity.Group, error) {
 	model, err := r.ModelFor(ctx)
@@ -156,7 +243,10 @@ func (r *GroupRepo) FindByPath(ctx context.Context, path string) (*iamentity.Gro
 	return &group, nil
 }
 
-// FindAncestors 查找祖先组织
+// FindAncestors 查找祖先组织（按根组织在前排列，不含组织本身）
+//
+// 父组织缺失或层级成环时返回 Internal 错误，避免损坏的层级被静默截断；
+// 每层查询前检查 ctx，请求取消或超时后立即返回 Timeout 错误（可用 errors.Is 判断 context 错误）。
 func (r *GroupRepo) FindAncestors(ctx context.Context, groupID int64) ([]*iamentity.Group, error) {
 	// 首先获取当前组织
 	group, err := r.Repo.Get(ctx, groupID)
@@ -166,12 +256,28 @@ func (r *GroupRepo) FindAncestors(ctx context.Context, groupID int64) ([]*iament
 
 	var ancestors []*iamentity.Group
 	currentGroup := *group // 解引用
+	visited := map[int64]struct{}{groupID: {}}
 
 	// 向上遍历找到所有祖先
 	for currentGroup.ParentID != nil {
-		parent, err := r.Repo.Get(ctx, *currentGroup.ParentID)
+		if err := ctxcheck.Check(ctx, "组织层级遍历已取消"); err != nil {
+			return nil, err
+		}
+		parentID := *currentGroup.ParentID
+		if _, ok := visited[parentID]; ok {
+			return nil, errorx.New(errorx.Internal, "组织层级存在环").
+				WithContext("group_id", currentGroup.GetID()).
+				WithContext("parent_id", parentID)
+		}
+		visited[parentID] = struct{}{}
+		parent, err := r.Repo.Get(ctx, parentID)
 		if err != nil {
-			break // 如果找不到父组织，停止查找
+			if errorx.Is(err, errorx.NotFound) {
+				return nil, errorx.New(errorx.Internal, "组织层级损坏：父组织不存在").
+					WithContext("group_id", currentGroup.GetID()).
+					WithContext("parent_id", parentID)
+			}
+			return nil, errorx.Wrap(err, errorx.Database, "查询父组织失败")
 		}
 		ancestors = append([]*iamentity.Group{parent}, ancestors...) // 插入到开头，解引用
 		currentGroup = *parent                                       // 解引用
@@ -180,8 +286,17 @@ func (r *GroupRepo) FindAncestors(ctx context.Context, groupID int64) ([]*iament
 	return ancestors, nil
 }
 
-// FindDescendants 查找所有后代组织
+// FindDescendants 查找所有后代组织（父组织先于子组织，不含组织本身）
+//
+// 基于物化路径单次查询整棵子树，见 FindDescendantsByPath。
 func (r *GroupRepo) FindDescendants(ctx context.Context, groupID int64) ([]*iamentity.Group, error) {
+	return r.FindDescendantsByPath(ctx, groupID)
+}
+
+// FindDescendantsRecursive 逐层递归查找后代组织（每个节点一次查询）
+//
+// 不依赖 path 字段，可用于校验或修复物化路径缺失/不一致的历史数据。
+func (r *GroupRepo) FindDescendantsRecursive(ctx context.Context, groupID int64) ([]*iamentity.Group, error) {
 	var descendants []*iamentity.Group
 
 	// 递归查找所有后代
@@ -193,8 +308,78 @@ func (r *GroupRepo) FindDescendants(ctx context.Context, groupID int64) ([]*iame
 	return descendants, nil
 }
 
-// findDescendantsRecursive 递归查找后代组织
+// FindDescendantsByPath 按物化路径前缀单次查询全部后代组织（按 path 排序，父组织先于子组织）
+//
+// 组织 path 为空（未回填路径的历史数据）时回退到 FindDescendantsRecursive。
+func (r *GroupRepo) FindDescendantsByPath(ctx context.Context, groupID int64) ([]*iamentity.Group, error) {
+	group, err := r.Repo.Get(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group.Path == "" {
+		return r.FindDescendantsRecursive(ctx, groupID)
+	}
+
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var descendants []*iamentity.Group
+	err = model.Find(ctx, &descendants,
+		orm.WithWhere("path LIKE ? ESCAPE '"+likeEscapeChar+"' AND deleted_at IS NULL", escapeLikePattern(group.Path)+"/%"),
+		orm.WithPreload("Users"),
+		orm.WithPreload("DefaultRoles"),
+		orm.WithOrderBy("path", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询后代组织失败")
+	}
+
+	return descendants, nil
+}
+
+// FindSubtree 单次查询组织及其全部后代，并在内存中组装为树（返回的根组织 Children 逐层填充）
+func (r *GroupRepo) FindSubtree(ctx context.Context, groupID int64) (*iamentity.Group, error) {
+	root, err := r.Repo.Get(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	descendants, err := r.FindDescendantsByPath(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	groupMap := map[int64]*iamentity.Group{root.GetID(): root}
+	root.Children = []*iamentity.Group{}
+	for _, group := range descendants {
+		groupMap[group.GetID()] = group
+		group.Children = []*iamentity.Group{}
+	}
+	for _, group := range descendants {
+		if group.ParentID == nil {
+			continue
+		}
+		if parent, exists := groupMap[*group.ParentID]; exists {
+			parent.Children = append(parent.Children, group)
+		}
+	}
+
+	return root, nil
+}
+
+// likeEscapeChar LIKE 模式的转义字符（避免反斜杠在不同数据库字符串字面量中的差异）
+const likeEscapeChar = "!"
+
+// escapeLikePattern 转义 LIKE 通配符（%、_）与转义字符本身，配合 ESCAPE likeEscapeChar 使用
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(likeEscapeChar, likeEscapeChar+likeEscapeChar, "%", likeEscapeChar+"%", "_", likeEscapeChar+"_").Replace(s)
+}
+
+// findDescendantsRecursive 递归查找后代组织（每个节点查询前检查 ctx，取消后不再继续遍历）
 func (r *GroupRepo) findDescendantsRecursive(ctx context.Context, parentID int64, descendants *[]*iamentity.Group) error {
+	if err := ctxcheck.Check(ctx, "组织层级遍历已取消"); err != nil {
+		return err
+	}
 	children, err := r.FindChildren(ctx, parentID)
 	if err != nil {
 		return err
@@ -212,6 +397,45 @@ func (r *GroupRepo) findDescendantsRecursive(ctx context.Context, parentID int64
 	return nil
 }
 
+// FindByPathPrefix 按路径前缀查找后代组织（不含前缀对应的组织本身）
+func (r *GroupRepo) FindByPathPrefix(ctx context.Context, path string) ([]*iamentity.Group, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*iamentity.Group
+	err = model.Find(ctx, &groups,
+		orm.WithWhere("path LIKE ? ESCAPE '"+likeEscapeChar+"' AND deleted_at IS NULL", escapeLikePattern(path)+"/%"),
+		orm.WithOrderBy("level", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询后代组织失败")
+	}
+
+	return groups, nil
+}
+
+// UpdateHierarchy 更新组织的父级、层级与路径（parentID 为 nil 时置为根组织）
+func (r *GroupRepo) UpdateHierarchy(ctx context.Context, groupID int64, parentID *int64, level int, path string) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	values := map[string]any{
+		"parent_id":  nil,
+		"level":      level,
+		"path":       path,
+		"updated_at": time.Now(),
+	}
+	if parentID != nil {
+		values["parent_id"] = *parentID
+	}
+	if err := model.UpdateValues(ctx, actor.StampValues(ctx, values), orm.WithWhere("id = ?", groupID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新组织层级失败")
+	}
+	return nil
+}
+
 // AddUserToGroup 将用户添加到组织
 func (r *GroupRepo) AddUserToGroup(ctx context.Context, groupID, userID int64) error {
 	// 检查组织是否存在
@@ -220,6 +444,15 @@ func (r *GroupRepo) AddUserToGroup(ctx context.Context, groupID, userID int64) e
 		return err
 	}
 
+	// 已关联时直接返回，重复调用幂等
+	exists, err := linktable.Exists(ctx, r.Orm(), linktable.UserGroups, "user_id", userID, "group_id", groupID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
@@ -231,6 +464,19 @@ func (r *GroupRepo) AddUserToGroup(ctx context.Context, groupID, userID int64) e
 		return errorx.Wrap(err, errorx.Database, "添加用户到组织失败")
 	}
 
+	// 记录加入时间（仅首次加入时写入，重复添加不覆盖）
+	membership, err := r.membershipModel(ctx)
+	if err != nil {
+		return err
+	}
+	err = membership.UpdateValues(ctx, map[string]any{
+		"joined_at": time.Now(),
+	}, orm.WithWhere("group_id = ? AND user_id = ? AND joined_at IS NULL", groupID, userID))
+
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录用户加入组织时间失败")
+	}
+
 	return nil
 }
 
@@ -264,6 +510,15 @@ func (r *GroupRepo) AddDefaultRole(ctx context.Context, groupID, roleID int64) e
 		return err
 	}
 
+	// 已关联时直接返回，重复调用幂等
+	exists, err := linktable.Exists(ctx, r.Orm(), linktable.GroupRoles, "group_id", groupID, "role_id", roleID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
@@ -344,6 +599,52 @@ func (r *GroupRepo) GetGroupTree(ctx context.Context) ([]*iamentity.Group, error
 	return rootGroups, nil
 }
 
+// FindAllLite 获取全部组织（不预加载关联），按 ID 升序
+func (r *GroupRepo) FindAllLite(ctx context.Context) ([]*iamentity.Group, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*iamentity.Group
+	err = model.Find(ctx, &groups,
+		orm.WithWhere("deleted_at IS NULL"),
+		orm.WithOrderBy("id", false),
+	)
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织列表失败")
+	}
+
+	return groups, nil
+}
+
+// CountMembersByGroup 统计各组织成员数量（groupID -> count）
+func (r *GroupRepo) CountMembersByGroup(ctx context.Context) (map[int64]int64, error) {
+	type memberCount struct {
+		GroupID int64
+		Count   int64
+	}
+
+	model, err := r.membershipModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var rows []memberCount
+	err = model.Find(ctx, &rows,
+		orm.WithSelect("group_id", "COUNT(*) as count"),
+		orm.WithGroupBy("group_id"),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "统计组织成员数量失败")
+	}
+
+	counts := make(map[int64]int64, len(rows))
+	for i := range rows {
+		counts[rows[i].GroupID] = rows[i].Count
+	}
+	return counts, nil
+}
+
 // CountByLevel 统计各层级组织数量
 func (r *GroupRepo) CountByLevel(ctx context.Context) (map[int]int64, error) {
 	type LevelCount struct {
@@ -404,6 +705,44 @@ func (r *GroupRepo) SearchGroups(ctx context.Context, keyword string, limit int)
 	return groups, nil
 }
 
+// SearchGroupsPaged 分页搜索组织（名称、描述模糊匹配，不含软删除，不预加载关联），并返回满足条件的总数
+//
+// keyword 为空时不过滤；parentID 非空时仅返回其直接子组织；offset/limit <= 0 表示不分页。
+// 结果按 ID 升序返回，保证跨页顺序稳定。
+func (r *GroupRepo) SearchGroupsPaged(ctx context.Context, keyword string, parentID *int64, offset, limit int) ([]*iamentity.Group, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := []orm.QueryOption{orm.WithWhere("deleted_at IS NULL")}
+	if keyword != "" {
+		filter = append(filter, orm.WithWhere("(name LIKE ? OR description LIKE ?)", "%"+keyword+"%", "%"+keyword+"%"))
+	}
+	if parentID != nil {
+		filter = append(filter, orm.WithWhere("parent_id = ?", *parentID))
+	}
+
+	total, err := model.Count(ctx, filter...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计组织失败")
+	}
+
+	opts := append(filter, orm.WithOrderBy("id", false))
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	var groups []*iamentity.Group
+	if err := model.Find(ctx, &groups, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "搜索组织失败")
+	}
+	return groups, total, nil
+}
+
 // FindByDefaultRoleID 根据默认角色ID查找组织
 func (r *GroupRepo) FindByDefaultRoleID(ctx context.Context, roleID int64) ([]*iamentity.Group, error) {
 	model, err := r.ModelFor(ctx)
@@ -425,3 +764,131 @@ func (r *GroupRepo) FindByDefaultRoleID(ctx context.Context, roleID int64) ([]*i
 
 	return groups, nil
 }
+
+// FindMemberships 查询组织的成员关系（含加入时间）
+func (r *GroupRepo) FindMemberships(ctx context.Context, groupID int64) ([]*iamentity.UserGroup, error) {
+	model, err := r.membershipModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var memberships []*iamentity.UserGroup
+	err = model.Find(ctx, &memberships, orm.WithWhere("group_id = ?", groupID))
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织成员关系失败")
+	}
+
+	return memberships, nil
+}
+
+// FindMembershipsByUserIDs 批量查询多个用户的组织成员关系
+func (r *GroupRepo) FindMembershipsByUserIDs(ctx context.Context, userIDs []int64) ([]*iamentity.UserGroup, error) {
+	if len(userIDs) == 0 {
+		return []*iamentity.UserGroup{}, nil
+	}
+
+	model, err := r.membershipModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var memberships []*iamentity.UserGroup
+	err = model.Find(ctx, &memberships, orm.WithWhere("user_id IN ?", userIDs))
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户组织成员关系失败")
+	}
+
+	return memberships, nil
+}
+
+// BackfillMembershipJoinedAt 回填历史成员关系的加入时间（尽力而为）
+//
+// 说明：
+// - 仅处理 joined_at 为空的记录；
+// - 真实加入时间已不可考，取组织与用户创建时间中较晚者（成员关系不可能早于两者）。
+// 返回回填的记录数。
+func (r *GroupRepo) BackfillMembershipJoinedAt(ctx context.Context) (int64, error) {
+	type pendingMembership struct {
+		UserID         int64
+		GroupID        int64
+		GroupCreatedAt time.Time
+		UserCreatedAt  time.Time
+	}
+
+	model, err := r.membershipModel(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var rows []pendingMembership
+	err = model.Find(ctx, &rows,
+		orm.WithSelect(
+			"user_groups.user_id",
+			"user_groups.group_id",
+			"groups.created_at AS group_created_at",
+			"users.created_at AS user_created_at",
+		),
+		orm.WithJoin(orm.InnerJoin("groups", "", orm.On("groups.id", "user_groups.group_id"))),
+		orm.WithJoin(orm.InnerJoin("users", "", orm.On("users.id", "user_groups.user_id"))),
+		orm.WithWhere("user_groups.joined_at IS NULL"),
+	)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "查询待回填成员关系失败")
+	}
+
+	var filled int64
+	for i := range rows {
+		joinedAt := rows[i].GroupCreatedAt
+		if rows[i].UserCreatedAt.After(joinedAt) {
+			joinedAt = rows[i].UserCreatedAt
+		}
+		err := model.UpdateValues(ctx, map[string]any{
+			"joined_at": joinedAt,
+		}, orm.WithWhere("group_id = ? AND user_id = ? AND joined_at IS NULL", rows[i].GroupID, rows[i].UserID))
+		if err != nil {
+			return filled, errorx.Wrap(err, errorx.Database, "回填成员加入时间失败")
+		}
+		filled++
+	}
+
+	return filled, nil
+}
+
+// RecordGroupRoleEvent 写入组织默认角色变更审计记录
+func (r *GroupRepo) RecordGroupRoleEvent(ctx context.Context, event *iamentity.GroupRoleEvent) error {
+	model, err := r.groupRoleEventModel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.Create(ctx, event); err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录组织角色变更失败")
+	}
+	return nil
+}
+
+// FindGroupRoleEvents 查询组织默认角色变更审计记录，按时间正序
+func (r *GroupRepo) FindGroupRoleEvents(ctx context.Context, groupID int64) ([]*iamentity.GroupRoleEvent, error) {
+	model, err := r.groupRoleEventModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var events []*iamentity.GroupRoleEvent
+	err = model.Find(ctx, &events,
+		orm.WithWhere("group_id = ?", groupID),
+		orm.WithOrderBy("created_at", false),
+		orm.WithOrderBy("id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织角色变更记录失败")
+	}
+	return events, nil
+}
+
+// groupRoleEventModel 获取 group_role_events 表模型（优先使用事务会话）
+func (r *GroupRepo) groupRoleEventModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.GroupRoleEvent](ctx, r.Orm(), "group_role_events")
+}
+
+// membershipModel 返回 user_groups 关联表模型（事务上下文中优先使用会话）
+func (r *GroupRepo) membershipModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UserGroup](ctx, r.Orm(), linktable.UserGroups)
+}
@@ -146,3 +146,17 @@ func TestGroupRepo_AddUserToGroup_UsesTxSessionAssociation(t *testing.T) {
 		t.Fatalf("expected association Append called once")
 	}
 }
+
+func TestEscapeLikePattern(t *testing.T) {
+	cases := map[string]string{
+		"/1/2":   "/1/2",
+		"/1_2":   "/1!_2",
+		"/50%":   "/50!%",
+		"/a!b_%": "/a!!b!_!%",
+	}
+	for in, want := range cases {
+		if got := escapeLikePattern(in); got != want {
+			t.Fatalf("escapeLikePattern(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
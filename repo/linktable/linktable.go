@@ -0,0 +1,60 @@
+// Package linktable 提供 many2many 关联表（user_roles、user_groups、group_roles）及附属表
+// （历史记录、变更事件等不经通用 CRUD 仓储访问的表）的通用模型与读取。
+//
+// 附属表模型统一经 Model 获取：事务上下文中使用事务会话，保证与主表写入处于同一事务。
+//
+// ORM 的 Association.Append 不保证幂等：关联表缺少联合唯一约束时重复调用会写入重复行，
+// 因此各仓储在追加关联前先用 Exists 判重，重复分配直接视为成功。
+package linktable
+
+import (
+	"context"
+
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// 关联表名
+const (
+	UserRoles  = "user_roles"
+	UserGroups = "user_groups"
+	GroupRoles = "group_roles"
+)
+
+// row 关联表占位模型（仅用于计数）
+type row struct{}
+
+// Engine 返回与 ctx 绑定的 ORM 引擎（事务上下文中为事务会话，否则为 o）
+func Engine(ctx context.Context, o orm.IOrm) orm.IOrm {
+	if session, ok := orm.SessionFromContext(ctx); ok && session != nil {
+		return session
+	}
+	return o
+}
+
+// Model 返回表 table 的模型（行类型为 T；事务上下文中使用事务会话）
+func Model[T any](ctx context.Context, o orm.IOrm, table string) (orm.IModel, error) {
+	model, err := Engine(ctx, o).Model(&orm.ModelMeta{
+		ModelFactory: orm.NewModelFactory[T](),
+		Table:        table,
+	})
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "初始化 "+table+" 模型失败")
+	}
+	return model, nil
+}
+
+// Exists 判断关联表中是否已存在 left/right 组合（事务上下文中使用事务会话）
+//
+// leftColumn/rightColumn 为关联表的两个外键列，如 ("user_id", "role_id")。
+func Exists(ctx context.Context, o orm.IOrm, table, leftColumn string, leftID int64, rightColumn string, rightID int64) (bool, error) {
+	model, err := Model[row](ctx, o, table)
+	if err != nil {
+		return false, err
+	}
+	count, err := model.Count(ctx, orm.WithWhere(leftColumn+" = ? AND "+rightColumn+" = ?", leftID, rightID))
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "查询 "+table+" 关联失败")
+	}
+	return count > 0, nil
+}
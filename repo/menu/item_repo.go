@@ -2,8 +2,10 @@ package menu
 
 import (
 	"context"
+	"time"
 
 	iamentity "gochen-iam/entity"
+	"gochen-iam/repo/actor"
 	"gochen/db/orm"
 	db "gochen/db/orm/repo"
 	"gochen/errorx"
@@ -27,6 +29,7 @@ func (r *MenuItemRepo) Create(ctx context.Context, m *iamentity.MenuItem) error
 	if err != nil {
 		return err
 	}
+	actor.StampCreate(ctx, m)
 	return model.Create(ctx, m)
 }
 
@@ -35,9 +38,23 @@ func (r *MenuItemRepo) Update(ctx context.Context, m *iamentity.MenuItem) error
 	if err != nil {
 		return err
 	}
+	actor.StampUpdate(ctx, m)
 	return model.Save(ctx, m, orm.WithWhere("id = ? AND deleted_at IS NULL", m.GetID()))
 }
 
+// Delete 覆盖通用软删，写入删除者/修改者（取自请求上下文）
+func (r *MenuItemRepo) Delete(ctx context.Context, id int64) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.UpdateValues(ctx, actor.SoftDeleteValues(ctx, time.Now()),
+		orm.WithWhere("id = ? AND deleted_at IS NULL", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "删除菜单失败")
+	}
+	return nil
+}
+
 func (r *MenuItemRepo) GetByID(ctx context.Context, id int64) (*iamentity.MenuItem, error) {
 	model, err := r.ModelFor(ctx)
 	if err != nil {
@@ -126,6 +143,96 @@ func (r *MenuItemRepo) ListPublished(ctx context.Context) ([]*iamentity.MenuItem
 	return items, nil
 }
 
+// FindPublishedByRoute 查询 route 或 path 等于给定值的已发布菜单（不含软删），按 id 升序。
+func (r *MenuItemRepo) FindPublishedByRoute(ctx context.Context, route string) ([]*iamentity.MenuItem, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var items []*iamentity.MenuItem
+	if err := model.Find(ctx, &items,
+		orm.WithWhere("deleted_at IS NULL AND published = ? AND (route = ? OR path = ?)", true, route, route),
+		orm.WithOrderBy("id", false),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询菜单失败")
+	}
+	return items, nil
+}
+
+// MenuItemFilter 菜单列表过滤条件（零值字段不参与过滤）。
+type MenuItemFilter struct {
+	Type      string
+	Published *bool
+	Disabled  *bool
+	ParentID  *int64
+	// RootOnly 仅返回顶级菜单（parent_id IS NULL）；设置 ParentID 时忽略。
+	RootOnly bool
+
+	Offset int
+	Limit  int
+}
+
+// ListFiltered 按条件分页查询菜单（不含软删），返回当前页与总数；结果按 id 升序。
+func (r *MenuItemRepo) ListFiltered(ctx context.Context, filter MenuItemFilter) ([]*iamentity.MenuItem, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := []orm.QueryOption{orm.WithWhere("deleted_at IS NULL")}
+	if filter.Type != "" {
+		where = append(where, orm.WithWhere("type = ?", filter.Type))
+	}
+	if filter.Published != nil {
+		where = append(where, orm.WithWhere("published = ?", *filter.Published))
+	}
+	if filter.Disabled != nil {
+		where = append(where, orm.WithWhere("disabled = ?", *filter.Disabled))
+	}
+	if filter.ParentID != nil {
+		where = append(where, orm.WithWhere("parent_id = ?", *filter.ParentID))
+	} else if filter.RootOnly {
+		where = append(where, orm.WithWhere("parent_id IS NULL"))
+	}
+
+	total, err := model.Count(ctx, where...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计菜单数量失败")
+	}
+
+	opts := append([]orm.QueryOption{}, where...)
+	opts = append(opts, orm.WithOrderBy("id", false))
+	if filter.Limit > 0 {
+		opts = append(opts, orm.WithLimit(filter.Limit))
+	}
+	if filter.Offset > 0 {
+		opts = append(opts, orm.WithOffset(filter.Offset))
+	}
+
+	var items []*iamentity.MenuItem
+	if err := model.Find(ctx, &items, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "查询菜单列表失败")
+	}
+	return items, total, nil
+}
+
+// UpdateOrder 更新菜单排序值（不含软删记录）。
+//
+// 显式写入 order，避免部分 ORM 适配器“零值不更新”导致 Order=0 丢失。
+func (r *MenuItemRepo) UpdateOrder(ctx context.Context, id int64, order int, updatedAt time.Time) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.UpdateValues(ctx, actor.StampValues(ctx, map[string]any{
+		"order":      order,
+		"updated_at": updatedAt,
+	}), orm.WithWhere("id = ? AND deleted_at IS NULL", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新菜单顺序失败")
+	}
+	return nil
+}
+
 // RestoreByID 恢复软删菜单（deleted_at 置空）。
 func (r *MenuItemRepo) RestoreByID(ctx context.Context, id int64) (*iamentity.MenuItem, error) {
 	item, err := r.GetByIDWithDeleted(ctx, id)
@@ -139,6 +246,8 @@ func (r *MenuItemRepo) RestoreByID(ctx context.Context, id int64) (*iamentity.Me
 	if err := item.Restore(); err != nil {
 		return nil, errorx.Wrap(err, errorx.Internal, "恢复菜单失败")
 	}
+	item.DeletedBy = actor.System
+	actor.StampUpdate(ctx, item)
 
 	model, err := r.ModelFor(ctx)
 	if err != nil {
@@ -148,13 +257,43 @@ func (r *MenuItemRepo) RestoreByID(ctx context.Context, id int64) (*iamentity.Me
 	// 显式置空 deleted_at，避免部分 ORM 适配器“零值/NULL 不更新”导致恢复失败。
 	if err := model.UpdateValues(ctx, map[string]any{
 		"deleted_at": item.DeletedAt,
+		"deleted_by": item.DeletedBy,
 		"updated_at": item.UpdatedAt,
+		"updated_by": item.UpdatedBy,
 	}, orm.WithWhere("id = ?", id)); err != nil {
 		return nil, errorx.Wrap(err, errorx.Database, "恢复菜单失败")
 	}
 	return item, nil
 }
 
+// Overwrite 以 m 的当前值整体覆盖未删除菜单的可编辑字段。
+//
+// 显式写入全部列，避免部分 ORM 适配器“零值不更新”导致 false/空值无法覆盖旧值。
+func (r *MenuItemRepo) Overwrite(ctx context.Context, m *iamentity.MenuItem) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	actor.StampUpdate(ctx, m)
+	return model.UpdateValues(ctx, map[string]any{
+		"parent_id":          m.ParentID,
+		"title":              m.Title,
+		"path":               m.Path,
+		"icon":               m.Icon,
+		"type":               m.Type,
+		"order":              m.Order,
+		"route":              m.Route,
+		"component":          m.Component,
+		"hidden":             m.Hidden,
+		"disabled":           m.Disabled,
+		"published":          m.Published,
+		"any_of_permissions": m.AnyOfPermissions,
+		"all_of_permissions": m.AllOfPermissions,
+		"updated_at":         m.UpdatedAt,
+		"updated_by":         m.UpdatedBy,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL", m.GetID()))
+}
+
 // PurgeByID 物理删除菜单（硬删）。
 func (r *MenuItemRepo) PurgeByID(ctx context.Context, id int64) error {
 	if err := r.Purge(ctx, id); err != nil {
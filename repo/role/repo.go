@@ -2,8 +2,14 @@ package role
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
+	"time"
 
 	iamentity "gochen-iam/entity"
+	"gochen-iam/repo/actor"
+	"gochen-iam/repo/linktable"
+	"gochen-iam/repo/tenantscope"
 	"gochen/db/orm"
 	db "gochen/db/orm/repo"
 	"gochen/domain/crud"
@@ -19,7 +25,7 @@ type RoleRepo struct {
 // NewRoleRepository 创建角色Repository
 func NewRoleRepository(o orm.IOrm) (*RoleRepo, error) {
 	base, err := db.NewRepo[*iamentity.Role, int64](
-		o,
+		tenantscope.Wrap(o, tenantscope.Tables...),
 		"roles",
 		db.WithIDGenerator[*iamentity.Role, int64](generator.DefaultInt64Generator()),
 	)
@@ -31,6 +37,21 @@ func NewRoleRepository(o orm.IOrm) (*RoleRepo, error) {
 
 // shared 原生 ICRUDRepository 方法由 CrudBase 提供
 
+// Create 覆盖通用创建，写入创建者/修改者（取自请求上下文）
+func (r *RoleRepo) Create(ctx context.Context, role *iamentity.Role) error {
+	actor.StampCreate(ctx, role)
+	return r.Repo.Create(ctx, role)
+}
+
+// Update 覆盖通用更新，写入修改者（取自请求上下文）；租户上下文中不可修改共享角色
+func (r *RoleRepo) Update(ctx context.Context, role *iamentity.Role) error {
+	if err := tenantscope.CheckWritable(ctx, role); err != nil {
+		return err
+	}
+	actor.StampUpdate(ctx, role)
+	return r.Repo.Update(ctx, role)
+}
+
 // GetByID 根据ID获取角色（过滤软删记录）
 func (r *RoleRepo) GetByID(ctx context.Context, id int64) (*iamentity.Role, error) {
 	model, err := r.ModelFor(ctx)
@@ -48,6 +69,67 @@ func (r *RoleRepo) GetByID(ctx context.Context, id int64) (*iamentity.Role, erro
 	return &role, nil
 }
 
+// FindParentChain 沿 parent_role_id 向上查找角色的祖先链（由近及远，不含自身）
+//
+// 父角色不存在或已软删时链路在此截断；遇到重复节点（数据中已存在环）时停止，不会死循环。
+func (r *RoleRepo) FindParentChain(ctx context.Context, role *iamentity.Role) ([]*iamentity.Role, error) {
+	if role == nil {
+		return nil, nil
+	}
+
+	var chain []*iamentity.Role
+	visited := map[int64]struct{}{role.GetID(): {}}
+	parentID := role.ParentRoleID
+	for parentID != nil {
+		if _, ok := visited[*parentID]; ok {
+			break
+		}
+		visited[*parentID] = struct{}{}
+
+		parent, err := r.GetByID(ctx, *parentID)
+		if err != nil {
+			if errorx.Is(err, errorx.NotFound) {
+				break
+			}
+			return nil, err
+		}
+		chain = append(chain, parent)
+		parentID = parent.ParentRoleID
+	}
+	return chain, nil
+}
+
+// SetParentRole 设置或清除（parentID 为 nil）角色的父角色
+//
+// 显式写入 parent_role_id，避免部分 ORM 适配器“零值/NULL 不更新”导致无法清除。
+func (r *RoleRepo) SetParentRole(ctx context.Context, roleID int64, parentID *int64) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.UpdateValues(ctx, actor.StampValues(ctx, map[string]any{
+		"parent_role_id": parentID,
+		"updated_at":     time.Now(),
+	}), orm.WithWhere("id = ? AND deleted_at IS NULL", roleID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新父角色失败")
+	}
+	return nil
+}
+
+// FindChildren 查找直接继承指定角色的子角色（不含已软删角色）
+func (r *RoleRepo) FindChildren(ctx context.Context, parentID int64) ([]*iamentity.Role, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var roles []*iamentity.Role
+	err = model.Find(ctx, &roles, orm.WithWhere("parent_role_id = ? AND deleted_at IS NULL", parentID))
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询子角色失败")
+	}
+	return roles, nil
+}
+
 // FindByName 根据角色名查找角色
 func (r *RoleRepo) FindByName(ctx context.Context, name string) (*iamentity.Role, error) {
 	model, err := r.ModelFor(ctx)
@@ -71,6 +153,29 @@ func (r *RoleRepo) FindByName(ctx context.Context, name string) (*iamentity.Role
 	return &role, nil
 }
 
+// FindByNormalizedName 按规范化名称查找未删除的角色（去除首尾空白后比较，caseFold 为 true 时忽略大小写）
+//
+// name 须已按 service.NormalizeName 规范化；用于唯一性检查，使规范化规则启用前落库的 " Manager"/"Manager"
+// 与新名称 "manager" 视为同名。
+func (r *RoleRepo) FindByNormalizedName(ctx context.Context, name string, caseFold bool) (*iamentity.Role, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	where := "TRIM(name) = ? AND deleted_at IS NULL"
+	if caseFold {
+		where = "LOWER(TRIM(name)) = ? AND deleted_at IS NULL"
+	}
+	var role iamentity.Role
+	if err := model.First(ctx, &role, orm.WithWhere(where, name)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, errorx.New(errorx.NotFound, "角色不存在")
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询角色失败")
+	}
+	return &role, nil
+}
+
 // FindByNames 根据角色名列表查找角色
 func (r *RoleRepo) FindByNames(ctx context.Context, names []string) ([]*iamentity.Role, error) {
 	if len(names) == 0 {
@@ -115,6 +220,69 @@ func (r *RoleRepo) FindByStatus(ctx context.Context, status string) ([]*iamentit
 	return roles, nil
 }
 
+// FindByStatusPaged 分页查找指定状态的未软删除角色（不预加载关联），结果按 ID 升序返回
+//
+// offset/limit <= 0 表示不分页；total 为该状态的角色总数。
+func (r *RoleRepo) FindByStatusPaged(ctx context.Context, status string, offset, limit int) ([]*iamentity.Role, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := []orm.QueryOption{orm.WithWhere("status = ? AND deleted_at IS NULL", status)}
+	total, err := model.Count(ctx, filter...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计角色失败")
+	}
+
+	opts := append(filter, orm.WithOrderBy("id", false))
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	var roles []*iamentity.Role
+	if err := model.Find(ctx, &roles, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "查询角色失败")
+	}
+	return roles, total, nil
+}
+
+// FindWithVisibility 查找角色列表（不预加载关联），结果按 ID 升序返回
+//
+// 默认仅返回 active 且未软删除的角色；includeInactive/includeDeleted 分别放开状态与软删除过滤。
+func (r *RoleRepo) FindWithVisibility(ctx context.Context, includeInactive, includeDeleted bool) ([]*iamentity.Role, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := []orm.QueryOption{orm.WithOrderBy("id", false)}
+	if conds, args := roleVisibilityConds("", includeInactive, includeDeleted); len(conds) > 0 {
+		opts = append(opts, orm.WithWhere(strings.Join(conds, " AND "), args...))
+	}
+	var roles []*iamentity.Role
+	if err := model.Find(ctx, &roles, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询角色失败")
+	}
+	return roles, nil
+}
+
+// roleVisibilityConds 生成角色可见性过滤条件（prefix 为列名前缀，如 "roles."；全部放开时返回空）
+func roleVisibilityConds(prefix string, includeInactive, includeDeleted bool) ([]string, []any) {
+	var conds []string
+	var args []any
+	if !includeInactive {
+		conds = append(conds, prefix+"status = ?")
+		args = append(args, "active")
+	}
+	if !includeDeleted {
+		conds = append(conds, prefix+"deleted_at IS NULL")
+	}
+	return conds, args
+}
+
 // FindSystemRoles 查找系统角色
 func (r *RoleRepo) FindSystemRoles(ctx context.Context) ([]*iamentity.Role, error) {
 	model, err := r.ModelFor(ctx)
@@ -153,15 +321,25 @@ func (r *RoleRepo) FindUserRoles(ctx context.Context) ([]*iamentity.Role, error)
 	return roles, nil
 }
 
-// FindByPermission 根据权限查找角色
+// FindByPermission 根据权限查找直接声明了该权限的角色（精确匹配，不展开通配符）
+//
+// 权限以 JSON 文本存储：先用 LIKE 匹配带引号的权限码做预筛（不依赖 MySQL 专有的 JSON_CONTAINS，
+// 兼容 SQLite/Postgres），再在内存中按成员精确过滤，避免 "user:re" 命中 "user:read" 等误匹配。
 func (r *RoleRepo) FindByPermission(ctx context.Context, permission string) ([]*iamentity.Role, error) {
+	if permission == "" {
+		return []*iamentity.Role{}, nil
+	}
+	needle, err := json.Marshal(permission)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "编码权限失败")
+	}
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return nil, err
 	}
-	var roles []*iamentity.Role
-	err = model.Find(ctx, &roles,
-		orm.WithWhere("JSON_CONTAINS(permissions, ?) AND deleted_at IS NULL", `"`+permission+`"`),
+	var candidates []*iamentity.Role
+	err = model.Find(ctx, &candidates,
+		orm.WithWhere("permissions LIKE ? AND deleted_at IS NULL", "%"+string(needle)+"%"),
 		orm.WithPreload("Users"),
 	)
 
@@ -169,10 +347,19 @@ func (r *RoleRepo) FindByPermission(ctx context.Context, permission string) ([]*
 		return nil, errorx.Wrap(err, errorx.Database, "查询角色失败")
 	}
 
+	roles := make([]*iamentity.Role, 0, len(candidates))
+	for _, role := range candidates {
+		for _, p := range role.Permissions {
+			if p == permission {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
 	return roles, nil
 }
 
-// FindByUserID 根据用户ID查找角色
+// FindByUserID 根据用户ID查找角色（过滤软删与已过期的分配）
 func (r *RoleRepo) FindByUserID(ctx context.Context, userID int64) ([]*iamentity.Role, error) {
 	model, err := r.ModelFor(ctx)
 	if err != nil {
@@ -181,7 +368,7 @@ func (r *RoleRepo) FindByUserID(ctx context.Context, userID int64) ([]*iamentity
 	var roles []*iamentity.Role
 	err = model.Find(ctx, &roles,
 		orm.WithJoin(orm.InnerJoin("user_roles", "", orm.On("roles.id", "user_roles.role_id"))),
-		orm.WithWhere("user_roles.user_id = ? AND roles.deleted_at IS NULL", userID),
+		orm.WithWhere("user_roles.user_id = ? AND roles.deleted_at IS NULL AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)", userID, time.Now()),
 	)
 
 	if err != nil {
@@ -191,8 +378,63 @@ func (r *RoleRepo) FindByUserID(ctx context.Context, userID int64) ([]*iamentity
 	return roles, nil
 }
 
+// FindByUserIDInGroupScope 查找用户在组织范围内生效的直接分配角色（过滤软删与已过期的分配）
+//
+// 仅返回全局分配（group_id 为空）以及限定于 groupIDs 中任一组织的分配。
+func (r *RoleRepo) FindByUserIDInGroupScope(ctx context.Context, userID int64, groupIDs []int64) ([]*iamentity.Role, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	where := "user_roles.user_id = ? AND roles.deleted_at IS NULL AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)"
+	args := []any{userID, time.Now()}
+	if len(groupIDs) > 0 {
+		where += " AND (user_roles.group_id IS NULL OR user_roles.group_id IN ?)"
+		args = append(args, groupIDs)
+	} else {
+		where += " AND user_roles.group_id IS NULL"
+	}
+	var roles []*iamentity.Role
+	err = model.Find(ctx, &roles,
+		orm.WithJoin(orm.InnerJoin("user_roles", "", orm.On("roles.id", "user_roles.role_id"))),
+		orm.WithWhere(where, args...),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户组织范围角色失败")
+	}
+	return roles, nil
+}
+
 // FindByGroupID 根据组织ID查找默认角色
-func (r *RoleRepo) FindByGroupID(ctx context.Context, groupID int64) ([]*iamentity.Role, error) {
+//
+// 默认仅返回 active 且未软删除的角色；includeInactive/includeDeleted 分别放开状态与软删除过滤。
+func (r *RoleRepo) FindByGroupID(ctx context.Context, groupID int64, includeInactive, includeDeleted bool) ([]*iamentity.Role, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conds, args := roleVisibilityConds("roles.", includeInactive, includeDeleted)
+	where := strings.Join(append([]string{"group_roles.group_id = ?"}, conds...), " AND ")
+	var roles []*iamentity.Role
+	err = model.Find(ctx, &roles,
+		orm.WithJoin(orm.InnerJoin("group_roles", "", orm.On("roles.id", "group_roles.role_id"))),
+		orm.WithWhere(where, append([]any{groupID}, args...)...),
+		orm.WithOrderBy("roles.id", false),
+	)
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织角色失败")
+	}
+
+	return roles, nil
+}
+
+// FindByGroupIDs 批量查找多个组织的默认角色（过滤软删；同一角色可能因多个组织重复返回）
+func (r *RoleRepo) FindByGroupIDs(ctx context.Context, groupIDs []int64) ([]*iamentity.Role, error) {
+	if len(groupIDs) == 0 {
+		return []*iamentity.Role{}, nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return nil, err
@@ -200,7 +442,7 @@ func (r *RoleRepo) FindByGroupID(ctx context.Context, groupID int64) ([]*iamenti
 	var roles []*iamentity.Role
 	err = model.Find(ctx, &roles,
 		orm.WithJoin(orm.InnerJoin("group_roles", "", orm.On("roles.id", "group_roles.role_id"))),
-		orm.WithWhere("group_roles.group_id = ? AND roles.deleted_at IS NULL", groupID),
+		orm.WithWhere("group_roles.group_id IN ? AND roles.deleted_at IS NULL", groupIDs),
 	)
 
 	if err != nil {
@@ -210,6 +452,143 @@ func (r *RoleRepo) FindByGroupID(ctx context.Context, groupID int64) ([]*iamenti
 	return roles, nil
 }
 
+// FindUserRoleAssignments 批量查询多个用户未过期的直接角色分配
+func (r *RoleRepo) FindUserRoleAssignments(ctx context.Context, userIDs []int64) ([]*iamentity.UserRoleAssignment, error) {
+	if len(userIDs) == 0 {
+		return []*iamentity.UserRoleAssignment{}, nil
+	}
+
+	model, err := r.userRoleModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []*iamentity.UserRoleAssignment
+	err = model.Find(ctx, &assignments,
+		orm.WithWhere("user_id IN ? AND (expires_at IS NULL OR expires_at > ?)", userIDs, time.Now()),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户角色分配失败")
+	}
+	return assignments, nil
+}
+
+// FindGroupGrantedUserRoles 查询因加入指定组织而自动授予用户的角色分配（source_group_id = groupID）
+func (r *RoleRepo) FindGroupGrantedUserRoles(ctx context.Context, userID, groupID int64) ([]*iamentity.UserRoleAssignment, error) {
+	model, err := r.userRoleModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []*iamentity.UserRoleAssignment
+	err = model.Find(ctx, &assignments,
+		orm.WithWhere("user_id = ? AND source_group_id = ?", userID, groupID),
+		orm.WithOrderBy("role_id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织授予的角色分配失败")
+	}
+	return assignments, nil
+}
+
+// FindGroupRoleIDs 批量查询多个组织的默认角色 ID（组织 ID -> 角色 ID 列表）
+func (r *RoleRepo) FindGroupRoleIDs(ctx context.Context, groupIDs []int64) (map[int64][]int64, error) {
+	result := make(map[int64][]int64, len(groupIDs))
+	if len(groupIDs) == 0 {
+		return result, nil
+	}
+
+	type groupRoleRow struct {
+		GroupID int64
+		RoleID  int64
+	}
+	model, err := linktable.Model[groupRoleRow](ctx, r.Orm(), linktable.GroupRoles)
+	if err != nil {
+		return nil, err
+	}
+	var rows []groupRoleRow
+	if err := model.Find(ctx, &rows, orm.WithWhere("group_id IN ?", groupIDs)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织角色失败")
+	}
+	for _, row := range rows {
+		result[row.GroupID] = append(result[row.GroupID], row.RoleID)
+	}
+	return result, nil
+}
+
+// FindExpiredUserRoles 查找在 now 时刻已过期的用户角色分配（按 user_id、role_id 升序）
+func (r *RoleRepo) FindExpiredUserRoles(ctx context.Context, now time.Time) ([]*iamentity.UserRoleAssignment, error) {
+	model, err := r.userRoleModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []*iamentity.UserRoleAssignment
+	err = model.Find(ctx, &assignments,
+		orm.WithWhere("expires_at IS NOT NULL AND expires_at <= ?", now),
+		orm.WithOrderBy("user_id", false),
+		orm.WithOrderBy("role_id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询过期角色分配失败")
+	}
+	return assignments, nil
+}
+
+// PurgeExpiredUserRoles 删除在 now 时刻已过期的用户角色分配，返回被删除的分配（供清理任务记录审计）
+func (r *RoleRepo) PurgeExpiredUserRoles(ctx context.Context, now time.Time) ([]*iamentity.UserRoleAssignment, error) {
+	expired, err := r.FindExpiredUserRoles(ctx, now)
+	if err != nil || len(expired) == 0 {
+		return expired, err
+	}
+
+	model, err := r.userRoleModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.Delete(ctx, orm.WithWhere("expires_at IS NOT NULL AND expires_at <= ?", now)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "清理过期角色分配失败")
+	}
+	return expired, nil
+}
+
+// userRoleModel 返回 user_roles 关联表模型（事务上下文中使用事务会话）
+func (r *RoleRepo) userRoleModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UserRoleAssignment](ctx, r.Orm(), linktable.UserRoles)
+}
+
+// RecordPermissionEvent 写入角色权限变更审计记录
+func (r *RoleRepo) RecordPermissionEvent(ctx context.Context, event *iamentity.RolePermissionEvent) error {
+	model, err := r.permissionEventModel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.Create(ctx, event); err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录角色权限变更失败")
+	}
+	return nil
+}
+
+// FindPermissionEvents 查询角色权限变更审计记录，按时间正序
+func (r *RoleRepo) FindPermissionEvents(ctx context.Context, roleID int64) ([]*iamentity.RolePermissionEvent, error) {
+	model, err := r.permissionEventModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var events []*iamentity.RolePermissionEvent
+	err = model.Find(ctx, &events,
+		orm.WithWhere("role_id = ?", roleID),
+		orm.WithOrderBy("created_at", false),
+		orm.WithOrderBy("id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询角色权限变更记录失败")
+	}
+	return events, nil
+}
+
+// permissionEventModel 获取 role_permission_events 表模型（优先使用事务会话）
+func (r *RoleRepo) permissionEventModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.RolePermissionEvent](ctx, r.Orm(), "role_permission_events")
+}
+
 // AssignToUser 将角色分配给用户
 func (r *RoleRepo) AssignToUser(ctx context.Context, roleID, userID int64) error {
 	// 检查角色是否存在
@@ -218,6 +597,15 @@ func (r *RoleRepo) AssignToUser(ctx context.Context, roleID, userID int64) error
 		return err
 	}
 
+	// 已关联时直接返回，重复调用幂等
+	exists, err := linktable.Exists(ctx, r.Orm(), linktable.UserRoles, "user_id", userID, "role_id", roleID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
@@ -262,6 +650,15 @@ func (r *RoleRepo) AssignToGroup(ctx context.Context, roleID, groupID int64) err
 		return err
 	}
 
+	// 已关联时直接返回，重复调用幂等
+	exists, err := linktable.Exists(ctx, r.Orm(), linktable.GroupRoles, "group_id", groupID, "role_id", roleID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
@@ -328,8 +725,18 @@ func (r *RoleRepo) CountByStatus(ctx context.Context) (map[string]int64, error)
 	return statusMap, nil
 }
 
-// GetRoleUsageStats 获取角色使用统计
-func (r *RoleRepo) GetRoleUsageStats(ctx context.Context) ([]map[string]interface{}, error) {
+// RoleUsageStat 角色使用统计（直接分配的用户数与以其为默认角色的组织数）
+type RoleUsageStat struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	UserCount  int64  `json:"user_count"`
+	GroupCount int64  `json:"group_count"`
+	IsSystem   bool   `json:"is_system"`
+	Status     string `json:"status"`
+}
+
+// GetRoleUsageStats 获取角色使用统计（未软删的角色；用户/组织数按 role_id 分组聚合，共 3 次查询）
+func (r *RoleRepo) GetRoleUsageStats(ctx context.Context) ([]RoleUsageStat, error) {
 	type roleBase struct {
 		ID       int64  `json:"id"`
 		Name     string `json:"name"`
@@ -363,20 +770,12 @@ func (r *RoleRepo) GetRoleUsageStats(ctx context.Context) ([]map[string]interfac
 	groupCounts := make(map[int64]int64, len(ids))
 
 	if len(ids) > 0 {
-		engine := r.Orm()
-		if session, ok := orm.SessionFromContext(ctx); ok && session != nil {
-			engine = session
-		}
-
-		userRoleModel, err := engine.Model(&orm.ModelMeta{
-			ModelFactory: orm.NewModelFactory[struct {
-				RoleID int64
-				UserID int64
-			}](),
-			Table: "user_roles",
-		})
+		userRoleModel, err := linktable.Model[struct {
+			RoleID int64
+			UserID int64
+		}](ctx, r.Orm(), linktable.UserRoles)
 		if err != nil {
-			return nil, errorx.Wrap(err, errorx.Database, "初始化 user_roles 模型失败")
+			return nil, err
 		}
 
 		var rows []roleCount
@@ -391,15 +790,12 @@ func (r *RoleRepo) GetRoleUsageStats(ctx context.Context) ([]map[string]interfac
 			userCounts[rows[i].RoleID] = rows[i].Count
 		}
 
-		groupRoleModel, err := engine.Model(&orm.ModelMeta{
-			ModelFactory: orm.NewModelFactory[struct {
-				RoleID  int64
-				GroupID int64
-			}](),
-			Table: "group_roles",
-		})
+		groupRoleModel, err := linktable.Model[struct {
+			RoleID  int64
+			GroupID int64
+		}](ctx, r.Orm(), linktable.GroupRoles)
 		if err != nil {
-			return nil, errorx.Wrap(err, errorx.Database, "初始化 group_roles 模型失败")
+			return nil, err
 		}
 		rows = nil
 		if err := groupRoleModel.Find(ctx, &rows,
@@ -414,17 +810,16 @@ func (r *RoleRepo) GetRoleUsageStats(ctx context.Context) ([]map[string]interfac
 		}
 	}
 
-	// 转换为通用格式
-	stats := make([]map[string]interface{}, len(roles))
+	stats := make([]RoleUsageStat, len(roles))
 	for i := range roles {
 		roleID := roles[i].ID
-		stats[i] = map[string]interface{}{
-			"id":          roleID,
-			"name":        roles[i].Name,
-			"user_count":  userCounts[roleID],
-			"group_count": groupCounts[roleID],
-			"is_system":   roles[i].IsSystem,
-			"status":      roles[i].Status,
+		stats[i] = RoleUsageStat{
+			ID:         roleID,
+			Name:       roles[i].Name,
+			UserCount:  userCounts[roleID],
+			GroupCount: groupCounts[roleID],
+			IsSystem:   roles[i].IsSystem,
+			Status:     roles[i].Status,
 		}
 	}
 
@@ -461,6 +856,40 @@ func (r *RoleRepo) SearchRoles(ctx context.Context, keyword string, limit int) (
 	return roles, nil
 }
 
+// SearchRolesPaged 分页搜索角色（名称、描述模糊匹配，不含软删除，不预加载关联），并返回满足条件的总数
+//
+// keyword 为空时不过滤；offset/limit <= 0 表示不分页。结果按 ID 升序返回，保证跨页顺序稳定。
+func (r *RoleRepo) SearchRolesPaged(ctx context.Context, keyword string, offset, limit int) ([]*iamentity.Role, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter := []orm.QueryOption{orm.WithWhere("deleted_at IS NULL")}
+	if keyword != "" {
+		filter = append(filter, orm.WithWhere("(name LIKE ? OR description LIKE ?)", "%"+keyword+"%", "%"+keyword+"%"))
+	}
+
+	total, err := model.Count(ctx, filter...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计角色失败")
+	}
+
+	opts := append(filter, orm.WithOrderBy("id", false))
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	var roles []*iamentity.Role
+	if err := model.Find(ctx, &roles, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "搜索角色失败")
+	}
+	return roles, total, nil
+}
+
 // InitializeSystemRoles 初始化系统角色
 func (r *RoleRepo) InitializeSystemRoles(ctx context.Context) error {
 	systemRoles := []*iamentity.Role{
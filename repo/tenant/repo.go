@@ -2,8 +2,10 @@ package tenant
 
 import (
 	"context"
+	"time"
 
 	iamentity "gochen-iam/entity"
+	"gochen-iam/repo/linktable"
 	"gochen/db/orm"
 	db "gochen/db/orm/repo"
 	"gochen/errorx"
@@ -83,3 +85,59 @@ func (r *TenantRepo) FindByKey(ctx context.Context, key string) (*iamentity.Tena
 
 	return &tenant, nil
 }
+
+// FindByUserID 查找用户所属的租户（过滤软删记录），按 ID 升序返回
+func (r *TenantRepo) FindByUserID(ctx context.Context, userID int64) ([]*iamentity.Tenant, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []*iamentity.Tenant
+	err = model.Find(ctx, &tenants,
+		orm.WithJoin(orm.InnerJoin("user_tenants", "", orm.On("tenants.id", "user_tenants.tenant_id"))),
+		orm.WithWhere("user_tenants.user_id = ? AND tenants.deleted_at IS NULL", userID),
+		orm.WithOrderBy("tenants.id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户租户失败")
+	}
+	return tenants, nil
+}
+
+// AddMember 将用户加入租户（已是成员时不重复写入）
+func (r *TenantRepo) AddMember(ctx context.Context, tenantID, userID int64) error {
+	membership, err := r.membershipModel(ctx)
+	if err != nil {
+		return err
+	}
+	count, err := membership.Count(ctx, orm.WithWhere("user_id = ? AND tenant_id = ?", userID, tenantID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "查询租户成员失败")
+	}
+	if count > 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if err := membership.Create(ctx, &iamentity.UserTenant{UserID: userID, TenantID: tenantID, JoinedAt: &now}); err != nil {
+		return errorx.Wrap(err, errorx.Database, "添加租户成员失败")
+	}
+	return nil
+}
+
+// RemoveMember 将用户移出租户
+func (r *TenantRepo) RemoveMember(ctx context.Context, tenantID, userID int64) error {
+	membership, err := r.membershipModel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := membership.Delete(ctx, orm.WithWhere("user_id = ? AND tenant_id = ?", userID, tenantID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "移除租户成员失败")
+	}
+	return nil
+}
+
+// membershipModel 获取 user_tenants 关联表模型（优先使用事务会话）
+func (r *TenantRepo) membershipModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UserTenant](ctx, r.Orm(), "user_tenants")
+}
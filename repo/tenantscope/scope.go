@@ -0,0 +1,211 @@
+// Package tenantscope 提供按请求上下文中的租户自动隔离数据的 ORM 包装。
+//
+// 被包装的 ORM 在 ctx 携带租户（metadata.WithTenantID，AuthMiddleware 取自令牌租户声明或经成员关系校验的租户头）时：
+//   - 对受管表的查询、统计、更新与删除自动追加 `<table>.tenant_id = ?` 条件；
+//   - 共享表（SharedTables）的查询与统计额外可见 tenant_id 为空（或 NULL）的共享行，更新与删除仍仅限当前租户；
+//   - 新建实体（实现 SetTenantID）且未指定租户时写入当前租户。
+//
+// ctx 未携带租户时不做任何过滤（与引入租户隔离前的行为一致）。
+package tenantscope
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"gochen/db/orm"
+	"gochen/errorx"
+	"gochen/metadata"
+)
+
+// Column 受管表的租户列名
+const Column = "tenant_id"
+
+// Tables 按租户隔离的表（用户、角色、组织）；各仓储统一包装全部受管表，
+// 保证任一仓储开启的事务中其他仓储的查询同样被隔离。
+var Tables = []string{"users", "roles", "groups"}
+
+// SharedTables 跨租户共享的受管表：tenant_id 为空的行（如 system_admin、user 等内置角色）对所有租户可读，
+// 租户上下文中不可修改或删除。
+var SharedTables = []string{"roles"}
+
+// ITenantScoped 租户感知实体（由受管表对应的实体实现）
+type ITenantScoped interface {
+	GetTenantID() string
+	SetTenantID(tenantID string)
+}
+
+// TenantFromContext 返回 ctx 中的租户 ID；未注入时为空字符串（表示不隔离）
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	return metadata.GetTenantID(ctx)
+}
+
+// Wrap 包装 ORM 引擎，使 tables 中的表按 ctx 租户自动隔离；对已包装的引擎追加受管表。
+//
+// 由其开启的事务会话同样生效，因此同一事务中的其他仓储查询受管表时也会被隔离。
+func Wrap(o orm.IOrm, tables ...string) orm.IOrm {
+	if o == nil {
+		return nil
+	}
+	if scoped, ok := o.(*scopedOrm); ok {
+		merged := make(map[string]struct{}, len(scoped.tables)+len(tables))
+		for table := range scoped.tables {
+			merged[table] = struct{}{}
+		}
+		for _, table := range tables {
+			merged[table] = struct{}{}
+		}
+		return &scopedOrm{IOrm: scoped.IOrm, tables: merged}
+	}
+	set := make(map[string]struct{}, len(tables))
+	for _, table := range tables {
+		set[table] = struct{}{}
+	}
+	return &scopedOrm{IOrm: o, tables: set}
+}
+
+// scopedOrm 租户隔离 ORM 包装
+type scopedOrm struct {
+	orm.IOrm
+	tables map[string]struct{}
+}
+
+func (o *scopedOrm) WithContext(ctx context.Context) orm.IOrm {
+	return &scopedOrm{IOrm: o.IOrm.WithContext(ctx), tables: o.tables}
+}
+
+func (o *scopedOrm) Model(meta *orm.ModelMeta) (orm.IModel, error) {
+	return scopeModel(o.IOrm, o.tables, meta)
+}
+
+func (o *scopedOrm) Begin(ctx context.Context) (orm.IOrmSession, error) {
+	session, err := o.IOrm.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &scopedSession{IOrmSession: session, tables: o.tables}, nil
+}
+
+func (o *scopedOrm) BeginTx(ctx context.Context, opts *sql.TxOptions) (orm.IOrmSession, error) {
+	session, err := o.IOrm.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &scopedSession{IOrmSession: session, tables: o.tables}, nil
+}
+
+// scopedSession 租户隔离事务会话包装
+type scopedSession struct {
+	orm.IOrmSession
+	tables map[string]struct{}
+}
+
+func (s *scopedSession) WithContext(ctx context.Context) orm.IOrm {
+	return &scopedOrm{IOrm: s.IOrmSession.WithContext(ctx), tables: s.tables}
+}
+
+func (s *scopedSession) Model(meta *orm.ModelMeta) (orm.IModel, error) {
+	return scopeModel(s.IOrmSession, s.tables, meta)
+}
+
+func (s *scopedSession) Begin(ctx context.Context) (orm.IOrmSession, error) {
+	session, err := s.IOrmSession.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &scopedSession{IOrmSession: session, tables: s.tables}, nil
+}
+
+func (s *scopedSession) BeginTx(ctx context.Context, opts *sql.TxOptions) (orm.IOrmSession, error) {
+	session, err := s.IOrmSession.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &scopedSession{IOrmSession: session, tables: s.tables}, nil
+}
+
+func scopeModel(engine orm.IOrm, tables map[string]struct{}, meta *orm.ModelMeta) (orm.IModel, error) {
+	model, err := engine.Model(meta)
+	if err != nil || meta == nil {
+		return model, err
+	}
+	if _, ok := tables[meta.Table]; !ok {
+		return model, nil
+	}
+	return &scopedModel{IModel: model, table: meta.Table, shared: slices.Contains(SharedTables, meta.Table)}, nil
+}
+
+// scopedModel 受管表模型：按 ctx 租户追加过滤条件并为新建实体写入租户
+type scopedModel struct {
+	orm.IModel
+	table  string
+	shared bool
+}
+
+// scope 在 ctx 携带租户时追加租户过滤条件；read 为 true 且为共享表时同时放行共享行
+func (m *scopedModel) scope(ctx context.Context, opts []orm.QueryOption, read bool) []orm.QueryOption {
+	tenantID := TenantFromContext(ctx)
+	if tenantID == "" {
+		return opts
+	}
+	scoped := make([]orm.QueryOption, 0, len(opts)+1)
+	scoped = append(scoped, opts...)
+	if read && m.shared {
+		// 存量共享行可能为 NULL（列在迁移前不存在），与空字符串同样视为共享
+		column := m.table + "." + Column
+		return append(scoped, orm.WithWhere("("+column+" IN (?, '') OR "+column+" IS NULL)", tenantID))
+	}
+	return append(scoped, orm.WithWhere(m.table+"."+Column+" = ?", tenantID))
+}
+
+func (m *scopedModel) First(ctx context.Context, dest any, opts ...orm.QueryOption) error {
+	return m.IModel.First(ctx, dest, m.scope(ctx, opts, true)...)
+}
+
+func (m *scopedModel) Find(ctx context.Context, dest any, opts ...orm.QueryOption) error {
+	return m.IModel.Find(ctx, dest, m.scope(ctx, opts, true)...)
+}
+
+func (m *scopedModel) Count(ctx context.Context, opts ...orm.QueryOption) (int64, error) {
+	return m.IModel.Count(ctx, m.scope(ctx, opts, true)...)
+}
+
+func (m *scopedModel) Create(ctx context.Context, entities ...any) error {
+	if tenantID := TenantFromContext(ctx); tenantID != "" {
+		for _, entity := range entities {
+			if e, ok := entity.(ITenantScoped); ok && e.GetTenantID() == "" {
+				e.SetTenantID(tenantID)
+			}
+		}
+	}
+	return m.IModel.Create(ctx, entities...)
+}
+
+// CheckWritable ctx 携带租户时，共享行或其他租户的实体不可修改（返回 Forbidden）
+func CheckWritable(ctx context.Context, entity ITenantScoped) error {
+	if tenantID := TenantFromContext(ctx); tenantID != "" && entity.GetTenantID() != tenantID {
+		return errorx.New(errorx.Forbidden, "不可修改共享或其他租户的数据")
+	}
+	return nil
+}
+
+// Save 仅可保存当前租户的实体：共享行或其他租户的实体返回 Forbidden（而非静默不更新）
+func (m *scopedModel) Save(ctx context.Context, entity any, opts ...orm.QueryOption) error {
+	if e, ok := entity.(ITenantScoped); ok {
+		if err := CheckWritable(ctx, e); err != nil {
+			return err
+		}
+	}
+	return m.IModel.Save(ctx, entity, m.scope(ctx, opts, false)...)
+}
+
+func (m *scopedModel) UpdateValues(ctx context.Context, values map[string]any, opts ...orm.QueryOption) error {
+	return m.IModel.UpdateValues(ctx, values, m.scope(ctx, opts, false)...)
+}
+
+func (m *scopedModel) Delete(ctx context.Context, opts ...orm.QueryOption) error {
+	return m.IModel.Delete(ctx, m.scope(ctx, opts, false)...)
+}
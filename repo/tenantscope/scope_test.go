@@ -0,0 +1,208 @@
+package tenantscope
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	iamentity "gochen-iam/entity"
+	"gochen/db"
+	"gochen/db/orm"
+	"gochen/errorx"
+	"gochen/metadata"
+)
+
+// capturingModel 记录最近一次调用收到的查询条件与新建实体
+type capturingModel struct {
+	meta *orm.ModelMeta
+
+	lastWhere []orm.Condition
+	created   []any
+	saves     int
+}
+
+func (m *capturingModel) capture(opts []orm.QueryOption) {
+	m.lastWhere = orm.CollectQueryOptions(opts...).Where
+}
+
+func (m *capturingModel) Meta() *orm.ModelMeta           { return m.meta }
+func (m *capturingModel) Capabilities() orm.Capabilities { return nil }
+func (m *capturingModel) First(_ context.Context, _ any, opts ...orm.QueryOption) error {
+	m.capture(opts)
+	return nil
+}
+func (m *capturingModel) Find(_ context.Context, _ any, opts ...orm.QueryOption) error {
+	m.capture(opts)
+	return nil
+}
+func (m *capturingModel) Count(_ context.Context, opts ...orm.QueryOption) (int64, error) {
+	m.capture(opts)
+	return 0, nil
+}
+func (m *capturingModel) Create(_ context.Context, entities ...any) error {
+	m.created = append(m.created, entities...)
+	return nil
+}
+func (m *capturingModel) Save(_ context.Context, _ any, opts ...orm.QueryOption) error {
+	m.saves++
+	m.capture(opts)
+	return nil
+}
+func (m *capturingModel) UpdateValues(_ context.Context, _ map[string]any, opts ...orm.QueryOption) error {
+	m.capture(opts)
+	return nil
+}
+func (m *capturingModel) Delete(_ context.Context, opts ...orm.QueryOption) error {
+	m.capture(opts)
+	return nil
+}
+func (m *capturingModel) Association(any, string) orm.IAssociation { return nil }
+
+type fakeOrm struct {
+	models map[string]*capturingModel
+}
+
+func (o *fakeOrm) Capabilities() orm.Capabilities           { return nil }
+func (o *fakeOrm) WithContext(ctx context.Context) orm.IOrm { return o }
+func (o *fakeOrm) Model(meta *orm.ModelMeta) (orm.IModel, error) {
+	m, ok := o.models[meta.Table]
+	if !ok {
+		m = &capturingModel{}
+		o.models[meta.Table] = m
+	}
+	m.meta = meta
+	return m, nil
+}
+func (o *fakeOrm) Begin(context.Context) (orm.IOrmSession, error) {
+	return &fakeSession{fakeOrm: o}, nil
+}
+func (o *fakeOrm) BeginTx(context.Context, *sql.TxOptions) (orm.IOrmSession, error) {
+	return &fakeSession{fakeOrm: o}, nil
+}
+func (o *fakeOrm) Database() db.IDatabase { return nil }
+func (o *fakeOrm) Raw() any               { return nil }
+
+type fakeSession struct {
+	*fakeOrm
+}
+
+func (s *fakeSession) Commit() error   { return nil }
+func (s *fakeSession) Rollback() error { return nil }
+
+func tenantContext(t *testing.T, tenantID string) context.Context {
+	t.Helper()
+	ctx, err := metadata.WithTenantID(context.Background(), tenantID)
+	if err != nil {
+		t.Fatalf("WithTenantID: %v", err)
+	}
+	return ctx
+}
+
+func scopedModelFor(t *testing.T, o orm.IOrm, table string) orm.IModel {
+	t.Helper()
+	model, err := o.Model(&orm.ModelMeta{Table: table})
+	if err != nil {
+		t.Fatalf("Model(%s): %v", table, err)
+	}
+	return model
+}
+
+func TestWrap_IsolatesTenantTables(t *testing.T) {
+	base := &fakeOrm{models: map[string]*capturingModel{}}
+	o := Wrap(base, Tables...)
+	users := scopedModelFor(t, o, "users")
+	ctxA := tenantContext(t, "tenant-a")
+
+	// 携带租户：读写均追加当前租户条件
+	for name, call := range map[string]func() error{
+		"first":  func() error { return users.First(ctxA, &iamentity.User{}, orm.WithWhere("id = ?", 1)) },
+		"find":   func() error { return users.Find(ctxA, &[]*iamentity.User{}) },
+		"update": func() error { return users.UpdateValues(ctxA, map[string]any{"status": "locked"}) },
+		"delete": func() error { return users.Delete(ctxA) },
+	} {
+		if err := call(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := orm.Condition{Expr: "users.tenant_id = ?", Args: []any{"tenant-a"}}
+		where := base.models["users"].lastWhere
+		if len(where) == 0 || !reflect.DeepEqual(where[len(where)-1], want) {
+			t.Fatalf("%s: expected tenant condition, got %+v", name, where)
+		}
+	}
+
+	// 未携带租户：不追加条件
+	if err := users.Find(context.Background(), &[]*iamentity.User{}); err != nil {
+		t.Fatalf("find without tenant: %v", err)
+	}
+	if where := base.models["users"].lastWhere; len(where) != 0 {
+		t.Fatalf("expected no condition without tenant, got %+v", where)
+	}
+
+	// 非受管表不受影响
+	if err := scopedModelFor(t, o, "user_roles").Find(ctxA, &[]map[string]any{}); err != nil {
+		t.Fatalf("find user_roles: %v", err)
+	}
+	if where := base.models["user_roles"].lastWhere; len(where) != 0 {
+		t.Fatalf("expected unmanaged table untouched, got %+v", where)
+	}
+
+	// 新建实体写入当前租户，已指定的租户保留
+	fresh, explicit := &iamentity.User{}, &iamentity.User{TenantID: "tenant-x"}
+	if err := users.Create(ctxA, fresh, explicit); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if fresh.TenantID != "tenant-a" || explicit.TenantID != "tenant-x" {
+		t.Fatalf("unexpected tenants: %q, %q", fresh.TenantID, explicit.TenantID)
+	}
+}
+
+func TestWrap_SharedRolesReadableButNotWritable(t *testing.T) {
+	base := &fakeOrm{models: map[string]*capturingModel{}}
+	o := Wrap(base, Tables...)
+	ctxA := tenantContext(t, "tenant-a")
+
+	// 事务会话同样生效：共享表读取放行 tenant_id 为空的共享行
+	session, err := o.Begin(ctxA)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	roles := scopedModelFor(t, session, "roles")
+	if err := roles.Find(ctxA, &[]*iamentity.Role{}); err != nil {
+		t.Fatalf("find roles: %v", err)
+	}
+	want := orm.Condition{Expr: "(roles.tenant_id IN (?, '') OR roles.tenant_id IS NULL)", Args: []any{"tenant-a"}}
+	if where := base.models["roles"].lastWhere; len(where) != 1 || !reflect.DeepEqual(where[0], want) {
+		t.Fatalf("expected shared read condition, got %+v", where)
+	}
+
+	// 写入仅限当前租户
+	if err := roles.Delete(ctxA, orm.WithWhere("id = ?", 1)); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	want = orm.Condition{Expr: "roles.tenant_id = ?", Args: []any{"tenant-a"}}
+	if where := base.models["roles"].lastWhere; len(where) != 2 || !reflect.DeepEqual(where[1], want) {
+		t.Fatalf("expected tenant-only write condition, got %+v", where)
+	}
+
+	// 共享角色与其他租户的角色不可在租户上下文中保存
+	for _, role := range []*iamentity.Role{{Name: "user"}, {Name: "other", TenantID: "tenant-b"}} {
+		if err := roles.Save(ctxA, role); !errorx.Is(err, errorx.Forbidden) {
+			t.Fatalf("expected Forbidden saving %s, got %v", role.Name, err)
+		}
+	}
+	if err := roles.Save(ctxA, &iamentity.Role{Name: "own", TenantID: "tenant-a"}); err != nil {
+		t.Fatalf("save own role: %v", err)
+	}
+	if base.models["roles"].saves != 1 {
+		t.Fatalf("expected only own role saved, got %d saves", base.models["roles"].saves)
+	}
+
+	// 用户表不是共享表：读取同样仅限当前租户
+	if _, err := scopedModelFor(t, o, "users").Count(ctxA); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if where := base.models["users"].lastWhere; len(where) != 1 || where[0].Expr != "users.tenant_id = ?" {
+		t.Fatalf("expected tenant-only user condition, got %+v", where)
+	}
+}
@@ -2,9 +2,14 @@ package user
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	iamentity "gochen-iam/entity"
+	"gochen-iam/repo/actor"
+	"gochen-iam/repo/linktable"
+	"gochen-iam/repo/tenantscope"
+	"gochen/db/dialect"
 	"gochen/db/orm"
 	db "gochen/db/orm/repo"
 	"gochen/domain/crud"
@@ -18,7 +23,7 @@ type UserRepo struct {
 
 // NewUserRepository 创建用户Repository
 func NewUserRepository(o orm.IOrm) (*UserRepo, error) {
-	base, err := db.NewRepo[*iamentity.User, int64](o, "users")
+	base, err := db.NewRepo[*iamentity.User, int64](tenantscope.Wrap(o, tenantscope.Tables...), "users")
 	if err != nil {
 		return nil, err
 	}
@@ -27,22 +32,44 @@ func NewUserRepository(o orm.IOrm) (*UserRepo, error) {
 
 // shared 原生 ICRUDRepository 方法由 CrudBase 提供
 
-// Create 覆盖通用创建，省略非表字段（version/created_by/updated_by/deleted_by）
+// Create 覆盖通用创建，写入创建者/修改者（取自请求上下文）
 func (r *UserRepo) Create(ctx context.Context, u *iamentity.User) error {
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
 	}
-	return model.Create(ctx, u)
+	actor.StampCreate(ctx, u)
+	u.SyncCanonicalNames()
+	return uniqueConflictError(model.Create(ctx, u))
 }
 
-// Update 覆盖通用更新，省略非表字段
+// Update 覆盖通用更新，写入修改者（取自请求上下文）
 func (r *UserRepo) Update(ctx context.Context, u *iamentity.User) error {
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
 	}
-	return model.Save(ctx, u, orm.WithWhere("id = ? AND deleted_at IS NULL", u.GetID()))
+	actor.StampUpdate(ctx, u)
+	u.SyncCanonicalNames()
+	return uniqueConflictError(model.Save(ctx, u, orm.WithWhere("id = ? AND deleted_at IS NULL", u.GetID())))
+}
+
+// isUniqueViolation 判断错误是否为唯一索引冲突（按常见数据库的错误文本识别）
+func isUniqueViolation(err error) bool {
+	return err != nil && dialect.New("").IsUniqueViolation(err)
+}
+
+// uniqueConflictError 将用户名/邮箱唯一索引冲突转换为 Validation
+//
+// 唯一索引覆盖软删与其他租户的用户，服务层按当前租户查重时看不到这些行，冲突只能在写入时识别。
+func uniqueConflictError(err error) error {
+	if !isUniqueViolation(err) {
+		return err
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "email") {
+		return errorx.Wrap(err, errorx.Validation, "邮箱已被占用（可能属于已删除的用户）")
+	}
+	return errorx.Wrap(err, errorx.Validation, "用户名已被占用（可能属于已删除的用户）")
 }
 
 // GetByID 根据ID获取用户（过滤软删记录）
@@ -62,6 +89,22 @@ func (r *UserRepo) GetByID(ctx context.Context, id int64) (*iamentity.User, erro
 	return &user, nil
 }
 
+// GetByIDWithDeleted 根据ID获取用户（包含软删记录，用于恢复/物理删除）
+func (r *UserRepo) GetByIDWithDeleted(ctx context.Context, id int64) (*iamentity.User, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var user iamentity.User
+	if err := model.First(ctx, &user, orm.WithWhere("id = ?", id)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, errorx.New(errorx.NotFound, "用户不存在")
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
+	}
+	return &user, nil
+}
+
 // GetWithRelations 根据ID获取用户及关联数据
 func (r *UserRepo) GetWithRelations(ctx context.Context, id int64) (*iamentity.User, error) {
 	model, err := r.ModelFor(ctx)
@@ -82,18 +125,22 @@ func (r *UserRepo) GetWithRelations(ctx context.Context, id int64) (*iamentity.U
 		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, &user); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
-// FindByEmail 根据邮箱查找用户
+// FindByEmail 根据邮箱查找用户（去除首尾空白、忽略大小写比较）
 func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*iamentity.User, error) {
+	email = iamentity.CanonicalName(email)
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return nil, err
 	}
 	var user iamentity.User
 	err = model.First(ctx, &user,
-		orm.WithWhere("email = ? AND deleted_at IS NULL", email),
+		orm.WithWhere(canonicalMatch("email")+" AND deleted_at IS NULL", email, email),
 		orm.WithPreload("Groups"),
 		orm.WithPreload("Roles"),
 	)
@@ -105,18 +152,24 @@ func (r *UserRepo) FindByEmail(ctx context.Context, email string) (*iamentity.Us
 		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, &user); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
-// FindByUsername 根据用户名查找用户
+// FindByUsername 根据用户名查找用户（去除首尾空白、忽略大小写比较）
+//
+// 用户名按注册时的写法存储，查找与唯一性检查统一按小写折叠比较，"Bob" 与 "bob" 视为同一用户名。
 func (r *UserRepo) FindByUsername(ctx context.Context, username string) (*iamentity.User, error) {
+	username = iamentity.CanonicalName(username)
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return nil, err
 	}
 	var user iamentity.User
 	err = model.First(ctx, &user,
-		orm.WithWhere("username = ? AND deleted_at IS NULL", username),
+		orm.WithWhere(canonicalMatch("username")+" AND deleted_at IS NULL", username, username),
 		orm.WithPreload("Groups"),
 		orm.WithPreload("Roles"),
 	)
@@ -128,17 +181,257 @@ func (r *UserRepo) FindByUsername(ctx context.Context, username string) (*iament
 		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, &user); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
-// UpdateLastLogin 更新最后登录时间
-func (r *UserRepo) UpdateLastLogin(ctx context.Context, userID int64) error {
+// ExistsByUsername 判断用户名是否已被占用（仅 COUNT，不加载用户及关联）
+//
+// 用户名按去除空白、忽略大小写比较（与 FindByUsername 一致）；软删除用户同样计入（唯一索引覆盖软删行）。
+func (r *UserRepo) ExistsByUsername(ctx context.Context, username string) (bool, error) {
+	username = iamentity.CanonicalName(username)
+	if username == "" {
+		return false, nil
+	}
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return false, err
+	}
+	count, err := model.Count(ctx, orm.WithWhere(canonicalMatch("username"), username, username))
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "检查用户名失败")
+	}
+	return count > 0, nil
+}
+
+// ExistsByEmail 判断邮箱是否已被占用（仅 COUNT，不加载用户及关联）
+//
+// 邮箱按去除空白、忽略大小写比较；软删除用户同样计入（唯一索引覆盖软删行）。
+func (r *UserRepo) ExistsByEmail(ctx context.Context, email string) (bool, error) {
+	email = iamentity.CanonicalName(email)
+	if email == "" {
+		return false, nil
+	}
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return false, err
+	}
+	count, err := model.Count(ctx, orm.WithWhere(canonicalMatch("email"), email, email))
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "检查邮箱失败")
+	}
+	return count > 0, nil
+}
+
+// canonicalMatch 返回按规范化列匹配的条件（需传入两次规范化值）
+//
+// 存量用户在 BackfillCanonicalNames 回填前规范化列为空，此时回退到对原列去空白转小写后比较，
+// 避免迁移后、回填前存量用户无法登录或被重复注册。
+func canonicalMatch(column string) string {
+	canonical := column + "_canonical"
+	return "(" + canonical + " = ? OR ((" + canonical + " IS NULL OR " + canonical + " = '') AND LOWER(TRIM(" + column + ")) = ?))"
+}
+
+// BackfillCanonicalNames 回填存量用户的小写规范化用户名与邮箱（含软删用户）
+//
+// 仅处理规范化列为空的记录；存量数据中存在仅大小写不同的重复用户名/邮箱时唯一索引冲突，返回 Validation，需先人工合并。
+// 返回回填的记录数。
+func (r *UserRepo) BackfillCanonicalNames(ctx context.Context) (int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var users []*iamentity.User
+	err = model.Find(ctx, &users,
+		orm.WithWhere("username_canonical IS NULL OR username_canonical = '' OR email_canonical IS NULL OR email_canonical = ''"),
+	)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "查询待回填用户失败")
+	}
+
+	var filled int64
+	for _, user := range users {
+		user.SyncCanonicalNames()
+		err := model.UpdateValues(ctx, map[string]any{
+			"username_canonical": user.UsernameCanonical,
+			"email_canonical":    user.EmailCanonical,
+		}, orm.WithWhere("id = ?", user.GetID()))
+		if err != nil {
+			if isUniqueViolation(err) {
+				return filled, errorx.Wrap(err, errorx.Validation, "存在仅大小写不同的重复用户名或邮箱，需先人工合并").
+					WithContext("user_id", user.GetID())
+			}
+			return filled, errorx.Wrap(err, errorx.Database, "回填用户规范化用户名/邮箱失败")
+		}
+		filled++
+	}
+	return filled, nil
+}
+
+// SoftDeleteByID 软删用户（写入 deleted_at）
+//
+// User 未实现 domain.ISoftDeletable，通用 Delete 为物理删除，因此软删需显式更新。
+func (r *UserRepo) SoftDeleteByID(ctx context.Context, id int64) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.UpdateValues(ctx, actor.SoftDeleteValues(ctx, time.Now()),
+		orm.WithWhere("id = ? AND deleted_at IS NULL", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "删除用户失败")
+	}
+	return nil
+}
+
+// RestoreByID 恢复软删用户（deleted_at 置空）
+func (r *UserRepo) RestoreByID(ctx context.Context, id int64) (*iamentity.User, error) {
+	user, err := r.GetByIDWithDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt == nil {
+		return user, nil
+	}
+	user.Restore()
+	user.DeletedBy = actor.System
+	actor.StampUpdate(ctx, user)
+
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 显式置空 deleted_at（Save 会跳过 nil 值）
+	if err := model.UpdateValues(ctx, map[string]any{
+		"deleted_at": nil,
+		"deleted_by": user.DeletedBy,
+		"updated_at": user.UpdatedAt,
+		"updated_by": user.UpdatedBy,
+	}, orm.WithWhere("id = ?", id)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "恢复用户失败")
+	}
+	return user, nil
+}
+
+// PurgeByID 物理删除用户（硬删），同时清理角色与组织关联
+func (r *UserRepo) PurgeByID(ctx context.Context, id int64) error {
+	user, err := r.GetByIDWithDeleted(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.Association(user, "Roles").Clear(ctx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理用户角色关联失败")
+	}
+	if err := model.Association(user, "Groups").Clear(ctx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理用户组织关联失败")
+	}
+	history, err := r.passwordHistoryModel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := history.Delete(ctx, orm.WithWhere("user_id = ?", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理用户历史密码失败")
+	}
+	if err := r.Purge(ctx, id); err != nil {
+		return errorx.Wrap(err, errorx.Database, "物理删除用户失败")
+	}
+	return nil
+}
+
+// AddPasswordHistory 记录一条历史密码哈希
+func (r *UserRepo) AddPasswordHistory(ctx context.Context, userID int64, passwordHash string) error {
+	model, err := r.passwordHistoryModel(ctx)
+	if err != nil {
+		return err
+	}
+	record := &iamentity.PasswordHistory{
+		UserID:       userID,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+	}
+	if err := model.Create(ctx, record); err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录历史密码失败")
+	}
+	return nil
+}
+
+// FindRecentPasswordHashes 查询用户最近的 limit 条历史密码哈希（按时间倒序）
+func (r *UserRepo) FindRecentPasswordHashes(ctx context.Context, userID int64, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	model, err := r.passwordHistoryModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var records []*iamentity.PasswordHistory
+	err = model.Find(ctx, &records,
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("created_at", true),
+		orm.WithOrderBy("id", true),
+		orm.WithLimit(limit),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询历史密码失败")
+	}
+	hashes := make([]string, 0, len(records))
+	for _, record := range records {
+		hashes = append(hashes, record.PasswordHash)
+	}
+	return hashes, nil
+}
+
+// PrunePasswordHistory 仅保留用户最近的 keep 条历史密码，删除更早的记录（keep<=0 时全部删除）
+func (r *UserRepo) PrunePasswordHistory(ctx context.Context, userID int64, keep int) error {
+	model, err := r.passwordHistoryModel(ctx)
+	if err != nil {
+		return err
+	}
+	var records []*iamentity.PasswordHistory
+	err = model.Find(ctx, &records,
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("created_at", true),
+		orm.WithOrderBy("id", true),
+	)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "查询历史密码失败")
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if len(records) <= keep {
+		return nil
+	}
+	stale := make([]int64, 0, len(records)-keep)
+	for _, record := range records[keep:] {
+		stale = append(stale, record.ID)
+	}
+	if err := model.Delete(ctx, orm.WithWhere("user_id = ? AND id IN ?", userID, stale)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理历史密码失败")
+	}
+	return nil
+}
+
+// passwordHistoryModel 获取 password_history 表模型（优先使用事务会话）
+func (r *UserRepo) passwordHistoryModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.PasswordHistory](ctx, r.Orm(), "password_history")
+}
+
+// UpdateLastLogin 更新最后登录时间与上一次登录时间（previousLoginAt 为 nil 时写入 NULL）
+func (r *UserRepo) UpdateLastLogin(ctx context.Context, userID int64, lastLoginAt time.Time, previousLoginAt *time.Time) error {
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
 	}
 	err = model.UpdateValues(ctx, map[string]any{
-		"last_login_at": time.Now(),
+		"last_login_at":     lastLoginAt,
+		"previous_login_at": previousLoginAt,
 	}, orm.WithWhere("id = ? AND deleted_at IS NULL", userID))
 
 	if err != nil {
@@ -148,6 +441,136 @@ func (r *UserRepo) UpdateLastLogin(ctx context.Context, userID int64) error {
 	return nil
 }
 
+// UpdatePassword 仅更新密码哈希（用于哈希成本升级等不触及其他字段的场景）
+func (r *UserRepo) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	err = model.UpdateValues(ctx, actor.StampValues(ctx, map[string]any{
+		"password_hash": hashedPassword,
+		"updated_at":    time.Now(),
+	}), orm.WithWhere("id = ? AND deleted_at IS NULL", userID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新密码失败")
+	}
+	return nil
+}
+
+// UpdateLoginFailures 更新登录失败计数与临时锁定截止时间（lockoutUntil 为 nil 表示未锁定）
+func (r *UserRepo) UpdateLoginFailures(ctx context.Context, userID int64, failedCount int, lockoutUntil *time.Time) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	err = model.UpdateValues(ctx, map[string]any{
+		"failed_login_count": failedCount,
+		"lockout_until":      lockoutUntil,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL", userID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新登录失败计数失败")
+	}
+	return nil
+}
+
+// IncrementLoginFailures 原子递增登录失败计数（failed_login_count = failed_login_count + 1）并读回递增后的值
+//
+// 上一次临时锁定已到期时先清零重新计数；并发的失败登录各自递增，不会因基于内存旧值覆盖而丢失计数。
+func (r *UserRepo) IncrementLoginFailures(ctx context.Context, userID int64, now time.Time) (int, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// 1. 到期的临时锁定清零重新计数
+	err = model.UpdateValues(ctx, map[string]any{
+		"failed_login_count": 0,
+		"lockout_until":      nil,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL AND lockout_until IS NOT NULL AND lockout_until <= ?", userID, now))
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "重置登录失败计数失败")
+	}
+
+	// 2. 原子递增
+	database := linktable.Engine(ctx, r.Orm()).Database()
+	if database == nil {
+		return 0, errorx.New(errorx.Internal, "ORM 未提供数据库连接，无法递增登录失败计数")
+	}
+	if _, err := database.Exec(ctx,
+		"UPDATE users SET failed_login_count = failed_login_count + 1 WHERE id = ? AND deleted_at IS NULL", userID); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "递增登录失败计数失败")
+	}
+
+	// 3. 读回递增后的值
+	var user iamentity.User
+	if err := model.First(ctx, &user, orm.WithWhere("id = ? AND deleted_at IS NULL", userID)); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "读取登录失败计数失败")
+	}
+	return user.FailedLoginCount, nil
+}
+
+// UpdateLockoutUntil 更新临时锁定截止时间（不改动失败计数）
+func (r *UserRepo) UpdateLockoutUntil(ctx context.Context, userID int64, lockoutUntil *time.Time) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	err = model.UpdateValues(ctx, map[string]any{
+		"lockout_until": lockoutUntil,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL", userID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新临时锁定时间失败")
+	}
+	return nil
+}
+
+// UpdateLockInfo 更新锁定原因与锁定时间（reason 为空、lockAt 为 nil 表示清除）
+func (r *UserRepo) UpdateLockInfo(ctx context.Context, userID int64, reason string, lockAt *time.Time) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	err = model.UpdateValues(ctx, map[string]any{
+		"lock_reason": reason,
+		"lock_at":     lockAt,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL", userID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新锁定信息失败")
+	}
+	return nil
+}
+
+// UpdateTOTP 更新 TOTP 密钥（密文）与两步验证启用状态（支持清空）
+func (r *UserRepo) UpdateTOTP(ctx context.Context, userID int64, encryptedSecret string, enabled bool) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	err = model.UpdateValues(ctx, map[string]any{
+		"totp_secret":        encryptedSecret,
+		"two_factor_enabled": enabled,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL", userID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新两步验证设置失败")
+	}
+	return nil
+}
+
+// UpdateTOTPLastStep 记录最近一次通过校验的 TOTP 时间步（仅向前推进，不回退）
+func (r *UserRepo) UpdateTOTPLastStep(ctx context.Context, userID int64, step int64) error {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return err
+	}
+	err = model.UpdateValues(ctx, map[string]any{
+		"totp_last_step": step,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL AND totp_last_step < ?", userID, step))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新两步验证时间步失败")
+	}
+	return nil
+}
+
 // FindByStatus 根据状态查找用户
 func (r *UserRepo) FindByStatus(ctx context.Context, status string) ([]*iamentity.User, error) {
 	model, err := r.ModelFor(ctx)
@@ -165,9 +588,124 @@ func (r *UserRepo) FindByStatus(ctx context.Context, status string) ([]*iamentit
 		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, users...); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// FindByStatusLite 根据状态查找用户（不预加载关联，适用于列表视图）
+//
+// 与 FindByStatus 不同，不加载 Groups/Roles；offset/limit <= 0 表示不分页。结果按 ID 升序返回。
+func (r *UserRepo) FindByStatusLite(ctx context.Context, status string, offset, limit int) ([]*iamentity.User, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var users []*iamentity.User
+	opts := []orm.QueryOption{
+		orm.WithWhere("status = ? AND deleted_at IS NULL", status),
+		orm.WithOrderBy("id", false),
+	}
+
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	err = model.Find(ctx, &users, opts...)
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
+	}
+
+	return users, nil
+}
+
+// FindLocked 查找当前处于锁定状态的用户（不预加载关联）
+//
+// 包括状态为 locked 的用户与临时锁定尚未到期（lockout_until > now）的用户，结果按 ID 升序返回。
+func (r *UserRepo) FindLocked(ctx context.Context, now time.Time) ([]*iamentity.User, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var users []*iamentity.User
+	err = model.Find(ctx, &users,
+		orm.WithWhere("deleted_at IS NULL AND (status = ? OR lockout_until > ?)", "locked", now),
+		orm.WithOrderBy("id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询锁定用户失败")
+	}
+	return users, nil
+}
+
+// FindPasswordsExpiringBefore 查找密码将在 cutoff 之前过期的 active 用户（不预加载关联）
+//
+// 过期时间为最近一次设置密码的时间（password_changed_at，为空时按 created_at）加上 maxAge，
+// 已过期的用户同样包含在内；maxAge <= 0 表示未启用密码过期，返回空列表。结果按 ID 升序返回。
+func (r *UserRepo) FindPasswordsExpiringBefore(ctx context.Context, cutoff time.Time, maxAge time.Duration) ([]*iamentity.User, error) {
+	if maxAge <= 0 {
+		return []*iamentity.User{}, nil
+	}
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var users []*iamentity.User
+	err = model.Find(ctx, &users,
+		orm.WithWhere("status = ? AND deleted_at IS NULL AND COALESCE(password_changed_at, created_at) < ?", "active", cutoff.Add(-maxAge)),
+		orm.WithOrderBy("id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询密码即将过期的用户失败")
+	}
 	return users, nil
 }
 
+// FindByCreatedRange 查找注册时间位于 [from, to) 区间内的用户（不预加载关联），并返回满足条件的总数
+//
+// status 为空时不按状态过滤；offset/limit <= 0 表示不分页。结果按注册时间、ID 升序返回。
+func (r *UserRepo) FindByCreatedRange(ctx context.Context, from, to time.Time, status string, offset, limit int) ([]*iamentity.User, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	where := "created_at >= ? AND created_at < ? AND deleted_at IS NULL"
+	args := []any{from, to}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	total, err := model.Count(ctx, orm.WithWhere(where, args...))
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计用户失败")
+	}
+
+	opts := []orm.QueryOption{
+		orm.WithWhere(where, args...),
+		orm.WithOrderBy("created_at", false),
+		orm.WithOrderBy("id", false),
+	}
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	var users []*iamentity.User
+	if err := model.Find(ctx, &users, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "查询用户失败")
+	}
+	return users, total, nil
+}
+
 // FindByGroupID 根据组织ID查找用户
 func (r *UserRepo) FindByGroupID(ctx context.Context, groupID int64) ([]*iamentity.User, error) {
 	model, err := r.ModelFor(ctx)
@@ -186,10 +724,13 @@ func (r *UserRepo) FindByGroupID(ctx context.Context, groupID int64) ([]*iamenti
 		return nil, errorx.Wrap(err, errorx.Database, "查询组织用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, users...); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
 
-// FindByRoleID 根据角色ID查找用户
+// FindByRoleID 根据角色ID查找用户（过滤软删用户与已过期的分配）
 func (r *UserRepo) FindByRoleID(ctx context.Context, roleID int64) ([]*iamentity.User, error) {
 	model, err := r.ModelFor(ctx)
 	if err != nil {
@@ -198,7 +739,7 @@ func (r *UserRepo) FindByRoleID(ctx context.Context, roleID int64) ([]*iamentity
 	var users []*iamentity.User
 	err = model.Find(ctx, &users,
 		orm.WithJoin(orm.InnerJoin("user_roles", "", orm.On("users.id", "user_roles.user_id"))),
-		orm.WithWhere("user_roles.role_id = ? AND users.deleted_at IS NULL", roleID),
+		orm.WithWhere("user_roles.role_id = ? AND users.deleted_at IS NULL AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)", roleID, time.Now()),
 		orm.WithPreload("Groups"),
 		orm.WithPreload("Roles"),
 	)
@@ -207,9 +748,71 @@ func (r *UserRepo) FindByRoleID(ctx context.Context, roleID int64) ([]*iamentity
 		return nil, errorx.Wrap(err, errorx.Database, "查询角色用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, users...); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
 
+// FindByGroupIDPaged 分页查询组织的直接成员，并返回成员总数
+//
+// offset/limit <= 0 表示不分页；结果按用户 ID 升序返回，保证跨页顺序稳定。
+func (r *UserRepo) FindByGroupIDPaged(ctx context.Context, groupID int64, offset, limit int) ([]*iamentity.User, int64, error) {
+	return r.findByLinkPaged(ctx, linktable.UserGroups, "group_id", groupID, offset, limit, "查询组织用户失败")
+}
+
+// FindByRoleIDPaged 分页查询直接分配了指定角色的用户（过滤已过期的分配），并返回用户总数
+//
+// offset/limit <= 0 表示不分页；结果按用户 ID 升序返回，保证跨页顺序稳定。
+func (r *UserRepo) FindByRoleIDPaged(ctx context.Context, roleID int64, offset, limit int) ([]*iamentity.User, int64, error) {
+	return r.findByLinkPaged(ctx, linktable.UserRoles, "role_id", roleID, offset, limit, "查询角色用户失败")
+}
+
+// findByLinkPaged 按关联表（user_groups/user_roles）分页查询未软删的用户
+func (r *UserRepo) findByLinkPaged(ctx context.Context, table, column string, id int64, offset, limit int, failMsg string) ([]*iamentity.User, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	where := table + "." + column + " = ? AND users.deleted_at IS NULL"
+	args := []any{id}
+	if table == linktable.UserRoles {
+		// 已过期的角色分配不计入
+		where += " AND (user_roles.expires_at IS NULL OR user_roles.expires_at > ?)"
+		args = append(args, time.Now())
+	}
+	filter := []orm.QueryOption{
+		orm.WithJoin(orm.InnerJoin(table, "", orm.On("users.id", table+".user_id"))),
+		orm.WithWhere(where, args...),
+	}
+
+	total, err := model.Count(ctx, filter...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, failMsg)
+	}
+
+	opts := append(filter,
+		orm.WithPreload("Groups"),
+		orm.WithPreload("Roles"),
+		orm.WithOrderBy("users.id", false),
+	)
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	var users []*iamentity.User
+	if err := model.Find(ctx, &users, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, failMsg)
+	}
+	if err := r.pruneExpiredRoles(ctx, users...); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
 // AssignToGroup 将用户分配到组织
 func (r *UserRepo) AssignToGroup(ctx context.Context, userID, groupID int64) error {
 	// 检查用户是否存在
@@ -218,6 +821,15 @@ func (r *UserRepo) AssignToGroup(ctx context.Context, userID, groupID int64) err
 		return err
 	}
 
+	// 已关联时直接返回，重复调用幂等
+	exists, err := linktable.Exists(ctx, r.Orm(), linktable.UserGroups, "user_id", userID, "group_id", groupID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
@@ -229,6 +841,19 @@ func (r *UserRepo) AssignToGroup(ctx context.Context, userID, groupID int64) err
 		return errorx.Wrap(err, errorx.Database, "分配用户到组织失败")
 	}
 
+	// 记录加入时间（仅首次加入时写入，重复分配不覆盖）
+	membership, err := linktable.Model[iamentity.UserGroup](ctx, r.Orm(), linktable.UserGroups)
+	if err != nil {
+		return err
+	}
+	err = membership.UpdateValues(ctx, map[string]any{
+		"joined_at": time.Now(),
+	}, orm.WithWhere("user_id = ? AND group_id = ? AND joined_at IS NULL", userID, groupID))
+
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录用户加入组织时间失败")
+	}
+
 	return nil
 }
 
@@ -262,6 +887,15 @@ func (r *UserRepo) AssignRole(ctx context.Context, userID, roleID int64) error {
 		return err
 	}
 
+	// 已关联时直接返回，重复调用幂等
+	exists, err := linktable.Exists(ctx, r.Orm(), linktable.UserRoles, "user_id", userID, "role_id", roleID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
 	model, err := r.ModelFor(ctx)
 	if err != nil {
 		return err
@@ -276,6 +910,106 @@ func (r *UserRepo) AssignRole(ctx context.Context, userID, roleID int64) error {
 	return nil
 }
 
+// SetRoleExpiry 设置用户角色分配的过期时间（expiresAt 为 nil 表示永久分配）
+func (r *UserRepo) SetRoleExpiry(ctx context.Context, userID, roleID int64, expiresAt *time.Time) error {
+	assignment, err := r.userRoleModel(ctx)
+	if err != nil {
+		return err
+	}
+	err = assignment.UpdateValues(ctx, map[string]any{
+		"expires_at": expiresAt,
+	}, orm.WithWhere("user_id = ? AND role_id = ?", userID, roleID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新角色分配过期时间失败")
+	}
+	return nil
+}
+
+// SetRoleGroupScope 设置用户角色分配的组织范围（groupID 为 nil 表示全局分配）
+func (r *UserRepo) SetRoleGroupScope(ctx context.Context, userID, roleID int64, groupID *int64) error {
+	assignment, err := r.userRoleModel(ctx)
+	if err != nil {
+		return err
+	}
+	err = assignment.UpdateValues(ctx, map[string]any{
+		"group_id": groupID,
+	}, orm.WithWhere("user_id = ? AND role_id = ?", userID, roleID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新角色分配组织范围失败")
+	}
+	return nil
+}
+
+// SetRoleSourceGroup 设置用户角色分配的来源组织（sourceGroupID 为 nil 表示直接分配）
+func (r *UserRepo) SetRoleSourceGroup(ctx context.Context, userID, roleID int64, sourceGroupID *int64) error {
+	assignment, err := r.userRoleModel(ctx)
+	if err != nil {
+		return err
+	}
+	err = assignment.UpdateValues(ctx, map[string]any{
+		"source_group_id": sourceGroupID,
+	}, orm.WithWhere("user_id = ? AND role_id = ?", userID, roleID))
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新角色分配来源组织失败")
+	}
+	return nil
+}
+
+// userRoleModel 返回 user_roles 关联表模型（事务上下文中使用事务会话）
+func (r *UserRepo) userRoleModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UserRoleAssignment](ctx, r.Orm(), linktable.UserRoles)
+}
+
+// pruneExpiredRoles 从预加载的 Roles 中剔除已过期的分配
+//
+// ORM 预加载不支持附加条件，过期分配在清理任务运行前仍留在关联表中，
+// 因此预加载后按 user_roles.expires_at 统一过滤，避免已过期的角色出现在用户详情或 HasRole 判断中。
+func (r *UserRepo) pruneExpiredRoles(ctx context.Context, users ...*iamentity.User) error {
+	userIDs := make([]int64, 0, len(users))
+	for _, user := range users {
+		if user != nil && len(user.Roles) > 0 {
+			userIDs = append(userIDs, user.GetID())
+		}
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	model, err := r.userRoleModel(ctx)
+	if err != nil {
+		return err
+	}
+	var expired []*iamentity.UserRoleAssignment
+	err = model.Find(ctx, &expired,
+		orm.WithWhere("user_id IN ? AND expires_at IS NOT NULL AND expires_at <= ?", userIDs, time.Now()),
+	)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "查询过期角色分配失败")
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	type key struct{ userID, roleID int64 }
+	skip := make(map[key]struct{}, len(expired))
+	for _, a := range expired {
+		skip[key{a.UserID, a.RoleID}] = struct{}{}
+	}
+	for _, user := range users {
+		if user == nil || len(user.Roles) == 0 {
+			continue
+		}
+		roles := user.Roles[:0]
+		for _, role := range user.Roles {
+			if _, ok := skip[key{user.GetID(), role.GetID()}]; !ok {
+				roles = append(roles, role)
+			}
+		}
+		user.Roles = roles
+	}
+	return nil
+}
+
 // RemoveRole 移除用户角色
 func (r *UserRepo) RemoveRole(ctx context.Context, userID, roleID int64) error {
 	// 检查用户是否存在
@@ -298,6 +1032,19 @@ func (r *UserRepo) RemoveRole(ctx context.Context, userID, roleID int64) error {
 	return nil
 }
 
+// CountCreatedSince 统计指定时间（含）之后注册的用户数量（不含软删）
+func (r *UserRepo) CountCreatedSince(ctx context.Context, since time.Time) (int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count, err := model.Count(ctx, orm.WithWhere("created_at >= ? AND deleted_at IS NULL", since))
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计新注册用户失败")
+	}
+	return count, nil
+}
+
 // CountByStatus 统计各状态用户数量
 func (r *UserRepo) CountByStatus(ctx context.Context) (map[string]int64, error) {
 	type StatusCount struct {
@@ -355,5 +1102,218 @@ func (r *UserRepo) SearchUsers(ctx context.Context, keyword string, limit int) (
 		return nil, errorx.Wrap(err, errorx.Database, "搜索用户失败")
 	}
 
+	if err := r.pruneExpiredRoles(ctx, users...); err != nil {
+		return nil, err
+	}
 	return users, nil
 }
+
+// SearchUsersPaged 分页搜索用户（用户名、邮箱模糊匹配，不预加载关联），并返回满足条件的总数
+//
+// keyword 为空时不过滤；默认仅返回 active 且未软删除的用户，includeInactive/includeDeleted 分别放开状态与软删除过滤；
+// offset/limit <= 0 表示不分页。结果按 ID 升序返回，保证跨页顺序稳定。
+func (r *UserRepo) SearchUsersPaged(ctx context.Context, keyword string, includeInactive, includeDeleted bool, offset, limit int) ([]*iamentity.User, int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var conds []string
+	var args []any
+	if !includeInactive {
+		conds = append(conds, "status = ?")
+		args = append(args, "active")
+	}
+	if !includeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if keyword != "" {
+		conds = append(conds, "(username LIKE ? OR email LIKE ?)")
+		args = append(args, "%"+keyword+"%", "%"+keyword+"%")
+	}
+	var filter []orm.QueryOption
+	if len(conds) > 0 {
+		filter = append(filter, orm.WithWhere(strings.Join(conds, " AND "), args...))
+	}
+
+	total, err := model.Count(ctx, filter...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计用户失败")
+	}
+
+	opts := append(filter, orm.WithOrderBy("id", false))
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	if offset > 0 {
+		opts = append(opts, orm.WithOffset(offset))
+	}
+
+	var users []*iamentity.User
+	if err := model.Find(ctx, &users, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "搜索用户失败")
+	}
+	return users, total, nil
+}
+
+// CountByStatusValue 统计指定状态的用户数量（不含软删除）
+func (r *UserRepo) CountByStatusValue(ctx context.Context, status string) (int64, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return 0, err
+	}
+	total, err := model.Count(ctx, orm.WithWhere("status = ? AND deleted_at IS NULL", status))
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户失败")
+	}
+	return total, nil
+}
+
+// FindWithEmptyAvatar 查找未设置头像的用户（资料不完整），可选按状态过滤
+//
+// statuses 为空时不过滤状态；limit <= 0 表示不限制条数。结果按 ID 升序返回。
+func (r *UserRepo) FindWithEmptyAvatar(ctx context.Context, limit int, statuses ...string) ([]*iamentity.User, error) {
+	model, err := r.ModelFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var users []*iamentity.User
+	opts := []orm.QueryOption{
+		orm.WithWhere("(avatar IS NULL OR avatar = '') AND deleted_at IS NULL"),
+		orm.WithOrderBy("id", false),
+	}
+
+	if len(statuses) > 0 {
+		opts = append(opts, orm.WithWhere("status IN ?", statuses))
+	}
+
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+
+	err = model.Find(ctx, &users, opts...)
+
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询资料不完整用户失败")
+	}
+
+	return users, nil
+}
+
+// RecordRoleChange 写入用户角色变更记录
+func (r *UserRepo) RecordRoleChange(ctx context.Context, change *iamentity.UserRoleChange) error {
+	model, err := r.roleChangeModel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.Create(ctx, change); err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录角色变更失败")
+	}
+	return nil
+}
+
+// FindRoleChanges 查询用户在指定时间（含）之后的角色变更记录，按时间倒序
+//
+// limit <= 0 表示不限制条数。
+func (r *UserRepo) FindRoleChanges(ctx context.Context, userID int64, since time.Time, limit int) ([]*iamentity.UserRoleChange, error) {
+	model, err := r.roleChangeModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := []orm.QueryOption{
+		orm.WithWhere("user_id = ? AND changed_at >= ?", userID, since),
+		orm.WithOrderBy("changed_at", true),
+		orm.WithOrderBy("id", true),
+	}
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+
+	var changes []*iamentity.UserRoleChange
+	if err := model.Find(ctx, &changes, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询角色变更记录失败")
+	}
+	return changes, nil
+}
+
+// RecordGroupChange 写入用户组织成员关系变更记录
+func (r *UserRepo) RecordGroupChange(ctx context.Context, change *iamentity.UserGroupChange) error {
+	model, err := r.groupChangeModel(ctx)
+	if err != nil {
+		return err
+	}
+	if err := model.Create(ctx, change); err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录组织成员变更失败")
+	}
+	return nil
+}
+
+// FindGroupChanges 查询用户的组织成员关系变更记录，按时间正序
+func (r *UserRepo) FindGroupChanges(ctx context.Context, userID int64) ([]*iamentity.UserGroupChange, error) {
+	model, err := r.groupChangeModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var changes []*iamentity.UserGroupChange
+	err = model.Find(ctx, &changes,
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("changed_at", false),
+		orm.WithOrderBy("id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询组织成员变更记录失败")
+	}
+	return changes, nil
+}
+
+// RecordUsernameChange 写入用户名变更记录（操作者取自请求上下文）
+func (r *UserRepo) RecordUsernameChange(ctx context.Context, userID int64, oldUsername, newUsername string) error {
+	model, err := r.usernameHistoryModel(ctx)
+	if err != nil {
+		return err
+	}
+	record := &iamentity.UsernameHistory{
+		UserID:      userID,
+		OldUsername: oldUsername,
+		NewUsername: newUsername,
+		ChangedBy:   actor.FromContext(ctx),
+		ChangedAt:   time.Now(),
+	}
+	if err := model.Create(ctx, record); err != nil {
+		return errorx.Wrap(err, errorx.Database, "记录用户名变更失败")
+	}
+	return nil
+}
+
+// FindUsernameHistory 查询用户的用户名变更记录，按时间正序
+func (r *UserRepo) FindUsernameHistory(ctx context.Context, userID int64) ([]*iamentity.UsernameHistory, error) {
+	model, err := r.usernameHistoryModel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var records []*iamentity.UsernameHistory
+	err = model.Find(ctx, &records,
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("changed_at", false),
+		orm.WithOrderBy("id", false),
+	)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户名变更记录失败")
+	}
+	return records, nil
+}
+
+// usernameHistoryModel 获取 username_history 表模型（优先使用事务会话）
+func (r *UserRepo) usernameHistoryModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UsernameHistory](ctx, r.Orm(), "username_history")
+}
+
+// groupChangeModel 获取 user_group_changes 表模型（优先使用事务会话）
+func (r *UserRepo) groupChangeModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UserGroupChange](ctx, r.Orm(), "user_group_changes")
+}
+
+// roleChangeModel 获取 user_role_changes 表模型（优先使用事务会话）
+func (r *UserRepo) roleChangeModel(ctx context.Context) (orm.IModel, error) {
+	return linktable.Model[iamentity.UserRoleChange](ctx, r.Orm(), "user_role_changes")
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	iammw "gochen-iam/middleware"
+	adminsvc "gochen-iam/service/admin"
+	"gochen/errorx"
+	"gochen/httpx"
+	hbasic "gochen/httpx/nethttp"
+)
+
+// AdminRoutes 管理端聚合路由注册器
+type AdminRoutes struct {
+	adminService *adminsvc.AdminService
+	utils        *hbasic.Utils
+}
+
+// NewAdminRoutes 创建管理端聚合路由注册器
+func NewAdminRoutes(adminService *adminsvc.AdminService) *AdminRoutes {
+	return &AdminRoutes{
+		adminService: adminService,
+		utils:        &hbasic.Utils{},
+	}
+}
+
+// RegisterRoutes 注册路由
+func (ar *AdminRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	if group == nil {
+		return errorx.New(errorx.InvalidInput, "route group cannot be nil")
+	}
+	adminGroup := group.Group("/admin")
+	adminGroup.Use(iammw.AdminOnlyMiddleware())
+
+	// 管理端首页汇总（一次请求返回组织/角色统计与近期注册数）
+	adminGroup.GET("/summary", ar.getSummary)
+
+	// 权限字典内省（已注册的 required permissions、是否可授予及注册点）
+	permissionGroup := group.Group("/permissions")
+	permissionGroup.Use(iammw.AdminOnlyMiddleware())
+	permissionGroup.GET("/registry", ar.getPermissionRegistry)
+	return nil
+}
+
+// GetName 获取注册器名称
+func (ar *AdminRoutes) GetName() string {
+	return "admin"
+}
+
+// GetPriority 获取注册优先级
+func (ar *AdminRoutes) GetPriority() int {
+	return 400 // 聚合路由依赖各领域服务，最后注册
+}
+
+// 管理端汇总处理器
+func (ar *AdminRoutes) getSummary(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	summary, err := ar.adminService.GetSummary(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	ar.utils.WriteSuccessResponse(ctx, summary)
+	return nil
+}
+
+// 权限字典内省处理器
+func (ar *AdminRoutes) getPermissionRegistry(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	entries := ar.adminService.GetPermissionRegistry(reqCtx)
+
+	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"permissions": entries,
+		"total":       len(entries),
+	})
+	return nil
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	iammw "gochen-iam/middleware"
+	adminsvc "gochen-iam/service/admin"
+	"gochen/httpx/nethttp"
+)
+
+func TestAdminRoutes_RegisterRoutes(t *testing.T) {
+	routes := map[string]struct{}{}
+	root := newRecordingGroup("", routes)
+
+	ar := NewAdminRoutes(nil)
+	if err := ar.RegisterRoutes(root); err != nil {
+		t.Fatalf("RegisterRoutes failed: %v", err)
+	}
+
+	for _, w := range []string{"GET /admin/summary", "GET /permissions/registry"} {
+		if _, ok := routes[w]; !ok {
+			t.Fatalf("missing route: %s", w)
+		}
+	}
+}
+
+func TestAdminRoutes_PermissionRegistry(t *testing.T) {
+	iammw.RegisterRequiredPermissions("registry:zeta", "registry:alpha", "user:read")
+
+	ar := NewAdminRoutes(adminsvc.NewAdminService(nil, nil, nil))
+	rec := httptest.NewRecorder()
+	ctx, err := nethttp.NewBaseContext(rec, httptest.NewRequest(http.MethodGet, "/api/v1/permissions/registry", nil))
+	if err != nil {
+		t.Fatalf("NewBaseContext: %v", err)
+	}
+	if err := ar.getPermissionRegistry(ctx); err != nil {
+		t.Fatalf("getPermissionRegistry failed: %v", err)
+	}
+
+	var resp struct {
+		Data struct {
+			Permissions []struct {
+				Permission string   `json:"permission"`
+				InCatalog  bool     `json:"in_catalog"`
+				Callsites  []string `json:"callsites"`
+			} `json:"permissions"`
+			Total int `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	entries := resp.Data.Permissions
+	if resp.Data.Total != len(entries) {
+		t.Fatalf("total %d does not match entries %d", resp.Data.Total, len(entries))
+	}
+	if !sort.SliceIsSorted(entries, func(i, j int) bool { return entries[i].Permission < entries[j].Permission }) {
+		t.Fatal("expected entries sorted by permission")
+	}
+
+	want := map[string]bool{"registry:alpha": false, "registry:zeta": false, "user:read": true}
+	for _, e := range entries {
+		inCatalog, ok := want[e.Permission]
+		if !ok {
+			continue
+		}
+		delete(want, e.Permission)
+		if e.InCatalog != inCatalog {
+			t.Fatalf("%s: in_catalog = %v, want %v", e.Permission, e.InCatalog, inCatalog)
+		}
+		found := false
+		for _, callsite := range e.Callsites {
+			if strings.HasPrefix(callsite, "admin_routes_test.go:") {
+				found = true
+			}
+			if strings.Contains(callsite, "/") {
+				t.Fatalf("%s: expected redacted callsite, got %q", e.Permission, callsite)
+			}
+		}
+		if !found {
+			t.Fatalf("%s: missing test callsite in %v", e.Permission, e.Callsites)
+		}
+	}
+	if len(want) != 0 {
+		t.Fatalf("missing permissions: %v", want)
+	}
+}
@@ -1,6 +1,9 @@
 package router
 
 import (
+	"bytes"
+	"context"
+
 	iammw "gochen-iam/middleware"
 	iamsvc "gochen-iam/service"
 	groupsvc "gochen-iam/service/group"
@@ -8,10 +11,38 @@ import (
 	usersvc "gochen-iam/service/user"
 	"gochen/errorx"
 	"gochen/httpx"
+	httpmw "gochen/httpx/middleware"
 	hbasic "gochen/httpx/nethttp"
+	"gochen/logging"
+	"gochen/policy/ratelimit"
+	"strings"
 	"time"
 )
 
+// availabilityRateLimit 可用性检查的限流配置（按客户端 IP），降低用户名/邮箱枚举风险。
+var availabilityRateLimit = ratelimit.Config{
+	RequestsPerSecond: 2,
+	BurstSize:         10,
+}
+
+// breakGlassRateLimit 应急登录的限流配置（按客户端 IP），降低凭据暴力破解风险。
+var breakGlassRateLimit = ratelimit.Config{
+	RequestsPerSecond: 1,
+	BurstSize:         3,
+}
+
+// PasswordResetNotifier 投递密码重置令牌（如发送邮件），由上层注入
+type PasswordResetNotifier func(ctx context.Context, email, token string) error
+
+// EmailVerificationNotifier 投递邮箱验证令牌（如发送邮件），由上层注入
+type EmailVerificationNotifier func(ctx context.Context, email, token string) error
+
+// twoFactorRateLimit 两步验证码提交的限流配置（按客户端 IP），降低验证码暴力破解风险。
+var twoFactorRateLimit = ratelimit.Config{
+	RequestsPerSecond: 1,
+	BurstSize:         5,
+}
+
 // AuthRoutes 认证路由注册器
 type AuthRoutes struct {
 	userService  *usersvc.UserService
@@ -19,6 +50,10 @@ type AuthRoutes struct {
 	roleService  *rolesvc.RoleService
 	utils        *hbasic.Utils
 	authConfig   *iammw.AuthConfig
+	logger       logging.ILogger
+
+	passwordResetNotifier     PasswordResetNotifier
+	emailVerificationNotifier EmailVerificationNotifier
 }
 
 // NewAuthRoutes 创建认证路由注册器
@@ -29,19 +64,61 @@ func NewAuthRoutes(userService *usersvc.UserService, groupService *groupsvc.Grou
 		roleService:  roleService,
 		utils:        &hbasic.Utils{},
 		authConfig:   iammw.DefaultAuthConfig(),
+		logger:       logging.ComponentLogger("iam.router.auth"),
 	}
 }
 
+// SetPasswordResetNotifier 设置密码重置令牌投递方式；未设置时令牌不会被投递。
+func (ar *AuthRoutes) SetPasswordResetNotifier(notifier PasswordResetNotifier) {
+	ar.passwordResetNotifier = notifier
+}
+
+// SetEmailVerificationNotifier 设置邮箱验证令牌投递方式；未设置时令牌不会被投递。
+func (ar *AuthRoutes) SetEmailVerificationNotifier(notifier EmailVerificationNotifier) {
+	ar.emailVerificationNotifier = notifier
+}
+
 // RegisterRoutes 注册路由。
 func (ar *AuthRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 	authGroup := group.Group("/auth")
 
-	authGroup.POST("/register", ar.register)
+	// 注册支持 Idempotency-Key（默认不生效，需配置幂等存储）
+	registerGroup := authGroup.Group("/register")
+	registerGroup.Use(iammw.IdempotencyMiddleware(nil))
+	registerGroup.POST("", ar.register)
+
 	authGroup.POST("/login", ar.login)
+
+	// 两步验证第二步（匿名可访问，凭挑战令牌提交验证码，需限流）
+	twoFactorGroup := authGroup.Group("/login/2fa")
+	twoFactorGroup.Use(httpmw.RateLimit(httpmw.RateLimitConfig{Config: twoFactorRateLimit}))
+	twoFactorGroup.POST("", ar.loginTwoFactor)
+
+	// 应急管理员登录（默认关闭，需配置 AUTH_BREAK_GLASS_CREDENTIAL；严格限流）
+	breakGlassGroup := authGroup.Group("/break-glass")
+	breakGlassGroup.Use(httpmw.RateLimit(httpmw.RateLimitConfig{Config: breakGlassRateLimit}))
+	breakGlassGroup.POST("", ar.breakGlassLogin)
+
 	authGroup.POST("/logout", ar.logout)
 	authGroup.POST("/refresh", ar.refreshToken)
 	authGroup.POST("/forgot-password", ar.forgotPassword)
 	authGroup.POST("/reset-password", ar.resetPassword)
+	authGroup.POST("/verify-email", ar.verifyEmail)
+
+	// 当前请求的认证上下文（来自 token claims，而非数据库实时状态，便于排查过期快照）
+	whoamiGroup := authGroup.Group("/whoami")
+	whoamiGroup.Use(iammw.UserOnlyMiddleware())
+	whoamiGroup.GET("", ar.whoami)
+
+	// 当前用户的实时身份快照（按数据库最新 RBAC 计算，角色变更后无需重新登录即可刷新）
+	meGroup := authGroup.Group("/me")
+	meGroup.Use(iammw.UserOnlyMiddleware())
+	meGroup.GET("", ar.me)
+
+	// 注册前的用户名/邮箱可用性检查（匿名可访问，需限流）
+	availabilityGroup := authGroup.Group("/availability")
+	availabilityGroup.Use(httpmw.RateLimit(httpmw.RateLimitConfig{Config: availabilityRateLimit}))
+	availabilityGroup.GET("", ar.checkAvailability)
 	return nil
 }
 
@@ -57,7 +134,7 @@ func (ar *AuthRoutes) GetPriority() int {
 
 // 认证处理器方法
 func (ar *AuthRoutes) register(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	req := &iamsvc.RegisterRequest{}
 
 	if err := ctx.BindJSON(req); err != nil {
@@ -71,14 +148,32 @@ func (ar *AuthRoutes) register(ctx httpx.IContext) error {
 
 	if user != nil {
 		user.Password = ""
+		if user.IsPending() && iamsvc.RequireEmailVerification() {
+			ar.sendEmailVerification(reqCtx, user.GetID(), user.Email)
+		}
 	}
 
-	ar.utils.WriteSuccessResponse(ctx, user)
-	return nil
+	return iammw.WriteIdempotentSuccess(ctx, user)
+}
+
+// sendEmailVerification 生成并投递邮箱验证令牌（失败仅记录日志，不影响注册结果）
+func (ar *AuthRoutes) sendEmailVerification(reqCtx context.Context, userID int64, email string) {
+	token, err := ar.userService.GenerateEmailVerificationToken(reqCtx, userID)
+	if err != nil {
+		ar.logger.Warn(reqCtx, "[AuthRoutes] 生成邮箱验证令牌失败", logging.Error(err), logging.Int64("user_id", userID))
+		return
+	}
+	if ar.emailVerificationNotifier == nil {
+		ar.logger.Warn(reqCtx, "[AuthRoutes] 未配置邮箱验证令牌投递方式")
+		return
+	}
+	if err := ar.emailVerificationNotifier(reqCtx, email, token); err != nil {
+		ar.logger.Warn(reqCtx, "[AuthRoutes] 投递邮箱验证令牌失败", logging.Error(err), logging.Int64("user_id", userID))
+	}
 }
 
 func (ar *AuthRoutes) login(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	req := &iamsvc.AuthenticateRequest{}
 
 	if err := ctx.BindJSON(req); err != nil {
@@ -90,35 +185,200 @@ func (ar *AuthRoutes) login(ctx httpx.IContext) error {
 		return err
 	}
 
-	// 基于用户信息生成 JWT，携带角色与权限声明
-	token, err := iammw.GenerateTokenWithTTL(authResult.UserID, authResult.Username, authResult.Roles, authResult.Permissions, ar.authConfig.SecretKey, ar.authConfig.AccessTokenTTL)
+	// 已启用两步验证：仅签发挑战令牌，由 /auth/login/2fa 完成登录
+	if authResult.TwoFactorRequired {
+		mfaToken, err := iammw.GenerateMFAToken(authResult.UserID, authResult.Username, ar.authConfig.SecretKey, 0)
+		if err != nil {
+			return err
+		}
+		ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+			"two_factor_required": true,
+			"mfa_token":           mfaToken,
+		})
+		return nil
+	}
+
+	return ar.writeLoginResponse(ctx, authResult)
+}
+
+func (ar *AuthRoutes) loginTwoFactor(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	claims, err := iammw.ParseMFAToken(req.MFAToken, ar.authConfig.SecretKey)
+	if err != nil {
+		return err
+	}
+	if iammw.IsTokenRevoked(claims) {
+		return errorx.New(errorx.Unauthorized, "token 已失效")
+	}
+	// 挑战令牌一次性使用：校验验证码前原子地吊销其 jti，并发提交只有一个能继续；
+	// 验证码错误时令牌同样作废，需重新登录获取新的挑战令牌
+	if err := iammw.ConsumeToken(claims); err != nil {
+		return err
+	}
+
+	authResult, err := ar.userService.CompleteTwoFactorLogin(reqCtx, claims.UserID, req.Code)
+	if err != nil {
+		return err
+	}
+	return ar.writeLoginResponse(ctx, authResult)
+}
+
+// writeLoginResponse 签发访问令牌与刷新令牌并写出登录响应
+func (ar *AuthRoutes) writeLoginResponse(ctx httpx.IContext, authResult *iamsvc.AuthenticateResult) error {
+	// 基于用户信息生成 JWT，携带角色、权限与租户声明
+	token, err := iammw.GenerateTenantTokenWithTTL(authResult.UserID, authResult.Username, authResult.TenantID, authResult.Roles, authResult.Permissions, ar.authConfig.SecretKey, ar.authConfig.AccessTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	refreshToken, err := iammw.GenerateRefreshToken(authResult.UserID, authResult.Username, ar.authConfig.SecretKey, ar.authConfig.RefreshTokenTTL)
 	if err != nil {
 		return err
 	}
 
+	// 登记会话并执行并发会话上限（超限且策略为 reject 时不下发令牌）
+	client := iammw.SessionClient{UserAgent: ctx.GetHeader("User-Agent"), IP: ctx.ClientIP()}
+	if err := iammw.StartSession(token, refreshToken, client, ar.authConfig); err != nil {
+		return err
+	}
+
 	// 注意：HTTP 层返回 token/expires_at；service 层不包含 token 语义。
 	type loginResponse struct {
-		UserID      int64     `json:"user_id"`
-		Username    string    `json:"username"`
-		Email       string    `json:"email"`
-		Token       string    `json:"token"`
-		ExpiresAt   time.Time `json:"expires_at"`
-		Permissions []string  `json:"permissions"`
+		UserID           int64     `json:"user_id"`
+		Username         string    `json:"username"`
+		Email            string    `json:"email"`
+		Token            string    `json:"token"`
+		ExpiresAt        time.Time `json:"expires_at"`
+		RefreshToken     string    `json:"refresh_token"`
+		RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+		Permissions      []string  `json:"permissions"`
+		// 本次与上一次登录时间（首次登录时 previous_login_at 为空）
+		LastLoginAt     *time.Time `json:"last_login_at,omitempty"`
+		PreviousLoginAt *time.Time `json:"previous_login_at,omitempty"`
 	}
+	now := time.Now()
 	resp := &loginResponse{
-		UserID:      authResult.UserID,
-		Username:    authResult.Username,
-		Email:       authResult.Email,
-		Token:       token,
-		ExpiresAt:   time.Now().Add(ar.authConfig.AccessTokenTTL),
-		Permissions: authResult.Permissions,
+		UserID:           authResult.UserID,
+		Username:         authResult.Username,
+		Email:            authResult.Email,
+		Token:            token,
+		ExpiresAt:        now.Add(ar.authConfig.AccessTokenTTL),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: now.Add(ar.authConfig.RefreshTokenTTL),
+		Permissions:      authResult.Permissions,
+		LastLoginAt:      authResult.LastLoginAt,
+		PreviousLoginAt:  authResult.PreviousLoginAt,
+	}
+
+	ar.utils.WriteSuccessResponse(ctx, resp)
+	return nil
+}
+
+func (ar *AuthRoutes) checkAvailability(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	username := strings.TrimSpace(ctx.GetQuery("username"))
+	email := strings.TrimSpace(ctx.GetQuery("email"))
+	if username == "" && email == "" {
+		return errorx.New(errorx.Validation, "username 或 email 至少提供一个")
 	}
 
+	usernameAvailable, emailAvailable, err := ar.userService.CheckAvailability(reqCtx, username, email)
+	if err != nil {
+		return err
+	}
+
+	// 仅返回调用方查询的字段
+	resp := map[string]interface{}{}
+	if username != "" {
+		resp["username_available"] = usernameAvailable
+	}
+	if email != "" {
+		resp["email_available"] = emailAvailable
+	}
 	ar.utils.WriteSuccessResponse(ctx, resp)
 	return nil
 }
 
+// breakGlassLogin 应急管理员登录：凭一次性应急凭据换取短期 system_admin token（始终审计）
+func (ar *AuthRoutes) breakGlassLogin(ctx httpx.IContext) error {
+	var req struct {
+		Credential string `json:"credential" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	token, expiresAt, err := iammw.BreakGlassLogin(ctx, req.Credential, ar.authConfig)
+	if err != nil {
+		return err
+	}
+
+	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+	return nil
+}
+
+// logout 登出：吊销当前访问令牌（以及请求体中可选的 refresh_token）
+//
+// 未携带 jti 的历史 token 无法单独吊销，退化为吊销该用户全部已签发 token。
 func (ar *AuthRoutes) logout(ctx httpx.IContext) error {
+	// 1) 解析当前访问令牌
+	token := iammw.ExtractToken(ctx, ar.authConfig)
+	if token == "" {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+	claims, err := iammw.ParseToken(token, ar.authConfig.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	// 2) 可选：同时吊销刷新令牌，避免登出后仍可换取新访问令牌
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if body, err := ctx.GetBody(); err == nil && len(bytes.TrimSpace(body)) > 0 {
+		if err := ctx.BindJSON(&req); err != nil {
+			return err
+		}
+	}
+	var refreshClaims *iammw.JWTClaims
+	if req.RefreshToken != "" {
+		refreshClaims, err = iammw.ParseRefreshToken(req.RefreshToken, ar.authConfig.SecretKey)
+		if err != nil {
+			return err
+		}
+		if refreshClaims.UserID != claims.UserID {
+			return errorx.New(errorx.Forbidden, "refresh_token 与当前用户不匹配")
+		}
+	}
+
+	// 3) 吊销
+	for _, c := range []*iammw.JWTClaims{claims, refreshClaims} {
+		if c == nil {
+			continue
+		}
+		if c.ID == "" {
+			iammw.RevokeUserTokens(c.UserID)
+			continue
+		}
+		if err := iammw.RevokeToken(c); err != nil {
+			return err
+		}
+	}
+	if refreshClaims != nil {
+		iammw.EndSession(refreshClaims.UserID, refreshClaims.ID)
+	}
+
 	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
 		"message": "logged_out",
 	})
@@ -127,40 +387,102 @@ func (ar *AuthRoutes) logout(ctx httpx.IContext) error {
 
 func (ar *AuthRoutes) refreshToken(ctx httpx.IContext) error {
 	var req struct {
-		Token string `json:"token" binding:"required"`
+		RefreshToken string `json:"refresh_token" binding:"required"`
 	}
 	if err := ctx.BindJSON(&req); err != nil {
 		return err
 	}
-	if req.Token == "" {
-		err := errorx.New(errorx.Validation, "token is required")
+	if req.RefreshToken == "" {
+		err := errorx.New(errorx.Validation, "refresh_token is required")
 		return err
 	}
 
-	// 1) 验证旧 token
-	claims, err := iammw.ParseToken(req.Token, ar.authConfig.SecretKey)
+	// 1) 验证刷新令牌（访问令牌不可用于刷新）
+	claims, err := iammw.ParseRefreshToken(req.RefreshToken, ar.authConfig.SecretKey)
 	if err != nil {
 		return err
 	}
+	if iammw.IsTokenRevoked(claims) {
+		return errorx.New(errorx.Unauthorized, "token 已失效")
+	}
 
 	// 2) 重新从数据源获取最新有效 RBAC（过滤软删/非激活角色，避免沿用旧 token 快照）
-	authSnapshot, err := ar.userService.GetAuthSnapshot(ctx.GetRequest().Context(), claims.UserID)
+	authSnapshot, err := ar.userService.GetAuthSnapshot(ctx.GetContext(), claims.UserID)
 	if err != nil {
 		return err
 	}
 
-	newToken, err := iammw.GenerateTokenWithTTL(authSnapshot.UserID, authSnapshot.Username, authSnapshot.Roles, authSnapshot.Permissions, ar.authConfig.SecretKey, ar.authConfig.AccessTokenTTL)
+	newToken, err := iammw.GenerateTenantTokenWithTTL(authSnapshot.UserID, authSnapshot.Username, authSnapshot.TenantID, authSnapshot.Roles, authSnapshot.Permissions, ar.authConfig.SecretKey, ar.authConfig.AccessTokenTTL)
 	if err != nil {
 		return err
 	}
+	iammw.UpdateSessionAccessToken(claims, newToken, ar.authConfig)
 
 	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
-		"token": newToken,
+		"token":      newToken,
+		"expires_at": time.Now().Add(ar.authConfig.AccessTokenTTL),
+	})
+	return nil
+}
+
+// whoami 返回认证中间件从 token 解析出的用户 ID、角色、权限与租户（不含任何密钥或令牌）
+func (ar *AuthRoutes) whoami(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := reqCtx.GetUserID()
+	if userID == 0 {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+
+	roles := iammw.GetRoles(reqCtx)
+	if roles == nil {
+		roles = []string{}
+	}
+	permissions := iammw.GetPermissions(reqCtx)
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"user_id":     userID,
+		"roles":       roles,
+		"permissions": permissions,
+		"tenant_id":   reqCtx.GetTenantID(),
+	})
+	return nil
+}
+
+// me 返回当前用户的实时身份快照（基本资料 + 最新角色/权限）；用户已被禁用时返回 Forbidden
+func (ar *AuthRoutes) me(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := reqCtx.GetUserID()
+	if userID == 0 {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+
+	snapshot, err := ar.userService.GetAuthSnapshot(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+	if snapshot.Roles == nil {
+		snapshot.Roles = []string{}
+	}
+	if snapshot.Permissions == nil {
+		snapshot.Permissions = []string{}
+	}
+
+	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"user_id":     snapshot.UserID,
+		"username":    snapshot.Username,
+		"email":       snapshot.Email,
+		"roles":       snapshot.Roles,
+		"permissions": snapshot.Permissions,
+		"tenant_id":   reqCtx.GetTenantID(),
 	})
 	return nil
 }
 
 func (ar *AuthRoutes) forgotPassword(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
 	var req struct {
 		Email string `json:"email" binding:"required,email"`
 	}
@@ -168,6 +490,20 @@ func (ar *AuthRoutes) forgotPassword(ctx httpx.IContext) error {
 		return err
 	}
 
+	// 无论邮箱是否存在、投递是否成功均返回相同提示，避免用户枚举
+	token, err := ar.userService.CreatePasswordResetToken(reqCtx, req.Email)
+	switch {
+	case err == nil:
+		if ar.passwordResetNotifier == nil {
+			ar.logger.Warn(reqCtx, "[AuthRoutes] 未配置密码重置令牌投递方式")
+		} else if err := ar.passwordResetNotifier(reqCtx, req.Email, token); err != nil {
+			ar.logger.Warn(reqCtx, "[AuthRoutes] 投递密码重置令牌失败", logging.Error(err))
+		}
+	case errorx.Is(err, errorx.NotFound):
+	default:
+		ar.logger.Warn(reqCtx, "[AuthRoutes] 生成密码重置令牌失败", logging.Error(err))
+	}
+
 	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
 		"message": "If the email exists, reset instructions have been sent.",
 	})
@@ -175,16 +511,42 @@ func (ar *AuthRoutes) forgotPassword(ctx httpx.IContext) error {
 }
 
 func (ar *AuthRoutes) resetPassword(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
 	var req struct {
 		Token       string `json:"token" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required,min=6"`
+		NewPassword string `json:"new_password" binding:"required"` // 长度规则见 PasswordMinLength
 	}
 	if err := ctx.BindJSON(&req); err != nil {
 		return err
 	}
 
+	if err := ar.userService.ResetPassword(reqCtx, req.Token, req.NewPassword); err != nil {
+		return err
+	}
+
+	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"message": "Password has been reset.",
+	})
+	return nil
+}
+
+func (ar *AuthRoutes) verifyEmail(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	user, err := ar.userService.VerifyEmail(reqCtx, req.Token)
+	if err != nil {
+		return err
+	}
+
 	ar.utils.WriteSuccessResponse(ctx, map[string]interface{}{
-		"message": "Password reset request accepted.",
+		"user_id": user.GetID(),
+		"status":  user.Status,
 	})
 	return nil
 }
@@ -0,0 +1,104 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	iamentity "gochen-iam/entity"
+	iammw "gochen-iam/middleware"
+	grouprepo "gochen-iam/repo/group"
+	rolerepo "gochen-iam/repo/role"
+	userrepo "gochen-iam/repo/user"
+	usersvc "gochen-iam/service/user"
+	"gochen/httpx/nethttp"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupRouterTestUserService 基于 sqlite 构建真实的用户服务
+func setupRouterTestUserService(t *testing.T) (*usersvc.UserService, *gorm.DB) {
+	t.Helper()
+
+	// 隔离 token 吊销状态（按用户 ID 记录，避免跨用例串扰）
+	iammw.SetDefaultTokenRevoker(iammw.NewMemoryTokenRevoker())
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "router_test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&iamentity.User{},
+		&iamentity.Group{},
+		&iamentity.Role{},
+		&iamentity.UserGroup{},
+		&iamentity.UserRoleAssignment{},
+		&iamentity.RolePermissionEvent{},
+		&iamentity.PasswordHistory{},
+	); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+
+	ormAdapter := newRouterTestOrm(db)
+	userRepo, err := userrepo.NewUserRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewUserRepository: %v", err)
+	}
+	groupRepo, err := grouprepo.NewGroupRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewGroupRepository: %v", err)
+	}
+	roleRepo, err := rolerepo.NewRoleRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewRoleRepository: %v", err)
+	}
+	return usersvc.NewUserService(userRepo, groupRepo, roleRepo, nil, nil), db
+}
+
+func TestAuthRoutes_RegisterIdempotencyKeyReplaysResponse(t *testing.T) {
+	userService, db := setupRouterTestUserService(t)
+	ar := NewAuthRoutes(userService, nil, nil)
+	mw := iammw.IdempotencyMiddleware(&iammw.IdempotencyConfig{Store: iammw.NewMemoryIdempotencyStore()})
+
+	body := []byte(`{"username":"idem_user","email":"idem@example.com","password":"password123"}`)
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", bytes.NewReader(body)).WithContext(context.Background())
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(iammw.IdempotencyKeyHeader, "register-key-1")
+		rec := httptest.NewRecorder()
+
+		ctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		if err := mw(ctx, func() error { return ar.register(ctx) }); err != nil {
+			t.Fatalf("register failed: %v", err)
+		}
+		return rec
+	}
+
+	first := call()
+	second := call()
+
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("unexpected status: first=%d second=%d", first.Code, second.Code)
+	}
+	if !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) {
+		t.Fatalf("replayed body mismatch:\nfirst=%s\nsecond=%s", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get(iammw.IdempotentReplayedHeader) != "true" {
+		t.Fatalf("expected replay header on second response")
+	}
+
+	var count int64
+	if err := db.Model(&iamentity.User{}).Where("username = ?", "idem_user").Count(&count).Error; err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected exactly 1 user, got %d", count)
+	}
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuthRoutes_LogoutRevokesTokens(t *testing.T) {
+	userService, _ := setupRouterTestUserService(t)
+	ar := NewAuthRoutes(userService, nil, nil)
+	ar.authConfig.SecretKey = "router-logout-secret"
+
+	user, err := userService.Register(context.Background(), &svc.RegisterRequest{
+		Username: "logout_user",
+		Email:    "logout@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	issue := func() (string, string) {
+		access, err := iammw.GenerateToken(user.GetID(), user.Username, nil, nil, ar.authConfig.SecretKey)
+		if err != nil {
+			t.Fatalf("GenerateToken failed: %v", err)
+		}
+		refresh, err := iammw.GenerateRefreshToken(user.GetID(), user.Username, ar.authConfig.SecretKey, 0)
+		if err != nil {
+			t.Fatalf("GenerateRefreshToken failed: %v", err)
+		}
+		return access, refresh
+	}
+	logout := func(accessToken string, body any) error {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		ctx, err := nethttp.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		return ar.logout(ctx)
+	}
+	parse := func(token string) *iammw.JWTClaims {
+		claims, err := iammw.ParseToken(token, ar.authConfig.SecretKey)
+		if err != nil {
+			t.Fatalf("ParseToken failed: %v", err)
+		}
+		return claims
+	}
+
+	// 未携带 token
+	if err := logout("", nil); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized without token, got %v", err)
+	}
+
+	// 仅吊销当前访问令牌
+	access, refresh := issue()
+	other, _ := issue()
+	if err := logout(access, nil); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if !iammw.IsTokenRevoked(parse(access)) {
+		t.Fatal("expected access token revoked after logout")
+	}
+	if iammw.IsTokenRevoked(parse(other)) {
+		t.Fatal("expected other session unaffected")
+	}
+	if _, err := iammw.RefreshToken(refresh, ar.authConfig.SecretKey); err != nil {
+		t.Fatalf("expected refresh token still valid, got %v", err)
+	}
+
+	// 同时吊销刷新令牌
+	access, refresh = issue()
+	if err := logout(access, map[string]string{"refresh_token": refresh}); err != nil {
+		t.Fatalf("logout failed: %v", err)
+	}
+	if _, err := iammw.RefreshToken(refresh, ar.authConfig.SecretKey); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected revoked refresh token rejected, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	iamentity "gochen-iam/entity"
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuthRoutes_MeReflectsLiveRoles(t *testing.T) {
+	// AuthMiddleware 在严格权限字典未加载时 fail-close
+	iammw.RegisterRequiredPermissions("report:read")
+
+	userService, db := setupRouterTestUserService(t)
+	ar := NewAuthRoutes(userService, nil, nil)
+	ar.authConfig.SecretKey = "router-me-secret"
+	authMW := iammw.AuthMiddleware(ar.authConfig)
+
+	user, err := userService.Register(context.Background(), &svc.RegisterRequest{
+		Username: "me_user",
+		Email:    "me@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	// 签发时用户尚无任何角色
+	token, err := iammw.GenerateToken(user.GetID(), user.Username, nil, nil, ar.authConfig.SecretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+
+	type identity struct {
+		UserID      int64    `json:"user_id"`
+		Username    string   `json:"username"`
+		Email       string   `json:"email"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+	call := func(path string, handler func(ctx *nethttp.Context) error) (identity, error) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		ctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		var resp struct {
+			Data identity `json:"data"`
+		}
+		if err := authMW(ctx, func() error { return handler(ctx) }); err != nil {
+			return resp.Data, err
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+		}
+		return resp.Data, nil
+	}
+	me := func() (identity, error) {
+		return call("/api/v1/auth/me", func(ctx *nethttp.Context) error { return ar.me(ctx) })
+	}
+
+	// 分配新角色后：/auth/me 立即反映，而旧 token（whoami）不变
+	role := &iamentity.Role{Name: "reporter", Status: "active", Permissions: []string{"report:read"}}
+	if err := db.Create(role).Error; err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	if err := userService.AssignRole(context.Background(), user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+
+	got, err := me()
+	if err != nil {
+		t.Fatalf("GET /auth/me: %v", err)
+	}
+	if got.UserID != user.GetID() || got.Username != "me_user" || got.Email != "me@example.com" {
+		t.Fatalf("unexpected profile: %+v", got)
+	}
+	if strings.Join(got.Roles, ",") != "reporter" || strings.Join(got.Permissions, ",") != "report:read" {
+		t.Fatalf("expected live roles/permissions, got %+v", got)
+	}
+
+	stale, err := call("/api/v1/auth/whoami", func(ctx *nethttp.Context) error { return ar.whoami(ctx) })
+	if err != nil {
+		t.Fatalf("GET /auth/whoami: %v", err)
+	}
+	if len(stale.Roles) != 0 || len(stale.Permissions) != 0 {
+		t.Fatalf("expected token claims unchanged, got %+v", stale)
+	}
+
+	// 用户被禁用后返回 Forbidden
+	if err := userService.DeactivateUser(context.Background(), user.GetID()); err != nil {
+		t.Fatalf("DeactivateUser failed: %v", err)
+	}
+	if _, err := me(); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for deactivated user, got %v", err)
+	}
+}
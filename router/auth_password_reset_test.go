@@ -0,0 +1,80 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/httpx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuthRoutes_PasswordResetFlow(t *testing.T) {
+	t.Setenv("AUTH_SECRET", "router-reset-secret")
+	userService, _ := setupRouterTestUserService(t)
+	ar := NewAuthRoutes(userService, nil, nil)
+
+	// 重置成功会吊销该用户 ID 的 token（进程级状态）；先注册占位用户，避免与其他用例的用户 ID 冲突
+	if _, err := userService.Register(context.Background(), &svc.RegisterRequest{
+		Username: "placeholder_user",
+		Email:    "placeholder@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := userService.Register(context.Background(), &svc.RegisterRequest{
+		Username: "forgot_user",
+		Email:    "forgot@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	delivered := map[string]string{}
+	ar.SetPasswordResetNotifier(func(ctx context.Context, email, token string) error {
+		delivered[email] = token
+		return nil
+	})
+
+	call := func(handler httpx.Handler, path string, payload any) (*httptest.ResponseRecorder, error) {
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		ctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		return rec, handler(ctx)
+	}
+
+	// 未知邮箱与已知邮箱返回相同响应（避免用户枚举）
+	unknown, err := call(ar.forgotPassword, "/api/v1/auth/forgot-password", map[string]string{"email": "missing@example.com"})
+	if err != nil {
+		t.Fatalf("forgotPassword(unknown) failed: %v", err)
+	}
+	known, err := call(ar.forgotPassword, "/api/v1/auth/forgot-password", map[string]string{"email": "forgot@example.com"})
+	if err != nil {
+		t.Fatalf("forgotPassword(known) failed: %v", err)
+	}
+	if !bytes.Equal(unknown.Body.Bytes(), known.Body.Bytes()) {
+		t.Fatalf("expected identical responses, got %s vs %s", unknown.Body.String(), known.Body.String())
+	}
+	if _, ok := delivered["missing@example.com"]; ok || len(delivered) != 1 {
+		t.Fatalf("unexpected deliveries: %v", delivered)
+	}
+
+	token := delivered["forgot@example.com"]
+	if _, err := call(ar.resetPassword, "/api/v1/auth/reset-password", map[string]string{"token": token, "new_password": "resetpassword123"}); err != nil {
+		t.Fatalf("resetPassword failed: %v", err)
+	}
+	_, err = call(ar.resetPassword, "/api/v1/auth/reset-password", map[string]string{"token": token, "new_password": "resetpassword456"})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for reused token, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuthRoutes_RefreshRequiresRefreshToken(t *testing.T) {
+	userService, _ := setupRouterTestUserService(t)
+	ar := NewAuthRoutes(userService, nil, nil)
+	ar.authConfig.SecretKey = "router-refresh-secret"
+
+	user, err := userService.Register(context.Background(), &svc.RegisterRequest{
+		Username: "refresh_user",
+		Email:    "refresh@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	call := func(token string) (*httptest.ResponseRecorder, error) {
+		body, _ := json.Marshal(map[string]string{"refresh_token": token})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		ctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		return rec, ar.refreshToken(ctx)
+	}
+
+	accessToken, err := iammw.GenerateToken(user.GetID(), user.Username, nil, nil, ar.authConfig.SecretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	if _, err := call(accessToken); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized for access token, got %v", err)
+	}
+
+	refreshToken, err := iammw.GenerateRefreshToken(user.GetID(), user.Username, ar.authConfig.SecretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+	rec, err := call(refreshToken)
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	var resp struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	claims, err := iammw.ParseToken(resp.Data.Token, ar.authConfig.SecretKey)
+	if err != nil {
+		t.Fatalf("expected fresh access token, got %v", err)
+	}
+	if claims.UserID != user.GetID() || claims.TokenType != iammw.TokenTypeAccess {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+}
@@ -0,0 +1,19 @@
+package router
+
+import "testing"
+
+func TestAuthRoutes_AvailabilityRoute(t *testing.T) {
+	routes := map[string]struct{}{}
+	root := newRecordingGroup("", routes)
+
+	ar := NewAuthRoutes(nil, nil, nil)
+	if err := ar.RegisterRoutes(root); err != nil {
+		t.Fatalf("RegisterRoutes failed: %v", err)
+	}
+
+	for _, want := range []string{"GET /auth/availability", "POST /auth/break-glass", "GET /auth/whoami", "GET /auth/me"} {
+		if _, ok := routes[want]; !ok {
+			t.Fatalf("missing route: %s", want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	usersvc "gochen-iam/service/user"
+	"gochen/errorx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuthRoutes_LoginTwoFactorConsumesMFAToken(t *testing.T) {
+	t.Setenv("AUTH_SECRET", "router-2fa-secret")
+	userService, _ := setupRouterTestUserService(t)
+	ar := NewAuthRoutes(userService, nil, nil)
+	ar.authConfig.SecretKey = "router-2fa-secret"
+	ctx := context.Background()
+
+	user, err := userService.Register(ctx, &svc.RegisterRequest{
+		Username: "mfa_user",
+		Email:    "mfa@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	setup, err := userService.EnableTOTP(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("EnableTOTP failed: %v", err)
+	}
+	codeAt := func(offset time.Duration) string {
+		code, err := usersvc.GenerateTOTPCode(setup.Secret, time.Now().Add(offset))
+		if err != nil {
+			t.Fatalf("GenerateTOTPCode failed: %v", err)
+		}
+		return code
+	}
+	if err := userService.ConfirmTOTP(ctx, user.GetID(), codeAt(-30*time.Second)); err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+
+	mfaToken, err := iammw.GenerateMFAToken(user.GetID(), user.Username, ar.authConfig.SecretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken failed: %v", err)
+	}
+	loginTwoFactor := func(mfaToken, code string) error {
+		data, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "code": code})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login/2fa", bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		reqCtx, err := nethttp.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		return ar.loginTwoFactor(reqCtx)
+	}
+
+	if err := loginTwoFactor(mfaToken, codeAt(0)); err != nil {
+		t.Fatalf("loginTwoFactor failed: %v", err)
+	}
+	// 同一挑战令牌不能再次使用（即使验证码有效且未使用过）
+	if err := loginTwoFactor(mfaToken, codeAt(30*time.Second)); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized reusing mfa_token, got %v", err)
+	}
+
+	// 验证码错误同样作废挑战令牌，需重新获取
+	retryToken, err := iammw.GenerateMFAToken(user.GetID(), user.Username, ar.authConfig.SecretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken failed: %v", err)
+	}
+	if err := loginTwoFactor(retryToken, "000000"); err == nil || errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected wrong code rejected, got %v", err)
+	}
+	if err := loginTwoFactor(retryToken, codeAt(30*time.Second)); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized after failed attempt, got %v", err)
+	}
+}
+
+func TestConsumeTokenIsSingleUse(t *testing.T) {
+	iammw.SetDefaultTokenRevoker(iammw.NewMemoryTokenRevoker())
+	defer iammw.SetDefaultTokenRevoker(nil)
+
+	mfaToken, err := iammw.GenerateMFAToken(1, "consume_user", "consume-secret", 0)
+	if err != nil {
+		t.Fatalf("GenerateMFAToken failed: %v", err)
+	}
+	claims, err := iammw.ParseMFAToken(mfaToken, "consume-secret")
+	if err != nil {
+		t.Fatalf("ParseMFAToken failed: %v", err)
+	}
+
+	// 并发提交同一挑战令牌只有一个成功
+	const attempts = 20
+	var wg sync.WaitGroup
+	var consumed atomic.Int32
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if iammw.ConsumeToken(claims) == nil {
+				consumed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if consumed.Load() != 1 {
+		t.Fatalf("expected exactly one consume to succeed, got %d", consumed.Load())
+	}
+	if !iammw.IsTokenRevoked(claims) {
+		t.Fatal("expected consumed token revoked")
+	}
+}
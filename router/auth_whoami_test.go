@@ -0,0 +1,78 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	iammw "gochen-iam/middleware"
+	"gochen/errorx"
+	"gochen/httpx"
+	"gochen/httpx/nethttp"
+)
+
+func TestAuthRoutes_WhoamiReflectsTokenClaims(t *testing.T) {
+	// AuthMiddleware 在严格权限字典未加载时 fail-close
+	iammw.RegisterRequiredPermissions("user:read")
+
+	ar := NewAuthRoutes(nil, nil, nil)
+	ar.authConfig.SecretKey = "router-whoami-secret"
+	authMW := iammw.AuthMiddleware(ar.authConfig)
+
+	call := func(token, tenantID string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/whoami", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if tenantID != "" {
+			req.Header.Set(httpx.HeaderTenantID, tenantID)
+		}
+		rec := httptest.NewRecorder()
+		ctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		return rec, authMW(ctx, func() error { return ar.whoami(ctx) })
+	}
+
+	// 未携带 token
+	if _, err := call("", ""); !errorx.Is(err, errorx.Unauthorized) {
+		t.Fatalf("expected Unauthorized without token, got %v", err)
+	}
+
+	// 返回 token 中注入的角色/权限（而非数据库实时状态）与令牌声明的租户
+	token, err := iammw.GenerateTenantTokenWithTTL(9001, "whoami_user", "tenant-a", []string{"auditor", "user"}, []string{"audit:read", "user:read"}, ar.authConfig.SecretKey, 0)
+	if err != nil {
+		t.Fatalf("GenerateTenantTokenWithTTL failed: %v", err)
+	}
+	rec, err := call(token, "tenant-a")
+	if err != nil {
+		t.Fatalf("whoami failed: %v", err)
+	}
+
+	var resp struct {
+		Data struct {
+			UserID      int64    `json:"user_id"`
+			Roles       []string `json:"roles"`
+			Permissions []string `json:"permissions"`
+			TenantID    string   `json:"tenant_id"`
+			Token       string   `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	if resp.Data.UserID != 9001 || resp.Data.TenantID != "tenant-a" {
+		t.Fatalf("unexpected identity: %+v", resp.Data)
+	}
+	if len(resp.Data.Roles) != 2 || resp.Data.Roles[0] != "auditor" || resp.Data.Roles[1] != "user" {
+		t.Fatalf("unexpected roles: %v", resp.Data.Roles)
+	}
+	if len(resp.Data.Permissions) != 2 || resp.Data.Permissions[0] != "audit:read" || resp.Data.Permissions[1] != "user:read" {
+		t.Fatalf("unexpected permissions: %v", resp.Data.Permissions)
+	}
+	if resp.Data.Token != "" {
+		t.Fatal("expected no token echoed in whoami response")
+	}
+}
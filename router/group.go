@@ -1,7 +1,9 @@
 package router
 
 import (
+	"net/http"
 	"strconv"
+	"strings"
 
 	iammw "gochen-iam/middleware"
 	grouprepo "gochen-iam/repo/group"
@@ -96,17 +98,27 @@ func (gr *GroupRoutes) setupGroupCustomRoutes(groupGroup httpx.IRouteGroup) {
 	groupGroup.GET("/roots", gr.getRootGroups)
 	groupGroup.GET("/statistics", gr.getGroupStatistics)
 
-	// 按层级查询（使用查询参数而不是路径参数）
+	// 分页搜索（?keyword=&parent_id=&page=&page_size=）与按层级查询（使用查询参数而不是路径参数）
+	groupGroup.GET("/search", gr.searchGroups)
 	groupGroup.GET("/search/by-level", gr.getGroupsByLevel)
 
+	// 组织移动（调整父组织，子树层级/路径随之重算）
+	groupGroup.POST("/:id/move", gr.moveGroup)
+
+	// 组织层级查询：祖先链（根在前，面包屑）与全部后代（子树）
+	groupGroup.GET("/:id/ancestors", gr.getGroupAncestors)
+	groupGroup.GET("/:id/descendants", gr.getGroupDescendants)
+
 	// 组织成员管理（使用ID参数的路由）
 	groupGroup.GET("/:id/users", gr.getGroupUsers)
+	groupGroup.GET("/:id/users/effective-roles", gr.getGroupMembersEffectiveRoles)
 	groupGroup.POST("/:id/users", gr.addUserToGroup)
 	groupGroup.DELETE("/:id/users/:user", gr.removeUserFromGroup)
 	groupGroup.POST("/:id/users/batch", gr.batchAddUsersToGroup)
 
 	// 组织角色管理
 	groupGroup.GET("/:id/roles", gr.getGroupRoles)
+	groupGroup.GET("/:id/roles/history", gr.getGroupRoleHistory)
 	groupGroup.POST("/:id/roles", gr.addGroupRole)
 	groupGroup.DELETE("/:id/roles/:role", gr.removeGroupRole)
 }
@@ -116,8 +128,20 @@ func (gr *GroupRoutes) setupGroupCustomRoutes(groupGroup httpx.IRouteGroup) {
 // 以下只包含扩展功能的处理器
 
 // 组织树操作处理器
+//
+// 响应携带 ETag（组织树校验值）；客户端携带匹配的 If-None-Match 时返回 304。
 func (gr *GroupRoutes) getGroupTree(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
+
+	checksum, err := gr.groupService.GetTreeChecksum(reqCtx)
+	if err != nil {
+		return err
+	}
+	etag := `"` + checksum + `"`
+	ctx.SetHeader("ETag", etag)
+	if etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+		return ctx.Data(http.StatusNotModified, "", nil)
+	}
 
 	tree, err := gr.groupService.GetGroupTree(reqCtx)
 	if err != nil {
@@ -129,7 +153,7 @@ func (gr *GroupRoutes) getGroupTree(ctx httpx.IContext) error {
 }
 
 func (gr *GroupRoutes) getRootGroups(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 
 	groups, err := gr.groupService.GetRootGroups(reqCtx)
 	if err != nil {
@@ -140,6 +164,37 @@ func (gr *GroupRoutes) getRootGroups(ctx httpx.IContext) error {
 	return nil
 }
 
+func (gr *GroupRoutes) searchGroups(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	page, pageSize, err := parsePagination(ctx)
+	if err != nil {
+		return err
+	}
+
+	var parentID *int64
+	if v := strings.TrimSpace(ctx.GetQuery("parent_id")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return errorx.New(errorx.Validation, "parent_id must be a positive integer")
+		}
+		parentID = &id
+	}
+
+	keyword := strings.TrimSpace(ctx.GetQuery("keyword"))
+	groups, total, err := gr.groupService.SearchGroupsPaged(reqCtx, keyword, parentID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return err
+	}
+
+	gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"items":     groups,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	return nil
+}
+
 func (gr *GroupRoutes) getGroupsByLevel(ctx httpx.IContext) error {
 	levelStr := ctx.GetQuery("level")
 	if levelStr == "" {
@@ -153,7 +208,7 @@ func (gr *GroupRoutes) getGroupsByLevel(ctx httpx.IContext) error {
 		return err
 	}
 
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groups, err := gr.groupService.GetGroupsByLevel(reqCtx, level)
 	if err != nil {
 		return err
@@ -168,12 +223,46 @@ func (gr *GroupRoutes) getGroupsByLevel(ctx httpx.IContext) error {
 
 // 组织成员管理处理器
 func (gr *GroupRoutes) getGroupUsers(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
 	}
 
+	// recursive=true 时包含所有后代组织的成员（按用户去重）
+	if recursive, _ := strconv.ParseBool(ctx.GetQuery("recursive")); recursive {
+		users, err := gr.groupService.GetGroupUsersRecursive(reqCtx, groupID)
+		if err != nil {
+			return err
+		}
+		gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+			"group_id":  groupID,
+			"recursive": true,
+			"users":     users,
+		})
+		return nil
+	}
+
+	// 携带 page/page_size 时在数据库侧分页，否则返回全部直接成员
+	if hasPaginationQuery(ctx) {
+		page, pageSize, err := parsePagination(ctx)
+		if err != nil {
+			return err
+		}
+		members, total, err := gr.groupService.GetGroupUsersPaged(reqCtx, groupID, (page-1)*pageSize, pageSize)
+		if err != nil {
+			return err
+		}
+		gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+			"group_id":  groupID,
+			"items":     members,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		})
+		return nil
+	}
+
 	users, err := gr.groupService.GetGroupUsers(reqCtx, groupID)
 	if err != nil {
 		return err
@@ -186,8 +275,34 @@ func (gr *GroupRoutes) getGroupUsers(ctx httpx.IContext) error {
 	return nil
 }
 
+func (gr *GroupRoutes) moveGroup(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	groupID, err := gr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ParentID *int64 `json:"parent_id"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+	if req.ParentID != nil && *req.ParentID <= 0 {
+		return errorx.New(errorx.Validation, "parent_id must be greater than 0")
+	}
+
+	group, err := gr.groupService.MoveGroup(reqCtx, groupID, req.ParentID)
+	if err != nil {
+		return err
+	}
+
+	gr.utils.WriteSuccessResponse(ctx, group)
+	return nil
+}
+
 func (gr *GroupRoutes) addUserToGroup(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -216,7 +331,7 @@ func (gr *GroupRoutes) addUserToGroup(ctx httpx.IContext) error {
 }
 
 func (gr *GroupRoutes) removeUserFromGroup(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -239,7 +354,7 @@ func (gr *GroupRoutes) removeUserFromGroup(ctx httpx.IContext) error {
 }
 
 func (gr *GroupRoutes) batchAddUsersToGroup(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -279,13 +394,18 @@ func (gr *GroupRoutes) batchAddUsersToGroup(ctx httpx.IContext) error {
 
 // 组织角色管理处理器
 func (gr *GroupRoutes) getGroupRoles(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
 	}
 
-	roles, err := gr.groupService.GetGroupRoles(reqCtx, groupID)
+	opts, err := parseListOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	roles, err := gr.groupService.GetGroupRoles(reqCtx, groupID, opts)
 	if err != nil {
 		return err
 	}
@@ -297,8 +417,85 @@ func (gr *GroupRoutes) getGroupRoles(ctx httpx.IContext) error {
 	return nil
 }
 
+func (gr *GroupRoutes) getGroupMembersEffectiveRoles(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	groupID, err := gr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	members, err := gr.groupService.GetMembersWithEffectiveRoles(reqCtx, groupID)
+	if err != nil {
+		return err
+	}
+
+	gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"group_id": groupID,
+		"members":  members,
+	})
+	return nil
+}
+
+func (gr *GroupRoutes) getGroupAncestors(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	groupID, err := gr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	ancestors, err := gr.groupService.GetGroupAncestors(reqCtx, groupID)
+	if err != nil {
+		return err
+	}
+
+	gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"group_id":  groupID,
+		"ancestors": ancestors,
+	})
+	return nil
+}
+
+func (gr *GroupRoutes) getGroupDescendants(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	groupID, err := gr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	descendants, err := gr.groupService.GetGroupDescendants(reqCtx, groupID)
+	if err != nil {
+		return err
+	}
+
+	gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"group_id":    groupID,
+		"descendants": descendants,
+	})
+	return nil
+}
+
+func (gr *GroupRoutes) getGroupRoleHistory(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	groupID, err := gr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	events, err := gr.groupService.GetGroupRoleHistory(reqCtx, groupID)
+	if err != nil {
+		return err
+	}
+
+	gr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"group_id": groupID,
+		"events":   events,
+	})
+	return nil
+}
+
 func (gr *GroupRoutes) addGroupRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	// 使用携带认证信息的请求上下文，便于审计记录操作者
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -327,7 +524,7 @@ func (gr *GroupRoutes) addGroupRole(ctx httpx.IContext) error {
 }
 
 func (gr *GroupRoutes) removeGroupRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	groupID, err := gr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -351,7 +548,7 @@ func (gr *GroupRoutes) removeGroupRole(ctx httpx.IContext) error {
 
 // 组织统计处理器
 func (gr *GroupRoutes) getGroupStatistics(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 
 	stats, err := gr.groupService.GetGroupStatistics(reqCtx)
 	if err != nil {
@@ -361,3 +558,21 @@ func (gr *GroupRoutes) getGroupStatistics(ctx httpx.IContext) error {
 	gr.utils.WriteSuccessResponse(ctx, stats)
 	return nil
 }
+
+// etagMatches 判断 If-None-Match 是否命中当前 ETag（支持多值、弱校验前缀与 *）
+func etagMatches(ifNoneMatch, etag string) bool {
+	ifNoneMatch = strings.TrimSpace(ifNoneMatch)
+	if ifNoneMatch == "" {
+		return false
+	}
+	if ifNoneMatch == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
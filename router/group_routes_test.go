@@ -0,0 +1,24 @@
+package router
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	etag := `"abc123"`
+	cases := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc123"`, true},
+		{`W/"abc123"`, true},
+		{`"other", "abc123"`, true},
+		{`"other"`, false},
+		{"*", true},
+		{"abc123", false},
+	}
+	for _, c := range cases {
+		if got := etagMatches(c.header, etag); got != c.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", c.header, got, c.want)
+		}
+	}
+}
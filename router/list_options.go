@@ -0,0 +1,83 @@
+package router
+
+import (
+	"strconv"
+	"strings"
+
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+const (
+	// defaultPageSize 分页查询默认每页条数
+	defaultPageSize = 10
+	// maxPageSize 分页查询每页最大条数（与 CRUD 列表一致）
+	maxPageSize = 1000
+)
+
+// parseListOptions 解析列表接口统一的可见性参数（?include_inactive=true&include_deleted=true，缺省均为 false）
+func parseListOptions(ctx httpx.IContext) (svc.ListOptions, error) {
+	var opts svc.ListOptions
+	var err error
+	if opts.IncludeInactive, err = parseBoolQuery(ctx, "include_inactive"); err != nil {
+		return opts, err
+	}
+	if opts.IncludeDeleted, err = parseBoolQuery(ctx, "include_deleted"); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// parseBoolQuery 解析布尔 query 参数（缺省为 false，非法值返回 Validation 错误）
+func parseBoolQuery(ctx httpx.IContext, key string) (bool, error) {
+	v := strings.TrimSpace(ctx.GetQuery(key))
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errorx.New(errorx.Validation, key+" must be a boolean")
+	}
+	return b, nil
+}
+
+// parseOptionalBoolQuery 解析可选布尔 query 参数（缺省返回 nil，非法值返回 Validation 错误）
+func parseOptionalBoolQuery(ctx httpx.IContext, key string) (*bool, error) {
+	if strings.TrimSpace(ctx.GetQuery(key)) == "" {
+		return nil, nil
+	}
+	b, err := parseBoolQuery(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// hasPaginationQuery 判断请求是否携带 page/page_size（用于兼容未分页的旧接口）
+func hasPaginationQuery(ctx httpx.IContext) bool {
+	return strings.TrimSpace(ctx.GetQuery("page")) != "" || strings.TrimSpace(ctx.GetQuery("page_size")) != ""
+}
+
+// parsePagination 解析 page/page_size 查询参数（page 从 1 开始，page_size 超过上限时截断）
+func parsePagination(ctx httpx.IContext) (int, int, error) {
+	page, pageSize := 1, defaultPageSize
+	if v := strings.TrimSpace(ctx.GetQuery("page")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, errorx.New(errorx.Validation, "page must be a positive integer")
+		}
+		page = n
+	}
+	if v := strings.TrimSpace(ctx.GetQuery("page_size")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, 0, errorx.New(errorx.Validation, "page_size must be a positive integer")
+		}
+		pageSize = n
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	return page, pageSize, nil
+}
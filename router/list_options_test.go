@@ -0,0 +1,35 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gochen/errorx"
+	hbasic "gochen/httpx/nethttp"
+)
+
+func TestParseListOptions(t *testing.T) {
+	parse := func(query string) (bool, bool, error) {
+		req := httptest.NewRequest(http.MethodGet, "/roles/list"+query, nil)
+		ctx, err := hbasic.NewBaseContext(httptest.NewRecorder(), req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		opts, err := parseListOptions(ctx)
+		return opts.IncludeInactive, opts.IncludeDeleted, err
+	}
+
+	if inactive, deleted, err := parse(""); err != nil || inactive || deleted {
+		t.Fatalf("expected exclude by default, got inactive=%v deleted=%v err=%v", inactive, deleted, err)
+	}
+	if inactive, deleted, err := parse("?include_inactive=true"); err != nil || !inactive || deleted {
+		t.Fatalf("unexpected result: inactive=%v deleted=%v err=%v", inactive, deleted, err)
+	}
+	if inactive, deleted, err := parse("?include_inactive=1&include_deleted=true"); err != nil || !inactive || !deleted {
+		t.Fatalf("unexpected result: inactive=%v deleted=%v err=%v", inactive, deleted, err)
+	}
+	if _, _, err := parse("?include_deleted=maybe"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for invalid flag, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	grouprepo "gochen-iam/repo/group"
+	rolerepo "gochen-iam/repo/role"
+	userrepo "gochen-iam/repo/user"
+	groupsvc "gochen-iam/service/group"
+	rolesvc "gochen-iam/service/role"
+	"gochen/httpx"
+	"gochen/httpx/nethttp"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// memberListResponse /roles/:id/users 与 /groups/:id/users 的响应
+type memberListResponse struct {
+	Data struct {
+		Users []map[string]any `json:"users"`
+		Items []map[string]any `json:"items"`
+		Total int64            `json:"total"`
+	} `json:"data"`
+}
+
+// callMemberList 以 :id 调用处理器，返回解码后的响应与原始响应体
+func callMemberList(t *testing.T, handler httpx.Handler, id int64, target string) (memberListResponse, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	ctx, err := nethttp.NewBaseContext(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if err != nil {
+		t.Fatalf("NewBaseContext: %v", err)
+	}
+	ctx.SetParam("id", strconv.FormatInt(id, 10))
+	if err := handler(ctx); err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+	var resp memberListResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	return resp, rec.Body.String()
+}
+
+func TestRoleAndGroupUserListsSanitizedAndPaged(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "router_members.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&iamentity.User{}, &iamentity.Group{}, &iamentity.Role{}, &iamentity.UserGroup{}, &iamentity.UserRoleAssignment{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	ormAdapter := newRouterTestOrm(db)
+	userRepo, err := userrepo.NewUserRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewUserRepository: %v", err)
+	}
+	groupRepo, err := grouprepo.NewGroupRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewGroupRepository: %v", err)
+	}
+	roleRepo, err := rolerepo.NewRoleRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewRoleRepository: %v", err)
+	}
+
+	role := &iamentity.Role{Name: "member", Status: "active"}
+	if err := db.Create(role).Error; err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+	group := &iamentity.Group{Name: "成员组织", Level: 1}
+	if err := db.Create(group).Error; err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		u := &iamentity.User{
+			Username:   "member" + strconv.Itoa(i),
+			Email:      "member" + strconv.Itoa(i) + "@example.com",
+			Password:   "$2a$10$secret-hash",
+			TOTPSecret: "totp-secret",
+			Status:     "active",
+		}
+		u.SyncCanonicalNames()
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		if err := db.Create(&iamentity.UserRoleAssignment{UserID: u.GetID(), RoleID: role.GetID()}).Error; err != nil {
+			t.Fatalf("assign role: %v", err)
+		}
+		if err := db.Create(&iamentity.UserGroup{UserID: u.GetID(), GroupID: group.GetID(), JoinedAt: &now}).Error; err != nil {
+			t.Fatalf("join group: %v", err)
+		}
+	}
+
+	roleRoutes := NewRoleRoutes(rolesvc.NewRoleService(roleRepo, userRepo, groupRepo, nil), nil, nil, roleRepo)
+	groupRoutes := NewGroupRoutes(groupsvc.NewGroupService(groupRepo, userRepo, roleRepo), nil, nil, groupRepo)
+
+	for _, c := range []struct {
+		name    string
+		handler httpx.Handler
+		id      int64
+		base    string
+	}{
+		{"role", roleRoutes.getRoleUsers, role.GetID(), "/roles/1/users"},
+		{"group", groupRoutes.getGroupUsers, group.GetID(), "/groups/1/users"},
+	} {
+		// 未分页：返回全部用户且不含密码哈希与 TOTP 密钥
+		resp, body := callMemberList(t, c.handler, c.id, c.base)
+		if len(resp.Data.Users) != 5 {
+			t.Fatalf("%s: expected 5 users, got %d", c.name, len(resp.Data.Users))
+		}
+		if strings.Contains(body, "secret-hash") || strings.Contains(body, "totp-secret") {
+			t.Fatalf("%s: response leaks secrets: %s", c.name, body)
+		}
+		for _, u := range resp.Data.Users {
+			if p, _ := u["password"].(string); p != "" {
+				t.Fatalf("%s: expected empty password, got %q", c.name, p)
+			}
+		}
+
+		// 分页边界：中间页、最后一页不足一页、超出范围为空
+		for _, p := range []struct {
+			query string
+			want  []string
+		}{
+			{"?page=1&page_size=2", []string{"member0", "member1"}},
+			{"?page=3&page_size=2", []string{"member4"}},
+			{"?page=4&page_size=2", nil},
+			{"?page_size=10", []string{"member0", "member1", "member2", "member3", "member4"}},
+		} {
+			resp, body := callMemberList(t, c.handler, c.id, c.base+p.query)
+			if resp.Data.Total != 5 || len(resp.Data.Items) != len(p.want) {
+				t.Fatalf("%s %s: total=%d items=%d, want total=5 items=%d", c.name, p.query, resp.Data.Total, len(resp.Data.Items), len(p.want))
+			}
+			for i, item := range resp.Data.Items {
+				if item["username"] != p.want[i] {
+					t.Fatalf("%s %s: item %d = %v, want %s", c.name, p.query, i, item["username"], p.want[i])
+				}
+			}
+			if strings.Contains(body, "secret-hash") {
+				t.Fatalf("%s %s: paged response leaks password hash", c.name, p.query)
+			}
+		}
+	}
+}
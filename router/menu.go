@@ -1,8 +1,12 @@
 package router
 
 import (
+	"strconv"
+	"strings"
+
 	iammw "gochen-iam/middleware"
 	menusvc "gochen-iam/service/menu"
+	"gochen/errorx"
 	"gochen/httpx"
 	hbasic "gochen/httpx/nethttp"
 )
@@ -12,6 +16,7 @@ import (
 // 约定：
 // - 菜单仅用于“导航可见性”，不作为安全边界；安全边界仍由 API 权限校验保证。
 // - /menus/me 返回基于当前请求上下文的菜单树（权限过滤）。
+// - /menus/public 允许匿名访问：携带有效 token 时同 /menus/me，否则仅返回无权限约束的菜单。
 type MenuRoutes struct {
 	menuService *menusvc.MenuService
 	utils       *hbasic.Utils
@@ -32,6 +37,9 @@ func (mr *MenuRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 	meGroup.Use(iammw.UserOnlyMiddleware())
 	meGroup.GET("", mr.getMyMenuTree)
 
+	// 公开菜单（可匿名访问；token 由模块级 OptionalAuthMiddleware 解析，存在时按当前用户过滤）
+	menuGroup.GET("/public", mr.getPublicMenuTree)
+
 	// 管理端：菜单定义与发布（管理员 + 细分权限）
 	adminGroup := menuGroup.Group("")
 	adminGroup.Use(iammw.AdminOnlyMiddleware())
@@ -42,13 +50,16 @@ func (mr *MenuRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 	adminReadGroup := adminGroup.Group("")
 	adminReadGroup.Use(iammw.PermissionMiddleware("menu:read"))
 	adminReadGroup.GET("", mr.listMenuItems)
+	adminReadGroup.POST("/preview", mr.previewMenuTree)
 
 	adminWriteGroup := adminGroup.Group("")
 	adminWriteGroup.Use(iammw.PermissionMiddleware("menu:write"))
 	adminWriteGroup.POST("", mr.createMenuItem)
+	adminWriteGroup.POST("/reorder", mr.reorderMenuItems)
 	adminWriteGroup.PUT("/:id", mr.updateMenuItem)
 	adminWriteGroup.DELETE("/:id", mr.deleteMenuItem)
 	adminWriteGroup.POST("/:id/restore", mr.restoreMenuItem)
+	adminWriteGroup.POST("/:id/clone", mr.cloneMenuSubtree)
 	adminWriteGroup.DELETE("/:id/purge", mr.purgeMenuItem)
 
 	adminPublishGroup := adminGroup.Group("")
@@ -66,12 +77,54 @@ func (mr *MenuRoutes) GetPriority() int {
 	return 210
 }
 
+// listMenuItems 管理端菜单列表
+//
+// 不带过滤参数时返回全部未删除菜单（数组）；携带 published/disabled/type/parent_id/root_only/page/page_size
+// 任一参数时在数据库侧过滤并分页，返回 {items, total, page, page_size}。
 func (mr *MenuRoutes) listMenuItems(ctx httpx.IContext) error {
-	items, err := mr.menuService.ListMenuItems(ctx.GetRequest().Context())
+	filtered := false
+	for _, key := range []string{"published", "disabled", "type", "parent_id", "root_only", "page", "page_size"} {
+		if strings.TrimSpace(ctx.GetQuery(key)) != "" {
+			filtered = true
+			break
+		}
+	}
+	if !filtered {
+		items, err := mr.menuService.ListMenuItems(ctx.GetRequest().Context())
+		if err != nil {
+			return err
+		}
+		mr.utils.WriteSuccessResponse(ctx, items)
+		return nil
+	}
+
+	filter := &menusvc.ListMenuItemsFilter{Type: strings.TrimSpace(ctx.GetQuery("type"))}
+	var err error
+	if filter.Published, err = parseOptionalBoolQuery(ctx, "published"); err != nil {
+		return err
+	}
+	if filter.Disabled, err = parseOptionalBoolQuery(ctx, "disabled"); err != nil {
+		return err
+	}
+	if filter.RootOnly, err = parseBoolQuery(ctx, "root_only"); err != nil {
+		return err
+	}
+	if v := strings.TrimSpace(ctx.GetQuery("parent_id")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return errorx.New(errorx.Validation, "parent_id must be a positive integer")
+		}
+		filter.ParentID = &id
+	}
+	if filter.Page, filter.PageSize, err = parsePagination(ctx); err != nil {
+		return err
+	}
+
+	page, err := mr.menuService.ListMenuItemsFiltered(ctx.GetRequest().Context(), filter)
 	if err != nil {
 		return err
 	}
-	mr.utils.WriteSuccessResponse(ctx, items)
+	mr.utils.WriteSuccessResponse(ctx, page)
 	return nil
 }
 
@@ -88,6 +141,18 @@ func (mr *MenuRoutes) createMenuItem(ctx httpx.IContext) error {
 	return nil
 }
 
+func (mr *MenuRoutes) reorderMenuItems(ctx httpx.IContext) error {
+	req := &menusvc.ReorderMenuItemsRequest{}
+	if err := ctx.BindJSON(req); err != nil {
+		return err
+	}
+	if err := mr.menuService.ReorderSiblings(ctx.GetRequest().Context(), req.ParentID, req.IDs); err != nil {
+		return err
+	}
+	mr.utils.WriteSuccessResponse(ctx, map[string]any{"parent_id": req.ParentID, "ids": req.IDs})
+	return nil
+}
+
 func (mr *MenuRoutes) updateMenuItem(ctx httpx.IContext) error {
 	id, err := mr.utils.ParseID(ctx, "id")
 	if err != nil {
@@ -130,6 +195,25 @@ func (mr *MenuRoutes) restoreMenuItem(ctx httpx.IContext) error {
 	return nil
 }
 
+func (mr *MenuRoutes) cloneMenuSubtree(ctx httpx.IContext) error {
+	id, err := mr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+	var req struct {
+		CodePrefix string `json:"code_prefix" binding:"required,max=50"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+	item, err := mr.menuService.CloneMenuSubtree(ctx.GetRequest().Context(), id, req.CodePrefix)
+	if err != nil {
+		return err
+	}
+	mr.utils.WriteSuccessResponse(ctx, item)
+	return nil
+}
+
 func (mr *MenuRoutes) purgeMenuItem(ctx httpx.IContext) error {
 	id, err := mr.utils.ParseID(ctx, "id")
 	if err != nil {
@@ -163,6 +247,31 @@ func (mr *MenuRoutes) setMenuPublished(ctx httpx.IContext, published bool) error
 	return nil
 }
 
+// previewMenuTree 按请求体中的权限集合预览菜单树（{"permissions": [...]}）
+func (mr *MenuRoutes) previewMenuTree(ctx httpx.IContext) error {
+	var req struct {
+		Permissions []string `json:"permissions"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+	menus, err := mr.menuService.PreviewMenuTree(ctx.GetRequest().Context(), req.Permissions)
+	if err != nil {
+		return err
+	}
+	mr.utils.WriteSuccessResponse(ctx, menus)
+	return nil
+}
+
+func (mr *MenuRoutes) getPublicMenuTree(ctx httpx.IContext) error {
+	menus, err := mr.menuService.GetPublicMenuTree(ctx.GetRequest().Context(), ctx.GetContext())
+	if err != nil {
+		return err
+	}
+	mr.utils.WriteSuccessResponse(ctx, menus)
+	return nil
+}
+
 func (mr *MenuRoutes) getMyMenuTree(ctx httpx.IContext) error {
 	menus, err := mr.menuService.GetMyMenuTree(ctx.GetRequest().Context(), ctx.GetContext())
 	if err != nil {
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	iamentity "gochen-iam/entity"
+	iammw "gochen-iam/middleware"
+	menurepo "gochen-iam/repo/menu"
+	menusvc "gochen-iam/service/menu"
+	"gochen/httpx/nethttp"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// collectMenuCodes 按先序收集菜单树节点编码（排序后返回）
+func collectMenuCodes(nodes []map[string]any, out []string) []string {
+	for _, n := range nodes {
+		if code, ok := n["code"].(string); ok {
+			out = append(out, code)
+		}
+		if children, ok := n["children"].([]any); ok {
+			sub := make([]map[string]any, 0, len(children))
+			for _, c := range children {
+				if m, ok := c.(map[string]any); ok {
+					sub = append(sub, m)
+				}
+			}
+			out = collectMenuCodes(sub, out)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestMenuRoutes_PublicMenuTreeWithOptionalAuth(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "router_menu_public.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&iamentity.MenuItem{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	repo, err := menurepo.NewMenuItemRepository(newRouterTestOrm(db))
+	if err != nil {
+		t.Fatalf("NewMenuItemRepository: %v", err)
+	}
+	svc := menusvc.NewMenuService(repo)
+	ctx := context.Background()
+
+	for _, req := range []*menusvc.CreateMenuItemRequest{
+		{Code: "home", Title: "首页", Route: "/home"},
+		{Code: "reports", Title: "报表", Route: "/reports", AnyOfPermissions: []string{"report:read"}},
+		{Code: "admin", Title: "管理", Route: "/admin", AllOfPermissions: []string{"user:read", "user:write"}},
+	} {
+		item, err := svc.CreateMenuItem(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateMenuItem(%s): %v", req.Code, err)
+		}
+		if _, err := svc.PublishMenuItem(ctx, item.GetID(), true); err != nil {
+			t.Fatalf("PublishMenuItem(%s): %v", req.Code, err)
+		}
+	}
+
+	iammw.RegisterRequiredPermissions("report:read")
+	cfg := iammw.DefaultAuthConfig()
+	cfg.SecretKey = "router-menu-public-secret"
+	mw := iammw.OptionalAuthMiddleware(cfg)
+	mr := NewMenuRoutes(svc)
+
+	call := func(token string) []string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/menus/public", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		hctx, err := nethttp.NewBaseContext(rec, req)
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		if err := mw(hctx, func() error { return mr.getPublicMenuTree(hctx) }); err != nil {
+			t.Fatalf("GET /menus/public: %v", err)
+		}
+		var resp struct {
+			Data []map[string]any `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+		}
+		return collectMenuCodes(resp.Data, nil)
+	}
+
+	// 匿名访客：仅可见无权限约束的菜单
+	if got := strings.Join(call(""), ","); got != "home" {
+		t.Fatalf("anonymous menu codes = %s, want home", got)
+	}
+
+	// 已登录用户：按 token 中的权限过滤
+	token, err := iammw.GenerateToken(9101, "menu_user", []string{"user"}, []string{"report:read"}, cfg.SecretKey)
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	if got := strings.Join(call(token), ","); got != "home,reports" {
+		t.Fatalf("authenticated menu codes = %s, want home,reports", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 type recordingRouteGroup struct {
 	prefix      string
 	routes      map[string]struct{}
+	handlers    map[string]httpx.Handler
 	middlewares int
 }
 
@@ -16,47 +17,48 @@ func newRecordingGroup(prefix string, routes map[string]struct{}) *recordingRout
 	if routes == nil {
 		routes = map[string]struct{}{}
 	}
-	return &recordingRouteGroup{prefix: prefix, routes: routes}
+	return &recordingRouteGroup{prefix: prefix, routes: routes, handlers: map[string]httpx.Handler{}}
 }
 
 func (g *recordingRouteGroup) full(path string) string {
 	return g.prefix + path
 }
 
-func (g *recordingRouteGroup) record(method, path string) {
+func (g *recordingRouteGroup) record(method, path string, handler httpx.Handler) {
 	g.routes[method+" "+g.full(path)] = struct{}{}
+	g.handlers[method+" "+g.full(path)] = handler
 }
 
 func (g *recordingRouteGroup) GET(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("GET", path)
+	g.record("GET", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) POST(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("POST", path)
+	g.record("POST", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) PUT(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("PUT", path)
+	g.record("PUT", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) DELETE(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("DELETE", path)
+	g.record("DELETE", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) PATCH(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("PATCH", path)
+	g.record("PATCH", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) HEAD(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("HEAD", path)
+	g.record("HEAD", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) OPTIONS(path string, handler httpx.Handler) httpx.IRouteGroup {
-	g.record("OPTIONS", path)
+	g.record("OPTIONS", path, handler)
 	return g
 }
 func (g *recordingRouteGroup) Group(prefix string) httpx.IRouteGroup {
-	return newRecordingGroup(g.prefix+prefix, g.routes)
+	return &recordingRouteGroup{prefix: g.prefix + prefix, routes: g.routes, handlers: g.handlers}
 }
 func (g *recordingRouteGroup) Use(middleware ...httpx.Middleware) httpx.IRouteGroup {
 	g.middlewares += len(middleware)
@@ -74,11 +76,14 @@ func TestMenuRoutes_RegisterRoutes(t *testing.T) {
 
 	want := []string{
 		"GET /menus/me",
+		"GET /menus/public",
 		"GET /menus",
 		"POST /menus",
+		"POST /menus/reorder",
 		"PUT /menus/:id",
 		"DELETE /menus/:id",
 		"POST /menus/:id/restore",
+		"POST /menus/:id/clone",
 		"DELETE /menus/:id/purge",
 		"POST /menus/:id/publish",
 		"POST /menus/:id/unpublish",
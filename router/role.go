@@ -1,6 +1,10 @@
 package router
 
 import (
+	"context"
+	"strings"
+
+	iamentity "gochen-iam/entity"
 	iammw "gochen-iam/middleware"
 	rolerepo "gochen-iam/repo/role"
 	svc "gochen-iam/service"
@@ -67,7 +71,8 @@ func (rr *RoleRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 			cfg.DefaultPageSize = 10
 			cfg.MaxPageSize = 1000
 		}).
-		Build(adminGroup); err != nil {
+		// 列表携带 ?status= 时按状态在数据库侧过滤并分页，否则保持构建器默认行为
+		Build(newQueryRouteGroup(adminGroup, "GET", "", "status", rr.getRolesByStatus)); err != nil {
 		if appErr, ok := err.(*errorx.AppError); ok && appErr != nil {
 			return appErr.Wrap("build role crud routes").WithContext("route", "iam.role")
 		}
@@ -94,11 +99,24 @@ func (rr *RoleRoutes) setupRoleCustomRoutes(roleGroup httpx.IRouteGroup) {
 	// 角色权限管理
 	roleGroup.GET("/:id/permissions", rr.getRolePermissions)
 	roleGroup.POST("/:id/permissions", rr.addRolePermission)
+	// 批量编辑（{"permissions": [...]}）：整体替换 / 批量添加 / 批量移除，全部校验通过后一次写入
+	roleGroup.PUT("/:id/permissions", rr.replaceRolePermissions)
+	roleGroup.POST("/:id/permissions/batch", rr.addRolePermissions)
+	roleGroup.POST("/:id/permissions/batch-remove", rr.removeRolePermissions)
 	roleGroup.DELETE("/:id/permissions/:permission", rr.removeRolePermission)
+	roleGroup.GET("/:id/permission-history", rr.getRolePermissionHistory)
+	roleGroup.GET("/:id/effective-permissions", rr.getRoleEffectivePermissions)
+
+	// 角色继承（父角色）
+	roleGroup.PUT("/:id/parent", rr.setRoleParent)
+	roleGroup.DELETE("/:id/parent", rr.clearRoleParent)
+	roleGroup.POST("/permissions/validate", rr.validatePermissionDependencies)
 
 	// 角色用户管理
 	roleGroup.GET("/:id/users", rr.getRoleUsers)
-	roleGroup.POST("/:id/users", rr.assignRoleToUsers)
+	assignGroup := roleGroup.Group("")
+	assignGroup.Use(iammw.IdempotencyMiddleware(nil))
+	assignGroup.POST("/:id/users", rr.assignRoleToUsers)
 	roleGroup.DELETE("/:id/users/:user", rr.removeRoleFromUser)
 
 	// 角色操作
@@ -106,12 +124,20 @@ func (rr *RoleRoutes) setupRoleCustomRoutes(roleGroup httpx.IRouteGroup) {
 	roleGroup.POST("/:id/deactivate", rr.deactivateRole)
 	roleGroup.POST("/:id/clone", rr.cloneRole)
 
+	// 角色列表（?include_inactive=true&include_deleted=true）
+	roleGroup.GET("/list", rr.listRoles)
+	roleGroup.GET("/search", rr.searchRoles)
+
 	// 系统角色
 	roleGroup.GET("/system", rr.getSystemRoles)
 	roleGroup.POST("/system/init", rr.initSystemRoles)
 
 	// 角色统计
 	roleGroup.GET("/statistics", rr.getRoleStatistics)
+	roleGroup.GET("/usage-stats", rr.getRoleUsageStats)
+
+	// 权限治理审计（unreachable / dangling / undeclared）
+	roleGroup.GET("/audit-permissions", rr.auditPermissions)
 }
 
 // 角色处理器方法
@@ -120,7 +146,7 @@ func (rr *RoleRoutes) setupRoleCustomRoutes(roleGroup httpx.IRouteGroup) {
 
 // 角色权限管理处理器
 func (rr *RoleRoutes) getRolePermissions(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -138,8 +164,85 @@ func (rr *RoleRoutes) getRolePermissions(ctx httpx.IContext) error {
 	return nil
 }
 
+func (rr *RoleRoutes) getRolePermissionHistory(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	roleID, err := rr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	events, err := rr.roleService.GetPermissionHistory(reqCtx, roleID)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"role_id": roleID,
+		"events":  events,
+	})
+	return nil
+}
+
+func (rr *RoleRoutes) getRoleEffectivePermissions(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	roleID, err := rr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	permissions, err := rr.roleService.GetEffectivePermissions(reqCtx, roleID)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"role_id":     roleID,
+		"permissions": permissions,
+	})
+	return nil
+}
+
+func (rr *RoleRoutes) setRoleParent(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	roleID, err := rr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		ParentRoleID int64 `json:"parent_role_id" binding:"required,gt=0"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	role, err := rr.roleService.SetParentRole(reqCtx, roleID, req.ParentRoleID)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, role)
+	return nil
+}
+
+func (rr *RoleRoutes) clearRoleParent(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	roleID, err := rr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	role, err := rr.roleService.ClearParentRole(reqCtx, roleID)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, role)
+	return nil
+}
+
 func (rr *RoleRoutes) addRolePermission(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -167,8 +270,59 @@ func (rr *RoleRoutes) addRolePermission(ctx httpx.IContext) error {
 	return nil
 }
 
+func (rr *RoleRoutes) replaceRolePermissions(ctx httpx.IContext) error {
+	return rr.editRolePermissions(ctx, rr.roleService.ReplacePermissions)
+}
+
+func (rr *RoleRoutes) addRolePermissions(ctx httpx.IContext) error {
+	return rr.editRolePermissions(ctx, rr.roleService.AddPermissions)
+}
+
+func (rr *RoleRoutes) removeRolePermissions(ctx httpx.IContext) error {
+	return rr.editRolePermissions(ctx, rr.roleService.RemovePermissions)
+}
+
+// editRolePermissions 解析 {"permissions": [...]} 并调用批量编辑方法，返回编辑后的权限列表
+func (rr *RoleRoutes) editRolePermissions(ctx httpx.IContext, edit func(context.Context, int64, []string) (*iamentity.Role, error)) error {
+	reqCtx := ctx.GetContext()
+	roleID, err := rr.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	role, err := edit(reqCtx, roleID, req.Permissions)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"role_id":     roleID,
+		"permissions": role.Permissions,
+	})
+	return nil
+}
+
+func (rr *RoleRoutes) validatePermissionDependencies(ctx httpx.IContext) error {
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, rr.roleService.GetPermissionDependencyValidation(req.Permissions))
+	return nil
+}
+
 func (rr *RoleRoutes) removeRolePermission(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -193,12 +347,32 @@ func (rr *RoleRoutes) removeRolePermission(ctx httpx.IContext) error {
 
 // 角色用户管理处理器
 func (rr *RoleRoutes) getRoleUsers(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
 	}
 
+	// 携带 page/page_size 时在数据库侧分页，否则返回全部用户
+	if hasPaginationQuery(ctx) {
+		page, pageSize, err := parsePagination(ctx)
+		if err != nil {
+			return err
+		}
+		users, total, err := rr.roleService.GetRoleUsersPaged(reqCtx, roleID, (page-1)*pageSize, pageSize)
+		if err != nil {
+			return err
+		}
+		rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+			"role_id":   roleID,
+			"items":     users,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		})
+		return nil
+	}
+
 	users, err := rr.roleService.GetRoleUsers(reqCtx, roleID)
 	if err != nil {
 		return err
@@ -212,7 +386,7 @@ func (rr *RoleRoutes) getRoleUsers(ctx httpx.IContext) error {
 }
 
 func (rr *RoleRoutes) assignRoleToUsers(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -240,17 +414,16 @@ func (rr *RoleRoutes) assignRoleToUsers(ctx httpx.IContext) error {
 		}
 	}
 
-	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+	return iammw.WriteIdempotentSuccess(ctx, map[string]interface{}{
 		"role_id":       roleID,
 		"success_count": result.SuccessCount,
 		"failure_count": result.FailureCount,
 		"errors":        errorMessages,
 	})
-	return nil
 }
 
 func (rr *RoleRoutes) removeRoleFromUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -274,7 +447,7 @@ func (rr *RoleRoutes) removeRoleFromUser(ctx httpx.IContext) error {
 
 // 角色操作处理器
 func (rr *RoleRoutes) activateRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -292,7 +465,7 @@ func (rr *RoleRoutes) activateRole(ctx httpx.IContext) error {
 }
 
 func (rr *RoleRoutes) deactivateRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -310,7 +483,7 @@ func (rr *RoleRoutes) deactivateRole(ctx httpx.IContext) error {
 }
 
 func (rr *RoleRoutes) cloneRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roleID, err := rr.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -318,12 +491,13 @@ func (rr *RoleRoutes) cloneRole(ctx httpx.IContext) error {
 
 	var req struct {
 		Name string `json:"name" binding:"required,min=3,max=50"`
+		svc.CloneRoleOptions
 	}
 	if err := ctx.BindJSON(&req); err != nil {
 		return err
 	}
 
-	clonedRole, err := rr.roleService.CloneRole(reqCtx, roleID, req.Name)
+	clonedRole, err := rr.roleService.CloneRoleWithOptions(reqCtx, roleID, req.Name, req.CloneRoleOptions)
 	if err != nil {
 		return err
 	}
@@ -332,9 +506,84 @@ func (rr *RoleRoutes) cloneRole(ctx httpx.IContext) error {
 	return nil
 }
 
+// getRolesByStatus 分页获取指定状态的角色（GET /roles?status=active|inactive&page=&page_size=）
+func (rr *RoleRoutes) getRolesByStatus(ctx httpx.IContext) error {
+	page, pageSize, err := parsePagination(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := strings.TrimSpace(ctx.GetQuery("status"))
+	if status == "" {
+		return errorx.New(errorx.Validation, "status parameter is required")
+	}
+	roles, total, err := rr.roleService.GetRolesByStatusPaged(ctx.GetContext(), status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"items":     roles,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	return nil
+}
+
+// 角色列表处理器
+func (rr *RoleRoutes) listRoles(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	opts, err := parseListOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	roles, err := rr.roleService.ListRoles(reqCtx, opts)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, roles)
+	return nil
+}
+
+func (rr *RoleRoutes) searchRoles(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	page, pageSize, err := parsePagination(ctx)
+	if err != nil {
+		return err
+	}
+
+	keyword := strings.TrimSpace(ctx.GetQuery("keyword"))
+	roles, total, err := rr.roleService.SearchRolesPaged(reqCtx, keyword, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"items":     roles,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	return nil
+}
+
+func (rr *RoleRoutes) auditPermissions(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	audit, err := rr.roleService.AuditPermissions(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, audit)
+	return nil
+}
+
 // 系统角色处理器
 func (rr *RoleRoutes) getSystemRoles(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	roles, err := rr.roleService.GetSystemRoles(reqCtx)
 	if err != nil {
 		return err
@@ -345,7 +594,7 @@ func (rr *RoleRoutes) getSystemRoles(ctx httpx.IContext) error {
 }
 
 func (rr *RoleRoutes) initSystemRoles(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	if err := rr.roleService.InitializeSystemRoles(reqCtx); err != nil {
 		return err
 	}
@@ -358,7 +607,7 @@ func (rr *RoleRoutes) initSystemRoles(ctx httpx.IContext) error {
 
 // 角色统计处理器
 func (rr *RoleRoutes) getRoleStatistics(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	stats, err := rr.roleService.GetRoleStatistics(reqCtx)
 	if err != nil {
 		return err
@@ -367,3 +616,17 @@ func (rr *RoleRoutes) getRoleStatistics(ctx httpx.IContext) error {
 	rr.utils.WriteSuccessResponse(ctx, stats)
 	return nil
 }
+
+// 角色使用统计处理器（各角色的用户数/组织数）
+func (rr *RoleRoutes) getRoleUsageStats(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	stats, err := rr.roleService.GetRoleUsageStats(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	rr.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"roles": stats,
+	})
+	return nil
+}
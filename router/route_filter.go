@@ -0,0 +1,117 @@
+package router
+
+import (
+	"strings"
+
+	"gochen/httpx"
+)
+
+// skipRouteGroup 跳过 CRUD 构建器注册的指定路由（"METHOD /path"），便于以带业务规则的处理器替换
+//
+// 同一 method+path 在 net/http ServeMux 上重复注册会 panic，因此需在构建阶段过滤。
+type skipRouteGroup struct {
+	httpx.IRouteGroup
+	skip map[string]struct{}
+}
+
+// newSkipRouteGroup 创建跳过指定路由的分组包装
+func newSkipRouteGroup(group httpx.IRouteGroup, routes ...string) *skipRouteGroup {
+	skip := make(map[string]struct{}, len(routes))
+	for _, r := range routes {
+		skip[r] = struct{}{}
+	}
+	return &skipRouteGroup{IRouteGroup: group, skip: skip}
+}
+
+func (g *skipRouteGroup) skipped(method, path string) bool {
+	_, ok := g.skip[method+" "+path]
+	return ok
+}
+
+func (g *skipRouteGroup) GET(path string, handler httpx.Handler) httpx.IRouteGroup {
+	if !g.skipped("GET", path) {
+		g.IRouteGroup.GET(path, handler)
+	}
+	return g
+}
+
+func (g *skipRouteGroup) POST(path string, handler httpx.Handler) httpx.IRouteGroup {
+	if !g.skipped("POST", path) {
+		g.IRouteGroup.POST(path, handler)
+	}
+	return g
+}
+
+func (g *skipRouteGroup) PUT(path string, handler httpx.Handler) httpx.IRouteGroup {
+	if !g.skipped("PUT", path) {
+		g.IRouteGroup.PUT(path, handler)
+	}
+	return g
+}
+
+func (g *skipRouteGroup) DELETE(path string, handler httpx.Handler) httpx.IRouteGroup {
+	if !g.skipped("DELETE", path) {
+		g.IRouteGroup.DELETE(path, handler)
+	}
+	return g
+}
+
+func (g *skipRouteGroup) PATCH(path string, handler httpx.Handler) httpx.IRouteGroup {
+	if !g.skipped("PATCH", path) {
+		g.IRouteGroup.PATCH(path, handler)
+	}
+	return g
+}
+
+// queryRouteGroup 按 query 参数分流 CRUD 构建器注册的指定路由（method + 相对分组的 path，分组根路径为空字符串）
+//
+// 请求携带 key 参数（非空）时交由 override 处理，否则仍由构建器的处理器处理，保持原有行为。
+type queryRouteGroup struct {
+	httpx.IRouteGroup
+	method   string
+	path     string
+	key      string
+	override httpx.Handler
+}
+
+// newQueryRouteGroup 创建按 query 参数分流指定路由的分组包装
+func newQueryRouteGroup(group httpx.IRouteGroup, method, path, key string, override httpx.Handler) *queryRouteGroup {
+	return &queryRouteGroup{IRouteGroup: group, method: method, path: path, key: key, override: override}
+}
+
+func (g *queryRouteGroup) wrap(method, path string, handler httpx.Handler) httpx.Handler {
+	if method != g.method || path != g.path {
+		return handler
+	}
+	return func(ctx httpx.IContext) error {
+		if strings.TrimSpace(ctx.GetQuery(g.key)) != "" {
+			return g.override(ctx)
+		}
+		return handler(ctx)
+	}
+}
+
+func (g *queryRouteGroup) GET(path string, handler httpx.Handler) httpx.IRouteGroup {
+	g.IRouteGroup.GET(path, g.wrap("GET", path, handler))
+	return g
+}
+
+func (g *queryRouteGroup) POST(path string, handler httpx.Handler) httpx.IRouteGroup {
+	g.IRouteGroup.POST(path, g.wrap("POST", path, handler))
+	return g
+}
+
+func (g *queryRouteGroup) PUT(path string, handler httpx.Handler) httpx.IRouteGroup {
+	g.IRouteGroup.PUT(path, g.wrap("PUT", path, handler))
+	return g
+}
+
+func (g *queryRouteGroup) DELETE(path string, handler httpx.Handler) httpx.IRouteGroup {
+	g.IRouteGroup.DELETE(path, g.wrap("DELETE", path, handler))
+	return g
+}
+
+func (g *queryRouteGroup) PATCH(path string, handler httpx.Handler) httpx.IRouteGroup {
+	g.IRouteGroup.PATCH(path, g.wrap("PATCH", path, handler))
+	return g
+}
@@ -0,0 +1,158 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	iamentity "gochen-iam/entity"
+	grouprepo "gochen-iam/repo/group"
+	rolerepo "gochen-iam/repo/role"
+	userrepo "gochen-iam/repo/user"
+	rolesvc "gochen-iam/service/role"
+	usersvc "gochen-iam/service/user"
+	"gochen/httpx/nethttp"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// callStatusList 调用已注册的列表处理器并返回响应中的 name/username 列表与 total
+func callStatusList(t *testing.T, root *recordingRouteGroup, route, target string) ([]string, int64) {
+	t.Helper()
+	handler, ok := root.handlers[route]
+	if !ok {
+		t.Fatalf("missing route: %s", route)
+	}
+	rec := httptest.NewRecorder()
+	ctx, err := nethttp.NewBaseContext(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if err != nil {
+		t.Fatalf("NewBaseContext: %v", err)
+	}
+	if err := handler(ctx); err != nil {
+		t.Fatalf("%s: %v", target, err)
+	}
+
+	var resp struct {
+		Data struct {
+			Items []struct {
+				Name     string `json:"name"`
+				Username string `json:"username"`
+				Status   string `json:"status"`
+			} `json:"items"`
+			Total int64 `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, rec.Body.String())
+	}
+	names := make([]string, 0, len(resp.Data.Items))
+	for _, item := range resp.Data.Items {
+		names = append(names, item.Name+item.Username+":"+item.Status)
+	}
+	return names, resp.Data.Total
+}
+
+func TestCrudListStatusFilter(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "router_status.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&iamentity.User{}, &iamentity.Group{}, &iamentity.Role{}, &iamentity.UserGroup{}, &iamentity.UserRoleAssignment{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	ormAdapter := newRouterTestOrm(db)
+	userRepo, err := userrepo.NewUserRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewUserRepository: %v", err)
+	}
+	groupRepo, err := grouprepo.NewGroupRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewGroupRepository: %v", err)
+	}
+	roleRepo, err := rolerepo.NewRoleRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewRoleRepository: %v", err)
+	}
+
+	for _, u := range []*iamentity.User{
+		{Username: "alice", Email: "alice@example.com", Password: "x", Status: "active"},
+		{Username: "bob", Email: "bob@example.com", Password: "x", Status: "locked"},
+		{Username: "carol", Email: "carol@example.com", Password: "x", Status: "active"},
+		{Username: "dave", Email: "dave@example.com", Password: "x", Status: "inactive"},
+	} {
+		u.SyncCanonicalNames()
+		if err := db.Create(u).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, r := range []*iamentity.Role{
+		{Name: "editor", Status: "active"},
+		{Name: "legacy", Status: "inactive"},
+		{Name: "viewer", Status: "active"},
+	} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatalf("create role: %v", err)
+		}
+	}
+
+	root := newRecordingGroup("", nil)
+	userService := usersvc.NewUserService(userRepo, groupRepo, roleRepo, nil, nil)
+	roleService := rolesvc.NewRoleService(roleRepo, userRepo, groupRepo, nil)
+	if err := NewUserRoutes(userService, nil, roleService, userRepo).RegisterRoutes(root); err != nil {
+		t.Fatalf("register user routes: %v", err)
+	}
+	if err := NewRoleRoutes(roleService, userService, nil, roleRepo).RegisterRoutes(root); err != nil {
+		t.Fatalf("register role routes: %v", err)
+	}
+
+	// 仅返回匹配状态的记录
+	names, total := callStatusList(t, root, "GET /users", "/users?status=active")
+	if total != 2 || len(names) != 2 || names[0] != "alice:active" || names[1] != "carol:active" {
+		t.Fatalf("unexpected active users: total=%d %v", total, names)
+	}
+	names, total = callStatusList(t, root, "GET /users", "/users?status=locked&page=1&page_size=10")
+	if total != 1 || len(names) != 1 || names[0] != "bob:locked" {
+		t.Fatalf("unexpected locked users: total=%d %v", total, names)
+	}
+	names, total = callStatusList(t, root, "GET /users", "/users?status=active&page=2&page_size=1")
+	if total != 2 || len(names) != 1 || names[0] != "carol:active" {
+		t.Fatalf("unexpected paged active users: total=%d %v", total, names)
+	}
+	names, total = callStatusList(t, root, "GET /roles", "/roles?status=inactive")
+	if total != 1 || len(names) != 1 || names[0] != "legacy:inactive" {
+		t.Fatalf("unexpected inactive roles: total=%d %v", total, names)
+	}
+	names, total = callStatusList(t, root, "GET /roles", "/roles?status=active")
+	if total != 2 || len(names) != 2 || names[0] != "editor:active" || names[1] != "viewer:active" {
+		t.Fatalf("unexpected active roles: total=%d %v", total, names)
+	}
+
+	// 不带 status 时仍由 CRUD 构建器处理，返回全部记录
+	rec := httptest.NewRecorder()
+	ctx, err := nethttp.NewBaseContext(rec, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if err != nil {
+		t.Fatalf("NewBaseContext: %v", err)
+	}
+	if err := root.handlers["GET /users"](ctx); err != nil {
+		t.Fatalf("default list: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		if !strings.Contains(rec.Body.String(), `"username":"`+name+`"`) {
+			t.Fatalf("expected %s in default list: %s", name, rec.Body.String())
+		}
+	}
+
+	// 非法状态返回 Validation 错误
+	rec = httptest.NewRecorder()
+	ctx, err = nethttp.NewBaseContext(rec, httptest.NewRequest(http.MethodGet, "/roles?status=unknown", nil))
+	if err != nil {
+		t.Fatalf("NewBaseContext: %v", err)
+	}
+	if err := root.handlers["GET /roles"](ctx); err == nil {
+		t.Fatal("expected error for invalid role status")
+	}
+}
@@ -12,6 +12,16 @@ import (
 	"gochen/errorx"
 	"gochen/httpx"
 	hbasic "gochen/httpx/nethttp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBulkRegisterSize 批量导入单次最多行数（每行需 bcrypt 哈希，避免单请求耗时过长）
+	maxBulkRegisterSize = 500
+	// maxCheckPermissionsSize 批量权限检查单次最多权限数
+	maxCheckPermissionsSize = 200
 )
 
 // UserRoutes 用户路由注册器
@@ -69,7 +79,9 @@ func (ur *UserRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 			cfg.DefaultPageSize = 10
 			cfg.MaxPageSize = 1000
 		}).
-		Build(adminGroup); err != nil {
+		// 删除由 UserService.DeleteUser 处理（校验“最后一个系统管理员”等业务规则）；
+		// 列表携带 ?status= 时按状态在数据库侧过滤并分页（同 /by-status），否则保持构建器默认行为
+		Build(newSkipRouteGroup(newQueryRouteGroup(adminGroup, "GET", "", "status", ur.getUsersByStatus), "DELETE /:id")); err != nil {
 		if appErr, ok := err.(*errorx.AppError); ok && appErr != nil {
 			return appErr.Wrap("build user crud routes").WithContext("route", "iam.user")
 		}
@@ -94,25 +106,50 @@ func (ur *UserRoutes) GetPriority() int {
 
 // setupAdminUserRoutes 设置管理员可用的用户管理路由
 func (ur *UserRoutes) setupAdminUserRoutes(userGroup httpx.IRouteGroup) {
+	// 分页查询（放在参数路由之前，避免冲突）
+	userGroup.GET("/search", ur.searchUsers)
+	userGroup.GET("/by-status", ur.getUsersByStatus)
+	userGroup.GET("/locked", ur.getLockedUsers)
+
+	// 批量导入（逐行返回结果，单行失败不影响其他行）
+	userGroup.POST("/bulk", ur.bulkRegisterUsers)
+
+	// 删除 / 恢复 / 物理删除
+	userGroup.DELETE("/:id", ur.deleteUser)
+	userGroup.POST("/:id/restore", ur.restoreUser)
+	userGroup.DELETE("/:id/purge", ur.purgeUser)
+
 	// 用户状态管理
 	userGroup.POST("/:id/activate", ur.activateUser)
 	userGroup.POST("/:id/deactivate", ur.deactivateUser)
 	userGroup.POST("/:id/lock", ur.lockUser)
 	userGroup.POST("/:id/unlock", ur.unlockUser)
 
+	// 用户名修改
+	userGroup.PUT("/:id/username", ur.changeUsername)
+	userGroup.GET("/:id/username-history", ur.getUsernameHistory)
+
 	// 用户角色管理
 	userGroup.GET("/:id/roles", ur.getUserRoles)
-	userGroup.POST("/:id/roles", ur.assignUserRole)
+	assignGroup := userGroup.Group("")
+	assignGroup.Use(iammw.IdempotencyMiddleware(nil))
+	assignGroup.POST("/:id/roles", ur.assignUserRole)
 	userGroup.DELETE("/:id/roles/:role", ur.removeUserRole)
 
 	// 用户组织管理
 	userGroup.GET("/:id/groups", ur.getUserGroups)
 	userGroup.POST("/:id/groups", ur.assignUserToGroup)
 	userGroup.DELETE("/:id/groups/:group", ur.removeUserFromGroupByUser)
+	userGroup.GET("/:id/group-history", ur.getUserGroupHistory)
+
+	// 用户登录会话管理
+	userGroup.GET("/:id/sessions", ur.getUserSessions)
+	userGroup.DELETE("/:id/sessions/:jti", ur.revokeUserSession)
 
 	// 用户权限查询
 	userGroup.GET("/:id/permissions", ur.getUserPermissions)
 	userGroup.POST("/:id/check-permission", ur.checkUserPermission)
+	userGroup.POST("/:id/check-permissions", ur.checkUserPermissions)
 }
 
 // setupSelfUserRoutes 设置当前用户自助操作路由
@@ -123,6 +160,12 @@ func (ur *UserRoutes) setupSelfUserRoutes(userGroup httpx.IRouteGroup) {
 	meGroup.GET("", ur.getCurrentUser)
 	meGroup.PUT("", ur.updateCurrentUser)
 	meGroup.POST("/change-password", ur.changePassword)
+	meGroup.GET("/role-names", ur.getCurrentUserRoleNames)
+	meGroup.GET("/tenants", ur.getCurrentUserTenants)
+	meGroup.GET("/access-changes", ur.getCurrentUserAccessChanges)
+	meGroup.GET("/sessions", ur.getCurrentUserSessions)
+	meGroup.DELETE("/sessions/:jti", ur.revokeCurrentUserSession)
+	meGroup.POST("/check-permissions", ur.checkCurrentUserPermissions)
 }
 
 // 用户处理器方法
@@ -131,7 +174,7 @@ func (ur *UserRoutes) setupSelfUserRoutes(userGroup httpx.IRouteGroup) {
 
 // 用户状态管理处理器
 func (ur *UserRoutes) activateUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -149,7 +192,7 @@ func (ur *UserRoutes) activateUser(ctx httpx.IContext) error {
 }
 
 func (ur *UserRoutes) deactivateUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -167,7 +210,7 @@ func (ur *UserRoutes) deactivateUser(ctx httpx.IContext) error {
 }
 
 func (ur *UserRoutes) lockUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -185,7 +228,7 @@ func (ur *UserRoutes) lockUser(ctx httpx.IContext) error {
 }
 
 func (ur *UserRoutes) unlockUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -204,7 +247,7 @@ func (ur *UserRoutes) unlockUser(ctx httpx.IContext) error {
 
 // 用户角色管理处理器
 func (ur *UserRoutes) getUserRoles(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -222,14 +265,16 @@ func (ur *UserRoutes) getUserRoles(ctx httpx.IContext) error {
 }
 
 func (ur *UserRoutes) assignUserRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
 	}
 
 	var req struct {
-		RoleID int64 `json:"role_id" binding:"required"`
+		RoleID    int64      `json:"role_id" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"` // 可选：限时分配的过期时间（RFC3339）
+		GroupID   *int64     `json:"group_id"`   // 可选：限定生效的组织范围
 	}
 	if err := ctx.BindJSON(&req); err != nil {
 		return err
@@ -238,20 +283,30 @@ func (ur *UserRoutes) assignUserRole(ctx httpx.IContext) error {
 		err := errorx.New(errorx.Validation, "role_id must be greater than 0")
 		return err
 	}
+	if req.GroupID != nil && req.ExpiresAt != nil {
+		return errorx.New(errorx.Validation, "group_id and expires_at cannot be combined")
+	}
 
-	if err := ur.userService.AssignRole(reqCtx, userID, req.RoleID); err != nil {
+	switch {
+	case req.GroupID != nil:
+		err = ur.userService.AssignRoleInGroup(reqCtx, userID, req.RoleID, *req.GroupID)
+	case req.ExpiresAt != nil:
+		err = ur.userService.AssignRoleUntil(reqCtx, userID, req.RoleID, *req.ExpiresAt)
+	default:
+		err = ur.userService.AssignRole(reqCtx, userID, req.RoleID)
+	}
+	if err != nil {
 		return err
 	}
 
-	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+	return iammw.WriteIdempotentSuccess(ctx, map[string]interface{}{
 		"user_id": userID,
 		"role_id": req.RoleID,
 	})
-	return nil
 }
 
 func (ur *UserRoutes) removeUserRole(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -275,7 +330,7 @@ func (ur *UserRoutes) removeUserRole(ctx httpx.IContext) error {
 
 // 用户组织管理处理器
 func (ur *UserRoutes) getUserGroups(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -292,8 +347,107 @@ func (ur *UserRoutes) getUserGroups(ctx httpx.IContext) error {
 	return nil
 }
 
+func (ur *UserRoutes) getUserGroupHistory(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	changes, err := ur.userService.GetGroupMembershipHistory(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"changes": changes,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) changeUsername(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	var req struct {
+		Username string `json:"username" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+
+	user, err := ur.userService.ChangeUsername(reqCtx, userID, req.Username)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"id":       userID,
+		"username": user.Username,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) getUsernameHistory(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	history, err := ur.userService.GetUsernameHistory(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"history": history,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) getUserSessions(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	sessions, err := ur.userService.ListSessions(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"sessions": sessions,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) revokeUserSession(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+
+	jti := ctx.GetParam("jti")
+	if err := ur.userService.RevokeSession(reqCtx, userID, jti); err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"user_id":    userID,
+		"session_id": jti,
+	})
+	return nil
+}
+
 func (ur *UserRoutes) assignUserToGroup(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -322,7 +476,7 @@ func (ur *UserRoutes) assignUserToGroup(ctx httpx.IContext) error {
 }
 
 func (ur *UserRoutes) removeUserFromGroupByUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -346,7 +500,7 @@ func (ur *UserRoutes) removeUserFromGroupByUser(ctx httpx.IContext) error {
 
 // 用户权限处理器
 func (ur *UserRoutes) getUserPermissions(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -365,7 +519,7 @@ func (ur *UserRoutes) getUserPermissions(ctx httpx.IContext) error {
 }
 
 func (ur *UserRoutes) checkUserPermission(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID, err := ur.utils.ParseID(ctx, "id")
 	if err != nil {
 		return err
@@ -373,6 +527,7 @@ func (ur *UserRoutes) checkUserPermission(ctx httpx.IContext) error {
 
 	var req struct {
 		Permission string `json:"permission" binding:"required"`
+		GroupID    *int64 `json:"group_id"` // 可选：仅按该组织范围内生效的角色检查
 	}
 	if err := ctx.BindJSON(&req); err != nil {
 		return err
@@ -382,22 +537,76 @@ func (ur *UserRoutes) checkUserPermission(ctx httpx.IContext) error {
 		return err
 	}
 
-	allowed, err := ur.userService.CheckPermission(reqCtx, userID, req.Permission)
+	var allowed bool
+	if req.GroupID != nil {
+		allowed, err = ur.userService.CheckPermissionInGroup(reqCtx, userID, req.Permission, *req.GroupID)
+	} else {
+		allowed, err = ur.userService.CheckPermission(reqCtx, userID, req.Permission)
+	}
 	if err != nil {
 		return err
 	}
 
-	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+	resp := map[string]interface{}{
 		"user_id":    userID,
 		"permission": req.Permission,
 		"allowed":    allowed,
+	}
+	if req.GroupID != nil {
+		resp["group_id"] = *req.GroupID
+	}
+	ur.utils.WriteSuccessResponse(ctx, resp)
+	return nil
+}
+
+func (ur *UserRoutes) checkUserPermissions(ctx httpx.IContext) error {
+	userID, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+	return ur.writePermissionChecks(ctx, userID)
+}
+
+func (ur *UserRoutes) checkCurrentUserPermissions(ctx httpx.IContext) error {
+	userID := ctx.GetContext().GetUserID()
+	if userID == 0 {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+	return ur.writePermissionChecks(ctx, userID)
+}
+
+// writePermissionChecks 解析 {permissions:[...]} 并返回逐项检查结果
+func (ur *UserRoutes) writePermissionChecks(ctx httpx.IContext, userID int64) error {
+	reqCtx := ctx.GetContext()
+
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+	if len(req.Permissions) == 0 {
+		return errorx.New(errorx.Validation, "permissions cannot be empty")
+	}
+	if len(req.Permissions) > maxCheckPermissionsSize {
+		return errorx.New(errorx.Validation, "permissions cannot exceed "+strconv.Itoa(maxCheckPermissionsSize)+" items")
+	}
+
+	results, err := ur.userService.CheckPermissions(reqCtx, userID, req.Permissions)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"user_id":     userID,
+		"permissions": results,
 	})
 	return nil
 }
 
 // 当前用户处理器
 func (ur *UserRoutes) getCurrentUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID := ctx.GetContext().GetUserID()
 	if userID == 0 {
 		err := errorx.New(errorx.Unauthorized, "用户未认证")
@@ -416,8 +625,44 @@ func (ur *UserRoutes) getCurrentUser(ctx httpx.IContext) error {
 	return nil
 }
 
+func (ur *UserRoutes) getCurrentUserSessions(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := ctx.GetContext().GetUserID()
+	if userID == 0 {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+
+	sessions, err := ur.userService.ListSessions(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"sessions": sessions,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) revokeCurrentUserSession(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := ctx.GetContext().GetUserID()
+	if userID == 0 {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+
+	jti := ctx.GetParam("jti")
+	if err := ur.userService.RevokeSession(reqCtx, userID, jti); err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"session_id": jti,
+	})
+	return nil
+}
+
 func (ur *UserRoutes) updateCurrentUser(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID := ctx.GetContext().GetUserID()
 	if userID == 0 {
 		err := errorx.New(errorx.Unauthorized, "用户未认证")
@@ -441,8 +686,201 @@ func (ur *UserRoutes) updateCurrentUser(ctx httpx.IContext) error {
 	return nil
 }
 
+func (ur *UserRoutes) getCurrentUserRoleNames(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := ctx.GetContext().GetUserID()
+	if userID == 0 {
+		err := errorx.New(errorx.Unauthorized, "用户未认证")
+		return err
+	}
+
+	roleNames, err := ur.userService.GetUserRoleNames(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"user_id": userID,
+		"roles":   roleNames,
+	})
+	return nil
+}
+
+// getCurrentUserTenants 获取当前用户可访问的租户（租户切换列表）
+func (ur *UserRoutes) getCurrentUserTenants(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := ctx.GetContext().GetUserID()
+	if userID == 0 {
+		err := errorx.New(errorx.Unauthorized, "用户未认证")
+		return err
+	}
+
+	tenants, err := ur.userService.GetUserTenants(reqCtx, userID)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, tenants)
+	return nil
+}
+
+// getCurrentUserAccessChanges 获取当前用户近期的角色授予/移除记录（?since=RFC3339，默认最近 30 天）
+func (ur *UserRoutes) getCurrentUserAccessChanges(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	userID := ctx.GetContext().GetUserID()
+	if userID == 0 {
+		err := errorx.New(errorx.Unauthorized, "用户未认证")
+		return err
+	}
+
+	var since time.Time
+	if v := strings.TrimSpace(ctx.GetQuery("since")); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return errorx.New(errorx.Validation, "since 格式错误，应为 RFC3339")
+		}
+		since = parsed
+	}
+
+	changes, err := ur.userService.GetMyAccessChanges(reqCtx, userID, since)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, changes)
+	return nil
+}
+
+func (ur *UserRoutes) searchUsers(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	page, pageSize, err := parsePagination(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts, err := parseListOptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	keyword := strings.TrimSpace(ctx.GetQuery("keyword"))
+	users, total, err := ur.userService.SearchUsersPaged(reqCtx, keyword, opts, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"items":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) getUsersByStatus(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	page, pageSize, err := parsePagination(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := strings.TrimSpace(ctx.GetQuery("status"))
+	if status == "" {
+		return errorx.New(errorx.Validation, "status parameter is required")
+	}
+	users, total, err := ur.userService.GetUsersByStatusPaged(reqCtx, status, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"items":     users,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	return nil
+}
+
+func (ur *UserRoutes) deleteUser(ctx httpx.IContext) error {
+	id, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+	if err := ur.userService.DeleteUser(ctx.GetContext(), id); err != nil {
+		return err
+	}
+	ur.utils.WriteSuccessResponse(ctx, map[string]any{"id": id})
+	return nil
+}
+
+func (ur *UserRoutes) restoreUser(ctx httpx.IContext) error {
+	id, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+	user, err := ur.userService.RestoreUser(ctx.GetContext(), id)
+	if err != nil {
+		return err
+	}
+	ur.utils.WriteSuccessResponse(ctx, user)
+	return nil
+}
+
+func (ur *UserRoutes) purgeUser(ctx httpx.IContext) error {
+	id, err := ur.utils.ParseID(ctx, "id")
+	if err != nil {
+		return err
+	}
+	if err := ur.userService.PurgeUser(ctx.GetContext(), id); err != nil {
+		return err
+	}
+	ur.utils.WriteSuccessResponse(ctx, map[string]any{"id": id})
+	return nil
+}
+
+func (ur *UserRoutes) getLockedUsers(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	users, err := ur.userService.GetLockedUsers(reqCtx)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, users)
+	return nil
+}
+
+func (ur *UserRoutes) bulkRegisterUsers(ctx httpx.IContext) error {
+	reqCtx := ctx.GetContext()
+	var req struct {
+		Users []*iamsvc.RegisterRequest `json:"users" binding:"required"`
+	}
+	if err := ctx.BindJSON(&req); err != nil {
+		return err
+	}
+	if len(req.Users) == 0 {
+		return errorx.New(errorx.Validation, "users cannot be empty")
+	}
+	if len(req.Users) > maxBulkRegisterSize {
+		return errorx.New(errorx.Validation, "users cannot exceed "+strconv.Itoa(maxBulkRegisterSize)+" rows")
+	}
+
+	summary, results, err := ur.userService.BulkRegister(reqCtx, req.Users)
+	if err != nil {
+		return err
+	}
+
+	ur.utils.WriteSuccessResponse(ctx, map[string]interface{}{
+		"success_count": summary.SuccessCount,
+		"failure_count": summary.FailureCount,
+		"results":       results,
+	})
+	return nil
+}
+
 func (ur *UserRoutes) changePassword(ctx httpx.IContext) error {
-	reqCtx := ctx.GetRequest().Context()
+	reqCtx := ctx.GetContext()
 	userID := ctx.GetContext().GetUserID()
 	if userID == 0 {
 		err := errorx.New(errorx.Unauthorized, "用户未认证")
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gochen/httpx"
+	"gochen/httpx/nethttp"
+)
+
+func TestUserRoutes_SelfRoutes(t *testing.T) {
+	routes := map[string]struct{}{}
+	root := newRecordingGroup("/users", routes)
+
+	ur := NewUserRoutes(nil, nil, nil, nil)
+	ur.setupSelfUserRoutes(root)
+
+	want := []string{
+		"GET /users/me",
+		"PUT /users/me",
+		"POST /users/me/change-password",
+		"GET /users/me/role-names",
+		"GET /users/me/tenants",
+		"GET /users/me/access-changes",
+		"GET /users/me/sessions",
+		"DELETE /users/me/sessions/:jti",
+		"POST /users/me/check-permissions",
+	}
+	for _, w := range want {
+		if _, ok := routes[w]; !ok {
+			t.Fatalf("missing route: %s", w)
+		}
+	}
+}
+
+func TestUserRoutes_AdminRoutes(t *testing.T) {
+	routes := map[string]struct{}{}
+	root := newRecordingGroup("/users", routes)
+
+	ur := NewUserRoutes(nil, nil, nil, nil)
+	ur.setupAdminUserRoutes(root)
+
+	for _, w := range []string{
+		"GET /users/search",
+		"GET /users/by-status",
+		"GET /users/locked",
+		"POST /users/bulk",
+		"DELETE /users/:id",
+		"POST /users/:id/restore",
+		"DELETE /users/:id/purge",
+		"GET /users/:id/group-history",
+		"PUT /users/:id/username",
+		"GET /users/:id/username-history",
+		"GET /users/:id/sessions",
+		"DELETE /users/:id/sessions/:jti",
+		"POST /users/:id/check-permissions",
+	} {
+		if _, ok := routes[w]; !ok {
+			t.Fatalf("missing route: %s", w)
+		}
+	}
+}
+
+func TestSkipRouteGroup(t *testing.T) {
+	routes := map[string]struct{}{}
+	g := newSkipRouteGroup(newRecordingGroup("/users", routes), "DELETE /:id")
+
+	g.DELETE("/:id", nil)
+	g.GET("/:id", nil)
+	g.DELETE("/batch", nil)
+
+	if _, ok := routes["DELETE /users/:id"]; ok {
+		t.Fatal("expected DELETE /users/:id to be skipped")
+	}
+	for _, w := range []string{"GET /users/:id", "DELETE /users/batch"} {
+		if _, ok := routes[w]; !ok {
+			t.Fatalf("missing route: %s", w)
+		}
+	}
+}
+
+func TestQueryRouteGroup(t *testing.T) {
+	root := newRecordingGroup("/users", nil)
+	var called string
+	g := newQueryRouteGroup(root, "GET", "", "status", func(httpx.IContext) error { called = "override"; return nil })
+
+	g.GET("", func(httpx.IContext) error { called = "default"; return nil })
+	g.GET("/:id", func(httpx.IContext) error { called = "get"; return nil })
+
+	for _, tc := range []struct{ route, target, want string }{
+		{"GET /users", "/users", "default"},
+		{"GET /users", "/users?status=", "default"},
+		{"GET /users", "/users?status=locked", "override"},
+		{"GET /users/:id", "/users/1?status=locked", "get"},
+	} {
+		called = ""
+		ctx, err := nethttp.NewBaseContext(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if err != nil {
+			t.Fatalf("NewBaseContext: %v", err)
+		}
+		if err := root.handlers[tc.route](ctx); err != nil {
+			t.Fatalf("%s: %v", tc.target, err)
+		}
+		if called != tc.want {
+			t.Errorf("%s: expected %s handler, got %q", tc.target, tc.want, called)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	groupsvc "gochen-iam/service/group"
+	rolesvc "gochen-iam/service/role"
+	usersvc "gochen-iam/service/user"
+	"gochen/db/orm"
+)
+
+// AdminService 管理端聚合服务（汇总各领域服务的统计数据）
+type AdminService struct {
+	userService  *usersvc.UserService
+	groupService *groupsvc.GroupService
+	roleService  *rolesvc.RoleService
+}
+
+// NewAdminService 创建管理端聚合服务实例
+func NewAdminService(
+	userService *usersvc.UserService,
+	groupService *groupsvc.GroupService,
+	roleService *rolesvc.RoleService,
+) *AdminService {
+	return &AdminService{
+		userService:  userService,
+		groupService: groupService,
+		roleService:  roleService,
+	}
+}
+
+// GetSummary 获取管理端首页汇总
+//
+// 组合 GetGroupStatistics、GetRoleStatistics 与近期注册数。各查询相互独立、只读，
+// 默认并行执行；若 ctx 携带事务会话（同一连接不可并发使用），则退化为顺序执行。
+func (s *AdminService) GetSummary(ctx context.Context) (*svc.AdminSummary, error) {
+	now := time.Now()
+	summary := &svc.AdminSummary{
+		RecentRegistrations: &svc.RecentRegistrations{},
+		GeneratedAt:         now,
+	}
+
+	tasks := []func() error{
+		func() (err error) {
+			summary.Groups, err = s.groupService.GetGroupStatistics(ctx)
+			return err
+		},
+		func() (err error) {
+			summary.Roles, err = s.roleService.GetRoleStatistics(ctx)
+			return err
+		},
+		func() (err error) {
+			summary.RecentRegistrations.Last24Hours, err = s.userService.CountRegistrationsSince(ctx, now.Add(-24*time.Hour))
+			return err
+		},
+		func() (err error) {
+			summary.RecentRegistrations.Last7Days, err = s.userService.CountRegistrationsSince(ctx, now.AddDate(0, 0, -7))
+			return err
+		},
+		func() (err error) {
+			summary.RecentRegistrations.Last30Days, err = s.userService.CountRegistrationsSince(ctx, now.AddDate(0, 0, -30))
+			return err
+		},
+	}
+
+	if err := runSummaryTasks(ctx, tasks); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// runSummaryTasks 执行汇总查询，返回第一个错误（按任务顺序）
+func runSummaryTasks(ctx context.Context, tasks []func() error) error {
+	if _, inTx := orm.SessionFromContext(ctx); inTx {
+		for _, task := range tasks {
+			if err := task(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task func() error) {
+			defer wg.Done()
+			errs[i] = task()
+		}(i, task)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPermissionRegistry 返回当前进程已注册的全部 required permissions（按权限码排序）
+//
+// 每项标明是否属于 AllPermissions 与注册点，用于排查守卫了无法授予角色的权限的路由。
+func (s *AdminService) GetPermissionRegistry(ctx context.Context) []*svc.PermissionRegistryEntry {
+	catalog := make(map[string]struct{}, len(svc.AllPermissions))
+	for _, permission := range svc.AllPermissions {
+		catalog[permission] = struct{}{}
+	}
+
+	registry := iammw.RequiredPermissionsWithRedactedCallsites()
+	entries := make([]*svc.PermissionRegistryEntry, 0, len(registry))
+	for permission, callsites := range registry {
+		_, inCatalog := catalog[permission]
+		entries = append(entries, &svc.PermissionRegistryEntry{
+			Permission: permission,
+			InCatalog:  inCatalog,
+			Callsites:  callsites,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Permission < entries[j].Permission })
+	return entries
+}
@@ -0,0 +1,177 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	grouprepo "gochen-iam/repo/group"
+	rolerepo "gochen-iam/repo/role"
+	userrepo "gochen-iam/repo/user"
+	svc "gochen-iam/service"
+	adminsvc "gochen-iam/service/admin"
+	groupsvc "gochen-iam/service/group"
+	rolesvc "gochen-iam/service/role"
+	usersvc "gochen-iam/service/user"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// adminServiceTestEnv 管理端聚合服务测试环境
+type adminServiceTestEnv struct {
+	db            *gorm.DB
+	adminService  *adminsvc.AdminService
+	userService   *usersvc.UserService
+	groupService  *groupsvc.GroupService
+	roleService   *rolesvc.RoleService
+	backgroundCtx context.Context
+	cancelFunc    context.CancelFunc
+}
+
+// setupAdminServiceTest 设置测试环境
+func setupAdminServiceTest(t *testing.T) *adminServiceTestEnv {
+	dbPath := filepath.Join(t.TempDir(), "admin_test.db")
+
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&iamentity.User{},
+		&iamentity.Group{},
+		&iamentity.Role{},
+		&iamentity.UserGroup{},
+		&iamentity.UserRoleAssignment{},
+		&iamentity.RolePermissionEvent{},
+		&iamentity.PasswordHistory{},
+	); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+
+	ormAdapter := newAdminTestOrm(db)
+	userRepo, err := userrepo.NewUserRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewUserRepository: %v", err)
+	}
+	groupRepo, err := grouprepo.NewGroupRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewGroupRepository: %v", err)
+	}
+	roleRepo, err := rolerepo.NewRoleRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewRoleRepository: %v", err)
+	}
+
+	userService := usersvc.NewUserService(userRepo, groupRepo, roleRepo, nil, nil)
+	groupService := groupsvc.NewGroupService(groupRepo, userRepo, roleRepo)
+	roleService := rolesvc.NewRoleService(roleRepo, userRepo, groupRepo, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	return &adminServiceTestEnv{
+		db:            db,
+		adminService:  adminsvc.NewAdminService(userService, groupService, roleService),
+		userService:   userService,
+		groupService:  groupService,
+		roleService:   roleService,
+		backgroundCtx: ctx,
+		cancelFunc:    cancel,
+	}
+}
+
+// teardown 清理测试环境
+func (env *adminServiceTestEnv) teardown(t *testing.T) {
+	env.cancelFunc()
+
+	sqlDB, err := env.db.DB()
+	if err == nil {
+		sqlDB.Close()
+	}
+}
+
+func TestAdminServiceGetSummary(t *testing.T) {
+	env := setupAdminServiceTest(t)
+	defer env.teardown(t)
+
+	// 3 个用户：其中 1 个注册于 10 天前
+	var oldUser *iamentity.User
+	for _, name := range []string{"summary_a", "summary_b", "summary_old"} {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: name,
+			Email:    name + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("register %s: %v", name, err)
+		}
+		oldUser = user
+	}
+	if err := env.db.Exec("UPDATE users SET created_at = ? WHERE id = ?",
+		time.Now().AddDate(0, 0, -10), oldUser.GetID()).Error; err != nil {
+		t.Fatalf("backdate user: %v", err)
+	}
+
+	root, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "汇总根组织"})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	rootID := root.GetID()
+	if _, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "汇总子组织", ParentID: &rootID}); err != nil {
+		t.Fatalf("create child group: %v", err)
+	}
+
+	role := &iamentity.Role{
+		Name:        "summary_role",
+		Permissions: iamentity.PermissionArray([]string{"user:read"}),
+		Status:      svc.RoleStatusInactive,
+	}
+	if err := env.db.Create(role).Error; err != nil {
+		t.Fatalf("create role: %v", err)
+	}
+
+	summary, err := env.adminService.GetSummary(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get summary: %v", err)
+	}
+
+	// 与各独立数据源一致
+	groupStats, err := env.groupService.GetGroupStatistics(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get group statistics: %v", err)
+	}
+	if !reflect.DeepEqual(summary.Groups, groupStats) {
+		t.Errorf("group statistics mismatch: %+v vs %+v", summary.Groups, groupStats)
+	}
+	roleStats, err := env.roleService.GetRoleStatistics(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get role statistics: %v", err)
+	}
+	if !reflect.DeepEqual(summary.Roles, roleStats) {
+		t.Errorf("role statistics mismatch: %+v vs %+v", summary.Roles, roleStats)
+	}
+
+	recent := summary.RecentRegistrations
+	if recent.Last24Hours != 2 || recent.Last7Days != 2 || recent.Last30Days != 3 {
+		t.Errorf("unexpected recent registrations: %+v", recent)
+	}
+	if summary.Groups.TotalUsers != 3 || summary.Groups.TotalGroups != 2 {
+		t.Errorf("unexpected totals: %+v", summary.Groups)
+	}
+
+	// 不包含敏感数据
+	raw, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("marshal summary: %v", err)
+	}
+	for _, sensitive := range []string{"password", "email", "summary_a"} {
+		if strings.Contains(string(raw), sensitive) {
+			t.Errorf("summary should not contain %q: %s", sensitive, raw)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+
+	iamentity "gochen-iam/entity"
+	"gochen/errorx"
+)
+
+// 错误上下文键：标识出错的资源类型与 id，便于 API 层精确提示是哪个参数无效。
+const (
+	ErrorContextResource   = "resource"
+	ErrorContextResourceID = "resource_id"
+)
+
+// WithResourceContext 为错误附加资源上下文（resource/resource_id），保留原错误码与信息。
+//
+// 非 AppError 的错误统一包装为 Database 错误后再附加上下文；err 为 nil 时返回 nil。
+func WithResourceContext(err error, resource string, id int64) error {
+	if err == nil {
+		return nil
+	}
+	var appErr *errorx.AppError
+	if !errors.As(err, &appErr) {
+		appErr = errorx.Wrap(err, errorx.Database, "查询资源失败")
+	}
+	return appErr.
+		WithContext(ErrorContextResource, resource).
+		WithContext(ErrorContextResourceID, id)
+}
+
+// InactiveUserError 返回非 active 用户的拒绝错误
+//
+// 统一返回 Forbidden（凭证错误仍为 Validation/NotFound），消息与 reason 按状态区分：
+//   - pending：开启邮箱验证时为“邮箱未验证”（reason=email_not_verified），否则为“待激活”（reason=account_pending）；
+//   - locked：管理员锁定（reason=account_locked）；
+//   - inactive：已停用（reason=account_inactive）。
+func InactiveUserError(user *iamentity.User) error {
+	switch {
+	case user.IsPending() && RequireEmailVerification():
+		return errorx.New(errorx.Forbidden, "邮箱未验证，请先完成邮箱验证").
+			WithContext("reason", "email_not_verified")
+	case user.IsPending():
+		return errorx.New(errorx.Forbidden, "用户账户待激活").
+			WithContext("reason", "account_pending")
+	case user.IsLocked():
+		return errorx.New(errorx.Forbidden, "用户账户已被锁定，请联系管理员").
+			WithContext("reason", "account_locked")
+	case user.Status == UserStatusInactive:
+		return errorx.New(errorx.Forbidden, "用户账户已停用").
+			WithContext("reason", "account_inactive")
+	}
+	return errorx.New(errorx.Forbidden, "用户账户已被禁用")
+}
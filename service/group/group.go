@@ -2,9 +2,17 @@ package group
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	iamentity "gochen-iam/entity"
+	"gochen-iam/repo/actor"
+	"gochen-iam/repo/ctxcheck"
 	grouprepo "gochen-iam/repo/group"
 	rolerepo "gochen-iam/repo/role"
 	userrepo "gochen-iam/repo/user"
@@ -18,7 +26,11 @@ type GroupService struct {
 	groupRepo *grouprepo.GroupRepo
 	userRepo  *userrepo.UserRepo
 	roleRepo  *rolerepo.RoleRepo
+	validator *svc.BusinessValidator
 	logger    logging.ILogger
+
+	// nameCaseFold 组织名称是否统一转为小写（默认仅去除首尾空白）
+	nameCaseFold bool
 }
 
 // NewGroupService 创建组织服务实例
@@ -31,13 +43,25 @@ func NewGroupService(
 		groupRepo: groupRepo,
 		userRepo:  userRepo,
 		roleRepo:  roleRepo,
+		validator: svc.NewBusinessValidator(userRepo, groupRepo, roleRepo),
 		logger:    logging.ComponentLogger("iam.service.group"),
 	}
 }
 
+// SetNameCaseFold 设置组织名称是否忽略大小写（开启后名称统一转为小写再校验唯一性与落库）。
+//
+// 名称始终去除首尾空白；同级重名检查按规范化后的名称比较，开启前已落库的名称不会被改写。
+func (s *GroupService) SetNameCaseFold(enabled bool) {
+	s.nameCaseFold = enabled
+	s.validator.SetNameCaseFold(enabled)
+}
+
 // CreateGroup 创建组织
 func (s *GroupService) CreateGroup(ctx context.Context, req *svc.CreateGroupRequest) (*iamentity.Group, error) {
-	// 1. 验证请求数据
+	// 1. 规范化名称并验证请求数据
+	normalized := *req
+	normalized.Name = svc.NormalizeName(req.Name, s.nameCaseFold)
+	req = &normalized
 	if err := s.validateCreateGroupRequest(req); err != nil {
 		return nil, err
 	}
@@ -51,14 +75,16 @@ func (s *GroupService) CreateGroup(ctx context.Context, req *svc.CreateGroupRequ
 		}
 		parentGroup = parent
 
-		// 检查层级限制
-		if parentGroup.Level >= svc.MaxGroupLevel {
-			return nil, errorx.New(errorx.Validation, "组织层级不能超过10级")
+		// 检查层级限制（按实际祖先链计算深度，并以此修正子组织的层级）
+		level, err := s.validator.ChildGroupLevel(ctx, parent.GetID())
+		if err != nil {
+			return nil, err
 		}
+		parentGroup.Level = level - 1
 	}
 
 	// 3. 检查组织名称是否重复（同一层级下）
-	if err := s.checkGroupNameDuplicate(ctx, req.Name, req.ParentID); err != nil {
+	if err := s.checkGroupNameDuplicate(ctx, req.Name, req.ParentID, 0); err != nil {
 		return nil, err
 	}
 
@@ -77,23 +103,37 @@ func (s *GroupService) CreateGroup(ctx context.Context, req *svc.CreateGroupRequ
 		group.Level = 1
 	}
 
-	// 6. 保存组织
-	if err := s.groupRepo.Create(ctx, group); err != nil {
-		return nil, errorx.Wrap(err, errorx.Database, "保存组织失败")
+	// 6. 在事务内保存组织并写入路径（路径依赖 ID，两步一起提交或回滚）
+	if err := s.createWithPath(ctx, group); err != nil {
+		return nil, err
 	}
 
-	// 7. 更新路径（需要ID）
-	group.UpdatePath()
-	if err := s.groupRepo.Update(ctx, group); err != nil {
-		// 记录错误但不影响创建流程
-		s.logger.Warn(ctx, "[GroupService] 更新组织路径失败",
-			logging.Error(err),
-			logging.Int64("group_id", group.GetID()),
-			logging.String("group_name", group.Name),
-		)
+	return group, nil
+}
+
+// createWithPath 在事务内插入组织并按生成的 ID 更新路径；任一步失败整体回滚，不会留下空路径的组织
+func (s *GroupService) createWithPath(ctx context.Context, group *iamentity.Group) (err error) {
+	txCtx, err := s.groupRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
 	}
+	defer func() {
+		if err != nil {
+			_ = s.groupRepo.Rollback(txCtx)
+		}
+	}()
 
-	return group, nil
+	if err = s.groupRepo.Create(txCtx, group); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存组织失败")
+	}
+	group.UpdatePath()
+	if err = s.groupRepo.Update(txCtx, group); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新组织路径失败")
+	}
+	if err = s.groupRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	return nil
 }
 
 // UpdateGroup 更新组织
@@ -105,12 +145,13 @@ func (s *GroupService) UpdateGroup(ctx context.Context, groupID int64, req *svc.
 	}
 
 	// 2. 更新字段
-	if req.Name != "" && req.Name != (*group).Name {
-		// 检查名称是否重复
-		if err := s.checkGroupNameDuplicate(ctx, req.Name, (*group).ParentID); err != nil {
+	name := svc.NormalizeName(req.Name, s.nameCaseFold)
+	if name != "" && name != (*group).Name {
+		// 检查名称是否重复（排除自身，允许仅规范化大小写/空白）
+		if err := s.checkGroupNameDuplicate(ctx, name, (*group).ParentID, groupID); err != nil {
 			return nil, err
 		}
-		(*group).Name = req.Name
+		(*group).Name = name
 	}
 
 	if req.Description != "" {
@@ -127,6 +168,107 @@ func (s *GroupService) UpdateGroup(ctx context.Context, groupID int64, req *svc.
 	return group, nil
 }
 
+// MoveGroup 将组织（连同其子树）移动到新的父组织下（newParentID 为 nil 表示移动为根组织）
+func (s *GroupService) MoveGroup(ctx context.Context, groupID int64, newParentID *int64) (*iamentity.Group, error) {
+	// 1. 获取组织
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if sameParent(group.ParentID, newParentID) {
+		return group, nil
+	}
+
+	// 2. 校验目标父组织（自身/环/名称唯一性）
+	if err := s.validator.ValidateGroupMove(ctx, group, newParentID); err != nil {
+		return nil, err
+	}
+
+	// 3. 计算新的层级与路径（层级与创建一致按实际祖先链计算，不信任父组织缓存的 Level）
+	newLevel := 1
+	newPath := "/" + strconv.FormatInt(group.GetID(), 10)
+	if newParentID != nil {
+		parent, err := s.groupRepo.GetByID(ctx, *newParentID)
+		if err != nil {
+			return nil, errorx.Wrap(err, errorx.NotFound, "新父组织不存在")
+		}
+		if newLevel, err = s.validator.ChildGroupLevel(ctx, parent.GetID()); err != nil {
+			return nil, err
+		}
+		newPath = parent.Path + newPath
+	}
+
+	// 4. 按旧路径前缀加载子树，并校验移动后最深节点不超过层级上限
+	oldPath := group.Path
+	oldLevel := group.GetLevel()
+	var descendants []*iamentity.Group
+	if oldPath != "" {
+		descendants, err = s.groupRepo.FindByPathPrefix(ctx, oldPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	delta := newLevel - oldLevel
+	deepest := newLevel
+	for _, d := range descendants {
+		if level := d.Level + delta; level > deepest {
+			deepest = level
+		}
+	}
+	if deepest > svc.MaxGroupLevel {
+		return nil, errorx.New(errorx.Validation, fmt.Sprintf("移动后组织层级不能超过%d级", svc.MaxGroupLevel))
+	}
+
+	// 5. 在事务内更新组织自身与后代的层级与路径
+	if err := s.applyMove(ctx, group.GetID(), newParentID, newLevel, newPath, oldPath, delta, descendants); err != nil {
+		return nil, err
+	}
+
+	// 6. 祖先组织变化影响继承的默认角色
+	svc.InvalidateAllPermissionCache()
+
+	group.ParentID = newParentID
+	group.Level = newLevel
+	group.Path = newPath
+	return group, nil
+}
+
+// applyMove 在事务内更新组织自身，并按路径前缀重算后代的层级与路径（父级不变）；
+// 任一步失败整体回滚，不会留下父级已变而后代路径未更新的子树
+func (s *GroupService) applyMove(ctx context.Context, groupID int64, newParentID *int64, newLevel int, newPath, oldPath string, delta int, descendants []*iamentity.Group) (err error) {
+	txCtx, err := s.groupRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.groupRepo.Rollback(txCtx)
+		}
+	}()
+
+	if err = s.groupRepo.UpdateHierarchy(txCtx, groupID, newParentID, newLevel, newPath); err != nil {
+		return err
+	}
+	for _, d := range descendants {
+		path := newPath + strings.TrimPrefix(d.Path, oldPath)
+		if err = s.groupRepo.UpdateHierarchy(txCtx, d.GetID(), d.ParentID, d.Level+delta, path); err != nil {
+			return err
+		}
+	}
+	if err = s.groupRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	return nil
+}
+
+// sameParent 判断两个父组织 ID 是否相同（均为 nil 视为相同）
+func sameParent(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
 // DeleteGroup 删除组织
 func (s *GroupService) DeleteGroup(ctx context.Context, groupID int64) error {
 	// 1. 检查是否有子组织
@@ -165,19 +307,210 @@ func (s *GroupService) GetGroupTree(ctx context.Context) ([]*svc.GroupTreeNode,
 	return nodes, nil
 }
 
+// GetTreeChecksum 计算组织树校验值（用于 ETag / 客户端缓存）
+//
+// 基于所有组织的 id/parent/name/description/level/updated_at 以及成员数量计算 SHA-256，
+// 组织树内容（含 user_count）不变时结果稳定。
+func (s *GroupService) GetTreeChecksum(ctx context.Context) (string, error) {
+	groups, err := s.groupRepo.FindAllLite(ctx)
+	if err != nil {
+		return "", err
+	}
+	memberCounts, err := s.groupRepo.CountMembersByGroup(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, group := range groups {
+		parentID := int64(0)
+		if group.ParentID != nil {
+			parentID = *group.ParentID
+		}
+		fmt.Fprintf(h, "%d|%d|%q|%q|%d|%d|%d\n",
+			group.GetID(),
+			parentID,
+			group.Name,
+			group.Description,
+			group.Level,
+			group.UpdatedAt.UnixNano(),
+			memberCounts[group.GetID()],
+		)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SearchGroupsPaged 分页搜索组织（用于管理端列表）
+//
+// parentID 非空时仅在该组织的直接子组织中搜索（父组织不存在时返回 NotFound）；不含软删除的组织，
+// 结果按 ID 升序，total 为满足条件的总数。
+func (s *GroupService) SearchGroupsPaged(ctx context.Context, keyword string, parentID *int64, offset, limit int) ([]*iamentity.Group, int64, error) {
+	// 1. 校验参数
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+	if parentID != nil {
+		if _, err := s.groupRepo.GetByID(ctx, *parentID); err != nil {
+			return nil, 0, svc.WithResourceContext(err, "group", *parentID)
+		}
+	}
+
+	// 2. 查询
+	return s.groupRepo.SearchGroupsPaged(ctx, strings.TrimSpace(keyword), parentID, offset, limit)
+}
+
 // GetRootGroups 获取根组织
 func (s *GroupService) GetRootGroups(ctx context.Context) ([]*iamentity.Group, error) {
 	return s.groupRepo.FindRootGroups(ctx)
 }
 
+// GetGroupAncestors 获取组织的祖先链（根组织在前，不含组织本身），可用于面包屑导航
+func (s *GroupService) GetGroupAncestors(ctx context.Context, groupID int64) ([]*iamentity.Group, error) {
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.FindAncestors(ctx, groupID)
+}
+
+// GetGroupDescendants 获取组织的全部后代组织（深度优先，不含组织本身）
+func (s *GroupService) GetGroupDescendants(ctx context.Context, groupID int64) ([]*iamentity.Group, error) {
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.groupRepo.FindDescendants(ctx, groupID)
+}
+
 // GetGroupsByLevel 根据层级获取组织
 func (s *GroupService) GetGroupsByLevel(ctx context.Context, level int) ([]*iamentity.Group, error) {
 	return s.groupRepo.FindByLevel(ctx, level)
 }
 
-// GetGroupUsers 获取组织用户列表
-func (s *GroupService) GetGroupUsers(ctx context.Context, groupID int64) ([]*iamentity.User, error) {
-	return s.userRepo.FindByGroupID(ctx, groupID)
+// GetGroupsByLevelRange 获取层级在 [minLevel, maxLevel] 闭区间内的组织
+//
+// 如查询“2 级及以下”的组织：GetGroupsByLevelRange(ctx, 2, svc.MaxGroupLevel)。
+func (s *GroupService) GetGroupsByLevelRange(ctx context.Context, minLevel, maxLevel int) ([]*iamentity.Group, error) {
+	if minLevel < 1 || maxLevel < 1 {
+		return nil, errorx.New(errorx.Validation, "组织层级必须大于0")
+	}
+	if minLevel > maxLevel {
+		return nil, errorx.New(errorx.Validation, "最小层级不能大于最大层级")
+	}
+	return s.groupRepo.FindByLevelRange(ctx, minLevel, maxLevel)
+}
+
+// GetGroupUsers 获取组织用户列表（附带加入时间，已清除敏感字段）
+func (s *GroupService) GetGroupUsers(ctx context.Context, groupID int64) ([]*svc.GroupMember, error) {
+	users, err := s.userRepo.FindByGroupID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.toGroupMembers(ctx, groupID, users)
+}
+
+// GetGroupUsersPaged 分页获取组织直接成员（附加入时间，已清除敏感字段），并返回成员总数
+func (s *GroupService) GetGroupUsersPaged(ctx context.Context, groupID int64, offset, limit int) ([]*svc.GroupMember, int64, error) {
+	// 1. 校验参数
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+
+	// 2. 查询
+	users, total, err := s.userRepo.FindByGroupIDPaged(ctx, groupID, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 3. 附加加入时间并清除敏感字段
+	members, err := s.toGroupMembers(ctx, groupID, users)
+	if err != nil {
+		return nil, 0, err
+	}
+	return members, total, nil
+}
+
+// toGroupMembers 为用户附加组织加入时间，并清除敏感字段
+func (s *GroupService) toGroupMembers(ctx context.Context, groupID int64, users []*iamentity.User) ([]*svc.GroupMember, error) {
+	joinedAt, err := s.GetGroupUserMembershipTimestamps(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.StripUserSecrets(users...)
+	members := make([]*svc.GroupMember, 0, len(users))
+	for _, user := range users {
+		member := &svc.GroupMember{User: user}
+		if t, ok := joinedAt[user.GetID()]; ok {
+			member.JoinedAt = &t
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// GetGroupUsersRecursive 获取组织及其所有后代组织的用户（按用户 ID 去重）
+//
+// 结果按发现顺序返回：先本组织成员，再按后代组织遍历顺序追加尚未出现的用户；已清除敏感字段。
+func (s *GroupService) GetGroupUsersRecursive(ctx context.Context, groupID int64) ([]*iamentity.User, error) {
+	// 1. 确认组织存在
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	// 2. 收集本组织及所有后代组织
+	descendants, err := s.groupRepo.FindDescendants(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := make([]int64, 0, len(descendants)+1)
+	groupIDs = append(groupIDs, groupID)
+	for _, d := range descendants {
+		groupIDs = append(groupIDs, d.GetID())
+	}
+
+	// 3. 合并成员并按用户 ID 去重
+	seen := make(map[int64]struct{})
+	users := make([]*iamentity.User, 0)
+	for _, id := range groupIDs {
+		if err := ctxcheck.Check(ctx, "查询组织成员已取消"); err != nil {
+			return nil, err
+		}
+		members, err := s.userRepo.FindByGroupID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range members {
+			if _, ok := seen[user.GetID()]; ok {
+				continue
+			}
+			seen[user.GetID()] = struct{}{}
+			users = append(users, user)
+		}
+	}
+	svc.StripUserSecrets(users...)
+	return users, nil
+}
+
+// GetGroupUserMembershipTimestamps 获取组织成员的加入时间（userID -> joined_at）
+//
+// 未记录加入时间的历史成员不会出现在结果中，可先调用 BackfillMembershipJoinedAt 回填。
+func (s *GroupService) GetGroupUserMembershipTimestamps(ctx context.Context, groupID int64) (map[int64]time.Time, error) {
+	memberships, err := s.groupRepo.FindMemberships(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64]time.Time, len(memberships))
+	for _, m := range memberships {
+		if m.JoinedAt != nil {
+			result[m.UserID] = *m.JoinedAt
+		}
+	}
+	return result, nil
+}
+
+// BackfillMembershipJoinedAt 回填历史成员关系的加入时间，返回回填数量
+func (s *GroupService) BackfillMembershipJoinedAt(ctx context.Context) (int64, error) {
+	return s.groupRepo.BackfillMembershipJoinedAt(ctx)
 }
 
 // AddUserToGroup 添加用户到组织
@@ -187,15 +520,54 @@ func (s *GroupService) AddUserToGroup(ctx context.Context, groupID, userID int64
 		return err
 	}
 	// 确认组织存在
-	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	// 添加成员（开启默认角色同步时同一事务内授予，见 svc.SetSyncGroupDefaultRoles）
+	if err := svc.JoinGroup(ctx, s.userRepo, s.groupRepo, s.roleRepo, s.logger, groupID, userID); err != nil {
 		return err
 	}
-	return s.groupRepo.AddUserToGroup(ctx, groupID, userID)
+	svc.InvalidateUserPermissionCache(userID)
+
+	// 记录成员变更（最佳努力，不影响主流程）
+	s.recordGroupChange(ctx, userID, groupID, group.Name, iamentity.GroupMembershipJoined)
+	return nil
 }
 
 // RemoveUserFromGroup 从组织移除用户
 func (s *GroupService) RemoveUserFromGroup(ctx context.Context, groupID, userID int64) error {
-	return s.groupRepo.RemoveUserFromGroup(ctx, groupID, userID)
+	if err := svc.LeaveGroup(ctx, s.userRepo, s.groupRepo, s.roleRepo, s.logger, groupID, userID); err != nil {
+		return err
+	}
+	svc.InvalidateUserPermissionCache(userID)
+
+	// 记录成员变更（最佳努力；组织已删除时名称为空）
+	var groupName string
+	if group, err := s.groupRepo.GetByID(ctx, groupID); err == nil {
+		groupName = group.Name
+	}
+	s.recordGroupChange(ctx, userID, groupID, groupName, iamentity.GroupMembershipLeft)
+	return nil
+}
+
+// recordGroupChange 记录用户组织成员变更（失败仅告警）
+func (s *GroupService) recordGroupChange(ctx context.Context, userID, groupID int64, groupName, action string) {
+	change := &iamentity.UserGroupChange{
+		UserID:    userID,
+		GroupID:   groupID,
+		GroupName: groupName,
+		Action:    action,
+		ChangedAt: time.Now(),
+	}
+	if err := s.userRepo.RecordGroupChange(ctx, change); err != nil {
+		s.logger.Warn(ctx, "[GroupService] 记录组织成员变更失败",
+			logging.Error(err),
+			logging.Int64("user_id", userID),
+			logging.Int64("group_id", groupID),
+			logging.String("action", action),
+		)
+	}
 }
 
 // BatchAddUsersToGroup 批量添加用户到组织
@@ -214,9 +586,9 @@ func (s *GroupService) BatchAddUsersToGroup(ctx context.Context, groupID int64,
 	return response, nil
 }
 
-// GetGroupRoles 获取组织默认角色
-func (s *GroupService) GetGroupRoles(ctx context.Context, groupID int64) ([]*iamentity.Role, error) {
-	return s.roleRepo.FindByGroupID(ctx, groupID)
+// GetGroupRoles 获取组织默认角色（默认仅 active 且未软删除，见 svc.ListOptions；按角色 ID 升序）
+func (s *GroupService) GetGroupRoles(ctx context.Context, groupID int64, opts svc.ListOptions) ([]*iamentity.Role, error) {
+	return s.roleRepo.FindByGroupID(ctx, groupID, opts.IncludeInactive, opts.IncludeDeleted)
 }
 
 // AddGroupRole 为组织添加默认角色
@@ -229,12 +601,218 @@ func (s *GroupService) AddGroupRole(ctx context.Context, groupID, roleID int64)
 	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
 		return err
 	}
-	return s.groupRepo.AddDefaultRole(ctx, groupID, roleID)
+	if err := s.groupRepo.AddDefaultRole(ctx, groupID, roleID); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+	s.recordGroupRoleEvent(ctx, groupID, roleID, iamentity.GroupRoleEventAdded)
+	return nil
 }
 
 // RemoveGroupRole 移除组织默认角色
 func (s *GroupService) RemoveGroupRole(ctx context.Context, groupID, roleID int64) error {
-	return s.groupRepo.RemoveDefaultRole(ctx, groupID, roleID)
+	if err := s.groupRepo.RemoveDefaultRole(ctx, groupID, roleID); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+	s.recordGroupRoleEvent(ctx, groupID, roleID, iamentity.GroupRoleEventRemoved)
+	return nil
+}
+
+// GetGroupRoleHistory 获取组织默认角色变更审计记录（按时间正序）
+func (s *GroupService) GetGroupRoleHistory(ctx context.Context, groupID int64) ([]*iamentity.GroupRoleEvent, error) {
+	// 1. 确认组织存在
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询审计记录
+	return s.groupRepo.FindGroupRoleEvents(ctx, groupID)
+}
+
+// recordGroupRoleEvent 记录组织默认角色变更（最佳努力：失败仅告警，不影响主流程）
+func (s *GroupService) recordGroupRoleEvent(ctx context.Context, groupID, roleID int64, action string) {
+	event := &iamentity.GroupRoleEvent{
+		GroupID:   groupID,
+		RoleID:    roleID,
+		Action:    action,
+		ActorID:   actor.FromContext(ctx),
+		CreatedAt: time.Now(),
+	}
+	if err := s.groupRepo.RecordGroupRoleEvent(ctx, event); err != nil {
+		s.logger.Warn(ctx, "[GroupService] 记录组织角色变更失败",
+			logging.Error(err),
+			logging.Int64("group_id", groupID),
+			logging.Int64("role_id", roleID),
+			logging.String("action", action),
+		)
+	}
+}
+
+// GetGroupContributedPermissions 获取用户所属各组织通过激活的默认角色贡献的权限
+//
+// 每个所属组织返回一项（按组织 id 升序），角色名与权限去重并排序；
+// 停用或已删除的默认角色不计入，无贡献的组织返回空列表。
+func (s *GroupService) GetGroupContributedPermissions(ctx context.Context, userID int64) ([]*svc.GroupPermissionContribution, error) {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, svc.WithResourceContext(err, "user", userID)
+	}
+
+	// 2. 查询用户所属组织（预加载默认角色）
+	groups, err := s.groupRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GetID() < groups[j].GetID() })
+
+	// 3. 汇总每个组织的贡献
+	result := make([]*svc.GroupPermissionContribution, 0, len(groups))
+	for _, group := range groups {
+		roleSet := make(map[string]struct{})
+		permissionSet := make(map[string]struct{})
+		for _, role := range group.DefaultRoles {
+			if role == nil || role.DeletedAt != nil || !role.IsActive() {
+				continue
+			}
+			roleSet[role.Name] = struct{}{}
+			for _, permission := range role.Permissions {
+				if permission = strings.TrimSpace(permission); permission != "" {
+					permissionSet[permission] = struct{}{}
+				}
+			}
+		}
+
+		result = append(result, &svc.GroupPermissionContribution{
+			GroupID:     group.GetID(),
+			GroupName:   group.Name,
+			Roles:       sortedKeys(roleSet),
+			Permissions: sortedKeys(permissionSet),
+		})
+	}
+
+	return result, nil
+}
+
+// GetMembersWithEffectiveRoles 批量解析组织成员的有效角色（用于组织架构报表）
+//
+// 有效角色 = 直接分配（未过期）+ 成员所属全部组织的默认角色，仅计入 active 且未软删的角色；
+// 不含祖先组织继承。查询次数与成员数无关（成员、成员关系、角色分配、组织角色、角色各一次），结果按用户 id 升序。
+func (s *GroupService) GetMembersWithEffectiveRoles(ctx context.Context, groupID int64) ([]*svc.GroupMemberEffectiveRoles, error) {
+	// 1. 检查组织是否存在
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return nil, svc.WithResourceContext(err, "group", groupID)
+	}
+
+	// 2. 查询成员
+	users, err := s.userRepo.FindByGroupID(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return []*svc.GroupMemberEffectiveRoles{}, nil
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].GetID() < users[j].GetID() })
+	userIDs := make([]int64, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.GetID())
+	}
+
+	// 3. 批量查询直接角色与所属组织
+	assignments, err := s.roleRepo.FindUserRoleAssignments(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	memberships, err := s.groupRepo.FindMembershipsByUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDsByUser := make(map[int64][]int64, len(users))
+	for _, a := range assignments {
+		roleIDsByUser[a.UserID] = append(roleIDsByUser[a.UserID], a.RoleID)
+	}
+	groupIDsByUser := make(map[int64][]int64, len(users))
+	groupIDSet := make(map[int64]struct{})
+	for _, m := range memberships {
+		groupIDsByUser[m.UserID] = append(groupIDsByUser[m.UserID], m.GroupID)
+		groupIDSet[m.GroupID] = struct{}{}
+	}
+
+	// 4. 批量查询组织默认角色
+	groupIDs := make([]int64, 0, len(groupIDSet))
+	for id := range groupIDSet {
+		groupIDs = append(groupIDs, id)
+	}
+	roleIDsByGroup, err := s.roleRepo.FindGroupRoleIDs(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 5. 批量加载涉及的角色
+	roleIDSet := make(map[int64]struct{})
+	for _, ids := range roleIDsByUser {
+		for _, id := range ids {
+			roleIDSet[id] = struct{}{}
+		}
+	}
+	for _, ids := range roleIDsByGroup {
+		for _, id := range ids {
+			roleIDSet[id] = struct{}{}
+		}
+	}
+	roleIDs := make([]int64, 0, len(roleIDSet))
+	for id := range roleIDSet {
+		roleIDs = append(roleIDs, id)
+	}
+	roleNames := make(map[int64]string, len(roleIDs))
+	if len(roleIDs) > 0 {
+		roles, err := s.roleRepo.ListByIds(ctx, roleIDs)
+		if err != nil {
+			return nil, errorx.Wrap(err, errorx.Database, "查询角色失败")
+		}
+		for _, role := range roles {
+			if role == nil || role.DeletedAt != nil || !role.IsActive() {
+				continue
+			}
+			roleNames[role.GetID()] = strings.TrimSpace(role.Name)
+		}
+	}
+
+	// 6. 组装每个成员的有效角色
+	result := make([]*svc.GroupMemberEffectiveRoles, 0, len(users))
+	for _, user := range users {
+		roleSet := make(map[string]struct{})
+		addRoles := func(ids []int64) {
+			for _, id := range ids {
+				if name := roleNames[id]; name != "" {
+					roleSet[name] = struct{}{}
+				}
+			}
+		}
+		addRoles(roleIDsByUser[user.GetID()])
+		for _, gid := range groupIDsByUser[user.GetID()] {
+			addRoles(roleIDsByGroup[gid])
+		}
+
+		result = append(result, &svc.GroupMemberEffectiveRoles{
+			UserID:   user.GetID(),
+			Username: user.Username,
+			Roles:    sortedKeys(roleSet),
+		})
+	}
+
+	return result, nil
+}
+
+// sortedKeys 返回集合中的元素（字典序）
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // GetGroupStatistics 获取组织统计信息
@@ -294,29 +872,15 @@ func (s *GroupService) validateCreateGroupRequest(req *svc.CreateGroupRequest) e
 	return nil
 }
 
-// checkGroupNameDuplicate 检查组织名称是否重复
-func (s *GroupService) checkGroupNameDuplicate(ctx context.Context, name string, parentID *int64) error {
-	var (
-		groups []*iamentity.Group
-		err    error
-	)
-
-	if parentID == nil {
-		groups, err = s.groupRepo.FindRootGroups(ctx)
-	} else {
-		groups, err = s.groupRepo.FindChildren(ctx, *parentID)
-	}
-
+// checkGroupNameDuplicate 检查组织名称是否重复（按规范化后的名称比较，excludeID 为自身 ID，0 表示不排除）
+func (s *GroupService) checkGroupNameDuplicate(ctx context.Context, name string, parentID *int64, excludeID int64) error {
+	exists, err := s.groupRepo.ExistsByNormalizedName(ctx, name, parentID, excludeID, s.nameCaseFold)
 	if err != nil {
 		return err
 	}
-
-	for _, group := range groups {
-		if group.Name == name {
-			return errorx.New(errorx.Validation, "同一层级下组织名称不能重复")
-		}
+	if exists {
+		return errorx.New(errorx.Validation, "同一层级下组织名称不能重复")
 	}
-
 	return nil
 }
 
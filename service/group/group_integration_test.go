@@ -2,8 +2,10 @@ package group_test
 
 import (
 	"context"
+	"errors"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -15,6 +17,7 @@ import (
 	groupsvc "gochen-iam/service/group"
 	usersvc "gochen-iam/service/user"
 	"gochen/errorx"
+	"gochen/httpx"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -54,6 +57,13 @@ func setupGroupServiceTest(t *testing.T) *groupServiceTestEnv {
 		&iamentity.Group{},
 		&iamentity.User{},
 		&iamentity.Role{},
+		&iamentity.UserGroup{},
+		&iamentity.UserRoleAssignment{},
+		&iamentity.RolePermissionEvent{},
+		&iamentity.PasswordHistory{},
+		&iamentity.GroupRoleEvent{},
+		&iamentity.UserGroupChange{},
+		&iamentity.UserRoleChange{},
 	); err != nil {
 		t.Fatalf("auto migrate: %v", err)
 	}
@@ -74,7 +84,7 @@ func setupGroupServiceTest(t *testing.T) *groupServiceTestEnv {
 
 	// 创建服务
 	groupService := groupsvc.NewGroupService(groupRepo, userRepo, roleRepo)
-	userService := usersvc.NewUserService(userRepo, groupRepo, roleRepo)
+	userService := usersvc.NewUserService(userRepo, groupRepo, roleRepo, nil, nil)
 
 	// 创建背景上下文
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -212,6 +222,110 @@ func TestGroupServiceCreateDuplicateName(t *testing.T) {
 	}
 }
 
+// TestGroupServiceCreateGroupRollsBackOnPathFailure 测试创建组织时路径写入失败整体回滚
+func TestGroupServiceCreateGroupRollsBackOnPathFailure(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	// 注入路径更新失败：写入路径时触发器中止
+	if err := env.db.Exec(`CREATE TRIGGER fail_group_path BEFORE UPDATE OF path ON groups
+		WHEN NEW.name = '路径失败组织'
+		BEGIN SELECT RAISE(ABORT, 'injected path failure'); END`).Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	_, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "路径失败组织"})
+	if !errorx.Is(err, errorx.Database) {
+		t.Fatalf("expected Database error on path failure, got %v", err)
+	}
+
+	// 插入随事务回滚，组织未落库
+	var n int64
+	if err := env.db.Table("groups").Where("name = ?", "路径失败组织").Count(&n).Error; err != nil {
+		t.Fatalf("count groups: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected group not persisted, found %d rows", n)
+	}
+
+	// 其他组织正常创建且路径已写入
+	group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "路径正常组织"})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	stored, err := env.groupRepo.GetByID(env.backgroundCtx, group.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.Path == "" {
+		t.Fatal("expected path persisted")
+	}
+}
+
+// TestGroupServiceNameNormalization 测试组织名称去除首尾空白与可选的大小写折叠
+func TestGroupServiceNameNormalization(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	if _, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "Manager"}); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	// 默认仅去除空白：" Manager" 与 "Manager" 冲突，"manager" 不冲突
+	if _, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: " Manager"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for trimmed duplicate, got %v", err)
+	}
+	lower, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "manager "})
+	if err != nil {
+		t.Fatalf("expected distinct case to pass without case folding, got %v", err)
+	}
+	if lower.Name != "manager" {
+		t.Fatalf("expected trimmed name stored, got %q", lower.Name)
+	}
+	dev, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "Dev"})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if _, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "Finance"}); err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+
+	// 开启大小写折叠：与已有名称按规范化形式比较
+	env.groupService.SetNameCaseFold(true)
+	if _, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "MANAGER"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for case-folded duplicate, got %v", err)
+	}
+	other, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: " Ops "})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if other.Name != "ops" {
+		t.Fatalf("expected case-folded name stored, got %q", other.Name)
+	}
+	if _, err := env.groupService.UpdateGroup(env.backgroundCtx, other.GetID(), &svc.UpdateGroupRequest{Name: "Manager"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation on update to duplicate, got %v", err)
+	}
+
+	// 仅改变大小写/空白的自身更新不视为冲突
+	updated, err := env.groupService.UpdateGroup(env.backgroundCtx, dev.GetID(), &svc.UpdateGroupRequest{Name: " DEV "})
+	if err != nil {
+		t.Fatalf("expected self rename to pass, got %v", err)
+	}
+	if updated.Name != "dev" {
+		t.Fatalf("expected normalized name, got %q", updated.Name)
+	}
+
+	// 移动到新父组织时同样按规范化名称检查同级重名（"Finance" 为开启前落库的混合大小写名称）
+	parentID := other.GetID()
+	child, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "FINANCE", ParentID: &parentID})
+	if err != nil {
+		t.Fatalf("create child group: %v", err)
+	}
+	if _, err := env.groupService.MoveGroup(env.backgroundCtx, child.GetID(), nil); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation when moving next to a case-folded duplicate, got %v", err)
+	}
+}
+
 // TestGroupServiceUpdateGroup 测试更新组织
 func TestGroupServiceUpdateGroup(t *testing.T) {
 	env := setupGroupServiceTest(t)
@@ -348,6 +462,314 @@ func TestGroupServiceRemoveUserFromGroup(t *testing.T) {
 	}
 }
 
+// TestGroupServiceGetGroupUsersRecursive 测试递归获取组织（含后代）成员并去重
+func TestGroupServiceGetGroupUsersRecursive(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	// 三级组织树：root -> (subA, subB)，subA -> leaf
+	root, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "递归根组织"})
+	if err != nil {
+		t.Fatalf("create root: %v", err)
+	}
+	rootID := root.GetID()
+	subA, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "递归子组织A", ParentID: &rootID})
+	if err != nil {
+		t.Fatalf("create subA: %v", err)
+	}
+	subB, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "递归子组织B", ParentID: &rootID})
+	if err != nil {
+		t.Fatalf("create subB: %v", err)
+	}
+	subAID := subA.GetID()
+	leaf, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "递归叶子组织", ParentID: &subAID})
+	if err != nil {
+		t.Fatalf("create leaf: %v", err)
+	}
+
+	rootUser := env.createTestUser(t, "recursive_root", "recursive_root@example.com")
+	shared := env.createTestUser(t, "recursive_shared", "recursive_shared@example.com")
+	leafUser := env.createTestUser(t, "recursive_leaf", "recursive_leaf@example.com")
+	memberships := []struct {
+		groupID int64
+		userID  int64
+	}{
+		{root.GetID(), rootUser.GetID()},
+		{subA.GetID(), shared.GetID()},
+		{subB.GetID(), shared.GetID()},
+		{leaf.GetID(), leafUser.GetID()},
+	}
+	for _, m := range memberships {
+		if err := env.groupService.AddUserToGroup(env.backgroundCtx, m.groupID, m.userID); err != nil {
+			t.Fatalf("add user %d to group %d: %v", m.userID, m.groupID, err)
+		}
+	}
+
+	// 非递归只返回直属成员
+	direct, err := env.groupService.GetGroupUsers(env.backgroundCtx, root.GetID())
+	if err != nil {
+		t.Fatalf("get group users: %v", err)
+	}
+	if len(direct) != 1 {
+		t.Fatalf("expected 1 direct member, got %d", len(direct))
+	}
+
+	// 递归包含所有后代成员，同时属于两个子组织的用户只出现一次
+	users, err := env.groupService.GetGroupUsersRecursive(env.backgroundCtx, root.GetID())
+	if err != nil {
+		t.Fatalf("get group users recursive: %v", err)
+	}
+	counts := make(map[int64]int)
+	for _, u := range users {
+		counts[u.GetID()]++
+	}
+	if len(users) != 3 || counts[rootUser.GetID()] != 1 || counts[shared.GetID()] != 1 || counts[leafUser.GetID()] != 1 {
+		t.Fatalf("expected 3 de-duplicated users, got %v", counts)
+	}
+
+	// 从中间层查询只包含其子树
+	users, err = env.groupService.GetGroupUsersRecursive(env.backgroundCtx, subA.GetID())
+	if err != nil {
+		t.Fatalf("get subA users recursive: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users under subA, got %d", len(users))
+	}
+
+	// 不存在的组织
+	if _, err := env.groupService.GetGroupUsersRecursive(env.backgroundCtx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing group, got %v", err)
+	}
+}
+
+func TestGroupServiceAncestorsAndDescendants(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	// 三层结构：root -> (mid -> leaf, sibling)
+	root, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "层级根组织"})
+	if err != nil {
+		t.Fatalf("CreateGroup root failed: %v", err)
+	}
+	rootID := root.GetID()
+	mid, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "层级中间组织", ParentID: &rootID})
+	if err != nil {
+		t.Fatalf("CreateGroup mid failed: %v", err)
+	}
+	midID := mid.GetID()
+	leaf, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "层级叶子组织", ParentID: &midID})
+	if err != nil {
+		t.Fatalf("CreateGroup leaf failed: %v", err)
+	}
+	sibling, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "层级兄弟组织", ParentID: &rootID})
+	if err != nil {
+		t.Fatalf("CreateGroup sibling failed: %v", err)
+	}
+
+	// 祖先链按根在前排列，不含自身
+	ancestors, err := env.groupService.GetGroupAncestors(ctx, leaf.GetID())
+	if err != nil {
+		t.Fatalf("GetGroupAncestors failed: %v", err)
+	}
+	if len(ancestors) != 2 || ancestors[0].GetID() != rootID || ancestors[1].GetID() != midID {
+		t.Fatalf("unexpected ancestors: %+v", ancestors)
+	}
+	if ancestors, err := env.groupService.GetGroupAncestors(ctx, rootID); err != nil || len(ancestors) != 0 {
+		t.Fatalf("expected no ancestors for root, got %v (%v)", ancestors, err)
+	}
+
+	// 后代包含整棵子树，不含自身
+	descendants, err := env.groupService.GetGroupDescendants(ctx, rootID)
+	if err != nil {
+		t.Fatalf("GetGroupDescendants failed: %v", err)
+	}
+	got := map[int64]bool{}
+	for _, d := range descendants {
+		got[d.GetID()] = true
+	}
+	if len(descendants) != 3 || !got[midID] || !got[leaf.GetID()] || !got[sibling.GetID()] {
+		t.Fatalf("unexpected descendants: %+v", descendants)
+	}
+	if descendants, err := env.groupService.GetGroupDescendants(ctx, leaf.GetID()); err != nil || len(descendants) != 0 {
+		t.Fatalf("expected no descendants for leaf, got %v (%v)", descendants, err)
+	}
+
+	// 不存在的组织
+	if _, err := env.groupService.GetGroupAncestors(ctx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing group, got %v", err)
+	}
+	if _, err := env.groupService.GetGroupDescendants(ctx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing group, got %v", err)
+	}
+
+	// 父组织缺失的损坏层级返回错误而非截断
+	if err := env.db.Exec("UPDATE groups SET parent_id = ? WHERE id = ?", 99999, midID).Error; err != nil {
+		t.Fatalf("break hierarchy: %v", err)
+	}
+	if _, err := env.groupService.GetGroupAncestors(ctx, leaf.GetID()); !errorx.Is(err, errorx.Internal) {
+		t.Fatalf("expected Internal for broken hierarchy, got %v", err)
+	}
+}
+
+// TestGroupRepoFindDescendantsByPathMatchesRecursive 测试按路径前缀单次查询与逐层递归结果一致
+func TestGroupRepoFindDescendantsByPathMatchesRecursive(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	// 多分支树：root -> a -> (a1 -> a1x, a2), b -> b1；另建一个 ID 前缀可能相同的无关根组织
+	create := func(name string, parentID *int64) int64 {
+		g, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: name, ParentID: parentID})
+		if err != nil {
+			t.Fatalf("CreateGroup %s failed: %v", name, err)
+		}
+		return g.GetID()
+	}
+	rootID := create("路径根组织", nil)
+	aID := create("路径A", &rootID)
+	a1ID := create("路径A1", &aID)
+	create("路径A1X", &a1ID)
+	create("路径A2", &aID)
+	bID := create("路径B", &rootID)
+	create("路径B1", &bID)
+	otherID := create("无关根组织", nil)
+	create("无关子组织", &otherID)
+
+	idSet := func(groups []*iamentity.Group) map[int64]bool {
+		out := map[int64]bool{}
+		for _, g := range groups {
+			out[g.GetID()] = true
+		}
+		return out
+	}
+	for _, id := range []int64{rootID, aID, a1ID, bID} {
+		byPath, err := env.groupRepo.FindDescendantsByPath(ctx, id)
+		if err != nil {
+			t.Fatalf("FindDescendantsByPath(%d) failed: %v", id, err)
+		}
+		recursive, err := env.groupRepo.FindDescendantsRecursive(ctx, id)
+		if err != nil {
+			t.Fatalf("FindDescendantsRecursive(%d) failed: %v", id, err)
+		}
+		gotPath, gotRec := idSet(byPath), idSet(recursive)
+		if len(byPath) != len(recursive) || len(gotPath) != len(gotRec) {
+			t.Fatalf("group %d: path-based %v vs recursive %v", id, gotPath, gotRec)
+		}
+		for gid := range gotRec {
+			if !gotPath[gid] {
+				t.Fatalf("group %d: path-based result missing %d", id, gid)
+			}
+		}
+
+		// 父组织先于子组织
+		seen := map[int64]bool{id: true}
+		for _, g := range byPath {
+			if g.ParentID == nil || !seen[*g.ParentID] {
+				t.Fatalf("group %d: descendant %d listed before its parent", id, g.GetID())
+			}
+			seen[g.GetID()] = true
+		}
+	}
+
+	// 软删除的后代不返回
+	if err := env.db.Exec("UPDATE groups SET deleted_at = ? WHERE id = ?", time.Now(), bID).Error; err != nil {
+		t.Fatalf("soft delete: %v", err)
+	}
+	descendants, err := env.groupRepo.FindDescendants(ctx, rootID)
+	if err != nil {
+		t.Fatalf("FindDescendants failed: %v", err)
+	}
+	if got := idSet(descendants); got[bID] || got[otherID] || len(got) != 5 {
+		t.Fatalf("unexpected descendants after soft delete: %v", got)
+	}
+
+	// 单次查询组装子树
+	subtree, err := env.groupRepo.FindSubtree(ctx, aID)
+	if err != nil {
+		t.Fatalf("FindSubtree failed: %v", err)
+	}
+	if len(subtree.Children) != 2 {
+		t.Fatalf("expected 2 children under A, got %d", len(subtree.Children))
+	}
+	for _, child := range subtree.Children {
+		want := 0
+		if child.GetID() == a1ID {
+			want = 1
+		}
+		if len(child.Children) != want {
+			t.Fatalf("child %d: expected %d grandchildren, got %d", child.GetID(), want, len(child.Children))
+		}
+	}
+
+	// 缺失 path 的历史数据回退到逐层递归
+	if err := env.db.Exec("UPDATE groups SET path = '' WHERE id = ?", aID).Error; err != nil {
+		t.Fatalf("clear path: %v", err)
+	}
+	if descendants, err := env.groupRepo.FindDescendantsByPath(ctx, aID); err != nil || len(descendants) != 3 {
+		t.Fatalf("expected fallback to return 3 descendants, got %d (%v)", len(descendants), err)
+	}
+}
+
+// TestGroupRepoTraversalHonorsCancelledContext 测试层级遍历在请求取消后立即返回 context 错误
+func TestGroupRepoTraversalHonorsCancelledContext(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	// 构造一条较深的链路：chain-0 -> chain-1 -> ... -> chain-9
+	var parentID *int64
+	var ids []int64
+	for i := 0; i < 10; i++ {
+		g, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "遍历链路" + strconv.Itoa(i), ParentID: parentID})
+		if err != nil {
+			t.Fatalf("CreateGroup %d failed: %v", i, err)
+		}
+		id := g.GetID()
+		ids = append(ids, id)
+		parentID = &id
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	for name, call := range map[string]func() error{
+		"FindDescendants": func() error { _, err := env.groupRepo.FindDescendants(cancelled, ids[0]); return err },
+		"FindAncestors":   func() error { _, err := env.groupRepo.FindAncestors(cancelled, ids[len(ids)-1]); return err },
+		"GetGroupUsersRecursive": func() error {
+			_, err := env.groupService.GetGroupUsersRecursive(cancelled, ids[0])
+			return err
+		},
+	} {
+		start := time.Now()
+		err := call()
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("%s: expected context.Canceled, got %v", name, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("%s: expected prompt return, took %v", name, elapsed)
+		}
+	}
+
+	// 遍历入口直接检查 ctx，返回 Timeout 错误而非逐层查询后的数据库错误
+	if _, err := env.groupRepo.FindDescendantsRecursive(cancelled, ids[0]); !errorx.Is(err, errorx.Timeout) {
+		t.Fatalf("expected Timeout for cancelled traversal, got %v", err)
+	}
+
+	// 超时同样中止遍历
+	expired, cancelExpired := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancelExpired()
+	if _, err := env.groupRepo.FindDescendantsRecursive(expired, ids[0]); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// 未取消的上下文完整遍历
+	descendants, err := env.groupRepo.FindDescendants(ctx, ids[0])
+	if err != nil || len(descendants) != len(ids)-1 {
+		t.Fatalf("expected %d descendants, got %d (%v)", len(ids)-1, len(descendants), err)
+	}
+}
+
 // TestGroupServiceBatchAddUsersToGroup 测试批量添加用户
 func TestGroupServiceBatchAddUsersToGroup(t *testing.T) {
 	env := setupGroupServiceTest(t)
@@ -417,7 +839,7 @@ func TestGroupServiceAddGroupRole(t *testing.T) {
 	}
 
 	// 验证角色已添加
-	roles, err := env.groupService.GetGroupRoles(env.backgroundCtx, group.GetID())
+	roles, err := env.groupService.GetGroupRoles(env.backgroundCtx, group.GetID(), svc.ListOptions{})
 	if err != nil {
 		t.Fatalf("get group roles: %v", err)
 	}
@@ -429,6 +851,208 @@ func TestGroupServiceAddGroupRole(t *testing.T) {
 	}
 }
 
+// TestGroupServiceSyncGroupDefaultRoles 测试加入/离开组织时同步授予/回收默认角色
+func TestGroupServiceSyncGroupDefaultRoles(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	groupA, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "同步组织A"})
+	if err != nil {
+		t.Fatalf("create group A: %v", err)
+	}
+	groupB, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "同步组织B"})
+	if err != nil {
+		t.Fatalf("create group B: %v", err)
+	}
+
+	onlyA := env.createTestRole(t, "sync_only_a")
+	shared := env.createTestRole(t, "sync_shared")
+	direct := env.createTestRole(t, "sync_direct")
+	inactive := env.createTestRole(t, "sync_inactive")
+	inactive.Status = svc.RoleStatusInactive
+	if err := env.roleRepo.Update(ctx, inactive); err != nil {
+		t.Fatalf("deactivate role: %v", err)
+	}
+	for _, role := range []*iamentity.Role{onlyA, shared, direct, inactive} {
+		if err := env.groupService.AddGroupRole(ctx, groupA.GetID(), role.GetID()); err != nil {
+			t.Fatalf("add group A role: %v", err)
+		}
+	}
+	if err := env.groupService.AddGroupRole(ctx, groupB.GetID(), shared.GetID()); err != nil {
+		t.Fatalf("add group B role: %v", err)
+	}
+
+	// assignments 返回用户直接角色分配：角色 ID -> 来源组织（0 表示直接分配）
+	assignments := func(userID int64) map[int64]int64 {
+		t.Helper()
+		rows, err := env.roleRepo.FindUserRoleAssignments(ctx, []int64{userID})
+		if err != nil {
+			t.Fatalf("find assignments: %v", err)
+		}
+		result := make(map[int64]int64, len(rows))
+		for _, row := range rows {
+			var source int64
+			if row.SourceGroupID != nil {
+				source = *row.SourceGroupID
+			}
+			result[row.RoleID] = source
+		}
+		return result
+	}
+
+	// 默认关闭：加入组织不授予角色
+	bystander := env.createTestUser(t, "sync_bystander", "sync_bystander@example.com")
+	if err := env.groupService.AddUserToGroup(ctx, groupA.GetID(), bystander.GetID()); err != nil {
+		t.Fatalf("add bystander: %v", err)
+	}
+	if got := assignments(bystander.GetID()); len(got) != 0 {
+		t.Fatalf("expected no grants when sync disabled, got %v", got)
+	}
+
+	svc.SetSyncGroupDefaultRoles(true)
+	defer svc.SetSyncGroupDefaultRoles(false)
+	user := env.createTestUser(t, "sync_user", "sync_user@example.com")
+	if err := env.userService.AssignRole(ctx, user.GetID(), direct.GetID()); err != nil {
+		t.Fatalf("assign direct role: %v", err)
+	}
+
+	// 加入 A：授予 active 默认角色，直接分配保持不变，停用角色不授予
+	if err := env.groupService.AddUserToGroup(ctx, groupA.GetID(), user.GetID()); err != nil {
+		t.Fatalf("join group A: %v", err)
+	}
+	got := assignments(user.GetID())
+	if len(got) != 3 || got[onlyA.GetID()] != groupA.GetID() || got[shared.GetID()] != groupA.GetID() {
+		t.Fatalf("unexpected grants after joining A: %v", got)
+	}
+	if source, ok := got[direct.GetID()]; !ok || source != 0 {
+		t.Fatalf("expected direct role untouched, got %v", got)
+	}
+
+	// 加入 B：共享角色已持有，来源不变
+	if err := env.groupService.AddUserToGroup(ctx, groupB.GetID(), user.GetID()); err != nil {
+		t.Fatalf("join group B: %v", err)
+	}
+	if got := assignments(user.GetID()); len(got) != 3 || got[shared.GetID()] != groupA.GetID() {
+		t.Fatalf("unexpected grants after joining B: %v", got)
+	}
+
+	// 离开 A：回收仅由 A 授予的角色，共享角色来源转移到 B，直接分配保留
+	if err := env.groupService.RemoveUserFromGroup(ctx, groupA.GetID(), user.GetID()); err != nil {
+		t.Fatalf("leave group A: %v", err)
+	}
+	got = assignments(user.GetID())
+	if _, ok := got[onlyA.GetID()]; ok || len(got) != 2 || got[shared.GetID()] != groupB.GetID() {
+		t.Fatalf("unexpected grants after leaving A: %v", got)
+	}
+	if source, ok := got[direct.GetID()]; !ok || source != 0 {
+		t.Fatalf("expected direct role kept after leaving A, got %v", got)
+	}
+
+	// 离开 B：共享角色回收
+	if err := env.groupService.RemoveUserFromGroup(ctx, groupB.GetID(), user.GetID()); err != nil {
+		t.Fatalf("leave group B: %v", err)
+	}
+	if got := assignments(user.GetID()); len(got) != 1 || got[direct.GetID()] != 0 {
+		t.Fatalf("expected only direct role left, got %v", got)
+	}
+}
+
+// TestGroupServiceAddIdempotent 测试重复添加成员/默认角色不产生重复关联行
+func TestGroupServiceAddIdempotent(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	// 模拟缺少联合唯一约束的关联表
+	for _, stmt := range []string{
+		"DROP TABLE user_groups",
+		"CREATE TABLE user_groups (user_id integer, group_id integer, joined_at datetime)",
+		"DROP TABLE group_roles",
+		"CREATE TABLE group_roles (group_id integer, role_id integer)",
+	} {
+		if err := env.db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	group, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "幂等组织"})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	user := env.createTestUser(t, "idempotent_member", "idempotent_member@example.com")
+	role := env.createTestRole(t, "idempotent_default")
+
+	for i := 0; i < 2; i++ {
+		if err := env.groupService.AddUserToGroup(ctx, group.GetID(), user.GetID()); err != nil {
+			t.Fatalf("AddUserToGroup #%d failed: %v", i+1, err)
+		}
+		if err := env.groupService.AddGroupRole(ctx, group.GetID(), role.GetID()); err != nil {
+			t.Fatalf("AddGroupRole #%d failed: %v", i+1, err)
+		}
+	}
+
+	members, err := env.groupService.GetGroupUsers(ctx, group.GetID())
+	if err != nil {
+		t.Fatalf("GetGroupUsers failed: %v", err)
+	}
+	if len(members) != 1 {
+		t.Fatalf("expected single member, got %d", len(members))
+	}
+	var n int64
+	if err := env.db.Table("group_roles").Where("group_id = ?", group.GetID()).Count(&n).Error; err != nil {
+		t.Fatalf("count group_roles: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 group_roles row, got %d", n)
+	}
+}
+
+// TestGroupServiceGetGroupRoleHistory 测试组织默认角色变更审计
+func TestGroupServiceGetGroupRoleHistory(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "审计组织"})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	role := env.createTestRole(t, "audited_role")
+
+	// 操作者来自请求上下文
+	actorCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(42))
+	if err := env.groupService.AddGroupRole(actorCtx, group.GetID(), role.GetID()); err != nil {
+		t.Fatalf("add group role: %v", err)
+	}
+	if err := env.groupService.RemoveGroupRole(actorCtx, group.GetID(), role.GetID()); err != nil {
+		t.Fatalf("remove group role: %v", err)
+	}
+
+	events, err := env.groupService.GetGroupRoleHistory(env.backgroundCtx, group.GetID())
+	if err != nil {
+		t.Fatalf("get group role history: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].Action != iamentity.GroupRoleEventAdded || events[1].Action != iamentity.GroupRoleEventRemoved {
+		t.Fatalf("unexpected event order: %s, %s", events[0].Action, events[1].Action)
+	}
+	for _, e := range events {
+		if e.GroupID != group.GetID() || e.RoleID != role.GetID() || e.ActorID != 42 {
+			t.Errorf("unexpected event: %+v", e)
+		}
+	}
+	if events[1].CreatedAt.Before(events[0].CreatedAt) {
+		t.Errorf("expected events in chronological order")
+	}
+
+	// 不存在的组织
+	if _, err := env.groupService.GetGroupRoleHistory(env.backgroundCtx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing group, got %v", err)
+	}
+}
+
 // TestGroupServiceGetRootGroups 测试获取根组织
 func TestGroupServiceGetRootGroups(t *testing.T) {
 	env := setupGroupServiceTest(t)
@@ -501,3 +1125,712 @@ func TestGroupServiceGetGroupsByLevel(t *testing.T) {
 		t.Errorf("expected 2 level 2 groups, got %d", len(level2Groups))
 	}
 }
+
+// TestGroupServiceSearchGroupsPaged 测试组织分页搜索（总数、页边界与父组织过滤）
+func TestGroupServiceSearchGroupsPaged(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	root, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "paged_root"})
+	if err != nil {
+		t.Fatalf("create root group: %v", err)
+	}
+	rootID := root.GetID()
+	var children []*iamentity.Group
+	for i := 1; i <= 5; i++ {
+		child, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{
+			Name:     "paged_child_" + strconv.Itoa(i),
+			ParentID: &rootID,
+		})
+		if err != nil {
+			t.Fatalf("create child group %d: %v", i, err)
+		}
+		children = append(children, child)
+	}
+	// 孙组织：不属于 root 的直接子组织
+	firstChildID := children[0].GetID()
+	if _, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: "paged_grandchild", ParentID: &firstChildID}); err != nil {
+		t.Fatalf("create grandchild group: %v", err)
+	}
+	// 软删除的组织不计入
+	if err := env.groupService.DeleteGroup(ctx, children[4].GetID()); err != nil {
+		t.Fatalf("delete group: %v", err)
+	}
+
+	// 关键字匹配：root 与 4 个未删除的子组织 + 孙组织
+	items, total, err := env.groupService.SearchGroupsPaged(ctx, "paged", nil, 0, 4)
+	if err != nil {
+		t.Fatalf("SearchGroupsPaged failed: %v", err)
+	}
+	if total != 6 || len(items) != 4 || items[0].GetID() != rootID {
+		t.Fatalf("unexpected first page: total=%d len=%d", total, len(items))
+	}
+	items, total, err = env.groupService.SearchGroupsPaged(ctx, "paged", nil, 4, 4)
+	if err != nil {
+		t.Fatalf("SearchGroupsPaged failed: %v", err)
+	}
+	if total != 6 || len(items) != 2 {
+		t.Fatalf("unexpected last page: total=%d len=%d", total, len(items))
+	}
+
+	// 仅直接子组织
+	items, total, err = env.groupService.SearchGroupsPaged(ctx, "", &rootID, 2, 2)
+	if err != nil {
+		t.Fatalf("SearchGroupsPaged by parent failed: %v", err)
+	}
+	if total != 4 || len(items) != 2 || items[0].GetID() != children[2].GetID() || items[1].GetID() != children[3].GetID() {
+		t.Fatalf("unexpected children page: total=%d items=%v", total, items)
+	}
+
+	// 页码越界返回空页但总数不变
+	items, total, err = env.groupService.SearchGroupsPaged(ctx, "", &rootID, 10, 2)
+	if err != nil || total != 4 || len(items) != 0 {
+		t.Fatalf("expected empty page past end, got total=%d len=%d err=%v", total, len(items), err)
+	}
+
+	missing := int64(999999)
+	if _, _, err := env.groupService.SearchGroupsPaged(ctx, "", &missing, 0, 10); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing parent, got %v", err)
+	}
+	if _, _, err := env.groupService.SearchGroupsPaged(ctx, "", nil, -1, 10); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for negative offset, got %v", err)
+	}
+}
+
+// TestGroupServiceAddUserToGroupRecordsJoinedAt 测试加入组织时记录加入时间
+func TestGroupServiceAddUserToGroupRecordsJoinedAt(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{
+		Name:        "加入时间测试",
+		Description: "加入时间测试",
+	})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	user := env.createTestUser(t, "joineduser", "joined@example.com")
+
+	before := time.Now().Add(-time.Second)
+	if err := env.groupService.AddUserToGroup(env.backgroundCtx, group.GetID(), user.GetID()); err != nil {
+		t.Fatalf("add user to group: %v", err)
+	}
+	after := time.Now().Add(time.Second)
+
+	members, err := env.groupService.GetGroupUsers(env.backgroundCtx, group.GetID())
+	if err != nil {
+		t.Fatalf("get group users: %v", err)
+	}
+	if len(members) != 1 {
+		t.Fatalf("expected 1 member, got %d", len(members))
+	}
+	joinedAt := members[0].JoinedAt
+	if joinedAt == nil {
+		t.Fatal("expected joined_at to be recorded")
+	}
+	if joinedAt.Before(before) || joinedAt.After(after) {
+		t.Errorf("joined_at %v not within [%v, %v]", *joinedAt, before, after)
+	}
+
+	// 重复添加不覆盖首次加入时间
+	if err := env.groupService.AddUserToGroup(env.backgroundCtx, group.GetID(), user.GetID()); err != nil {
+		t.Fatalf("re-add user to group: %v", err)
+	}
+	timestamps, err := env.groupService.GetGroupUserMembershipTimestamps(env.backgroundCtx, group.GetID())
+	if err != nil {
+		t.Fatalf("get membership timestamps: %v", err)
+	}
+	if got, ok := timestamps[user.GetID()]; !ok || !got.Equal(*joinedAt) {
+		t.Errorf("expected joined_at unchanged (%v), got %v", *joinedAt, got)
+	}
+}
+
+// TestGroupServiceBackfillMembershipJoinedAt 测试回填历史成员加入时间
+func TestGroupServiceBackfillMembershipJoinedAt(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{
+		Name:        "回填测试",
+		Description: "回填测试",
+	})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	user := env.createTestUser(t, "legacyuser", "legacy@example.com")
+
+	// 模拟历史数据：关联存在但未记录加入时间
+	if err := env.db.Exec("INSERT INTO user_groups (user_id, group_id) VALUES (?, ?)", user.GetID(), group.GetID()).Error; err != nil {
+		t.Fatalf("insert legacy membership: %v", err)
+	}
+
+	filled, err := env.groupService.BackfillMembershipJoinedAt(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("backfill: %v", err)
+	}
+	if filled != 1 {
+		t.Fatalf("expected 1 row backfilled, got %d", filled)
+	}
+
+	timestamps, err := env.groupService.GetGroupUserMembershipTimestamps(env.backgroundCtx, group.GetID())
+	if err != nil {
+		t.Fatalf("get membership timestamps: %v", err)
+	}
+	if _, ok := timestamps[user.GetID()]; !ok {
+		t.Fatal("expected backfilled joined_at")
+	}
+}
+
+// TestGroupServiceGetTreeChecksum 测试组织树校验值
+func TestGroupServiceGetTreeChecksum(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	root, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "校验根组织"})
+	if err != nil {
+		t.Fatalf("create root group: %v", err)
+	}
+	parentID := root.GetID()
+	if _, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "校验子组织", ParentID: &parentID}); err != nil {
+		t.Fatalf("create child group: %v", err)
+	}
+
+	first, err := env.groupService.GetTreeChecksum(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get checksum: %v", err)
+	}
+	second, err := env.groupService.GetTreeChecksum(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get checksum again: %v", err)
+	}
+	if first == "" || first != second {
+		t.Fatalf("expected stable non-empty checksum, got %q and %q", first, second)
+	}
+
+	// 重命名后变化
+	if _, err := env.groupService.UpdateGroup(env.backgroundCtx, root.GetID(), &svc.UpdateGroupRequest{Name: "校验根组织-改名"}); err != nil {
+		t.Fatalf("rename group: %v", err)
+	}
+	renamed, err := env.groupService.GetTreeChecksum(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get checksum after rename: %v", err)
+	}
+	if renamed == first {
+		t.Fatal("expected checksum to change after rename")
+	}
+
+	// 成员变化（影响 user_count）后变化
+	user := env.createTestUser(t, "checksumuser", "checksum@example.com")
+	if err := env.groupService.AddUserToGroup(env.backgroundCtx, root.GetID(), user.GetID()); err != nil {
+		t.Fatalf("add user to group: %v", err)
+	}
+	withMember, err := env.groupService.GetTreeChecksum(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("get checksum after add member: %v", err)
+	}
+	if withMember == renamed {
+		t.Fatal("expected checksum to change after membership change")
+	}
+}
+
+// TestGroupServiceGetGroupsByLevelRange 测试按层级区间查询组织
+func TestGroupServiceGetGroupsByLevelRange(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	// 构建 1 -> 2 -> 3 -> 4 的链路
+	var parentID *int64
+	levels := make(map[int]int64)
+	for level := 1; level <= 4; level++ {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{
+			Name:     "层级组织" + string(rune('0'+level)),
+			ParentID: parentID,
+		})
+		if err != nil {
+			t.Fatalf("create level %d group: %v", level, err)
+		}
+		levels[level] = group.GetID()
+		id := group.GetID()
+		parentID = &id
+	}
+
+	groups, err := env.groupService.GetGroupsByLevelRange(env.backgroundCtx, 2, 3)
+	if err != nil {
+		t.Fatalf("get groups by level range: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if groups[0].GetID() != levels[2] || groups[1].GetID() != levels[3] {
+		t.Errorf("unexpected groups: %d, %d", groups[0].GetID(), groups[1].GetID())
+	}
+
+	// 单层区间与精确查询一致
+	groups, err = env.groupService.GetGroupsByLevelRange(env.backgroundCtx, 4, 4)
+	if err != nil {
+		t.Fatalf("get groups by level range: %v", err)
+	}
+	if len(groups) != 1 || groups[0].GetID() != levels[4] {
+		t.Errorf("expected only level 4 group, got %d groups", len(groups))
+	}
+
+	// min > max 拒绝
+	if _, err := env.groupService.GetGroupsByLevelRange(env.backgroundCtx, 3, 2); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for min > max, got %v", err)
+	}
+	if _, err := env.groupService.GetGroupsByLevelRange(env.backgroundCtx, 0, 2); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for non-positive level, got %v", err)
+	}
+}
+
+// TestGroupServiceGetGroupContributedPermissions 测试按组织解释成员获得的权限
+func TestGroupServiceGetGroupContributedPermissions(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	user := env.createTestUser(t, "contrib_user", "contrib@example.com")
+
+	newRole := func(name, status string, permissions ...string) *iamentity.Role {
+		role := &iamentity.Role{
+			Name:        name,
+			Permissions: iamentity.PermissionArray(permissions),
+			Status:      status,
+		}
+		if err := env.roleRepo.Create(env.backgroundCtx, role); err != nil {
+			t.Fatalf("create role %s: %v", name, err)
+		}
+		return role
+	}
+	newGroup := func(name string, roles ...*iamentity.Role) *iamentity.Group {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: name})
+		if err != nil {
+			t.Fatalf("create group %s: %v", name, err)
+		}
+		for _, role := range roles {
+			if err := env.groupService.AddGroupRole(env.backgroundCtx, group.GetID(), role.GetID()); err != nil {
+				t.Fatalf("add group role: %v", err)
+			}
+		}
+		if err := env.groupService.AddUserToGroup(env.backgroundCtx, group.GetID(), user.GetID()); err != nil {
+			t.Fatalf("add user to group: %v", err)
+		}
+		return group
+	}
+
+	finance := newGroup("Finance",
+		newRole("finance_reader", svc.RoleStatusActive, "report:read", "ledger:read"),
+		newRole("finance_legacy", svc.RoleStatusInactive, "ledger:write"),
+	)
+	engineering := newGroup("Engineering",
+		newRole("engineer", svc.RoleStatusActive, "repo:write", "report:read"),
+	)
+
+	contributions, err := env.groupService.GetGroupContributedPermissions(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("get contributed permissions: %v", err)
+	}
+	if len(contributions) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(contributions))
+	}
+
+	want := []struct {
+		groupID     int64
+		roles       []string
+		permissions []string
+	}{
+		{finance.GetID(), []string{"finance_reader"}, []string{"ledger:read", "report:read"}},
+		{engineering.GetID(), []string{"engineer"}, []string{"repo:write", "report:read"}},
+	}
+	for i, w := range want {
+		got := contributions[i]
+		if got.GroupID != w.groupID {
+			t.Fatalf("contribution %d: expected group %d, got %d", i, w.groupID, got.GroupID)
+		}
+		if strings.Join(got.Roles, ",") != strings.Join(w.roles, ",") {
+			t.Errorf("group %s: expected roles %v, got %v", got.GroupName, w.roles, got.Roles)
+		}
+		if strings.Join(got.Permissions, ",") != strings.Join(w.permissions, ",") {
+			t.Errorf("group %s: expected permissions %v, got %v", got.GroupName, w.permissions, got.Permissions)
+		}
+	}
+
+	// 用户不存在
+	if _, err := env.groupService.GetGroupContributedPermissions(env.backgroundCtx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+}
+
+// TestGroupServiceGetMembersWithEffectiveRoles 测试批量解析组织成员的有效角色（直接角色 + 所属组织默认角色）
+func TestGroupServiceGetMembersWithEffectiveRoles(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	newRole := func(name, status string) *iamentity.Role {
+		role := &iamentity.Role{Name: name, Status: status}
+		if err := env.roleRepo.Create(ctx, role); err != nil {
+			t.Fatalf("create role %s: %v", name, err)
+		}
+		return role
+	}
+	newGroup := func(name string, roles ...*iamentity.Role) *iamentity.Group {
+		group, err := env.groupService.CreateGroup(ctx, &svc.CreateGroupRequest{Name: name})
+		if err != nil {
+			t.Fatalf("create group %s: %v", name, err)
+		}
+		for _, role := range roles {
+			if err := env.groupService.AddGroupRole(ctx, group.GetID(), role.GetID()); err != nil {
+				t.Fatalf("add group role: %v", err)
+			}
+		}
+		return group
+	}
+	join := func(group *iamentity.Group, users ...*iamentity.User) {
+		for _, user := range users {
+			if err := env.groupService.AddUserToGroup(ctx, group.GetID(), user.GetID()); err != nil {
+				t.Fatalf("add user to group: %v", err)
+			}
+		}
+	}
+	assign := func(user *iamentity.User, role *iamentity.Role) {
+		if err := env.roleRepo.AssignToUser(ctx, role.GetID(), user.GetID()); err != nil {
+			t.Fatalf("assign role: %v", err)
+		}
+	}
+
+	member := newRole("member", svc.RoleStatusActive)
+	legacy := newRole("legacy", svc.RoleStatusInactive)
+	auditor := newRole("auditor", svc.RoleStatusActive)
+	oncall := newRole("oncall", svc.RoleStatusActive)
+	contractor := newRole("contractor", svc.RoleStatusActive)
+
+	team := newGroup("Platform", member, legacy)
+	audit := newGroup("Audit", auditor)
+
+	alice := env.createTestUser(t, "eff_alice", "eff_alice@example.com")
+	bob := env.createTestUser(t, "eff_bob", "eff_bob@example.com")
+	carol := env.createTestUser(t, "eff_carol", "eff_carol@example.com")
+	outsider := env.createTestUser(t, "eff_outsider", "eff_outsider@example.com")
+
+	join(team, alice, bob, carol)
+	join(audit, bob)
+	assign(alice, oncall)
+	assign(carol, contractor)
+	assign(outsider, oncall)
+
+	// carol 的直接角色已过期，不计入
+	if err := env.db.Exec("UPDATE user_roles SET expires_at = ? WHERE user_id = ? AND role_id = ?",
+		time.Now().Add(-time.Hour), carol.GetID(), contractor.GetID()).Error; err != nil {
+		t.Fatalf("expire role: %v", err)
+	}
+
+	members, err := env.groupService.GetMembersWithEffectiveRoles(ctx, team.GetID())
+	if err != nil {
+		t.Fatalf("GetMembersWithEffectiveRoles: %v", err)
+	}
+
+	want := map[int64]string{
+		alice.GetID(): "member,oncall",
+		bob.GetID():   "auditor,member",
+		carol.GetID(): "member",
+	}
+	if len(members) != len(want) {
+		t.Fatalf("expected %d members, got %d", len(want), len(members))
+	}
+	for i, m := range members {
+		if i > 0 && members[i-1].UserID >= m.UserID {
+			t.Fatalf("expected members ordered by user id, got %+v", members)
+		}
+		if got := strings.Join(m.Roles, ","); got != want[m.UserID] {
+			t.Errorf("user %s: expected roles %q, got %q", m.Username, want[m.UserID], got)
+		}
+	}
+
+	// 无成员的组织返回空列表；不存在的组织返回 NotFound
+	empty := newGroup("Empty")
+	if members, err := env.groupService.GetMembersWithEffectiveRoles(ctx, empty.GetID()); err != nil || len(members) != 0 {
+		t.Fatalf("expected empty result, got %v, %v", members, err)
+	}
+	if _, err := env.groupService.GetMembersWithEffectiveRoles(ctx, 999999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
+
+// TestGroupServiceMoveGroup 测试移动多级子树并重算层级与路径
+func TestGroupServiceMoveGroup(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	create := func(name string, parentID *int64) *iamentity.Group {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: name, ParentID: parentID})
+		if err != nil {
+			t.Fatalf("create group %s: %v", name, err)
+		}
+		return group
+	}
+	idOf := func(g *iamentity.Group) *int64 {
+		id := g.GetID()
+		return &id
+	}
+	pathOf := func(groups ...*iamentity.Group) string {
+		var b strings.Builder
+		for _, g := range groups {
+			b.WriteString("/" + strconv.FormatInt(g.GetID(), 10))
+		}
+		return b.String()
+	}
+
+	// A -> B -> C -> D，另有根组织 X -> Y
+	a := create("移动A", nil)
+	b := create("移动B", idOf(a))
+	c := create("移动C", idOf(b))
+	d := create("移动D", idOf(c))
+	x := create("移动X", nil)
+	y := create("移动Y", idOf(x))
+
+	// 将 B 子树移动到 Y 下
+	moved, err := env.groupService.MoveGroup(env.backgroundCtx, b.GetID(), idOf(y))
+	if err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	if moved.Level != 3 || moved.Path != pathOf(x, y, b) {
+		t.Fatalf("unexpected moved group: level=%d path=%s", moved.Level, moved.Path)
+	}
+
+	expect := map[int64]struct {
+		level  int
+		path   string
+		parent int64
+	}{
+		b.GetID(): {3, pathOf(x, y, b), y.GetID()},
+		c.GetID(): {4, pathOf(x, y, b, c), b.GetID()},
+		d.GetID(): {5, pathOf(x, y, b, c, d), c.GetID()},
+	}
+	for id, want := range expect {
+		got, err := env.groupRepo.GetByID(env.backgroundCtx, id)
+		if err != nil {
+			t.Fatalf("get group %d: %v", id, err)
+		}
+		if got.Level != want.level || got.Path != want.path || got.ParentID == nil || *got.ParentID != want.parent {
+			t.Errorf("group %d: expected level=%d path=%s parent=%d, got level=%d path=%s parent=%v",
+				id, want.level, want.path, want.parent, got.Level, got.Path, got.ParentID)
+		}
+	}
+
+	// 原父组织 A 不再有子组织
+	children, err := env.groupRepo.FindChildren(env.backgroundCtx, a.GetID())
+	if err != nil {
+		t.Fatalf("find children: %v", err)
+	}
+	if len(children) != 0 {
+		t.Fatalf("expected no children under A, got %d", len(children))
+	}
+
+	// 移动为根组织
+	moved, err = env.groupService.MoveGroup(env.backgroundCtx, c.GetID(), nil)
+	if err != nil {
+		t.Fatalf("move group to root: %v", err)
+	}
+	if moved.Level != 1 || moved.Path != pathOf(c) || moved.ParentID != nil {
+		t.Fatalf("unexpected root group: level=%d path=%s parent=%v", moved.Level, moved.Path, moved.ParentID)
+	}
+	got, err := env.groupRepo.GetByID(env.backgroundCtx, d.GetID())
+	if err != nil {
+		t.Fatalf("get group D: %v", err)
+	}
+	if got.Level != 2 || got.Path != pathOf(c, d) {
+		t.Fatalf("unexpected descendant after move to root: level=%d path=%s", got.Level, got.Path)
+	}
+}
+
+// TestGroupServiceMoveGroupIgnoresStaleLevel 测试移动按实际祖先链计算层级，不信任缓存的 Level 字段
+func TestGroupServiceMoveGroupIgnoresStaleLevel(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	// 建立 MaxGroupLevel 级的链
+	var chain []*iamentity.Group
+	var parentID *int64
+	for i := 0; i < svc.MaxGroupLevel; i++ {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "失真" + strconv.Itoa(i), ParentID: parentID})
+		if err != nil {
+			t.Fatalf("create group %d: %v", i, err)
+		}
+		chain = append(chain, group)
+		id := group.GetID()
+		parentID = &id
+	}
+	leaf := chain[len(chain)-1]
+	mover, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "失真移动"})
+	if err != nil {
+		t.Fatalf("create mover: %v", err)
+	}
+
+	// 缓存的 Level 失真为 1
+	if err := env.db.Exec("UPDATE groups SET level = 1 WHERE id IN (?, ?)", leaf.GetID(), chain[2].GetID()).Error; err != nil {
+		t.Fatalf("corrupt level: %v", err)
+	}
+
+	// 最深组织下已无法容纳子组织（ValidateGroupMove 拒绝）
+	leafID := leaf.GetID()
+	if _, err := env.groupService.MoveGroup(env.backgroundCtx, mover.GetID(), &leafID); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation moving below max level, got %v", err)
+	}
+
+	// 移动到层级失真的中间组织下，层级按祖先链修正
+	midID := chain[2].GetID()
+	moved, err := env.groupService.MoveGroup(env.backgroundCtx, mover.GetID(), &midID)
+	if err != nil {
+		t.Fatalf("move group: %v", err)
+	}
+	if moved.Level != 4 {
+		t.Fatalf("expected level 4 from ancestor chain, got %d", moved.Level)
+	}
+}
+
+// TestGroupServiceMoveGroupRollsBackOnDescendantFailure 测试后代路径更新失败时整体回滚，组织自身不被移动
+func TestGroupServiceMoveGroupRollsBackOnDescendantFailure(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	create := func(name string, parentID *int64) *iamentity.Group {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: name, ParentID: parentID})
+		if err != nil {
+			t.Fatalf("create group %s: %v", name, err)
+		}
+		return group
+	}
+	root := create("回滚根", nil)
+	rootID := root.GetID()
+	moving := create("回滚移动", &rootID)
+	movingID := moving.GetID()
+	create("回滚后代", &movingID)
+	target := create("回滚目标", nil)
+	targetID := target.GetID()
+
+	// 注入后代路径更新失败
+	if err := env.db.Exec(`CREATE TRIGGER fail_descendant_path BEFORE UPDATE OF path ON groups
+		WHEN NEW.name = '回滚后代'
+		BEGIN SELECT RAISE(ABORT, 'injected descendant failure'); END`).Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	if _, err := env.groupService.MoveGroup(env.backgroundCtx, movingID, &targetID); !errorx.Is(err, errorx.Database) {
+		t.Fatalf("expected Database error on descendant failure, got %v", err)
+	}
+
+	// 组织自身的父级、层级与路径随事务回滚
+	stored, err := env.groupRepo.GetByID(env.backgroundCtx, movingID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.ParentID == nil || *stored.ParentID != rootID || stored.Level != moving.Level || stored.Path != moving.Path {
+		t.Fatalf("expected move rolled back, got parent=%v level=%d path=%s", stored.ParentID, stored.Level, stored.Path)
+	}
+}
+
+func TestGroupServiceCreateGroupDepthIgnoresStaleLevel(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	// 构建深度为 MaxGroupLevel 的链路
+	var parentID *int64
+	var deepest *iamentity.Group
+	for level := 1; level <= svc.MaxGroupLevel; level++ {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{
+			Name:     "深度组织" + strconv.Itoa(level),
+			ParentID: parentID,
+		})
+		if err != nil {
+			t.Fatalf("create level %d group: %v", level, err)
+		}
+		deepest = group
+		id := group.GetID()
+		parentID = &id
+	}
+
+	// 人为调低最深组织的 level 列：实际深度仍达上限，创建子组织依旧被拒绝
+	if err := env.db.Exec("UPDATE groups SET level = 2 WHERE id = ?", deepest.GetID()).Error; err != nil {
+		t.Fatalf("corrupt level: %v", err)
+	}
+	deepestID := deepest.GetID()
+	_, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "超限组织", ParentID: &deepestID})
+	if !errorx.Is(err, errorx.Validation) || !strings.Contains(err.Error(), strconv.Itoa(svc.MaxGroupLevel)) {
+		t.Fatalf("expected Validation naming the limit, got %v", err)
+	}
+
+	// 子组织层级按实际深度计算，而非失真的 level
+	var midID int64
+	if err := env.db.Table("groups").Select("id").Where("name = ?", "深度组织3").Scan(&midID).Error; err != nil {
+		t.Fatalf("find mid group: %v", err)
+	}
+	if err := env.db.Exec("UPDATE groups SET level = 1 WHERE id = ?", midID).Error; err != nil {
+		t.Fatalf("corrupt level: %v", err)
+	}
+	child, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "修正层级组织", ParentID: &midID})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if child.Level != 4 {
+		t.Fatalf("expected level 4 from real depth, got %d", child.Level)
+	}
+}
+
+// TestGroupServiceMoveGroupRejectsInvalidTarget 测试移动到自身/后代下或超出层级上限时被拒绝
+func TestGroupServiceMoveGroupRejectsInvalidTarget(t *testing.T) {
+	env := setupGroupServiceTest(t)
+	defer env.teardown(t)
+
+	// 构建深度为 MaxGroupLevel 的链路
+	chain := make([]*iamentity.Group, 0, svc.MaxGroupLevel)
+	var parentID *int64
+	for level := 1; level <= svc.MaxGroupLevel; level++ {
+		group, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{
+			Name:     "链路组织" + strconv.Itoa(level),
+			ParentID: parentID,
+		})
+		if err != nil {
+			t.Fatalf("create level %d group: %v", level, err)
+		}
+		chain = append(chain, group)
+		id := group.GetID()
+		parentID = &id
+	}
+	rootID := chain[0].GetID()
+
+	// 不能移动到自身下
+	if _, err := env.groupService.MoveGroup(env.backgroundCtx, rootID, &rootID); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for self parent, got %v", err)
+	}
+
+	// 不能移动到后代下
+	descendantID := chain[3].GetID()
+	if _, err := env.groupService.MoveGroup(env.backgroundCtx, chain[1].GetID(), &descendantID); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for descendant parent, got %v", err)
+	}
+
+	// 子树最深节点超过层级上限（目标父组织本身层级合法，但移动后子树整体下沉一级）
+	other, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "另一个根"})
+	if err != nil {
+		t.Fatalf("create other root: %v", err)
+	}
+	otherRootID := other.GetID()
+	otherChild, err := env.groupService.CreateGroup(env.backgroundCtx, &svc.CreateGroupRequest{Name: "另一个子组织", ParentID: &otherRootID})
+	if err != nil {
+		t.Fatalf("create other child: %v", err)
+	}
+	otherID := otherChild.GetID()
+	if _, err := env.groupService.MoveGroup(env.backgroundCtx, chain[1].GetID(), &otherID); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for exceeding max level, got %v", err)
+	}
+
+	// 校验失败后层级与路径保持不变
+	got, err := env.groupRepo.GetByID(env.backgroundCtx, chain[svc.MaxGroupLevel-1].GetID())
+	if err != nil {
+		t.Fatalf("get deepest group: %v", err)
+	}
+	if got.Level != svc.MaxGroupLevel || !strings.HasPrefix(got.Path, chain[0].Path+"/") {
+		t.Fatalf("expected deepest group unchanged, got level=%d path=%s", got.Level, got.Path)
+	}
+}
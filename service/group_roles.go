@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	grouprepo "gochen-iam/repo/group"
+	rolerepo "gochen-iam/repo/role"
+	userrepo "gochen-iam/repo/user"
+	"gochen/errorx"
+	"gochen/logging"
+)
+
+// inheritAncestorGroupRoles 是否继承祖先组织的默认角色（默认仅继承直接所属组织）
+var inheritAncestorGroupRoles atomic.Bool
+
+// SetInheritAncestorGroupRoles 设置是否继承祖先组织的默认角色。
+//
+// 关闭（默认）时仅合并用户直接所属组织的默认角色；开启后沿组织层级向上合并所有祖先组织的默认角色。
+// UserService 的有效权限与 RoleService.CheckPermission 的权限来源共用该设置；切换时失效全部权限缓存。
+func SetInheritAncestorGroupRoles(enabled bool) {
+	inheritAncestorGroupRoles.Store(enabled)
+	InvalidateAllPermissionCache()
+}
+
+// InheritAncestorGroupRoles 返回是否继承祖先组织的默认角色
+func InheritAncestorGroupRoles() bool {
+	return inheritAncestorGroupRoles.Load()
+}
+
+// syncGroupDefaultRoles 加入/离开组织时是否同步授予/回收组织默认角色（默认关闭）
+var syncGroupDefaultRoles atomic.Bool
+
+// SetSyncGroupDefaultRoles 设置加入/离开组织时是否同步授予/回收组织默认角色（默认关闭，默认角色仅在鉴权时合并）。
+//
+// 开启后加入组织（GroupService.AddUserToGroup、UserService.AssignToGroup）在同一事务内将组织 active 默认角色分配给用户（已持有的角色不变），
+// 离开组织（GroupService.RemoveUserFromGroup、UserService.RemoveFromGroup）回收仅由该组织授予的角色；直接分配的角色不会被回收，
+// 详见 GrantGroupDefaultRoles / RevokeGroupDefaultRoles。
+func SetSyncGroupDefaultRoles(enabled bool) {
+	syncGroupDefaultRoles.Store(enabled)
+}
+
+// SyncGroupDefaultRoles 返回加入/离开组织时是否同步授予/回收组织默认角色
+func SyncGroupDefaultRoles() bool {
+	return syncGroupDefaultRoles.Load()
+}
+
+// JoinGroup 将用户加入组织；开启 SyncGroupDefaultRoles 时在同一事务内授予组织默认角色，并记录角色变更（最佳努力）
+//
+// 调用方负责校验用户与组织存在、失效权限缓存及记录成员变更。
+func JoinGroup(ctx context.Context, userRepo *userrepo.UserRepo, groupRepo *grouprepo.GroupRepo, roleRepo *rolerepo.RoleRepo, logger logging.ILogger, groupID, userID int64) error {
+	if !SyncGroupDefaultRoles() {
+		return groupRepo.AddUserToGroup(ctx, groupID, userID)
+	}
+
+	granted, err := joinGroupWithDefaultRoles(ctx, userRepo, groupRepo, roleRepo, groupID, userID)
+	if err != nil {
+		return err
+	}
+	for _, role := range granted {
+		RecordRoleChange(ctx, userRepo, logger, userID, role.GetID(), role.Name, iamentity.RoleChangeGranted)
+	}
+	return nil
+}
+
+// joinGroupWithDefaultRoles 在事务内添加成员并授予组织默认角色
+func joinGroupWithDefaultRoles(ctx context.Context, userRepo *userrepo.UserRepo, groupRepo *grouprepo.GroupRepo, roleRepo *rolerepo.RoleRepo, groupID, userID int64) (granted []*iamentity.Role, err error) {
+	txCtx, err := groupRepo.BeginTx(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = groupRepo.Rollback(txCtx)
+		}
+	}()
+
+	if err = groupRepo.AddUserToGroup(txCtx, groupID, userID); err != nil {
+		return nil, err
+	}
+	if granted, err = GrantGroupDefaultRoles(txCtx, userRepo, roleRepo, groupID, userID); err != nil {
+		return nil, err
+	}
+	if err = groupRepo.Commit(txCtx); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	return granted, nil
+}
+
+// LeaveGroup 将用户移出组织；开启 SyncGroupDefaultRoles 时在同一事务内回收仅由该组织授予的默认角色，并记录角色变更（最佳努力）
+//
+// 调用方负责失效权限缓存及记录成员变更。
+func LeaveGroup(ctx context.Context, userRepo *userrepo.UserRepo, groupRepo *grouprepo.GroupRepo, roleRepo *rolerepo.RoleRepo, logger logging.ILogger, groupID, userID int64) error {
+	if !SyncGroupDefaultRoles() {
+		return groupRepo.RemoveUserFromGroup(ctx, groupID, userID)
+	}
+
+	revoked, err := leaveGroupWithDefaultRoles(ctx, userRepo, groupRepo, roleRepo, groupID, userID)
+	if err != nil {
+		return err
+	}
+	for _, roleID := range revoked {
+		var roleName string
+		if role, err := roleRepo.GetByID(ctx, roleID); err == nil {
+			roleName = role.Name
+		}
+		RecordRoleChange(ctx, userRepo, logger, userID, roleID, roleName, iamentity.RoleChangeRevoked)
+	}
+	return nil
+}
+
+// leaveGroupWithDefaultRoles 在事务内移除成员并回收仅由该组织授予的默认角色
+func leaveGroupWithDefaultRoles(ctx context.Context, userRepo *userrepo.UserRepo, groupRepo *grouprepo.GroupRepo, roleRepo *rolerepo.RoleRepo, groupID, userID int64) (revoked []int64, err error) {
+	txCtx, err := groupRepo.BeginTx(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = groupRepo.Rollback(txCtx)
+		}
+	}()
+
+	if err = groupRepo.RemoveUserFromGroup(txCtx, groupID, userID); err != nil {
+		return nil, err
+	}
+	if revoked, err = RevokeGroupDefaultRoles(txCtx, userRepo, groupRepo, roleRepo, groupID, userID); err != nil {
+		return nil, err
+	}
+	if err = groupRepo.Commit(txCtx); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	return revoked, nil
+}
+
+// RecordRoleChange 记录用户角色变更（最佳努力，失败仅告警）
+func RecordRoleChange(ctx context.Context, userRepo *userrepo.UserRepo, logger logging.ILogger, userID, roleID int64, roleName, action string) {
+	change := &iamentity.UserRoleChange{
+		UserID:    userID,
+		RoleID:    roleID,
+		RoleName:  roleName,
+		Action:    action,
+		ChangedAt: time.Now(),
+	}
+	if err := userRepo.RecordRoleChange(ctx, change); err != nil {
+		logger.Warn(ctx, "记录角色变更失败",
+			logging.Error(err),
+			logging.Int64("user_id", userID),
+			logging.Int64("role_id", roleID),
+			logging.String("action", action),
+		)
+	}
+}
+
+// GrantGroupDefaultRoles 为加入组织的用户授予组织的默认角色（仅 active 且未软删），返回新授予的角色
+//
+// 用户已持有（未过期）的角色保持不变，无论是直接分配还是由其他组织授予；
+// 新授予的分配为永久、全局分配，并记录来源组织（source_group_id），供离开组织时由 RevokeGroupDefaultRoles 回收。
+func GrantGroupDefaultRoles(ctx context.Context, userRepo *userrepo.UserRepo, roleRepo *rolerepo.RoleRepo, groupID, userID int64) ([]*iamentity.Role, error) {
+	// 1. 查询组织默认角色
+	roles, err := roleRepo.FindByGroupID(ctx, groupID, false, false)
+	if err != nil || len(roles) == 0 {
+		return nil, err
+	}
+
+	// 2. 查询用户已持有的角色
+	assignments, err := roleRepo.FindUserRoleAssignments(ctx, []int64{userID})
+	if err != nil {
+		return nil, err
+	}
+	held := make(map[int64]struct{}, len(assignments))
+	for _, a := range assignments {
+		held[a.RoleID] = struct{}{}
+	}
+
+	// 3. 授予缺少的角色并记录来源组织
+	source := groupID
+	var granted []*iamentity.Role
+	for _, role := range roles {
+		if _, ok := held[role.GetID()]; ok {
+			continue
+		}
+		if err := userRepo.AssignRole(ctx, userID, role.GetID()); err != nil {
+			return nil, err
+		}
+		// 已过期的历史分配可能仍在表中，统一重置为永久、全局分配
+		if err := userRepo.SetRoleExpiry(ctx, userID, role.GetID(), nil); err != nil {
+			return nil, err
+		}
+		if err := userRepo.SetRoleGroupScope(ctx, userID, role.GetID(), nil); err != nil {
+			return nil, err
+		}
+		if err := userRepo.SetRoleSourceGroup(ctx, userID, role.GetID(), &source); err != nil {
+			return nil, err
+		}
+		granted = append(granted, role)
+	}
+	return granted, nil
+}
+
+// RevokeGroupDefaultRoles 回收因加入组织而自动授予用户的角色（须在移除成员关系后调用），返回被回收的角色 ID
+//
+// 仅处理来源为该组织的分配：直接分配（含加入组织前已持有、或之后被显式分配的角色）不受影响；
+// 若用户仍属于其他以该角色为默认角色的组织，则将来源转移至该组织（取 id 最小者）而不回收。
+func RevokeGroupDefaultRoles(ctx context.Context, userRepo *userrepo.UserRepo, groupRepo *grouprepo.GroupRepo, roleRepo *rolerepo.RoleRepo, groupID, userID int64) ([]int64, error) {
+	// 1. 查询该组织授予的分配
+	assignments, err := roleRepo.FindGroupGrantedUserRoles(ctx, userID, groupID)
+	if err != nil || len(assignments) == 0 {
+		return nil, err
+	}
+
+	// 2. 查询用户仍所属组织的默认角色
+	memberships, err := groupRepo.FindMembershipsByUserIDs(ctx, []int64{userID})
+	if err != nil {
+		return nil, err
+	}
+	otherGroupIDs := make([]int64, 0, len(memberships))
+	for _, m := range memberships {
+		if m.GroupID != groupID {
+			otherGroupIDs = append(otherGroupIDs, m.GroupID)
+		}
+	}
+	roleIDsByGroup, err := roleRepo.FindGroupRoleIDs(ctx, otherGroupIDs)
+	if err != nil {
+		return nil, err
+	}
+	nextSource := make(map[int64]int64)
+	for gid, roleIDs := range roleIDsByGroup {
+		for _, roleID := range roleIDs {
+			if current, ok := nextSource[roleID]; !ok || gid < current {
+				nextSource[roleID] = gid
+			}
+		}
+	}
+
+	// 3. 转移来源或回收
+	var revoked []int64
+	for _, a := range assignments {
+		if gid, ok := nextSource[a.RoleID]; ok {
+			if err := userRepo.SetRoleSourceGroup(ctx, userID, a.RoleID, &gid); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := userRepo.RemoveRole(ctx, userID, a.RoleID); err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, a.RoleID)
+	}
+	return revoked, nil
+}
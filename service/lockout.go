@@ -0,0 +1,51 @@
+package service
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// envLoginLockoutThreshold 连续登录失败锁定阈值（环境变量）
+	envLoginLockoutThreshold = "AUTH_LOCKOUT_THRESHOLD"
+	// envLoginLockoutDuration 临时锁定时长（环境变量）
+	envLoginLockoutDuration = "AUTH_LOCKOUT_DURATION"
+
+	// DefaultLoginLockoutThreshold 默认连续失败次数阈值
+	DefaultLoginLockoutThreshold = 5
+	// DefaultLoginLockoutDuration 默认临时锁定时长
+	DefaultLoginLockoutDuration = 15 * time.Minute
+)
+
+// LoginLockoutThreshold 返回触发临时锁定的连续登录失败次数。
+//
+// 默认为 DefaultLoginLockoutThreshold；可通过 AUTH_LOCKOUT_THRESHOLD 覆盖，配置为 0 表示关闭锁定，
+// 非法值（非整数或负数）回退为默认值。
+func LoginLockoutThreshold() int {
+	v := strings.TrimSpace(os.Getenv(envLoginLockoutThreshold))
+	if v == "" {
+		return DefaultLoginLockoutThreshold
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return DefaultLoginLockoutThreshold
+	}
+	return n
+}
+
+// LoginLockoutDuration 返回临时锁定时长（到期自动解除）。
+//
+// 默认为 DefaultLoginLockoutDuration；可通过 AUTH_LOCKOUT_DURATION（如 "30m"）覆盖，非法或非正值回退为默认值。
+func LoginLockoutDuration() time.Duration {
+	v := strings.TrimSpace(os.Getenv(envLoginLockoutDuration))
+	if v == "" {
+		return DefaultLoginLockoutDuration
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return DefaultLoginLockoutDuration
+	}
+	return d
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutConfig_Env(t *testing.T) {
+	thresholds := []struct {
+		env  string
+		want int
+	}{
+		{"", DefaultLoginLockoutThreshold},
+		{"3", 3},
+		{" 0 ", 0},
+		{"-1", DefaultLoginLockoutThreshold},
+		{"abc", DefaultLoginLockoutThreshold},
+	}
+	for _, c := range thresholds {
+		t.Setenv(envLoginLockoutThreshold, c.env)
+		if got := LoginLockoutThreshold(); got != c.want {
+			t.Errorf("LoginLockoutThreshold() with %q = %d, want %d", c.env, got, c.want)
+		}
+	}
+
+	durations := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", DefaultLoginLockoutDuration},
+		{"30m", 30 * time.Minute},
+		{"0s", DefaultLoginLockoutDuration},
+		{"bad", DefaultLoginLockoutDuration},
+	}
+	for _, c := range durations {
+		t.Setenv(envLoginLockoutDuration, c.env)
+		if got := LoginLockoutDuration(); got != c.want {
+			t.Errorf("LoginLockoutDuration() with %q = %v, want %v", c.env, got, c.want)
+		}
+	}
+}
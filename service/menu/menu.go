@@ -2,17 +2,41 @@ package menu
 
 import (
 	"context"
+	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"gochen-iam/auth"
 	iamentity "gochen-iam/entity"
 	iammw "gochen-iam/middleware"
+	"gochen-iam/repo/ctxcheck"
 	menurepo "gochen-iam/repo/menu"
 	"gochen/errorx"
 	"gochen/httpx"
 	"gochen/logging"
 )
 
+const (
+	// envMenuCodeReuse 软删菜单 code 复用策略（环境变量）。
+	envMenuCodeReuse = "MENU_CODE_REUSE"
+	// MenuCodeReuseBlock 不允许复用已软删菜单的 code（默认）。
+	MenuCodeReuseBlock = "block"
+	// MenuCodeReuseRestore 复用已软删菜单的 code 时恢复该记录并以新字段覆盖。
+	MenuCodeReuseRestore = "restore"
+)
+
+// MenuCodeReusePolicy 返回当前生效的软删菜单 code 复用策略。
+//
+// 默认为 block；可通过 MENU_CODE_REUSE=restore 开启恢复覆盖，非法取值回退为 block。
+func MenuCodeReusePolicy() string {
+	if strings.ToLower(strings.TrimSpace(os.Getenv(envMenuCodeReuse))) == MenuCodeReuseRestore {
+		return MenuCodeReuseRestore
+	}
+	return MenuCodeReuseBlock
+}
+
 type MenuService struct {
 	menuRepo *menurepo.MenuItemRepo
 	logger   logging.ILogger
@@ -26,7 +50,8 @@ func NewMenuService(menuRepo *menurepo.MenuItemRepo) *MenuService {
 }
 
 type CreateMenuItemRequest struct {
-	Code      string `json:"code" binding:"required,max=100"`
+	// Code 为空时由 Title 自动生成唯一 slug（见 generateMenuCode）；显式传入时以传入值为准。
+	Code      string `json:"code" binding:"omitempty,max=100"`
 	ParentID  *int64 `json:"parent_id,omitempty" binding:"omitempty,gt=0"`
 	Title     string `json:"title" binding:"required,max=200"`
 	Path      string `json:"path,omitempty" binding:"omitempty,max=500"`
@@ -62,12 +87,26 @@ type UpdateMenuItemRequest struct {
 	AllOfPermissions []string `json:"all_of_permissions,omitempty"`
 }
 
+// ReorderMenuItemsRequest 同级菜单重排请求（ParentID 为空表示顶级菜单）。
+type ReorderMenuItemsRequest struct {
+	ParentID *int64  `json:"parent_id,omitempty" binding:"omitempty,gt=0"`
+	IDs      []int64 `json:"ids" binding:"required,min=1"`
+}
+
 func (s *MenuService) CreateMenuItem(ctx context.Context, req *CreateMenuItemRequest) (*iamentity.MenuItem, error) {
 	if req == nil {
 		return nil, errorx.New(errorx.Validation, "request is required")
 	}
+	code := req.Code
+	if code == "" && req.Title != "" {
+		generated, err := s.generateMenuCode(ctx, req.Title)
+		if err != nil {
+			return nil, err
+		}
+		code = generated
+	}
 	item := &iamentity.MenuItem{
-		Code:      req.Code,
+		Code:      code,
 		ParentID:  req.ParentID,
 		Title:     req.Title,
 		Path:      req.Path,
@@ -96,9 +135,12 @@ func (s *MenuService) CreateMenuItem(ctx context.Context, req *CreateMenuItemReq
 	}
 
 	// menu_items.code 是唯一索引，且 Delete 为软删：
-	// 这里显式检查并返回更友好的错误信息（当前策略：code 不可复用）。
+	// 这里显式检查并返回更友好的错误信息；软删记录是否可复用由 MenuCodeReusePolicy 决定。
 	if existing, err := s.menuRepo.GetByCodeWithDeleted(ctx, item.Code); err == nil && existing != nil {
 		if existing.DeletedAt != nil {
+			if MenuCodeReusePolicy() == MenuCodeReuseRestore {
+				return s.restoreMenuItemWithCode(ctx, existing, item)
+			}
 			return nil, errorx.New(errorx.Validation, "菜单 code 已被占用（已删除），当前策略不允许复用；请更换 code 或进行物理删除后重建")
 		}
 		return nil, errorx.New(errorx.Validation, "菜单 code 已存在")
@@ -117,6 +159,56 @@ func (s *MenuService) CreateMenuItem(ctx context.Context, req *CreateMenuItemReq
 	return item, nil
 }
 
+// restoreMenuItemWithCode 在单事务内恢复同 code 的软删菜单，并以新建请求的字段覆盖（保留原 ID 与创建信息）。
+func (s *MenuService) restoreMenuItemWithCode(ctx context.Context, existing, item *iamentity.MenuItem) (restored *iamentity.MenuItem, err error) {
+	// 1. 开启事务
+	txCtx, err := s.menuRepo.BeginTx(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.menuRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 2. 恢复软删记录
+	restored, err = s.menuRepo.RestoreByID(txCtx, existing.GetID())
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 以新字段覆盖
+	restored.ParentID = item.ParentID
+	restored.Title = item.Title
+	restored.Path = item.Path
+	restored.Icon = item.Icon
+	restored.Type = item.Type
+	restored.Order = item.Order
+	restored.Route = item.Route
+	restored.Component = item.Component
+	restored.Hidden = item.Hidden
+	restored.Disabled = item.Disabled
+	restored.Published = item.Published
+	restored.AnyOfPermissions = item.AnyOfPermissions
+	restored.AllOfPermissions = item.AllOfPermissions
+	restored.SetUpdatedAt(time.Now())
+	if err = s.menuRepo.Overwrite(txCtx, restored); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "更新菜单失败")
+	}
+
+	// 4. 提交事务
+	if err = s.menuRepo.Commit(txCtx); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	s.logger.Info(ctx, "[MenuService] restore menu by code reuse",
+		logging.Int64("menu_id", restored.GetID()),
+		logging.String("code", restored.Code),
+		logging.String("title", restored.Title),
+	)
+	return restored, nil
+}
+
 func (s *MenuService) UpdateMenuItem(ctx context.Context, id int64, req *UpdateMenuItemRequest) (*iamentity.MenuItem, error) {
 	if req == nil {
 		return nil, errorx.New(errorx.Validation, "request is required")
@@ -253,10 +345,284 @@ func (s *MenuService) PublishMenuItem(ctx context.Context, id int64, published b
 	return item, nil
 }
 
+// ReorderSiblings 按给定顺序重排同一父级下的菜单，依次写入 Order = 0,1,2,...（单事务）。
+//
+// parentID 为 nil 表示顶级菜单。orderedIDs 中的菜单必须存在、未软删且父级均为 parentID，不允许重复；
+// 未列出的同级菜单保持原有相对顺序（Order、Title 升序）排在其后，重排后同级 Order 不再冲突。
+func (s *MenuService) ReorderSiblings(ctx context.Context, parentID *int64, orderedIDs []int64) (err error) {
+	if len(orderedIDs) == 0 {
+		return errorx.New(errorx.Validation, "ids 不能为空")
+	}
+
+	// 1. 开启事务
+	txCtx, err := s.menuRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.menuRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 2. 校验给定菜单：存在、未软删、父级一致、不重复
+	ordered := make([]*iamentity.MenuItem, 0, len(orderedIDs))
+	seen := make(map[int64]struct{}, len(orderedIDs))
+	for _, id := range orderedIDs {
+		if _, dup := seen[id]; dup {
+			return errorx.New(errorx.Validation, "菜单 id 重复: "+strconv.FormatInt(id, 10))
+		}
+		seen[id] = struct{}{}
+
+		item, err := s.menuRepo.GetByID(txCtx, id)
+		if err != nil {
+			return err
+		}
+		if !sameParent(item.ParentID, parentID) {
+			return errorx.New(errorx.Validation, "菜单不属于同一父级: "+strconv.FormatInt(id, 10))
+		}
+		ordered = append(ordered, item)
+	}
+
+	// 3. 未列出的同级菜单按当前顺序追加在后
+	filter := menurepo.MenuItemFilter{ParentID: parentID, RootOnly: parentID == nil}
+	siblings, _, err := s.menuRepo.ListFiltered(txCtx, filter)
+	if err != nil {
+		return err
+	}
+	rest := make([]*iamentity.MenuItem, 0, len(siblings))
+	for _, item := range siblings {
+		if _, ok := seen[item.GetID()]; !ok {
+			rest = append(rest, item)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		if rest[i].Order != rest[j].Order {
+			return rest[i].Order < rest[j].Order
+		}
+		return rest[i].Title < rest[j].Title
+	})
+	ordered = append(ordered, rest...)
+
+	// 4. 依次写入 Order
+	now := time.Now()
+	for i, item := range ordered {
+		if item.Order == i {
+			continue
+		}
+		if err = s.menuRepo.UpdateOrder(txCtx, item.GetID(), i, now); err != nil {
+			return err
+		}
+	}
+
+	// 5. 提交事务
+	if err = s.menuRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	s.logger.Info(ctx, "[MenuService] reorder menus",
+		logging.Int("count", len(ordered)),
+	)
+	return nil
+}
+
+// sameParent 判断两个父级 id 是否相同（nil 表示顶级）。
+func sameParent(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// CloneMenuSubtree 深拷贝菜单节点及其全部后代（单事务），返回克隆出的根节点。
+//
+// 新 code 为 newCodePrefix + 原 code，任一 code 已被占用（含软删记录）时整体拒绝；
+// 克隆根节点与原节点同级，父子结构与 Order 保持不变，所有克隆节点均为未发布状态，便于审核后再上线。
+// 已软删的后代不会被克隆；遍历时遇到重复节点视为 parent 链路存在环。
+func (s *MenuService) CloneMenuSubtree(ctx context.Context, rootID int64, newCodePrefix string) (cloned *iamentity.MenuItem, err error) {
+	newCodePrefix = strings.TrimSpace(newCodePrefix)
+	if newCodePrefix == "" {
+		return nil, errorx.New(errorx.Validation, "code 前缀不能为空")
+	}
+
+	// 1. 开启事务
+	txCtx, err := s.menuRepo.BeginTx(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.menuRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 2. 收集子树（父节点先于子节点）
+	root, err := s.menuRepo.GetByID(txCtx, rootID)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []*iamentity.MenuItem{root}
+	visited := map[int64]struct{}{root.GetID(): {}}
+	for i := 0; i < len(nodes); i++ {
+		if err := ctxcheck.Check(ctx, "菜单遍历已取消"); err != nil {
+			return nil, err
+		}
+		parentID := nodes[i].GetID()
+		children, _, err := s.menuRepo.ListFiltered(txCtx, menurepo.MenuItemFilter{ParentID: &parentID})
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if _, ok := visited[child.GetID()]; ok {
+				return nil, errorx.New(errorx.Validation, "菜单 parent 链路存在环")
+			}
+			visited[child.GetID()] = struct{}{}
+			nodes = append(nodes, child)
+		}
+	}
+
+	// 3. 校验新 code 均可用
+	for _, node := range nodes {
+		code := newCodePrefix + node.Code
+		if len(code) > 100 {
+			return nil, errorx.New(errorx.Validation, "克隆后的菜单 code 过长: "+code)
+		}
+		existing, err := s.menuRepo.GetByCodeWithDeleted(txCtx, code)
+		if err != nil && !errorx.Is(err, errorx.NotFound) {
+			return nil, err
+		}
+		if existing != nil {
+			return nil, errorx.New(errorx.Validation, "菜单 code 已被占用: "+code)
+		}
+	}
+
+	// 4. 按序创建克隆节点，映射父节点到新 id
+	now := time.Now()
+	newIDs := make(map[int64]int64, len(nodes))
+	for _, node := range nodes {
+		parentID := node.ParentID
+		if node.GetID() != root.GetID() {
+			mapped := newIDs[*node.ParentID]
+			parentID = &mapped
+		}
+		item := &iamentity.MenuItem{
+			Code:      newCodePrefix + node.Code,
+			ParentID:  parentID,
+			Title:     node.Title,
+			Path:      node.Path,
+			Icon:      node.Icon,
+			Type:      node.Type,
+			Order:     node.Order,
+			Route:     node.Route,
+			Component: node.Component,
+
+			Hidden:    node.Hidden,
+			Disabled:  node.Disabled,
+			Published: false,
+
+			AnyOfPermissions: append(iamentity.StringArray(nil), node.AnyOfPermissions...),
+			AllOfPermissions: append(iamentity.StringArray(nil), node.AllOfPermissions...),
+		}
+		item.SetUpdatedAt(now)
+		if err = item.Validate(); err != nil {
+			return nil, err
+		}
+		if err = s.menuRepo.Create(txCtx, item); err != nil {
+			return nil, errorx.Wrap(err, errorx.Database, "创建克隆菜单失败")
+		}
+		newIDs[node.GetID()] = item.GetID()
+		if cloned == nil {
+			cloned = item
+		}
+	}
+
+	// 5. 提交事务
+	if err = s.menuRepo.Commit(txCtx); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	s.logger.Info(ctx, "[MenuService] clone menu subtree",
+		logging.Int64("source_id", rootID),
+		logging.Int64("menu_id", cloned.GetID()),
+		logging.Int("count", len(nodes)),
+	)
+	return cloned, nil
+}
+
 func (s *MenuService) ListMenuItems(ctx context.Context) ([]*iamentity.MenuItem, error) {
 	return s.menuRepo.ListAll(ctx)
 }
 
+// ListMenuItemsFilter 管理端菜单列表的过滤与分页条件。
+type ListMenuItemsFilter struct {
+	Type      string
+	Published *bool
+	Disabled  *bool
+	ParentID  *int64
+	// RootOnly 仅返回顶级菜单；设置 ParentID 时忽略。
+	RootOnly bool
+
+	Page     int // 从 1 开始，<= 0 时默认为 1
+	PageSize int // <= 0 时默认为 DefaultMenuPageSize，最大 MaxMenuPageSize
+}
+
+const (
+	DefaultMenuPageSize = 20
+	MaxMenuPageSize     = 200
+)
+
+// MenuItemPage 菜单分页结果。
+type MenuItemPage struct {
+	Items    []*iamentity.MenuItem `json:"items"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"page_size"`
+}
+
+// ListMenuItemsFiltered 按类型/发布状态/禁用状态/父节点过滤并分页返回菜单（不含软删）。
+func (s *MenuService) ListMenuItemsFiltered(ctx context.Context, filter *ListMenuItemsFilter) (*MenuItemPage, error) {
+	if filter == nil {
+		filter = &ListMenuItemsFilter{}
+	}
+	switch filter.Type {
+	case "", iamentity.MenuTypeGroup, iamentity.MenuTypePage, iamentity.MenuTypeLink:
+	default:
+		return nil, errorx.New(errorx.Validation, "menu type is invalid")
+	}
+	if filter.ParentID != nil && *filter.ParentID <= 0 {
+		return nil, errorx.New(errorx.Validation, "parent_id 无效")
+	}
+
+	page := filter.Page
+	if page <= 0 {
+		page = 1
+	}
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultMenuPageSize
+	}
+	if pageSize > MaxMenuPageSize {
+		pageSize = MaxMenuPageSize
+	}
+
+	items, total, err := s.menuRepo.ListFiltered(ctx, menurepo.MenuItemFilter{
+		Type:      filter.Type,
+		Published: filter.Published,
+		Disabled:  filter.Disabled,
+		ParentID:  filter.ParentID,
+		RootOnly:  filter.RootOnly,
+		Offset:    (page - 1) * pageSize,
+		Limit:     pageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MenuItemPage{
+		Items:    items,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
 type MenuNode struct {
 	ID       int64  `json:"id"`
 	Code     string `json:"code"`
@@ -280,13 +646,68 @@ type MenuNode struct {
 	Children []*MenuNode `json:"children,omitempty"`
 }
 
+// FindByRoute 按前端路由定位所属的已发布菜单节点（用于高亮当前菜单项）。
+//
+// 匹配 Route 或 Path 字段；多条命中时优先 Route 匹配，其次按 order、id 升序取第一条，保证结果稳定。
+func (s *MenuService) FindByRoute(ctx context.Context, route string) (*MenuNode, error) {
+	route = strings.TrimSpace(route)
+	if route == "" {
+		return nil, errorx.New(errorx.Validation, "route is required")
+	}
+
+	items, err := s.menuRepo.FindPublishedByRoute(ctx, route)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, errorx.New(errorx.NotFound, "菜单不存在")
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		ri, rj := items[i].Route == route, items[j].Route == route
+		if ri != rj {
+			return ri
+		}
+		if items[i].Order != items[j].Order {
+			return items[i].Order < items[j].Order
+		}
+		return items[i].ID < items[j].ID
+	})
+	return toNode(items[0]), nil
+}
+
 // GetMyMenuTree 返回当前用户可见的菜单树（按权限过滤）。
 func (s *MenuService) GetMyMenuTree(ctx context.Context, reqCtx httpx.IRequestContext) ([]*MenuNode, error) {
 	items, err := s.menuRepo.ListPublished(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return buildMenuTree(items, reqCtx), nil
+	if err := ctxcheck.Check(ctx, "菜单遍历已取消"); err != nil {
+		return nil, err
+	}
+	return buildMenuTree(items, requestPermissionChecker(reqCtx)), nil
+}
+
+// GetPublicMenuTree 返回公开菜单树：已登录用户与 GetMyMenuTree 一致，匿名访客仅可见无权限约束的菜单。
+func (s *MenuService) GetPublicMenuTree(ctx context.Context, reqCtx httpx.IRequestContext) ([]*MenuNode, error) {
+	if reqCtx == nil || reqCtx.GetUserID() == 0 {
+		reqCtx = nil
+	}
+	return s.GetMyMenuTree(ctx, reqCtx)
+}
+
+// PreviewMenuTree 按给定权限集合预览菜单树（管理员配置菜单时查看“持有这些权限的用户能看到什么”）。
+//
+// 可见性规则与 GetMyMenuTree 一致（支持通配符权限），但不读取当前请求上下文，也不包含 system_admin 放行。
+func (s *MenuService) PreviewMenuTree(ctx context.Context, permissions []string) ([]*MenuNode, error) {
+	items, err := s.menuRepo.ListPublished(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctxcheck.Check(ctx, "菜单遍历已取消"); err != nil {
+		return nil, err
+	}
+	return buildMenuTree(items, permissionSet(permissions)), nil
 }
 
 func (s *MenuService) validateParentNoCycle(ctx context.Context, selfID int64, parentID *int64) error {
@@ -307,6 +728,9 @@ func (s *MenuService) validateParentNoCycle(ctx context.Context, selfID int64, p
 
 	curID := *parentID
 	for curID > 0 {
+		if err := ctxcheck.Check(ctx, "菜单遍历已取消"); err != nil {
+			return err
+		}
 		if _, ok := visited[curID]; ok {
 			return errorx.New(errorx.Validation, "菜单 parent 链路存在环")
 		}
@@ -324,6 +748,59 @@ func (s *MenuService) validateParentNoCycle(ctx context.Context, selfID int64, p
 	return nil
 }
 
+const (
+	// menuCodeFallback 标题无法生成 slug（如纯中文标题）时使用的基础 code。
+	menuCodeFallback = "menu"
+	// menuCodeMaxBaseLen 预留数字后缀空间，保证最终 code 不超过 100 字符。
+	menuCodeMaxBaseLen = 90
+	// menuCodeMaxAttempts 去重尝试上限，避免异常数据下无限循环。
+	menuCodeMaxAttempts = 1000
+)
+
+// generateMenuCode 由标题生成唯一的菜单 code。
+//
+// 规则：小写、非字母数字字符折叠为 "-"；若已被占用（含软删记录），依次追加 -2、-3... 直到可用。
+func (s *MenuService) generateMenuCode(ctx context.Context, title string) (string, error) {
+	base := slugifyMenuTitle(title)
+	if base == "" {
+		base = menuCodeFallback
+	}
+
+	candidate := base
+	for i := 2; i <= menuCodeMaxAttempts; i++ {
+		_, err := s.menuRepo.GetByCodeWithDeleted(ctx, candidate)
+		if err != nil {
+			if errorx.Is(err, errorx.NotFound) {
+				return candidate, nil
+			}
+			return "", err
+		}
+		candidate = base + "-" + strconv.Itoa(i)
+	}
+	return "", errorx.New(errorx.Validation, "无法为菜单生成唯一 code，请显式指定 code")
+}
+
+// slugifyMenuTitle 将标题转换为 slug（仅保留 ASCII 字母数字，其余折叠为 "-"）。
+func slugifyMenuTitle(title string) string {
+	var b strings.Builder
+	pendingHyphen := false
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingHyphen = false
+			b.WriteRune(r)
+			if b.Len() >= menuCodeMaxBaseLen {
+				break
+			}
+			continue
+		}
+		pendingHyphen = true
+	}
+	return b.String()
+}
+
 func validateMenuPermissionCodes(anyOf []string, allOf []string) error {
 	for _, p := range anyOf {
 		if !iammw.IsValidPermissionCode(p) {
@@ -338,7 +815,47 @@ func validateMenuPermissionCodes(anyOf []string, allOf []string) error {
 	return nil
 }
 
-func buildMenuTree(items []*iamentity.MenuItem, reqCtx httpx.IRequestContext) []*MenuNode {
+// permissionChecker 菜单可见性判定所需的权限查询（当前请求上下文，或预览用的合成权限集合）。
+type permissionChecker interface {
+	// IsAdmin 为 true 时跳过权限约束（system_admin 可见全部未隐藏/未禁用菜单）
+	IsAdmin() bool
+	HasPermission(permission string) bool
+}
+
+// requestPermissions 基于请求上下文的权限查询（含 system_admin 放行，见 iammw.HasPermission）。
+type requestPermissions struct {
+	reqCtx httpx.IRequestContext
+}
+
+func (p requestPermissions) IsAdmin() bool {
+	return iammw.IsAdmin(p.reqCtx)
+}
+
+func (p requestPermissions) HasPermission(permission string) bool {
+	return iammw.HasPermission(p.reqCtx, permission)
+}
+
+// requestPermissionChecker 包装请求上下文；无上下文时返回 nil（仅显示无权限约束的菜单）。
+func requestPermissionChecker(reqCtx httpx.IRequestContext) permissionChecker {
+	if reqCtx == nil {
+		return nil
+	}
+	return requestPermissions{reqCtx: reqCtx}
+}
+
+// permissionSet 合成权限集合（按 auth.HasPermission 匹配，支持通配符）。
+type permissionSet []string
+
+// IsAdmin 合成集合只按权限判定，不含角色放行
+func (p permissionSet) IsAdmin() bool {
+	return false
+}
+
+func (p permissionSet) HasPermission(permission string) bool {
+	return auth.HasPermission(p, permission)
+}
+
+func buildMenuTree(items []*iamentity.MenuItem, checker permissionChecker) []*MenuNode {
 	nodes := make(map[int64]*MenuNode, len(items))
 	for i := range items {
 		nodes[items[i].ID] = toNode(items[i])
@@ -359,7 +876,7 @@ func buildMenuTree(items []*iamentity.MenuItem, reqCtx httpx.IRequestContext) []
 	}
 
 	sortMenuTree(roots)
-	roots = filterMenuTree(roots, reqCtx)
+	roots = filterMenuTree(roots, checker)
 	return roots
 }
 
@@ -418,12 +935,12 @@ func sortMenuTreeRec(nodes []*MenuNode, visited map[int64]struct{}) {
 	}
 }
 
-func filterMenuTree(nodes []*MenuNode, reqCtx httpx.IRequestContext) []*MenuNode {
+func filterMenuTree(nodes []*MenuNode, checker permissionChecker) []*MenuNode {
 	visited := map[int64]struct{}{}
-	return filterMenuTreeRec(nodes, reqCtx, visited)
+	return filterMenuTreeRec(nodes, checker, visited)
 }
 
-func filterMenuTreeRec(nodes []*MenuNode, reqCtx httpx.IRequestContext, visited map[int64]struct{}) []*MenuNode {
+func filterMenuTreeRec(nodes []*MenuNode, checker permissionChecker, visited map[int64]struct{}) []*MenuNode {
 	out := make([]*MenuNode, 0, len(nodes))
 	for _, n := range nodes {
 		if n == nil {
@@ -437,8 +954,8 @@ func filterMenuTreeRec(nodes []*MenuNode, reqCtx httpx.IRequestContext, visited
 		if n.Disabled || n.Hidden {
 			continue
 		}
-		n.Children = filterMenuTreeRec(n.Children, reqCtx, visited)
-		selfVisible := evaluateMenuVisibility(n, reqCtx)
+		n.Children = filterMenuTreeRec(n.Children, checker, visited)
+		selfVisible := evaluateMenuVisibility(n, checker)
 		if selfVisible || len(n.Children) > 0 {
 			out = append(out, n)
 		}
@@ -446,22 +963,26 @@ func filterMenuTreeRec(nodes []*MenuNode, reqCtx httpx.IRequestContext, visited
 	return out
 }
 
-func evaluateMenuVisibility(n *MenuNode, reqCtx httpx.IRequestContext) bool {
+func evaluateMenuVisibility(n *MenuNode, checker permissionChecker) bool {
 	// 没有上下文时：仅显示无权限约束的菜单
-	if reqCtx == nil {
+	if checker == nil {
 		return len(n.AnyOfPermissions) == 0 && len(n.AllOfPermissions) == 0
 	}
+	// system_admin：忽略 any_of/all_of 约束（hidden/disabled 已在调用方过滤）
+	if checker.IsAdmin() {
+		return true
+	}
 
 	// all_of_permissions：必须全部满足
 	for _, p := range n.AllOfPermissions {
-		if !iammw.HasPermission(reqCtx, p) {
+		if !checker.HasPermission(p) {
 			return false
 		}
 	}
 	// any_of_permissions：至少一个满足
 	if len(n.AnyOfPermissions) > 0 {
 		for _, p := range n.AnyOfPermissions {
-			if iammw.HasPermission(reqCtx, p) {
+			if checker.HasPermission(p) {
 				return true
 			}
 		}
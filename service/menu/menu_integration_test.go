@@ -0,0 +1,703 @@
+package menu_test
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	menurepo "gochen-iam/repo/menu"
+	menusvc "gochen-iam/service/menu"
+
+	"gochen/errorx"
+	"gochen/httpx"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// menuServiceTestEnv 菜单服务测试环境
+type menuServiceTestEnv struct {
+	db            *gorm.DB
+	menuService   *menusvc.MenuService
+	menuRepo      *menurepo.MenuItemRepo
+	backgroundCtx context.Context
+	cancelFunc    context.CancelFunc
+}
+
+// setupMenuServiceTest 设置测试环境
+func setupMenuServiceTest(t *testing.T) *menuServiceTestEnv {
+	dbPath := filepath.Join(t.TempDir(), "menu_test.db")
+
+	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&iamentity.MenuItem{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+
+	menuRepo, err := menurepo.NewMenuItemRepository(newMenuTestOrm(db))
+	if err != nil {
+		t.Fatalf("NewMenuItemRepository: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	return &menuServiceTestEnv{
+		db:            db,
+		menuService:   menusvc.NewMenuService(menuRepo),
+		menuRepo:      menuRepo,
+		backgroundCtx: ctx,
+		cancelFunc:    cancel,
+	}
+}
+
+// teardown 清理测试环境
+func (env *menuServiceTestEnv) teardown(t *testing.T) {
+	env.cancelFunc()
+
+	sqlDB, err := env.db.DB()
+	if err == nil {
+		sqlDB.Close()
+	}
+}
+
+// createTestMenu 创建测试菜单
+func (env *menuServiceTestEnv) createTestMenu(t *testing.T, req *menusvc.CreateMenuItemRequest) *iamentity.MenuItem {
+	item, err := env.menuService.CreateMenuItem(env.backgroundCtx, req)
+	if err != nil {
+		t.Fatalf("create test menu %s: %v", req.Code, err)
+	}
+	return item
+}
+
+func TestMenuServiceListMenuItemsFiltered(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	root := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "root", Title: "Root", Type: iamentity.MenuTypeGroup, Published: true,
+	})
+	rootID := root.GetID()
+	// 5 个已发布页面 + 2 个未发布页面 + 1 个链接，均挂在 root 下
+	for i := 0; i < 5; i++ {
+		env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+			Code: "page-" + strconv.Itoa(i), Title: "Page", Type: iamentity.MenuTypePage,
+			Route: "/page-" + strconv.Itoa(i), ParentID: &rootID, Published: true,
+		})
+	}
+	for i := 0; i < 2; i++ {
+		env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+			Code: "draft-" + strconv.Itoa(i), Title: "Draft", Type: iamentity.MenuTypePage,
+			Route: "/draft-" + strconv.Itoa(i), ParentID: &rootID,
+		})
+	}
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "link", Title: "Link", Type: iamentity.MenuTypeLink, Path: "https://example.com",
+		ParentID: &rootID, Published: true,
+	})
+
+	published := true
+	unpublished := false
+
+	// 按类型 + 发布状态过滤，并分页
+	page, err := env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{
+		Type: iamentity.MenuTypePage, Published: &published, Page: 2, PageSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("list filtered: %v", err)
+	}
+	if page.Total != 5 {
+		t.Fatalf("expected total 5, got %d", page.Total)
+	}
+	if len(page.Items) != 2 {
+		t.Fatalf("expected 2 items on page 2, got %d", len(page.Items))
+	}
+	if page.Items[0].Code != "page-2" || page.Items[1].Code != "page-3" {
+		t.Errorf("unexpected page 2 items: %s, %s", page.Items[0].Code, page.Items[1].Code)
+	}
+
+	// 最后一页不足 page_size
+	page, err = env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{
+		Type: iamentity.MenuTypePage, Published: &published, Page: 3, PageSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("list filtered last page: %v", err)
+	}
+	if len(page.Items) != 1 {
+		t.Errorf("expected 1 item on last page, got %d", len(page.Items))
+	}
+
+	// 未发布
+	page, err = env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{
+		Published: &unpublished,
+	})
+	if err != nil {
+		t.Fatalf("list unpublished: %v", err)
+	}
+	if page.Total != 2 {
+		t.Errorf("expected 2 unpublished items, got %d", page.Total)
+	}
+
+	// 按父节点 / 顶级菜单过滤
+	page, err = env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{ParentID: &rootID})
+	if err != nil {
+		t.Fatalf("list by parent: %v", err)
+	}
+	if page.Total != 8 {
+		t.Errorf("expected 8 children, got %d", page.Total)
+	}
+	page, err = env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{RootOnly: true})
+	if err != nil {
+		t.Fatalf("list root only: %v", err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 || page.Items[0].GetID() != rootID {
+		t.Errorf("expected only root item, got total=%d", page.Total)
+	}
+
+	// 软删记录不计入
+	if err := env.menuService.DeleteMenuItem(env.backgroundCtx, rootID); err != nil {
+		t.Fatalf("delete root: %v", err)
+	}
+	page, err = env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{RootOnly: true})
+	if err != nil {
+		t.Fatalf("list root only after delete: %v", err)
+	}
+	if page.Total != 0 {
+		t.Errorf("expected deleted root excluded, got total=%d", page.Total)
+	}
+}
+
+func TestMenuServiceListMenuItemsFiltered_Disabled(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	root := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "root", Title: "Root", Type: iamentity.MenuTypeGroup, Published: true,
+	})
+	rootID := root.GetID()
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "enabled", Title: "Enabled", Type: iamentity.MenuTypePage, Route: "/enabled",
+		ParentID: &rootID, Published: true,
+	})
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "disabled", Title: "Disabled", Type: iamentity.MenuTypePage, Route: "/disabled",
+		ParentID: &rootID, Published: true, Disabled: true,
+	})
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "disabled-draft", Title: "Disabled Draft", Type: iamentity.MenuTypePage, Route: "/disabled-draft",
+		ParentID: &rootID, Disabled: true,
+	})
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "disabled-root", Title: "Disabled Root", Type: iamentity.MenuTypePage, Route: "/disabled-root",
+		Published: true, Disabled: true,
+	})
+
+	yes, no := true, false
+	cases := []struct {
+		name   string
+		filter *menusvc.ListMenuItemsFilter
+		codes  []string
+	}{
+		{"disabled", &menusvc.ListMenuItemsFilter{Disabled: &yes}, []string{"disabled", "disabled-draft", "disabled-root"}},
+		{"enabled", &menusvc.ListMenuItemsFilter{Disabled: &no}, []string{"root", "enabled"}},
+		{"disabled+published", &menusvc.ListMenuItemsFilter{Disabled: &yes, Published: &yes}, []string{"disabled", "disabled-root"}},
+		{"disabled+published+parent+type", &menusvc.ListMenuItemsFilter{
+			Disabled: &yes, Published: &yes, ParentID: &rootID, Type: iamentity.MenuTypePage,
+		}, []string{"disabled"}},
+	}
+	for _, tc := range cases {
+		page, err := env.menuService.ListMenuItemsFiltered(env.backgroundCtx, tc.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if int(page.Total) != len(tc.codes) || len(page.Items) != len(tc.codes) {
+			t.Fatalf("%s: expected %d items, got total=%d items=%d", tc.name, len(tc.codes), page.Total, len(page.Items))
+		}
+		for i, code := range tc.codes {
+			if page.Items[i].Code != code {
+				t.Errorf("%s: expected item %d to be %s, got %s", tc.name, i, code, page.Items[i].Code)
+			}
+		}
+	}
+}
+
+func TestMenuServiceListMenuItemsFiltered_InvalidType(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	if _, err := env.menuService.ListMenuItemsFiltered(env.backgroundCtx, &menusvc.ListMenuItemsFilter{Type: "unknown"}); err == nil {
+		t.Fatal("expected error for invalid type")
+	}
+}
+
+func TestMenuServiceCreateMenuItem_GeneratesCodeFromTitle(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	first := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{Title: "User Management", Route: "/settings"})
+	if first.Code != "user-management" {
+		t.Fatalf("expected code user-management, got %q", first.Code)
+	}
+
+	// 与已存在 code 冲突时追加数字后缀
+	second := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{Title: "User  Management!", Route: "/settings"})
+	if second.Code != "user-management-2" {
+		t.Fatalf("expected code user-management-2, got %q", second.Code)
+	}
+
+	// 软删记录同样占用 code
+	if err := env.menuService.DeleteMenuItem(env.backgroundCtx, second.GetID()); err != nil {
+		t.Fatalf("delete menu: %v", err)
+	}
+	third := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{Title: "user management", Route: "/settings"})
+	if third.Code != "user-management-3" {
+		t.Fatalf("expected code user-management-3, got %q", third.Code)
+	}
+
+	// 无法生成 slug 的标题使用默认前缀
+	zh := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{Title: "系统设置", Route: "/settings"})
+	if zh.Code != "menu" {
+		t.Fatalf("expected fallback code menu, got %q", zh.Code)
+	}
+}
+
+func TestMenuServiceCreateMenuItem_ExplicitCodeIsAuthoritative(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	item := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{Code: "custom.code", Title: "User Management", Route: "/users"})
+	if item.Code != "custom.code" {
+		t.Fatalf("expected explicit code kept, got %q", item.Code)
+	}
+
+	// 显式 code 冲突时仍报错，而不是自动改名
+	if _, err := env.menuService.CreateMenuItem(env.backgroundCtx, &menusvc.CreateMenuItemRequest{
+		Code: "custom.code", Title: "Other", Route: "/other",
+	}); err == nil {
+		t.Fatal("expected duplicate explicit code to fail")
+	}
+}
+
+func TestMenuServiceFindByRoute(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	// path 命中但 order 更靠前的节点不应优先于 route 精确命中的节点
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "users-by-path", Title: "Users (path)", Type: iamentity.MenuTypeLink,
+		Path: "/admin/users", Order: 0, Published: true,
+	})
+	byRoute := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "users", Title: "Users", Type: iamentity.MenuTypePage,
+		Route: "/admin/users", Order: 5, Published: true,
+	})
+	// 未发布的节点不参与匹配
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "users-draft", Title: "Users draft", Type: iamentity.MenuTypePage,
+		Route: "/admin/users",
+	})
+
+	node, err := env.menuService.FindByRoute(env.backgroundCtx, " /admin/users ")
+	if err != nil {
+		t.Fatalf("find by route: %v", err)
+	}
+	if node.ID != byRoute.GetID() {
+		t.Fatalf("expected node %d (route match), got %d (%s)", byRoute.GetID(), node.ID, node.Code)
+	}
+
+	// 仅 path 命中
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "roles", Title: "Roles", Type: iamentity.MenuTypeLink,
+		Path: "/admin/roles", Published: true,
+	})
+	node, err = env.menuService.FindByRoute(env.backgroundCtx, "/admin/roles")
+	if err != nil {
+		t.Fatalf("find by path: %v", err)
+	}
+	if node.Code != "roles" {
+		t.Fatalf("expected roles, got %s", node.Code)
+	}
+
+	// 无匹配
+	if _, err := env.menuService.FindByRoute(env.backgroundCtx, "/admin/unknown"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	if _, err := env.menuService.FindByRoute(env.backgroundCtx, "  "); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for empty route, got %v", err)
+	}
+}
+
+func TestMenuServicePreviewMenuTree(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "home", Title: "Home", Type: iamentity.MenuTypePage, Route: "/home", Published: true,
+	})
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "reports", Title: "Reports", Type: iamentity.MenuTypePage, Route: "/reports", Published: true,
+		AnyOfPermissions: []string{"report:read"},
+	})
+
+	codes := func(permissions []string) []string {
+		t.Helper()
+		tree, err := env.menuService.PreviewMenuTree(env.backgroundCtx, permissions)
+		if err != nil {
+			t.Fatalf("preview: %v", err)
+		}
+		out := make([]string, 0, len(tree))
+		for _, n := range tree {
+			out = append(out, n.Code)
+		}
+		return out
+	}
+
+	// 权限约束的节点仅在预览集合包含该权限（或覆盖它的通配符）时出现
+	if got := codes(nil); len(got) != 1 || got[0] != "home" {
+		t.Fatalf("expected only home without permissions, got %v", got)
+	}
+	if got := codes([]string{"user:read"}); len(got) != 1 || got[0] != "home" {
+		t.Fatalf("expected only home with unrelated permission, got %v", got)
+	}
+	for _, permissions := range [][]string{{"report:read"}, {"report:*"}} {
+		if got := codes(permissions); len(got) != 2 {
+			t.Fatalf("expected reports visible with %v, got %v", permissions, got)
+		}
+	}
+}
+
+func TestMenuServiceCreateMenuItem_TypeSpecificValidation(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	cases := []struct {
+		name  string
+		req   *menusvc.CreateMenuItemRequest
+		valid bool
+	}{
+		{"group without target", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypeGroup}, true},
+		{"group with route", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypeGroup, Route: "/admin"}, false},
+		{"group with path", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypeGroup, Path: "/admin"}, false},
+		{"page with route", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypePage, Route: "/admin/users"}, true},
+		{"page without route", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypePage, Path: "/admin/users"}, false},
+		{"default type without route", &menusvc.CreateMenuItemRequest{}, false},
+		{"link with path", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypeLink, Path: "https://example.com"}, true},
+		{"link with route", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypeLink, Route: "/docs"}, true},
+		{"link without target", &menusvc.CreateMenuItemRequest{Type: iamentity.MenuTypeLink}, false},
+	}
+	for i, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.req.Code = "type-case-" + strconv.Itoa(i)
+			c.req.Title = c.name
+			_, err := env.menuService.CreateMenuItem(env.backgroundCtx, c.req)
+			if c.valid && err != nil {
+				t.Fatalf("expected valid, got %v", err)
+			}
+			if !c.valid && !errorx.Is(err, errorx.Validation) {
+				t.Fatalf("expected Validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMenuServiceReorderSiblings(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	root := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "reorder-root", Title: "Root", Type: iamentity.MenuTypeGroup,
+	})
+	rootID := root.GetID()
+	other := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "reorder-other", Title: "Other", Type: iamentity.MenuTypeGroup,
+	})
+	otherID := other.GetID()
+
+	// 三个同级页面，Order 均为 5（冲突）
+	var children []*iamentity.MenuItem
+	for i := 0; i < 3; i++ {
+		children = append(children, env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+			Code: "reorder-child-" + strconv.Itoa(i), Title: "Child " + strconv.Itoa(i), Type: iamentity.MenuTypePage,
+			Route: "/reorder-" + strconv.Itoa(i), ParentID: &rootID, Order: 5,
+		}))
+	}
+	foreign := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "reorder-foreign", Title: "Foreign", Type: iamentity.MenuTypePage,
+		Route: "/reorder-foreign", ParentID: &otherID, Order: 7,
+	})
+
+	orderOf := func(id int64) int {
+		t.Helper()
+		item, err := env.menuRepo.GetByID(ctx, id)
+		if err != nil {
+			t.Fatalf("get menu %d: %v", id, err)
+		}
+		return item.Order
+	}
+
+	// 按给定顺序写入 0,1,2
+	ids := []int64{children[2].GetID(), children[0].GetID(), children[1].GetID()}
+	if err := env.menuService.ReorderSiblings(ctx, &rootID, ids); err != nil {
+		t.Fatalf("ReorderSiblings: %v", err)
+	}
+	for i, id := range ids {
+		if got := orderOf(id); got != i {
+			t.Errorf("menu %d: expected order %d, got %d", id, i, got)
+		}
+	}
+
+	// 混合父级：整体拒绝，原顺序不变
+	err := env.menuService.ReorderSiblings(ctx, &rootID, []int64{children[1].GetID(), foreign.GetID(), children[2].GetID()})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for mixed parents, got %v", err)
+	}
+	for i, id := range ids {
+		if got := orderOf(id); got != i {
+			t.Errorf("menu %d: expected order %d unchanged, got %d", id, i, got)
+		}
+	}
+	if got := orderOf(foreign.GetID()); got != 7 {
+		t.Errorf("foreign menu: expected order 7 unchanged, got %d", got)
+	}
+
+	// 顶级菜单不能与子菜单混排
+	if err := env.menuService.ReorderSiblings(ctx, nil, []int64{rootID, children[0].GetID()}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for child under nil parent, got %v", err)
+	}
+
+	// 重复 id
+	if err := env.menuService.ReorderSiblings(ctx, &rootID, []int64{children[0].GetID(), children[0].GetID()}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for duplicate ids, got %v", err)
+	}
+
+	// 不存在与已软删的菜单
+	if err := env.menuService.ReorderSiblings(ctx, &rootID, []int64{999999}); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing menu, got %v", err)
+	}
+	if err := env.menuService.DeleteMenuItem(ctx, children[1].GetID()); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+	if err := env.menuService.ReorderSiblings(ctx, &rootID, []int64{children[1].GetID()}); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for soft-deleted menu, got %v", err)
+	}
+
+	// 仅列出部分同级时，其余同级按原顺序追加在后
+	if err := env.menuService.ReorderSiblings(ctx, &rootID, []int64{children[0].GetID()}); err != nil {
+		t.Fatalf("ReorderSiblings partial: %v", err)
+	}
+	if orderOf(children[0].GetID()) != 0 || orderOf(children[2].GetID()) != 1 {
+		t.Errorf("expected partial reorder to normalize siblings, got %d/%d",
+			orderOf(children[0].GetID()), orderOf(children[2].GetID()))
+	}
+}
+
+func TestMenuServiceCloneMenuSubtree(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	// root -> (section -> leaf, page)，另有一个已软删的子节点
+	root := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "ops", Title: "Ops", Type: iamentity.MenuTypeGroup, Published: true,
+	})
+	rootID := root.GetID()
+	section := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "ops-section", Title: "Section", Type: iamentity.MenuTypeGroup, ParentID: &rootID, Order: 1, Published: true,
+	})
+	sectionID := section.GetID()
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "ops-leaf", Title: "Leaf", Type: iamentity.MenuTypePage, Route: "/ops/leaf", ParentID: &sectionID,
+		Published: true, AnyOfPermissions: []string{"ops:read"},
+	})
+	env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "ops-page", Title: "Page", Type: iamentity.MenuTypePage, Route: "/ops/page", ParentID: &rootID, Order: 2, Published: true,
+	})
+	removed := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "ops-removed", Title: "Removed", Type: iamentity.MenuTypePage, Route: "/ops/removed", ParentID: &rootID,
+	})
+	if err := env.menuService.DeleteMenuItem(ctx, removed.GetID()); err != nil {
+		t.Fatalf("DeleteMenuItem: %v", err)
+	}
+
+	cloned, err := env.menuService.CloneMenuSubtree(ctx, rootID, "eu-")
+	if err != nil {
+		t.Fatalf("CloneMenuSubtree: %v", err)
+	}
+	if cloned.Code != "eu-ops" || cloned.ParentID != nil || cloned.GetID() == rootID {
+		t.Fatalf("unexpected cloned root: %+v", cloned)
+	}
+
+	byCode := func(code string) *iamentity.MenuItem {
+		t.Helper()
+		item, err := env.menuRepo.GetByCode(ctx, code)
+		if err != nil {
+			t.Fatalf("get %s: %v", code, err)
+		}
+		return item
+	}
+	clonedSection := byCode("eu-ops-section")
+	clonedLeaf := byCode("eu-ops-leaf")
+	clonedPage := byCode("eu-ops-page")
+
+	// 层级与排序保持一致
+	if clonedSection.ParentID == nil || *clonedSection.ParentID != cloned.GetID() || clonedSection.Order != 1 {
+		t.Errorf("unexpected cloned section: %+v", clonedSection)
+	}
+	if clonedPage.ParentID == nil || *clonedPage.ParentID != cloned.GetID() || clonedPage.Order != 2 {
+		t.Errorf("unexpected cloned page: %+v", clonedPage)
+	}
+	if clonedLeaf.ParentID == nil || *clonedLeaf.ParentID != clonedSection.GetID() || clonedLeaf.Route != "/ops/leaf" {
+		t.Errorf("unexpected cloned leaf: %+v", clonedLeaf)
+	}
+	if len(clonedLeaf.AnyOfPermissions) != 1 || clonedLeaf.AnyOfPermissions[0] != "ops:read" {
+		t.Errorf("expected permissions copied, got %v", clonedLeaf.AnyOfPermissions)
+	}
+
+	// 克隆节点均未发布，软删节点不克隆
+	for _, item := range []*iamentity.MenuItem{byCode("eu-ops"), clonedSection, clonedLeaf, clonedPage} {
+		if item.Published {
+			t.Errorf("expected cloned menu %s unpublished", item.Code)
+		}
+	}
+	if _, err := env.menuRepo.GetByCodeWithDeleted(ctx, "eu-ops-removed"); !errorx.Is(err, errorx.NotFound) {
+		t.Errorf("expected soft-deleted child not cloned, got %v", err)
+	}
+
+	// 原子树不受影响
+	if orig := byCode("ops-leaf"); orig.ParentID == nil || *orig.ParentID != sectionID || !orig.Published {
+		t.Errorf("expected original leaf unchanged, got %+v", orig)
+	}
+
+	// 再次使用相同前缀：code 冲突，整体拒绝且不产生部分数据
+	before, err := env.menuService.ListMenuItems(ctx)
+	if err != nil {
+		t.Fatalf("ListMenuItems: %v", err)
+	}
+	if _, err := env.menuService.CloneMenuSubtree(ctx, rootID, "eu-"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for code conflict, got %v", err)
+	}
+	after, err := env.menuService.ListMenuItems(ctx)
+	if err != nil {
+		t.Fatalf("ListMenuItems: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("expected no partial clone, got %d -> %d items", len(before), len(after))
+	}
+
+	// 空前缀
+	if _, err := env.menuService.CloneMenuSubtree(ctx, rootID, "  "); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for empty prefix, got %v", err)
+	}
+}
+
+func TestMenuServiceActorColumns(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	creatorCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(42))
+	editorCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(43))
+
+	item, err := env.menuService.CreateMenuItem(creatorCtx, &menusvc.CreateMenuItemRequest{Title: "Audit", Route: "/audit"})
+	if err != nil {
+		t.Fatalf("CreateMenuItem failed: %v", err)
+	}
+	if item.CreatedBy != 42 || item.UpdatedBy != 42 {
+		t.Fatalf("expected creator stamped on create, got %d/%d", item.CreatedBy, item.UpdatedBy)
+	}
+
+	title := "Audit Log"
+	if _, err := env.menuService.UpdateMenuItem(editorCtx, item.GetID(), &menusvc.UpdateMenuItemRequest{Title: title}); err != nil {
+		t.Fatalf("UpdateMenuItem failed: %v", err)
+	}
+	stored, err := env.menuRepo.GetByID(env.backgroundCtx, item.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.CreatedBy != 42 || stored.UpdatedBy != 43 {
+		t.Fatalf("expected created_by=42 updated_by=43, got %d/%d", stored.CreatedBy, stored.UpdatedBy)
+	}
+
+	// 排序、软删与恢复同样写入操作者
+	sibling, err := env.menuService.CreateMenuItem(creatorCtx, &menusvc.CreateMenuItemRequest{Title: "Audit Export", Route: "/audit-export"})
+	if err != nil {
+		t.Fatalf("CreateMenuItem failed: %v", err)
+	}
+	if err := env.menuService.ReorderSiblings(creatorCtx, nil, []int64{sibling.GetID(), item.GetID()}); err != nil {
+		t.Fatalf("ReorderSiblings failed: %v", err)
+	}
+	if stored, err = env.menuRepo.GetByID(env.backgroundCtx, item.GetID()); err != nil || stored.UpdatedBy != 42 {
+		t.Fatalf("expected updated_by=42 after reorder, got %+v, %v", stored, err)
+	}
+	if err := env.menuService.DeleteMenuItem(editorCtx, item.GetID()); err != nil {
+		t.Fatalf("DeleteMenuItem failed: %v", err)
+	}
+	deleted, err := env.menuRepo.GetByIDWithDeleted(env.backgroundCtx, item.GetID())
+	if err != nil {
+		t.Fatalf("GetByIDWithDeleted failed: %v", err)
+	}
+	if deleted.DeletedAt == nil || deleted.DeletedBy != 43 || deleted.UpdatedBy != 43 {
+		t.Fatalf("expected soft delete stamped by 43, got %+v", deleted)
+	}
+	restored, err := env.menuService.RestoreMenuItem(creatorCtx, item.GetID())
+	if err != nil {
+		t.Fatalf("RestoreMenuItem failed: %v", err)
+	}
+	if restored.DeletedBy != 0 || restored.UpdatedBy != 42 {
+		t.Fatalf("expected deleted_by cleared and updated_by=42 after restore, got %d/%d", restored.DeletedBy, restored.UpdatedBy)
+	}
+}
+
+func TestMenuServiceCreateMenuItem_CodeReusePolicy(t *testing.T) {
+	env := setupMenuServiceTest(t)
+	defer env.teardown(t)
+
+	old := env.createTestMenu(t, &menusvc.CreateMenuItemRequest{
+		Code: "reports", Title: "Reports", Type: iamentity.MenuTypePage, Route: "/reports",
+		Published: true, AnyOfPermissions: []string{"report:read"},
+	})
+	if err := env.menuService.DeleteMenuItem(env.backgroundCtx, old.GetID()); err != nil {
+		t.Fatalf("delete menu: %v", err)
+	}
+	req := &menusvc.CreateMenuItemRequest{
+		Code: "reports", Title: "Reports v2", Type: iamentity.MenuTypePage, Route: "/reports/v2", Order: 3,
+	}
+
+	// 默认 block：保持原有错误
+	t.Setenv("MENU_CODE_REUSE", "")
+	if _, err := env.menuService.CreateMenuItem(env.backgroundCtx, req); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error under block policy, got %v", err)
+	}
+
+	// restore：恢复原记录并以新字段覆盖
+	t.Setenv("MENU_CODE_REUSE", "restore")
+	item, err := env.menuService.CreateMenuItem(env.backgroundCtx, req)
+	if err != nil {
+		t.Fatalf("create under restore policy: %v", err)
+	}
+	if item.GetID() != old.GetID() {
+		t.Fatalf("expected tombstoned row %d revived, got id %d", old.GetID(), item.GetID())
+	}
+
+	reloaded, err := env.menuRepo.GetByID(env.backgroundCtx, old.GetID())
+	if err != nil {
+		t.Fatalf("reload restored menu: %v", err)
+	}
+	if reloaded.DeletedAt != nil {
+		t.Fatal("expected restored menu not deleted")
+	}
+	if reloaded.Title != "Reports v2" || reloaded.Route != "/reports/v2" || reloaded.Order != 3 {
+		t.Errorf("expected new field values, got title=%q route=%q order=%d", reloaded.Title, reloaded.Route, reloaded.Order)
+	}
+	if reloaded.Published || len(reloaded.AnyOfPermissions) != 0 {
+		t.Errorf("expected old published/permissions overwritten, got published=%v any_of=%v", reloaded.Published, reloaded.AnyOfPermissions)
+	}
+
+	// 未删除的同 code 记录仍然冲突
+	if _, err := env.menuService.CreateMenuItem(env.backgroundCtx, req); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for live duplicate code, got %v", err)
+	}
+}
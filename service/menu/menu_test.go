@@ -58,7 +58,7 @@ func TestBuildMenuTree_WithPermissions_AnyAllAndParentRetention(t *testing.T) {
 	reqCtx = auth.WithRoles(reqCtx, []string{"user"})
 	reqCtx = auth.WithPermissions(reqCtx, []string{"a:b"})
 
-	tree := buildMenuTree(items, reqCtx)
+	tree := buildMenuTree(items, requestPermissionChecker(reqCtx))
 	if len(tree) != 1 {
 		t.Fatalf("expected 1 root, got %d", len(tree))
 	}
@@ -82,7 +82,7 @@ func TestBuildMenuTree_TenantOverride_AppliesAndFilters(t *testing.T) {
 	reqCtx = hbasic.WithUserID(reqCtx, 1)
 	reqCtx = auth.WithRoles(reqCtx, []string{"user"})
 
-	tree := buildMenuTree(items, reqCtx)
+	tree := buildMenuTree(items, requestPermissionChecker(reqCtx))
 	if len(tree) != 1 || tree[0].Code != "root" {
 		t.Fatalf("expected root to be visible, got %#v", tree)
 	}
@@ -112,3 +112,59 @@ func TestSortAndFilterMenuTree_CycleDoesNotStackOverflow(t *testing.T) {
 	sortMenuTree([]*MenuNode{a})
 	_ = filterMenuTree([]*MenuNode{a}, nil)
 }
+
+func TestSlugifyMenuTitle(t *testing.T) {
+	cases := map[string]string{
+		"User Management":        "user-management",
+		"  Roles & Permissions ": "roles-permissions",
+		"API_v2 -- Keys":         "api-v2-keys",
+		"用户管理":                   "",
+		"Audit 日志 Logs":          "audit-logs",
+	}
+	for in, want := range cases {
+		if got := slugifyMenuTitle(in); got != want {
+			t.Errorf("slugifyMenuTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBuildMenuTree_PermissionSet(t *testing.T) {
+	items := []*iamentity.MenuItem{
+		{Entity: crud.Entity[int64]{ID: 1}, Code: "root", Title: "Root", Published: true},
+		{Entity: crud.Entity[int64]{ID: 2}, Code: "secure", Title: "Secure", Published: true, AllOfPermissions: iamentity.StringArray{"a:b", "c:d"}},
+	}
+
+	// 合成权限集合不读取请求上下文：all_of 需全部持有
+	if tree := buildMenuTree(items, permissionSet{"a:b"}); len(tree) != 1 || tree[0].Code != "root" {
+		t.Fatalf("expected only root with partial permissions, got %#v", tree)
+	}
+	if tree := buildMenuTree(items, permissionSet{"a:b", "c:d"}); len(tree) != 2 {
+		t.Fatalf("expected secure visible with full permissions, got %#v", tree)
+	}
+}
+
+func TestBuildMenuTree_AdminSeesAllPermissionGated(t *testing.T) {
+	rootID := int64(1)
+	items := []*iamentity.MenuItem{
+		{Entity: crud.Entity[int64]{ID: rootID}, Code: "root", Title: "Root", Published: true, AllOfPermissions: iamentity.StringArray{"x:y", "z:w"}},
+		{Entity: crud.Entity[int64]{ID: 2}, Code: "child", ParentID: &rootID, Title: "Child", Published: true, AnyOfPermissions: iamentity.StringArray{"a:b"}},
+		{Entity: crud.Entity[int64]{ID: 3}, Code: "other", Title: "Other", Published: true, AnyOfPermissions: iamentity.StringArray{"c:d"}},
+		{Entity: crud.Entity[int64]{ID: 4}, Code: "hidden", Title: "Hidden", Published: true, Hidden: true},
+	}
+
+	// token 中只有 system_admin 角色，没有任何权限声明
+	reqCtx, err := hbasic.NewRequestContext(context.Background())
+	if err != nil {
+		t.Fatalf("NewRequestContext: %v", err)
+	}
+	reqCtx = hbasic.WithUserID(reqCtx, 1)
+	reqCtx = auth.WithRoles(reqCtx, []string{"system_admin"})
+
+	tree := buildMenuTree(items, requestPermissionChecker(reqCtx))
+	if len(tree) != 2 || tree[0].Code != "other" || tree[1].Code != "root" {
+		t.Fatalf("expected other and root visible, got %#v", tree)
+	}
+	if len(tree[1].Children) != 1 || tree[1].Children[0].Code != "child" {
+		t.Fatalf("expected child visible under root, got %#v", tree[1].Children)
+	}
+}
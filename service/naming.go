@@ -0,0 +1,14 @@
+package service
+
+import "strings"
+
+// NormalizeName 规范化角色/组织名称：始终去除首尾空白，caseFold 为 true 时统一转为小写。
+//
+// 在唯一性检查与落库前调用，避免 "Manager" 与 " Manager" 被视为不同名称。
+func NormalizeName(name string, caseFold bool) string {
+	name = strings.TrimSpace(name)
+	if caseFold {
+		name = strings.ToLower(name)
+	}
+	return name
+}
@@ -0,0 +1,22 @@
+package service
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	cases := []struct {
+		name     string
+		caseFold bool
+		want     string
+	}{
+		{" Manager ", false, "Manager"},
+		{"Manager", false, "Manager"},
+		{" Manager ", true, "manager"},
+		{"\tDev Ops\n", true, "dev ops"},
+		{"   ", false, ""},
+	}
+	for _, c := range cases {
+		if got := NormalizeName(c.name, c.caseFold); got != c.want {
+			t.Errorf("NormalizeName(%q, %v) = %q; want %q", c.name, c.caseFold, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"gochen/errorx"
+)
+
+const (
+	// envPasswordMinLength 最小密码长度配置（环境变量）。
+	envPasswordMinLength = "AUTH_PASSWORD_MIN_LENGTH"
+	// envBcryptCost bcrypt 哈希成本配置（环境变量）。
+	envBcryptCost = "AUTH_BCRYPT_COST"
+	// envPasswordMaxAge 密码最长有效期配置（环境变量）。
+	envPasswordMaxAge = "AUTH_PASSWORD_MAX_AGE"
+	// envPasswordHistorySize 禁止重复使用的历史密码个数（环境变量）。
+	envPasswordHistorySize = "AUTH_PASSWORD_HISTORY_SIZE"
+	// maxPasswordHistorySize 历史密码个数上限（每个候选密码需逐一 bcrypt 比对，避免修改密码耗时过长）。
+	maxPasswordHistorySize = 24
+	// envPasswordMaxLength 最大密码长度配置（环境变量）。
+	envPasswordMaxLength = "AUTH_PASSWORD_MAX_LENGTH"
+	// envPasswordRequireUpper 密码须包含大写字母（环境变量）。
+	envPasswordRequireUpper = "AUTH_PASSWORD_REQUIRE_UPPER"
+	// envPasswordRequireLower 密码须包含小写字母（环境变量）。
+	envPasswordRequireLower = "AUTH_PASSWORD_REQUIRE_LOWER"
+	// envPasswordRequireDigit 密码须包含数字（环境变量）。
+	envPasswordRequireDigit = "AUTH_PASSWORD_REQUIRE_DIGIT"
+	// envPasswordRequireSpecial 密码须包含特殊字符（环境变量）。
+	envPasswordRequireSpecial = "AUTH_PASSWORD_REQUIRE_SPECIAL"
+)
+
+// PasswordHistorySize 返回禁止重复使用的历史密码个数 N。
+//
+// 默认为 0，表示不启用；可通过 AUTH_PASSWORD_HISTORY_SIZE 开启，取值需在 [0, 24] 范围内，否则视为不启用。
+// 启用后修改/重置密码时，新密码不得与最近 N 个密码相同（当前密码计入 N，另保留最近 N-1 个历史密码）。
+func PasswordHistorySize() int {
+	v := strings.TrimSpace(os.Getenv(envPasswordHistorySize))
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > maxPasswordHistorySize {
+		return 0
+	}
+	return n
+}
+
+// PasswordPolicy 密码强度策略。
+//
+// 默认仅校验长度（与历史行为一致）；字符类别要求需通过环境变量显式开启，见 PasswordPolicyFromEnv。
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSpecial bool
+}
+
+// PasswordPolicyFromEnv 按环境变量构造当前生效的密码策略。
+//
+//   - 最小长度见 PasswordMinLength；
+//   - AUTH_PASSWORD_MAX_LENGTH 取值需在 [最小长度, MaxPasswordLength] 范围内，否则回退为 MaxPasswordLength；
+//   - AUTH_PASSWORD_REQUIRE_UPPER/LOWER/DIGIT/SPECIAL 为 true/1 时开启对应字符类别要求。
+func PasswordPolicyFromEnv() *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:      PasswordMinLength(),
+		MaxLength:      MaxPasswordLength,
+		RequireUpper:   envFlag(envPasswordRequireUpper),
+		RequireLower:   envFlag(envPasswordRequireLower),
+		RequireDigit:   envFlag(envPasswordRequireDigit),
+		RequireSpecial: envFlag(envPasswordRequireSpecial),
+	}
+	if v := strings.TrimSpace(os.Getenv(envPasswordMaxLength)); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= policy.MinLength && n <= MaxPasswordLength {
+			policy.MaxLength = n
+		}
+	}
+	return policy
+}
+
+// Validate 按策略校验密码，返回第一条未满足规则对应的 Validation 错误。
+func (p *PasswordPolicy) Validate(password string) error {
+	if password == "" {
+		return errorx.New(errorx.Validation, "密码不能为空")
+	}
+	if len(password) < p.MinLength {
+		return errorx.New(errorx.Validation, fmt.Sprintf("密码长度不能少于%d个字符", p.MinLength))
+	}
+	maxLen := p.MaxLength
+	if maxLen <= 0 || maxLen > MaxPasswordLength {
+		maxLen = MaxPasswordLength
+	}
+	if len(password) > maxLen {
+		return errorx.New(errorx.Validation, fmt.Sprintf("密码长度不能超过%d个字符", maxLen))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r) && !unicode.IsSpace(r):
+			hasSpecial = true
+		}
+	}
+	if p.RequireUpper && !hasUpper {
+		return errorx.New(errorx.Validation, "密码必须包含大写字母")
+	}
+	if p.RequireLower && !hasLower {
+		return errorx.New(errorx.Validation, "密码必须包含小写字母")
+	}
+	if p.RequireDigit && !hasDigit {
+		return errorx.New(errorx.Validation, "密码必须包含数字")
+	}
+	if p.RequireSpecial && !hasSpecial {
+		return errorx.New(errorx.Validation, "密码必须包含特殊字符")
+	}
+	return nil
+}
+
+// ValidatePassword 按当前生效的密码策略校验密码（注册、修改密码、重置密码的统一入口）。
+func ValidatePassword(password string) error {
+	return PasswordPolicyFromEnv().Validate(password)
+}
+
+// envFlag 读取布尔型环境变量（true/1 视为开启）
+func envFlag(key string) bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(key)))
+	return v == "true" || v == "1"
+}
+
+// PasswordMinLength 返回当前生效的最小密码长度。
+//
+// 默认为 MinPasswordLength；可通过 AUTH_PASSWORD_MIN_LENGTH 覆盖，
+// 取值需在 [1, MaxPasswordLength] 范围内，否则回退为默认值。
+// 注册、修改密码、重置密码与 BusinessValidator 均以此为准，避免各入口规则不一致。
+func PasswordMinLength() int {
+	v := strings.TrimSpace(os.Getenv(envPasswordMinLength))
+	if v == "" {
+		return MinPasswordLength
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > MaxPasswordLength {
+		return MinPasswordLength
+	}
+	return n
+}
+
+// BcryptCost 返回密码哈希使用的 bcrypt 成本。
+//
+// 默认为 bcrypt.DefaultCost；可通过 AUTH_BCRYPT_COST 覆盖，
+// 取值需在 [bcrypt.MinCost, bcrypt.MaxCost] 范围内，否则回退为默认值。
+// 调高后，存量低成本哈希会在用户下次成功登录时透明升级。
+func BcryptCost() int {
+	v := strings.TrimSpace(os.Getenv(envBcryptCost))
+	if v == "" {
+		return bcrypt.DefaultCost
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < bcrypt.MinCost || n > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return n
+}
+
+// PasswordMaxAge 返回密码最长有效期（自最近一次设置密码起算）。
+//
+// 默认为 0，表示未启用密码过期；可通过 AUTH_PASSWORD_MAX_AGE（如 "2160h"）开启，
+// 非法或非正值视为未启用。
+func PasswordMaxAge() time.Duration {
+	v := strings.TrimSpace(os.Getenv(envPasswordMaxAge))
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// ValidatePasswordLength 仅校验密码长度（不含字符类别要求，完整策略见 ValidatePassword）。
+func ValidatePasswordLength(password string) error {
+	if password == "" {
+		return errorx.New(errorx.Validation, "密码不能为空")
+	}
+	if minLen := PasswordMinLength(); len(password) < minLen {
+		return errorx.New(errorx.Validation, fmt.Sprintf("密码长度不能少于%d个字符", minLen))
+	}
+	if len(password) > MaxPasswordLength {
+		return errorx.New(errorx.Validation, fmt.Sprintf("密码长度不能超过%d个字符", MaxPasswordLength))
+	}
+	return nil
+}
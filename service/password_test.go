@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"gochen/errorx"
+)
+
+func TestPasswordMinLength_Env(t *testing.T) {
+	cases := []struct {
+		env  string
+		want int
+	}{
+		{"", MinPasswordLength},
+		{"12", 12},
+		{" 10 ", 10},
+		{"0", MinPasswordLength},
+		{"-1", MinPasswordLength},
+		{"abc", MinPasswordLength},
+		{"256", MinPasswordLength},
+	}
+	for _, c := range cases {
+		t.Setenv(envPasswordMinLength, c.env)
+		if got := PasswordMinLength(); got != c.want {
+			t.Errorf("PasswordMinLength() with %q = %d, want %d", c.env, got, c.want)
+		}
+	}
+}
+
+func TestPasswordMaxAge_Env(t *testing.T) {
+	cases := []struct {
+		env  string
+		want time.Duration
+	}{
+		{"", 0},
+		{"2160h", 2160 * time.Hour},
+		{" 720h ", 720 * time.Hour},
+		{"0", 0},
+		{"-1h", 0},
+		{"abc", 0},
+	}
+	for _, c := range cases {
+		t.Setenv(envPasswordMaxAge, c.env)
+		if got := PasswordMaxAge(); got != c.want {
+			t.Errorf("PasswordMaxAge() with %q = %s, want %s", c.env, got, c.want)
+		}
+	}
+}
+
+func TestBcryptCost_Env(t *testing.T) {
+	cases := []struct {
+		env  string
+		want int
+	}{
+		{"", bcrypt.DefaultCost},
+		{"12", 12},
+		{" 4 ", bcrypt.MinCost},
+		{"3", bcrypt.DefaultCost},
+		{"32", bcrypt.DefaultCost},
+		{"abc", bcrypt.DefaultCost},
+	}
+	for _, c := range cases {
+		t.Setenv(envBcryptCost, c.env)
+		if got := BcryptCost(); got != c.want {
+			t.Errorf("BcryptCost() with %q = %d, want %d", c.env, got, c.want)
+		}
+	}
+}
+
+func TestValidatePasswordLength_UsesConfiguredMinimum(t *testing.T) {
+	t.Setenv(envPasswordMinLength, "10")
+
+	err := ValidatePasswordLength("123456789")
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "10") {
+		t.Fatalf("expected message mentions configured minimum, got %v", err)
+	}
+	if err := ValidatePasswordLength("1234567890"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ValidatePasswordLength(strings.Repeat("a", MaxPasswordLength+1)); err == nil {
+		t.Fatal("expected error for too long password")
+	}
+}
+
+func TestBusinessValidator_PasswordUsesConfiguredMinimum(t *testing.T) {
+	t.Setenv(envPasswordMinLength, "10")
+
+	v := NewBusinessValidator(nil, nil, nil)
+	err := v.ValidateUserRegistration(context.Background(), &RegisterRequest{
+		Username: "validator_user",
+		Email:    "validator@example.com",
+		Password: "123456789",
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error for short password, got %v", err)
+	}
+	if err := v.validatePasswordStrength("1234567890"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPasswordPolicy_Rules(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		wantMsg  string
+	}{
+		{"empty", PasswordPolicy{MinLength: 8}, "", "密码不能为空"},
+		{"too short", PasswordPolicy{MinLength: 8}, "Ab1!", "密码长度不能少于8个字符"},
+		{"too long", PasswordPolicy{MinLength: 8, MaxLength: 10}, "Abcdefgh1!x", "密码长度不能超过10个字符"},
+		{"missing upper", PasswordPolicy{MinLength: 8, RequireUpper: true}, "abcdefg1!", "密码必须包含大写字母"},
+		{"missing lower", PasswordPolicy{MinLength: 8, RequireLower: true}, "ABCDEFG1!", "密码必须包含小写字母"},
+		{"missing digit", PasswordPolicy{MinLength: 8, RequireDigit: true}, "Abcdefgh!", "密码必须包含数字"},
+		{"missing special", PasswordPolicy{MinLength: 8, RequireSpecial: true}, "Abcdefgh1", "密码必须包含特殊字符"},
+		{"space is not special", PasswordPolicy{MinLength: 8, RequireSpecial: true}, "Abcd efgh1", "密码必须包含特殊字符"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.policy.Validate(c.password)
+			if !errorx.Is(err, errorx.Validation) {
+				t.Fatalf("expected Validation error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), c.wantMsg) {
+				t.Fatalf("expected message %q, got %v", c.wantMsg, err)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyFromEnv_Table(t *testing.T) {
+	configs := []struct {
+		name string
+		env  map[string]string
+		pass []string
+		fail []string
+	}{
+		{
+			name: "default length only",
+			env:  map[string]string{},
+			pass: []string{"password", "12345678", "        "},
+			fail: []string{"short", strings.Repeat("a", MaxPasswordLength+1)},
+		},
+		{
+			name: "upper and digit",
+			env:  map[string]string{envPasswordRequireUpper: "true", envPasswordRequireDigit: "1"},
+			pass: []string{"Password1", "ABCDEFG1"},
+			fail: []string{"password1", "Password", "Pass1"},
+		},
+		{
+			name: "full complexity",
+			env: map[string]string{
+				envPasswordMinLength:      "10",
+				envPasswordMaxLength:      "16",
+				envPasswordRequireUpper:   "true",
+				envPasswordRequireLower:   "true",
+				envPasswordRequireDigit:   "true",
+				envPasswordRequireSpecial: "true",
+			},
+			pass: []string{"Passw0rd!xyz", "aB3#aB3#aB3#"},
+			fail: []string{"Passw0rd!", "passw0rd!xyz", "PASSW0RD!XYZ", "Password!xyz", "Passw0rdxyzz", "Passw0rd!xyz12345"},
+		},
+		{
+			name: "invalid max length falls back",
+			env:  map[string]string{envPasswordMaxLength: "4"},
+			pass: []string{strings.Repeat("a", MaxPasswordLength)},
+			fail: []string{"short"},
+		},
+	}
+	for _, c := range configs {
+		t.Run(c.name, func(t *testing.T) {
+			for _, key := range []string{envPasswordMinLength, envPasswordMaxLength, envPasswordRequireUpper, envPasswordRequireLower, envPasswordRequireDigit, envPasswordRequireSpecial} {
+				t.Setenv(key, c.env[key])
+			}
+			for _, p := range c.pass {
+				if err := ValidatePassword(p); err != nil {
+					t.Errorf("expected %q to pass, got %v", p, err)
+				}
+			}
+			for _, p := range c.fail {
+				if err := ValidatePassword(p); !errorx.Is(err, errorx.Validation) {
+					t.Errorf("expected %q to fail with Validation, got %v", p, err)
+				}
+			}
+		})
+	}
+}
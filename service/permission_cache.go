@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	iamevent "gochen-iam/event"
+	"gochen-iam/repo/tenantscope"
+	"gochen/eventing"
+	"gochen/eventing/bus"
+	"gochen/messaging"
+)
+
+const (
+	// DefaultPermissionCacheTTL 权限缓存默认有效期
+	DefaultPermissionCacheTTL = time.Minute
+	// DefaultPermissionCacheMaxEntries 权限缓存默认最大条目数
+	DefaultPermissionCacheMaxEntries = 10000
+)
+
+// PermissionCache 用户有效角色/权限缓存（可插拔，如替换为 Redis 实现多实例共享）
+//
+// 缓存的是 UserService 计算出的有效角色与权限（含组织默认角色与父角色链路），按租户 + 用户 ID 区分
+// （同一用户在不同租户上下文中可见的角色不同）；角色分配、角色变更、组织成员与组织默认角色变更时由各服务主动失效。
+type PermissionCache interface {
+	// Get 返回用户在租户下缓存的角色与权限；未命中或已过期时 ok 为 false
+	Get(tenantID string, userID int64) (roles, permissions []string, ok bool)
+	// Set 写入用户在租户下的角色与权限
+	Set(tenantID string, userID int64, roles, permissions []string)
+	// Invalidate 失效单个用户在所有租户下的缓存
+	Invalidate(userID int64)
+	// InvalidateAll 失效全部缓存（角色定义变更可能影响任意用户）
+	InvalidateAll()
+}
+
+var defaultPermissionCache = struct {
+	mu    sync.RWMutex
+	cache PermissionCache
+}{}
+
+// SetDefaultPermissionCache 设置各服务共用的有效角色/权限缓存（nil 关闭缓存，默认关闭）。
+//
+// UserService 计算有效角色与权限时优先读取缓存；UserService/RoleService/GroupService 的相关变更统一失效同一实例。
+func SetDefaultPermissionCache(cache PermissionCache) {
+	defaultPermissionCache.mu.Lock()
+	defer defaultPermissionCache.mu.Unlock()
+	defaultPermissionCache.cache = cache
+}
+
+func currentPermissionCache() PermissionCache {
+	defaultPermissionCache.mu.RLock()
+	defer defaultPermissionCache.mu.RUnlock()
+	return defaultPermissionCache.cache
+}
+
+// GetCachedPermissions 读取用户在当前租户上下文下缓存的角色与权限（未开启缓存时 ok 为 false）
+func GetCachedPermissions(ctx context.Context, userID int64) (roles, permissions []string, ok bool) {
+	cache := currentPermissionCache()
+	if cache == nil {
+		return nil, nil, false
+	}
+	return cache.Get(tenantscope.TenantFromContext(ctx), userID)
+}
+
+// SetCachedPermissions 写入用户在当前租户上下文下的角色与权限（未开启缓存时忽略）
+func SetCachedPermissions(ctx context.Context, userID int64, roles, permissions []string) {
+	if cache := currentPermissionCache(); cache != nil {
+		cache.Set(tenantscope.TenantFromContext(ctx), userID, roles, permissions)
+	}
+}
+
+// InvalidateUserPermissionCache 失效单个用户的权限缓存（未开启缓存时忽略）
+func InvalidateUserPermissionCache(userID int64) {
+	if cache := currentPermissionCache(); cache != nil {
+		cache.Invalidate(userID)
+	}
+}
+
+// InvalidateAllPermissionCache 失效全部权限缓存（未开启缓存时忽略）
+func InvalidateAllPermissionCache() {
+	if cache := currentPermissionCache(); cache != nil {
+		cache.InvalidateAll()
+	}
+}
+
+// permissionCacheKey 缓存键（租户 + 用户 ID）
+type permissionCacheKey struct {
+	tenantID string
+	userID   int64
+}
+
+type permissionCacheEntry struct {
+	roles       []string
+	permissions []string
+	expiresAt   time.Time
+}
+
+// MemoryPermissionCache 进程内存权限缓存（带 TTL 与容量上限，单实例适用）
+type MemoryPermissionCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[permissionCacheKey]permissionCacheEntry
+	now        func() time.Time
+}
+
+// NewMemoryPermissionCache 创建进程内存权限缓存
+//
+// ttl <= 0 使用 DefaultPermissionCacheTTL，maxEntries <= 0 使用 DefaultPermissionCacheMaxEntries；
+// 达到容量上限时先清理已过期条目，仍不足则淘汰最早过期的条目。
+func NewMemoryPermissionCache(ttl time.Duration, maxEntries int) *MemoryPermissionCache {
+	if ttl <= 0 {
+		ttl = DefaultPermissionCacheTTL
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultPermissionCacheMaxEntries
+	}
+	return &MemoryPermissionCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[permissionCacheKey]permissionCacheEntry{},
+		now:        time.Now,
+	}
+}
+
+// Get 返回用户在租户下缓存的角色与权限（返回副本）
+func (c *MemoryPermissionCache) Get(tenantID string, userID int64) ([]string, []string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := permissionCacheKey{tenantID: tenantID, userID: userID}
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, nil, false
+	}
+	return append([]string(nil), entry.roles...), append([]string(nil), entry.permissions...), true
+}
+
+// Set 写入用户在租户下的角色与权限（保存副本）
+func (c *MemoryPermissionCache) Set(tenantID string, userID int64, roles, permissions []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	key := permissionCacheKey{tenantID: tenantID, userID: userID}
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.evictLocked(now)
+	}
+	c.entries[key] = permissionCacheEntry{
+		roles:       append([]string(nil), roles...),
+		permissions: append([]string(nil), permissions...),
+		expiresAt:   now.Add(c.ttl),
+	}
+}
+
+// evictLocked 清理已过期条目；仍达到上限时淘汰最早过期的条目
+func (c *MemoryPermissionCache) evictLocked(now time.Time) {
+	var oldestKey permissionCacheKey
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest.IsZero() || entry.expiresAt.Before(oldest) {
+			oldestKey, oldest = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= c.maxEntries {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// Invalidate 失效单个用户在所有租户下的缓存
+func (c *MemoryPermissionCache) Invalidate(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key.userID == userID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// InvalidateAll 失效全部缓存
+func (c *MemoryPermissionCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[permissionCacheKey]permissionCacheEntry{}
+}
+
+// SubscribePermissionCacheInvalidation 订阅 UserRoleAssigned/UserRoleRemoved 事件并失效对应用户的缓存
+//
+// 用于多实例部署：其他实例变更角色分配后，本实例通过事件总线收到通知再失效本地缓存。
+func SubscribePermissionCacheInvalidation(ctx context.Context, eventBus bus.IEventBus, cache PermissionCache) (messaging.UnsubscribeFunc, error) {
+	handler := bus.EventHandlerFunc(func(_ context.Context, evt eventing.IEvent) error {
+		switch payload := evt.GetPayload().(type) {
+		case *iamevent.UserRoleAssigned:
+			cache.Invalidate(payload.UserID)
+		case iamevent.UserRoleAssigned:
+			cache.Invalidate(payload.UserID)
+		case *iamevent.UserRoleRemoved:
+			cache.Invalidate(payload.UserID)
+		case iamevent.UserRoleRemoved:
+			cache.Invalidate(payload.UserID)
+		}
+		return nil
+	})
+
+	var unsubscribes []messaging.UnsubscribeFunc
+	for _, eventType := range []string{(iamevent.UserRoleAssigned{}).GetType(), (iamevent.UserRoleRemoved{}).GetType()} {
+		unsubscribe, err := eventBus.SubscribeEvent(ctx, eventType, handler)
+		if err != nil {
+			for _, u := range unsubscribes {
+				_ = u(ctx)
+			}
+			return nil, err
+		}
+		unsubscribes = append(unsubscribes, unsubscribe)
+	}
+	return func(ctx context.Context) error {
+		for _, u := range unsubscribes {
+			if err := u(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	iamevent "gochen-iam/event"
+	"gochen/eventing"
+	"gochen/eventing/bus"
+	"gochen/messaging"
+	"gochen/messaging/transport/direct"
+	"gochen/metadata"
+)
+
+func TestMemoryPermissionCache_HitAndTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cache := NewMemoryPermissionCache(time.Minute, 0)
+	cache.now = func() time.Time { return now }
+
+	if _, _, ok := cache.Get("", 1); ok {
+		t.Fatal("expected miss on empty cache")
+	}
+
+	roles, permissions := []string{"editor"}, []string{"doc:read"}
+	cache.Set("", 1, roles, permissions)
+	roles[0], permissions[0] = "mutated", "mutated"
+
+	gotRoles, gotPermissions, ok := cache.Get("", 1)
+	if !ok || len(gotRoles) != 1 || gotRoles[0] != "editor" || len(gotPermissions) != 1 || gotPermissions[0] != "doc:read" {
+		t.Fatalf("unexpected cache hit: %v %v %v", gotRoles, gotPermissions, ok)
+	}
+	gotRoles[0] = "mutated"
+	if again, _, _ := cache.Get("", 1); again[0] != "editor" {
+		t.Fatal("expected cached roles isolated from caller mutations")
+	}
+
+	// TTL 到期后未命中
+	now = now.Add(59 * time.Second)
+	if _, _, ok := cache.Get("", 1); !ok {
+		t.Fatal("expected hit before ttl")
+	}
+	now = now.Add(time.Second)
+	if _, _, ok := cache.Get("", 1); ok {
+		t.Fatal("expected miss after ttl")
+	}
+}
+
+func TestMemoryPermissionCache_SizeBoundAndInvalidate(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cache := NewMemoryPermissionCache(time.Minute, 2)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("", 1, []string{"a"}, nil)
+	now = now.Add(time.Second)
+	cache.Set("", 2, []string{"b"}, nil)
+	now = now.Add(time.Second)
+
+	// 覆盖已有条目不触发淘汰
+	cache.Set("", 2, []string{"b2"}, nil)
+	if _, _, ok := cache.Get("", 1); !ok {
+		t.Fatal("expected entry 1 kept when overwriting entry 2")
+	}
+
+	// 超出上限淘汰最早过期的条目
+	cache.Set("", 3, []string{"c"}, nil)
+	if _, _, ok := cache.Get("", 1); ok {
+		t.Fatal("expected oldest entry evicted")
+	}
+	for _, id := range []int64{2, 3} {
+		if _, _, ok := cache.Get("", id); !ok {
+			t.Fatalf("expected entry %d kept", id)
+		}
+	}
+
+	cache.Invalidate(2)
+	if _, _, ok := cache.Get("", 2); ok {
+		t.Fatal("expected entry 2 invalidated")
+	}
+	cache.InvalidateAll()
+	if _, _, ok := cache.Get("", 3); ok {
+		t.Fatal("expected all entries invalidated")
+	}
+}
+
+func TestMemoryPermissionCache_TenantKey(t *testing.T) {
+	cache := NewMemoryPermissionCache(time.Minute, 0)
+	cache.Set("tenant-a", 1, []string{"a"}, nil)
+	cache.Set("tenant-b", 1, []string{"b"}, nil)
+	cache.Set("tenant-a", 2, []string{"c"}, nil)
+
+	// 同一用户在不同租户下互不可见
+	if roles, _, ok := cache.Get("tenant-a", 1); !ok || roles[0] != "a" {
+		t.Fatalf("unexpected tenant-a entry: %v %v", roles, ok)
+	}
+	if roles, _, ok := cache.Get("tenant-b", 1); !ok || roles[0] != "b" {
+		t.Fatalf("unexpected tenant-b entry: %v %v", roles, ok)
+	}
+	if _, _, ok := cache.Get("", 1); ok {
+		t.Fatal("expected miss without tenant")
+	}
+
+	// 失效用户覆盖所有租户
+	cache.Invalidate(1)
+	for _, tenantID := range []string{"tenant-a", "tenant-b"} {
+		if _, _, ok := cache.Get(tenantID, 1); ok {
+			t.Fatalf("expected user 1 invalidated in %s", tenantID)
+		}
+	}
+	if _, _, ok := cache.Get("tenant-a", 2); !ok {
+		t.Fatal("expected other user kept")
+	}
+}
+
+func TestDefaultPermissionCache_UsesContextTenant(t *testing.T) {
+	ctx := context.Background()
+	if _, _, ok := GetCachedPermissions(ctx, 1); ok {
+		t.Fatal("expected miss when cache disabled")
+	}
+	SetCachedPermissions(ctx, 1, []string{"ignored"}, nil)
+
+	cache := NewMemoryPermissionCache(time.Minute, 0)
+	SetDefaultPermissionCache(cache)
+	defer SetDefaultPermissionCache(nil)
+
+	tenantCtx, err := metadata.WithTenantID(ctx, "tenant-a")
+	if err != nil {
+		t.Fatalf("WithTenantID failed: %v", err)
+	}
+	SetCachedPermissions(tenantCtx, 1, []string{"editor"}, []string{"doc:read"})
+	if _, _, ok := GetCachedPermissions(ctx, 1); ok {
+		t.Fatal("expected miss for request without tenant")
+	}
+	if roles, _, ok := GetCachedPermissions(tenantCtx, 1); !ok || roles[0] != "editor" {
+		t.Fatalf("expected hit for tenant request, got %v %v", roles, ok)
+	}
+	InvalidateUserPermissionCache(1)
+	if _, _, ok := cache.Get("tenant-a", 1); ok {
+		t.Fatal("expected user invalidated via default cache")
+	}
+}
+
+func TestSubscribePermissionCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	transport := direct.NewSyncTransport()
+	if err := transport.Start(ctx); err != nil {
+		t.Fatalf("start transport: %v", err)
+	}
+	eventBus := bus.NewEventBus(messaging.NewMessageBus(transport))
+
+	cache := NewMemoryPermissionCache(time.Minute, 0)
+	unsubscribe, err := SubscribePermissionCacheInvalidation(ctx, eventBus, cache)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	cache.Set("", 1, []string{"editor"}, nil)
+	cache.Set("", 2, []string{"editor"}, nil)
+	cache.Set("", 3, []string{"editor"}, nil)
+
+	publish := func(userID int64, payload interface{ GetType() string }) {
+		t.Helper()
+		if err := eventBus.PublishEvent(ctx, eventing.NewEvent(userID, "user", payload.GetType(), 1, payload)); err != nil {
+			t.Fatalf("publish %s: %v", payload.GetType(), err)
+		}
+	}
+	publish(1, &iamevent.UserRoleAssigned{UserID: 1, RoleID: 10})
+	publish(2, &iamevent.UserRoleRemoved{UserID: 2, RoleID: 10})
+
+	for id, want := range map[int64]bool{1: false, 2: false, 3: true} {
+		if _, _, ok := cache.Get("", id); ok != want {
+			t.Errorf("user %d: expected cached=%v, got %v", id, want, ok)
+		}
+	}
+
+	// 取消订阅后不再失效
+	if err := unsubscribe(ctx); err != nil {
+		t.Fatalf("unsubscribe: %v", err)
+	}
+	publish(3, &iamevent.UserRoleRemoved{UserID: 3, RoleID: 10})
+	if _, _, ok := cache.Get("", 3); !ok {
+		t.Fatal("expected no invalidation after unsubscribe")
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gochen/errorx"
+)
+
+// 用户资料字段长度上限
+const (
+	MaxDisplayNameLength = 100 // 最大显示名长度（字符）
+	MaxLocaleLength      = 35  // 最大语言区域标签长度（BCP 47 建议上限）
+)
+
+var (
+	// phonePattern E.164：+ 国家码（首位非 0）+ 号码，共 8~15 位数字
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	// localePattern BCP 47 近似：2~3 位字母语言码，后接若干 2~8 位字母数字子标签（如 zh-CN、zh-Hant-TW、en-US）
+	localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	// phoneSeparators 输入号码中允许的分隔符（落库前去除）
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+)
+
+// NormalizeEmail 返回邮箱的规范形式（去除首尾空白并转小写），注册与修改邮箱时按此落库
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeDisplayName 去除首尾空白并校验显示名：非空白、不超过 100 个字符且不含控制字符
+func NormalizeDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errorx.New(errorx.Validation, "显示名不能为空白")
+	}
+	if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+		return "", errorx.New(errorx.Validation, "显示名不能超过100个字符")
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", errorx.New(errorx.Validation, "显示名不能包含控制字符")
+	}
+	return name, nil
+}
+
+// NormalizePhone 校验并规范化手机号为 E.164 格式（如 +8613800138000）
+//
+// 输入中的空格、连字符与括号视为分隔符并去除；须以 + 和国家码开头。
+func NormalizePhone(phone string) (string, error) {
+	phone = phoneSeparators.Replace(strings.TrimSpace(phone))
+	if !phonePattern.MatchString(phone) {
+		return "", errorx.New(errorx.Validation, "手机号格式不正确，须为 + 国家码开头的 E.164 格式（如 +8613800138000）")
+	}
+	return phone, nil
+}
+
+// NormalizeLocale 校验语言区域标签（BCP 47 形式，如 zh-CN、en-US），去除首尾空白后原样返回
+func NormalizeLocale(locale string) (string, error) {
+	locale = strings.TrimSpace(locale)
+	if len(locale) > MaxLocaleLength {
+		return "", errorx.New(errorx.Validation, "语言区域不能超过35个字符")
+	}
+	if !localePattern.MatchString(locale) {
+		return "", errorx.New(errorx.Validation, "语言区域格式不正确，须为 BCP 47 形式（如 zh-CN、en-US）")
+	}
+	return locale, nil
+}
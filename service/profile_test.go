@@ -0,0 +1,53 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"gochen/errorx"
+)
+
+func TestNormalizeDisplayName(t *testing.T) {
+	if got, err := NormalizeDisplayName("  张三 Zhang  "); err != nil || got != "张三 Zhang" {
+		t.Fatalf("NormalizeDisplayName = %q, %v", got, err)
+	}
+	if _, err := NormalizeDisplayName(strings.Repeat("名", MaxDisplayNameLength)); err != nil {
+		t.Fatalf("expected %d characters allowed, got %v", MaxDisplayNameLength, err)
+	}
+	for _, name := range []string{"   ", strings.Repeat("a", MaxDisplayNameLength+1), "bad\x00name", "line\nbreak"} {
+		if _, err := NormalizeDisplayName(name); !errorx.Is(err, errorx.Validation) {
+			t.Errorf("NormalizeDisplayName(%q) = %v; want Validation error", name, err)
+		}
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	cases := map[string]string{
+		"+8613800138000":     "+8613800138000",
+		" +1 (415) 555-2671": "+14155552671",
+		"+44 20 7946 0958":   "+442079460958",
+	}
+	for in, want := range cases {
+		if got, err := NormalizePhone(in); err != nil || got != want {
+			t.Errorf("NormalizePhone(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, phone := range []string{"13800138000", "+0123456789", "+86 138", "+1234567890123456", "+86abc0138000", "++8613800138000"} {
+		if _, err := NormalizePhone(phone); !errorx.Is(err, errorx.Validation) {
+			t.Errorf("NormalizePhone(%q) = %v; want Validation error", phone, err)
+		}
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	for _, locale := range []string{"en", "zh-CN", "zh-Hant-TW", "es-419", " en-US "} {
+		if _, err := NormalizeLocale(locale); err != nil {
+			t.Errorf("NormalizeLocale(%q) = %v; want nil", locale, err)
+		}
+	}
+	for _, locale := range []string{"zh_CN", "e", "english-", "en--US", "en-US-" + strings.Repeat("x", 40), "12-CN"} {
+		if _, err := NormalizeLocale(locale); !errorx.Is(err, errorx.Validation) {
+			t.Errorf("NormalizeLocale(%q) = %v; want Validation error", locale, err)
+		}
+	}
+}
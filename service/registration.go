@@ -0,0 +1,63 @@
+package service
+
+import (
+	"os"
+	"strings"
+
+	"gochen/errorx"
+)
+
+const (
+	// envRegistrationDefaultStatus 注册用户默认状态配置（环境变量）。
+	envRegistrationDefaultStatus = "AUTH_REGISTRATION_DEFAULT_STATUS"
+	// envRequireEmailVerification 注册后是否需要邮箱验证（环境变量）。
+	envRequireEmailVerification = "AUTH_REQUIRE_EMAIL_VERIFICATION"
+	// envDefaultRole 注册用户默认角色名（环境变量）。
+	envDefaultRole = "AUTH_DEFAULT_ROLE"
+	// envDefaultRoleStrict 默认角色严格模式（环境变量）。
+	envDefaultRoleStrict = "AUTH_DEFAULT_ROLE_STRICT"
+)
+
+// RegistrationDefaultStatus 返回新注册用户的初始状态。
+//
+// 默认为 active；需人工审核的部署可通过 AUTH_REGISTRATION_DEFAULT_STATUS=pending 配置。
+// 仅允许 active/pending 作为初始状态，配置非法时返回错误（fail-close，避免误配置导致账号被直接激活）。
+func RegistrationDefaultStatus() (string, error) {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(envRegistrationDefaultStatus)))
+	switch v {
+	case "":
+		return UserStatusActive, nil
+	case UserStatusActive, UserStatusPending:
+		return v, nil
+	default:
+		return "", errorx.New(errorx.Internal, "注册默认状态配置无效: "+v)
+	}
+}
+
+// RequireEmailVerification 返回新注册用户是否需要完成邮箱验证后才能登录。
+//
+// 通过 AUTH_REQUIRE_EMAIL_VERIFICATION=true（或 1）开启；开启后注册用户以 pending 状态创建，
+// 优先于 AUTH_REGISTRATION_DEFAULT_STATUS，验证邮箱后转为 active。
+func RequireEmailVerification() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(envRequireEmailVerification)))
+	return v == "true" || v == "1"
+}
+
+// DefaultRoleName 返回新注册用户自动分配的角色名。
+//
+// 默认为 user（UserRoleName），可通过 AUTH_DEFAULT_ROLE 配置为其他已存在的角色。
+func DefaultRoleName() string {
+	if v := strings.TrimSpace(os.Getenv(envDefaultRole)); v != "" {
+		return v
+	}
+	return UserRoleName
+}
+
+// DefaultRoleStrict 返回默认角色是否为严格模式。
+//
+// 通过 AUTH_DEFAULT_ROLE_STRICT=true（或 1）开启：默认角色分配失败时注册失败（用户不会被创建），
+// 启动时默认角色不存在则拒绝启动；关闭时（默认）仅记录警告，注册照常完成。
+func DefaultRoleStrict() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv(envDefaultRoleStrict)))
+	return v == "true" || v == "1"
+}
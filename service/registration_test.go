@@ -0,0 +1,59 @@
+package service
+
+import "testing"
+
+func TestRegistrationDefaultStatus_Env(t *testing.T) {
+	cases := []struct {
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"", UserStatusActive, false},
+		{"active", UserStatusActive, false},
+		{" Pending ", UserStatusPending, false},
+		{"locked", "", true},
+		{"unknown", "", true},
+	}
+	for _, c := range cases {
+		t.Setenv(envRegistrationDefaultStatus, c.env)
+		got, err := RegistrationDefaultStatus()
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("RegistrationDefaultStatus() with %q: expected error", c.env)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("RegistrationDefaultStatus() with %q = %q, %v; want %q", c.env, got, err, c.want)
+		}
+	}
+}
+
+func TestRequireEmailVerification_Env(t *testing.T) {
+	cases := map[string]bool{"": false, "false": false, "0": false, "true": true, " TRUE ": true, "1": true}
+	for env, want := range cases {
+		t.Setenv(envRequireEmailVerification, env)
+		if got := RequireEmailVerification(); got != want {
+			t.Errorf("RequireEmailVerification() with %q = %v; want %v", env, got, want)
+		}
+	}
+}
+
+func TestDefaultRole_Env(t *testing.T) {
+	t.Setenv(envDefaultRole, "")
+	if got := DefaultRoleName(); got != UserRoleName {
+		t.Errorf("DefaultRoleName() = %q; want %q", got, UserRoleName)
+	}
+	t.Setenv(envDefaultRole, " member ")
+	if got := DefaultRoleName(); got != "member" {
+		t.Errorf("DefaultRoleName() = %q; want member", got)
+	}
+
+	cases := map[string]bool{"": false, "false": false, "true": true, " TRUE ": true, "1": true}
+	for env, want := range cases {
+		t.Setenv(envDefaultRoleStrict, env)
+		if got := DefaultRoleStrict(); got != want {
+			t.Errorf("DefaultRoleStrict() with %q = %v; want %v", env, got, want)
+		}
+	}
+}
@@ -2,11 +2,17 @@ package role
 
 import (
 	"context"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"gochen-iam/auth"
 	iamentity "gochen-iam/entity"
 	iamevent "gochen-iam/event"
 	iammw "gochen-iam/middleware"
+	"gochen-iam/repo/actor"
 	grouprepo "gochen-iam/repo/group"
 	rolerepo "gochen-iam/repo/role"
 	userrepo "gochen-iam/repo/user"
@@ -22,8 +28,18 @@ type RoleService struct {
 	roleRepo  *rolerepo.RoleRepo
 	userRepo  *userrepo.UserRepo
 	groupRepo *grouprepo.GroupRepo
+	validator *svc.BusinessValidator
 	eventBus  bus.IEventBus
 	logger    logging.ILogger
+
+	// revokeSessionsOnChange 角色停用/权限变更时是否吊销受影响用户的已签发 token（默认关闭）
+	revokeSessionsOnChange bool
+	// permissionDependencies 权限依赖关系（权限 -> 其依赖的权限列表）
+	permissionDependencies map[string][]string
+	// permissionDependencyMode 权限依赖校验模式（默认 warn）
+	permissionDependencyMode svc.PermissionDependencyMode
+	// nameCaseFold 角色名称是否统一转为小写（默认仅去除首尾空白）
+	nameCaseFold bool
 }
 
 // NewRoleService 创建角色服务实例
@@ -37,40 +53,123 @@ func NewRoleService(
 		roleRepo:  roleRepo,
 		userRepo:  userRepo,
 		groupRepo: groupRepo,
+		validator: svc.NewBusinessValidator(userRepo, groupRepo, roleRepo),
 		eventBus:  eventBus,
 		logger:    logging.ComponentLogger("iam.service.role"),
 	}
 }
 
+// SetRevokeSessionsOnChange 设置角色停用/更新时是否立即吊销受影响用户的已签发 token。
+//
+// 默认关闭：旧 token 在过期前仍携带旧的角色/权限声明。开启后受影响用户需重新登录或刷新 token。
+func (s *RoleService) SetRevokeSessionsOnChange(enabled bool) {
+	s.revokeSessionsOnChange = enabled
+}
+
+// SetNameCaseFold 设置角色名称是否忽略大小写（开启后名称统一转为小写再校验唯一性与落库）。
+//
+// 名称始终去除首尾空白；开启前已落库的名称不会被改写。
+func (s *RoleService) SetNameCaseFold(enabled bool) {
+	s.nameCaseFold = enabled
+	s.validator.SetNameCaseFold(enabled)
+}
+
+// SetPermissionDependencies 设置权限依赖关系（如 user:delete 依赖 user:read），nil 表示清空。
+func (s *RoleService) SetPermissionDependencies(deps map[string][]string) {
+	copied := make(map[string][]string, len(deps))
+	for permission, required := range deps {
+		copied[permission] = append([]string(nil), required...)
+	}
+	s.permissionDependencies = copied
+}
+
+// SetPermissionDependencyMode 设置权限依赖校验模式。
+//
+// warn（默认）：创建/更新角色时仅记录缺失的依赖；enforce：缺少依赖时返回 Validation。
+func (s *RoleService) SetPermissionDependencyMode(mode svc.PermissionDependencyMode) {
+	s.permissionDependencyMode = mode
+}
+
+// GetPermissionDependencyValidation 检查权限集合是否满足已配置的依赖关系
+func (s *RoleService) GetPermissionDependencyValidation(permissions []string) *svc.PermissionDependencyValidation {
+	granted := make(map[string]struct{}, len(permissions))
+	for _, p := range permissions {
+		granted[p] = struct{}{}
+	}
+
+	result := &svc.PermissionDependencyValidation{Valid: true}
+	for _, p := range permissions {
+		var missing []string
+		for _, required := range s.permissionDependencies[p] {
+			if _, ok := granted[required]; !ok {
+				missing = append(missing, required)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		sort.Strings(missing)
+		if result.Missing == nil {
+			result.Missing = map[string][]string{}
+		}
+		result.Missing[p] = missing
+		result.Valid = false
+	}
+	return result
+}
+
 // CreateRole 创建角色
 func (s *RoleService) CreateRole(ctx context.Context, req *svc.CreateRoleRequest) (*iamentity.Role, error) {
-	// 1. 验证请求数据
+	// 1. 规范化名称并验证请求数据
+	normalized := *req
+	normalized.Name = svc.NormalizeName(req.Name, s.nameCaseFold)
+	req = &normalized
 	if err := s.validateCreateRoleRequest(req); err != nil {
 		return nil, err
 	}
 
 	// 2. 检查角色名称是否已存在
-	existingRole, err := s.roleRepo.FindByName(ctx, req.Name)
+	existingRole, err := s.roleRepo.FindByNormalizedName(ctx, req.Name, s.nameCaseFold)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
 		return nil, errorx.Wrap(err, errorx.Database, "检查角色名称失败")
 	}
 	if existingRole != nil {
-		return nil, errorx.New(errorx.Validation, "角色名称已存在")
+		conflictErr := errorx.New(errorx.Validation, "角色名称已存在")
+		if req.SuggestNameOnConflict {
+			suggestion, err := s.suggestRoleName(ctx, req.Name)
+			if err != nil {
+				return nil, err
+			}
+			if suggestion != "" {
+				// 当前阶段 Code 默认与名称相同，建议值同时作为 code
+				conflictErr = conflictErr.
+					WithContext("suggested_name", suggestion).
+					WithContext("suggested_code", suggestion)
+			}
+		}
+		return nil, conflictErr
 	}
 
-	// 3. 验证权限
+	// 3. 验证权限与父角色
 	if err := s.validatePermissions(req.Permissions); err != nil {
 		return nil, err
 	}
+	if err := s.checkPermissionDependencies(ctx, req.Name, req.Permissions); err != nil {
+		return nil, err
+	}
+	if err := s.validateParentRoleNoCycle(ctx, 0, req.ParentRoleID); err != nil {
+		return nil, err
+	}
 
 	// 4. 创建角色实体
 	role := &iamentity.Role{
-		Code:        req.Name, // 当前阶段默认使用名称作为稳定编码
-		Name:        req.Name,
-		Description: req.Description,
-		Permissions: iamentity.PermissionArray(req.Permissions),
-		IsSystem:    false,
-		Status:      svc.RoleStatusActive,
+		Code:         req.Name, // 当前阶段默认使用名称作为稳定编码
+		Name:         req.Name,
+		Description:  req.Description,
+		Permissions:  iamentity.PermissionArray(req.Permissions),
+		IsSystem:     false,
+		Status:       svc.RoleStatusActive,
+		ParentRoleID: req.ParentRoleID,
 	}
 	role.SetUpdatedAt(time.Now())
 
@@ -95,17 +194,22 @@ func (s *RoleService) UpdateRole(ctx context.Context, roleID int64, req *svc.Upd
 		return nil, errorx.New(errorx.Validation, "系统角色不能被修改")
 	}
 
-	// 3. 更新字段
-	if req.Name != "" && req.Name != role.Name {
+	// 3. 更新字段（名称、权限与父角色会影响 token 声明中的角色与有效权限）
+	claimsChanged := false
+	permissionsEdited := false
+	var permissionsBefore []string
+	name := svc.NormalizeName(req.Name, s.nameCaseFold)
+	if name != "" && name != role.Name {
 		// 检查名称是否重复
-		existingRole, err := s.roleRepo.FindByName(ctx, req.Name)
+		existingRole, err := s.roleRepo.FindByNormalizedName(ctx, name, s.nameCaseFold)
 		if err != nil && !errorx.Is(err, errorx.NotFound) {
 			return nil, errorx.Wrap(err, errorx.Database, "检查角色名称失败")
 		}
 		if existingRole != nil && existingRole.GetID() != roleID {
 			return nil, errorx.New(errorx.Validation, "角色名称已存在")
 		}
-		role.Name = req.Name
+		role.Name = name
+		claimsChanged = true
 	}
 
 	if req.Description != "" {
@@ -116,7 +220,25 @@ func (s *RoleService) UpdateRole(ctx context.Context, roleID int64, req *svc.Upd
 		if err := s.validatePermissions(req.Permissions); err != nil {
 			return nil, err
 		}
+		if err := s.checkPermissionDependencies(ctx, role.Name, req.Permissions); err != nil {
+			return nil, err
+		}
+		permissionsBefore = append([]string(nil), role.Permissions...)
+		permissionsEdited = true
 		role.SetPermissions(req.Permissions)
+		claimsChanged = true
+	}
+
+	if req.ParentRoleID != nil {
+		// 提交前沿完整父链路检测环（基于最新持久化状态，覆盖多步更新形成的间接环）
+		if err := s.validateParentRoleNoCycle(ctx, roleID, req.ParentRoleID); err != nil {
+			return nil, err
+		}
+		// 父角色变化会改变继承的有效权限
+		if role.ParentRoleID == nil || *role.ParentRoleID != *req.ParentRoleID {
+			claimsChanged = true
+		}
+		role.ParentRoleID = req.ParentRoleID
 	}
 
 	role.SetUpdatedAt(time.Now())
@@ -125,10 +247,166 @@ func (s *RoleService) UpdateRole(ctx context.Context, roleID int64, req *svc.Upd
 	if err := s.roleRepo.Update(ctx, role); err != nil {
 		return nil, err
 	}
+	svc.InvalidateAllPermissionCache()
+
+	// 5. 记录权限变更历史
+	if permissionsEdited {
+		s.recordPermissionChange(ctx, role, permissionsBefore)
+	}
+
+	// 6. 按需吊销受影响用户的 token
+	if claimsChanged {
+		s.revokeRoleUserSessions(ctx, roleID)
+	}
+
+	return role, nil
+}
+
+// SetParentRole 设置角色的父角色（角色继承：子角色获得父链路上 active 角色的权限）
+//
+// 形成环（含指向自身）时返回 Validation；系统角色不能被修改。
+func (s *RoleService) SetParentRole(ctx context.Context, roleID, parentRoleID int64) (*iamentity.Role, error) {
+	return s.updateParentRole(ctx, roleID, &parentRoleID)
+}
+
+// ClearParentRole 清除角色的父角色
+func (s *RoleService) ClearParentRole(ctx context.Context, roleID int64) (*iamentity.Role, error) {
+	return s.updateParentRole(ctx, roleID, nil)
+}
+
+// updateParentRole 设置或清除父角色（parentRoleID 为 nil 表示清除）
+func (s *RoleService) updateParentRole(ctx context.Context, roleID int64, parentRoleID *int64) (*iamentity.Role, error) {
+	// 1. 获取角色
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 检查是否为系统角色
+	if role.IsSystem {
+		return nil, errorx.New(errorx.Validation, "系统角色不能被修改")
+	}
+
+	// 3. 检测继承环
+	if err := s.validateParentRoleNoCycle(ctx, roleID, parentRoleID); err != nil {
+		return nil, err
+	}
+
+	// 4. 保存
+	if err := s.roleRepo.SetParentRole(ctx, roleID, parentRoleID); err != nil {
+		return nil, err
+	}
+	role.ParentRoleID = parentRoleID
+
+	// 5. 继承的权限变化，按需吊销受影响用户的 token
+	svc.InvalidateAllPermissionCache()
+	s.revokeRoleUserSessions(ctx, roleID)
 
 	return role, nil
 }
 
+// AuditPermissions 交叉比对 required permissions registry、AllPermissions 与 active 角色实际授予的权限
+//
+// 返回无法授予的路由权限（unreachable）、无路由使用的角色权限（dangling）与未声明的权限（undeclared），
+// 用于 RBAC 治理排查。停用或已软删除的角色不计入授予。
+func (s *RoleService) AuditPermissions(ctx context.Context) (*svc.PermissionAudit, error) {
+	// 1. 汇总 active 角色授予的权限
+	roles, err := s.roleRepo.FindWithVisibility(ctx, false, false)
+	if err != nil {
+		return nil, err
+	}
+	grantedSet := make(map[string]struct{})
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if permission != "" {
+				grantedSet[permission] = struct{}{}
+			}
+		}
+	}
+	granted := make([]string, 0, len(grantedSet))
+	for permission := range grantedSet {
+		granted = append(granted, permission)
+	}
+	sort.Strings(granted)
+
+	required := iammw.RequiredPermissions()
+	catalog := make(map[string]struct{}, len(svc.AllPermissions))
+	for _, permission := range svc.AllPermissions {
+		catalog[permission] = struct{}{}
+	}
+
+	audit := &svc.PermissionAudit{
+		Unreachable: []string{},
+		Dangling:    []string{},
+		Undeclared:  []string{},
+	}
+	undeclared := make(map[string]struct{})
+
+	// 2. 路由权限：无角色覆盖即 unreachable
+	for _, permission := range required {
+		if !auth.HasPermission(granted, permission) {
+			audit.Unreachable = append(audit.Unreachable, permission)
+		}
+		if _, ok := catalog[permission]; !ok {
+			undeclared[permission] = struct{}{}
+		}
+	}
+
+	// 3. 角色权限：不覆盖任何路由权限即 dangling
+	for _, permission := range granted {
+		covers := false
+		for _, r := range required {
+			if auth.PermissionCovers(permission, r) {
+				covers = true
+				break
+			}
+		}
+		if !covers {
+			audit.Dangling = append(audit.Dangling, permission)
+		}
+		if _, ok := catalog[permission]; !ok && !strings.Contains(permission, auth.PermissionWildcard) {
+			undeclared[permission] = struct{}{}
+		}
+	}
+
+	for permission := range undeclared {
+		audit.Undeclared = append(audit.Undeclared, permission)
+	}
+	sort.Strings(audit.Undeclared)
+	return audit, nil
+}
+
+// GetEffectivePermissions 获取角色的有效权限（自身权限 + 父链路上 active 角色的权限，去重排序）
+func (s *RoleService) GetEffectivePermissions(ctx context.Context, roleID int64) ([]string, error) {
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := s.roleRepo.FindParentChain(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+
+	permissionSet := make(map[string]struct{})
+	for _, source := range append([]*iamentity.Role{role}, chain...) {
+		if source != role && !source.IsActive() {
+			continue
+		}
+		for _, permission := range source.Permissions {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				permissionSet[permission] = struct{}{}
+			}
+		}
+	}
+
+	permissions := make([]string, 0, len(permissionSet))
+	for permission := range permissionSet {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
+
 // DeleteRole 删除角色
 func (s *RoleService) DeleteRole(ctx context.Context, roleID int64) error {
 	// 1. 获取角色
@@ -148,11 +426,15 @@ func (s *RoleService) DeleteRole(ctx context.Context, roleID int64) error {
 	}
 
 	// 4. 删除角色
-	return s.roleRepo.Delete(ctx, roleID)
+	if err := s.roleRepo.Delete(ctx, roleID); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+	return nil
 }
 
-// AssignRoleToUser 将角色分配给用户
-func (s *RoleService) AssignRoleToUser(ctx context.Context, roleID, userID int64) error {
+// AssignRoleToUser 将角色分配给用户（永久分配；对已持有的限时角色调用会清除其过期时间）
+func (s *RoleService) AssignRoleToUser(ctx context.Context, roleID, userID int64) (err error) {
 	// 1. 检查角色是否存在
 	role, err := s.roleRepo.GetByID(ctx, roleID)
 	if err != nil {
@@ -170,23 +452,57 @@ func (s *RoleService) AssignRoleToUser(ctx context.Context, roleID, userID int64
 		return err
 	}
 
-	// 4. 分配角色
-	if err := s.roleRepo.AssignToUser(ctx, roleID, userID); err != nil {
+	// 4. 在事务内分配角色（永久分配：清除已有的过期时间；显式分配视为直接分配，离开组织时不再回收）
+	txCtx, err := s.roleRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.roleRepo.Rollback(txCtx)
+		}
+	}()
+
+	if err = s.roleRepo.AssignToUser(txCtx, roleID, userID); err != nil {
 		return err
 	}
+	if err = s.userRepo.SetRoleExpiry(txCtx, userID, roleID, nil); err != nil {
+		return err
+	}
+	if err = s.userRepo.SetRoleSourceGroup(txCtx, userID, roleID, nil); err != nil {
+		return err
+	}
+	if err = s.roleRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	svc.InvalidateUserPermissionCache(userID)
 
-	// 5. 发布用户角色分配事件（最佳努力，不影响主流程）
+	// 5. 记录角色变更并发布用户角色分配事件（最佳努力，不影响主流程）
+	svc.RecordRoleChange(ctx, s.userRepo, s.logger, userID, roleID, role.Name, iamentity.RoleChangeGranted)
 	s.publishUserRoleAssignedEvent(ctx, userID, role)
 	return nil
 }
 
 // RemoveRoleFromUser 从用户移除角色
+//
+// 不允许移除最后一个可用系统管理员的 system_admin 角色（Validation）。
 func (s *RoleService) RemoveRoleFromUser(ctx context.Context, roleID, userID int64) error {
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	if role.Name == svc.SystemAdminRoleName {
+		if err := s.validator.EnsureNotLastSystemAdmin(ctx, userID, "不能移除最后一个系统管理员的管理员角色"); err != nil {
+			return err
+		}
+	}
 	if err := s.roleRepo.RemoveFromUser(ctx, roleID, userID); err != nil {
 		return err
 	}
+	svc.InvalidateUserPermissionCache(userID)
 
-	// 发布用户角色移除事件（最佳努力）
+	// 记录角色变更并发布用户角色移除事件（最佳努力）
+	svc.RecordRoleChange(ctx, s.userRepo, s.logger, userID, roleID, role.Name, iamentity.RoleChangeRevoked)
 	s.publishUserRoleRemovedEvent(ctx, userID, roleID)
 	return nil
 }
@@ -211,53 +527,133 @@ func (s *RoleService) AssignRoleToGroup(ctx context.Context, roleID, groupID int
 	}
 
 	// 4. 分配角色给组织
-	return s.roleRepo.AssignToGroup(ctx, roleID, groupID)
+	if err := s.roleRepo.AssignToGroup(ctx, roleID, groupID); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+	return nil
 }
 
 // RemoveRoleFromGroup 从组织移除默认角色
 func (s *RoleService) RemoveRoleFromGroup(ctx context.Context, roleID, groupID int64) error {
-	return s.roleRepo.RemoveFromGroup(ctx, roleID, groupID)
+	if err := s.roleRepo.RemoveFromGroup(ctx, roleID, groupID); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+	return nil
 }
 
 // AddPermission 为角色添加权限
+//
+// 与批量编辑共用校验流程：校验权限码并按依赖规则校验添加后的集合，记录权限变更历史并按需吊销 token。
 func (s *RoleService) AddPermission(ctx context.Context, roleID int64, permission string) error {
-	// 1. 获取角色
-	role, err := s.roleRepo.GetByID(ctx, roleID)
-	if err != nil {
-		return err
-	}
+	_, err := s.editPermissions(ctx, roleID, []string{permission}, func(role *iamentity.Role) {
+		role.AddPermission(permission)
+	})
+	return err
+}
 
-	// 2. 检查是否为系统角色
-	if role.IsSystem {
-		return errorx.New(errorx.Validation, "系统角色权限不能被修改")
+// RemovePermission 从角色移除权限（按依赖规则校验移除后的集合，其余同 AddPermission）
+func (s *RoleService) RemovePermission(ctx context.Context, roleID int64, permission string) error {
+	_, err := s.editPermissions(ctx, roleID, nil, func(role *iamentity.Role) {
+		role.RemovePermission(permission)
+	})
+	return err
+}
+
+// ReplacePermissions 以给定集合整体替换角色权限
+//
+// 整个集合先按权限码格式、严格权限字典与依赖规则校验，任一权限不合法则不做任何修改；
+// 校验通过后一次写入（重复项去重），记录权限变更历史，并按需吊销受影响用户的 token。
+func (s *RoleService) ReplacePermissions(ctx context.Context, roleID int64, permissions []string) (*iamentity.Role, error) {
+	if len(permissions) == 0 {
+		return nil, errorx.New(errorx.Validation, "角色必须至少拥有一个权限")
 	}
+	return s.editPermissions(ctx, roleID, permissions, func(role *iamentity.Role) {
+		role.SetPermissions(uniquePermissions(permissions))
+	})
+}
 
-	// 3. 验证权限
-	if err := s.validatePermissions([]string{permission}); err != nil {
-		return err
+// AddPermissions 为角色批量添加权限（全部校验通过后一次写入，已拥有的权限忽略）
+func (s *RoleService) AddPermissions(ctx context.Context, roleID int64, permissions []string) (*iamentity.Role, error) {
+	if len(permissions) == 0 {
+		return nil, errorx.New(errorx.Validation, "权限列表不能为空")
 	}
+	return s.editPermissions(ctx, roleID, permissions, func(role *iamentity.Role) {
+		for _, p := range permissions {
+			role.AddPermission(p)
+		}
+	})
+}
 
-	// 4. 添加权限
-	role.AddPermission(permission)
-	return s.roleRepo.Update(ctx, role)
+// RemovePermissions 从角色批量移除权限（一次写入，角色未拥有的权限忽略）
+func (s *RoleService) RemovePermissions(ctx context.Context, roleID int64, permissions []string) (*iamentity.Role, error) {
+	if len(permissions) == 0 {
+		return nil, errorx.New(errorx.Validation, "权限列表不能为空")
+	}
+	return s.editPermissions(ctx, roleID, nil, func(role *iamentity.Role) {
+		for _, p := range permissions {
+			role.RemovePermission(p)
+		}
+	})
 }
 
-// RemovePermission 从角色移除权限
-func (s *RoleService) RemovePermission(ctx context.Context, roleID int64, permission string) error {
+// editPermissions 批量编辑角色权限的公共流程：validate 非空时校验这些权限，并始终校验编辑后集合的依赖
+// （移除被依赖的权限同样受依赖规则约束），全部通过后一次保存
+func (s *RoleService) editPermissions(ctx context.Context, roleID int64, validate []string, edit func(role *iamentity.Role)) (*iamentity.Role, error) {
 	// 1. 获取角色
 	role, err := s.roleRepo.GetByID(ctx, roleID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 2. 检查是否为系统角色
 	if role.IsSystem {
-		return errorx.New(errorx.Validation, "系统角色权限不能被修改")
+		return nil, errorx.New(errorx.Validation, "系统角色权限不能被修改")
+	}
+
+	// 3. 验证权限（任一无效则整体拒绝）
+	if len(validate) > 0 {
+		if err := s.validatePermissions(validate); err != nil {
+			return nil, err
+		}
+	}
+
+	// 4. 应用编辑并校验结果集合的依赖
+	before := append([]string(nil), role.Permissions...)
+	edit(role)
+	added, removed := diffPermissions(before, role.Permissions)
+	if len(added) == 0 && len(removed) == 0 {
+		return role, nil
+	}
+	if err := s.checkPermissionDependencies(ctx, role.Name, role.Permissions); err != nil {
+		return nil, err
 	}
 
-	// 3. 移除权限
-	role.RemovePermission(permission)
-	return s.roleRepo.Update(ctx, role)
+	// 5. 保存
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return nil, err
+	}
+	svc.InvalidateAllPermissionCache()
+
+	// 6. 记录权限变更历史并吊销受影响用户的 token
+	s.recordPermissionChange(ctx, role, before)
+	s.revokeRoleUserSessions(ctx, roleID)
+	return role, nil
+}
+
+// uniquePermissions 按首次出现顺序去重
+func uniquePermissions(permissions []string) []string {
+	seen := make(map[string]struct{}, len(permissions))
+	result := make([]string, 0, len(permissions))
+	for _, p := range permissions {
+		if _, ok := seen[p]; ok {
+			continue
+		}
+		seen[p] = struct{}{}
+		result = append(result, p)
+	}
+	return result
 }
 
 // ActivateRole 激活角色
@@ -268,7 +664,11 @@ func (s *RoleService) ActivateRole(ctx context.Context, roleID int64) error {
 	}
 
 	role.Activate()
-	return s.roleRepo.Update(ctx, role)
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+	return nil
 }
 
 // DeactivateRole 停用角色
@@ -283,11 +683,30 @@ func (s *RoleService) DeactivateRole(ctx context.Context, roleID int64) error {
 	}
 
 	role.Deactivate()
-	return s.roleRepo.Update(ctx, role)
+	if err := s.roleRepo.Update(ctx, role); err != nil {
+		return err
+	}
+	svc.InvalidateAllPermissionCache()
+
+	s.revokeRoleUserSessions(ctx, roleID)
+	return nil
 }
 
-// CloneRole 克隆角色
+// CloneRole 克隆角色（仅复制权限）
 func (s *RoleService) CloneRole(ctx context.Context, roleID int64, newName string) (*iamentity.Role, error) {
+	return s.CloneRoleWithOptions(ctx, roleID, newName, svc.CloneRoleOptions{})
+}
+
+// CloneRoleWithOptions 按选项克隆角色
+//
+// 开启 CopyGroupAssignments 时，克隆角色与源角色的组织默认角色关联在同一事务内写入，
+// 任一步失败整体回滚；用户分配始终不复制。
+func (s *RoleService) CloneRoleWithOptions(ctx context.Context, roleID int64, newName string, opts svc.CloneRoleOptions) (clonedRole *iamentity.Role, err error) {
+	newName = svc.NormalizeName(newName, s.nameCaseFold)
+	if newName == "" {
+		return nil, errorx.New(errorx.Validation, "角色名称不能为空")
+	}
+
 	// 1. 获取原角色
 	originalRole, err := s.roleRepo.GetByID(ctx, roleID)
 	if err != nil {
@@ -295,7 +714,7 @@ func (s *RoleService) CloneRole(ctx context.Context, roleID int64, newName strin
 	}
 
 	// 2. 检查新名称是否重复
-	existingRole, err := s.roleRepo.FindByName(ctx, newName)
+	existingRole, err := s.roleRepo.FindByNormalizedName(ctx, newName, s.nameCaseFold)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
 		return nil, errorx.Wrap(err, errorx.Database, "检查角色名称失败")
 	}
@@ -304,22 +723,80 @@ func (s *RoleService) CloneRole(ctx context.Context, roleID int64, newName strin
 	}
 
 	// 3. 克隆角色
-	clonedRole := originalRole.Clone(newName)
+	clonedRole = originalRole.Clone(newName)
 	if clonedRole.Code == "" {
 		clonedRole.Code = newName
 	}
 
-	// 4. 保存克隆的角色
-	if err := s.roleRepo.Create(ctx, clonedRole); err != nil {
+	// 4. 开启事务
+	txCtx, err := s.roleRepo.BeginTx(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.roleRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 5. 保存克隆的角色
+	if err = s.roleRepo.Create(txCtx, clonedRole); err != nil {
 		return nil, errorx.Wrap(err, errorx.Database, "保存克隆角色失败")
 	}
 
+	// 6. 复制组织默认角色关联
+	if opts.CopyGroupAssignments {
+		groups, err := s.groupRepo.FindByDefaultRoleID(txCtx, roleID)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if err := s.roleRepo.AssignToGroup(txCtx, clonedRole.ID, group.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 7. 提交事务
+	if err = s.roleRepo.Commit(txCtx); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+
+	// 8. 组织成员经默认角色获得了克隆角色的权限，与其他组织默认角色变更一致失效缓存
+	if opts.CopyGroupAssignments {
+		svc.InvalidateAllPermissionCache()
+		s.revokeRoleUserSessions(ctx, clonedRole.ID)
+	}
+
 	return clonedRole, nil
 }
 
-// GetRoleUsers 获取拥有指定角色的用户
+// GetRoleUsers 获取拥有指定角色的用户（已清除敏感字段）
 func (s *RoleService) GetRoleUsers(ctx context.Context, roleID int64) ([]*iamentity.User, error) {
-	return s.userRepo.FindByRoleID(ctx, roleID)
+	users, err := s.userRepo.FindByRoleID(ctx, roleID)
+	if err != nil {
+		return nil, err
+	}
+	svc.StripUserSecrets(users...)
+	return users, nil
+}
+
+// GetRoleUsersPaged 分页获取直接分配了指定角色的用户（已清除敏感字段），并返回总数
+func (s *RoleService) GetRoleUsersPaged(ctx context.Context, roleID int64, offset, limit int) ([]*iamentity.User, int64, error) {
+	// 1. 校验参数
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+
+	// 2. 查询
+	users, total, err := s.userRepo.FindByRoleIDPaged(ctx, roleID, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 3. 清除敏感字段
+	svc.StripUserSecrets(users...)
+	return users, total, nil
 }
 
 // GetRoleGroups 获取使用指定角色作为默认角色的组织
@@ -327,28 +804,166 @@ func (s *RoleService) GetRoleGroups(ctx context.Context, roleID int64) ([]*iamen
 	return s.groupRepo.FindByDefaultRoleID(ctx, roleID)
 }
 
-// CheckPermission 检查权限
+// CheckPermission 检查权限并返回其来源
+//
+// 与登录/鉴权快照一致：计入未过期的直接分配角色、所属组织的默认角色（开启 svc.SetInheritAncestorGroupRoles
+// 时含祖先组织的默认角色），以及二者父链路上的祖先角色，仅 active 且未软删的角色贡献权限
+// （停用的父角色不贡献但不截断链路），通配符按 auth.PermissionCovers 匹配。
+// 返回全部授予路径，便于排查“用户为何拥有该权限”；用户非 active 时返回 Forbidden（与鉴权一致）。
 func (s *RoleService) CheckPermission(ctx context.Context, req *svc.PermissionCheckRequest) (*svc.PermissionCheckResponse, error) {
-	// 1. 获取用户
+	permission := strings.TrimSpace(req.Permission)
+	if permission == "" {
+		return nil, errorx.New(errorx.Validation, "权限不能为空")
+	}
+
+	// 1. 获取用户并检查状态
 	user, err := s.userRepo.GetByID(ctx, req.UserID)
 	if err != nil {
 		return nil, err
 	}
+	if !user.IsActive() {
+		return nil, svc.InactiveUserError(user)
+	}
 
-	// 2. 检查权限
-	hasPermission := user.HasPermission(req.Permission)
+	// 2. 直接分配的角色
+	var sources []*svc.PermissionSource
+	directRoles, err := s.roleRepo.FindByUserID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(directRoles, func(i, j int) bool { return directRoles[i].GetID() < directRoles[j].GetID() })
+	for _, role := range directRoles {
+		found, err := s.permissionSources(ctx, role, permission, svc.PermissionSourceDirect, nil)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, found...)
+	}
+
+	// 3. 所属组织（开启继承时含祖先组织）的默认角色
+	groups, err := s.groupRepo.FindByUserID(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err = s.withAncestorGroups(ctx, groups)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GetID() < groups[j].GetID() })
+	for _, group := range groups {
+		for _, role := range group.DefaultRoles {
+			if role == nil || role.DeletedAt != nil {
+				continue
+			}
+			found, err := s.permissionSources(ctx, role, permission, svc.PermissionSourceGroup, group)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, found...)
+		}
+	}
 
-	// 3. 获取用户角色
-	var roles []string
-	for _, role := range user.Roles {
-		roles = append(roles, role.Name)
+	// 4. 汇总授予角色与首要来源
+	response := &svc.PermissionCheckResponse{
+		HasPermission: len(sources) > 0,
+		Roles:         []string{},
+		Sources:       sources,
+	}
+	if response.Sources == nil {
+		response.Sources = []*svc.PermissionSource{}
+	}
+	roleSet := make(map[string]struct{}, len(sources))
+	for _, source := range sources {
+		if _, ok := roleSet[source.Role]; !ok {
+			roleSet[source.Role] = struct{}{}
+			response.Roles = append(response.Roles, source.Role)
+		}
 	}
+	sort.Strings(response.Roles)
+	for _, sourceType := range []string{svc.PermissionSourceDirect, svc.PermissionSourceGroup, svc.PermissionSourceInherited} {
+		if hasSourceType(sources, sourceType) {
+			response.Source = sourceType
+			break
+		}
+	}
+	return response, nil
+}
 
-	return &svc.PermissionCheckResponse{
-		HasPermission: hasPermission,
-		Roles:         roles,
-		Source:        "direct", // 简化实现，实际可以区分直接权限和继承权限
-	}, nil
+// withAncestorGroups 开启祖先组织默认角色继承时，追加所属组织的祖先组织（已去重，并加载其默认角色）
+func (s *RoleService) withAncestorGroups(ctx context.Context, groups []*iamentity.Group) ([]*iamentity.Group, error) {
+	if !svc.InheritAncestorGroupRoles() {
+		return groups, nil
+	}
+
+	seen := make(map[int64]struct{}, len(groups))
+	for _, group := range groups {
+		seen[group.GetID()] = struct{}{}
+	}
+	result := append([]*iamentity.Group(nil), groups...)
+	for _, group := range groups {
+		if group.ParentID == nil {
+			continue
+		}
+		ancestors, err := s.groupRepo.FindAncestors(ctx, group.GetID())
+		if err != nil {
+			return nil, err
+		}
+		for _, ancestor := range ancestors {
+			if _, ok := seen[ancestor.GetID()]; ok {
+				continue
+			}
+			seen[ancestor.GetID()] = struct{}{}
+			roles, err := s.roleRepo.FindByGroupID(ctx, ancestor.GetID(), false, false)
+			if err != nil {
+				return nil, err
+			}
+			ancestor.DefaultRoles = roles
+			result = append(result, ancestor)
+		}
+	}
+	return result, nil
+}
+
+// permissionSources 返回角色及其父链路授予 permission 的路径（停用角色本身不计入）
+func (s *RoleService) permissionSources(ctx context.Context, role *iamentity.Role, permission, sourceType string, group *iamentity.Group) ([]*svc.PermissionSource, error) {
+	if role == nil || role.Status != svc.RoleStatusActive {
+		return nil, nil
+	}
+
+	newSource := func(typ, roleName, viaRole string) *svc.PermissionSource {
+		source := &svc.PermissionSource{Type: typ, Role: roleName, ViaRole: viaRole}
+		if group != nil {
+			source.GroupID = group.GetID()
+			source.GroupName = group.Name
+		}
+		return source
+	}
+
+	var sources []*svc.PermissionSource
+	if role.HasPermission(permission) {
+		sources = append(sources, newSource(sourceType, role.Name, ""))
+	}
+
+	chain, err := s.roleRepo.FindParentChain(ctx, role)
+	if err != nil {
+		return nil, err
+	}
+	for _, parent := range chain {
+		if parent.Status == svc.RoleStatusActive && parent.HasPermission(permission) {
+			sources = append(sources, newSource(svc.PermissionSourceInherited, parent.Name, role.Name))
+		}
+	}
+	return sources, nil
+}
+
+// hasSourceType 判断来源列表中是否包含指定类型
+func hasSourceType(sources []*svc.PermissionSource, sourceType string) bool {
+	for _, source := range sources {
+		if source.Type == sourceType {
+			return true
+		}
+	}
+	return false
 }
 
 // SearchRoles 搜索角色
@@ -356,11 +971,37 @@ func (s *RoleService) SearchRoles(ctx context.Context, keyword string, limit int
 	return s.roleRepo.SearchRoles(ctx, keyword, limit)
 }
 
+// SearchRolesPaged 分页搜索角色（用于管理端列表）
+//
+// 不含软删除的角色，结果按 ID 升序；total 为满足关键字条件的总数。
+func (s *RoleService) SearchRolesPaged(ctx context.Context, keyword string, offset, limit int) ([]*iamentity.Role, int64, error) {
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+	return s.roleRepo.SearchRolesPaged(ctx, strings.TrimSpace(keyword), offset, limit)
+}
+
 // GetActiveRoles 获取激活状态的角色
 func (s *RoleService) GetActiveRoles(ctx context.Context) ([]*iamentity.Role, error) {
 	return s.roleRepo.FindByStatus(ctx, svc.RoleStatusActive)
 }
 
+// GetRolesByStatusPaged 分页获取指定状态的角色（用于管理端列表；不预加载关联，按 ID 升序）
+func (s *RoleService) GetRolesByStatusPaged(ctx context.Context, status string, offset, limit int) ([]*iamentity.Role, int64, error) {
+	if status != svc.RoleStatusActive && status != svc.RoleStatusInactive {
+		return nil, 0, errorx.New(errorx.Validation, "无效的角色状态")
+	}
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+	return s.roleRepo.FindByStatusPaged(ctx, status, offset, limit)
+}
+
+// ListRoles 获取角色列表（默认仅 active 且未软删除，见 svc.ListOptions；不预加载关联，按 ID 升序）
+func (s *RoleService) ListRoles(ctx context.Context, opts svc.ListOptions) ([]*iamentity.Role, error) {
+	return s.roleRepo.FindWithVisibility(ctx, opts.IncludeInactive, opts.IncludeDeleted)
+}
+
 // GetSystemRoles 获取系统角色
 func (s *RoleService) GetSystemRoles(ctx context.Context) ([]*iamentity.Role, error) {
 	return s.roleRepo.FindSystemRoles(ctx)
@@ -405,6 +1046,11 @@ func (s *RoleService) GetRoleStatistics(ctx context.Context) (map[string]interfa
 	}, nil
 }
 
+// GetRoleUsageStats 获取各角色的使用统计（直接分配的用户数、以其为默认角色的组织数）
+func (s *RoleService) GetRoleUsageStats(ctx context.Context) ([]rolerepo.RoleUsageStat, error) {
+	return s.roleRepo.GetRoleUsageStats(ctx)
+}
+
 // BatchAssignRole 批量分配角色
 func (s *RoleService) BatchAssignRole(ctx context.Context, req *svc.RoleAssignRequest) (*svc.BatchOperationResponse, error) {
 	response := &svc.BatchOperationResponse{}
@@ -460,6 +1106,266 @@ func (s *RoleService) validatePermissions(permissions []string) error {
 	return nil
 }
 
+// checkPermissionDependencies 按模式处理缺失的权限依赖：enforce 返回 Validation，warn 记录日志
+func (s *RoleService) checkPermissionDependencies(ctx context.Context, roleName string, permissions []string) error {
+	result := s.GetPermissionDependencyValidation(permissions)
+	if result.Valid {
+		return nil
+	}
+
+	permissionsWithMissing := make([]string, 0, len(result.Missing))
+	for p := range result.Missing {
+		permissionsWithMissing = append(permissionsWithMissing, p)
+	}
+	sort.Strings(permissionsWithMissing)
+	details := make([]string, 0, len(permissionsWithMissing))
+	for _, p := range permissionsWithMissing {
+		details = append(details, p+" 需要 "+strings.Join(result.Missing[p], ","))
+	}
+
+	if s.permissionDependencyMode == svc.PermissionDependencyModeEnforce {
+		return errorx.New(errorx.Validation, "权限缺少依赖: "+strings.Join(details, "; ")).
+			WithContext("missing_dependencies", result.Missing)
+	}
+	s.logger.Warn(ctx, "[RoleService] 角色权限缺少依赖",
+		logging.String("role", roleName),
+		logging.String("missing", strings.Join(details, "; ")),
+	)
+	return nil
+}
+
+const (
+	maxRoleNameLength      = 50  // 与 Role.Name 字段长度一致（字节）
+	maxRoleNameSuggestions = 100 // 名称冲突时尝试的最大后缀序号
+)
+
+// suggestRoleName 为冲突的角色名称生成可用的替代名称（如 manager -> manager-2），
+// 超出名称长度限制时截断前缀；找不到可用名称时返回空字符串。
+func (s *RoleService) suggestRoleName(ctx context.Context, name string) (string, error) {
+	base := strings.TrimSpace(name)
+	for i := 2; i <= maxRoleNameSuggestions; i++ {
+		suffix := "-" + strconv.Itoa(i)
+		prefix := base
+		for len(prefix)+len(suffix) > maxRoleNameLength {
+			// 按字符截断，避免切断多字节字符
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+		candidate := prefix + suffix
+
+		existing, err := s.roleRepo.FindByNormalizedName(ctx, candidate, s.nameCaseFold)
+		if err != nil && !errorx.Is(err, errorx.NotFound) {
+			return "", errorx.Wrap(err, errorx.Database, "检查角色名称失败")
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// revokeRoleUserSessions 吊销受指定角色变更影响的用户的已签发 token（需通过 SetRevokeSessionsOnChange 开启）
+//
+// 影响范围为该角色及其全部后代角色（子角色继承父链路权限）的直接持有者，
+// 以及将这些角色设为默认角色的组织（含后代组织，继承祖先组织默认角色时同样受影响）的成员。
+// 角色变更已落库，吊销失败仅记录日志，不回滚变更。
+func (s *RoleService) revokeRoleUserSessions(ctx context.Context, roleID int64) {
+	if !s.revokeSessionsOnChange {
+		return
+	}
+
+	userIDs, err := s.collectAffectedUserIDs(ctx, roleID)
+	if err != nil {
+		s.logger.Warn(ctx, "[RoleService] 查询角色用户失败，未吊销 token",
+			logging.Error(err),
+			logging.Int64("role_id", roleID),
+		)
+		return
+	}
+	for userID := range userIDs {
+		iammw.RevokeUserTokens(userID)
+	}
+}
+
+// collectAffectedUserIDs 收集角色（含后代角色）的直接持有者与组织默认角色持有者
+func (s *RoleService) collectAffectedUserIDs(ctx context.Context, roleID int64) (map[int64]struct{}, error) {
+	// 1. 沿 parent_role_id 向下展开后代角色（visited 防止历史数据中的环导致死循环）
+	roleIDs := []int64{roleID}
+	visited := map[int64]struct{}{roleID: {}}
+	for i := 0; i < len(roleIDs); i++ {
+		children, err := s.roleRepo.FindChildren(ctx, roleIDs[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if _, ok := visited[child.GetID()]; ok {
+				continue
+			}
+			visited[child.GetID()] = struct{}{}
+			roleIDs = append(roleIDs, child.GetID())
+		}
+	}
+
+	userIDs := make(map[int64]struct{})
+	groupIDs := make(map[int64]struct{})
+	for _, id := range roleIDs {
+		// 2. 直接持有者
+		users, err := s.userRepo.FindByRoleID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			userIDs[user.GetID()] = struct{}{}
+		}
+
+		// 3. 使用该角色作为默认角色的组织及其后代组织
+		groups, err := s.groupRepo.FindByDefaultRoleID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			groupIDs[group.GetID()] = struct{}{}
+			descendants, err := s.groupRepo.FindDescendants(ctx, group.GetID())
+			if err != nil {
+				return nil, err
+			}
+			for _, descendant := range descendants {
+				groupIDs[descendant.GetID()] = struct{}{}
+			}
+		}
+	}
+
+	// 4. 组织成员
+	for groupID := range groupIDs {
+		members, err := s.userRepo.FindByGroupID(ctx, groupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			userIDs[member.GetID()] = struct{}{}
+		}
+	}
+	return userIDs, nil
+}
+
+// validateParentRoleNoCycle 校验父角色存在且父链路不形成环
+//
+// 从 parentID 沿 parent_role_id 向上遍历完整链路（visited 集合防止死循环），
+// 链路中出现 selfID 或重复节点时返回 Validation。
+func (s *RoleService) validateParentRoleNoCycle(ctx context.Context, selfID int64, parentID *int64) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID <= 0 {
+		return errorx.New(errorx.Validation, "parent_role_id 无效")
+	}
+	if selfID > 0 && *parentID == selfID {
+		return errorx.New(errorx.Validation, "parent_role_id 不能指向自身")
+	}
+
+	visited := map[int64]struct{}{}
+	if selfID > 0 {
+		visited[selfID] = struct{}{}
+	}
+
+	curID := *parentID
+	for curID > 0 {
+		if _, ok := visited[curID]; ok {
+			return errorx.New(errorx.Validation, "角色继承链路存在环").
+				WithContext("role_id", selfID).
+				WithContext("parent_role_id", *parentID)
+		}
+		visited[curID] = struct{}{}
+
+		cur, err := s.roleRepo.GetByID(ctx, curID)
+		if err != nil {
+			return err
+		}
+		if cur.ParentRoleID == nil {
+			break
+		}
+		curID = *cur.ParentRoleID
+	}
+	return nil
+}
+
+// GetPermissionHistory 获取角色权限变更历史（按时间正序，每条为一次编辑的新增/移除差异）
+func (s *RoleService) GetPermissionHistory(ctx context.Context, roleID int64) ([]*iamentity.RolePermissionEvent, error) {
+	// 1. 检查角色是否存在
+	if _, err := s.roleRepo.GetByID(ctx, roleID); err != nil {
+		return nil, svc.WithResourceContext(err, "role", roleID)
+	}
+
+	// 2. 查询变更记录
+	return s.roleRepo.FindPermissionEvents(ctx, roleID)
+}
+
+// recordPermissionChange 对比编辑前后的权限，持久化差异并发布 RolePermissionsChanged 事件（均为 best-effort）
+func (s *RoleService) recordPermissionChange(ctx context.Context, role *iamentity.Role, before []string) {
+	added, removed := diffPermissions(before, role.Permissions)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	now := time.Now()
+	actorID := actor.FromContext(ctx)
+	event := &iamentity.RolePermissionEvent{
+		RoleID:    role.GetID(),
+		Added:     iamentity.PermissionArray(added),
+		Removed:   iamentity.PermissionArray(removed),
+		ActorID:   actorID,
+		CreatedAt: now,
+	}
+	if err := s.roleRepo.RecordPermissionEvent(ctx, event); err != nil {
+		s.logger.Warn(ctx, "[RoleService] 记录角色权限变更失败",
+			logging.Error(err),
+			logging.Int64("role_id", role.GetID()),
+		)
+	}
+
+	if s.eventBus == nil {
+		return
+	}
+	payload := &iamevent.RolePermissionsChanged{
+		RoleID:    role.GetID(),
+		RoleCode:  role.Code,
+		Added:     added,
+		Removed:   removed,
+		ActorID:   actorID,
+		ChangedAt: now,
+	}
+	evt := eventing.NewEvent(role.GetID(), "role", payload.GetType(), 1, payload)
+	if err := s.eventBus.PublishEvent(ctx, evt); err != nil {
+		s.logger.Warn(ctx, "[RoleService] 发布 RolePermissionsChanged 事件失败",
+			logging.Error(err),
+			logging.Int64("role_id", role.GetID()),
+		)
+	}
+}
+
+// diffPermissions 计算权限差异（结果排序，便于比较与展示）
+func diffPermissions(before, after []string) (added, removed []string) {
+	beforeSet := make(map[string]struct{}, len(before))
+	for _, p := range before {
+		beforeSet[p] = struct{}{}
+	}
+	afterSet := make(map[string]struct{}, len(after))
+	for _, p := range after {
+		afterSet[p] = struct{}{}
+		if _, ok := beforeSet[p]; !ok {
+			added = append(added, p)
+		}
+	}
+	for p := range beforeSet {
+		if _, ok := afterSet[p]; !ok {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
 // 发布用户角色相关事件（内部辅助方法）
 
 func (s *RoleService) publishUserRoleAssignedEvent(ctx context.Context, userID int64, role *iamentity.Role) {
@@ -55,3 +55,29 @@ func TestValidatePermissions_StrictRegistry(t *testing.T) {
 		t.Fatalf("expected unknown permission to fail")
 	}
 }
+
+func TestGetPermissionDependencyValidation(t *testing.T) {
+	s := &RoleService{}
+	if result := s.GetPermissionDependencyValidation([]string{"user:delete"}); !result.Valid {
+		t.Fatalf("expected valid without configured dependencies, got %+v", result)
+	}
+
+	s.SetPermissionDependencies(map[string][]string{
+		"user:delete": {"user:read", "user:list"},
+		"user:write":  {"user:read"},
+	})
+	result := s.GetPermissionDependencyValidation([]string{"user:delete", "user:list", "user:write"})
+	if result.Valid {
+		t.Fatal("expected missing dependencies")
+	}
+	if got := result.Missing["user:delete"]; len(got) != 1 || got[0] != "user:read" {
+		t.Fatalf("expected user:delete missing user:read, got %v", got)
+	}
+	if got := result.Missing["user:write"]; len(got) != 1 || got[0] != "user:read" {
+		t.Fatalf("expected user:write missing user:read, got %v", got)
+	}
+
+	if result := s.GetPermissionDependencyValidation([]string{"user:delete", "user:list", "user:read"}); !result.Valid || len(result.Missing) != 0 {
+		t.Fatalf("expected satisfied dependencies, got %+v", result)
+	}
+}
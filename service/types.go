@@ -1,12 +1,18 @@
 package service
 
+import (
+	"time"
+
+	iamentity "gochen-iam/entity"
+)
+
 // 用户相关请求和响应类型
 
 // RegisterRequest 用户注册请求
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"` // 长度规则见 PasswordMinLength
 }
 
 // AuthenticateRequest 用户认证请求
@@ -22,18 +28,46 @@ type AuthenticateResult struct {
 	Email       string   `json:"email"`
 	Roles       []string `json:"roles"`
 	Permissions []string `json:"permissions"`
+	// TenantID 用户所属租户（签发令牌时写入租户声明；空表示不属于任何租户）
+	TenantID string `json:"tenant_id,omitempty"`
+	// LastLoginAt 本次登录时间；PreviousLoginAt 上一次登录时间（首次登录为空），供客户端展示“上次登录于”
+	LastLoginAt     *time.Time `json:"last_login_at,omitempty"`
+	PreviousLoginAt *time.Time `json:"previous_login_at,omitempty"`
+	// TwoFactorRequired 为 true 时表示密码已通过但仍需第二因子（此时不含角色/权限，不应签发访问令牌）
+	TwoFactorRequired bool `json:"two_factor_required,omitempty"`
+}
+
+// TOTPSetup 启用 TOTP 两步验证时返回的密钥信息
+type TOTPSetup struct {
+	Secret string `json:"secret"`      // base32 编码密钥（供手动录入）
+	URL    string `json:"otpauth_url"` // otpauth:// URL（供生成二维码）
 }
 
 // ChangePasswordRequest 修改密码请求
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" binding:"required"`
-	NewPassword string `json:"new_password" binding:"required,min=6"`
+	NewPassword string `json:"new_password" binding:"required"` // 规则见 PasswordPolicyFromEnv
 }
 
 // UpdateUserRequest 更新用户信息请求
 type UpdateUserRequest struct {
 	Email  string `json:"email" binding:"omitempty,email"`
 	Avatar string `json:"avatar" binding:"omitempty"`
+
+	// 资料字段：为空表示不修改
+	DisplayName string `json:"display_name" binding:"omitempty"`
+	Phone       string `json:"phone" binding:"omitempty"`  // E.164，如 +8613800138000（空格/连字符/括号会被去除）
+	Locale      string `json:"locale" binding:"omitempty"` // BCP 47，如 zh-CN
+}
+
+// LockedUser 锁定用户报表项（手动锁定或连续登录失败自动锁定）
+type LockedUser struct {
+	UserID       int64      `json:"user_id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	Reason       string     `json:"reason"` // manual/failed_logins
+	LockedAt     *time.Time `json:"locked_at,omitempty"`
+	LockoutUntil *time.Time `json:"lockout_until,omitempty"`
 }
 
 // 组织相关请求和响应类型
@@ -62,6 +96,40 @@ type GroupTreeNode struct {
 	Children    []*GroupTreeNode `json:"children,omitempty"`
 }
 
+// GroupMember 组织成员（用户信息 + 加入时间）
+//
+// 内嵌 *User 以保持原有用户字段的 JSON 结构，额外附加 joined_at；
+// 历史数据未回填时 JoinedAt 为空。
+type GroupMember struct {
+	*iamentity.User
+	JoinedAt *time.Time `json:"joined_at"`
+}
+
+// StripUserSecrets 清除用户的敏感字段（密码哈希、TOTP 密钥），用于对外返回用户列表
+func StripUserSecrets(users ...*iamentity.User) {
+	for _, user := range users {
+		if user != nil {
+			user.Password = ""
+			user.TOTPSecret = ""
+		}
+	}
+}
+
+// GroupMemberEffectiveRoles 组织成员及其有效角色（直接分配 + 所属组织默认角色，仅 active 且未软删，字典序）
+type GroupMemberEffectiveRoles struct {
+	UserID   int64    `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+// GroupPermissionContribution 组织通过默认角色为成员贡献的权限（用于权限来源解释）
+type GroupPermissionContribution struct {
+	GroupID     int64    `json:"group_id"`
+	GroupName   string   `json:"group_name"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
 // 角色相关请求和响应类型
 
 // CreateRoleRequest 创建角色请求
@@ -69,6 +137,11 @@ type CreateRoleRequest struct {
 	Name        string   `json:"name" binding:"required,max=50"`
 	Description string   `json:"description" binding:"omitempty,max=500"`
 	Permissions []string `json:"permissions" binding:"required"`
+	// ParentRoleID 父角色（可选）
+	ParentRoleID *int64 `json:"parent_role_id" binding:"omitempty"`
+
+	// SuggestNameOnConflict 名称冲突时在错误上下文中附带可用的建议名称（suggested_name/suggested_code）
+	SuggestNameOnConflict bool `json:"suggest_name_on_conflict"`
 }
 
 // UpdateRoleRequest 更新角色请求
@@ -76,6 +149,24 @@ type UpdateRoleRequest struct {
 	Name        string   `json:"name" binding:"omitempty,max=50"`
 	Description string   `json:"description" binding:"omitempty,max=500"`
 	Permissions []string `json:"permissions" binding:"omitempty"`
+	// ParentRoleID 父角色（可选；为空表示不修改）
+	ParentRoleID *int64 `json:"parent_role_id" binding:"omitempty"`
+}
+
+// CloneRoleOptions 克隆角色选项（零值表示仅复制权限）
+type CloneRoleOptions struct {
+	// CopyGroupAssignments 同时复制源角色的组织默认角色关联（不复制用户分配）
+	CopyGroupAssignments bool `json:"copy_group_assignments"`
+}
+
+// ListOptions 列表查询的可见性选项（零值表示仅返回 active 且未软删除的实体）
+//
+// 路由层统一通过 query 参数 include_inactive / include_deleted（true/false）传入。
+type ListOptions struct {
+	// IncludeInactive 包含非 active 状态的实体（角色：inactive；用户：inactive/locked/pending 等）
+	IncludeInactive bool `json:"include_inactive"`
+	// IncludeDeleted 包含已软删除的实体
+	IncludeDeleted bool `json:"include_deleted"`
 }
 
 // RoleAssignRequest 角色分配请求
@@ -90,11 +181,48 @@ type PermissionCheckRequest struct {
 	Permission string `json:"permission" binding:"required"`
 }
 
+// 权限来源类型
+const (
+	PermissionSourceDirect    = "direct"    // 直接分配给用户的角色
+	PermissionSourceGroup     = "group"     // 所属组织的默认角色
+	PermissionSourceInherited = "inherited" // 上述角色父链路（parent_role_id）上的祖先角色
+)
+
 // PermissionCheckResponse 权限检查响应
 type PermissionCheckResponse struct {
 	HasPermission bool     `json:"has_permission"`
-	Roles         []string `json:"roles"`
-	Source        string   `json:"source"` // "direct" 或 "inherited"
+	Roles         []string `json:"roles"`  // 授予该权限的角色名（去重排序）
+	Source        string   `json:"source"` // 首要来源（direct > group > inherited），无权限时为空
+	// Sources 全部授予路径（同一角色经多条路径授予时各列一项）
+	Sources []*PermissionSource `json:"sources"`
+}
+
+// PermissionSource 权限的一条授予路径
+type PermissionSource struct {
+	Type string `json:"type"` // direct / group / inherited
+	Role string `json:"role"` // 权限声明所在的角色
+	// ViaRole 为 inherited 时用户实际持有（直接分配或组织默认）的子角色
+	ViaRole string `json:"via_role,omitempty"`
+	// GroupID/GroupName 经组织默认角色授予时的组织（含经组织角色继承）
+	GroupID   int64  `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+}
+
+// PermissionDependencyMode 权限依赖校验模式
+type PermissionDependencyMode string
+
+const (
+	// PermissionDependencyModeWarn 仅记录缺失的依赖（默认）
+	PermissionDependencyModeWarn PermissionDependencyMode = "warn"
+	// PermissionDependencyModeEnforce 缺少依赖时拒绝创建/更新角色
+	PermissionDependencyModeEnforce PermissionDependencyMode = "enforce"
+)
+
+// PermissionDependencyValidation 权限依赖校验结果
+type PermissionDependencyValidation struct {
+	Valid bool `json:"valid"`
+	// Missing 权限 -> 缺失的依赖权限（按字典序）
+	Missing map[string][]string `json:"missing,omitempty"`
 }
 
 // 通用响应类型
@@ -111,6 +239,15 @@ type BatchOperationResponse struct {
 	Errors       []error `json:"errors,omitempty"`
 }
 
+// BulkRegisterResult 批量注册的单行结果（Index 对应请求切片下标）
+type BulkRegisterResult struct {
+	Index    int    `json:"index"`
+	Username string `json:"username"`
+	Success  bool   `json:"success"`
+	UserID   int64  `json:"user_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 // StatisticsResponse 统计信息响应
 type StatisticsResponse struct {
 	TotalUsers    int64            `json:"total_users"`
@@ -121,6 +258,40 @@ type StatisticsResponse struct {
 	UsersByStatus map[string]int64 `json:"users_by_status"`
 }
 
+// RecentRegistrations 近期注册用户数
+type RecentRegistrations struct {
+	Last24Hours int64 `json:"last_24h"`
+	Last7Days   int64 `json:"last_7d"`
+	Last30Days  int64 `json:"last_30d"`
+}
+
+// AdminSummary 管理端首页汇总（仅包含聚合计数，不含用户明细等敏感数据）
+type AdminSummary struct {
+	Groups              *StatisticsResponse    `json:"groups"`
+	Roles               map[string]interface{} `json:"roles"`
+	RecentRegistrations *RecentRegistrations   `json:"recent_registrations"`
+	GeneratedAt         time.Time              `json:"generated_at"`
+}
+
+// PermissionRegistryEntry 权限字典（required permissions registry）中的一项
+type PermissionRegistryEntry struct {
+	Permission string `json:"permission"`
+	// InCatalog 是否属于 AllPermissions（可授予角色的权限目录）；为 false 表示该权限守卫的路由无法通过角色授予
+	InCatalog bool `json:"in_catalog"`
+	// Callsites 注册点（脱敏：仅保留文件名与行号）
+	Callsites []string `json:"callsites"`
+}
+
+// PermissionAudit 权限治理审计结果（各集合按权限码排序）
+type PermissionAudit struct {
+	// Unreachable 路由要求但没有任何 active 角色授予（含通配符覆盖）的权限
+	Unreachable []string `json:"unreachable"`
+	// Dangling 角色授予但不被任何路由要求的权限（通配符未覆盖任何路由权限时同样计入）
+	Dangling []string `json:"dangling"`
+	// Undeclared 路由要求或角色授予、但不在 AllPermissions 中的权限（通配符不计入）
+	Undeclared []string `json:"undeclared"`
+}
+
 // 业务规则常量
 
 const (
@@ -139,11 +310,12 @@ const (
 	UserRoleName        = "user"
 
 	// 业务限制
-	MaxGroupLevel     = 10  // 最大组织层级
-	MaxPasswordLength = 255 // 最大密码长度
-	MinPasswordLength = 6   // 最小密码长度
-	MaxUsernameLength = 50  // 最大用户名长度
-	MinUsernameLength = 3   // 最小用户名长度
+	MaxGroupLevel      = 10  // 最大组织层级
+	MaxPasswordLength  = 255 // 最大密码长度
+	MinPasswordLength  = 8   // 默认最小密码长度（可通过 AUTH_PASSWORD_MIN_LENGTH 覆盖，见 PasswordMinLength）
+	MaxUsernameLength  = 50  // 最大用户名长度
+	MinUsernameLength  = 3   // 最小用户名长度
+	MaxAvatarURLLength = 500 // 最大头像URL长度
 )
 
 // 预定义权限
@@ -0,0 +1,125 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	"gochen/errorx"
+)
+
+const (
+	// defaultEmailVerificationTTL 邮箱验证令牌默认有效期
+	defaultEmailVerificationTTL = 24 * time.Hour
+	// emailVerificationTokenPurpose 签名用途前缀，避免与密码重置等签名内容混用
+	emailVerificationTokenPurpose = "iam.email_verification"
+)
+
+// SetEmailVerificationTTL 设置邮箱验证令牌有效期（<=0 恢复默认 24 小时）。
+func (s *UserService) SetEmailVerificationTTL(ttl time.Duration) {
+	s.emailVerificationTTL = ttl
+}
+
+func (s *UserService) currentEmailVerificationTTL() time.Duration {
+	if s.emailVerificationTTL <= 0 {
+		return defaultEmailVerificationTTL
+	}
+	return s.emailVerificationTTL
+}
+
+// GenerateEmailVerificationToken 为待验证用户生成邮箱验证令牌
+//
+// 令牌格式为 "<user_id>.<expires_unix>.<signature>"，签名基于 AUTH_SECRET 与用户当前邮箱、状态：
+// 验证成功后用户转为 active，此前签发的令牌全部失效，从而保证一次性使用。
+// 用户非 pending 状态时返回 Validation。
+func (s *UserService) GenerateEmailVerificationToken(ctx context.Context, userID int64) (string, error) {
+	// 1. 校验参数
+	secret, err := authSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// 2. 查找用户
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if !user.IsPending() {
+		return "", errorx.New(errorx.Validation, "用户无需验证邮箱")
+	}
+
+	// 3. 生成令牌
+	expiresAt := time.Now().Add(s.currentEmailVerificationTTL()).Unix()
+	payload := strconv.FormatInt(user.GetID(), 10) + "." + strconv.FormatInt(expiresAt, 10)
+	return payload + "." + signEmailVerification(secret, user, payload), nil
+}
+
+// VerifyEmail 使用验证令牌完成邮箱验证并激活用户
+//
+// 令牌无效、已使用或已过期时返回 Validation。
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (*iamentity.User, error) {
+	// 1. 校验参数
+	secret, err := authSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 解析令牌
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, errorx.New(errorx.Validation, "验证令牌无效")
+	}
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || userID <= 0 {
+		return nil, errorx.New(errorx.Validation, "验证令牌无效")
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, errorx.New(errorx.Validation, "验证令牌无效")
+	}
+
+	// 3. 校验签名（绑定当前邮箱与状态，激活或更换邮箱后旧令牌不再匹配）
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, errorx.New(errorx.Validation, "验证令牌无效")
+		}
+		return nil, err
+	}
+	expected := signEmailVerification(secret, user, parts[0]+"."+parts[1])
+	if !user.IsPending() || !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, errorx.New(errorx.Validation, "验证令牌无效或已使用")
+	}
+
+	// 4. 校验有效期
+	if time.Now().Unix() > expiresAt {
+		return nil, errorx.New(errorx.Validation, "验证令牌已过期")
+	}
+
+	// 5. 激活用户
+	user.Activate()
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// signEmailVerification 计算令牌签名：HMAC-SHA256(secret, purpose | payload | 邮箱 | 状态)
+func signEmailVerification(secret []byte, user *iamentity.User, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(emailVerificationTokenPurpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(user.Email))
+	mac.Write([]byte{0})
+	mac.Write([]byte(user.Status))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
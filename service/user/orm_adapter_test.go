@@ -59,9 +59,40 @@ func (g *testGormOrm) BeginTx(ctx context.Context, opts *sql.TxOptions) (orm.IOr
 	}
 	return &testGormSession{testGormOrm{db: tx, capabilities: g.capabilities}}, nil
 }
-func (g *testGormOrm) Database() database.IDatabase { return nil }
+func (g *testGormOrm) Database() database.IDatabase { return &testGormDatabase{db: g.db} }
 func (g *testGormOrm) Raw() any                     { return g.db }
 
+// testGormDatabase 基于 GORM 的最小 IDatabase 实现（仅支持原生 SQL 执行与查询）。
+type testGormDatabase struct{ db *gorm.DB }
+
+func (d *testGormDatabase) Query(ctx context.Context, query string, args ...any) (database.IRows, error) {
+	return d.db.WithContext(ctx).Raw(query, args...).Rows()
+}
+func (d *testGormDatabase) QueryRow(ctx context.Context, query string, args ...any) database.IRow {
+	return d.db.WithContext(ctx).Raw(query, args...).Row()
+}
+func (d *testGormDatabase) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result := d.db.WithContext(ctx).Exec(query, args...)
+	if result.Error != nil {
+		return nil, convertTestError(result.Error)
+	}
+	return testGormResult(result.RowsAffected), nil
+}
+func (d *testGormDatabase) Begin(ctx context.Context) (database.ITransaction, error) {
+	return nil, errorx.New(errorx.Unsupported, "test database does not support raw transactions")
+}
+func (d *testGormDatabase) BeginTx(ctx context.Context, opts *sql.TxOptions) (database.ITransaction, error) {
+	return nil, errorx.New(errorx.Unsupported, "test database does not support raw transactions")
+}
+func (d *testGormDatabase) Ping(ctx context.Context) error { return nil }
+func (d *testGormDatabase) Close() error                   { return nil }
+func (d *testGormDatabase) Raw() any                       { return d.db }
+
+type testGormResult int64
+
+func (r testGormResult) LastInsertId() (int64, error) { return 0, nil }
+func (r testGormResult) RowsAffected() (int64, error) { return int64(r), nil }
+
 type testGormSession struct{ testGormOrm }
 
 func (s *testGormSession) Commit() error   { return s.db.Commit().Error }
@@ -0,0 +1,164 @@
+package user
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	iamevent "gochen-iam/event"
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	"gochen/errorx"
+)
+
+const (
+	// envAuthSecret 服务端密钥（与 JWT 共用 AUTH_SECRET）
+	envAuthSecret = "AUTH_SECRET"
+	// defaultPasswordResetTTL 密码重置令牌默认有效期
+	defaultPasswordResetTTL = 30 * time.Minute
+	// passwordResetTokenPurpose 签名用途前缀，避免与其他签名内容混用
+	passwordResetTokenPurpose = "iam.password_reset"
+)
+
+// SetPasswordResetTTL 设置密码重置令牌有效期（<=0 恢复默认 30 分钟）。
+func (s *UserService) SetPasswordResetTTL(ttl time.Duration) {
+	s.passwordResetTTL = ttl
+}
+
+func (s *UserService) currentPasswordResetTTL() time.Duration {
+	if s.passwordResetTTL <= 0 {
+		return defaultPasswordResetTTL
+	}
+	return s.passwordResetTTL
+}
+
+// CreatePasswordResetToken 为指定邮箱的用户生成密码重置令牌
+//
+// 令牌格式为 "<user_id>.<expires_unix>.<signature>"，签名基于 AUTH_SECRET 与用户当前密码哈希：
+// 密码一旦变更（包括通过该令牌完成重置），此前签发的令牌全部失效，从而保证一次性使用。
+// 邮箱不存在时返回 NotFound；协议层应统一返回泛化提示，避免用户枚举。
+func (s *UserService) CreatePasswordResetToken(ctx context.Context, email string) (string, error) {
+	// 1. 校验参数
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", errorx.New(errorx.Validation, "邮箱不能为空")
+	}
+	secret, err := authSecret()
+	if err != nil {
+		return "", err
+	}
+
+	// 2. 查找用户
+	user, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", errorx.New(errorx.NotFound, "用户不存在")
+	}
+
+	// 3. 生成令牌
+	expiresAt := time.Now().Add(s.currentPasswordResetTTL()).Unix()
+	payload := strconv.FormatInt(user.GetID(), 10) + "." + strconv.FormatInt(expiresAt, 10)
+	return payload + "." + signPasswordReset(secret, user, payload), nil
+}
+
+// ResetPassword 使用重置令牌设置新密码
+//
+// 令牌无效、已使用或已过期时返回 Validation；新密码需满足密码策略（见 svc.ValidatePassword），
+// 且启用历史密码校验时不得与最近使用过的密码相同。
+// 重置成功后吊销该用户已签发的 token。
+func (s *UserService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// 1. 校验参数
+	if err := svc.ValidatePassword(newPassword); err != nil {
+		return err
+	}
+	secret, err := authSecret()
+	if err != nil {
+		return err
+	}
+
+	// 2. 解析令牌
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return errorx.New(errorx.Validation, "重置令牌无效")
+	}
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || userID <= 0 {
+		return errorx.New(errorx.Validation, "重置令牌无效")
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errorx.New(errorx.Validation, "重置令牌无效")
+	}
+
+	// 3. 校验签名（绑定当前密码哈希，密码变更后旧令牌不再匹配）
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return errorx.New(errorx.Validation, "重置令牌无效")
+		}
+		return err
+	}
+	expected := signPasswordReset(secret, user, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return errorx.New(errorx.Validation, "重置令牌无效或已使用")
+	}
+
+	// 4. 校验有效期
+	if time.Now().Unix() > expiresAt {
+		return errorx.New(errorx.Validation, "重置令牌已过期")
+	}
+
+	// 5. 校验历史密码重复使用，更新密码并记录被替换的旧密码
+	if err := s.checkPasswordReuse(ctx, user, newPassword); err != nil {
+		return err
+	}
+	previousHash := user.Password
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Internal, "密码加密失败")
+	}
+	user.SetPassword(hashedPassword, time.Now())
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	s.recordPasswordHistory(ctx, user.GetID(), previousHash)
+
+	// 6. 吊销已签发 token，避免泄露的会话在重置后继续可用
+	iammw.RevokeUserTokens(user.GetID())
+
+	// 7. 发布密码变更事件（最佳努力）
+	s.publishEvent(ctx, user.GetID(), &iamevent.PasswordChanged{
+		UserID:    user.GetID(),
+		Source:    "reset",
+		ChangedAt: user.UpdatedAt,
+	})
+	return nil
+}
+
+// authSecret 获取服务端密钥（AUTH_SECRET，用于签名与加密）
+func authSecret() ([]byte, error) {
+	secret := os.Getenv(envAuthSecret)
+	if secret == "" {
+		return nil, errorx.New(errorx.Internal, "必须设置 AUTH_SECRET 环境变量")
+	}
+	return []byte(secret), nil
+}
+
+// signPasswordReset 计算令牌签名：HMAC-SHA256(secret, purpose | payload | 当前密码哈希)
+func signPasswordReset(secret []byte, user *iamentity.User, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(passwordResetTokenPurpose))
+	mac.Write([]byte{0})
+	mac.Write([]byte(payload))
+	mac.Write([]byte{0})
+	mac.Write([]byte(user.Password))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,44 @@
+package user
+
+import (
+	"context"
+
+	iammw "gochen-iam/middleware"
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/logging"
+)
+
+// ListSessions 返回用户当前活跃的登录会话（未过期且未被吊销），按登记时间正序
+//
+// 会话由登录时登记（见 middleware.StartSession），存储默认为进程内存，可通过 middleware.SetDefaultSessionTracker 替换。
+func (s *UserService) ListSessions(ctx context.Context, userID int64) ([]*iammw.Session, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, svc.WithResourceContext(err, "user", userID)
+	}
+	return iammw.ActiveSessions(userID), nil
+}
+
+// RevokeSession 吊销用户的指定会话（jti 为会话 ID 即刷新令牌 jti，或其当前访问令牌 jti）
+//
+// 会话的访问令牌与刷新令牌均被吊销；会话不存在、已失效或不属于该用户时返回 NotFound。
+func (s *UserService) RevokeSession(ctx context.Context, userID int64, jti string) error {
+	// 1. 校验参数
+	if jti == "" {
+		return errorx.New(errorx.Validation, "会话 ID 不能为空")
+	}
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return svc.WithResourceContext(err, "user", userID)
+	}
+
+	// 2. 吊销会话
+	if !iammw.RevokeSession(userID, jti) {
+		return errorx.New(errorx.NotFound, "会话不存在或已失效")
+	}
+
+	s.logger.Info(ctx, "[UserService] revoke session",
+		logging.Int64("user_id", userID),
+		logging.String("session_id", jti),
+	)
+	return nil
+}
@@ -0,0 +1,313 @@
+package user
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	iamentity "gochen-iam/entity"
+	svc "gochen-iam/service"
+	"gochen/errorx"
+	"gochen/logging"
+)
+
+const (
+	// totpIssuer otpauth URL 中的签发方名称
+	totpIssuer = "gochen-iam"
+	// totpPeriod 时间步长（RFC 6238 默认 30 秒）
+	totpPeriod = 30
+	// totpDigits 验证码位数
+	totpDigits = 6
+	// totpSkew 允许的前后时间步偏差（容忍客户端时钟漂移）
+	totpSkew = 1
+	// totpSecretSize 密钥字节数（160 bit，与 HMAC-SHA1 输出等长）
+	totpSecretSize = 20
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnableTOTP 为用户生成新的 TOTP 密钥（待确认状态）
+//
+// 返回 base32 密钥与 otpauth:// URL；需调用 ConfirmTOTP 校验首个验证码后两步验证才会生效。
+// 已启用时返回 Validation，需先 DisableTOTP。
+func (s *UserService) EnableTOTP(ctx context.Context, userID int64) (*svc.TOTPSetup, error) {
+	// 1. 获取用户
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, errorx.New(errorx.Validation, "两步验证已启用")
+	}
+
+	// 2. 生成密钥
+	raw := make([]byte, totpSecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "生成两步验证密钥失败")
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	// 3. 加密保存（未启用）
+	encrypted, err := encryptTOTPSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdateTOTP(ctx, userID, encrypted, false); err != nil {
+		return nil, err
+	}
+
+	return &svc.TOTPSetup{
+		Secret: secret,
+		URL:    totpURL(user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP 校验首个验证码并启用两步验证
+func (s *UserService) ConfirmTOTP(ctx context.Context, userID int64, code string) error {
+	// 1. 获取用户
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.TwoFactorEnabled {
+		return errorx.New(errorx.Validation, "两步验证已启用")
+	}
+	if user.TOTPSecret == "" {
+		return errorx.New(errorx.Validation, "请先生成两步验证密钥")
+	}
+
+	// 2. 校验验证码（记录时间步，确认用的验证码不能再用于登录）
+	if err := s.acceptTOTP(ctx, user, code); err != nil {
+		return err
+	}
+
+	// 3. 启用
+	return s.userRepo.UpdateTOTP(ctx, userID, user.TOTPSecret, true)
+}
+
+// VerifyTOTP 校验已启用两步验证用户的验证码（每个验证码仅可使用一次）
+func (s *UserService) VerifyTOTP(ctx context.Context, userID int64, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.verifyEnabledTOTP(ctx, user, code)
+}
+
+// verifyEnabledTOTP 校验已启用两步验证用户的验证码并记录时间步
+func (s *UserService) verifyEnabledTOTP(ctx context.Context, user *iamentity.User, code string) error {
+	if !user.TwoFactorEnabled || user.TOTPSecret == "" {
+		return errorx.New(errorx.Validation, "未启用两步验证")
+	}
+	return s.acceptTOTP(ctx, user, code)
+}
+
+// acceptTOTP 校验验证码并拒绝重放：不晚于上次通过的时间步的验证码视为已使用，通过后记录本次时间步
+func (s *UserService) acceptTOTP(ctx context.Context, user *iamentity.User, code string) error {
+	step, err := verifyUserTOTP(user.TOTPSecret, code)
+	if err != nil {
+		return err
+	}
+	if step <= user.TOTPLastStep {
+		return errorx.New(errorx.Validation, "验证码已使用，请等待下一个验证码")
+	}
+	if err := s.userRepo.UpdateTOTPLastStep(ctx, user.GetID(), step); err != nil {
+		return err
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// DisableTOTP 关闭两步验证（需校验当前密码）
+func (s *UserService) DisableTOTP(ctx context.Context, userID int64, currentPassword string) error {
+	// 1. 获取用户
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// 2. 验证当前密码
+	if !s.verifyPassword(currentPassword, user.Password) {
+		return errorx.New(errorx.Validation, "密码错误")
+	}
+
+	// 3. 清除密钥
+	return s.userRepo.UpdateTOTP(ctx, userID, "", false)
+}
+
+// CompleteTwoFactorLogin 完成两步验证登录：校验验证码后返回完整认证结果
+//
+// 验证码错误与密码错误共用登录失败计数，连续失败达到阈值后临时锁定；锁定期内不校验验证码。
+func (s *UserService) CompleteTwoFactorLogin(ctx context.Context, userID int64, code string) (*svc.AuthenticateResult, error) {
+	// 1. 获取用户并检查临时锁定
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if user.IsLockedOut(now) {
+		return nil, errorx.New(errorx.Forbidden, "账户已被临时锁定，请稍后再试").
+			WithContext("lockout_until", user.LockoutUntil.Format(time.RFC3339))
+	}
+
+	// 2. 校验验证码（错误或重放计入登录失败）
+	if err := s.verifyEnabledTOTP(ctx, user, code); err != nil {
+		if errorx.Is(err, errorx.Validation) && user.TwoFactorEnabled {
+			if recordErr := s.recordLoginFailure(ctx, user, now); recordErr != nil {
+				return nil, recordErr
+			}
+		}
+		return nil, err
+	}
+
+	// 3. 获取最新身份快照（含状态校验）
+	result, err := s.GetAuthSnapshot(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. 清除登录失败计数，更新最后登录时间（原最后登录时间记为上一次登录）
+	s.resetLoginFailures(ctx, user)
+	user.UpdateLastLogin()
+	if err := s.userRepo.UpdateLastLogin(ctx, userID, *user.LastLoginAt, user.PreviousLoginAt); err != nil {
+		s.logger.Warn(ctx, "[UserService] 更新最后登录时间失败",
+			logging.Error(err),
+			logging.Int64("user_id", userID),
+		)
+	}
+	result.LastLoginAt = user.LastLoginAt
+	result.PreviousLoginAt = user.PreviousLoginAt
+	return result, nil
+}
+
+// GenerateTOTPCode 根据 base32 密钥计算指定时刻的 TOTP 验证码（RFC 6238，HMAC-SHA1，6 位，30 秒步长）
+func GenerateTOTPCode(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, uint64(at.Unix()/totpPeriod), totpDigits), nil
+}
+
+// verifyUserTOTP 解密密钥并校验验证码（容忍 ±totpSkew 个时间步），返回匹配的时间步
+func verifyUserTOTP(encryptedSecret, code string) (int64, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, errorx.New(errorx.Validation, "验证码错误")
+	}
+	secret, err := decryptTOTPSecret(encryptedSecret)
+	if err != nil {
+		return 0, err
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+
+	step := time.Now().Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		expected := totpCode(key, uint64(step+offset), totpDigits)
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step + offset, nil
+		}
+	}
+	return 0, errorx.New(errorx.Validation, "验证码错误")
+}
+
+// totpCode 计算 HOTP 值（RFC 4226 动态截断）
+func totpCode(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(strings.TrimSpace(secret), "=")))
+	if err != nil || len(key) == 0 {
+		return nil, errorx.New(errorx.Validation, "两步验证密钥无效")
+	}
+	return key, nil
+}
+
+func totpURL(username, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", totpIssuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+// totpCipher 基于 AUTH_SECRET 派生的 AES-256-GCM
+func totpCipher() (cipher.AEAD, error) {
+	secret, err := authSecret()
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(append([]byte("iam.totp_secret\x00"), secret...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "初始化加密失败")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "初始化加密失败")
+	}
+	return gcm, nil
+}
+
+// encryptTOTPSecret 加密密钥，输出 base64(nonce | ciphertext)
+func encryptTOTPSecret(secret string) (string, error) {
+	gcm, err := totpCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errorx.Wrap(err, errorx.Internal, "加密两步验证密钥失败")
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptTOTPSecret 解密密钥
+func decryptTOTPSecret(encrypted string) (string, error) {
+	gcm, err := totpCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", errorx.New(errorx.Internal, "两步验证密钥已损坏")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errorx.New(errorx.Internal, "两步验证密钥解密失败")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,62 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 测试向量（HMAC-SHA1，密钥 "12345678901234567890"，8 位）
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, c := range cases {
+		if got := totpCode(key, uint64(c.unix/totpPeriod), 8); got != c.want {
+			t.Errorf("totpCode(t=%d) = %s, want %s", c.unix, got, c.want)
+		}
+	}
+
+	// GenerateTOTPCode 使用 6 位：取 8 位结果的后 6 位
+	secret := totpEncoding.EncodeToString(key)
+	got, err := GenerateTOTPCode(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("GenerateTOTPCode failed: %v", err)
+	}
+	if got != "287082" {
+		t.Fatalf("GenerateTOTPCode(t=59) = %s, want 287082", got)
+	}
+}
+
+func TestTOTPSecretEncryption_RoundTrip(t *testing.T) {
+	t.Setenv(envAuthSecret, "totp-test-secret")
+
+	encrypted, err := encryptTOTPSecret("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("encryptTOTPSecret failed: %v", err)
+	}
+	if encrypted == "JBSWY3DPEHPK3PXP" {
+		t.Fatal("expected ciphertext to differ from plaintext")
+	}
+	plain, err := decryptTOTPSecret(encrypted)
+	if err != nil {
+		t.Fatalf("decryptTOTPSecret failed: %v", err)
+	}
+	if plain != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("round trip mismatch: %s", plain)
+	}
+
+	// 密钥变更后无法解密
+	t.Setenv(envAuthSecret, "another-secret")
+	if _, err := decryptTOTPSecret(encrypted); err == nil {
+		t.Fatal("expected decrypt with different AUTH_SECRET to fail")
+	}
+}
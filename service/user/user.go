@@ -9,25 +9,52 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"gochen-iam/auth"
+
 	iamentity "gochen-iam/entity"
 
+	iamevent "gochen-iam/event"
+
+	iammw "gochen-iam/middleware"
+
 	grouprepo "gochen-iam/repo/group"
 
 	rolerepo "gochen-iam/repo/role"
 
+	tenantrepo "gochen-iam/repo/tenant"
+
 	userrepo "gochen-iam/repo/user"
 
 	svc "gochen-iam/service"
 	"gochen/errorx"
+	"gochen/eventing"
+	"gochen/eventing/bus"
 	"gochen/logging"
 )
 
+const (
+	// defaultAccessChangesWindow GetMyAccessChanges 默认查询窗口
+	defaultAccessChangesWindow = 30 * 24 * time.Hour
+	// maxAccessChanges GetMyAccessChanges 最多返回条数
+	maxAccessChanges = 100
+)
+
 // UserService 用户服务
 type UserService struct {
-	userRepo  *userrepo.UserRepo
-	groupRepo *grouprepo.GroupRepo
-	roleRepo  *rolerepo.RoleRepo
-	logger    logging.ILogger
+	userRepo   *userrepo.UserRepo
+	groupRepo  *grouprepo.GroupRepo
+	roleRepo   *rolerepo.RoleRepo
+	tenantRepo *tenantrepo.TenantRepo
+	validator  *svc.BusinessValidator
+	eventBus   bus.IEventBus
+	logger     logging.ILogger
+
+	// passwordResetTTL 密码重置令牌有效期（<=0 使用默认值，见 SetPasswordResetTTL）
+	passwordResetTTL time.Duration
+	// emailVerificationTTL 邮箱验证令牌有效期（<=0 使用默认值，见 SetEmailVerificationTTL）
+	emailVerificationTTL time.Duration
+	// bcryptCost 密码哈希成本（构造时读取 AUTH_BCRYPT_COST）
+	bcryptCost int
 }
 
 // NewUserService 创建用户服务实例
@@ -35,12 +62,18 @@ func NewUserService(
 	userRepo *userrepo.UserRepo,
 	groupRepo *grouprepo.GroupRepo,
 	roleRepo *rolerepo.RoleRepo,
+	tenantRepo *tenantrepo.TenantRepo,
+	eventBus bus.IEventBus,
 ) *UserService {
 	return &UserService{
-		userRepo:  userRepo,
-		groupRepo: groupRepo,
-		roleRepo:  roleRepo,
-		logger:    logging.ComponentLogger("iam.service.user"),
+		userRepo:   userRepo,
+		groupRepo:  groupRepo,
+		roleRepo:   roleRepo,
+		tenantRepo: tenantRepo,
+		validator:  svc.NewBusinessValidator(userRepo, groupRepo, roleRepo),
+		eventBus:   eventBus,
+		bcryptCost: svc.BcryptCost(),
+		logger:     logging.ComponentLogger("iam.service.user"),
 	}
 }
 
@@ -51,8 +84,12 @@ func (s *UserService) Register(ctx context.Context, req *svc.RegisterRequest) (*
 		return nil, err
 	}
 
+	// 用户名按输入（去除首尾空白）存储、忽略大小写比较；邮箱统一存储为小写
+	username := strings.TrimSpace(req.Username)
+	email := svc.NormalizeEmail(req.Email)
+
 	// 2. 检查用户名是否已存在
-	existingUser, err := s.userRepo.FindByUsername(ctx, req.Username)
+	existingUser, err := s.userRepo.FindByUsername(ctx, username)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
 		return nil, errorx.Wrap(err, errorx.Database, "检查用户名失败")
 	}
@@ -61,7 +98,7 @@ func (s *UserService) Register(ctx context.Context, req *svc.RegisterRequest) (*
 	}
 
 	// 3. 检查邮箱是否已存在
-	existingUser, err = s.userRepo.FindByEmail(ctx, req.Email)
+	existingUser, err = s.userRepo.FindByEmail(ctx, email)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
 		return nil, errorx.Wrap(err, errorx.Database, "检查邮箱失败")
 	}
@@ -69,35 +106,58 @@ func (s *UserService) Register(ctx context.Context, req *svc.RegisterRequest) (*
 		return nil, errorx.New(errorx.Validation, "邮箱已存在")
 	}
 
-	// 4. 创建用户实体
+	// 4. 创建用户实体（初始状态按配置，见 svc.RegistrationDefaultStatus；需邮箱验证时固定为 pending）
+	status, err := svc.RegistrationDefaultStatus()
+	if err != nil {
+		return nil, err
+	}
+	if svc.RequireEmailVerification() {
+		status = svc.UserStatusPending
+	}
 	hashedPassword, err := s.hashPassword(req.Password)
 	if err != nil {
 		return nil, errorx.Wrap(err, errorx.Internal, "密码加密失败")
 	}
 
 	user := &iamentity.User{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: hashedPassword,
-		Status:   svc.UserStatusActive,
-	}
-	user.SetUpdatedAt(time.Now())
-
-	// 5. 保存用户
-	if err := s.userRepo.Create(ctx, user); err != nil {
-		return nil, errorx.Wrap(err, errorx.Database, "保存用户失败")
+		Username: username,
+		Email:    email,
+		Status:   status,
 	}
+	user.SetPassword(hashedPassword, time.Now())
 
-	// 6. 分配默认角色
-	if err := s.assignDefaultRole(ctx, user.GetID()); err != nil {
-		// 记录错误但不影响注册流程
-		s.logger.Warn(ctx, "[UserService] 分配默认角色失败",
-			logging.Error(err),
-			logging.Int64("user_id", user.GetID()),
-			logging.String("username", user.Username),
-		)
+	// 5. 保存用户并分配默认角色（严格模式下同一事务完成，分配失败则注册失败）
+	if svc.DefaultRoleStrict() {
+		if err := s.createUserWithDefaultRole(ctx, user); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			if errorx.Is(err, errorx.Validation) {
+				return nil, err
+			}
+			return nil, errorx.Wrap(err, errorx.Database, "保存用户失败")
+		}
+		// 6. 分配默认角色
+		if err := s.assignDefaultRole(ctx, user.GetID()); err != nil {
+			// 记录错误但不影响注册流程
+			s.logger.Warn(ctx, "[UserService] 分配默认角色失败",
+				logging.Error(err),
+				logging.Int64("user_id", user.GetID()),
+				logging.String("username", user.Username),
+				logging.String("role", svc.DefaultRoleName()),
+			)
+		}
 	}
 
+	// 7. 发布用户注册事件（最佳努力）
+	s.publishEvent(ctx, user.GetID(), &iamevent.UserRegistered{
+		UserID:       user.GetID(),
+		Username:     user.Username,
+		Email:        user.Email,
+		Status:       user.Status,
+		RegisteredAt: user.CreatedAt,
+	})
 	return user, nil
 }
 
@@ -120,19 +180,61 @@ func (s *UserService) Authenticate(ctx context.Context, req *svc.AuthenticateReq
 		return nil, errorx.Wrap(err, errorx.Database, "查询用户失败")
 	}
 
-	// 3. 验证密码
+	// 3. 检查临时锁定（锁定期内不校验密码）
+	now := time.Now()
+	if user.IsLockedOut(now) {
+		return nil, errorx.New(errorx.Forbidden, "账户已被临时锁定，请稍后再试").
+			WithContext("lockout_until", user.LockoutUntil.Format(time.RFC3339))
+	}
+
+	// 4. 验证密码（失败计数，连续失败达到阈值后临时锁定）
 	if !s.verifyPassword(req.Password, user.Password) {
+		if err := s.recordLoginFailure(ctx, user, now); err != nil {
+			return nil, err
+		}
 		return nil, errorx.New(errorx.Validation, "用户名或密码错误")
 	}
 
-	// 4. 检查用户状态
+	// 5. 检查用户状态
 	if !user.IsActive() {
-		return nil, errorx.New(errorx.Forbidden, "用户账户已被禁用")
+		return nil, svc.InactiveUserError(user)
+	}
+
+	// 6. 哈希成本低于配置时透明升级（失败不影响登录）
+	if s.needsRehash(user.Password) {
+		if hashedPassword, err := s.hashPassword(req.Password); err != nil {
+			s.logger.Warn(ctx, "[UserService] 升级密码哈希失败",
+				logging.Error(err),
+				logging.Int64("user_id", user.GetID()),
+			)
+		} else if err := s.userRepo.UpdatePassword(ctx, user.GetID(), hashedPassword); err != nil {
+			s.logger.Warn(ctx, "[UserService] 升级密码哈希失败",
+				logging.Error(err),
+				logging.Int64("user_id", user.GetID()),
+			)
+		} else {
+			user.Password = hashedPassword
+		}
+	}
+
+	// 7. 清除登录失败计数（已启用两步验证时待第二因子通过后再清除，避免绕过验证码失败计数）
+	if !user.TwoFactorEnabled {
+		s.resetLoginFailures(ctx, user)
+	}
+
+	// 8. 已启用两步验证：仅返回身份信息并标记需要第二因子，不返回角色/权限
+	if user.TwoFactorEnabled {
+		return &svc.AuthenticateResult{
+			UserID:            user.GetID(),
+			Username:          user.Username,
+			Email:             user.Email,
+			TwoFactorRequired: true,
+		}, nil
 	}
 
-	// 5. 更新最后登录时间
+	// 9. 更新最后登录时间（仅写登录时间列，不覆盖并发写入的失败计数等字段）
 	user.UpdateLastLogin()
-	if err := s.userRepo.Update(ctx, user); err != nil {
+	if err := s.userRepo.UpdateLastLogin(ctx, user.GetID(), *user.LastLoginAt, user.PreviousLoginAt); err != nil {
 		// 记录错误但不影响登录流程
 		s.logger.Warn(ctx, "[UserService] 更新最后登录时间失败",
 			logging.Error(err),
@@ -141,18 +243,21 @@ func (s *UserService) Authenticate(ctx context.Context, req *svc.AuthenticateReq
 		)
 	}
 
-	// 6. 返回认证结果（不包含 token）
+	// 10. 返回认证结果（不包含 token）
 	roles, permissions, err := s.resolveEffectiveRolesAndPermissions(ctx, user.GetID())
 	if err != nil {
 		return nil, err
 	}
 
 	return &svc.AuthenticateResult{
-		UserID:      user.GetID(),
-		Username:    user.Username,
-		Email:       user.Email,
-		Roles:       roles,
-		Permissions: permissions,
+		UserID:          user.GetID(),
+		Username:        user.Username,
+		Email:           user.Email,
+		Roles:           roles,
+		Permissions:     permissions,
+		TenantID:        user.TenantID,
+		LastLoginAt:     user.LastLoginAt,
+		PreviousLoginAt: user.PreviousLoginAt,
 	}, nil
 }
 
@@ -167,7 +272,7 @@ func (s *UserService) GetAuthSnapshot(ctx context.Context, userID int64) (*svc.A
 		return nil, err
 	}
 	if !user.IsActive() {
-		return nil, errorx.New(errorx.Forbidden, "用户账户已被禁用")
+		return nil, svc.InactiveUserError(user)
 	}
 
 	roles, permissions, err := s.resolveEffectiveRolesAndPermissions(ctx, userID)
@@ -181,15 +286,39 @@ func (s *UserService) GetAuthSnapshot(ctx context.Context, userID int64) (*svc.A
 		Email:       user.Email,
 		Roles:       roles,
 		Permissions: permissions,
+		TenantID:    user.TenantID,
 	}, nil
 }
 
+// resolveEffectiveRolesAndPermissions 计算用户有效角色与权限
+//
+// 合并直接分配的角色与所属组织（可选含祖先组织）的默认角色，仅计入 active 角色，去重后排序输出；
+// 权限额外合并各角色父链路（parent_role_id）上 active 角色的权限。开启缓存时优先返回缓存结果。
 func (s *UserService) resolveEffectiveRolesAndPermissions(ctx context.Context, userID int64) ([]string, []string, error) {
+	if roleNames, permissions, ok := svc.GetCachedPermissions(ctx, userID); ok {
+		return roleNames, permissions, nil
+	}
+
 	roles, err := s.roleRepo.FindByUserID(ctx, userID)
 	if err != nil {
 		return nil, nil, err
 	}
+	groupRoles, err := s.findGroupDefaultRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles = append(roles, groupRoles...)
+
+	roleNames, permissions, err := s.collectRolesAndPermissions(ctx, roles)
+	if err != nil {
+		return nil, nil, err
+	}
+	svc.SetCachedPermissions(ctx, userID, roleNames, permissions)
+	return roleNames, permissions, nil
+}
 
+// collectRolesAndPermissions 汇总角色列表中 active 角色的名称与权限（含父角色链路上 active 角色的权限），去重后排序
+func (s *UserService) collectRolesAndPermissions(ctx context.Context, roles []*iamentity.Role) ([]string, []string, error) {
 	roleNames := make([]string, 0, len(roles))
 	roleSet := make(map[string]struct{}, len(roles))
 
@@ -213,16 +342,26 @@ func (s *UserService) resolveEffectiveRolesAndPermissions(ctx context.Context, u
 			}
 		}
 
-		for _, permission := range role.Permissions {
-			permission = strings.TrimSpace(permission)
-			if permission == "" {
+		// 父角色链路上的 active 角色同样贡献权限（角色名不展开）
+		chain, err := s.roleRepo.FindParentChain(ctx, role)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, source := range append([]*iamentity.Role{role}, chain...) {
+			if source.Status != svc.RoleStatusActive {
 				continue
 			}
-			if _, exists := permissionSet[permission]; exists {
-				continue
+			for _, permission := range source.Permissions {
+				permission = strings.TrimSpace(permission)
+				if permission == "" {
+					continue
+				}
+				if _, exists := permissionSet[permission]; exists {
+					continue
+				}
+				permissionSet[permission] = struct{}{}
+				permissions = append(permissions, permission)
 			}
-			permissionSet[permission] = struct{}{}
-			permissions = append(permissions, permission)
 		}
 	}
 
@@ -233,6 +372,61 @@ func (s *UserService) resolveEffectiveRolesAndPermissions(ctx context.Context, u
 	return roleNames, permissions, nil
 }
 
+// findGroupDefaultRoles 获取用户所属组织（可选含祖先组织）的默认角色
+func (s *UserService) findGroupDefaultRoles(ctx context.Context, userID int64) ([]*iamentity.Role, error) {
+	groupIDs, err := s.findRoleGrantingGroupIDs(ctx, userID)
+	if err != nil || len(groupIDs) == 0 {
+		return nil, err
+	}
+	return s.roleRepo.FindByGroupIDs(ctx, groupIDs)
+}
+
+// findRoleGrantingGroupIDs 获取为用户提供默认角色的组织 ID（所属组织，开启继承时含其祖先组织；已去重）
+func (s *UserService) findRoleGrantingGroupIDs(ctx context.Context, userID int64) ([]int64, error) {
+	if s.groupRepo == nil {
+		return nil, nil
+	}
+
+	groups, err := s.groupRepo.FindLiteByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	groupIDs := make([]int64, 0, len(groups))
+	seen := make(map[int64]struct{}, len(groups))
+	for _, group := range groups {
+		if _, ok := seen[group.GetID()]; ok {
+			continue
+		}
+		seen[group.GetID()] = struct{}{}
+		groupIDs = append(groupIDs, group.GetID())
+	}
+
+	if svc.InheritAncestorGroupRoles() {
+		for _, group := range groups {
+			if group.ParentID == nil {
+				continue
+			}
+			ancestors, err := s.groupRepo.FindAncestors(ctx, group.GetID())
+			if err != nil {
+				return nil, err
+			}
+			for _, ancestor := range ancestors {
+				if _, ok := seen[ancestor.GetID()]; ok {
+					continue
+				}
+				seen[ancestor.GetID()] = struct{}{}
+				groupIDs = append(groupIDs, ancestor.GetID())
+			}
+		}
+	}
+
+	return groupIDs, nil
+}
+
 // ChangePassword 修改密码
 func (s *UserService) ChangePassword(ctx context.Context, userID int64, req *svc.ChangePasswordRequest) error {
 	// 1. 获取用户
@@ -246,20 +440,36 @@ func (s *UserService) ChangePassword(ctx context.Context, userID int64, req *svc
 		return errorx.New(errorx.Validation, "原密码错误")
 	}
 
-	// 3. 验证新密码
-	if len(req.NewPassword) < svc.MinPasswordLength {
-		return errorx.New(errorx.Validation, "新密码长度不能少于6个字符")
+	// 3. 验证新密码（策略 + 历史密码重复使用）
+	if err := svc.ValidatePassword(req.NewPassword); err != nil {
+		return err
+	}
+	if err := s.checkPasswordReuse(ctx, user, req.NewPassword); err != nil {
+		return err
 	}
 
-	// 4. 更新密码
+	// 4. 更新密码，并记录被替换的旧密码
+	previousHash := user.Password
 	hashedPassword, err := s.hashPassword(req.NewPassword)
 	if err != nil {
 		return errorx.Wrap(err, errorx.Internal, "密码加密失败")
 	}
-	user.Password = hashedPassword
-	user.SetUpdatedAt(time.Now())
+	user.SetPassword(hashedPassword, time.Now())
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+	s.recordPasswordHistory(ctx, userID, previousHash)
 
-	return s.userRepo.Update(ctx, user)
+	// 5. 退出所有设备：吊销该用户已签发的 token
+	iammw.RevokeUserTokens(userID)
+
+	// 6. 发布密码变更事件（最佳努力）
+	s.publishEvent(ctx, userID, &iamevent.PasswordChanged{
+		UserID:    userID,
+		Source:    "change",
+		ChangedAt: user.UpdatedAt,
+	})
+	return nil
 }
 
 // UpdateProfile 更新用户资料
@@ -271,21 +481,39 @@ func (s *UserService) UpdateProfile(ctx context.Context, userID int64, req *svc.
 	}
 
 	// 2. 更新字段
-	if req.Email != "" && req.Email != user.Email {
+	if email := svc.NormalizeEmail(req.Email); email != "" && email != user.Email {
 		// 检查邮箱是否已被使用
-		existingUser, err := s.userRepo.FindByEmail(ctx, req.Email)
+		existingUser, err := s.userRepo.FindByEmail(ctx, email)
 		if err != nil && !errorx.Is(err, errorx.NotFound) {
 			return nil, errorx.Wrap(err, errorx.Database, "检查邮箱失败")
 		}
 		if existingUser != nil && existingUser.GetID() != userID {
 			return nil, errorx.New(errorx.Validation, "邮箱已被使用")
 		}
-		user.Email = req.Email
+		user.Email = email
 	}
 
 	if req.Avatar != "" {
+		if err := svc.ValidateAvatarURL(req.Avatar); err != nil {
+			return nil, err
+		}
 		user.Avatar = req.Avatar
 	}
+	if req.DisplayName != "" {
+		if user.DisplayName, err = svc.NormalizeDisplayName(req.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+	if req.Phone != "" {
+		if user.Phone, err = svc.NormalizePhone(req.Phone); err != nil {
+			return nil, err
+		}
+	}
+	if req.Locale != "" {
+		if user.Locale, err = svc.NormalizeLocale(req.Locale); err != nil {
+			return nil, err
+		}
+	}
 
 	user.SetUpdatedAt(time.Now())
 
@@ -297,6 +525,65 @@ func (s *UserService) UpdateProfile(ctx context.Context, userID int64, req *svc.
 	return user, nil
 }
 
+// ChangeUsername 修改用户名（管理员改名），返回更新后的用户
+//
+// 新用户名须满足长度规则且与其他用户不重复（忽略大小写）；仅大小写不同视为改名并记录历史。
+// 旧用户名在同一事务内写入 username_history 以便审计。已签发的 token 仍携带旧用户名，
+// 客户端应调用刷新接口换取新 token（刷新时按数据库实时状态签发）。
+func (s *UserService) ChangeUsername(ctx context.Context, userID int64, newUsername string) (user *iamentity.User, err error) {
+	// 1. 校验新用户名（格式与唯一性规则同注册，忽略大小写，排除自身）
+	newUsername = strings.TrimSpace(newUsername)
+	if err := s.validator.ValidateUsernameChange(ctx, userID, newUsername); err != nil {
+		return nil, err
+	}
+
+	// 2. 获取用户
+	user, err = s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	oldUsername := user.Username
+	if newUsername == oldUsername {
+		return user, nil
+	}
+
+	// 3. 开启事务
+	txCtx, err := s.userRepo.BeginTx(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.userRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 4. 更新用户名并记录历史（唯一索引冲突，如与已删除用户重名，由仓储转换为 Validation）
+	user.Username = newUsername
+	user.SetUpdatedAt(time.Now())
+	if err = s.userRepo.Update(txCtx, user); err != nil {
+		return nil, err
+	}
+	if err = s.userRepo.RecordUsernameChange(txCtx, userID, oldUsername, newUsername); err != nil {
+		return nil, err
+	}
+	if err = s.userRepo.Commit(txCtx); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	return user, nil
+}
+
+// GetUsernameHistory 获取用户的用户名变更记录（按时间正序）
+func (s *UserService) GetUsernameHistory(ctx context.Context, userID int64) ([]*iamentity.UsernameHistory, error) {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询变更记录
+	return s.userRepo.FindUsernameHistory(ctx, userID)
+}
+
 // ActivateUser 激活用户
 func (s *UserService) ActivateUser(ctx context.Context, userID int64) error {
 	user, err := s.userRepo.GetByID(ctx, userID)
@@ -314,9 +601,20 @@ func (s *UserService) DeactivateUser(ctx context.Context, userID int64) error {
 	if err != nil {
 		return err
 	}
+	if err := s.validator.EnsureNotLastSystemAdmin(ctx, userID, "不能停用最后一个系统管理员"); err != nil {
+		return err
+	}
 
 	user.Deactivate()
-	return s.userRepo.Update(ctx, user)
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, userID, &iamevent.UserDeactivated{
+		UserID:        userID,
+		DeactivatedAt: user.UpdatedAt,
+	})
+	return nil
 }
 
 // LockUser 锁定用户
@@ -325,9 +623,21 @@ func (s *UserService) LockUser(ctx context.Context, userID int64) error {
 	if err != nil {
 		return err
 	}
+	if err := s.validator.EnsureNotLastSystemAdmin(ctx, userID, "不能锁定最后一个系统管理员"); err != nil {
+		return err
+	}
 
 	user.Lock()
-	return s.userRepo.Update(ctx, user)
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, userID, &iamevent.UserLocked{
+		UserID:   userID,
+		Reason:   iamentity.LockReasonManual,
+		LockedAt: *user.LockAt,
+	})
+	return nil
 }
 
 // UnlockUser 解锁用户
@@ -338,125 +648,819 @@ func (s *UserService) UnlockUser(ctx context.Context, userID int64) error {
 	}
 
 	user.Unlock()
-	return s.userRepo.Update(ctx, user)
-}
-
-// AssignRole 为用户分配角色
-func (s *UserService) AssignRole(ctx context.Context, userID, roleID int64) error {
-	// 1. 检查用户是否存在
-	_, err := s.userRepo.GetByID(ctx, userID)
-	if err != nil {
+	if err := s.userRepo.Update(ctx, user); err != nil {
 		return err
 	}
-
-	// 2. 检查角色是否存在
-	_, err = s.roleRepo.GetByID(ctx, roleID)
-	if err != nil {
+	// 清除锁定原因（零值需显式更新）
+	if err := s.userRepo.UpdateLockInfo(ctx, userID, "", nil); err != nil {
 		return err
 	}
 
-	// 3. 分配角色
-	return s.userRepo.AssignRole(ctx, userID, roleID)
+	s.publishEvent(ctx, userID, &iamevent.UserUnlocked{
+		UserID:     userID,
+		UnlockedAt: user.UpdatedAt,
+	})
+	return nil
 }
 
-// RemoveRole 移除用户角色
-func (s *UserService) RemoveRole(ctx context.Context, userID, roleID int64) error {
-	return s.userRepo.RemoveRole(ctx, userID, roleID)
+// GetLockedUsers 获取当前处于锁定状态的用户及锁定原因（手动锁定或临时锁定未到期）
+//
+// 历史数据未记录原因时按状态推断：status 为 locked 视为手动锁定，否则视为登录失败自动锁定。
+func (s *UserService) GetLockedUsers(ctx context.Context) ([]*svc.LockedUser, error) {
+	users, err := s.userRepo.FindLocked(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*svc.LockedUser, 0, len(users))
+	for _, user := range users {
+		reason := user.LockReason
+		if reason == "" {
+			reason = iamentity.LockReasonFailedLogins
+			if user.IsLocked() {
+				reason = iamentity.LockReasonManual
+			}
+		}
+		result = append(result, &svc.LockedUser{
+			UserID:       user.GetID(),
+			Username:     user.Username,
+			Email:        user.Email,
+			Reason:       reason,
+			LockedAt:     user.LockAt,
+			LockoutUntil: user.LockoutUntil,
+		})
+	}
+	return result, nil
 }
 
-// AssignToGroup 将用户分配到组织
-func (s *UserService) AssignToGroup(ctx context.Context, userID, groupID int64) error {
-	// 1. 检查用户是否存在
-	_, err := s.userRepo.GetByID(ctx, userID)
+// recordLoginFailure 记录一次登录失败（密码或两步验证码错误），连续失败达到阈值后临时锁定并发布 UserLocked 事件
+func (s *UserService) recordLoginFailure(ctx context.Context, user *iamentity.User, now time.Time) error {
+	// 1. 数据库侧原子递增并读回计数（并发失败登录不会相互覆盖；到期的临时锁定重新计数）
+	count, err := s.userRepo.IncrementLoginFailures(ctx, user.GetID(), now)
 	if err != nil {
 		return err
 	}
+	prevReason := user.LockReason
+	if user.LockoutUntil != nil && !now.Before(*user.LockoutUntil) {
+		user.ResetFailedLogins()
+	}
 
-	// 2. 检查组织是否存在
-	_, err = s.groupRepo.GetByID(ctx, groupID)
-	if err != nil {
-		return err
+	// 2. 达到阈值时临时锁定
+	locked := user.ApplyFailedLoginCount(count, now, svc.LoginLockoutThreshold(), svc.LoginLockoutDuration())
+	if locked {
+		s.logger.Warn(ctx, "[UserService] 连续登录失败，账户已临时锁定",
+			logging.Int64("user_id", user.GetID()),
+			logging.String("username", user.Username),
+		)
+		if err := s.userRepo.UpdateLockoutUntil(ctx, user.GetID(), user.LockoutUntil); err != nil {
+			return err
+		}
+	}
+	if user.LockReason != prevReason {
+		s.updateLockInfo(ctx, user)
 	}
+	if locked {
+		s.publishEvent(ctx, user.GetID(), &iamevent.UserLocked{
+			UserID:   user.GetID(),
+			Reason:   iamentity.LockReasonFailedLogins,
+			LockedAt: now,
+			Until:    user.LockoutUntil,
+		})
+	}
+	return nil
+}
 
-	// 3. 分配到组织
-	return s.userRepo.AssignToGroup(ctx, userID, groupID)
+// resetLoginFailures 登录成功后清除登录失败计数与自动锁定（零值需显式更新，失败仅告警）
+func (s *UserService) resetLoginFailures(ctx context.Context, user *iamentity.User) {
+	if user.FailedLoginCount == 0 && user.LockoutUntil == nil {
+		return
+	}
+	prevReason := user.LockReason
+	user.ResetFailedLogins()
+	if err := s.userRepo.UpdateLoginFailures(ctx, user.GetID(), 0, nil); err != nil {
+		s.logger.Warn(ctx, "[UserService] 清除登录失败计数失败",
+			logging.Error(err),
+			logging.Int64("user_id", user.GetID()),
+		)
+	}
+	if user.LockReason != prevReason {
+		s.updateLockInfo(ctx, user)
+	}
 }
 
-// RemoveFromGroup 从组织中移除用户
-func (s *UserService) RemoveFromGroup(ctx context.Context, userID, groupID int64) error {
-	return s.userRepo.RemoveFromGroup(ctx, userID, groupID)
+// updateLockInfo 持久化锁定原因与时间（最佳努力：失败仅告警，不影响登录流程）
+func (s *UserService) updateLockInfo(ctx context.Context, user *iamentity.User) {
+	if err := s.userRepo.UpdateLockInfo(ctx, user.GetID(), user.LockReason, user.LockAt); err != nil {
+		s.logger.Warn(ctx, "[UserService] 更新锁定信息失败",
+			logging.Error(err),
+			logging.Int64("user_id", user.GetID()),
+		)
+	}
 }
 
-// GetUserPermissions 获取用户权限。
+// DeleteUser 删除用户（软删）
 //
-// 语义：
-// - 用户不存在：返回 NotFound；
-// - 用户非 active：返回错误（fail-close，避免禁用账号仍可参与鉴权/授权决策）。
-func (s *UserService) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
-	user, err := s.userRepo.GetByID(ctx, userID)
-	if err != nil {
-		return nil, err
+// 遵循 BusinessValidator.ValidateUserDeletion 的业务规则（不能删除最后一个系统管理员），
+// 删除后吊销该用户已签发的 token。
+func (s *UserService) DeleteUser(ctx context.Context, userID int64) error {
+	// 1. 业务规则校验
+	if err := s.validator.ValidateUserDeletion(ctx, userID); err != nil {
+		return err
 	}
-	if !user.IsActive() {
-		return nil, errorx.New(errorx.Forbidden, "用户账户已被禁用")
+
+	// 2. 软删
+	if err := s.userRepo.SoftDeleteByID(ctx, userID); err != nil {
+		return err
 	}
 
-	_, permissions, err := s.resolveEffectiveRolesAndPermissions(ctx, userID)
+	// 3. 吊销已签发的 token
+	iammw.RevokeUserTokens(userID)
+
+	s.logger.Info(ctx, "[UserService] delete user (soft)", logging.Int64("user_id", userID))
+	return nil
+}
+
+// RestoreUser 恢复软删的用户
+func (s *UserService) RestoreUser(ctx context.Context, userID int64) (*iamentity.User, error) {
+	user, err := s.userRepo.RestoreByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	return permissions, nil
+	s.logger.Info(ctx, "[UserService] restore user",
+		logging.Int64("user_id", user.GetID()),
+		logging.String("username", user.Username),
+	)
+	user.Password = ""
+	return user, nil
 }
 
-// CheckPermission 检查用户权限
-func (s *UserService) CheckPermission(ctx context.Context, userID int64, permission string) (bool, error) {
-	permissions, err := s.GetUserPermissions(ctx, userID)
+// BackfillCanonicalNames 回填存量用户的小写规范化用户名与邮箱，返回回填数量
+//
+// 查找、登录与查重按规范化列比较，升级后需先回填，否则存量用户无法按用户名/邮箱找到。
+func (s *UserService) BackfillCanonicalNames(ctx context.Context) (int64, error) {
+	return s.userRepo.BackfillCanonicalNames(ctx)
+}
+
+// PurgeUser 物理删除用户（硬删）
+//
+// 未软删的用户同样需满足删除业务规则；已软删的用户可直接清理。
+//
+// 角色/组织关联、历史密码与用户行在同一事务中删除，任一步失败整体回滚。
+func (s *UserService) PurgeUser(ctx context.Context, userID int64) (err error) {
+	// 1. 获取用户（包含软删记录）
+	user, err := s.userRepo.GetByIDWithDeleted(ctx, userID)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	for _, perm := range permissions {
-		if perm == permission {
-			return true, nil
+	// 2. 未软删时校验删除业务规则
+	if !user.IsDeleted() {
+		if err = s.validator.ValidateUserDeletion(ctx, userID); err != nil {
+			return err
 		}
 	}
 
-	return false, nil
-}
+	// 3. 开启事务
+	txCtx, err := s.userRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.userRepo.Rollback(txCtx)
+		}
+	}()
 
-// SearchUsers 搜索用户
-func (s *UserService) SearchUsers(ctx context.Context, keyword string, limit int) ([]*iamentity.User, error) {
-	return s.userRepo.SearchUsers(ctx, keyword, limit)
-}
+	// 4. 物理删除
+	if err = s.userRepo.PurgeByID(txCtx, userID); err != nil {
+		return err
+	}
+	if err = s.userRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	iammw.RevokeUserTokens(userID)
 
-// GetUsersByStatus 根据状态获取用户
-func (s *UserService) GetUsersByStatus(ctx context.Context, status string) ([]*iamentity.User, error) {
-	return s.userRepo.FindByStatus(ctx, status)
+	s.logger.Info(ctx, "[UserService] purge user (hard)",
+		logging.Int64("user_id", userID),
+		logging.String("username", user.Username),
+	)
+	return nil
 }
 
-// GetUserRoles 获取用户角色
-func (s *UserService) GetUserRoles(ctx context.Context, userID int64) ([]*iamentity.Role, error) {
-	return s.roleRepo.FindByUserID(ctx, userID)
+// AssignRole 为用户分配角色（永久、全局分配；已有的限时或限定组织范围的分配会转为永久、全局）
+//
+// 用户或角色不存在时返回 NotFound，并在错误上下文中以 resource（"user"/"role"）标明无效的 id；
+// 角色未激活时返回 Validation。成功后发布 UserRoleAssigned 事件。
+func (s *UserService) AssignRole(ctx context.Context, userID, roleID int64) error {
+	return s.assignRole(ctx, userID, roleID, nil, nil)
 }
 
-// GetUserGroups 获取用户所属组织
-func (s *UserService) GetUserGroups(ctx context.Context, userID int64) ([]*iamentity.Group, error) {
-	return s.groupRepo.FindByUserID(ctx, userID)
+// AssignRoleUntil 为用户分配限时角色（到期后不再计入有效角色与 token，可由 PurgeExpiredRoleAssignments 清理）
+//
+// expiresAt 必须晚于当前时间；对已持有的角色再次调用会覆盖其过期时间。错误语义同 AssignRole。
+func (s *UserService) AssignRoleUntil(ctx context.Context, userID, roleID int64, expiresAt time.Time) error {
+	if !expiresAt.After(time.Now()) {
+		return errorx.New(errorx.Validation, "过期时间必须晚于当前时间")
+	}
+	return s.assignRole(ctx, userID, roleID, &expiresAt, nil)
 }
 
-// GetUserProfile 获取包含关联数据的用户信息
-func (s *UserService) GetUserProfile(ctx context.Context, userID int64) (*iamentity.User, error) {
-	return s.userRepo.GetWithRelations(ctx, userID)
+// AssignRoleInGroup 为用户分配限定于组织范围的角色（永久分配）
+//
+// 该分配仅在 CheckPermissionInGroup 检查该组织或其子组织时生效，全局鉴权快照（登录/刷新 token、GetUserPermissions）仍计入。
+// 每个用户-角色仅有一条分配：对已持有的角色再次调用会覆盖其组织范围（AssignRole 则恢复为全局分配）。
+// 用户、角色或组织不存在时返回 NotFound，并在错误上下文中以 resource（"user"/"role"/"group"）标明无效的 id。
+func (s *UserService) AssignRoleInGroup(ctx context.Context, userID, roleID, groupID int64) error {
+	if s.groupRepo == nil {
+		return errorx.New(errorx.Internal, "组织仓储未配置")
+	}
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return svc.WithResourceContext(err, "group", groupID)
+	}
+	return s.assignRole(ctx, userID, roleID, nil, &groupID)
 }
 
-// BatchAssignToGroup 批量将用户加入组织
-func (s *UserService) BatchAssignToGroup(ctx context.Context, groupID int64, userIDs []int64) (*svc.BatchOperationResponse, error) {
-	response := &svc.BatchOperationResponse{}
+// assignRole 分配角色并设置过期时间与组织范围（expiresAt 为 nil 表示永久分配，groupID 为 nil 表示全局分配）
+func (s *UserService) assignRole(ctx context.Context, userID, roleID int64, expiresAt *time.Time, groupID *int64) (err error) {
+	// 1. 检查用户是否存在
+	if _, err = s.userRepo.GetByID(ctx, userID); err != nil {
+		return svc.WithResourceContext(err, "user", userID)
+	}
 
-	for _, userID := range userIDs {
-		if err := s.AssignToGroup(ctx, userID, groupID); err != nil {
-			response.FailureCount++
-			response.Errors = append(response.Errors, err)
+	// 2. 检查角色是否存在且已激活
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return svc.WithResourceContext(err, "role", roleID)
+	}
+	if role.Status != svc.RoleStatusActive {
+		return errorx.New(errorx.Validation, "只能分配激活状态的角色")
+	}
+
+	// 3. 开启事务：分配、过期时间与组织范围同时生效，避免限时/限定范围的授权退化为永久/全局授权
+	txCtx, err := s.userRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.userRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 4. 分配角色并设置过期时间与组织范围
+	if err = s.userRepo.AssignRole(txCtx, userID, roleID); err != nil {
+		return err
+	}
+	if err = s.userRepo.SetRoleExpiry(txCtx, userID, roleID, expiresAt); err != nil {
+		return err
+	}
+	if err = s.userRepo.SetRoleGroupScope(txCtx, userID, roleID, groupID); err != nil {
+		return err
+	}
+	// 显式分配视为直接分配：即使此前由组织默认角色授予，离开组织时也不再回收
+	if err = s.userRepo.SetRoleSourceGroup(txCtx, userID, roleID, nil); err != nil {
+		return err
+	}
+	if err = s.userRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	svc.InvalidateUserPermissionCache(userID)
+
+	// 5. 记录角色变更并发布用户角色分配事件（最佳努力，不影响主流程）
+	svc.RecordRoleChange(ctx, s.userRepo, s.logger, userID, roleID, role.Name, iamentity.RoleChangeGranted)
+	s.publishEvent(ctx, userID, &iamevent.UserRoleAssigned{
+		UserID:     userID,
+		RoleID:     roleID,
+		RoleCode:   role.Code,
+		AssignedAt: time.Now(),
+	})
+	return nil
+}
+
+// PurgeExpiredRoleAssignments 清理已过期的限时角色分配（供定时清理任务调用），返回清理数量
+//
+// 过期分配在清理前已不计入有效角色；清理时为每条分配记录一次角色移除变更（最佳努力）。
+func (s *UserService) PurgeExpiredRoleAssignments(ctx context.Context) (int, error) {
+	expired, err := s.roleRepo.PurgeExpiredUserRoles(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	for _, assignment := range expired {
+		svc.InvalidateUserPermissionCache(assignment.UserID)
+		var roleName string
+		if role, err := s.roleRepo.GetByID(ctx, assignment.RoleID); err == nil {
+			roleName = role.Name
+		}
+		svc.RecordRoleChange(ctx, s.userRepo, s.logger, assignment.UserID, assignment.RoleID, roleName, iamentity.RoleChangeRevoked)
+	}
+	return len(expired), nil
+}
+
+// RemoveRole 移除用户角色
+//
+// 不允许移除最后一个可用系统管理员的 system_admin 角色（Validation）；成功后发布 UserRoleRemoved 事件。
+func (s *UserService) RemoveRole(ctx context.Context, userID, roleID int64) error {
+	// 1. 保护最后一个系统管理员（角色已删除时名称为空，跳过）
+	var roleName string
+	if role, err := s.roleRepo.GetByID(ctx, roleID); err == nil {
+		roleName = role.Name
+	}
+	if roleName == svc.SystemAdminRoleName {
+		if err := s.validator.EnsureNotLastSystemAdmin(ctx, userID, "不能移除最后一个系统管理员的管理员角色"); err != nil {
+			return err
+		}
+	}
+
+	// 2. 移除角色
+	if err := s.userRepo.RemoveRole(ctx, userID, roleID); err != nil {
+		return err
+	}
+	svc.InvalidateUserPermissionCache(userID)
+
+	// 3. 记录角色变更并发布用户角色移除事件（最佳努力）
+	svc.RecordRoleChange(ctx, s.userRepo, s.logger, userID, roleID, roleName, iamentity.RoleChangeRevoked)
+	s.publishEvent(ctx, userID, &iamevent.UserRoleRemoved{
+		UserID:    userID,
+		RoleID:    roleID,
+		RemovedAt: time.Now(),
+	})
+	return nil
+}
+
+// GetMyAccessChanges 获取用户自身近期的角色授予/移除记录（按时间倒序）
+//
+// since 为零值时默认最近 30 天；最多返回 100 条。仅包含直接授予/移除用户角色的变更。
+func (s *UserService) GetMyAccessChanges(ctx context.Context, userID int64, since time.Time) ([]*iamentity.UserRoleChange, error) {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询变更记录
+	if since.IsZero() {
+		since = time.Now().Add(-defaultAccessChangesWindow)
+	}
+	return s.userRepo.FindRoleChanges(ctx, userID, since, maxAccessChanges)
+}
+
+// AssignToGroup 将用户分配到组织
+func (s *UserService) AssignToGroup(ctx context.Context, userID, groupID int64) error {
+	// 1. 检查用户是否存在
+	_, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// 2. 检查组织是否存在
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	// 3. 分配到组织（开启默认角色同步时同一事务内授予，见 svc.SetSyncGroupDefaultRoles）
+	if err := svc.JoinGroup(ctx, s.userRepo, s.groupRepo, s.roleRepo, s.logger, groupID, userID); err != nil {
+		return err
+	}
+	svc.InvalidateUserPermissionCache(userID)
+
+	// 4. 记录成员变更（最佳努力，不影响主流程）
+	s.recordGroupChange(ctx, userID, groupID, group.Name, iamentity.GroupMembershipJoined)
+	return nil
+}
+
+// RemoveFromGroup 从组织中移除用户
+func (s *UserService) RemoveFromGroup(ctx context.Context, userID, groupID int64) error {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	// 2. 移出组织（开启默认角色同步时同一事务内回收）
+	if err := svc.LeaveGroup(ctx, s.userRepo, s.groupRepo, s.roleRepo, s.logger, groupID, userID); err != nil {
+		return err
+	}
+	svc.InvalidateUserPermissionCache(userID)
+
+	// 3. 记录成员变更（最佳努力；组织已删除时名称为空）
+	var groupName string
+	if group, err := s.groupRepo.GetByID(ctx, groupID); err == nil {
+		groupName = group.Name
+	}
+	s.recordGroupChange(ctx, userID, groupID, groupName, iamentity.GroupMembershipLeft)
+	return nil
+}
+
+// GetGroupMembershipHistory 获取用户加入/离开组织的历史记录（按时间正序）
+func (s *UserService) GetGroupMembershipHistory(ctx context.Context, userID int64) ([]*iamentity.UserGroupChange, error) {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询变更记录
+	return s.userRepo.FindGroupChanges(ctx, userID)
+}
+
+// recordGroupChange 记录用户组织成员变更（失败仅告警）
+func (s *UserService) recordGroupChange(ctx context.Context, userID, groupID int64, groupName, action string) {
+	change := &iamentity.UserGroupChange{
+		UserID:    userID,
+		GroupID:   groupID,
+		GroupName: groupName,
+		Action:    action,
+		ChangedAt: time.Now(),
+	}
+	if err := s.userRepo.RecordGroupChange(ctx, change); err != nil {
+		s.logger.Warn(ctx, "[UserService] 记录组织成员变更失败",
+			logging.Error(err),
+			logging.Int64("user_id", userID),
+			logging.Int64("group_id", groupID),
+			logging.String("action", action),
+		)
+	}
+}
+
+// AddToTenant 将用户加入租户
+func (s *UserService) AddToTenant(ctx context.Context, userID, tenantID int64) error {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return err
+	}
+
+	// 2. 检查租户是否存在
+	if _, err := s.tenantRepo.GetByID(ctx, tenantID); err != nil {
+		return err
+	}
+
+	// 3. 加入租户
+	return s.tenantRepo.AddMember(ctx, tenantID, userID)
+}
+
+// RemoveFromTenant 将用户移出租户
+func (s *UserService) RemoveFromTenant(ctx context.Context, userID, tenantID int64) error {
+	return s.tenantRepo.RemoveMember(ctx, tenantID, userID)
+}
+
+// GetUserTenants 获取用户可访问的租户（用于租户切换）
+//
+// 仅返回用户所属且处于 active 状态的租户，按租户 ID 升序。
+func (s *UserService) GetUserTenants(ctx context.Context, userID int64) ([]*iamentity.Tenant, error) {
+	// 1. 检查用户是否存在
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// 2. 查询成员关系并过滤未启用租户
+	tenants, err := s.tenantRepo.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	accessible := make([]*iamentity.Tenant, 0, len(tenants))
+	for _, tenant := range tenants {
+		if tenant != nil && tenant.IsActive() {
+			accessible = append(accessible, tenant)
+		}
+	}
+	return accessible, nil
+}
+
+// IsTenantMember 判断用户是否属于租户（tenantKey 为租户业务编码；仅计入 active 租户）
+//
+// 供 middleware.SetTenantMembershipChecker 使用：不属于任何租户的用户经租户头切换租户前须通过该校验。
+func (s *UserService) IsTenantMember(ctx context.Context, userID int64, tenantKey string) (bool, error) {
+	tenants, err := s.GetUserTenants(ctx, userID)
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, tenant := range tenants {
+		if tenant.Key == tenantKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetUserPermissions 获取用户权限。
+//
+// 语义：
+// - 用户不存在：返回 NotFound；
+// - 用户非 active：返回 Forbidden（fail-close，避免禁用账号仍可参与鉴权/授权决策，提示按状态区分）；
+// - 返回结果去重并按字典序排序，与角色分配顺序无关（便于客户端比对与缓存）。
+func (s *UserService) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive() {
+		return nil, svc.InactiveUserError(user)
+	}
+
+	_, permissions, err := s.resolveEffectiveRolesAndPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// CheckPermission 检查用户权限（持有的 `resource:*`、`*:*`、`*` 通配符权限覆盖对应权限）
+//
+// 用户非 active 时返回 (false, Forbidden) 而非 (false, nil)，调用方可据此区分“无权限”与“账号不可用”。
+func (s *UserService) CheckPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	permissions, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return auth.HasPermission(permissions, permission), nil
+}
+
+// CheckPermissions 批量检查用户权限：有效权限只解析一次，逐项按通配符规则判断（同 CheckPermission）
+//
+// 返回以请求权限为键的结果；重复项合并，空权限返回 Validation 错误。
+func (s *UserService) CheckPermissions(ctx context.Context, userID int64, permissions []string) (map[string]bool, error) {
+	for _, permission := range permissions {
+		if strings.TrimSpace(permission) == "" {
+			return nil, errorx.New(errorx.Validation, "权限不能为空")
+		}
+	}
+
+	held, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		result[permission] = auth.HasPermission(held, permission)
+	}
+	return result, nil
+}
+
+// CheckPermissionInGroup 检查用户在指定组织范围内是否拥有权限
+//
+// 仅计入全局分配的角色、限定于该组织或其祖先组织的角色，以及该组织或其祖先组织中为用户提供的默认角色；
+// 限定于其他组织的角色分配与范围外组织的默认角色不生效。用户非 active 时返回错误，组织不存在时返回 NotFound（resource=group）。
+func (s *UserService) CheckPermissionInGroup(ctx context.Context, userID int64, permission string, groupID int64) (bool, error) {
+	// 1. 检查用户状态
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return false, svc.WithResourceContext(err, "user", userID)
+	}
+	if !user.IsActive() {
+		return false, svc.InactiveUserError(user)
+	}
+
+	// 2. 计算组织范围（该组织及其祖先组织）
+	if s.groupRepo == nil {
+		return false, errorx.New(errorx.Internal, "组织仓储未配置")
+	}
+	if _, err := s.groupRepo.GetByID(ctx, groupID); err != nil {
+		return false, svc.WithResourceContext(err, "group", groupID)
+	}
+	scope := []int64{groupID}
+	inScope := map[int64]struct{}{groupID: {}}
+	ancestors, err := s.groupRepo.FindAncestors(ctx, groupID)
+	if err != nil {
+		return false, err
+	}
+	for _, ancestor := range ancestors {
+		scope = append(scope, ancestor.GetID())
+		inScope[ancestor.GetID()] = struct{}{}
+	}
+
+	// 3. 汇总范围内生效的角色与权限（默认角色仅计入范围内组织提供的部分）
+	roles, err := s.roleRepo.FindByUserIDInGroupScope(ctx, userID, scope)
+	if err != nil {
+		return false, err
+	}
+	grantingGroupIDs, err := s.findRoleGrantingGroupIDs(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	scopedGroupIDs := make([]int64, 0, len(grantingGroupIDs))
+	for _, id := range grantingGroupIDs {
+		if _, ok := inScope[id]; ok {
+			scopedGroupIDs = append(scopedGroupIDs, id)
+		}
+	}
+	groupRoles, err := s.roleRepo.FindByGroupIDs(ctx, scopedGroupIDs)
+	if err != nil {
+		return false, err
+	}
+	_, permissions, err := s.collectRolesAndPermissions(ctx, append(roles, groupRoles...))
+	if err != nil {
+		return false, err
+	}
+	return auth.HasPermission(permissions, permission), nil
+}
+
+// GetUserRoleNames 获取用户有效角色名称（已去重、排序）
+//
+// 与 GetUserRoles 不同，仅返回 active 角色的名称，适用于导航栏徽标等轻量场景。
+func (s *UserService) GetUserRoleNames(ctx context.Context, userID int64) ([]string, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	roleNames, _, err := s.resolveEffectiveRolesAndPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return roleNames, nil
+}
+
+// CheckAvailability 检查用户名/邮箱是否可用于注册
+//
+// 仅做 COUNT 查询，适合注册表单实时校验；空值视为不可用（未提供或无法注册）。
+func (s *UserService) CheckAvailability(ctx context.Context, username, email string) (usernameAvailable, emailAvailable bool, err error) {
+	// 1. 检查用户名
+	if strings.TrimSpace(username) != "" {
+		taken, err := s.userRepo.ExistsByUsername(ctx, username)
+		if err != nil {
+			return false, false, err
+		}
+		usernameAvailable = !taken
+	}
+
+	// 2. 检查邮箱
+	if strings.TrimSpace(email) != "" {
+		taken, err := s.userRepo.ExistsByEmail(ctx, email)
+		if err != nil {
+			return false, false, err
+		}
+		emailAvailable = !taken
+	}
+
+	return usernameAvailable, emailAvailable, nil
+}
+
+// SearchUsers 搜索用户
+func (s *UserService) SearchUsers(ctx context.Context, keyword string, limit int) ([]*iamentity.User, error) {
+	return s.userRepo.SearchUsers(ctx, keyword, limit)
+}
+
+// GetUsersByStatus 根据状态获取用户
+func (s *UserService) GetUsersByStatus(ctx context.Context, status string) ([]*iamentity.User, error) {
+	return s.userRepo.FindByStatus(ctx, status)
+}
+
+// SearchUsersPaged 分页搜索用户（用于管理端列表）
+//
+// 默认仅返回 active 且未软删除的用户（见 svc.ListOptions）；结果按 ID 升序，返回的用户已清除密码字段，
+// total 为满足关键字与可见性条件的总数。
+func (s *UserService) SearchUsersPaged(ctx context.Context, keyword string, opts svc.ListOptions, offset, limit int) ([]*iamentity.User, int64, error) {
+	// 1. 校验参数
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+
+	// 2. 查询
+	users, total, err := s.userRepo.SearchUsersPaged(ctx, strings.TrimSpace(keyword), opts.IncludeInactive, opts.IncludeDeleted, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 3. 清除敏感字段
+	for _, user := range users {
+		if user != nil {
+			user.Password = ""
+		}
+	}
+	return users, total, nil
+}
+
+// GetUsersByStatusPaged 分页获取指定状态的用户（用于管理端列表）
+//
+// 结果按 ID 升序，返回的用户已清除密码字段，total 为该状态的用户总数。
+func (s *UserService) GetUsersByStatusPaged(ctx context.Context, status string, offset, limit int) ([]*iamentity.User, int64, error) {
+	// 1. 校验参数
+	if !isValidUserStatus(status) {
+		return nil, 0, errorx.New(errorx.Validation, "无效的用户状态")
+	}
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+
+	// 2. 统计与查询
+	total, err := s.userRepo.CountByStatusValue(ctx, status)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, err := s.userRepo.FindByStatusLite(ctx, status, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 3. 清除敏感字段
+	for _, user := range users {
+		if user != nil {
+			user.Password = ""
+		}
+	}
+	return users, total, nil
+}
+
+// GetUsersWithExpiringPasswords 获取密码将在 within 时长内过期的 active 用户（含已过期，用于提前通知）
+//
+// 过期规则见 svc.PasswordMaxAge；未启用密码过期时返回空列表。返回的用户已清除密码字段。
+func (s *UserService) GetUsersWithExpiringPasswords(ctx context.Context, within time.Duration) ([]*iamentity.User, error) {
+	// 1. 校验参数
+	if within < 0 {
+		return nil, errorx.New(errorx.Validation, "时间范围不能为负数")
+	}
+
+	// 2. 查询
+	users, err := s.userRepo.FindPasswordsExpiringBefore(ctx, time.Now().Add(within), svc.PasswordMaxAge())
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 清除敏感字段
+	for _, user := range users {
+		if user != nil {
+			user.Password = ""
+		}
+	}
+	return users, nil
+}
+
+// GetProfileIncompleteUsers 获取资料不完整（未设置头像）的用户
+//
+// statuses 用于按状态过滤（如仅提醒 active 用户），为空时不过滤；limit <= 0 表示不限制条数。
+func (s *UserService) GetProfileIncompleteUsers(ctx context.Context, limit int, statuses ...string) ([]*iamentity.User, error) {
+	return s.userRepo.FindWithEmptyAvatar(ctx, limit, statuses...)
+}
+
+// CountRegistrationsSince 统计指定时间之后注册的用户数量
+func (s *UserService) CountRegistrationsSince(ctx context.Context, since time.Time) (int64, error) {
+	return s.userRepo.CountCreatedSince(ctx, since)
+}
+
+// GetUsersByCreatedRange 分页获取注册时间位于 [from, to) 区间内的用户（用于管理端导出）
+//
+// status 为空时不按状态过滤；返回的用户已清除密码字段，total 为满足条件的总数。
+func (s *UserService) GetUsersByCreatedRange(ctx context.Context, from, to time.Time, status string, offset, limit int) ([]*iamentity.User, int64, error) {
+	// 1. 校验参数
+	if from.IsZero() || to.IsZero() || !from.Before(to) {
+		return nil, 0, errorx.New(errorx.Validation, "时间范围无效：需满足 from < to")
+	}
+	if offset < 0 || limit < 0 {
+		return nil, 0, errorx.New(errorx.Validation, "分页参数不能为负数")
+	}
+	if status != "" && !isValidUserStatus(status) {
+		return nil, 0, errorx.New(errorx.Validation, "无效的用户状态")
+	}
+
+	// 2. 查询
+	users, total, err := s.userRepo.FindByCreatedRange(ctx, from, to, status, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 3. 清除敏感字段
+	for _, user := range users {
+		if user != nil {
+			user.Password = ""
+		}
+	}
+	return users, total, nil
+}
+
+// isValidUserStatus 判断是否为已知的用户状态
+func isValidUserStatus(status string) bool {
+	switch status {
+	case svc.UserStatusActive, svc.UserStatusInactive, svc.UserStatusLocked, svc.UserStatusPending:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetUserRoles 获取用户角色
+func (s *UserService) GetUserRoles(ctx context.Context, userID int64) ([]*iamentity.Role, error) {
+	return s.roleRepo.FindByUserID(ctx, userID)
+}
+
+// GetUserGroups 获取用户所属组织
+func (s *UserService) GetUserGroups(ctx context.Context, userID int64) ([]*iamentity.Group, error) {
+	return s.groupRepo.FindByUserID(ctx, userID)
+}
+
+// GetUserProfile 获取包含关联数据的用户信息
+func (s *UserService) GetUserProfile(ctx context.Context, userID int64) (*iamentity.User, error) {
+	return s.userRepo.GetWithRelations(ctx, userID)
+}
+
+// BatchAssignToGroup 批量将用户加入组织
+func (s *UserService) BatchAssignToGroup(ctx context.Context, groupID int64, userIDs []int64) (*svc.BatchOperationResponse, error) {
+	response := &svc.BatchOperationResponse{}
+
+	for _, userID := range userIDs {
+		if err := s.AssignToGroup(ctx, userID, groupID); err != nil {
+			response.FailureCount++
+			response.Errors = append(response.Errors, err)
 		} else {
 			response.SuccessCount++
 		}
@@ -465,6 +1469,39 @@ func (s *UserService) BatchAssignToGroup(ctx context.Context, groupID int64, use
 	return response, nil
 }
 
+// BulkRegister 批量注册用户，返回汇总结果与按请求下标对应的逐行结果。
+//
+// 每行独立调用 Register（各自完成校验、查重与写入）：某行校验失败、用户名/邮箱重复
+// 或写库失败只记录到该行，不中断批次，也不影响已成功的行；批次内后出现的重复行同样被拒绝。
+func (s *UserService) BulkRegister(ctx context.Context, reqs []*svc.RegisterRequest) (*svc.BatchOperationResponse, []*svc.BulkRegisterResult, error) {
+	response := &svc.BatchOperationResponse{}
+	results := make([]*svc.BulkRegisterResult, len(reqs))
+
+	for i, req := range reqs {
+		result := &svc.BulkRegisterResult{Index: i}
+		results[i] = result
+
+		var user *iamentity.User
+		var err error = errorx.New(errorx.Validation, "请求不能为空")
+		if req != nil {
+			result.Username = req.Username
+			user, err = s.Register(ctx, req)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			response.FailureCount++
+			response.Errors = append(response.Errors, err)
+			continue
+		}
+
+		result.Success = true
+		result.UserID = user.GetID()
+		response.SuccessCount++
+	}
+
+	return response, results, nil
+}
+
 // 私有辅助方法
 
 // validateRegisterRequest 验证注册请求
@@ -478,42 +1515,154 @@ func (s *UserService) validateRegisterRequest(req *svc.RegisterRequest) error {
 	if req.Email == "" {
 		return errorx.New(errorx.Validation, "邮箱不能为空")
 	}
-	if req.Password == "" {
-		return errorx.New(errorx.Validation, "密码不能为空")
-	}
-	if len(req.Password) < 8 {
-		return errorx.New(errorx.Validation, "密码长度不能少于8个字符")
-	}
-	// 可选：添加更强的密码策略
-	// - 至少包含一个大写字母
-	// - 至少包含一个小写字母
-	// - 至少包含一个数字
-	return nil
+	return svc.ValidatePassword(req.Password)
 }
 
 // hashPassword 加密密码
 // 使用 bcrypt 算法，自动加盐，防止彩虹表攻击
 func (s *UserService) hashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.currentBcryptCost())
 	if err != nil {
 		return "", fmt.Errorf("hash password: %w", err)
 	}
 	return string(hash), nil
 }
 
+// needsRehash 判断已存储哈希的成本是否低于当前配置
+func (s *UserService) needsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return false
+	}
+	return cost < s.currentBcryptCost()
+}
+
+func (s *UserService) currentBcryptCost() int {
+	if s.bcryptCost <= 0 {
+		return bcrypt.DefaultCost
+	}
+	return s.bcryptCost
+}
+
 // verifyPassword 验证密码
 func (s *UserService) verifyPassword(password, hashedPassword string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
 
+// checkPasswordReuse 校验新密码不得与最近 N 个密码相同（当前密码计入 N，另比对最近 N-1 个历史密码；N 见 svc.PasswordHistorySize，0 表示不启用）
+func (s *UserService) checkPasswordReuse(ctx context.Context, user *iamentity.User, candidate string) error {
+	size := svc.PasswordHistorySize()
+	if size <= 0 {
+		return nil
+	}
+	var hashes []string
+	if size > 1 {
+		var err error
+		hashes, err = s.userRepo.FindRecentPasswordHashes(ctx, user.GetID(), size-1)
+		if err != nil {
+			return err
+		}
+	}
+	for _, hash := range append([]string{user.Password}, hashes...) {
+		if hash != "" && s.verifyPassword(candidate, hash) {
+			return errorx.New(errorx.Validation, fmt.Sprintf("新密码不能与最近%d次使用过的密码相同", size))
+		}
+	}
+	return nil
+}
+
+// recordPasswordHistory 记录被替换的旧密码哈希，并裁剪超出 N-1 条的历史（当前密码计入 N；最佳努力，失败仅告警）
+func (s *UserService) recordPasswordHistory(ctx context.Context, userID int64, previousHash string) {
+	keep := svc.PasswordHistorySize() - 1
+	if keep <= 0 || previousHash == "" {
+		return
+	}
+	if err := s.userRepo.AddPasswordHistory(ctx, userID, previousHash); err != nil {
+		s.logger.Warn(ctx, "[UserService] 记录历史密码失败", logging.Error(err), logging.Int64("user_id", userID))
+		return
+	}
+	if err := s.userRepo.PrunePasswordHistory(ctx, userID, keep); err != nil {
+		s.logger.Warn(ctx, "[UserService] 清理历史密码失败", logging.Error(err), logging.Int64("user_id", userID))
+	}
+}
+
+// publishEvent 发布用户生命周期事件（未配置事件总线时忽略；失败仅告警，不影响主流程）
+func (s *UserService) publishEvent(ctx context.Context, userID int64, payload interface{ GetType() string }) {
+	if s.eventBus == nil {
+		return
+	}
+
+	evt := eventing.NewEvent(userID, "user", payload.GetType(), 1, payload)
+	if err := s.eventBus.PublishEvent(ctx, evt); err != nil {
+		s.logger.Warn(ctx, "[UserService] 发布 "+payload.GetType()+" 事件失败",
+			logging.Error(err),
+			logging.Int64("user_id", userID),
+		)
+	}
+}
+
 // assignDefaultRole 分配默认角色
 func (s *UserService) assignDefaultRole(ctx context.Context, userID int64) error {
 	// 查找默认用户角色
-	role, err := s.roleRepo.FindByName(ctx, svc.UserRoleName)
+	role, err := s.findDefaultRole(ctx)
 	if err != nil {
 		return err
 	}
 
 	return s.userRepo.AssignRole(ctx, userID, role.GetID())
 }
+
+// createUserWithDefaultRole 在同一事务内创建用户并分配默认角色（严格模式）
+func (s *UserService) createUserWithDefaultRole(ctx context.Context, user *iamentity.User) (err error) {
+	// 1. 查找默认角色
+	role, err := s.findDefaultRole(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 2. 开启事务
+	txCtx, err := s.userRepo.BeginTx(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启事务失败")
+	}
+	defer func() {
+		if err != nil {
+			_ = s.userRepo.Rollback(txCtx)
+		}
+	}()
+
+	// 3. 保存用户并分配默认角色
+	if err = s.userRepo.Create(txCtx, user); err != nil {
+		if errorx.Is(err, errorx.Validation) {
+			return err
+		}
+		return errorx.Wrap(err, errorx.Database, "保存用户失败")
+	}
+	if err = s.userRepo.AssignRole(txCtx, user.GetID(), role.GetID()); err != nil {
+		return errorx.Wrap(err, errorx.Database, "分配默认角色失败")
+	}
+	if err = s.userRepo.Commit(txCtx); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交事务失败")
+	}
+	return nil
+}
+
+// findDefaultRole 查找配置的默认角色（见 svc.DefaultRoleName），不存在时返回 Internal 错误
+func (s *UserService) findDefaultRole(ctx context.Context) (*iamentity.Role, error) {
+	name := svc.DefaultRoleName()
+	role, err := s.roleRepo.FindByName(ctx, name)
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, errorx.New(errorx.Internal, "默认角色不存在: "+name).WithContext("role", name)
+		}
+		return nil, err
+	}
+	return role, nil
+}
+
+// ValidateDefaultRole 校验配置的默认角色存在（启动期调用，见 svc.DefaultRoleName）
+func (s *UserService) ValidateDefaultRole(ctx context.Context) error {
+	_, err := s.findDefaultRole(ctx)
+	return err
+}
@@ -2,19 +2,35 @@ package user_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	iamentity "gochen-iam/entity"
+	iamevent "gochen-iam/event"
+	iammw "gochen-iam/middleware"
 	grouprepo "gochen-iam/repo/group"
 	rolerepo "gochen-iam/repo/role"
+	tenantrepo "gochen-iam/repo/tenant"
 	userrepo "gochen-iam/repo/user"
 	svc "gochen-iam/service"
 	groupsvc "gochen-iam/service/group"
+	rolesvc "gochen-iam/service/role"
 	usersvc "gochen-iam/service/user"
 
+	"github.com/golang-jwt/jwt/v4"
 	"gochen/errorx"
+	"gochen/eventing"
+	"gochen/eventing/bus"
+	"gochen/httpx"
+	"gochen/metadata"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -27,6 +43,7 @@ type userServiceTestEnv struct {
 	userRepo      *userrepo.UserRepo
 	groupRepo     *grouprepo.GroupRepo
 	roleRepo      *rolerepo.RoleRepo
+	tenantRepo    *tenantrepo.TenantRepo
 	backgroundCtx context.Context
 	cancelFunc    context.CancelFunc
 }
@@ -54,6 +71,15 @@ func setupUserServiceTest(t *testing.T) *userServiceTestEnv {
 		&iamentity.User{},
 		&iamentity.Group{},
 		&iamentity.Role{},
+		&iamentity.UserGroup{},
+		&iamentity.UserRoleAssignment{},
+		&iamentity.RolePermissionEvent{},
+		&iamentity.PasswordHistory{},
+		&iamentity.Tenant{},
+		&iamentity.UserTenant{},
+		&iamentity.UserRoleChange{},
+		&iamentity.UserGroupChange{},
+		&iamentity.UsernameHistory{},
 	); err != nil {
 		t.Fatalf("auto migrate: %v", err)
 	}
@@ -71,11 +97,18 @@ func setupUserServiceTest(t *testing.T) *userServiceTestEnv {
 	if err != nil {
 		t.Fatalf("NewRoleRepository: %v", err)
 	}
+	tenantRepo, err := tenantrepo.NewTenantRepository(ormAdapter)
+	if err != nil {
+		t.Fatalf("NewTenantRepository: %v", err)
+	}
 
 	// 创建服务
-	userService := usersvc.NewUserService(userRepo, groupRepo, roleRepo)
+	userService := usersvc.NewUserService(userRepo, groupRepo, roleRepo, tenantRepo, nil)
 	groupService := groupsvc.NewGroupService(groupRepo, userRepo, roleRepo)
 
+	// 隔离 token 吊销状态（按用户 ID 记录，避免跨用例串扰）
+	iammw.SetDefaultTokenRevoker(iammw.NewMemoryTokenRevoker())
+
 	// 创建背景上下文
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 
@@ -86,6 +119,7 @@ func setupUserServiceTest(t *testing.T) *userServiceTestEnv {
 		userRepo:      userRepo,
 		groupRepo:     groupRepo,
 		roleRepo:      roleRepo,
+		tenantRepo:    tenantRepo,
 		backgroundCtx: ctx,
 		cancelFunc:    cancel,
 	}
@@ -228,6 +262,261 @@ func TestUserServiceRegister(t *testing.T) {
 	}
 }
 
+// TestUserServicePasswordPolicy 测试注册与修改密码应用密码策略
+func TestUserServicePasswordPolicy(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	t.Setenv("AUTH_PASSWORD_REQUIRE_DIGIT", "true")
+	t.Setenv("AUTH_PASSWORD_REQUIRE_UPPER", "true")
+
+	_, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "policy_user",
+		Email:    "policy@example.com",
+		Password: "Passwordxx",
+	})
+	if !errorx.Is(err, errorx.Validation) || !strings.Contains(err.Error(), "密码必须包含数字") {
+		t.Fatalf("expected digit rule violation on register, got %v", err)
+	}
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "policy_user",
+		Email:    "policy@example.com",
+		Password: "Password1",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	err = env.userService.ChangePassword(env.backgroundCtx, user.GetID(), &svc.ChangePasswordRequest{
+		OldPassword: "Password1",
+		NewPassword: "newpassword2",
+	})
+	if !errorx.Is(err, errorx.Validation) || !strings.Contains(err.Error(), "密码必须包含大写字母") {
+		t.Fatalf("expected upper rule violation on change password, got %v", err)
+	}
+	if err := env.userService.ChangePassword(env.backgroundCtx, user.GetID(), &svc.ChangePasswordRequest{
+		OldPassword: "Password1",
+		NewPassword: "NewPassword2",
+	}); err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+}
+
+// TestUserServicePasswordHistory 测试禁止重复使用最近 N 个密码
+func TestUserServicePasswordHistory(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	t.Setenv("AUTH_BCRYPT_COST", "4")
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "history_user",
+		Email:    "history@example.com",
+		Password: "password-a",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	change := func(oldPassword, newPassword string) error {
+		return env.userService.ChangePassword(env.backgroundCtx, user.GetID(), &svc.ChangePasswordRequest{
+			OldPassword: oldPassword,
+			NewPassword: newPassword,
+		})
+	}
+
+	// 默认不启用：可改回上一个密码
+	if err := change("password-a", "password-b"); err != nil {
+		t.Fatalf("change a->b: %v", err)
+	}
+	if err := change("password-b", "password-a"); err != nil {
+		t.Fatalf("expected reuse allowed when disabled, got %v", err)
+	}
+
+	t.Setenv("AUTH_PASSWORD_HISTORY_SIZE", "2")
+	for _, step := range [][2]string{{"password-a", "password-b"}, {"password-b", "password-c"}, {"password-c", "password-d"}} {
+		if err := change(step[0], step[1]); err != nil {
+			t.Fatalf("change %s->%s: %v", step[0], step[1], err)
+		}
+	}
+
+	// 最近 N=2 个密码（当前密码 + 1 个历史密码）均被拒绝
+	for _, reused := range []string{"password-d", "password-c"} {
+		if err := change("password-d", reused); !errorx.Is(err, errorx.Validation) {
+			t.Fatalf("expected reuse of %s rejected, got %v", reused, err)
+		}
+	}
+
+	// 历史仅保留 N-1 条（当前密码计入 N）
+	var count int64
+	if err := env.db.Model(&iamentity.PasswordHistory{}).Where("user_id = ?", user.GetID()).Count(&count).Error; err != nil {
+		t.Fatalf("count history: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("expected history pruned to 1 entry, got %d", count)
+	}
+
+	// 早于最近 N 个的密码允许再次使用
+	if err := change("password-d", "password-b"); err != nil {
+		t.Fatalf("expected password older than N allowed, got %v", err)
+	}
+}
+
+// TestUserServiceSessions 测试会话列表与指定会话吊销
+func TestUserServiceSessions(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	iammw.SetDefaultTokenRevoker(iammw.NewMemoryTokenRevoker())
+	defer iammw.SetDefaultTokenRevoker(nil)
+	iammw.SetDefaultSessionTracker(iammw.NewMemorySessionTracker())
+	defer iammw.SetDefaultSessionTracker(nil)
+
+	register := func(username string) *iamentity.User {
+		u, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		return u
+	}
+	user := register("session_user")
+	other := register("session_other")
+	config := &iammw.AuthConfig{SecretKey: "user-session-secret"}
+
+	login := func(userID int64, userAgent string) (access, refresh string) {
+		access, err := iammw.GenerateToken(userID, "session", nil, nil, config.SecretKey)
+		if err != nil {
+			t.Fatalf("GenerateToken failed: %v", err)
+		}
+		refresh, err = iammw.GenerateRefreshToken(userID, "session", config.SecretKey, 0)
+		if err != nil {
+			t.Fatalf("GenerateRefreshToken failed: %v", err)
+		}
+		if err := iammw.StartSession(access, refresh, iammw.SessionClient{UserAgent: userAgent, IP: "10.0.0.1"}, config); err != nil {
+			t.Fatalf("StartSession failed: %v", err)
+		}
+		return access, refresh
+	}
+	firstAccess, _ := login(user.GetID(), "laptop")
+	secondAccess, _ := login(user.GetID(), "phone")
+	login(other.GetID(), "other")
+
+	sessions, err := env.userService.ListSessions(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].UserAgent != "laptop" || sessions[1].UserAgent != "phone" || sessions[0].IP != "10.0.0.1" {
+		t.Fatalf("unexpected sessions: %+v", sessions)
+	}
+	if _, err := env.userService.ListSessions(env.backgroundCtx, 999999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+
+	// 不能吊销其他用户或不存在的会话
+	otherSessions, err := env.userService.ListSessions(env.backgroundCtx, other.GetID())
+	if err != nil || len(otherSessions) != 1 {
+		t.Fatalf("expected 1 session for other user, got %v (%v)", otherSessions, err)
+	}
+	if err := env.userService.RevokeSession(env.backgroundCtx, user.GetID(), otherSessions[0].ID); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for foreign session, got %v", err)
+	}
+	if err := env.userService.RevokeSession(env.backgroundCtx, user.GetID(), ""); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for empty jti, got %v", err)
+	}
+
+	// 吊销第一个会话：其访问令牌被拒绝，其他会话不受影响
+	if err := env.userService.RevokeSession(env.backgroundCtx, user.GetID(), sessions[0].ID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	remaining, err := env.userService.ListSessions(env.backgroundCtx, user.GetID())
+	if err != nil || len(remaining) != 1 || remaining[0].ID != sessions[1].ID {
+		t.Fatalf("expected only second session remaining, got %+v (%v)", remaining, err)
+	}
+	parse := func(token string) *iammw.JWTClaims {
+		claims, err := iammw.ParseToken(token, config.SecretKey)
+		if err != nil {
+			t.Fatalf("ParseToken failed: %v", err)
+		}
+		return claims
+	}
+	if !iammw.IsTokenRevoked(parse(firstAccess)) {
+		t.Fatal("expected revoked session's access token rejected")
+	}
+	if iammw.IsTokenRevoked(parse(secondAccess)) {
+		t.Fatal("expected other session's access token still valid")
+	}
+	if err := env.userService.RevokeSession(env.backgroundCtx, user.GetID(), sessions[0].ID); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for already revoked session, got %v", err)
+	}
+}
+
+// TestUserServiceBulkRegister 测试批量注册：逐行独立，重复与校验失败只记录不中断
+func TestUserServiceBulkRegister(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "bulk_existing",
+		Email:    "bulk_existing@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	reqs := []*svc.RegisterRequest{
+		{Username: "bulk_one", Email: "bulk_one@example.com", Password: "password123"},
+		{Username: "bulk_existing", Email: "bulk_other@example.com", Password: "password123"}, // 用户名已存在
+		{Username: "bulk_two", Email: "bulk_two@example.com", Password: "12345"},              // 密码太短
+		{Username: "bulk_three", Email: "bulk_one@example.com", Password: "password123"},      // 与批次内前一行邮箱重复
+		nil,
+		{Username: "bulk_four", Email: "bulk_four@example.com", Password: "password123"},
+	}
+	summary, results, err := env.userService.BulkRegister(env.backgroundCtx, reqs)
+	if err != nil {
+		t.Fatalf("BulkRegister failed: %v", err)
+	}
+	if summary.SuccessCount != 2 || summary.FailureCount != 4 || len(summary.Errors) != 4 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if len(results) != len(reqs) {
+		t.Fatalf("expected %d results, got %d", len(reqs), len(results))
+	}
+
+	for i, wantSuccess := range []bool{true, false, false, false, false, true} {
+		r := results[i]
+		if r.Index != i || r.Success != wantSuccess {
+			t.Fatalf("row %d: unexpected result %+v", i, r)
+		}
+		if wantSuccess {
+			if r.UserID == 0 || r.Error != "" {
+				t.Fatalf("row %d: expected created user id, got %+v", i, r)
+			}
+			user, err := env.userRepo.GetByID(env.backgroundCtx, r.UserID)
+			if err != nil || user.Username != reqs[i].Username {
+				t.Fatalf("row %d: expected persisted user %s, got %v (%v)", i, reqs[i].Username, user, err)
+			}
+			continue
+		}
+		if r.UserID != 0 || r.Error == "" {
+			t.Fatalf("row %d: expected failure detail, got %+v", i, r)
+		}
+	}
+	for _, e := range summary.Errors {
+		if !errorx.Is(e, errorx.Validation) {
+			t.Fatalf("expected Validation errors, got %v", e)
+		}
+	}
+
+	// 失败行未写入
+	if _, err := env.userRepo.FindByUsername(env.backgroundCtx, "bulk_two"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected failed row not persisted, got %v", err)
+	}
+}
+
 // TestUserServiceLogin 测试用户登录
 func TestUserServiceLogin(t *testing.T) {
 	env := setupUserServiceTest(t)
@@ -307,16 +596,20 @@ func TestUserServiceAuthPathsRejectDisabledUserAsForbidden(t *testing.T) {
 	tests := []struct {
 		name    string
 		disable func(ctx context.Context, userID int64) error
+		reason  string
 	}{
 		{
 			name:    "inactive",
 			disable: env.userService.DeactivateUser,
+			reason:  "account_inactive",
 		},
 		{
 			name:    "locked",
 			disable: env.userService.LockUser,
+			reason:  "account_locked",
 		},
 	}
+	messages := map[string]string{}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -344,6 +637,11 @@ func TestUserServiceAuthPathsRejectDisabledUserAsForbidden(t *testing.T) {
 			if !errorx.Is(err, errorx.Forbidden) {
 				t.Fatalf("expected forbidden error for authenticate/%s, got %v", tt.name, err)
 			}
+			var appErr *errorx.AppError
+			if !errors.As(err, &appErr) || appErr.Details()["reason"] != tt.reason {
+				t.Fatalf("expected reason %s for authenticate/%s, got %v", tt.reason, tt.name, err)
+			}
+			messages[tt.name] = appErr.Message()
 
 			_, err = env.userService.GetAuthSnapshot(env.backgroundCtx, user.GetID())
 			if err == nil {
@@ -352,8 +650,25 @@ func TestUserServiceAuthPathsRejectDisabledUserAsForbidden(t *testing.T) {
 			if !errorx.Is(err, errorx.Forbidden) {
 				t.Fatalf("expected forbidden error for snapshot/%s, got %v", tt.name, err)
 			}
+			if !errors.As(err, &appErr) || appErr.Message() != messages[tt.name] {
+				t.Fatalf("expected snapshot/%s message %q, got %v", tt.name, messages[tt.name], err)
+			}
 		})
 	}
+
+	// 不同状态的提示不同
+	if messages["inactive"] == "" || messages["inactive"] == messages["locked"] {
+		t.Fatalf("expected status-specific messages, got %v", messages)
+	}
+
+	// 凭证错误仍为 Validation（不泄露账户状态）
+	_, err := env.userService.Authenticate(env.backgroundCtx, &svc.AuthenticateRequest{
+		Username: "disabled_auth_locked",
+		Password: "wrong-password",
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected validation error for wrong password, got %v", err)
+	}
 }
 
 func TestUserServiceAuthSnapshotFiltersInactiveAndDeletedRoles(t *testing.T) {
@@ -469,6 +784,93 @@ func TestUserServiceAuthSnapshotFiltersInactiveAndDeletedRoles(t *testing.T) {
 	}
 }
 
+// TestUserServiceAuthSnapshotIncludesGroupDefaultRoles 测试组织默认角色（可选含祖先组织）计入有效权限与 token 声明
+func TestUserServiceAuthSnapshotIncludesGroupDefaultRoles(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "group_snapshot",
+		Email:    "group_snapshot@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+
+	direct := env.createTestRole(t, "direct_role", []string{"perm:direct", "perm:shared"})
+	member := env.createTestRole(t, "member_role", []string{"perm:group", "perm:shared"})
+	parentOnly := env.createTestRole(t, "parent_role", []string{"perm:parent"})
+	inactive := env.createTestRole(t, "group_inactive_role", []string{"perm:group_inactive"})
+
+	parent := env.createTestGroup(t, "parent_group", nil)
+	parentID := parent.GetID()
+	child := env.createTestGroup(t, "child_group", &parentID)
+	for _, pair := range []struct{ group, role int64 }{
+		{child.GetID(), member.GetID()},
+		{child.GetID(), inactive.GetID()},
+		{parent.GetID(), parentOnly.GetID()},
+	} {
+		if err := env.groupService.AddGroupRole(env.backgroundCtx, pair.group, pair.role); err != nil {
+			t.Fatalf("add group role: %v", err)
+		}
+	}
+	inactive.Status = svc.RoleStatusInactive
+	inactive.SetUpdatedAt(time.Now())
+	if err := env.roleRepo.Update(env.backgroundCtx, inactive); err != nil {
+		t.Fatalf("deactivate role: %v", err)
+	}
+
+	if err := env.userService.AssignRole(env.backgroundCtx, user.GetID(), direct.GetID()); err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+	if err := env.userService.AssignToGroup(env.backgroundCtx, user.GetID(), child.GetID()); err != nil {
+		t.Fatalf("assign to group: %v", err)
+	}
+
+	const secret = "group-snapshot-secret"
+	snapshotClaims := func() *iammw.JWTClaims {
+		t.Helper()
+		snapshot, err := env.userService.GetAuthSnapshot(env.backgroundCtx, user.GetID())
+		if err != nil {
+			t.Fatalf("get auth snapshot: %v", err)
+		}
+		token, err := iammw.GenerateToken(snapshot.UserID, snapshot.Username, snapshot.Roles, snapshot.Permissions, secret)
+		if err != nil {
+			t.Fatalf("generate token: %v", err)
+		}
+		claims, err := iammw.ParseToken(token, secret)
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		return claims
+	}
+	assertList := func(label string, got, want []string) {
+		t.Helper()
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("expected %s %v, got %v", label, want, got)
+		}
+	}
+
+	// 默认：合并直接所属组织的 active 默认角色，权限去重
+	claims := snapshotClaims()
+	assertList("roles", claims.Roles, []string{"direct_role", "member_role"})
+	assertList("permissions", claims.Permissions, []string{"perm:direct", "perm:group", "perm:shared"})
+
+	perms, err := env.userService.GetUserPermissions(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("get user permissions: %v", err)
+	}
+	assertList("user permissions", perms, []string{"perm:direct", "perm:group", "perm:shared"})
+
+	// 开启祖先继承：合并父组织默认角色
+	svc.SetInheritAncestorGroupRoles(true)
+	defer svc.SetInheritAncestorGroupRoles(false)
+	claims = snapshotClaims()
+	assertList("roles", claims.Roles, []string{"direct_role", "member_role", "parent_role"})
+	assertList("permissions", claims.Permissions, []string{"perm:direct", "perm:group", "perm:parent", "perm:shared"})
+}
+
 func TestUserServiceGetUserPermissionsRequiresActiveUser(t *testing.T) {
 	env := setupUserServiceTest(t)
 	defer env.teardown(t)
@@ -527,6 +929,11 @@ func TestUserServiceGetUserPermissionsRequiresActiveUser(t *testing.T) {
 			if allowed {
 				t.Fatalf("expected allowed=false for %s user", tt.name)
 			}
+
+			results, err := env.userService.CheckPermissions(env.backgroundCtx, user.GetID(), []string{"perm:active"})
+			if !errorx.Is(err, errorx.Forbidden) || results != nil {
+				t.Fatalf("expected forbidden batch check for %s user, got %v, %v", tt.name, results, err)
+			}
 		})
 	}
 }
@@ -547,6 +954,10 @@ func TestUserServiceChangePassword(t *testing.T) {
 		t.Fatalf("register user: %v", err)
 	}
 
+	// 修改前签发的 token
+	claims := &iammw.JWTClaims{UserID: user.GetID()}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
 	// 修改密码
 	changeReq := &svc.ChangePasswordRequest{
 		OldPassword: "oldpassword",
@@ -557,6 +968,11 @@ func TestUserServiceChangePassword(t *testing.T) {
 		t.Fatalf("change password: %v", err)
 	}
 
+	// 修改密码后退出所有设备
+	if !iammw.IsTokenRevoked(claims) {
+		t.Fatal("expected tokens issued before password change to be revoked")
+	}
+
 	// 验证旧密码无法登录
 	loginReq := &svc.AuthenticateRequest{
 		Username: "pwduser",
@@ -610,6 +1026,134 @@ func TestUserServiceUpdateProfile(t *testing.T) {
 	if updatedUser.Avatar != updateReq.Avatar {
 		t.Errorf("expected avatar %s, got %s", updateReq.Avatar, updatedUser.Avatar)
 	}
+
+	// 非 http(s) 头像被拒绝
+	_, err = env.userService.UpdateProfile(env.backgroundCtx, user.GetID(), &svc.UpdateUserRequest{Avatar: "javascript:alert(1)"})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for javascript avatar, got %v", err)
+	}
+}
+
+// TestUserServiceUpdateProfileFields 测试更新显示名、手机号与语言区域
+func TestUserServiceUpdateProfileFields(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "profile_user",
+		Email:    "profile_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+
+	// 逐项更新，未提供的字段保持不变
+	if _, err := env.userService.UpdateProfile(ctx, user.GetID(), &svc.UpdateUserRequest{DisplayName: " 张三 "}); err != nil {
+		t.Fatalf("update display name: %v", err)
+	}
+	if _, err := env.userService.UpdateProfile(ctx, user.GetID(), &svc.UpdateUserRequest{Phone: "+86 138-0013-8000"}); err != nil {
+		t.Fatalf("update phone: %v", err)
+	}
+	if _, err := env.userService.UpdateProfile(ctx, user.GetID(), &svc.UpdateUserRequest{Locale: "zh-CN"}); err != nil {
+		t.Fatalf("update locale: %v", err)
+	}
+	stored, err := env.userRepo.GetByID(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if stored.DisplayName != "张三" || stored.Phone != "+8613800138000" || stored.Locale != "zh-CN" {
+		t.Fatalf("unexpected profile: display_name=%q phone=%q locale=%q", stored.DisplayName, stored.Phone, stored.Locale)
+	}
+
+	// 格式错误被拒绝且不落库
+	for _, req := range []*svc.UpdateUserRequest{
+		{Phone: "13800138000"},
+		{Phone: "+86 abc"},
+		{Locale: "zh_CN"},
+		{Locale: "chinese"},
+		{DisplayName: "   "},
+	} {
+		if _, err := env.userService.UpdateProfile(ctx, user.GetID(), req); !errorx.Is(err, errorx.Validation) {
+			t.Fatalf("expected Validation for %+v, got %v", req, err)
+		}
+	}
+	stored, err = env.userRepo.GetByID(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if stored.Phone != "+8613800138000" || stored.Locale != "zh-CN" {
+		t.Fatalf("expected profile unchanged after rejected updates, got phone=%q locale=%q", stored.Phone, stored.Locale)
+	}
+}
+
+// TestUserServiceAssignIdempotent 测试重复分配角色/加入组织不产生重复关联行
+func TestUserServiceAssignIdempotent(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	// 模拟缺少联合唯一约束的关联表（如手工建表的历史库）
+	for _, stmt := range []string{
+		"DROP TABLE user_roles",
+		"CREATE TABLE user_roles (user_id integer, role_id integer, expires_at datetime, group_id integer, source_group_id integer)",
+		"DROP TABLE user_groups",
+		"CREATE TABLE user_groups (user_id integer, group_id integer, joined_at datetime)",
+	} {
+		if err := env.db.Exec(stmt).Error; err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "idempotent_user",
+		Email:    "idempotent_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	role := env.createTestRole(t, "idempotent_role", []string{"user:read"})
+	group := env.createTestGroup(t, "幂等组织", nil)
+
+	for i := 0; i < 2; i++ {
+		if err := env.userService.AssignRole(ctx, user.GetID(), role.GetID()); err != nil {
+			t.Fatalf("AssignRole #%d failed: %v", i+1, err)
+		}
+		if err := env.userService.AssignToGroup(ctx, user.GetID(), group.GetID()); err != nil {
+			t.Fatalf("AssignToGroup #%d failed: %v", i+1, err)
+		}
+	}
+
+	countRows := func(table string) int64 {
+		t.Helper()
+		var n int64
+		if err := env.db.Table(table).Where("user_id = ?", user.GetID()).Count(&n).Error; err != nil {
+			t.Fatalf("count %s: %v", table, err)
+		}
+		return n
+	}
+	if n := countRows("user_roles"); n != 1 {
+		t.Fatalf("expected 1 user_roles row, got %d", n)
+	}
+	if n := countRows("user_groups"); n != 1 {
+		t.Fatalf("expected 1 user_groups row, got %d", n)
+	}
+	roles, err := env.userService.GetUserRoles(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetUserRoles failed: %v", err)
+	}
+	if len(roles) != 1 || roles[0].GetID() != role.GetID() {
+		t.Fatalf("expected single role, got %d", len(roles))
+	}
+	groups, err := env.userService.GetUserGroups(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetUserGroups failed: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected single group, got %d", len(groups))
+	}
 }
 
 // TestUserServiceActivateDeactivate 测试激活和停用用户
@@ -859,3 +1403,3894 @@ func TestUserServiceRemoveFromGroup(t *testing.T) {
 		t.Errorf("expected 0 groups, got %d", len(groups))
 	}
 }
+
+// TestUserServiceGetProfileIncompleteUsers 测试查询资料不完整（无头像）用户
+func TestUserServiceGetProfileIncompleteUsers(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	register := func(username string) *iamentity.User {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("register user %s: %v", username, err)
+		}
+		return user
+	}
+
+	// 准备数据：一个有头像，两个无头像（其中一个被锁定）
+	withAvatar := register("withavatar")
+	noAvatar := register("noavatar")
+	lockedNoAvatar := register("lockednoavatar")
+
+	if _, err := env.userService.UpdateProfile(env.backgroundCtx, withAvatar.GetID(), &svc.UpdateUserRequest{
+		Avatar: "https://example.com/avatar.png",
+	}); err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	if err := env.userService.LockUser(env.backgroundCtx, lockedNoAvatar.GetID()); err != nil {
+		t.Fatalf("lock user: %v", err)
+	}
+
+	// 不过滤状态：返回全部无头像用户
+	users, err := env.userService.GetProfileIncompleteUsers(env.backgroundCtx, 0)
+	if err != nil {
+		t.Fatalf("get profile incomplete users: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("expected 2 users, got %d", len(users))
+	}
+	if users[0].GetID() != noAvatar.GetID() || users[1].GetID() != lockedNoAvatar.GetID() {
+		t.Errorf("unexpected users: %d, %d", users[0].GetID(), users[1].GetID())
+	}
+
+	// 按状态过滤：仅 active
+	users, err = env.userService.GetProfileIncompleteUsers(env.backgroundCtx, 0, svc.UserStatusActive)
+	if err != nil {
+		t.Fatalf("get active profile incomplete users: %v", err)
+	}
+	if len(users) != 1 || users[0].GetID() != noAvatar.GetID() {
+		t.Fatalf("expected only active user without avatar, got %d users", len(users))
+	}
+
+	// limit 生效
+	users, err = env.userService.GetProfileIncompleteUsers(env.backgroundCtx, 1)
+	if err != nil {
+		t.Fatalf("get profile incomplete users with limit: %v", err)
+	}
+	if len(users) != 1 {
+		t.Errorf("expected 1 user with limit, got %d", len(users))
+	}
+}
+
+// TestUserServiceGetUserRoleNames 测试仅返回有效角色名称
+func TestUserServiceGetUserRoleNames(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "rolenames_user",
+		Email:    "rolenames@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+
+	zRole := env.createTestRole(t, "z_role", []string{"perm:z"})
+	aRole := env.createTestRole(t, "a_role", []string{"perm:a"})
+	inactiveRole := env.createTestRole(t, "inactive_role", []string{"perm:inactive"})
+	for _, role := range []*iamentity.Role{zRole, aRole, inactiveRole} {
+		if err := env.userService.AssignRole(env.backgroundCtx, user.GetID(), role.GetID()); err != nil {
+			t.Fatalf("assign role %s: %v", role.Name, err)
+		}
+	}
+	// 重复分配不应产生重复名称
+	if err := env.userService.AssignRole(env.backgroundCtx, user.GetID(), aRole.GetID()); err != nil {
+		t.Fatalf("re-assign role: %v", err)
+	}
+
+	inactiveRole.Status = svc.RoleStatusInactive
+	inactiveRole.SetUpdatedAt(time.Now())
+	if err := env.roleRepo.Update(env.backgroundCtx, inactiveRole); err != nil {
+		t.Fatalf("deactivate role: %v", err)
+	}
+
+	names, err := env.userService.GetUserRoleNames(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("get user role names: %v", err)
+	}
+	want := []string{"a_role", "z_role"}
+	if len(names) != len(want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, names)
+		}
+	}
+
+	// 用户不存在
+	if _, err := env.userService.GetUserRoleNames(env.backgroundCtx, 999999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+}
+
+// TestUserRepoFindByStatusLite 测试轻量状态查询（无关联预加载）
+func TestUserRepoFindByStatusLite(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	role := env.createTestRole(t, "lite_role", []string{"perm:lite"})
+	group := env.createTestGroup(t, "轻量查询组织", nil)
+
+	var activeIDs []int64
+	for _, name := range []string{"lite1", "lite2", "lite3"} {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: name,
+			Email:    name + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("register user %s: %v", name, err)
+		}
+		if err := env.userService.AssignRole(env.backgroundCtx, user.GetID(), role.GetID()); err != nil {
+			t.Fatalf("assign role: %v", err)
+		}
+		if err := env.userService.AssignToGroup(env.backgroundCtx, user.GetID(), group.GetID()); err != nil {
+			t.Fatalf("assign group: %v", err)
+		}
+		activeIDs = append(activeIDs, user.GetID())
+	}
+	if err := env.userService.LockUser(env.backgroundCtx, activeIDs[2]); err != nil {
+		t.Fatalf("lock user: %v", err)
+	}
+	activeIDs = activeIDs[:2]
+
+	full, err := env.userRepo.FindByStatus(env.backgroundCtx, svc.UserStatusActive)
+	if err != nil {
+		t.Fatalf("find by status: %v", err)
+	}
+	lite, err := env.userRepo.FindByStatusLite(env.backgroundCtx, svc.UserStatusActive, 0, 0)
+	if err != nil {
+		t.Fatalf("find by status lite: %v", err)
+	}
+
+	if len(full) != len(lite) || len(lite) != len(activeIDs) {
+		t.Fatalf("expected %d users, got full=%d lite=%d", len(activeIDs), len(full), len(lite))
+	}
+	fullIDs := make(map[int64]bool, len(full))
+	for _, u := range full {
+		fullIDs[u.GetID()] = true
+	}
+	for i, u := range lite {
+		if u.GetID() != activeIDs[i] || !fullIDs[u.GetID()] {
+			t.Errorf("unexpected lite user id %d at %d", u.GetID(), i)
+		}
+		if len(u.Roles) != 0 || len(u.Groups) != 0 {
+			t.Errorf("expected no preloaded associations, got roles=%d groups=%d", len(u.Roles), len(u.Groups))
+		}
+	}
+
+	// 分页
+	page, err := env.userRepo.FindByStatusLite(env.backgroundCtx, svc.UserStatusActive, 1, 1)
+	if err != nil {
+		t.Fatalf("find by status lite paged: %v", err)
+	}
+	if len(page) != 1 || page[0].GetID() != activeIDs[1] {
+		t.Fatalf("expected second active user on page, got %v", page)
+	}
+}
+
+// TestUserServicePasswordMinLengthConsistent 测试注册与修改密码使用同一最小长度配置
+func TestUserServicePasswordMinLengthConsistent(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	t.Setenv("AUTH_PASSWORD_MIN_LENGTH", "10")
+
+	// 注册：9 位拒绝，10 位通过
+	_, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "minlen_short",
+		Email:    "minlen_short@example.com",
+		Password: "123456789",
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error on register, got %v", err)
+	}
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "minlen_ok",
+		Email:    "minlen_ok@example.com",
+		Password: "1234567890",
+	})
+	if err != nil {
+		t.Fatalf("register with configured minimum: %v", err)
+	}
+
+	// 修改密码：同样规则
+	err = env.userService.ChangePassword(env.backgroundCtx, user.GetID(), &svc.ChangePasswordRequest{
+		OldPassword: "1234567890",
+		NewPassword: "abcdefghi",
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error on change password, got %v", err)
+	}
+	if err := env.userService.ChangePassword(env.backgroundCtx, user.GetID(), &svc.ChangePasswordRequest{
+		OldPassword: "1234567890",
+		NewPassword: "abcdefghij",
+	}); err != nil {
+		t.Fatalf("change password with configured minimum: %v", err)
+	}
+}
+
+// TestUserServiceCheckAvailability 测试用户名/邮箱可用性检查
+func TestUserServiceCheckAvailability(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "taken_user",
+		Email:    "taken@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+
+	cases := []struct {
+		name         string
+		username     string
+		email        string
+		wantUsername bool
+		wantEmail    bool
+	}{
+		{"both taken", "taken_user", "taken@example.com", false, false},
+		{"both available", "free_user", "free@example.com", true, true},
+		{"email case insensitive", "free_user", "  Taken@Example.COM ", true, false},
+		{"username trimmed", " taken_user ", "", false, false},
+	}
+	for _, c := range cases {
+		usernameOK, emailOK, err := env.userService.CheckAvailability(env.backgroundCtx, c.username, c.email)
+		if err != nil {
+			t.Fatalf("%s: check availability: %v", c.name, err)
+		}
+		if usernameOK != c.wantUsername || emailOK != c.wantEmail {
+			t.Fatalf("%s: expected (%v,%v), got (%v,%v)", c.name, c.wantUsername, c.wantEmail, usernameOK, emailOK)
+		}
+	}
+}
+
+// TestRoleServiceDeactivateRoleRevokesSessions 测试开启吊销后停用角色会使受影响用户的 token 失效
+func TestRoleServiceDeactivateRoleRevokesSessions(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	const secret = "revoke-test-secret"
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	affected, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "revoke_affected",
+		Email:    "revoke_affected@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register affected user: %v", err)
+	}
+	bystander, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "revoke_bystander",
+		Email:    "revoke_bystander@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register bystander user: %v", err)
+	}
+
+	role := env.createTestRole(t, "revocable_role", []string{"perm:revocable"})
+	if err := env.userService.AssignRole(env.backgroundCtx, affected.GetID(), role.GetID()); err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+
+	affectedToken, err := iammw.GenerateToken(affected.GetID(), affected.Username, []string{role.Name}, nil, secret)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	bystanderToken, err := iammw.GenerateToken(bystander.GetID(), bystander.Username, nil, nil, secret)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	isRevoked := func(token string) bool {
+		claims, err := iammw.ParseToken(token, secret)
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		return iammw.IsTokenRevoked(claims)
+	}
+
+	// 默认关闭：停用角色不影响已签发 token
+	if err := roleService.DeactivateRole(env.backgroundCtx, role.GetID()); err != nil {
+		t.Fatalf("deactivate role: %v", err)
+	}
+	if isRevoked(affectedToken) {
+		t.Fatal("expected token not revoked when option disabled")
+	}
+
+	// 开启后停用角色吊销受影响用户的 token
+	if err := roleService.ActivateRole(env.backgroundCtx, role.GetID()); err != nil {
+		t.Fatalf("activate role: %v", err)
+	}
+	roleService.SetRevokeSessionsOnChange(true)
+	if err := roleService.DeactivateRole(env.backgroundCtx, role.GetID()); err != nil {
+		t.Fatalf("deactivate role: %v", err)
+	}
+	if !isRevoked(affectedToken) {
+		t.Fatal("expected affected user's token revoked")
+	}
+	if isRevoked(bystanderToken) {
+		t.Fatal("expected bystander's token not revoked")
+	}
+}
+
+// TestRoleServiceUpdateRoleRevokesInheritedSessions 测试父角色变更同样吊销子角色持有者与组织默认角色持有者的 token
+func TestRoleServiceUpdateRoleRevokesInheritedSessions(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	const secret = "revoke-inherited-secret"
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	register := func(name string) *iamentity.User {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: name,
+			Email:    name + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("register %s: %v", name, err)
+		}
+		return user
+	}
+	childHolder := register("inherit_child_holder")
+	groupMember := register("inherit_group_member")
+	bystander := register("inherit_bystander")
+
+	parent := env.createTestRole(t, "inherit_parent_role", []string{"perm:parent"})
+	child := env.createTestRole(t, "inherit_child_role", []string{"perm:child"})
+	if _, err := roleService.SetParentRole(env.backgroundCtx, child.GetID(), parent.GetID()); err != nil {
+		t.Fatalf("set parent role: %v", err)
+	}
+	if err := env.userService.AssignRole(env.backgroundCtx, childHolder.GetID(), child.GetID()); err != nil {
+		t.Fatalf("assign child role: %v", err)
+	}
+
+	// 父组织以父角色为默认角色，成员位于子组织
+	group := env.createTestGroup(t, "inherit_group", nil)
+	groupID := group.GetID()
+	subgroup := env.createTestGroup(t, "inherit_subgroup", &groupID)
+	if err := env.groupService.AddGroupRole(env.backgroundCtx, groupID, parent.GetID()); err != nil {
+		t.Fatalf("add group role: %v", err)
+	}
+	if err := env.groupService.AddUserToGroup(env.backgroundCtx, subgroup.GetID(), groupMember.GetID()); err != nil {
+		t.Fatalf("add user to group: %v", err)
+	}
+
+	tokens := make(map[int64]string)
+	for _, user := range []*iamentity.User{childHolder, groupMember, bystander} {
+		token, err := iammw.GenerateToken(user.GetID(), user.Username, nil, nil, secret)
+		if err != nil {
+			t.Fatalf("generate token: %v", err)
+		}
+		tokens[user.GetID()] = token
+	}
+	isRevoked := func(user *iamentity.User) bool {
+		claims, err := iammw.ParseToken(tokens[user.GetID()], secret)
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		return iammw.IsTokenRevoked(claims)
+	}
+
+	roleService.SetRevokeSessionsOnChange(true)
+	if _, err := roleService.UpdateRole(env.backgroundCtx, parent.GetID(), &svc.UpdateRoleRequest{
+		Name: "inherit_parent_renamed",
+	}); err != nil {
+		t.Fatalf("update role: %v", err)
+	}
+
+	if !isRevoked(childHolder) {
+		t.Fatal("expected child role holder's token revoked")
+	}
+	if !isRevoked(groupMember) {
+		t.Fatal("expected group default role holder's token revoked")
+	}
+	if isRevoked(bystander) {
+		t.Fatal("expected bystander's token not revoked")
+	}
+}
+
+// TestUserServiceGetUserPermissionsDeterministicOrder 测试权限列表与角色分配顺序无关
+func TestUserServiceGetUserPermissionsDeterministicOrder(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	roleA := env.createTestRole(t, "order_role_a", []string{"task:write", "user:read", "group:read"})
+	roleB := env.createTestRole(t, "order_role_b", []string{"role:read", "user:read", "a:first"})
+
+	register := func(name string) *iamentity.User {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: name,
+			Email:    name + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("register %s: %v", name, err)
+		}
+		return user
+	}
+	first := register("order_first")
+	second := register("order_second")
+
+	// 两个用户以相反顺序分配相同角色
+	for _, role := range []*iamentity.Role{roleA, roleB} {
+		if err := env.userService.AssignRole(env.backgroundCtx, first.GetID(), role.GetID()); err != nil {
+			t.Fatalf("assign role: %v", err)
+		}
+	}
+	for _, role := range []*iamentity.Role{roleB, roleA} {
+		if err := env.userService.AssignRole(env.backgroundCtx, second.GetID(), role.GetID()); err != nil {
+			t.Fatalf("assign role: %v", err)
+		}
+	}
+
+	want := []string{"a:first", "group:read", "role:read", "task:write", "user:read"}
+	for _, user := range []*iamentity.User{first, second} {
+		for i := 0; i < 3; i++ {
+			perms, err := env.userService.GetUserPermissions(env.backgroundCtx, user.GetID())
+			if err != nil {
+				t.Fatalf("get user permissions: %v", err)
+			}
+			if len(perms) != len(want) {
+				t.Fatalf("user %s: expected %v, got %v", user.Username, want, perms)
+			}
+			for j := range want {
+				if perms[j] != want[j] {
+					t.Fatalf("user %s: expected %v, got %v", user.Username, want, perms)
+				}
+			}
+		}
+	}
+
+	// 实体层的 GetAllPermissions 也保证同样的顺序
+	profile, err := env.userService.GetUserProfile(env.backgroundCtx, second.GetID())
+	if err != nil {
+		t.Fatalf("get user profile: %v", err)
+	}
+	all := profile.GetAllPermissions()
+	if len(all) != len(want) {
+		t.Fatalf("expected %v, got %v", want, all)
+	}
+	for j := range want {
+		if all[j] != want[j] {
+			t.Fatalf("expected %v, got %v", want, all)
+		}
+	}
+}
+
+// TestUserServiceRegisterPendingDefaultStatus 测试配置 pending 默认状态后注册用户无法登录
+func TestUserServiceRegisterPendingDefaultStatus(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	t.Setenv("AUTH_REGISTRATION_DEFAULT_STATUS", "pending")
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "pending_user",
+		Email:    "pending@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if user.Status != svc.UserStatusPending {
+		t.Fatalf("expected status pending, got %s", user.Status)
+	}
+
+	_, err = env.userService.Authenticate(env.backgroundCtx, &svc.AuthenticateRequest{
+		Username: "pending_user",
+		Password: "password123",
+	})
+	if !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for pending user, got %v", err)
+	}
+
+	// 激活后可正常登录
+	if err := env.userService.ActivateUser(env.backgroundCtx, user.GetID()); err != nil {
+		t.Fatalf("activate user: %v", err)
+	}
+	if _, err := env.userService.Authenticate(env.backgroundCtx, &svc.AuthenticateRequest{
+		Username: "pending_user",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("authenticate after activation: %v", err)
+	}
+
+	// 非法配置：注册失败
+	t.Setenv("AUTH_REGISTRATION_DEFAULT_STATUS", "locked")
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "invalid_status_user",
+		Email:    "invalid_status@example.com",
+		Password: "password123",
+	}); err == nil {
+		t.Fatal("expected error for invalid default status")
+	}
+}
+
+// TestUserServiceRegisterDefaultRole 测试可配置的注册默认角色与严格模式
+func TestUserServiceRegisterDefaultRole(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	roleNames := func(userID int64) []string {
+		roles, err := env.userService.GetUserRoles(ctx, userID)
+		if err != nil {
+			t.Fatalf("GetUserRoles failed: %v", err)
+		}
+		names := make([]string, 0, len(roles))
+		for _, r := range roles {
+			names = append(names, r.Name)
+		}
+		return names
+	}
+
+	// 自定义默认角色
+	env.createTestRole(t, "member", []string{"profile:read"})
+	t.Setenv("AUTH_DEFAULT_ROLE", "member")
+	if err := env.userService.ValidateDefaultRole(ctx); err != nil {
+		t.Fatalf("ValidateDefaultRole failed: %v", err)
+	}
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{Username: "member_user", Email: "member@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if names := roleNames(user.GetID()); len(names) != 1 || names[0] != "member" {
+		t.Fatalf("expected default role member, got %v", names)
+	}
+
+	// 默认角色缺失：非严格模式注册成功但没有角色
+	t.Setenv("AUTH_DEFAULT_ROLE", "missing_role")
+	if err := env.userService.ValidateDefaultRole(ctx); !errorx.Is(err, errorx.Internal) {
+		t.Fatalf("expected Internal for missing default role, got %v", err)
+	}
+	user, err = env.userService.Register(ctx, &svc.RegisterRequest{Username: "lenient_user", Email: "lenient@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("register in lenient mode: %v", err)
+	}
+	if names := roleNames(user.GetID()); len(names) != 0 {
+		t.Fatalf("expected no roles, got %v", names)
+	}
+
+	// 严格模式：注册失败且不创建用户
+	t.Setenv("AUTH_DEFAULT_ROLE_STRICT", "true")
+	if _, err := env.userService.Register(ctx, &svc.RegisterRequest{Username: "strict_user", Email: "strict@example.com", Password: "password123"}); !errorx.Is(err, errorx.Internal) {
+		t.Fatalf("expected Internal in strict mode, got %v", err)
+	}
+	if _, err := env.userRepo.FindByUsername(ctx, "strict_user"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected strict_user not created, got %v", err)
+	}
+
+	// 严格模式且角色存在：正常注册
+	t.Setenv("AUTH_DEFAULT_ROLE", "member")
+	user, err = env.userService.Register(ctx, &svc.RegisterRequest{Username: "strict_user", Email: "strict@example.com", Password: "password123"})
+	if err != nil {
+		t.Fatalf("register in strict mode: %v", err)
+	}
+	if names := roleNames(user.GetID()); len(names) != 1 || names[0] != "member" {
+		t.Fatalf("expected default role member in strict mode, got %v", names)
+	}
+}
+
+// TestUserServiceChangeUsername 测试修改用户名的校验、唯一性与历史记录
+func TestUserServiceChangeUsername(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	register := func(username, email string) *iamentity.User {
+		user, err := env.userService.Register(ctx, &svc.RegisterRequest{Username: username, Email: email, Password: "password123"})
+		if err != nil {
+			t.Fatalf("register %s: %v", username, err)
+		}
+		return user
+	}
+	alice := register("alice", "alice@example.com")
+	register("bob", "bob@example.com")
+
+	// 成功改名：返回新用户名，可用新用户名登录，旧用户名不再可用
+	renamed, err := env.userService.ChangeUsername(ctx, alice.GetID(), "  alice_new ")
+	if err != nil {
+		t.Fatalf("ChangeUsername failed: %v", err)
+	}
+	if renamed.Username != "alice_new" {
+		t.Fatalf("expected username alice_new, got %s", renamed.Username)
+	}
+	if _, err := env.userService.Authenticate(ctx, &svc.AuthenticateRequest{Username: "alice_new", Password: "password123"}); err != nil {
+		t.Fatalf("authenticate with new username: %v", err)
+	}
+	if _, err := env.userRepo.FindByUsername(ctx, "alice"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected old username to be free, got %v", err)
+	}
+
+	// 与其他用户重复（忽略大小写）、长度非法均拒绝
+	if _, err := env.userService.ChangeUsername(ctx, alice.GetID(), "BOB"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for duplicate username, got %v", err)
+	}
+	if _, err := env.userService.ChangeUsername(ctx, alice.GetID(), "ab"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for short username, got %v", err)
+	}
+	if _, err := env.userService.ChangeUsername(ctx, alice.GetID(), strings.Repeat("a", svc.MaxUsernameLength+1)); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for long username, got %v", err)
+	}
+	if _, err := env.userService.ChangeUsername(ctx, 99999, "ghost_user"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+
+	// 仅大小写变化允许（与自身不冲突），未变化不记录
+	if _, err := env.userService.ChangeUsername(ctx, alice.GetID(), "Alice_New"); err != nil {
+		t.Fatalf("ChangeUsername case-only failed: %v", err)
+	}
+	if _, err := env.userService.ChangeUsername(ctx, alice.GetID(), "Alice_New"); err != nil {
+		t.Fatalf("ChangeUsername unchanged failed: %v", err)
+	}
+
+	// 历史按时间正序记录旧值与新值
+	history, err := env.userService.GetUsernameHistory(ctx, alice.GetID())
+	if err != nil {
+		t.Fatalf("GetUsernameHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history records, got %d", len(history))
+	}
+	if history[0].OldUsername != "alice" || history[0].NewUsername != "alice_new" {
+		t.Fatalf("unexpected first record: %+v", history[0])
+	}
+	if history[1].OldUsername != "alice_new" || history[1].NewUsername != "Alice_New" {
+		t.Fatalf("unexpected second record: %+v", history[1])
+	}
+}
+
+// TestUserServiceEmailVerification 测试开启邮箱验证后未验证用户无法登录、验证后激活且令牌一次性
+func TestUserServiceEmailVerification(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_SECRET", "email-verification-secret")
+	t.Setenv("AUTH_REQUIRE_EMAIL_VERIFICATION", "true")
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "verify_user",
+		Email:    "verify@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if user.Status != svc.UserStatusPending {
+		t.Fatalf("expected status pending, got %s", user.Status)
+	}
+
+	// 未验证：登录被拒绝，且提示区别于禁用
+	login := &svc.AuthenticateRequest{Username: "verify_user", Password: "password123"}
+	_, err = env.userService.Authenticate(env.backgroundCtx, login)
+	if !errorx.Is(err, errorx.Forbidden) || !strings.Contains(err.Error(), "邮箱未验证") {
+		t.Fatalf("expected email-not-verified Forbidden, got %v", err)
+	}
+
+	token, err := env.userService.GenerateEmailVerificationToken(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("GenerateEmailVerificationToken failed: %v", err)
+	}
+
+	// 篡改令牌
+	if _, err := env.userService.VerifyEmail(env.backgroundCtx, token+"x"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for tampered token, got %v", err)
+	}
+
+	verified, err := env.userService.VerifyEmail(env.backgroundCtx, token)
+	if err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	if verified.Status != svc.UserStatusActive {
+		t.Fatalf("expected status active, got %s", verified.Status)
+	}
+	if _, err := env.userService.Authenticate(env.backgroundCtx, login); err != nil {
+		t.Fatalf("authenticate after verification: %v", err)
+	}
+
+	// 一次性：重复使用失效，已激活用户不再签发令牌
+	if _, err := env.userService.VerifyEmail(env.backgroundCtx, token); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for reused token, got %v", err)
+	}
+	if _, err := env.userService.GenerateEmailVerificationToken(env.backgroundCtx, user.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for active user, got %v", err)
+	}
+
+	// 禁用用户仍返回禁用提示
+	if err := env.userService.DeactivateUser(env.backgroundCtx, user.GetID()); err != nil {
+		t.Fatalf("deactivate user: %v", err)
+	}
+	_, err = env.userService.Authenticate(env.backgroundCtx, login)
+	if !errorx.Is(err, errorx.Forbidden) || strings.Contains(err.Error(), "邮箱未验证") {
+		t.Fatalf("expected disabled Forbidden, got %v", err)
+	}
+}
+
+// TestRoleServicePermissionDependencies 测试权限依赖校验：enforce 模式拒绝，warn 模式放行并可查询缺失依赖
+func TestRoleServicePermissionDependencies(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	iammw.RegisterRequiredPermissions("dep_user:read", "dep_user:write", "dep_user:delete")
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	roleService.SetPermissionDependencies(map[string][]string{"dep_user:delete": {"dep_user:read"}})
+
+	// enforce：缺少依赖时拒绝创建与更新
+	roleService.SetPermissionDependencyMode(svc.PermissionDependencyModeEnforce)
+	_, err := roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{
+		Name:        "dep_enforce",
+		Permissions: []string{"dep_user:delete"},
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for missing dependency, got %v", err)
+	}
+	var appErr *errorx.AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("expected AppError, got %T", err)
+	}
+	if _, ok := appErr.Details()["missing_dependencies"]; !ok {
+		t.Fatalf("expected missing_dependencies in details, got %v", appErr.Details())
+	}
+
+	role, err := roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{
+		Name:        "dep_enforce",
+		Permissions: []string{"dep_user:delete", "dep_user:read"},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole with dependencies failed: %v", err)
+	}
+	if _, err := roleService.UpdateRole(env.backgroundCtx, role.GetID(), &svc.UpdateRoleRequest{
+		Permissions: []string{"dep_user:delete"},
+	}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation on update, got %v", err)
+	}
+
+	// 单个权限编辑同样校验编辑后的集合
+	if err := roleService.RemovePermission(env.backgroundCtx, role.GetID(), "dep_user:read"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation when removing a dependency, got %v", err)
+	}
+	readOnly := env.createTestRole(t, "dep_read_only", []string{"dep_user:write"})
+	if err := roleService.AddPermission(env.backgroundCtx, readOnly.GetID(), "dep_user:delete"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation when adding without dependency, got %v", err)
+	}
+	if err := roleService.AddPermission(env.backgroundCtx, readOnly.GetID(), "dep_user:read"); err != nil {
+		t.Fatalf("AddPermission of dependency failed: %v", err)
+	}
+	if err := roleService.AddPermission(env.backgroundCtx, readOnly.GetID(), "dep_user:delete"); err != nil {
+		t.Fatalf("AddPermission with dependency present failed: %v", err)
+	}
+
+	// warn：放行，缺失依赖通过 GetPermissionDependencyValidation 报告
+	roleService.SetPermissionDependencyMode(svc.PermissionDependencyModeWarn)
+	warned, err := roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{
+		Name:        "dep_warn",
+		Permissions: []string{"dep_user:delete"},
+	})
+	if err != nil {
+		t.Fatalf("expected CreateRole to pass in warn mode, got %v", err)
+	}
+	report := roleService.GetPermissionDependencyValidation(warned.Permissions)
+	if report.Valid || len(report.Missing["dep_user:delete"]) != 1 || report.Missing["dep_user:delete"][0] != "dep_user:read" {
+		t.Fatalf("expected report of missing dep_user:read, got %+v", report)
+	}
+}
+
+// TestRoleServiceNameNormalization 测试角色名称去除首尾空白与可选的大小写折叠
+func TestRoleServiceNameNormalization(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	iammw.RegisterRequiredPermissions("norm:read")
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	create := func(name string) (*iamentity.Role, error) {
+		return roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{Name: name, Permissions: []string{"norm:read"}})
+	}
+
+	role, err := create(" Manager ")
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+	if role.Name != "Manager" || role.Code != "Manager" {
+		t.Fatalf("expected trimmed name and code, got %q/%q", role.Name, role.Code)
+	}
+
+	// 默认仅去除空白
+	if _, err := create("Manager"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for trimmed duplicate, got %v", err)
+	}
+	if _, err := create("manager"); err != nil {
+		t.Fatalf("expected distinct case to pass without case folding, got %v", err)
+	}
+	if _, err := create("Legacy Ops"); err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+
+	// 开启大小写折叠：与开启前落库的混合大小写名称同样冲突
+	roleService.SetNameCaseFold(true)
+	if _, err := create("MANAGER"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for case-folded duplicate, got %v", err)
+	}
+	if _, err := create("LEGACY OPS"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for duplicate of mixed-case legacy name, got %v", err)
+	}
+	other, err := create("Auditor")
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+	if other.Name != "auditor" {
+		t.Fatalf("expected case-folded name, got %q", other.Name)
+	}
+	if _, err := roleService.UpdateRole(env.backgroundCtx, other.GetID(), &svc.UpdateRoleRequest{Name: " Manager"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation on update to duplicate, got %v", err)
+	}
+}
+
+// TestRoleServiceCreateRoleSuggestsNameOnConflict 测试角色名称冲突时返回可用的建议名称
+func TestRoleServiceCreateRoleSuggestsNameOnConflict(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	env.createTestRole(t, "manager", []string{"user:read"})
+	env.createTestRole(t, "manager-2", []string{"user:read"})
+
+	// 默认不附带建议
+	_, err := roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{
+		Name:        "manager",
+		Permissions: []string{"user:read"},
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error, got %v", err)
+	}
+	var appErr *errorx.AppError
+	if !errors.As(err, &appErr) {
+		t.Fatalf("expected AppError, got %T", err)
+	}
+	if _, ok := appErr.Details()["suggested_name"]; ok {
+		t.Fatalf("expected no suggestion without option, got %v", appErr.Details())
+	}
+
+	// 开启后仍拒绝，但附带跳过已占用名称的建议
+	_, err = roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{
+		Name:                  "manager",
+		Permissions:           []string{"user:read"},
+		SuggestNameOnConflict: true,
+	})
+	if !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation error, got %v", err)
+	}
+	if !errors.As(err, &appErr) {
+		t.Fatalf("expected AppError, got %T", err)
+	}
+	if got := appErr.Details()["suggested_name"]; got != "manager-3" {
+		t.Fatalf("expected suggested_name manager-3, got %v", got)
+	}
+	if got := appErr.Details()["suggested_code"]; got != "manager-3" {
+		t.Fatalf("expected suggested_code manager-3, got %v", got)
+	}
+	if _, err := env.roleRepo.FindByName(env.backgroundCtx, "manager-3"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected suggested name to be available, got %v", err)
+	}
+}
+
+// TestUserServiceAssignRoleMissingResourceContext 测试分配角色时可区分缺失的用户与角色
+func TestUserServiceAssignRoleMissingResourceContext(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "assign_ctx_user",
+		Email:    "assign_ctx@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	role := env.createTestRole(t, "assign_ctx_role", []string{"user:read"})
+
+	cases := []struct {
+		name         string
+		userID       int64
+		roleID       int64
+		wantResource string
+		wantID       int64
+	}{
+		{"missing user", 99999, role.GetID(), "user", 99999},
+		{"missing role", user.GetID(), 88888, "role", 88888},
+	}
+	for _, c := range cases {
+		err := env.userService.AssignRole(env.backgroundCtx, c.userID, c.roleID)
+		if !errorx.Is(err, errorx.NotFound) {
+			t.Fatalf("%s: expected NotFound, got %v", c.name, err)
+		}
+		var appErr *errorx.AppError
+		if !errors.As(err, &appErr) {
+			t.Fatalf("%s: expected AppError, got %T", c.name, err)
+		}
+		details := appErr.Details()
+		if details[svc.ErrorContextResource] != c.wantResource {
+			t.Fatalf("%s: expected resource %q, got %v", c.name, c.wantResource, details)
+		}
+		if details[svc.ErrorContextResourceID] != c.wantID {
+			t.Fatalf("%s: expected resource_id %d, got %v", c.name, c.wantID, details)
+		}
+	}
+}
+
+// TestUserServiceGetUsersByCreatedRange 测试按注册时间区间分页查询用户
+func TestUserServiceGetUsersByCreatedRange(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{-time.Hour, 0, 2 * time.Hour, 5 * time.Hour, 24 * time.Hour}
+	ids := make([]int64, 0, len(offsets))
+	for i, off := range offsets {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: fmt.Sprintf("cohort_%d", i),
+			Email:    fmt.Sprintf("cohort_%d@example.com", i),
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if err := env.db.Exec("UPDATE users SET created_at = ? WHERE id = ?", base.Add(off), user.GetID()).Error; err != nil {
+			t.Fatalf("update created_at: %v", err)
+		}
+		ids = append(ids, user.GetID())
+	}
+	// 区间内的一个用户置为 inactive，用于验证状态过滤
+	if err := env.db.Exec("UPDATE users SET status = ? WHERE id = ?", svc.UserStatusInactive, ids[2]).Error; err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	from, to := base, base.Add(24*time.Hour)
+
+	// 区间为 [from, to)：包含 base，不包含 base+24h
+	users, total, err := env.userService.GetUsersByCreatedRange(env.backgroundCtx, from, to, "", 0, 0)
+	if err != nil {
+		t.Fatalf("GetUsersByCreatedRange failed: %v", err)
+	}
+	if total != 3 || len(users) != 3 {
+		t.Fatalf("expected 3 users in range, got total=%d len=%d", total, len(users))
+	}
+	for i, user := range users {
+		if user.GetID() != ids[i+1] {
+			t.Errorf("users[%d]: expected id %d, got %d", i, ids[i+1], user.GetID())
+		}
+		if user.Password != "" {
+			t.Errorf("expected password stripped for user %d", user.GetID())
+		}
+	}
+
+	// 分页：total 不受分页影响
+	page, total, err := env.userService.GetUsersByCreatedRange(env.backgroundCtx, from, to, "", 1, 1)
+	if err != nil {
+		t.Fatalf("GetUsersByCreatedRange paged failed: %v", err)
+	}
+	if total != 3 || len(page) != 1 || page[0].GetID() != ids[2] {
+		t.Fatalf("unexpected page: total=%d len=%d", total, len(page))
+	}
+
+	// 状态过滤
+	active, total, err := env.userService.GetUsersByCreatedRange(env.backgroundCtx, from, to, svc.UserStatusActive, 0, 0)
+	if err != nil {
+		t.Fatalf("GetUsersByCreatedRange with status failed: %v", err)
+	}
+	if total != 2 || len(active) != 2 {
+		t.Fatalf("expected 2 active users, got total=%d len=%d", total, len(active))
+	}
+
+	// 参数校验
+	if _, _, err := env.userService.GetUsersByCreatedRange(env.backgroundCtx, to, from, "", 0, 0); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for reversed range, got %v", err)
+	}
+	if _, _, err := env.userService.GetUsersByCreatedRange(env.backgroundCtx, from, to, "unknown", 0, 0); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for unknown status, got %v", err)
+	}
+}
+
+// TestUserServiceSearchUsersPaged 测试分页搜索：跨页按 ID 稳定排序、total 与关键字/软删除过滤一致
+func TestUserServiceSearchUsersPaged(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	ids := make([]int64, 0, 5)
+	for i := 0; i < 5; i++ {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: fmt.Sprintf("pager_%d", i),
+			Email:    fmt.Sprintf("pager_%d@example.com", i),
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		ids = append(ids, user.GetID())
+	}
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "unrelated",
+		Email:    "unrelated@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	// 软删除的用户不计入结果与总数
+	if err := env.db.Exec("UPDATE users SET deleted_at = ? WHERE id = ?", time.Now(), ids[4]).Error; err != nil {
+		t.Fatalf("soft delete user: %v", err)
+	}
+	// 非 active 用户用于验证按状态分页
+	if err := env.db.Exec("UPDATE users SET status = ? WHERE id = ?", svc.UserStatusInactive, ids[1]).Error; err != nil {
+		t.Fatalf("update status: %v", err)
+	}
+
+	// 逐页读取：每页 2 条，含非 active 共 4 条匹配
+	includeInactive := svc.ListOptions{IncludeInactive: true}
+	var collected []int64
+	for offset := 0; offset < 6; offset += 2 {
+		users, total, err := env.userService.SearchUsersPaged(env.backgroundCtx, "pager", includeInactive, offset, 2)
+		if err != nil {
+			t.Fatalf("SearchUsersPaged failed: %v", err)
+		}
+		if total != 4 {
+			t.Fatalf("expected total 4 at offset %d, got %d", offset, total)
+		}
+		for _, user := range users {
+			if user.Password != "" {
+				t.Errorf("expected password stripped for user %d", user.GetID())
+			}
+			collected = append(collected, user.GetID())
+		}
+	}
+	if len(collected) != 4 {
+		t.Fatalf("expected 4 users across pages, got %v", collected)
+	}
+	for i, id := range collected {
+		if id != ids[i] {
+			t.Fatalf("expected stable id order %v, got %v", ids[:4], collected)
+		}
+	}
+
+	// 关键字可匹配邮箱，且与软删除过滤同时生效
+	users, total, err := env.userService.SearchUsersPaged(env.backgroundCtx, "pager_4@", includeInactive, 0, 10)
+	if err != nil {
+		t.Fatalf("SearchUsersPaged failed: %v", err)
+	}
+	if total != 0 || len(users) != 0 {
+		t.Fatalf("expected soft-deleted user excluded, got total=%d len=%d", total, len(users))
+	}
+
+	// 默认仅返回 active 且未软删除的用户
+	users, total, err = env.userService.SearchUsersPaged(env.backgroundCtx, "pager", svc.ListOptions{}, 0, 10)
+	if err != nil {
+		t.Fatalf("SearchUsersPaged failed: %v", err)
+	}
+	if total != 3 || len(users) != 3 || users[0].GetID() != ids[0] || users[1].GetID() != ids[2] || users[2].GetID() != ids[3] {
+		t.Fatalf("expected only active users by default, got total=%d users=%v", total, users)
+	}
+
+	// include_deleted 返回软删除用户，include_inactive 与 include_deleted 可组合
+	users, total, err = env.userService.SearchUsersPaged(env.backgroundCtx, "pager", svc.ListOptions{IncludeDeleted: true}, 0, 10)
+	if err != nil {
+		t.Fatalf("SearchUsersPaged failed: %v", err)
+	}
+	if total != 4 || len(users) != 4 || users[3].GetID() != ids[4] {
+		t.Fatalf("expected soft-deleted active user included, got total=%d users=%v", total, users)
+	}
+	_, total, err = env.userService.SearchUsersPaged(env.backgroundCtx, "pager", svc.ListOptions{IncludeInactive: true, IncludeDeleted: true}, 0, 10)
+	if err != nil {
+		t.Fatalf("SearchUsersPaged failed: %v", err)
+	}
+	if total != 5 {
+		t.Fatalf("expected all 5 users, got total=%d", total)
+	}
+
+	// 按状态分页
+	active, total, err := env.userService.GetUsersByStatusPaged(env.backgroundCtx, svc.UserStatusActive, 1, 2)
+	if err != nil {
+		t.Fatalf("GetUsersByStatusPaged failed: %v", err)
+	}
+	if total != 4 || len(active) != 2 || active[0].GetID() != ids[2] || active[1].GetID() != ids[3] {
+		t.Fatalf("unexpected active page: total=%d users=%v", total, active)
+	}
+
+	// 参数校验
+	if _, _, err := env.userService.SearchUsersPaged(env.backgroundCtx, "", svc.ListOptions{}, -1, 10); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for negative offset, got %v", err)
+	}
+	if _, _, err := env.userService.GetUsersByStatusPaged(env.backgroundCtx, "unknown", 0, 10); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for unknown status, got %v", err)
+	}
+}
+
+// TestUserServicePasswordReset 测试密码重置令牌：正常重置、重复使用、过期与错误邮箱
+func TestUserServicePasswordReset(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_SECRET", "password-reset-secret")
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "reset_user",
+		Email:    "reset@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// 错误邮箱
+	if _, err := env.userService.CreatePasswordResetToken(env.backgroundCtx, "nobody@example.com"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for unknown email, got %v", err)
+	}
+
+	token, err := env.userService.CreatePasswordResetToken(env.backgroundCtx, "reset@example.com")
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken failed: %v", err)
+	}
+	// 同一时刻签发的第二个令牌，用于验证重置后其他令牌一并失效
+	otherToken, err := env.userService.CreatePasswordResetToken(env.backgroundCtx, "reset@example.com")
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken failed: %v", err)
+	}
+
+	// 新密码需满足密码策略
+	if err := env.userService.ResetPassword(env.backgroundCtx, token, "short"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for short password, got %v", err)
+	}
+	// 篡改令牌
+	if err := env.userService.ResetPassword(env.backgroundCtx, token+"x", "newpassword123"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for tampered token, got %v", err)
+	}
+
+	if err := env.userService.ResetPassword(env.backgroundCtx, token, "newpassword123"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if _, err := env.userService.Authenticate(env.backgroundCtx, &svc.AuthenticateRequest{Username: "reset_user", Password: "newpassword123"}); err != nil {
+		t.Fatalf("expected login with new password, got %v", err)
+	}
+
+	// 重复使用（以及重置前签发的其他令牌）均失效
+	if err := env.userService.ResetPassword(env.backgroundCtx, token, "anotherpassword123"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for reused token, got %v", err)
+	}
+	if err := env.userService.ResetPassword(env.backgroundCtx, otherToken, "anotherpassword123"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for token issued before reset, got %v", err)
+	}
+
+	// 过期
+	env.userService.SetPasswordResetTTL(time.Second)
+	expiring, err := env.userService.CreatePasswordResetToken(env.backgroundCtx, user.Email)
+	if err != nil {
+		t.Fatalf("CreatePasswordResetToken failed: %v", err)
+	}
+	time.Sleep(2100 * time.Millisecond)
+	err = env.userService.ResetPassword(env.backgroundCtx, expiring, "anotherpassword123")
+	if !errorx.Is(err, errorx.Validation) || !strings.Contains(err.Error(), "过期") {
+		t.Fatalf("expected expired Validation error, got %v", err)
+	}
+}
+
+// TestUserServiceAuthenticateLockout 测试连续登录失败后的临时锁定与自动解除
+func TestUserServiceAuthenticateLockout(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_LOCKOUT_THRESHOLD", "3")
+	t.Setenv("AUTH_LOCKOUT_DURATION", "1s")
+
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "lockout_user",
+		Email:    "lockout@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	good := &svc.AuthenticateRequest{Username: "lockout_user", Password: "password123"}
+	bad := &svc.AuthenticateRequest{Username: "lockout_user", Password: "wrong-password"}
+
+	// 成功登录清零计数：2 次失败 + 1 次成功 + 2 次失败不触发锁定
+	for i := 0; i < 2; i++ {
+		if _, err := env.userService.Authenticate(env.backgroundCtx, bad); !errorx.Is(err, errorx.Validation) {
+			t.Fatalf("attempt %d: expected Validation, got %v", i+1, err)
+		}
+	}
+	if _, err := env.userService.Authenticate(env.backgroundCtx, good); err != nil {
+		t.Fatalf("expected successful login, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := env.userService.Authenticate(env.backgroundCtx, bad); !errorx.Is(err, errorx.Validation) {
+			t.Fatalf("attempt %d after reset: expected Validation, got %v", i+1, err)
+		}
+	}
+
+	// 第 3 次连续失败触发锁定
+	if _, err := env.userService.Authenticate(env.backgroundCtx, bad); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation on threshold attempt, got %v", err)
+	}
+	var stored iamentity.User
+	if err := env.db.First(&stored, "username = ?", "lockout_user").Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if stored.FailedLoginCount != 3 || stored.LockoutUntil == nil {
+		t.Fatalf("expected lockout persisted, got count=%d until=%v", stored.FailedLoginCount, stored.LockoutUntil)
+	}
+	if stored.Status != svc.UserStatusActive {
+		t.Fatalf("temporary lockout must not change status, got %s", stored.Status)
+	}
+
+	// 锁定期内即使密码正确也返回 Forbidden
+	_, err := env.userService.Authenticate(env.backgroundCtx, good)
+	if !errorx.Is(err, errorx.Forbidden) || !strings.Contains(err.Error(), "临时锁定") {
+		t.Fatalf("expected Forbidden lockout, got %v", err)
+	}
+
+	// 到期自动解除，成功登录后计数清零
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := env.userService.Authenticate(env.backgroundCtx, good); err != nil {
+		t.Fatalf("expected login after lockout expiry, got %v", err)
+	}
+	var reset iamentity.User
+	if err := env.db.First(&reset, "username = ?", "lockout_user").Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if reset.FailedLoginCount != 0 || reset.LockoutUntil != nil {
+		t.Fatalf("expected counters reset, got count=%d until=%v", reset.FailedLoginCount, reset.LockoutUntil)
+	}
+}
+
+// TestUserServiceConcurrentLoginFailures 测试并发的失败登录各自计数（数据库侧原子递增，不丢失计数）
+func TestUserServiceConcurrentLoginFailures(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_LOCKOUT_THRESHOLD", "0")
+	sqlDB, err := env.db.DB()
+	if err != nil {
+		t.Fatalf("get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "concurrent_failures",
+		Email:    "concurrent_failures@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	bad := &svc.AuthenticateRequest{Username: "concurrent_failures", Password: "wrong-password"}
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := env.userService.Authenticate(env.backgroundCtx, bad); !errorx.Is(err, errorx.Validation) {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected Validation, got %v", err)
+	}
+
+	var stored iamentity.User
+	if err := env.db.First(&stored, "username = ?", "concurrent_failures").Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if stored.FailedLoginCount != attempts {
+		t.Fatalf("expected %d failures counted, got %d", attempts, stored.FailedLoginCount)
+	}
+}
+
+// TestUserServiceGetLockedUsers 测试锁定用户报表区分手动锁定与自动锁定
+func TestUserServiceGetLockedUsers(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_LOCKOUT_THRESHOLD", "2")
+	t.Setenv("AUTH_LOCKOUT_DURATION", "1h")
+
+	register := func(username string) *iamentity.User {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		return user
+	}
+	manual := register("manual_locked")
+	auto := register("auto_locked")
+	register("not_locked")
+
+	// 管理员手动锁定
+	if err := env.userService.LockUser(env.backgroundCtx, manual.GetID()); err != nil {
+		t.Fatalf("LockUser failed: %v", err)
+	}
+	// 连续登录失败自动锁定
+	bad := &svc.AuthenticateRequest{Username: "auto_locked", Password: "wrong-password"}
+	for i := 0; i < 2; i++ {
+		if _, err := env.userService.Authenticate(env.backgroundCtx, bad); !errorx.Is(err, errorx.Validation) {
+			t.Fatalf("attempt %d: expected Validation, got %v", i+1, err)
+		}
+	}
+
+	locked, err := env.userService.GetLockedUsers(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("GetLockedUsers failed: %v", err)
+	}
+	if len(locked) != 2 {
+		t.Fatalf("expected 2 locked users, got %d", len(locked))
+	}
+	byID := make(map[int64]*svc.LockedUser, len(locked))
+	for _, l := range locked {
+		byID[l.UserID] = l
+	}
+	if l := byID[manual.GetID()]; l == nil || l.Reason != iamentity.LockReasonManual || l.LockedAt == nil || l.LockoutUntil != nil {
+		t.Fatalf("unexpected manual lock entry: %+v", l)
+	}
+	if l := byID[auto.GetID()]; l == nil || l.Reason != iamentity.LockReasonFailedLogins || l.LockedAt == nil || l.LockoutUntil == nil {
+		t.Fatalf("unexpected auto lock entry: %+v", l)
+	}
+
+	// 解锁后不再出现，锁定原因被清除
+	if err := env.userService.UnlockUser(env.backgroundCtx, manual.GetID()); err != nil {
+		t.Fatalf("UnlockUser failed: %v", err)
+	}
+	var stored iamentity.User
+	if err := env.db.First(&stored, manual.GetID()).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if stored.LockReason != "" || stored.LockAt != nil {
+		t.Fatalf("expected lock info cleared, got reason=%q at=%v", stored.LockReason, stored.LockAt)
+	}
+	locked, err = env.userService.GetLockedUsers(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("GetLockedUsers failed: %v", err)
+	}
+	if len(locked) != 1 || locked[0].UserID != auto.GetID() {
+		t.Fatalf("expected only auto-locked user, got %+v", locked)
+	}
+}
+
+// TestUserServiceDeleteRestorePurge 测试用户软删、恢复与物理删除，以及“最后一个系统管理员”规则
+func TestUserServiceDeleteRestorePurge(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	register := func(username string) *iamentity.User {
+		user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		return user
+	}
+	alice := register("delete_alice")
+	bob := register("delete_bob")
+	adminRole := env.createTestRole(t, svc.SystemAdminRoleName, []string{"*"})
+	if err := env.userService.AssignRole(env.backgroundCtx, alice.GetID(), adminRole.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+
+	// 唯一的系统管理员不能删除
+	if err := env.userService.DeleteUser(env.backgroundCtx, alice.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for last system admin, got %v", err)
+	}
+	if err := env.userService.PurgeUser(env.backgroundCtx, alice.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation purging last system admin, got %v", err)
+	}
+
+	// 存在其他管理员时可以软删
+	if err := env.userService.AssignRole(env.backgroundCtx, bob.GetID(), adminRole.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	if err := env.userService.DeleteUser(env.backgroundCtx, alice.GetID()); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	if _, err := env.userRepo.GetByID(env.backgroundCtx, alice.GetID()); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound after soft delete, got %v", err)
+	}
+	deleted, err := env.userRepo.GetByIDWithDeleted(env.backgroundCtx, alice.GetID())
+	if err != nil || deleted.DeletedAt == nil {
+		t.Fatalf("expected soft-deleted record, got %+v, %v", deleted, err)
+	}
+
+	// bob 此时是唯一有效的管理员
+	if err := env.userService.DeleteUser(env.backgroundCtx, bob.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for remaining system admin, got %v", err)
+	}
+
+	// 恢复
+	restored, err := env.userService.RestoreUser(env.backgroundCtx, alice.GetID())
+	if err != nil {
+		t.Fatalf("RestoreUser failed: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Password != "" {
+		t.Fatalf("unexpected restored user: deleted_at=%v", restored.DeletedAt)
+	}
+	if _, err := env.userRepo.GetByID(env.backgroundCtx, alice.GetID()); err != nil {
+		t.Fatalf("expected user visible after restore, got %v", err)
+	}
+
+	// 已软删的用户可直接物理删除，关联一并清理
+	if err := env.userService.DeleteUser(env.backgroundCtx, alice.GetID()); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+
+	// 已软删用户的用户名与邮箱仍被占用：返回 Validation 而不是数据库错误
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "delete_alice",
+		Email:    "delete_alice_new@example.com",
+		Password: "password123",
+	}); !errorx.Is(err, errorx.Validation) || !strings.Contains(err.Error(), "用户名已被占用") {
+		t.Fatalf("expected Validation reusing soft-deleted username, got %v", err)
+	}
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "delete_alice_new",
+		Email:    "delete_alice@example.com",
+		Password: "password123",
+	}); !errorx.Is(err, errorx.Validation) || !strings.Contains(err.Error(), "邮箱已被占用") {
+		t.Fatalf("expected Validation reusing soft-deleted email, got %v", err)
+	}
+	if _, err := env.userService.ChangeUsername(env.backgroundCtx, bob.GetID(), "delete_alice"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation renaming to soft-deleted username, got %v", err)
+	}
+	usernameOK, emailOK, err := env.userService.CheckAvailability(env.backgroundCtx, "Delete_Alice", "delete_alice@example.com")
+	if err != nil {
+		t.Fatalf("CheckAvailability failed: %v", err)
+	}
+	if usernameOK || emailOK {
+		t.Fatalf("expected soft-deleted username/email unavailable, got %v/%v", usernameOK, emailOK)
+	}
+	if err := env.userService.PurgeUser(env.backgroundCtx, alice.GetID()); err != nil {
+		t.Fatalf("PurgeUser failed: %v", err)
+	}
+	if _, err := env.userRepo.GetByIDWithDeleted(env.backgroundCtx, alice.GetID()); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound after purge, got %v", err)
+	}
+	var links int64
+	if err := env.db.Table("user_roles").Where("user_id = ?", alice.GetID()).Count(&links).Error; err != nil {
+		t.Fatalf("count user_roles: %v", err)
+	}
+	if links != 0 {
+		t.Fatalf("expected role links purged, got %d", links)
+	}
+
+	// 物理删除后用户名可重新使用
+	register("delete_alice")
+
+	// 不存在的用户
+	if _, err := env.userService.RestoreUser(env.backgroundCtx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound restoring missing user, got %v", err)
+	}
+}
+
+// TestUserServiceTOTPTwoFactor 测试 TOTP 两步验证的启用、登录与关闭
+func TestUserServiceTOTPTwoFactor(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_SECRET", "totp-integration-secret")
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "totp_admin",
+		Email:    "totp@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	login := &svc.AuthenticateRequest{Username: "totp_admin", Password: "password123"}
+
+	setup, err := env.userService.EnableTOTP(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("EnableTOTP failed: %v", err)
+	}
+	if setup.Secret == "" || !strings.HasPrefix(setup.URL, "otpauth://totp/") || !strings.Contains(setup.URL, "secret="+setup.Secret) {
+		t.Fatalf("unexpected setup: %+v", setup)
+	}
+
+	// 密钥密文存储
+	var stored iamentity.User
+	if err := env.db.First(&stored, user.GetID()).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if stored.TOTPSecret == "" || stored.TOTPSecret == setup.Secret || stored.TwoFactorEnabled {
+		t.Fatalf("expected encrypted pending secret, got enabled=%v", stored.TwoFactorEnabled)
+	}
+
+	// 确认前登录不受影响
+	result, err := env.userService.Authenticate(env.backgroundCtx, login)
+	if err != nil || result.TwoFactorRequired {
+		t.Fatalf("expected normal login before confirmation, got %+v, %v", result, err)
+	}
+
+	// 错误验证码不能确认
+	if err := env.userService.ConfirmTOTP(env.backgroundCtx, user.GetID(), "000000x"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for bad code, got %v", err)
+	}
+	code, err := usersvc.GenerateTOTPCode(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateTOTPCode failed: %v", err)
+	}
+	if err := env.userService.ConfirmTOTP(env.backgroundCtx, user.GetID(), code); err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+
+	// 启用后登录仅返回部分结果
+	result, err = env.userService.Authenticate(env.backgroundCtx, login)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if !result.TwoFactorRequired || len(result.Roles) != 0 || len(result.Permissions) != 0 {
+		t.Fatalf("expected partial result requiring second factor, got %+v", result)
+	}
+
+	// 第二因子
+	if _, err := env.userService.CompleteTwoFactorLogin(env.backgroundCtx, user.GetID(), "123"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for bad code, got %v", err)
+	}
+	// 确认时使用过的验证码不能再用于登录
+	if _, err := env.userService.CompleteTwoFactorLogin(env.backgroundCtx, user.GetID(), code); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for replayed confirmation code, got %v", err)
+	}
+	code, _ = usersvc.GenerateTOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	full, err := env.userService.CompleteTwoFactorLogin(env.backgroundCtx, user.GetID(), code)
+	if err != nil {
+		t.Fatalf("CompleteTwoFactorLogin failed: %v", err)
+	}
+	if full.TwoFactorRequired || full.UserID != user.GetID() {
+		t.Fatalf("unexpected full result: %+v", full)
+	}
+	if _, err := env.userService.CompleteTwoFactorLogin(env.backgroundCtx, user.GetID(), code); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for replayed code, got %v", err)
+	}
+	if err := env.userService.VerifyTOTP(env.backgroundCtx, user.GetID(), code); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for replayed code via VerifyTOTP, got %v", err)
+	}
+
+	// 关闭需要当前密码
+	if err := env.userService.DisableTOTP(env.backgroundCtx, user.GetID(), "wrong-password"); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for wrong password, got %v", err)
+	}
+	if err := env.userService.DisableTOTP(env.backgroundCtx, user.GetID(), "password123"); err != nil {
+		t.Fatalf("DisableTOTP failed: %v", err)
+	}
+	result, err = env.userService.Authenticate(env.backgroundCtx, login)
+	if err != nil || result.TwoFactorRequired {
+		t.Fatalf("expected normal login after disable, got %+v, %v", result, err)
+	}
+	if err := env.userService.VerifyTOTP(env.backgroundCtx, user.GetID(), code); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation when 2FA disabled, got %v", err)
+	}
+}
+
+// TestUserServiceTOTPFailuresCountTowardLockout 测试两步验证码错误与密码错误共用登录失败计数
+func TestUserServiceTOTPFailuresCountTowardLockout(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	t.Setenv("AUTH_SECRET", "totp-integration-secret")
+	t.Setenv("AUTH_LOCKOUT_THRESHOLD", "3")
+	ctx := env.backgroundCtx
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "totp_lockout",
+		Email:    "totp_lockout@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	setup, err := env.userService.EnableTOTP(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("EnableTOTP failed: %v", err)
+	}
+	code, _ := usersvc.GenerateTOTPCode(setup.Secret, time.Now())
+	if err := env.userService.ConfirmTOTP(ctx, user.GetID(), code); err != nil {
+		t.Fatalf("ConfirmTOTP failed: %v", err)
+	}
+
+	// 密码错误一次；密码正确不清除计数（待第二因子通过）
+	if _, err := env.userService.Authenticate(ctx, &svc.AuthenticateRequest{Username: "totp_lockout", Password: "wrong-password"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for wrong password, got %v", err)
+	}
+	if _, err := env.userService.Authenticate(ctx, &svc.AuthenticateRequest{Username: "totp_lockout", Password: "password123"}); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	// 两次验证码错误后达到阈值，临时锁定
+	for i := 0; i < 2; i++ {
+		if _, err := env.userService.CompleteTwoFactorLogin(ctx, user.GetID(), "000000"); !errorx.Is(err, errorx.Validation) {
+			t.Fatalf("expected Validation for bad code, got %v", err)
+		}
+	}
+	next, _ := usersvc.GenerateTOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	if _, err := env.userService.CompleteTwoFactorLogin(ctx, user.GetID(), next); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden while locked out, got %v", err)
+	}
+	if _, err := env.userService.Authenticate(ctx, &svc.AuthenticateRequest{Username: "totp_lockout", Password: "password123"}); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden login while locked out, got %v", err)
+	}
+}
+
+// TestUserServiceGetUserTenants 测试多租户成员关系查询
+func TestUserServiceGetUserTenants(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	newTenant := func(key, status string) *iamentity.Tenant {
+		tenant := &iamentity.Tenant{Key: key, Name: key, Status: status}
+		if err := env.db.Create(tenant).Error; err != nil {
+			t.Fatalf("create tenant %s: %v", key, err)
+		}
+		return tenant
+	}
+	tenantA := newTenant("tenant-a", "active")
+	tenantB := newTenant("tenant-b", "active")
+	inactive := newTenant("tenant-off", "inactive")
+
+	multi, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "multi_tenant", Email: "multi@example.com", Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	single, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "single_tenant", Email: "single@example.com", Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	for _, tenantID := range []int64{tenantB.GetID(), tenantA.GetID(), inactive.GetID()} {
+		if err := env.userService.AddToTenant(env.backgroundCtx, multi.GetID(), tenantID); err != nil {
+			t.Fatalf("AddToTenant failed: %v", err)
+		}
+	}
+	// 重复加入保持幂等
+	if err := env.userService.AddToTenant(env.backgroundCtx, multi.GetID(), tenantA.GetID()); err != nil {
+		t.Fatalf("AddToTenant (repeat) failed: %v", err)
+	}
+	if err := env.userService.AddToTenant(env.backgroundCtx, single.GetID(), tenantB.GetID()); err != nil {
+		t.Fatalf("AddToTenant failed: %v", err)
+	}
+
+	// 多租户用户：仅返回 active 租户，按 ID 排序
+	tenants, err := env.userService.GetUserTenants(env.backgroundCtx, multi.GetID())
+	if err != nil {
+		t.Fatalf("GetUserTenants failed: %v", err)
+	}
+	if len(tenants) != 2 || tenants[0].GetID() != tenantA.GetID() || tenants[1].GetID() != tenantB.GetID() {
+		t.Fatalf("expected [tenant-a tenant-b], got %+v", tenants)
+	}
+
+	// 单租户用户
+	tenants, err = env.userService.GetUserTenants(env.backgroundCtx, single.GetID())
+	if err != nil {
+		t.Fatalf("GetUserTenants failed: %v", err)
+	}
+	if len(tenants) != 1 || tenants[0].Key != "tenant-b" {
+		t.Fatalf("expected [tenant-b], got %+v", tenants)
+	}
+
+	// 移出后不再可见
+	if err := env.userService.RemoveFromTenant(env.backgroundCtx, single.GetID(), tenantB.GetID()); err != nil {
+		t.Fatalf("RemoveFromTenant failed: %v", err)
+	}
+	tenants, err = env.userService.GetUserTenants(env.backgroundCtx, single.GetID())
+	if err != nil {
+		t.Fatalf("GetUserTenants failed: %v", err)
+	}
+	if len(tenants) != 0 {
+		t.Fatalf("expected no tenants after removal, got %+v", tenants)
+	}
+
+	// 不存在的用户/租户
+	if _, err := env.userService.GetUserTenants(env.backgroundCtx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+	if err := env.userService.AddToTenant(env.backgroundCtx, single.GetID(), 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing tenant, got %v", err)
+	}
+}
+
+// TestUserServiceAuthenticateRehashesLowCostPassword 测试登录时透明升级低成本密码哈希
+func TestUserServiceAuthenticateRehashesLowCostPassword(t *testing.T) {
+	t.Setenv("AUTH_BCRYPT_COST", "5")
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "rehash_user",
+		Email:    "rehash@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// 模拟以较低成本生成的存量哈希
+	lowCost, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword failed: %v", err)
+	}
+	if err := env.db.Model(&iamentity.User{}).Where("id = ?", user.GetID()).Update("password_hash", string(lowCost)).Error; err != nil {
+		t.Fatalf("downgrade hash: %v", err)
+	}
+
+	storedCost := func() int {
+		var stored iamentity.User
+		if err := env.db.First(&stored, user.GetID()).Error; err != nil {
+			t.Fatalf("load user: %v", err)
+		}
+		cost, err := bcrypt.Cost([]byte(stored.Password))
+		if err != nil {
+			t.Fatalf("bcrypt.Cost failed: %v", err)
+		}
+		return cost
+	}
+
+	// 错误密码不升级
+	login := &svc.AuthenticateRequest{Username: "rehash_user", Password: "password123"}
+	if _, err := env.userService.Authenticate(env.backgroundCtx, &svc.AuthenticateRequest{Username: "rehash_user", Password: "wrong-password"}); err == nil {
+		t.Fatal("expected wrong password to fail")
+	}
+	if cost := storedCost(); cost != bcrypt.MinCost {
+		t.Fatalf("expected hash untouched after failed login, got cost %d", cost)
+	}
+
+	// 正确登录后升级到配置成本
+	if _, err := env.userService.Authenticate(env.backgroundCtx, login); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if cost := storedCost(); cost != 5 {
+		t.Fatalf("expected hash upgraded to cost 5, got %d", cost)
+	}
+
+	// 升级后仍可正常登录
+	if _, err := env.userService.Authenticate(env.backgroundCtx, login); err != nil {
+		t.Fatalf("Authenticate after rehash failed: %v", err)
+	}
+}
+
+// TestUserServiceGetMyAccessChanges 测试用户查看自身角色授予/移除记录
+func TestUserServiceGetMyAccessChanges(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "access_changes",
+		Email:    "access_changes@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	other, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "access_bystander",
+		Email:    "access_bystander@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	editor := env.createTestRole(t, "editor_role", []string{"doc:edit"})
+	viewer := env.createTestRole(t, "viewer_role", []string{"doc:read"})
+
+	start := time.Now().Add(-time.Second)
+	if err := env.userService.AssignRole(env.backgroundCtx, user.GetID(), editor.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	if err := roleService.AssignRoleToUser(env.backgroundCtx, viewer.GetID(), user.GetID()); err != nil {
+		t.Fatalf("AssignRoleToUser failed: %v", err)
+	}
+	if err := env.userService.RemoveRole(env.backgroundCtx, user.GetID(), editor.GetID()); err != nil {
+		t.Fatalf("RemoveRole failed: %v", err)
+	}
+	if err := env.userService.AssignRole(env.backgroundCtx, other.GetID(), editor.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+
+	changes, err := env.userService.GetMyAccessChanges(env.backgroundCtx, user.GetID(), start)
+	if err != nil {
+		t.Fatalf("GetMyAccessChanges failed: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes for user, got %d: %+v", len(changes), changes)
+	}
+
+	// 倒序：最近一次为移除 editor
+	latest := changes[0]
+	if latest.Action != iamentity.RoleChangeRevoked || latest.RoleID != editor.GetID() || latest.RoleName != editor.Name {
+		t.Fatalf("expected latest change to be editor revoked, got %+v", latest)
+	}
+	granted := map[int64]bool{}
+	for _, c := range changes[1:] {
+		if c.UserID != user.GetID() || c.Action != iamentity.RoleChangeGranted {
+			t.Fatalf("unexpected change: %+v", c)
+		}
+		granted[c.RoleID] = true
+	}
+	if !granted[editor.GetID()] || !granted[viewer.GetID()] {
+		t.Fatalf("expected editor and viewer grants, got %+v", changes)
+	}
+
+	// since 之后无变更
+	changes, err = env.userService.GetMyAccessChanges(env.backgroundCtx, user.GetID(), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetMyAccessChanges failed: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes after since, got %+v", changes)
+	}
+
+	// 其他用户仅看到自己的变更
+	changes, err = env.userService.GetMyAccessChanges(env.backgroundCtx, other.GetID(), time.Time{})
+	if err != nil {
+		t.Fatalf("GetMyAccessChanges failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].UserID != other.GetID() {
+		t.Fatalf("expected only bystander's own change, got %+v", changes)
+	}
+}
+
+// TestRoleServiceUpdateRole_RejectsParentCycle 测试角色继承链路的环检测
+func TestRoleServiceUpdateRole_RejectsParentCycle(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	roleA := env.createTestRole(t, "cycle_role_a", []string{"perm:a"})
+	roleB := env.createTestRole(t, "cycle_role_b", []string{"perm:b"})
+	roleC := env.createTestRole(t, "cycle_role_c", []string{"perm:c"})
+	parentOf := func(id int64) *int64 { return &id }
+
+	// 角色 A 的持有者：父角色变化改变继承的权限，开启吊销时其 token 失效
+	const secret = "parent-change-secret"
+	holder, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "cycle_holder",
+		Email:    "cycle_holder@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register holder: %v", err)
+	}
+	if err := env.userService.AssignRole(env.backgroundCtx, holder.GetID(), roleA.GetID()); err != nil {
+		t.Fatalf("assign role A: %v", err)
+	}
+	roleService.SetRevokeSessionsOnChange(true)
+
+	// A → B
+	token, err := iammw.GenerateToken(holder.GetID(), holder.Username, nil, nil, secret)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	updated, err := roleService.UpdateRole(env.backgroundCtx, roleA.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(roleB.GetID())})
+	if err != nil {
+		t.Fatalf("UpdateRole A->B failed: %v", err)
+	}
+	if updated.ParentRoleID == nil || *updated.ParentRoleID != roleB.GetID() {
+		t.Fatalf("expected parent B, got %v", updated.ParentRoleID)
+	}
+	if claims, err := iammw.ParseToken(token, secret); err != nil || !iammw.IsTokenRevoked(claims) {
+		t.Fatalf("expected holder's token revoked after parent change, got %v", err)
+	}
+
+	// 父角色未变化时不吊销
+	time.Sleep(1100 * time.Millisecond)
+	token, err = iammw.GenerateToken(holder.GetID(), holder.Username, nil, nil, secret)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if _, err := roleService.UpdateRole(env.backgroundCtx, roleA.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(roleB.GetID())}); err != nil {
+		t.Fatalf("UpdateRole A->B again failed: %v", err)
+	}
+	if claims, err := iammw.ParseToken(token, secret); err != nil || iammw.IsTokenRevoked(claims) {
+		t.Fatalf("expected holder's token kept when parent unchanged, got %v", err)
+	}
+
+	// B → A 形成直接环
+	if _, err := roleService.UpdateRole(env.backgroundCtx, roleB.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(roleA.GetID())}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for B->A cycle, got %v", err)
+	}
+
+	// B → C 后 C → A 形成间接环（A → B → C → A）
+	if _, err := roleService.UpdateRole(env.backgroundCtx, roleB.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(roleC.GetID())}); err != nil {
+		t.Fatalf("UpdateRole B->C failed: %v", err)
+	}
+	if _, err := roleService.UpdateRole(env.backgroundCtx, roleC.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(roleA.GetID())}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for C->A cycle, got %v", err)
+	}
+
+	// 指向自身 / 不存在的父角色
+	if _, err := roleService.UpdateRole(env.backgroundCtx, roleC.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(roleC.GetID())}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for self parent, got %v", err)
+	}
+	if _, err := roleService.UpdateRole(env.backgroundCtx, roleC.GetID(), &svc.UpdateRoleRequest{ParentRoleID: parentOf(99999)}); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing parent, got %v", err)
+	}
+
+	// 被拒绝的更新未落库
+	stored, err := env.roleRepo.GetByID(env.backgroundCtx, roleC.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.ParentRoleID != nil {
+		t.Fatalf("expected role C without parent, got %v", *stored.ParentRoleID)
+	}
+
+	// 创建时同样校验父角色（注册权限码以通过严格权限字典校验）
+	iammw.RegisterRequiredPermissions("perm:child")
+	child, err := roleService.CreateRole(env.backgroundCtx, &svc.CreateRoleRequest{
+		Name:         "cycle_role_child",
+		Permissions:  []string{"perm:child"},
+		ParentRoleID: parentOf(roleA.GetID()),
+	})
+	if err != nil {
+		t.Fatalf("CreateRole with parent failed: %v", err)
+	}
+	if child.ParentRoleID == nil || *child.ParentRoleID != roleA.GetID() {
+		t.Fatalf("expected parent A, got %v", child.ParentRoleID)
+	}
+}
+
+// TestRoleServiceParentRoleInheritance 测试角色继承：子角色在用户权限快照中获得父链路上 active 角色的权限
+func TestRoleServiceParentRoleInheritance(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	staff := env.createTestRole(t, "inherit_staff", []string{"doc:read"})
+	employee := env.createTestRole(t, "inherit_employee", []string{"leave:apply"})
+	manager := env.createTestRole(t, "inherit_manager", []string{"leave:approve"})
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "inherit_user",
+		Email:    "inherit_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	if err := env.userService.AssignRole(ctx, user.GetID(), manager.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+
+	// manager → employee → staff
+	if _, err := roleService.SetParentRole(ctx, manager.GetID(), employee.GetID()); err != nil {
+		t.Fatalf("SetParentRole manager->employee failed: %v", err)
+	}
+	if _, err := roleService.SetParentRole(ctx, employee.GetID(), staff.GetID()); err != nil {
+		t.Fatalf("SetParentRole employee->staff failed: %v", err)
+	}
+
+	snapshot := func() (string, string) {
+		t.Helper()
+		auth, err := env.userService.GetAuthSnapshot(ctx, user.GetID())
+		if err != nil {
+			t.Fatalf("GetAuthSnapshot failed: %v", err)
+		}
+		return strings.Join(auth.Roles, ","), strings.Join(auth.Permissions, ",")
+	}
+
+	roles, permissions := snapshot()
+	if roles != "inherit_manager" {
+		t.Fatalf("expected only assigned role name, got %q", roles)
+	}
+	if permissions != "doc:read,leave:apply,leave:approve" {
+		t.Fatalf("expected inherited permissions, got %q", permissions)
+	}
+	if effective, err := roleService.GetEffectivePermissions(ctx, manager.GetID()); err != nil || strings.Join(effective, ",") != permissions {
+		t.Fatalf("expected role effective permissions %q, got %v, %v", permissions, effective, err)
+	}
+
+	// 形成环的父角色设置被拒绝
+	if _, err := roleService.SetParentRole(ctx, staff.GetID(), manager.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for staff->manager cycle, got %v", err)
+	}
+
+	// 停用中间角色：其权限不再贡献，链路上更远的 active 角色仍然贡献
+	if err := roleService.DeactivateRole(ctx, employee.GetID()); err != nil {
+		t.Fatalf("DeactivateRole failed: %v", err)
+	}
+	if _, permissions := snapshot(); permissions != "doc:read,leave:approve" {
+		t.Fatalf("expected inactive parent skipped, got %q", permissions)
+	}
+
+	// 清除父角色后不再继承
+	cleared, err := roleService.ClearParentRole(ctx, manager.GetID())
+	if err != nil {
+		t.Fatalf("ClearParentRole failed: %v", err)
+	}
+	if cleared.ParentRoleID != nil {
+		t.Fatalf("expected parent cleared, got %v", *cleared.ParentRoleID)
+	}
+	stored, err := env.roleRepo.GetByID(ctx, manager.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if stored.ParentRoleID != nil {
+		t.Fatalf("expected parent cleared in storage, got %v", *stored.ParentRoleID)
+	}
+	if _, permissions := snapshot(); permissions != "leave:approve" {
+		t.Fatalf("expected no inherited permissions, got %q", permissions)
+	}
+}
+
+func TestRoleServiceCloneRoleWithGroupAssignments(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	source := env.createTestRole(t, "clone_source", []string{"perm:clone"})
+	groupA := env.createTestGroup(t, "clone_group_a", nil)
+	groupB := env.createTestGroup(t, "clone_group_b", nil)
+	for _, g := range []*iamentity.Group{groupA, groupB} {
+		if err := env.roleRepo.AssignToGroup(env.backgroundCtx, source.GetID(), g.GetID()); err != nil {
+			t.Fatalf("AssignToGroup failed: %v", err)
+		}
+	}
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "clone_user",
+		Email:    "clone_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	if err := env.userRepo.AssignRole(env.backgroundCtx, user.GetID(), source.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+
+	// 默认仅复制权限
+	plain, err := roleService.CloneRole(env.backgroundCtx, source.GetID(), "clone_plain")
+	if err != nil {
+		t.Fatalf("CloneRole failed: %v", err)
+	}
+	if groups, err := env.groupRepo.FindByDefaultRoleID(env.backgroundCtx, plain.GetID()); err != nil || len(groups) != 0 {
+		t.Fatalf("expected no group links on plain clone, got %d (%v)", len(groups), err)
+	}
+
+	// 组织成员的权限快照已缓存、token 已签发
+	const secret = "clone-groups-secret"
+	svc.SetDefaultPermissionCache(svc.NewMemoryPermissionCache(time.Minute, 0))
+	defer svc.SetDefaultPermissionCache(nil)
+	member, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "clone_member",
+		Email:    "clone_member@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register member: %v", err)
+	}
+	if err := env.groupService.AddUserToGroup(env.backgroundCtx, groupA.GetID(), member.GetID()); err != nil {
+		t.Fatalf("add member to group: %v", err)
+	}
+	if _, err := env.userService.GetAuthSnapshot(env.backgroundCtx, member.GetID()); err != nil {
+		t.Fatalf("GetAuthSnapshot failed: %v", err)
+	}
+	token, err := iammw.GenerateToken(member.GetID(), member.Username, nil, nil, secret)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	roleService.SetRevokeSessionsOnChange(true)
+
+	// 复制组织默认角色关联
+	cloned, err := roleService.CloneRoleWithOptions(env.backgroundCtx, source.GetID(), "clone_with_groups", svc.CloneRoleOptions{CopyGroupAssignments: true})
+	if err != nil {
+		t.Fatalf("CloneRoleWithOptions failed: %v", err)
+	}
+
+	// 组织成员经默认角色获得克隆角色：缓存失效、token 吊销
+	snapshot, err := env.userService.GetAuthSnapshot(env.backgroundCtx, member.GetID())
+	if err != nil {
+		t.Fatalf("GetAuthSnapshot failed: %v", err)
+	}
+	if !strings.Contains(strings.Join(snapshot.Roles, ","), "clone_with_groups") {
+		t.Fatalf("expected cloned role in member snapshot, got %v", snapshot.Roles)
+	}
+	if claims, err := iammw.ParseToken(token, secret); err != nil || !iammw.IsTokenRevoked(claims) {
+		t.Fatalf("expected member token revoked after clone, got %v", err)
+	}
+	groups, err := env.groupRepo.FindByDefaultRoleID(env.backgroundCtx, cloned.GetID())
+	if err != nil {
+		t.Fatalf("FindByDefaultRoleID failed: %v", err)
+	}
+	linked := map[int64]bool{}
+	for _, g := range groups {
+		linked[g.GetID()] = true
+	}
+	if len(groups) != 2 || !linked[groupA.GetID()] || !linked[groupB.GetID()] {
+		t.Fatalf("expected clone linked to both groups, got %v", linked)
+	}
+	if len(cloned.Permissions) != 1 || cloned.Permissions[0] != "perm:clone" {
+		t.Fatalf("expected permissions copied, got %v", cloned.Permissions)
+	}
+
+	// 用户分配不复制
+	users, err := env.userRepo.FindByRoleID(env.backgroundCtx, cloned.GetID())
+	if err != nil {
+		t.Fatalf("FindByRoleID failed: %v", err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("expected no users on clone, got %d", len(users))
+	}
+}
+
+// TestUserServiceGetGroupMembershipHistory 测试加入后离开组织产生两条按时间排序的记录
+func TestUserServiceGetGroupMembershipHistory(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "history_user",
+		Email:    "history_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	group := env.createTestGroup(t, "history_group", nil)
+
+	if err := env.userService.AssignToGroup(env.backgroundCtx, user.GetID(), group.GetID()); err != nil {
+		t.Fatalf("AssignToGroup failed: %v", err)
+	}
+	if err := env.userService.RemoveFromGroup(env.backgroundCtx, user.GetID(), group.GetID()); err != nil {
+		t.Fatalf("RemoveFromGroup failed: %v", err)
+	}
+
+	changes, err := env.userService.GetGroupMembershipHistory(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetGroupMembershipHistory failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+	if changes[0].Action != iamentity.GroupMembershipJoined || changes[1].Action != iamentity.GroupMembershipLeft {
+		t.Fatalf("expected joined then left, got %s, %s", changes[0].Action, changes[1].Action)
+	}
+	for _, c := range changes {
+		if c.GroupID != group.GetID() || c.GroupName != "history_group" {
+			t.Fatalf("unexpected change: %+v", c)
+		}
+	}
+	if changes[1].ChangedAt.Before(changes[0].ChangedAt) {
+		t.Fatalf("expected chronological order, got %v then %v", changes[0].ChangedAt, changes[1].ChangedAt)
+	}
+
+	// 用户不存在
+	if _, err := env.userService.GetGroupMembershipHistory(env.backgroundCtx, 99999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+}
+
+// capturingEventBus 记录发布的事件（仅实现 PublishEvent，其余方法不应被调用）
+type capturingEventBus struct {
+	bus.IEventBus
+	events []eventing.IEvent
+}
+
+func (b *capturingEventBus) PublishEvent(_ context.Context, evt eventing.IEvent) error {
+	b.events = append(b.events, evt)
+	return nil
+}
+
+func TestUserServiceLifecycleEvents(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	eventBus := &capturingEventBus{}
+	userService := usersvc.NewUserService(env.userRepo, env.groupRepo, env.roleRepo, env.tenantRepo, eventBus)
+	ctx := env.backgroundCtx
+
+	lastEvent := func(expectedType string) interface{} {
+		t.Helper()
+		if len(eventBus.events) == 0 {
+			t.Fatalf("expected %s event, got none", expectedType)
+		}
+		evt := eventBus.events[len(eventBus.events)-1]
+		if evt.GetType() != expectedType {
+			t.Fatalf("expected event type %s, got %s", expectedType, evt.GetType())
+		}
+		return evt.GetPayload()
+	}
+
+	// 注册
+	user, err := userService.Register(ctx, &svc.RegisterRequest{
+		Username: "event_user",
+		Email:    "event_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	registered, ok := lastEvent("UserRegistered").(*iamevent.UserRegistered)
+	if !ok || registered.UserID != user.GetID() || registered.Username != "event_user" ||
+		registered.Email != "event_user@example.com" || registered.Status != "active" {
+		t.Fatalf("unexpected UserRegistered payload: %+v", registered)
+	}
+
+	// 修改密码
+	if err := userService.ChangePassword(ctx, user.GetID(), &svc.ChangePasswordRequest{
+		OldPassword: "password123",
+		NewPassword: "newpassword456",
+	}); err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+	changed, ok := lastEvent("PasswordChanged").(*iamevent.PasswordChanged)
+	if !ok || changed.UserID != user.GetID() || changed.Source != "change" {
+		t.Fatalf("unexpected PasswordChanged payload: %+v", changed)
+	}
+
+	// 锁定 / 解锁
+	if err := userService.LockUser(ctx, user.GetID()); err != nil {
+		t.Fatalf("LockUser failed: %v", err)
+	}
+	locked, ok := lastEvent("UserLocked").(*iamevent.UserLocked)
+	if !ok || locked.UserID != user.GetID() || locked.Reason != iamentity.LockReasonManual || locked.LockedAt.IsZero() {
+		t.Fatalf("unexpected UserLocked payload: %+v", locked)
+	}
+	if err := userService.UnlockUser(ctx, user.GetID()); err != nil {
+		t.Fatalf("UnlockUser failed: %v", err)
+	}
+	unlocked, ok := lastEvent("UserUnlocked").(*iamevent.UserUnlocked)
+	if !ok || unlocked.UserID != user.GetID() {
+		t.Fatalf("unexpected UserUnlocked payload: %+v", unlocked)
+	}
+
+	// 分配 / 移除角色（与 RoleService 一致发布，供权限缓存失效订阅）
+	role := env.createTestRole(t, "event_role", []string{"perm:event"})
+	if err := userService.AssignRole(ctx, user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	assigned, ok := lastEvent("UserRoleAssigned").(*iamevent.UserRoleAssigned)
+	if !ok || assigned.UserID != user.GetID() || assigned.RoleID != role.GetID() || assigned.RoleCode != role.Code {
+		t.Fatalf("unexpected UserRoleAssigned payload: %+v", assigned)
+	}
+	if err := userService.RemoveRole(ctx, user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("RemoveRole failed: %v", err)
+	}
+	removed, ok := lastEvent("UserRoleRemoved").(*iamevent.UserRoleRemoved)
+	if !ok || removed.UserID != user.GetID() || removed.RoleID != role.GetID() {
+		t.Fatalf("unexpected UserRoleRemoved payload: %+v", removed)
+	}
+
+	// 停用角色不可分配
+	if err := env.db.Model(&iamentity.Role{}).Where("id = ?", role.GetID()).Update("status", svc.RoleStatusInactive).Error; err != nil {
+		t.Fatalf("deactivate role: %v", err)
+	}
+	if err := userService.AssignRole(ctx, user.GetID(), role.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for inactive role, got %v", err)
+	}
+
+	// 停用
+	if err := userService.DeactivateUser(ctx, user.GetID()); err != nil {
+		t.Fatalf("DeactivateUser failed: %v", err)
+	}
+	deactivated, ok := lastEvent("UserDeactivated").(*iamevent.UserDeactivated)
+	if !ok || deactivated.UserID != user.GetID() || deactivated.DeactivatedAt.IsZero() {
+		t.Fatalf("unexpected UserDeactivated payload: %+v", deactivated)
+	}
+
+	for _, evt := range eventBus.events {
+		typed, ok := evt.(eventing.ITypedEvent[int64])
+		if !ok || typed.GetAggregateID() != user.GetID() || evt.GetAggregateType() != "user" {
+			t.Fatalf("unexpected aggregate on %s: %+v", evt.GetType(), evt)
+		}
+	}
+	if len(eventBus.events) != 7 {
+		t.Fatalf("expected 7 events, got %d", len(eventBus.events))
+	}
+
+	// 失败操作不发布事件
+	if err := userService.LockUser(ctx, 99999); err == nil {
+		t.Fatal("expected error for missing user")
+	}
+	if len(eventBus.events) != 7 {
+		t.Fatalf("expected no event for failed operation, got %d", len(eventBus.events))
+	}
+}
+
+// TestUserServiceGetUsersWithExpiringPasswords 测试密码即将过期用户报表
+func TestUserServiceGetUsersWithExpiringPasswords(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	register := func(username string) *iamentity.User {
+		user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if user.PasswordChangedAt == nil {
+			t.Fatalf("expected password_changed_at set on register for %s", username)
+		}
+		return user
+	}
+	setChangedAt := func(user *iamentity.User, changedAt *time.Time) {
+		if err := env.db.Model(&iamentity.User{}).Where("id = ?", user.GetID()).Update("password_changed_at", changedAt).Error; err != nil {
+			t.Fatalf("update password_changed_at: %v", err)
+		}
+	}
+	daysAgo := func(days int) *time.Time {
+		ts := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+		return &ts
+	}
+
+	register("pwd_fresh")
+	soon := register("pwd_soon")
+	setChangedAt(soon, daysAgo(85))
+	expired := register("pwd_expired")
+	setChangedAt(expired, daysAgo(100))
+	legacy := register("pwd_legacy")
+	setChangedAt(legacy, nil)
+	if err := env.db.Model(&iamentity.User{}).Where("id = ?", legacy.GetID()).Update("created_at", *daysAgo(88)).Error; err != nil {
+		t.Fatalf("update created_at: %v", err)
+	}
+	inactive := register("pwd_inactive")
+	setChangedAt(inactive, daysAgo(100))
+	if err := env.userService.DeactivateUser(ctx, inactive.GetID()); err != nil {
+		t.Fatalf("DeactivateUser failed: %v", err)
+	}
+
+	ids := func(users []*iamentity.User) []int64 {
+		out := make([]int64, 0, len(users))
+		for _, u := range users {
+			if u.Password != "" {
+				t.Fatalf("expected password cleared for user %d", u.GetID())
+			}
+			out = append(out, u.GetID())
+		}
+		return out
+	}
+
+	// 未启用密码过期
+	users, err := env.userService.GetUsersWithExpiringPasswords(ctx, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetUsersWithExpiringPasswords failed: %v", err)
+	}
+	if len(users) != 0 {
+		t.Fatalf("expected no users when expiry disabled, got %v", ids(users))
+	}
+
+	// 90 天有效期，查询 7 天内过期（含已过期；停用用户与新密码用户不在内）
+	t.Setenv("AUTH_PASSWORD_MAX_AGE", "2160h")
+	users, err = env.userService.GetUsersWithExpiringPasswords(ctx, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetUsersWithExpiringPasswords failed: %v", err)
+	}
+	got := ids(users)
+	want := []int64{soon.GetID(), expired.GetID(), legacy.GetID()}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// 修改密码后重新计算有效期
+	if err := env.userService.ChangePassword(ctx, soon.GetID(), &svc.ChangePasswordRequest{
+		OldPassword: "password123",
+		NewPassword: "newpassword456",
+	}); err != nil {
+		t.Fatalf("ChangePassword failed: %v", err)
+	}
+	users, err = env.userService.GetUsersWithExpiringPasswords(ctx, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetUsersWithExpiringPasswords failed: %v", err)
+	}
+	got = ids(users)
+	want = []int64{expired.GetID(), legacy.GetID()}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected %v after password change, got %v", want, got)
+	}
+
+	if _, err := env.userService.GetUsersWithExpiringPasswords(ctx, -time.Hour); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for negative window, got %v", err)
+	}
+}
+
+// TestUserServiceCheckPermissionWildcard 测试通配符权限匹配
+func TestUserServiceCheckPermissionWildcard(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "wildcard_user",
+		Email:    "wildcard_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	role := env.createTestRole(t, "wildcard_role", []string{"user:*", "role:read"})
+	if err := env.userService.AssignRole(env.backgroundCtx, user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+
+	cases := []struct {
+		permission string
+		want       bool
+	}{
+		{"user:read", true},
+		{"user:delete", true},
+		{"group:read", false},
+		{"role:read", true},
+		{"role:write", false},
+	}
+	for _, c := range cases {
+		allowed, err := env.userService.CheckPermission(env.backgroundCtx, user.GetID(), c.permission)
+		if err != nil {
+			t.Fatalf("CheckPermission(%s): %v", c.permission, err)
+		}
+		if allowed != c.want {
+			t.Fatalf("CheckPermission(%s) = %v, want %v", c.permission, allowed, c.want)
+		}
+		if got := role.HasPermission(c.permission); got != c.want {
+			t.Fatalf("Role.HasPermission(%s) = %v, want %v", c.permission, got, c.want)
+		}
+	}
+
+	withRoles := &iamentity.User{Roles: []iamentity.Role{{Permissions: []string{"*"}}}}
+	if !withRoles.HasPermission("menu:write") {
+		t.Fatal("expected * to cover everything in User.HasPermission")
+	}
+}
+
+// TestUserServiceCheckPermissions 测试批量权限检查
+func TestUserServiceCheckPermissions(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "batch_check_user",
+		Email:    "batch_check_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	role := env.createTestRole(t, "batch_check_role", []string{"user:*", "role:read"})
+	if err := env.userService.AssignRole(ctx, user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("assign role: %v", err)
+	}
+
+	got, err := env.userService.CheckPermissions(ctx, user.GetID(), []string{
+		"role:read", "role:write", "user:delete", "group:read", "role:read",
+	})
+	if err != nil {
+		t.Fatalf("CheckPermissions failed: %v", err)
+	}
+	want := map[string]bool{
+		"role:read":   true,  // 直接持有
+		"role:write":  false, // 未持有
+		"user:delete": true,  // user:* 覆盖
+		"group:read":  false,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected result size: %v", got)
+	}
+	for permission, allowed := range want {
+		if got[permission] != allowed {
+			t.Fatalf("CheckPermissions[%s] = %v, want %v", permission, got[permission], allowed)
+		}
+	}
+
+	if _, err := env.userService.CheckPermissions(ctx, user.GetID(), []string{"user:read", " "}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for blank permission, got %v", err)
+	}
+	if _, err := env.userService.CheckPermissions(ctx, 999999, []string{"user:read"}); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing user, got %v", err)
+	}
+}
+
+// TestRoleServiceSearchRolesPaged 测试角色分页搜索（总数与页边界）
+func TestRoleServiceSearchRolesPaged(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	var roles []*iamentity.Role
+	for i := 1; i <= 5; i++ {
+		roles = append(roles, env.createTestRole(t, fmt.Sprintf("paged_role_%d", i), []string{"user:read"}))
+	}
+	env.createTestRole(t, "other_role", []string{"user:read"})
+	// 软删除的角色不计入
+	if err := env.db.Exec("UPDATE roles SET deleted_at = ? WHERE id = ?", time.Now(), roles[4].GetID()).Error; err != nil {
+		t.Fatalf("soft delete role: %v", err)
+	}
+
+	items, total, err := roleService.SearchRolesPaged(ctx, "paged_role", 0, 3)
+	if err != nil {
+		t.Fatalf("SearchRolesPaged failed: %v", err)
+	}
+	if total != 4 || len(items) != 3 || items[0].GetID() != roles[0].GetID() {
+		t.Fatalf("unexpected first page: total=%d len=%d", total, len(items))
+	}
+	items, total, err = roleService.SearchRolesPaged(ctx, "paged_role", 3, 3)
+	if err != nil {
+		t.Fatalf("SearchRolesPaged failed: %v", err)
+	}
+	if total != 4 || len(items) != 1 || items[0].GetID() != roles[3].GetID() {
+		t.Fatalf("unexpected last page: total=%d len=%d", total, len(items))
+	}
+
+	// 关键字为空时统计全部未删除角色
+	if _, total, err := roleService.SearchRolesPaged(ctx, "", 0, 1); err != nil || total != 5 {
+		t.Fatalf("expected 5 roles without keyword, got %d (%v)", total, err)
+	}
+	if _, _, err := roleService.SearchRolesPaged(ctx, "", 0, -1); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for negative limit, got %v", err)
+	}
+}
+
+// TestLastSystemAdminProtection 测试不能降级、停用或锁定最后一个系统管理员
+func TestLastSystemAdminProtection(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	register := func(username string) *iamentity.User {
+		t.Helper()
+		user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		return user
+	}
+	alice := register("last_admin_alice")
+	bob := register("last_admin_bob")
+	adminRole := env.createTestRole(t, svc.SystemAdminRoleName, []string{"*"})
+	otherRole := env.createTestRole(t, "last_admin_other", []string{"user:read"})
+	for _, roleID := range []int64{adminRole.GetID(), otherRole.GetID()} {
+		if err := env.userService.AssignRole(ctx, alice.GetID(), roleID); err != nil {
+			t.Fatalf("AssignRole failed: %v", err)
+		}
+	}
+
+	// 唯一的管理员：不能移除管理员角色、停用或锁定
+	if err := env.userService.RemoveRole(ctx, alice.GetID(), adminRole.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation removing last admin role, got %v", err)
+	}
+	if err := roleService.RemoveRoleFromUser(ctx, adminRole.GetID(), alice.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation removing last admin role via RoleService, got %v", err)
+	}
+	if err := env.userService.DeactivateUser(ctx, alice.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation deactivating last admin, got %v", err)
+	}
+	if err := env.userService.LockUser(ctx, alice.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation locking last admin, got %v", err)
+	}
+	// 其他角色与非管理员用户不受影响
+	if err := env.userService.RemoveRole(ctx, alice.GetID(), otherRole.GetID()); err != nil {
+		t.Fatalf("RemoveRole of non-admin role failed: %v", err)
+	}
+	if err := env.userService.LockUser(ctx, bob.GetID()); err != nil {
+		t.Fatalf("LockUser of non-admin failed: %v", err)
+	}
+
+	// 被锁定的管理员不算可用管理员
+	if err := env.userService.AssignRole(ctx, bob.GetID(), adminRole.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	if err := env.userService.RemoveRole(ctx, alice.GetID(), adminRole.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation while other admin is locked, got %v", err)
+	}
+
+	// 已过期的管理员分配不算可用管理员
+	carol := register("last_admin_carol")
+	if err := env.userService.AssignRole(ctx, carol.GetID(), adminRole.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := env.userRepo.SetRoleExpiry(ctx, carol.GetID(), adminRole.GetID(), &past); err != nil {
+		t.Fatalf("SetRoleExpiry failed: %v", err)
+	}
+	if err := env.userService.RemoveRole(ctx, alice.GetID(), adminRole.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation while other admin grant is expired, got %v", err)
+	}
+
+	// 存在第二个可用管理员后可以降级
+	if err := env.userService.UnlockUser(ctx, bob.GetID()); err != nil {
+		t.Fatalf("UnlockUser failed: %v", err)
+	}
+	if err := roleService.RemoveRoleFromUser(ctx, adminRole.GetID(), alice.GetID()); err != nil {
+		t.Fatalf("expected demotion with second admin, got %v", err)
+	}
+	// bob 成为唯一管理员
+	if err := env.userService.DeactivateUser(ctx, bob.GetID()); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation deactivating remaining admin, got %v", err)
+	}
+	if err := env.userService.DeactivateUser(ctx, alice.GetID()); err != nil {
+		t.Fatalf("DeactivateUser of demoted user failed: %v", err)
+	}
+}
+
+// TestRoleServiceCheckPermissionSources 测试权限检查返回全部来源（直接/组织/继承）
+func TestRoleServiceCheckPermissionSources(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "source_user",
+		Email:    "source_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	direct := env.createTestRole(t, "src_direct", []string{"report:read"})
+	groupRole := env.createTestRole(t, "src_group", []string{"report:read", "report:export"})
+	parent := env.createTestRole(t, "src_parent", []string{"report:*"})
+	child := env.createTestRole(t, "src_child", []string{"misc:read"})
+	parentID := parent.GetID()
+	if err := env.roleRepo.SetParentRole(ctx, child.GetID(), &parentID); err != nil {
+		t.Fatalf("SetParentRole failed: %v", err)
+	}
+	for _, role := range []*iamentity.Role{direct, child} {
+		if err := env.userService.AssignRole(ctx, user.GetID(), role.GetID()); err != nil {
+			t.Fatalf("AssignRole failed: %v", err)
+		}
+	}
+	group := env.createTestGroup(t, "来源组织", nil)
+	if err := env.groupService.AddGroupRole(ctx, group.GetID(), groupRole.GetID()); err != nil {
+		t.Fatalf("AddGroupRole failed: %v", err)
+	}
+	if err := env.userService.AssignToGroup(ctx, user.GetID(), group.GetID()); err != nil {
+		t.Fatalf("AssignToGroup failed: %v", err)
+	}
+
+	check := func(permission string) *svc.PermissionCheckResponse {
+		t.Helper()
+		resp, err := roleService.CheckPermission(ctx, &svc.PermissionCheckRequest{UserID: user.GetID(), Permission: permission})
+		if err != nil {
+			t.Fatalf("CheckPermission(%s) failed: %v", permission, err)
+		}
+		return resp
+	}
+	describe := func(resp *svc.PermissionCheckResponse) []string {
+		var got []string
+		for _, source := range resp.Sources {
+			got = append(got, source.Type+":"+source.Role+":"+source.ViaRole+":"+strconv.FormatInt(source.GroupID, 10))
+		}
+		sort.Strings(got)
+		return got
+	}
+	groupIDText := strconv.FormatInt(group.GetID(), 10)
+
+	// 三种来源同时授予：列出全部路径，首要来源为 direct
+	resp := check("report:read")
+	want := []string{"direct:src_direct::0", "group:src_group::" + groupIDText, "inherited:src_parent:src_child:0"}
+	if !resp.HasPermission || resp.Source != svc.PermissionSourceDirect || strings.Join(describe(resp), ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected report:read result: source=%s sources=%v", resp.Source, describe(resp))
+	}
+	if strings.Join(resp.Roles, ",") != "src_direct,src_group,src_parent" {
+		t.Fatalf("unexpected granting roles: %v", resp.Roles)
+	}
+
+	// 无直接授予：首要来源为 group，继承路径仍列出
+	resp = check("report:export")
+	want = []string{"group:src_group::" + groupIDText, "inherited:src_parent:src_child:0"}
+	if !resp.HasPermission || resp.Source != svc.PermissionSourceGroup || strings.Join(describe(resp), ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected report:export result: source=%s sources=%v", resp.Source, describe(resp))
+	}
+	if resp.Sources[0].GroupName != "来源组织" && resp.Sources[1].GroupName != "来源组织" {
+		t.Fatalf("expected group name on group source, got %+v", resp.Sources)
+	}
+
+	// 停用父角色后继承路径消失
+	parent.Status = svc.RoleStatusInactive
+	if err := env.roleRepo.Update(ctx, parent); err != nil {
+		t.Fatalf("deactivate parent: %v", err)
+	}
+	if resp := check("report:export"); strings.Join(describe(resp), ",") != "group:src_group::"+groupIDText {
+		t.Fatalf("expected only group source after deactivating parent, got %v", describe(resp))
+	}
+
+	// 无权限
+	resp = check("misc:delete")
+	if resp.HasPermission || resp.Source != "" || len(resp.Sources) != 0 || len(resp.Roles) != 0 {
+		t.Fatalf("expected no permission, got %+v", resp)
+	}
+
+	if _, err := roleService.CheckPermission(ctx, &svc.PermissionCheckRequest{UserID: user.GetID(), Permission: " "}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for blank permission, got %v", err)
+	}
+
+	// 祖先组织的默认角色：仅在开启继承时计入（与有效权限一致）
+	ancestorRole := env.createTestRole(t, "src_ancestor", []string{"ancestor:read"})
+	upper := env.createTestGroup(t, "来源上级组织", nil)
+	upperID := upper.GetID()
+	lower := env.createTestGroup(t, "来源下级组织", &upperID)
+	if err := env.groupService.AddGroupRole(ctx, upperID, ancestorRole.GetID()); err != nil {
+		t.Fatalf("AddGroupRole failed: %v", err)
+	}
+	if err := env.userService.AssignToGroup(ctx, user.GetID(), lower.GetID()); err != nil {
+		t.Fatalf("AssignToGroup failed: %v", err)
+	}
+	if resp := check("ancestor:read"); resp.HasPermission {
+		t.Fatalf("expected ancestor group role ignored by default, got %v", describe(resp))
+	}
+	svc.SetInheritAncestorGroupRoles(true)
+	defer svc.SetInheritAncestorGroupRoles(false)
+	want = []string{"group:src_ancestor::" + strconv.FormatInt(upperID, 10)}
+	if resp := check("ancestor:read"); !resp.HasPermission || strings.Join(describe(resp), ",") != strings.Join(want, ",") {
+		t.Fatalf("expected ancestor group source, got %v", describe(resp))
+	}
+	if allowed, err := env.userService.CheckPermission(ctx, user.GetID(), "ancestor:read"); err != nil || !allowed {
+		t.Fatalf("expected effective permissions to agree, got %v (%v)", allowed, err)
+	}
+
+	// 非 active 用户：与鉴权一致返回 Forbidden
+	if err := env.userService.DeactivateUser(ctx, user.GetID()); err != nil {
+		t.Fatalf("DeactivateUser failed: %v", err)
+	}
+	if _, err := roleService.CheckPermission(ctx, &svc.PermissionCheckRequest{UserID: user.GetID(), Permission: "report:read"}); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden for inactive user, got %v", err)
+	}
+}
+
+// TestRoleServiceAuditPermissions 测试权限治理审计的三类结果
+func TestRoleServiceAuditPermissions(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	// 路由要求的权限：points:write 无角色授予；task:read 由通配符覆盖；audit:ghost 未在 AllPermissions 声明；
+	// level:read 仅由停用角色授予
+	iammw.RegisterRequiredPermissions("points:write", "task:read", "audit:ghost", "level:read")
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	env.createTestRole(t, "audit_wildcard", []string{"task:*", "audit:ghost"})
+	env.createTestRole(t, "audit_dangling", []string{"points:read", "audit:orphan"})
+	inactive := env.createTestRole(t, "audit_inactive", []string{"level:read"})
+	if err := roleService.DeactivateRole(env.backgroundCtx, inactive.GetID()); err != nil {
+		t.Fatalf("DeactivateRole failed: %v", err)
+	}
+
+	audit, err := roleService.AuditPermissions(env.backgroundCtx)
+	if err != nil {
+		t.Fatalf("AuditPermissions failed: %v", err)
+	}
+	contains := func(set []string, permission string) bool {
+		for _, p := range set {
+			if p == permission {
+				return true
+			}
+		}
+		return false
+	}
+	for _, set := range [][]string{audit.Unreachable, audit.Dangling, audit.Undeclared} {
+		if !sort.StringsAreSorted(set) {
+			t.Fatalf("expected sorted result, got %v", set)
+		}
+	}
+
+	// unreachable
+	for _, p := range []string{"points:write", "level:read"} {
+		if !contains(audit.Unreachable, p) {
+			t.Fatalf("expected %s unreachable, got %v", p, audit.Unreachable)
+		}
+	}
+	for _, p := range []string{"task:read", "audit:ghost"} {
+		if contains(audit.Unreachable, p) {
+			t.Fatalf("expected %s reachable, got %v", p, audit.Unreachable)
+		}
+	}
+
+	// dangling
+	for _, p := range []string{"points:read", "audit:orphan"} {
+		if !contains(audit.Dangling, p) {
+			t.Fatalf("expected %s dangling, got %v", p, audit.Dangling)
+		}
+	}
+	for _, p := range []string{"task:*", "audit:ghost", "level:read"} {
+		if contains(audit.Dangling, p) {
+			t.Fatalf("expected %s not dangling, got %v", p, audit.Dangling)
+		}
+	}
+
+	// undeclared
+	for _, p := range []string{"audit:ghost", "audit:orphan"} {
+		if !contains(audit.Undeclared, p) {
+			t.Fatalf("expected %s undeclared, got %v", p, audit.Undeclared)
+		}
+	}
+	for _, p := range []string{"points:write", "points:read", "task:*"} {
+		if contains(audit.Undeclared, p) {
+			t.Fatalf("expected %s declared, got %v", p, audit.Undeclared)
+		}
+	}
+}
+
+// TestRoleServiceListRolesVisibility 测试角色列表的 include_inactive / include_deleted 约定
+func TestRoleServiceListRolesVisibility(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	active := env.createTestRole(t, "visible_active", []string{"perm:a"})
+	inactive := env.createTestRole(t, "visible_inactive", []string{"perm:b"})
+	deleted := env.createTestRole(t, "visible_deleted", []string{"perm:c"})
+	if err := roleService.DeactivateRole(env.backgroundCtx, inactive.GetID()); err != nil {
+		t.Fatalf("DeactivateRole failed: %v", err)
+	}
+	if err := env.db.Exec("UPDATE roles SET deleted_at = ? WHERE id = ?", time.Now(), deleted.GetID()).Error; err != nil {
+		t.Fatalf("soft delete role: %v", err)
+	}
+
+	list := func(opts svc.ListOptions) []int64 {
+		t.Helper()
+		roles, err := roleService.ListRoles(env.backgroundCtx, opts)
+		if err != nil {
+			t.Fatalf("ListRoles(%+v) failed: %v", opts, err)
+		}
+		ids := make([]int64, 0, len(roles))
+		for _, r := range roles {
+			ids = append(ids, r.GetID())
+		}
+		return ids
+	}
+	contains := func(ids []int64, id int64) bool {
+		for _, v := range ids {
+			if v == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	cases := []struct {
+		opts                     svc.ListOptions
+		wantInactive, wantDelete bool
+	}{
+		{svc.ListOptions{}, false, false},
+		{svc.ListOptions{IncludeInactive: true}, true, false},
+		{svc.ListOptions{IncludeDeleted: true}, false, true},
+		{svc.ListOptions{IncludeInactive: true, IncludeDeleted: true}, true, true},
+	}
+	for _, c := range cases {
+		ids := list(c.opts)
+		if !contains(ids, active.GetID()) {
+			t.Fatalf("%+v: expected active role listed, got %v", c.opts, ids)
+		}
+		if contains(ids, inactive.GetID()) != c.wantInactive {
+			t.Fatalf("%+v: inactive role listed=%v, want %v", c.opts, !c.wantInactive, c.wantInactive)
+		}
+		if contains(ids, deleted.GetID()) != c.wantDelete {
+			t.Fatalf("%+v: deleted role listed=%v, want %v", c.opts, !c.wantDelete, c.wantDelete)
+		}
+	}
+}
+
+// TestUserServiceAssignRoleInGroup 测试限定组织范围的角色分配
+func TestUserServiceAssignRoleInGroup(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "scoped_role_user",
+		Email:    "scoped_role_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	company := env.createTestGroup(t, "scoped_company", nil)
+	companyID := company.GetID()
+	deptA := env.createTestGroup(t, "scoped_dept_a", &companyID)
+	deptB := env.createTestGroup(t, "scoped_dept_b", &companyID)
+	deptAID := deptA.GetID()
+	teamA := env.createTestGroup(t, "scoped_team_a", &deptAID)
+
+	deptAdmin := env.createTestRole(t, "scoped_dept_admin", []string{"group:manage"})
+	reader := env.createTestRole(t, "scoped_reader", []string{"user:read"})
+
+	if err := env.userService.AssignRoleInGroup(ctx, user.GetID(), deptAdmin.GetID(), deptA.GetID()); err != nil {
+		t.Fatalf("AssignRoleInGroup failed: %v", err)
+	}
+	if err := env.userService.AssignRole(ctx, user.GetID(), reader.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+
+	check := func(permission string, groupID int64) bool {
+		t.Helper()
+		allowed, err := env.userService.CheckPermissionInGroup(ctx, user.GetID(), permission, groupID)
+		if err != nil {
+			t.Fatalf("CheckPermissionInGroup(%s, %d) failed: %v", permission, groupID, err)
+		}
+		return allowed
+	}
+
+	// 限定范围的角色：仅在该组织及其子组织生效
+	if !check("group:manage", deptA.GetID()) || !check("group:manage", teamA.GetID()) {
+		t.Fatal("expected scoped permission in dept A and its child team")
+	}
+	if check("group:manage", deptB.GetID()) || check("group:manage", company.GetID()) {
+		t.Fatal("expected scoped permission absent in sibling and parent groups")
+	}
+
+	// 全局角色在任意组织生效
+	if !check("user:read", deptB.GetID()) {
+		t.Fatal("expected global permission in any group")
+	}
+
+	// 全局鉴权快照仍合并所有分配
+	if allowed, err := env.userService.CheckPermission(ctx, user.GetID(), "group:manage"); err != nil || !allowed {
+		t.Fatalf("expected global check to include scoped role, got %v (%v)", allowed, err)
+	}
+
+	// 组织不存在
+	if _, err := env.userService.CheckPermissionInGroup(ctx, user.GetID(), "group:manage", 999999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing group, got %v", err)
+	}
+	if err := env.userService.AssignRoleInGroup(ctx, user.GetID(), deptAdmin.GetID(), 999999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing group, got %v", err)
+	}
+
+	// 重新限定到部门 B：部门 A 不再生效
+	if err := env.userService.AssignRoleInGroup(ctx, user.GetID(), deptAdmin.GetID(), deptB.GetID()); err != nil {
+		t.Fatalf("AssignRoleInGroup failed: %v", err)
+	}
+	if check("group:manage", deptA.GetID()) || !check("group:manage", deptB.GetID()) {
+		t.Fatal("expected scope moved from dept A to dept B")
+	}
+
+	// AssignRole 恢复为全局分配
+	if err := env.userService.AssignRole(ctx, user.GetID(), deptAdmin.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	if !check("group:manage", deptA.GetID()) || !check("group:manage", company.GetID()) {
+		t.Fatal("expected global assignment to apply in every group")
+	}
+
+	// 组织默认角色：仅在提供该角色的组织及其子组织范围内生效
+	auditor := env.createTestRole(t, "scoped_dept_b_auditor", []string{"audit:read"})
+	if err := env.groupService.AddGroupRole(ctx, deptB.GetID(), auditor.GetID()); err != nil {
+		t.Fatalf("AddGroupRole failed: %v", err)
+	}
+	if err := env.groupService.AddUserToGroup(ctx, deptB.GetID(), user.GetID()); err != nil {
+		t.Fatalf("AddUserToGroup failed: %v", err)
+	}
+	if !check("audit:read", deptB.GetID()) {
+		t.Fatal("expected dept B default role in dept B")
+	}
+	if check("audit:read", deptA.GetID()) || check("audit:read", teamA.GetID()) {
+		t.Fatal("expected dept B default role absent outside dept B")
+	}
+}
+
+// TestUserServiceAssignRoleUntil 测试限时角色分配：过期分配不进入权限快照，清理任务移除过期分配
+func TestUserServiceAssignRoleUntil(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "temp_role_user",
+		Email:    "temp_role_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	current := env.createTestRole(t, "temp_current", []string{"perm:current"})
+	expired := env.createTestRole(t, "temp_expired", []string{"perm:expired"})
+
+	if err := env.userService.AssignRoleUntil(ctx, user.GetID(), current.GetID(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("AssignRoleUntil failed: %v", err)
+	}
+	if err := env.userService.AssignRoleUntil(ctx, user.GetID(), expired.GetID(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("AssignRoleUntil failed: %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := env.userRepo.SetRoleExpiry(ctx, user.GetID(), expired.GetID(), &past); err != nil {
+		t.Fatalf("SetRoleExpiry failed: %v", err)
+	}
+
+	// 过期分配不进入权限快照
+	snapshot, err := env.userService.GetAuthSnapshot(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetAuthSnapshot failed: %v", err)
+	}
+	if fmt.Sprint(snapshot.Roles) != "[temp_current]" || fmt.Sprint(snapshot.Permissions) != "[perm:current]" {
+		t.Fatalf("expected only unexpired role in snapshot, got roles=%v permissions=%v", snapshot.Roles, snapshot.Permissions)
+	}
+	roles, err := env.userService.GetUserRoles(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetUserRoles failed: %v", err)
+	}
+	if len(roles) != 1 || roles[0].GetID() != current.GetID() {
+		t.Fatalf("expected only unexpired role, got %v", roles)
+	}
+
+	// 预加载的用户角色与角色成员列表同样不含过期分配
+	loaded, err := env.userRepo.GetWithRelations(ctx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetWithRelations failed: %v", err)
+	}
+	if loaded.HasRole(expired.Name) || !loaded.HasRole(current.Name) {
+		t.Fatalf("expected preloaded roles to exclude expired assignment, got %v", loaded.Roles)
+	}
+	if _, total, err := env.userRepo.FindByRoleIDPaged(ctx, expired.GetID(), 0, 0); err != nil || total != 0 {
+		t.Fatalf("expected no members for expired assignment, got %d (%v)", total, err)
+	}
+
+	// 过期时间必须晚于当前时间
+	if err := env.userService.AssignRoleUntil(ctx, user.GetID(), current.GetID(), past); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for past expiry, got %v", err)
+	}
+
+	// 清理任务仅移除过期分配，并记录移除变更
+	purged, err := env.userService.PurgeExpiredRoleAssignments(ctx)
+	if err != nil {
+		t.Fatalf("PurgeExpiredRoleAssignments failed: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("expected 1 purged assignment, got %d", purged)
+	}
+	var rows []iamentity.UserRoleAssignment
+	if err := env.db.Where("user_id = ?", user.GetID()).Find(&rows).Error; err != nil {
+		t.Fatalf("load user_roles: %v", err)
+	}
+	if len(rows) != 1 || rows[0].RoleID != current.GetID() || rows[0].ExpiresAt == nil {
+		t.Fatalf("expected only the unexpired assignment left, got %+v", rows)
+	}
+	changes, err := env.userService.GetMyAccessChanges(ctx, user.GetID(), time.Time{})
+	if err != nil {
+		t.Fatalf("GetMyAccessChanges failed: %v", err)
+	}
+	if len(changes) == 0 || changes[0].RoleID != expired.GetID() || changes[0].Action != iamentity.RoleChangeRevoked {
+		t.Fatalf("expected revoke change recorded for purged assignment, got %+v", changes)
+	}
+
+	// 永久分配清除已有的过期时间
+	if err := env.userService.AssignRole(ctx, user.GetID(), current.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	if err := env.db.Where("user_id = ?", user.GetID()).Find(&rows).Error; err != nil {
+		t.Fatalf("load user_roles: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ExpiresAt != nil {
+		t.Fatalf("expected permanent assignment, got %+v", rows)
+	}
+
+	// 角色服务的永久分配同样清除已有的过期时间
+	if err := env.userService.AssignRoleUntil(ctx, user.GetID(), current.GetID(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("AssignRoleUntil failed: %v", err)
+	}
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	if err := roleService.AssignRoleToUser(ctx, current.GetID(), user.GetID()); err != nil {
+		t.Fatalf("AssignRoleToUser failed: %v", err)
+	}
+	if err := env.db.Where("user_id = ?", user.GetID()).Find(&rows).Error; err != nil {
+		t.Fatalf("load user_roles: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ExpiresAt != nil {
+		t.Fatalf("expected RoleService grant to be permanent, got %+v", rows)
+	}
+}
+
+// TestRoleServicePermissionHistory 测试角色权限编辑按序记录新增/移除差异与操作者
+func TestRoleServicePermissionHistory(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	iammw.RegisterRequiredPermissions("hist:read", "hist:write", "hist:delete")
+	eventBus := &capturingEventBus{}
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, eventBus)
+	actorCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(42))
+
+	role, err := roleService.CreateRole(actorCtx, &svc.CreateRoleRequest{
+		Name:        "history_role",
+		Permissions: []string{"hist:read"},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+
+	// 第一次编辑：整体替换权限
+	if _, err := roleService.UpdateRole(actorCtx, role.GetID(), &svc.UpdateRoleRequest{
+		Permissions: []string{"hist:read", "hist:write", "hist:delete"},
+	}); err != nil {
+		t.Fatalf("UpdateRole failed: %v", err)
+	}
+	// 第二次编辑：移除单个权限
+	if err := roleService.RemovePermission(actorCtx, role.GetID(), "hist:delete"); err != nil {
+		t.Fatalf("RemovePermission failed: %v", err)
+	}
+	// 无实际变化的编辑不产生记录
+	if err := roleService.AddPermission(actorCtx, role.GetID(), "hist:read"); err != nil {
+		t.Fatalf("AddPermission failed: %v", err)
+	}
+
+	history, err := roleService.GetPermissionHistory(env.backgroundCtx, role.GetID())
+	if err != nil {
+		t.Fatalf("GetPermissionHistory failed: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history entries, got %d: %+v", len(history), history)
+	}
+	first, second := history[0], history[1]
+	if strings.Join(first.Added, ",") != "hist:delete,hist:write" || len(first.Removed) != 0 {
+		t.Fatalf("unexpected first diff: added=%v removed=%v", first.Added, first.Removed)
+	}
+	if len(second.Added) != 0 || strings.Join(second.Removed, ",") != "hist:delete" {
+		t.Fatalf("unexpected second diff: added=%v removed=%v", second.Added, second.Removed)
+	}
+	if first.ActorID != 42 || second.ActorID != 42 {
+		t.Fatalf("expected actor 42, got %d/%d", first.ActorID, second.ActorID)
+	}
+	if second.CreatedAt.Before(first.CreatedAt) || second.ID <= first.ID {
+		t.Fatalf("expected chronological order, got %+v then %+v", first, second)
+	}
+
+	// 每次有效编辑发布一条 RolePermissionsChanged 事件
+	published := 0
+	for _, evt := range eventBus.events {
+		if evt.GetType() == (iamevent.RolePermissionsChanged{}).GetType() {
+			published++
+		}
+	}
+	if published != 2 {
+		t.Fatalf("expected 2 RolePermissionsChanged events, got %d", published)
+	}
+
+	// 不存在的角色返回 NotFound
+	if _, err := roleService.GetPermissionHistory(env.backgroundCtx, 999999); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound for missing role, got %v", err)
+	}
+}
+
+func TestUserServiceTenantIsolation(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	withTenant := func(tenantID string) context.Context {
+		t.Helper()
+		ctx, err := metadata.WithTenantID(env.backgroundCtx, tenantID)
+		if err != nil {
+			t.Fatalf("WithTenantID: %v", err)
+		}
+		return ctx
+	}
+	ctxA := withTenant("tenant-a")
+	ctxB := withTenant("tenant-b")
+
+	// 共享的内置默认角色（tenant_id 为空）对所有租户可见
+	sharedRole := env.createTestRole(t, svc.UserRoleName, []string{"user:read"})
+
+	// 在租户 A 下注册：自动写入租户
+	user, err := env.userService.Register(ctxA, &svc.RegisterRequest{
+		Username: "tenant_a_user",
+		Email:    "tenant_a_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	if user.TenantID != "tenant-a" {
+		t.Fatalf("expected tenant-a, got %q", user.TenantID)
+	}
+	roles, err := env.roleRepo.FindByUserID(ctxA, user.GetID())
+	if err != nil {
+		t.Fatalf("FindByUserID: %v", err)
+	}
+	if len(roles) != 1 || roles[0].GetID() != sharedRole.GetID() {
+		t.Fatalf("expected shared default role assigned under tenant-a, got %+v", roles)
+	}
+
+	// 租户内可读取但不可修改共享角色；租户自建角色对其他租户不可见
+	if _, err := env.roleRepo.GetByID(ctxB, sharedRole.GetID()); err != nil {
+		t.Fatalf("expected shared role visible under tenant-b, got %v", err)
+	}
+	sharedRole.Description = "tenant edit"
+	if err := env.roleRepo.Update(ctxA, sharedRole); !errorx.Is(err, errorx.Forbidden) {
+		t.Fatalf("expected Forbidden updating shared role under tenant, got %v", err)
+	}
+	ownRole := &iamentity.Role{Name: "tenant_a_role", Status: svc.RoleStatusActive}
+	if err := env.roleRepo.Create(ctxA, ownRole); err != nil {
+		t.Fatalf("create tenant role: %v", err)
+	}
+	if _, err := env.roleRepo.GetByID(ctxB, ownRole.GetID()); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected tenant-a role NotFound under tenant-b, got %v", err)
+	}
+
+	// 迁移前已存在的角色 tenant_id 为 NULL，同样视为共享角色
+	legacyRole := env.createTestRole(t, "legacy_null_tenant_role", []string{"user:read"})
+	if err := env.db.Exec("UPDATE roles SET tenant_id = NULL WHERE id = ?", legacyRole.GetID()).Error; err != nil {
+		t.Fatalf("set NULL tenant_id: %v", err)
+	}
+	if _, err := env.roleRepo.GetByID(ctxA, legacyRole.GetID()); err != nil {
+		t.Fatalf("expected NULL-tenant role visible under tenant-a, got %v", err)
+	}
+	if err := env.userService.AssignRole(ctxA, user.GetID(), legacyRole.GetID()); err != nil {
+		t.Fatalf("expected NULL-tenant role assignable under tenant-a, got %v", err)
+	}
+	if roles, err := env.roleRepo.FindByUserID(ctxA, user.GetID()); err != nil || len(roles) != 2 {
+		t.Fatalf("expected shared and NULL-tenant roles under tenant-a, got %+v, %v", roles, err)
+	}
+
+	// 租户 B 下不可见
+	if _, err := env.userRepo.GetByID(ctxB, user.GetID()); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound by id under tenant-b, got %v", err)
+	}
+	if _, err := env.userRepo.FindByUsername(ctxB, "tenant_a_user"); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound by username under tenant-b, got %v", err)
+	}
+	if err := env.userService.DeleteUser(ctxB, user.GetID()); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected NotFound deleting under tenant-b, got %v", err)
+	}
+
+	// 租户 A 与未携带租户的上下文可见
+	for name, ctx := range map[string]context.Context{"tenant-a": ctxA, "no tenant": env.backgroundCtx} {
+		found, err := env.userRepo.GetByID(ctx, user.GetID())
+		if err != nil {
+			t.Fatalf("GetByID under %s: %v", name, err)
+		}
+		if found.DeletedAt != nil {
+			t.Fatalf("expected user not deleted under %s", name)
+		}
+	}
+
+	// 组织同样隔离
+	group, err := env.groupService.CreateGroup(ctxA, &svc.CreateGroupRequest{Name: "tenant_a_group"})
+	if err != nil {
+		t.Fatalf("create group: %v", err)
+	}
+	if group.TenantID != "tenant-a" {
+		t.Fatalf("expected group tenant-a, got %q", group.TenantID)
+	}
+	if _, err := env.groupRepo.GetByID(ctxB, group.GetID()); !errorx.Is(err, errorx.NotFound) {
+		t.Fatalf("expected group NotFound under tenant-b, got %v", err)
+	}
+	if _, err := env.groupRepo.GetByID(ctxA, group.GetID()); err != nil {
+		t.Fatalf("expected group visible under tenant-a, got %v", err)
+	}
+}
+
+// TestEntityActorColumns 测试用户/角色/组织的创建者与最后修改者取自请求上下文
+func TestEntityActorColumns(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	creatorCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(42))
+	editorCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(43))
+	iammw.RegisterRequiredPermissions("user:read")
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	assertActors := func(kind string, createdBy, updatedBy int64) {
+		t.Helper()
+		if createdBy != 42 || updatedBy != 43 {
+			t.Fatalf("%s: expected created_by=42 updated_by=43, got %d/%d", kind, createdBy, updatedBy)
+		}
+	}
+
+	// 用户
+	user, err := env.userService.Register(creatorCtx, &svc.RegisterRequest{
+		Username: "actor_user",
+		Email:    "actor_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	if user.CreatedBy != 42 || user.UpdatedBy != 42 {
+		t.Fatalf("expected creator stamped on create, got %d/%d", user.CreatedBy, user.UpdatedBy)
+	}
+	if _, err := env.userService.UpdateProfile(editorCtx, user.GetID(), &svc.UpdateUserRequest{Avatar: "https://example.com/a.png"}); err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	storedUser, err := env.userRepo.GetByID(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	assertActors("user", storedUser.CreatedBy, storedUser.UpdatedBy)
+
+	// 角色
+	role, err := roleService.CreateRole(creatorCtx, &svc.CreateRoleRequest{Name: "actor_role", Permissions: []string{"user:read"}})
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+	if _, err := roleService.UpdateRole(editorCtx, role.GetID(), &svc.UpdateRoleRequest{Description: "edited"}); err != nil {
+		t.Fatalf("UpdateRole failed: %v", err)
+	}
+	storedRole, err := env.roleRepo.GetByID(env.backgroundCtx, role.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	assertActors("role", storedRole.CreatedBy, storedRole.UpdatedBy)
+
+	// 组织
+	group, err := env.groupService.CreateGroup(creatorCtx, &svc.CreateGroupRequest{Name: "actor_group"})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if _, err := env.groupService.UpdateGroup(editorCtx, group.GetID(), &svc.UpdateGroupRequest{Description: "edited"}); err != nil {
+		t.Fatalf("UpdateGroup failed: %v", err)
+	}
+	storedGroup, err := env.groupRepo.GetByID(env.backgroundCtx, group.GetID())
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	assertActors("group", storedGroup.CreatedBy, storedGroup.UpdatedBy)
+
+	// 系统操作（无请求用户）记为 0
+	systemUser, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "actor_system_user",
+		Email:    "actor_system_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("register user: %v", err)
+	}
+	if systemUser.CreatedBy != 0 || systemUser.UpdatedBy != 0 {
+		t.Fatalf("expected system actor 0, got %d/%d", systemUser.CreatedBy, systemUser.UpdatedBy)
+	}
+
+	// 按列更新的窄写入同样写入最后修改者
+	narrowCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(44))
+	if err := env.userRepo.UpdatePassword(narrowCtx, user.GetID(), "hash"); err != nil {
+		t.Fatalf("UpdatePassword failed: %v", err)
+	}
+	if storedUser, err = env.userRepo.GetByID(env.backgroundCtx, user.GetID()); err != nil || storedUser.UpdatedBy != 44 {
+		t.Fatalf("expected updated_by=44 after password update, got %+v, %v", storedUser, err)
+	}
+	parentRole, err := roleService.CreateRole(creatorCtx, &svc.CreateRoleRequest{Name: "actor_parent_role", Permissions: []string{"user:read"}})
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+	if _, err := roleService.SetParentRole(narrowCtx, role.GetID(), parentRole.GetID()); err != nil {
+		t.Fatalf("SetParentRole failed: %v", err)
+	}
+	if storedRole, err = env.roleRepo.GetByID(env.backgroundCtx, role.GetID()); err != nil || storedRole.UpdatedBy != 44 {
+		t.Fatalf("expected updated_by=44 after SetParentRole, got %+v, %v", storedRole, err)
+	}
+	parentGroup, err := env.groupService.CreateGroup(creatorCtx, &svc.CreateGroupRequest{Name: "actor_parent_group"})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	parentGroupID := parentGroup.GetID()
+	if _, err := env.groupService.MoveGroup(narrowCtx, group.GetID(), &parentGroupID); err != nil {
+		t.Fatalf("MoveGroup failed: %v", err)
+	}
+	if storedGroup, err = env.groupRepo.GetByID(env.backgroundCtx, group.GetID()); err != nil || storedGroup.UpdatedBy != 44 {
+		t.Fatalf("expected updated_by=44 after MoveGroup, got %+v, %v", storedGroup, err)
+	}
+
+	// 软删写入删除者，恢复时清零
+	deleterCtx := context.WithValue(env.backgroundCtx, httpx.UserIDKey, int64(45))
+	if err := env.userService.DeleteUser(deleterCtx, user.GetID()); err != nil {
+		t.Fatalf("DeleteUser failed: %v", err)
+	}
+	deletedUser, err := env.userRepo.GetByIDWithDeleted(env.backgroundCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("GetByIDWithDeleted failed: %v", err)
+	}
+	if deletedUser.DeletedBy != 45 || deletedUser.UpdatedBy != 45 {
+		t.Fatalf("expected deleted_by=updated_by=45, got %d/%d", deletedUser.DeletedBy, deletedUser.UpdatedBy)
+	}
+	restored, err := env.userService.RestoreUser(editorCtx, user.GetID())
+	if err != nil {
+		t.Fatalf("RestoreUser failed: %v", err)
+	}
+	if restored.DeletedBy != 0 || restored.UpdatedBy != 43 {
+		t.Fatalf("expected deleted_by cleared and updated_by=43 after restore, got %d/%d", restored.DeletedBy, restored.UpdatedBy)
+	}
+	if storedUser, err = env.userRepo.GetByID(env.backgroundCtx, user.GetID()); err != nil || storedUser.DeletedBy != 0 || storedUser.UpdatedBy != 43 {
+		t.Fatalf("expected restore persisted, got %+v, %v", storedUser, err)
+	}
+}
+
+func TestUserServiceCaseInsensitiveIdentity(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	// 用户名按输入存储；邮箱规范化为小写
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "Bob",
+		Email:    "  Bob@Example.COM ",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if user.Username != "Bob" || user.Email != "bob@example.com" {
+		t.Fatalf("unexpected stored identity: %q / %q", user.Username, user.Email)
+	}
+
+	// 仅大小写不同的用户名/邮箱视为已存在
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "bob",
+		Email:    "other@example.com",
+		Password: "password123",
+	}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected duplicate username rejected, got %v", err)
+	}
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "alice",
+		Email:    "BOB@example.com",
+		Password: "password123",
+	}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected duplicate email rejected, got %v", err)
+	}
+	usernameOK, emailOK, err := env.userService.CheckAvailability(env.backgroundCtx, "BOB", "Bob@example.com")
+	if err != nil {
+		t.Fatalf("CheckAvailability failed: %v", err)
+	}
+	if usernameOK || emailOK {
+		t.Fatalf("expected folded username/email unavailable, got %v/%v", usernameOK, emailOK)
+	}
+
+	// 登录不区分用户名大小写
+	for _, name := range []string{"Bob", "bob", "BOB"} {
+		result, err := env.userService.Authenticate(env.backgroundCtx, &svc.AuthenticateRequest{Username: name, Password: "password123"})
+		if err != nil {
+			t.Fatalf("Authenticate(%q) failed: %v", name, err)
+		}
+		if result.UserID != user.GetID() {
+			t.Fatalf("Authenticate(%q) returned user %d, want %d", name, result.UserID, user.GetID())
+		}
+	}
+
+	// 修改邮箱同样规范化
+	updated, err := env.userService.UpdateProfile(env.backgroundCtx, user.GetID(), &svc.UpdateUserRequest{Email: "New.Bob@Example.com"})
+	if err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	if updated.Email != "new.bob@example.com" {
+		t.Fatalf("expected lowercased email, got %q", updated.Email)
+	}
+
+	// 规范化列随写入同步，数据库唯一索引兜底仅大小写不同的重复
+	var stored iamentity.User
+	if err := env.db.First(&stored, user.GetID()).Error; err != nil {
+		t.Fatalf("load user: %v", err)
+	}
+	if stored.UsernameCanonical != "bob" || stored.EmailCanonical != "new.bob@example.com" {
+		t.Fatalf("unexpected canonical columns: %q / %q", stored.UsernameCanonical, stored.EmailCanonical)
+	}
+	if err := env.db.Exec("INSERT INTO users (username, email, password_hash, username_canonical, email_canonical) VALUES ('BOB', 'x@example.com', 'x', 'bob', 'x@example.com')").Error; err == nil {
+		t.Fatal("expected unique index on username_canonical")
+	}
+
+	// 存量用户回填前按原列回退匹配，回填后按规范化列找到
+	if err := env.db.Exec("INSERT INTO users (username, email, password_hash) VALUES ('Legacy', 'Legacy@Example.com', 'x')").Error; err != nil {
+		t.Fatalf("insert legacy user: %v", err)
+	}
+	if _, err := env.userRepo.FindByUsername(env.backgroundCtx, "legacy"); err != nil {
+		t.Fatalf("expected legacy user found by username before backfill, got %v", err)
+	}
+	if _, err := env.userRepo.FindByEmail(env.backgroundCtx, "LEGACY@example.com"); err != nil {
+		t.Fatalf("expected legacy user found by email before backfill, got %v", err)
+	}
+	if exists, err := env.userRepo.ExistsByUsername(env.backgroundCtx, "LEGACY"); err != nil || !exists {
+		t.Fatalf("expected legacy username taken before backfill, got %v, %v", exists, err)
+	}
+	if exists, err := env.userRepo.ExistsByEmail(env.backgroundCtx, "legacy@example.com"); err != nil || !exists {
+		t.Fatalf("expected legacy email taken before backfill, got %v, %v", exists, err)
+	}
+	filled, err := env.userService.BackfillCanonicalNames(env.backgroundCtx)
+	if err != nil || filled != 1 {
+		t.Fatalf("BackfillCanonicalNames = %d, %v; want 1", filled, err)
+	}
+	if _, err := env.userRepo.FindByUsername(env.backgroundCtx, "LEGACY"); err != nil {
+		t.Fatalf("expected legacy user found by username after backfill, got %v", err)
+	}
+	if _, err := env.userRepo.FindByEmail(env.backgroundCtx, "legacy@example.com"); err != nil {
+		t.Fatalf("expected legacy user found by email after backfill, got %v", err)
+	}
+}
+
+func TestUserServiceAuthenticatePreviousLogin(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	if _, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "login_history_user",
+		Email:    "login_history@example.com",
+		Password: "password123",
+	}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	req := &svc.AuthenticateRequest{Username: "login_history_user", Password: "password123"}
+
+	// 首次登录：无上一次登录时间
+	first, err := env.userService.Authenticate(env.backgroundCtx, req)
+	if err != nil {
+		t.Fatalf("first Authenticate failed: %v", err)
+	}
+	if first.LastLoginAt == nil || first.PreviousLoginAt != nil {
+		t.Fatalf("unexpected first login times: last=%v previous=%v", first.LastLoginAt, first.PreviousLoginAt)
+	}
+
+	// 再次登录：上一次登录时间为首次登录时间
+	second, err := env.userService.Authenticate(env.backgroundCtx, req)
+	if err != nil {
+		t.Fatalf("second Authenticate failed: %v", err)
+	}
+	if second.PreviousLoginAt == nil || !second.PreviousLoginAt.Equal(*first.LastLoginAt) {
+		t.Fatalf("expected previous login %v, got %v", first.LastLoginAt, second.PreviousLoginAt)
+	}
+	if second.LastLoginAt == nil || second.LastLoginAt.Before(*first.LastLoginAt) {
+		t.Fatalf("expected last login after first login, got %v", second.LastLoginAt)
+	}
+
+	user, err := env.userRepo.GetByID(env.backgroundCtx, first.UserID)
+	if err != nil {
+		t.Fatalf("GetByID failed: %v", err)
+	}
+	if user.PreviousLoginAt == nil || !user.PreviousLoginAt.Equal(*first.LastLoginAt) {
+		t.Fatalf("expected persisted previous login %v, got %v", first.LastLoginAt, user.PreviousLoginAt)
+	}
+}
+
+func TestRoleServiceBatchPermissions(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	iammw.RegisterRequiredPermissions("bulk:read", "bulk:write", "bulk:delete", "bulk:export")
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	role, err := roleService.CreateRole(ctx, &svc.CreateRoleRequest{
+		Name:        "bulk_role",
+		Permissions: []string{"bulk:read", "bulk:write"},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole failed: %v", err)
+	}
+	reload := func() []string {
+		t.Helper()
+		latest, err := env.roleRepo.GetByID(ctx, role.GetID())
+		if err != nil {
+			t.Fatalf("GetByID failed: %v", err)
+		}
+		perms := append([]string(nil), latest.Permissions...)
+		sort.Strings(perms)
+		return perms
+	}
+
+	// 整体替换（重复项去重）
+	if _, err := roleService.ReplacePermissions(ctx, role.GetID(), []string{"bulk:delete", "bulk:export", "bulk:delete"}); err != nil {
+		t.Fatalf("ReplacePermissions failed: %v", err)
+	}
+	if got := strings.Join(reload(), ","); got != "bulk:delete,bulk:export" {
+		t.Fatalf("unexpected permissions after replace: %s", got)
+	}
+
+	// 批量中含未知权限：整体拒绝，权限不变
+	if _, err := roleService.ReplacePermissions(ctx, role.GetID(), []string{"bulk:read", "bulk:ghost"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for unknown permission, got %v", err)
+	}
+	if _, err := roleService.AddPermissions(ctx, role.GetID(), []string{"bulk:read", "bulk:ghost"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for unknown permission, got %v", err)
+	}
+	if got := strings.Join(reload(), ","); got != "bulk:delete,bulk:export" {
+		t.Fatalf("expected permissions unchanged after rejected batch, got %s", got)
+	}
+
+	// 批量添加 / 移除
+	if _, err := roleService.AddPermissions(ctx, role.GetID(), []string{"bulk:read", "bulk:write", "bulk:export"}); err != nil {
+		t.Fatalf("AddPermissions failed: %v", err)
+	}
+	updated, err := roleService.RemovePermissions(ctx, role.GetID(), []string{"bulk:delete", "bulk:export", "bulk:absent"})
+	if err != nil {
+		t.Fatalf("RemovePermissions failed: %v", err)
+	}
+	if got := strings.Join(reload(), ","); got != "bulk:read,bulk:write" || len(updated.Permissions) != 2 {
+		t.Fatalf("unexpected permissions after add/remove: %s", got)
+	}
+
+	// 批量移除同样校验结果集合的依赖：移除被依赖的权限整体拒绝
+	roleService.SetPermissionDependencies(map[string][]string{"bulk:write": {"bulk:read"}})
+	roleService.SetPermissionDependencyMode(svc.PermissionDependencyModeEnforce)
+	if _, err := roleService.RemovePermissions(ctx, role.GetID(), []string{"bulk:read"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for removing a dependency, got %v", err)
+	}
+	if got := strings.Join(reload(), ","); got != "bulk:read,bulk:write" {
+		t.Fatalf("expected permissions unchanged after rejected removal, got %s", got)
+	}
+	roleService.SetPermissionDependencies(nil)
+
+	// 单个权限编辑与批量编辑一样吊销角色用户的 token
+	const secret = "bulk-revoke-secret"
+	holder, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "bulk_holder",
+		Email:    "bulk_holder@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := env.userService.AssignRole(ctx, holder.GetID(), role.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	roleService.SetRevokeSessionsOnChange(true)
+	for _, edit := range []func() error{
+		func() error { return roleService.AddPermission(ctx, role.GetID(), "bulk:delete") },
+		func() error { return roleService.RemovePermission(ctx, role.GetID(), "bulk:delete") },
+	} {
+		token, err := iammw.GenerateToken(holder.GetID(), holder.Username, []string{role.Name}, nil, secret)
+		if err != nil {
+			t.Fatalf("generate token: %v", err)
+		}
+		if err := edit(); err != nil {
+			t.Fatalf("edit permission failed: %v", err)
+		}
+		claims, err := iammw.ParseToken(token, secret)
+		if err != nil {
+			t.Fatalf("parse token: %v", err)
+		}
+		if !iammw.IsTokenRevoked(claims) {
+			t.Fatal("expected single permission edit to revoke role holder's token")
+		}
+	}
+
+	// 空集合拒绝
+	if _, err := roleService.ReplacePermissions(ctx, role.GetID(), nil); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for empty replace, got %v", err)
+	}
+
+	// 系统角色不能修改
+	systemRole := &iamentity.Role{
+		Name:        "bulk_system_role",
+		Permissions: iamentity.PermissionArray{"bulk:read"},
+		IsSystem:    true,
+		Status:      svc.RoleStatusActive,
+	}
+	if err := env.roleRepo.Create(ctx, systemRole); err != nil {
+		t.Fatalf("create system role: %v", err)
+	}
+	if _, err := roleService.ReplacePermissions(ctx, systemRole.GetID(), []string{"bulk:write"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for system role replace, got %v", err)
+	}
+	if _, err := roleService.AddPermissions(ctx, systemRole.GetID(), []string{"bulk:write"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for system role add, got %v", err)
+	}
+	if _, err := roleService.RemovePermissions(ctx, systemRole.GetID(), []string{"bulk:read"}); !errorx.Is(err, errorx.Validation) {
+		t.Fatalf("expected Validation for system role remove, got %v", err)
+	}
+}
+
+func TestRoleRepoFindByPermission(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	reader := env.createTestRole(t, "perm_reader", []string{"user:read", "task:read"})
+	writer := env.createTestRole(t, "perm_writer", []string{"user:write", "user:read_all"})
+	env.createTestRole(t, "perm_other", []string{"task:read"})
+	deleted := env.createTestRole(t, "perm_deleted", []string{"user:read"})
+	if err := env.db.Exec("UPDATE roles SET deleted_at = ? WHERE id = ?", time.Now(), deleted.GetID()).Error; err != nil {
+		t.Fatalf("soft delete role: %v", err)
+	}
+
+	names := func(permission string) string {
+		t.Helper()
+		roles, err := env.roleRepo.FindByPermission(ctx, permission)
+		if err != nil {
+			t.Fatalf("FindByPermission(%q) failed: %v", permission, err)
+		}
+		got := make([]string, 0, len(roles))
+		for _, role := range roles {
+			got = append(got, role.Name)
+		}
+		sort.Strings(got)
+		return strings.Join(got, ",")
+	}
+
+	// 仅返回实际持有该权限的角色（不含软删角色）
+	if got := names("user:read"); got != reader.Name {
+		t.Fatalf("expected only %s for user:read, got %q", reader.Name, got)
+	}
+	if got := names("user:write"); got != writer.Name {
+		t.Fatalf("expected only %s for user:write, got %q", writer.Name, got)
+	}
+	if got := names("task:read"); got != "perm_other,perm_reader" {
+		t.Fatalf("unexpected roles for task:read: %q", got)
+	}
+
+	// 前缀/子串不构成匹配
+	for _, permission := range []string{"user:re", "user", "read", "user:read_"} {
+		if got := names(permission); got != "" {
+			t.Fatalf("expected no roles for %q, got %q", permission, got)
+		}
+	}
+}
+
+func TestRoleServiceGetRoleUsageStats(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	role := env.createTestRole(t, "usage_role", []string{"user:read"})
+	idle := env.createTestRole(t, "usage_idle", []string{"user:read"})
+	for _, username := range []string{"usage_alice", "usage_bob"} {
+		user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+			Username: username,
+			Email:    username + "@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if err := env.userService.AssignRole(ctx, user.GetID(), role.GetID()); err != nil {
+			t.Fatalf("AssignRole failed: %v", err)
+		}
+	}
+	group := env.createTestGroup(t, "usage_group", nil)
+	if err := env.groupService.AddGroupRole(ctx, group.GetID(), role.GetID()); err != nil {
+		t.Fatalf("AddGroupRole failed: %v", err)
+	}
+
+	stats, err := roleService.GetRoleUsageStats(ctx)
+	if err != nil {
+		t.Fatalf("GetRoleUsageStats failed: %v", err)
+	}
+	byID := make(map[int64]rolerepo.RoleUsageStat, len(stats))
+	for _, stat := range stats {
+		byID[stat.ID] = stat
+	}
+	got, ok := byID[role.GetID()]
+	if !ok || got.Name != "usage_role" || got.UserCount != 2 || got.GroupCount != 1 || got.Status != svc.RoleStatusActive || got.IsSystem {
+		t.Fatalf("unexpected stats for assigned role: %+v", got)
+	}
+	if got := byID[idle.GetID()]; got.UserCount != 0 || got.GroupCount != 0 {
+		t.Fatalf("unexpected stats for idle role: %+v", got)
+	}
+}
+
+// TestUserServicePermissionCache 测试权限缓存命中与角色变更失效
+func TestUserServicePermissionCache(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+	ctx := env.backgroundCtx
+
+	iammw.RegisterRequiredPermissions("cache:read", "cache:write", "cache:export")
+	svc.SetDefaultPermissionCache(svc.NewMemoryPermissionCache(time.Minute, 0))
+	defer svc.SetDefaultPermissionCache(nil)
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+
+	user, err := env.userService.Register(ctx, &svc.RegisterRequest{
+		Username: "cache_user",
+		Email:    "cache@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	role := env.createTestRole(t, "cache_role", []string{"cache:read"})
+	snapshot := func() string {
+		t.Helper()
+		result, err := env.userService.GetAuthSnapshot(ctx, user.GetID())
+		if err != nil {
+			t.Fatalf("GetAuthSnapshot failed: %v", err)
+		}
+		return strings.Join(result.Roles, ",") + "|" + strings.Join(result.Permissions, ",")
+	}
+
+	// 分配角色失效缓存
+	before := snapshot()
+	if err := env.userService.AssignRole(ctx, user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("AssignRole failed: %v", err)
+	}
+	assigned := snapshot()
+	if assigned == before || !strings.Contains(assigned, "cache:read") {
+		t.Fatalf("expected assigned role in snapshot, got %q", assigned)
+	}
+
+	// 绕过服务直接修改数据库：命中缓存，仍返回旧权限
+	if err := env.db.Model(&iamentity.Role{}).Where("id = ?", role.GetID()).
+		Update("permissions", `["cache:write"]`).Error; err != nil {
+		t.Fatalf("update role permissions: %v", err)
+	}
+	if got := snapshot(); got != assigned {
+		t.Fatalf("expected cache hit %q, got %q", assigned, got)
+	}
+
+	// 角色权限变更失效全部缓存
+	if err := roleService.AddPermission(ctx, role.GetID(), "cache:export"); err != nil {
+		t.Fatalf("AddPermission failed: %v", err)
+	}
+	got := snapshot()
+	if !strings.Contains(got, "cache:export") || !strings.Contains(got, "cache:write") || strings.Contains(got, "cache:read") {
+		t.Fatalf("expected fresh permissions after role change, got %q", got)
+	}
+
+	// 移除角色失效缓存
+	if err := env.userService.RemoveRole(ctx, user.GetID(), role.GetID()); err != nil {
+		t.Fatalf("RemoveRole failed: %v", err)
+	}
+	if got := snapshot(); strings.Contains(got, "cache_role") || strings.Contains(got, "cache:") {
+		t.Fatalf("expected role removed from snapshot, got %q", got)
+	}
+}
+
+// TestRoleServiceAssignRoleToUserRollsBack 测试分配角色的多步写入在同一事务内提交或回滚
+func TestRoleServiceAssignRoleToUserRollsBack(t *testing.T) {
+	env := setupUserServiceTest(t)
+	defer env.teardown(t)
+
+	roleService := rolesvc.NewRoleService(env.roleRepo, env.userRepo, env.groupRepo, nil)
+	role := env.createTestRole(t, "tx_assign_role", []string{"perm:tx"})
+	user, err := env.userService.Register(env.backgroundCtx, &svc.RegisterRequest{
+		Username: "tx_assign_user",
+		Email:    "tx_assign_user@example.com",
+		Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	// 注入来源组织写入失败：关联已插入后触发器中止
+	if err := env.db.Exec(`CREATE TRIGGER fail_role_source BEFORE UPDATE OF source_group_id ON user_roles
+		BEGIN SELECT RAISE(ABORT, 'injected source failure'); END`).Error; err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+	if err := roleService.AssignRoleToUser(env.backgroundCtx, role.GetID(), user.GetID()); !errorx.Is(err, errorx.Database) {
+		t.Fatalf("expected Database error on source failure, got %v", err)
+	}
+
+	// 关联插入随事务回滚
+	var n int64
+	if err := env.db.Table("user_roles").Where("user_id = ? AND role_id = ?", user.GetID(), role.GetID()).Count(&n).Error; err != nil {
+		t.Fatalf("count user_roles: %v", err)
+	}
+	if n != 0 {
+		t.Fatalf("expected assignment rolled back, found %d rows", n)
+	}
+
+	// 移除故障后正常分配
+	if err := env.db.Exec(`DROP TRIGGER fail_role_source`).Error; err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	if err := roleService.AssignRoleToUser(env.backgroundCtx, role.GetID(), user.GetID()); err != nil {
+		t.Fatalf("AssignRoleToUser failed: %v", err)
+	}
+	if err := env.db.Table("user_roles").Where("user_id = ? AND role_id = ?", user.GetID(), role.GetID()).Count(&n).Error; err != nil {
+		t.Fatalf("count user_roles: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected one assignment, found %d rows", n)
+	}
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 	"strings"
 
 	iamentity "gochen-iam/entity"
@@ -17,6 +19,9 @@ type BusinessValidator struct {
 	userRepo  *userrepo.UserRepo
 	groupRepo *grouprepo.GroupRepo
 	roleRepo  *rolerepo.RoleRepo
+
+	// nameCaseFold 角色/组织名称唯一性检查是否忽略大小写（见 NormalizeName）
+	nameCaseFold bool
 }
 
 // NewBusinessValidator 创建业务验证器
@@ -32,6 +37,11 @@ func NewBusinessValidator(
 	}
 }
 
+// SetNameCaseFold 设置角色/组织名称唯一性检查是否忽略大小写（与所属服务的 SetNameCaseFold 保持一致）
+func (v *BusinessValidator) SetNameCaseFold(enabled bool) {
+	v.nameCaseFold = enabled
+}
+
 // 用户相关业务规则验证
 
 // ValidateUserRegistration 验证用户注册业务规则
@@ -42,7 +52,7 @@ func (v *BusinessValidator) ValidateUserRegistration(ctx context.Context, req *R
 	}
 
 	// 2. 用户名唯一性验证
-	if err := v.validateUsernameUniqueness(ctx, req.Username); err != nil {
+	if err := v.validateUsernameUniqueness(ctx, req.Username, 0); err != nil {
 		return err
 	}
 
@@ -59,6 +69,17 @@ func (v *BusinessValidator) ValidateUserRegistration(ctx context.Context, req *R
 	return nil
 }
 
+// ValidateUsernameChange 验证用户名变更业务规则（与注册相同的格式与唯一性规则，排除用户自身）
+func (v *BusinessValidator) ValidateUsernameChange(ctx context.Context, userID int64, username string) error {
+	// 1. 基础字段验证
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	// 2. 用户名唯一性验证
+	return v.validateUsernameUniqueness(ctx, username, userID)
+}
+
 // ValidateUserUpdate 验证用户更新业务规则
 func (v *BusinessValidator) ValidateUserUpdate(ctx context.Context, userID int64, req *UpdateUserRequest) error {
 	// 1. 用户是否存在
@@ -76,32 +97,91 @@ func (v *BusinessValidator) ValidateUserUpdate(ctx context.Context, userID int64
 
 	// 3. 头像URL验证
 	if req.Avatar != "" {
-		if err := v.validateAvatarURL(req.Avatar); err != nil {
+		if err := ValidateAvatarURL(req.Avatar); err != nil {
 			return err
 		}
 	}
 
+	// 4. 资料字段验证
+	return validateProfileFields(req)
+}
+
+// validateProfileFields 验证显示名、手机号与语言区域（为空表示不修改，跳过）
+func validateProfileFields(req *UpdateUserRequest) error {
+	if req.DisplayName != "" {
+		if _, err := NormalizeDisplayName(req.DisplayName); err != nil {
+			return err
+		}
+	}
+	if req.Phone != "" {
+		if _, err := NormalizePhone(req.Phone); err != nil {
+			return err
+		}
+	}
+	if req.Locale != "" {
+		if _, err := NormalizeLocale(req.Locale); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureNotLastSystemAdmin 确保 userID 失去管理员能力（删除、停用、锁定或移除 system_admin 角色）后仍有其他可用的系统管理员
+//
+// userID 未持有 system_admin 角色时直接通过；其他管理员仅计入 active 状态且分配未过期的用户（按角色名查找，不假设角色 ID）。
+// 否则返回 Validation 错误，message 说明被拒绝的操作。
+//
+// 按名称查不到 system_admin 角色时 fail-close：只要该用户关联了同名角色（含已过期的分配）即拒绝，无法确认是否仍有其他管理员。
+func (v *BusinessValidator) EnsureNotLastSystemAdmin(ctx context.Context, userID int64, message string) error {
+	adminRole, err := v.roleRepo.FindByName(ctx, SystemAdminRoleName)
+	if err != nil {
+		if !errorx.Is(err, errorx.NotFound) {
+			return err
+		}
+		user, err := v.userRepo.GetWithRelations(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user.HasRole(SystemAdminRoleName) {
+			return errorx.New(errorx.Validation, message)
+		}
+		return nil
+	}
+	adminUsers, err := v.userRepo.FindByRoleID(ctx, adminRole.GetID())
+	if err != nil {
+		return err
+	}
+
+	isAdmin := false
+	otherActive := 0
+	for _, admin := range adminUsers {
+		if admin.GetID() == userID {
+			isAdmin = true
+			continue
+		}
+		if admin.IsActive() {
+			otherActive++
+		}
+	}
+	if isAdmin && otherActive == 0 {
+		return errorx.New(errorx.Validation, message)
+	}
 	return nil
 }
 
 // ValidateUserDeletion 验证用户删除业务规则
 func (v *BusinessValidator) ValidateUserDeletion(ctx context.Context, userID int64) error {
-	// 1. 用户是否存在
-	user, err := v.userRepo.GetByID(ctx, userID)
+	// 1. 用户是否存在（需加载角色以判断是否为系统管理员）
+	user, err := v.userRepo.GetWithRelations(ctx, userID)
 	if err != nil {
 		return err
 	}
 
-	// 2. 检查是否为系统管理员
+	// 2. 检查是否为最后一个系统管理员
 	if user.HasRole(SystemAdminRoleName) {
-		// 检查是否为最后一个系统管理员
-		adminUsers, err := v.userRepo.FindByRoleID(ctx, 1) // 假设系统管理员角色ID为1
-		if err != nil {
+		if err := v.EnsureNotLastSystemAdmin(ctx, userID, "不能删除最后一个系统管理员"); err != nil {
 			return err
 		}
-		if len(adminUsers) <= 1 {
-			return errorx.New(errorx.Validation, "不能删除最后一个系统管理员")
-		}
 	}
 
 	// 3. 检查用户是否有重要的业务关联
@@ -127,7 +207,7 @@ func (v *BusinessValidator) ValidateGroupCreation(ctx context.Context, req *Crea
 	}
 
 	// 3. 同级组织名称唯一性验证
-	if err := v.validateGroupNameUniqueness(ctx, req.Name, req.ParentID); err != nil {
+	if err := v.validateGroupNameUniqueness(ctx, req.Name, req.ParentID, 0); err != nil {
 		return err
 	}
 
@@ -144,7 +224,7 @@ func (v *BusinessValidator) ValidateGroupUpdate(ctx context.Context, groupID int
 
 	// 2. 名称唯一性验证（如果更改了名称）
 	if req.Name != "" && req.Name != group.Name {
-		if err := v.validateGroupNameUniqueness(ctx, req.Name, group.ParentID); err != nil {
+		if err := v.validateGroupNameUniqueness(ctx, req.Name, group.ParentID, groupID); err != nil {
 			return err
 		}
 	}
@@ -159,6 +239,17 @@ func (v *BusinessValidator) ValidateGroupUpdate(ctx context.Context, groupID int
 	return nil
 }
 
+// ValidateGroupMove 验证组织移动业务规则（newParentID 为 nil 表示移动为根组织）
+func (v *BusinessValidator) ValidateGroupMove(ctx context.Context, group *iamentity.Group, newParentID *int64) error {
+	// 1. 父组织变更验证（自身/环/目标层级）
+	if err := v.validateGroupParentChange(ctx, group, newParentID); err != nil {
+		return err
+	}
+
+	// 2. 新父组织下名称唯一性验证
+	return v.validateGroupNameUniqueness(ctx, group.Name, newParentID, group.GetID())
+}
+
 // ValidateGroupDeletion 验证组织删除业务规则
 func (v *BusinessValidator) ValidateGroupDeletion(ctx context.Context, groupID int64) error {
 	// 1. 组织是否存在
@@ -265,11 +356,8 @@ func (v *BusinessValidator) ValidateRoleDeletion(ctx context.Context, roleID int
 
 // validateUserBasicFields 验证用户基础字段
 func (v *BusinessValidator) validateUserBasicFields(username, email, password string) error {
-	if err := validation.ValidateRequired(username, "username"); err != nil {
-		return errorx.New(errorx.Validation, "用户名不能为空")
-	}
-	if err := validation.ValidateStringLength(username, "username", MinUsernameLength, MaxUsernameLength); err != nil {
-		return errorx.New(errorx.Validation, "用户名长度必须在3-50个字符之间")
+	if err := validateUsername(username); err != nil {
+		return err
 	}
 	if err := validation.ValidateRequired(email, "email"); err != nil {
 		return errorx.New(errorx.Validation, "邮箱不能为空")
@@ -277,22 +365,27 @@ func (v *BusinessValidator) validateUserBasicFields(username, email, password st
 	if err := validation.ValidateEmail(email); err != nil {
 		return errorx.New(errorx.Validation, "邮箱格式不正确")
 	}
-	if err := validation.ValidateRequired(password, "password"); err != nil {
-		return errorx.New(errorx.Validation, "密码不能为空")
+	return ValidatePassword(password)
+}
+
+// validateUsername 验证用户名必填与长度
+func validateUsername(username string) error {
+	if err := validation.ValidateRequired(username, "username"); err != nil {
+		return errorx.New(errorx.Validation, "用户名不能为空")
 	}
-	if err := validation.ValidateStringLength(password, "password", MinPasswordLength, 0); err != nil {
-		return errorx.New(errorx.Validation, "密码长度不能少于6个字符")
+	if err := validation.ValidateStringLength(username, "username", MinUsernameLength, MaxUsernameLength); err != nil {
+		return errorx.New(errorx.Validation, "用户名长度必须在3-50个字符之间")
 	}
 	return nil
 }
 
-// validateUsernameUniqueness 验证用户名唯一性
-func (v *BusinessValidator) validateUsernameUniqueness(ctx context.Context, username string) error {
+// validateUsernameUniqueness 验证用户名唯一性（excludeID 为更新时排除的用户自身，0 表示不排除）
+func (v *BusinessValidator) validateUsernameUniqueness(ctx context.Context, username string, excludeID int64) error {
 	existingUser, err := v.userRepo.FindByUsername(ctx, username)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
 		return errorx.Wrap(err, errorx.Database, "检查用户名失败")
 	}
-	if existingUser != nil {
+	if existingUser != nil && existingUser.GetID() != excludeID {
 		return errorx.New(errorx.Validation, "用户名已存在")
 	}
 	return nil
@@ -312,26 +405,30 @@ func (v *BusinessValidator) validateEmailUniqueness(ctx context.Context, email s
 
 // validatePasswordStrength 验证密码强度
 func (v *BusinessValidator) validatePasswordStrength(password string) error {
-	// 基础长度检查
-	if err := validation.ValidateStringLength(password, "password", MinPasswordLength, 0); err != nil {
-		return errorx.New(errorx.Validation, "密码长度不能少于6个字符")
-	}
-	if err := validation.ValidateStringLength(password, "password", 0, MaxPasswordLength); err != nil {
-		return errorx.New(errorx.Validation, "密码长度不能超过255个字符")
-	}
-
-	// 可以添加更多密码强度规则
-	// 例如：必须包含大小写字母、数字、特殊字符等
-
-	return nil
+	// 长度与字符类别要求（见 PasswordPolicyFromEnv）
+	return ValidatePassword(password)
 }
 
-// validateAvatarURL 验证头像URL
-func (v *BusinessValidator) validateAvatarURL(avatar string) error {
-	if err := validation.ValidateStringLength(avatar, "avatar", 0, 500); err != nil {
+// ValidateAvatarURL 验证头像URL：须为绝对 http(s) 地址且不超过 500 个字符（空值视为不修改，直接通过）
+//
+// 拒绝 javascript:、data: 等其他协议、相对路径与缺少主机的地址，避免头像字段被用于注入脚本或内联大体积数据。
+func ValidateAvatarURL(avatar string) error {
+	if avatar == "" {
+		return nil
+	}
+	if err := validation.ValidateStringLength(avatar, "avatar", 0, MaxAvatarURLLength); err != nil {
 		return errorx.New(errorx.Validation, "头像URL长度不能超过500个字符")
 	}
-	// 可以添加URL格式验证
+	u, err := url.Parse(avatar)
+	if err != nil {
+		return errorx.New(errorx.Validation, "头像URL格式不正确")
+	}
+	if scheme := strings.ToLower(u.Scheme); scheme != "http" && scheme != "https" {
+		return errorx.New(errorx.Validation, "头像URL必须以 http:// 或 https:// 开头")
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return errorx.New(errorx.Validation, "头像URL缺少主机名")
+	}
 	return nil
 }
 
@@ -351,35 +448,37 @@ func (v *BusinessValidator) validateGroupBasicFields(name, description string) e
 
 // validateParentGroup 验证父组织
 func (v *BusinessValidator) validateParentGroup(ctx context.Context, parentID int64) error {
-	parent, err := v.groupRepo.GetByID(ctx, parentID)
-	if err != nil {
+	if _, err := v.groupRepo.GetByID(ctx, parentID); err != nil {
 		return errorx.Wrap(err, errorx.NotFound, "父组织不存在")
 	}
-	if parent.Level >= MaxGroupLevel {
-		return errorx.New(errorx.Validation, "组织层级不能超过10级")
-	}
-	return nil
+	_, err := v.ChildGroupLevel(ctx, parentID)
+	return err
 }
 
-// validateGroupNameUniqueness 验证组织名称唯一性（同级）
-func (v *BusinessValidator) validateGroupNameUniqueness(ctx context.Context, name string, parentID *int64) error {
-	var (
-		groups []*iamentity.Group
-		err    error
-	)
-
-	if parentID == nil {
-		groups, err = v.groupRepo.FindRootGroups(ctx)
-	} else {
-		groups, err = v.groupRepo.FindChildren(ctx, *parentID)
+// ChildGroupLevel 返回在 parentID 下新建子组织的层级，超过 MaxGroupLevel 时返回 Validation
+//
+// 父组织深度按实际祖先链计算（祖先数 + 1），不信任缓存的 Level 字段，避免 Level 失真时子树突破 MaxGroupLevel。
+func (v *BusinessValidator) ChildGroupLevel(ctx context.Context, parentID int64) (int, error) {
+	ancestors, err := v.groupRepo.FindAncestors(ctx, parentID)
+	if err != nil {
+		return 0, err
 	}
+	level := len(ancestors) + 2
+	if level > MaxGroupLevel {
+		return 0, errorx.New(errorx.Validation, fmt.Sprintf("组织层级不能超过%d级", MaxGroupLevel)).
+			WithContext("max_level", MaxGroupLevel)
+	}
+	return level, nil
+}
+
+// validateGroupNameUniqueness 验证组织名称唯一性（同级，按规范化后的名称比较；excludeID 为自身 ID，0 表示不排除）
+func (v *BusinessValidator) validateGroupNameUniqueness(ctx context.Context, name string, parentID *int64, excludeID int64) error {
+	exists, err := v.groupRepo.ExistsByNormalizedName(ctx, NormalizeName(name, v.nameCaseFold), parentID, excludeID, v.nameCaseFold)
 	if err != nil {
 		return err
 	}
-	for _, group := range groups {
-		if group.Name == name {
-			return errorx.New(errorx.Validation, "同一层级下组织名称不能重复")
-		}
+	if exists {
+		return errorx.New(errorx.Validation, "同一层级下组织名称不能重复")
 	}
 	return nil
 }
@@ -403,9 +502,9 @@ func (v *BusinessValidator) validateGroupParentChange(ctx context.Context, group
 			return errorx.New(errorx.Validation, "不能将组织移动到其子组织下")
 		}
 
-		// 检查新父组织层级
-		if newParent.Level >= MaxGroupLevel {
-			return errorx.New(errorx.Validation, "目标组织层级过深")
+		// 检查新父组织层级（与创建一致按实际祖先链计算，不信任缓存的 Level 字段）
+		if _, err := v.ChildGroupLevel(ctx, newParent.GetID()); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -425,9 +524,9 @@ func (v *BusinessValidator) validateRoleBasicFields(name, description string) er
 	return nil
 }
 
-// validateRoleNameUniqueness 验证角色名称唯一性
+// validateRoleNameUniqueness 验证角色名称唯一性（按规范化后的名称比较）
 func (v *BusinessValidator) validateRoleNameUniqueness(ctx context.Context, name string) error {
-	existingRole, err := v.roleRepo.FindByName(ctx, name)
+	existingRole, err := v.roleRepo.FindByNormalizedName(ctx, NormalizeName(name, v.nameCaseFold), v.nameCaseFold)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
 		return errorx.Wrap(err, errorx.Database, "检查角色名称失败")
 	}
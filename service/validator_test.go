@@ -0,0 +1,41 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"gochen/errorx"
+)
+
+func TestValidateAvatarURL(t *testing.T) {
+	valid := []string{
+		"",
+		"https://cdn.example.com/avatars/1.png",
+		"http://example.com/a.jpg?size=64",
+		"HTTPS://EXAMPLE.COM/A.PNG",
+		"https://example.com:8443/a.png",
+	}
+	for _, avatar := range valid {
+		if err := ValidateAvatarURL(avatar); err != nil {
+			t.Errorf("ValidateAvatarURL(%q) = %v; want nil", avatar, err)
+		}
+	}
+
+	invalid := []string{
+		"javascript:alert(1)",
+		"data:image/png;base64,iVBORw0KGgo=",
+		"ftp://example.com/a.png",
+		"/avatars/1.png",
+		"avatars/1.png",
+		"//example.com/a.png",
+		"https://",
+		"https:///a.png",
+		"http://exa mple.com/a.png",
+		"https://example.com/" + strings.Repeat("a", MaxAvatarURLLength),
+	}
+	for _, avatar := range invalid {
+		if err := ValidateAvatarURL(avatar); !errorx.Is(err, errorx.Validation) {
+			t.Errorf("ValidateAvatarURL(%q) = %v; want Validation error", avatar, err)
+		}
+	}
+}